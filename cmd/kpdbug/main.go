@@ -7,7 +7,15 @@ import (
 	"github.com/the-kernel-panics/k8s-pods-debug/pkg/plugin"
 )
 
+// Set by the release build through ldflags
+var (
+	version = "dev"
+	commit  = "none"
+	date    = "unknown"
+)
+
 func main() {
+	plugin.SetVersionInfo(version, commit, date)
 	if err := plugin.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
@@ -0,0 +1,179 @@
+//go:build e2e
+
+// Package e2e runs the kpdbug binary against a real cluster: a kind cluster
+// it creates, or the cluster of KPDBUG_E2E_KUBECONFIG.
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultClusterName is the kind cluster the suite creates
+	defaultClusterName = "kpdbug-e2e"
+	// debugImage is small, public and has a shell
+	debugImage = "busybox:1.36"
+	// targetImage is the image of the pods the suite debugs
+	targetImage = "nginx:1.27-alpine"
+)
+
+// Cluster is the cluster under test and the kpdbug binary built for it
+type Cluster struct {
+	Name       string
+	Kubeconfig string
+	Binary     string
+	// owned is set when the suite created the kind cluster
+	owned bool
+}
+
+// Result is the outcome of one command
+type Result struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// SetUp builds kpdbug into dir and returns the cluster to test against.
+// KPDBUG_E2E_KUBECONFIG selects an existing cluster; otherwise a kind
+// cluster named KPDBUG_E2E_CLUSTER (default kpdbug-e2e) is created.
+func SetUp(ctx context.Context, dir string) (*Cluster, error) {
+	cluster := &Cluster{Name: os.Getenv("KPDBUG_E2E_CLUSTER"), Binary: filepath.Join(dir, "kpdbug")}
+	if cluster.Name == "" {
+		cluster.Name = defaultClusterName
+	}
+
+	build := exec.CommandContext(ctx, "go", "build", "-o", cluster.Binary, "../../cmd/kpdbug")
+	if output, err := build.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("build kpdbug: %v - %s", err, output)
+	}
+
+	if kubeconfig := os.Getenv("KPDBUG_E2E_KUBECONFIG"); kubeconfig != "" {
+		cluster.Kubeconfig = kubeconfig
+		return cluster, nil
+	}
+
+	cluster.Kubeconfig = filepath.Join(dir, "kubeconfig")
+	existing, err := exec.CommandContext(ctx, "kind", "get", "clusters").Output()
+	if err != nil {
+		return nil, fmt.Errorf("kind is required unless KPDBUG_E2E_KUBECONFIG is set: %v", err)
+	}
+	if !containsLine(string(existing), cluster.Name) {
+		create := exec.CommandContext(ctx, "kind", "create", "cluster", "--name", cluster.Name, "--wait", "180s")
+		if output, err := create.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("create kind cluster %s: %v - %s", cluster.Name, err, output)
+		}
+		cluster.owned = true
+	}
+	kubeconfig, err := exec.CommandContext(ctx, "kind", "get", "kubeconfig", "--name", cluster.Name).Output()
+	if err != nil {
+		cluster.TearDown(ctx)
+		return nil, fmt.Errorf("get kubeconfig of %s: %v", cluster.Name, err)
+	}
+	if err := os.WriteFile(cluster.Kubeconfig, kubeconfig, 0o600); err != nil {
+		cluster.TearDown(ctx)
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// TearDown deletes the kind cluster if the suite created it, unless
+// KPDBUG_E2E_KEEP=1
+func (c *Cluster) TearDown(ctx context.Context) {
+	if !c.owned || os.Getenv("KPDBUG_E2E_KEEP") == "1" {
+		return
+	}
+	_ = exec.CommandContext(ctx, "kind", "delete", "cluster", "--name", c.Name).Run()
+}
+
+func containsLine(output, line string) bool {
+	for _, l := range strings.Split(output, "\n") {
+		if strings.TrimSpace(l) == line {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Cluster) run(ctx context.Context, name string, args ...string) Result {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), "KUBECONFIG="+c.Kubeconfig)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	result := Result{Stdout: stdout.String(), Stderr: stderr.String()}
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	case err != nil:
+		result.ExitCode = -1
+		result.Stderr += err.Error()
+	}
+	return result
+}
+
+// Kpdbug runs the kpdbug binary against the cluster
+func (c *Cluster) Kpdbug(ctx context.Context, args ...string) Result {
+	return c.run(ctx, c.Binary, args...)
+}
+
+// Kubectl runs kubectl against the cluster
+func (c *Cluster) Kubectl(ctx context.Context, args ...string) Result {
+	return c.run(ctx, "kubectl", args...)
+}
+
+// CreateNamespace creates a namespace with a unique name for one test
+func (c *Cluster) CreateNamespace(ctx context.Context, prefix string) (string, error) {
+	name := fmt.Sprintf("%s-%d", prefix, time.Now().UnixNano()%1000000)
+	if result := c.Kubectl(ctx, "create", "namespace", name); result.ExitCode != 0 {
+		return "", fmt.Errorf("create namespace %s: %s", name, result.Stderr)
+	}
+	return name, nil
+}
+
+// DeleteNamespace deletes a test namespace without waiting for it to go
+func (c *Cluster) DeleteNamespace(ctx context.Context, name string) {
+	c.Kubectl(ctx, "delete", "namespace", name, "--wait=false")
+}
+
+// RunTarget starts a pod to debug and waits until it is ready
+func (c *Cluster) RunTarget(ctx context.Context, namespace, name string) error {
+	if result := c.Kubectl(ctx, "run", name, "-n", namespace, "--image", targetImage,
+		"--labels", "app="+name); result.ExitCode != 0 {
+		return fmt.Errorf("run target %s: %s", name, result.Stderr)
+	}
+	if result := c.Kubectl(ctx, "wait", "pod/"+name, "-n", namespace,
+		"--for=condition=Ready", "--timeout=180s"); result.ExitCode != 0 {
+		return fmt.Errorf("target %s did not become ready: %s", name, result.Stderr)
+	}
+	return nil
+}
+
+// Get returns a jsonpath expression evaluated on a resource
+func (c *Cluster) Get(ctx context.Context, namespace, resource, jsonpath string) (string, error) {
+	result := c.Kubectl(ctx, "get", resource, "-n", namespace, "-o", "jsonpath="+jsonpath)
+	if result.ExitCode != 0 {
+		return "", fmt.Errorf("get %s: %s", resource, result.Stderr)
+	}
+	return result.Stdout, nil
+}
+
+// DebugPods returns the names of the debug pods kpdbug labeled in namespace
+func (c *Cluster) DebugPods(ctx context.Context, namespace string) ([]string, error) {
+	result := c.Kubectl(ctx, "get", "pods", "-n", namespace, "-l", "debug-tool/type=debug-pod",
+		"-o", "jsonpath={.items[*].metadata.name}")
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("list debug pods: %s", result.Stderr)
+	}
+	return strings.Fields(result.Stdout), nil
+}
@@ -0,0 +1,205 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var cluster *Cluster
+
+func TestMain(m *testing.M) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	dir, err := os.MkdirTemp("", "kpdbug-e2e")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	cluster, err = SetUp(ctx, dir)
+	cancel()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+
+	cluster.TearDown(context.Background())
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testNamespace creates a namespace with a ready target pod for the test
+func testNamespace(t *testing.T, ctx context.Context, target string) string {
+	t.Helper()
+	namespace, err := cluster.CreateNamespace(ctx, "kpdbug-e2e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cluster.DeleteNamespace(context.Background(), namespace) })
+	if target != "" {
+		if err := cluster.RunTarget(ctx, namespace, target); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return namespace
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func mustKpdbug(t *testing.T, ctx context.Context, args ...string) Result {
+	t.Helper()
+	result := cluster.Kpdbug(ctx, args...)
+	if result.ExitCode != 0 {
+		t.Fatalf("kpdbug %s exited with %d\nstdout: %s\nstderr: %s",
+			strings.Join(args, " "), result.ExitCode, result.Stdout, result.Stderr)
+	}
+	return result
+}
+
+func TestStandalonePod(t *testing.T) {
+	ctx := testContext(t)
+	namespace := testNamespace(t, ctx, "")
+
+	result := mustKpdbug(t, ctx, "-n", namespace, "--image", debugImage, "-o", "name")
+	pod := strings.TrimSpace(result.Stdout)
+	if pod == "" {
+		t.Fatalf("-o name printed no pod name; stderr: %s", result.Stderr)
+	}
+
+	phase, err := cluster.Get(ctx, namespace, "pod/"+pod, "{.status.phase}")
+	if err != nil || phase != "Running" {
+		t.Errorf("debug pod phase = %q, %v", phase, err)
+	}
+	image, _ := cluster.Get(ctx, namespace, "pod/"+pod, "{.spec.containers[0].image}")
+	if image != debugImage {
+		t.Errorf("debug pod image = %q, want %s", image, debugImage)
+	}
+	nonRoot, _ := cluster.Get(ctx, namespace, "pod/"+pod, "{.spec.securityContext.runAsNonRoot}")
+	if nonRoot != "true" {
+		t.Errorf("debug pod runAsNonRoot = %q, want true", nonRoot)
+	}
+	pods, err := cluster.DebugPods(ctx, namespace)
+	if err != nil || len(pods) != 1 || pods[0] != pod {
+		t.Errorf("debug pods = %v, %v; want [%s]", pods, err, pod)
+	}
+}
+
+func TestStandaloneCommand(t *testing.T) {
+	ctx := testContext(t)
+	namespace := testNamespace(t, ctx, "")
+
+	// Quoting must survive the trip through kubectl exec
+	result := mustKpdbug(t, ctx, "-n", namespace, "--image", debugImage, "--rm",
+		"--command", `echo "kpdbug e2e" 'ok'`)
+	if !strings.Contains(result.Stdout, "kpdbug e2e ok") {
+		t.Errorf("stdout = %q, want the command output", result.Stdout)
+	}
+	if pods, _ := cluster.DebugPods(ctx, namespace); len(pods) != 0 {
+		t.Errorf("--rm left debug pods %v", pods)
+	}
+
+	result = cluster.Kpdbug(ctx, "-n", namespace, "--image", debugImage, "--rm", "--command", "exit 3")
+	if result.ExitCode != 3 {
+		t.Errorf("exit code = %d, want the remote command's 3; stderr: %s", result.ExitCode, result.Stderr)
+	}
+}
+
+func TestEphemeralContainer(t *testing.T) {
+	ctx := testContext(t)
+	namespace := testNamespace(t, ctx, "web")
+
+	result := mustKpdbug(t, ctx, "-n", namespace, "-p", "web", "--image", debugImage,
+		"--command", "echo ephemeral-$((40+2))")
+	if !strings.Contains(result.Stdout, "ephemeral-42") {
+		t.Errorf("stdout = %q, want the command output", result.Stdout)
+	}
+
+	images, err := cluster.Get(ctx, namespace, "pod/web", "{.spec.ephemeralContainers[*].image}")
+	if err != nil || !strings.Contains(images, debugImage) {
+		t.Errorf("ephemeral container images = %q, %v", images, err)
+	}
+	target, _ := cluster.Get(ctx, namespace, "pod/web", "{.spec.ephemeralContainers[0].targetContainerName}")
+	if target != "web" {
+		t.Errorf("ephemeral container targets %q, want web", target)
+	}
+	restarts, _ := cluster.Get(ctx, namespace, "pod/web", "{.status.containerStatuses[0].restartCount}")
+	if restarts != "0" {
+		t.Errorf("target restarted %s times", restarts)
+	}
+}
+
+func TestPodCopy(t *testing.T) {
+	ctx := testContext(t)
+	namespace := testNamespace(t, ctx, "web")
+
+	result := mustKpdbug(t, ctx, "-n", namespace, "-p", "web", "--copy", "--image", debugImage, "-o", "name")
+	copyName := strings.TrimSpace(result.Stdout)
+	if copyName == "" || copyName == "web" {
+		t.Fatalf("-o name printed %q; stderr: %s", copyName, result.Stderr)
+	}
+
+	containers, err := cluster.Get(ctx, namespace, "pod/"+copyName, "{.spec.containers[*].image}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if images := strings.Fields(containers); len(images) != 2 || images[0] != targetImage || images[1] != debugImage {
+		t.Errorf("copy containers = %q, want the target's and the debug container", containers)
+	}
+	shared, _ := cluster.Get(ctx, namespace, "pod/"+copyName, "{.spec.shareProcessNamespace}")
+	if shared != "true" {
+		t.Errorf("copy shareProcessNamespace = %q, want true", shared)
+	}
+	ephemeral, _ := cluster.Get(ctx, namespace, "pod/web", "{.spec.ephemeralContainers}")
+	if ephemeral != "" {
+		t.Errorf("the target was changed: ephemeral containers %s", ephemeral)
+	}
+}
+
+func TestListAndClean(t *testing.T) {
+	ctx := testContext(t)
+	namespace := testNamespace(t, ctx, "web")
+
+	// --force creates a second pod instead of reusing the first
+	var created []string
+	for i := 0; i < 2; i++ {
+		result := mustKpdbug(t, ctx, "-n", namespace, "--image", debugImage, "-o", "name", "--force")
+		created = append(created, strings.TrimSpace(result.Stdout))
+	}
+
+	list := mustKpdbug(t, ctx, "list", "-n", namespace)
+	for _, pod := range created {
+		if !strings.Contains(list.Stdout, pod) {
+			t.Errorf("list does not show %s:\n%s", pod, list.Stdout)
+		}
+	}
+
+	mustKpdbug(t, ctx, "clean", "-n", namespace, "--force")
+	for i := 0; i < 60; i++ {
+		pods, err := cluster.DebugPods(ctx, namespace)
+		if err == nil && len(pods) == 0 {
+			break
+		}
+		if i == 59 {
+			t.Fatalf("clean left debug pods %v (%v)", pods, err)
+		}
+		time.Sleep(time.Second)
+	}
+	if phase, err := cluster.Get(ctx, namespace, "pod/web", "{.status.phase}"); err != nil || phase != "Running" {
+		t.Errorf("clean touched the target: phase %q, %v", phase, err)
+	}
+
+	list = mustKpdbug(t, ctx, "list", "-n", namespace)
+	if !strings.Contains(list.Stdout+list.Stderr, "No debug pods found") {
+		t.Errorf("list after clean:\n%s", list.Stdout)
+	}
+}
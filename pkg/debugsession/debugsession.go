@@ -0,0 +1,169 @@
+// Package debugsession embeds the debug pod lifecycle of kpdbug in other Go
+// programs, without its command line flags: the cluster, identity and
+// streams are passed explicitly instead.
+//
+// The kpdbug config file and the cluster debug policy apply like in the CLI.
+// Progress is logged through the standard log package.
+package debugsession
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/the-kernel-panics/k8s-pods-debug/pkg/plugin"
+)
+
+// Options select the cluster and identity of every kubectl call and connect
+// the sessions
+type Options struct {
+	// Kubeconfig and Context select the cluster; empty uses kubectl's
+	// defaults
+	Kubeconfig string
+	Context    string
+	// As and AsGroups impersonate a user and groups
+	As       string
+	AsGroups []string
+	// Namespace defaults to the namespace of the kubeconfig context
+	Namespace string
+
+	// Stdin, Stdout and Stderr connect sessions and kubectl output; nil
+	// uses the process's own
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Runner runs kubectl; nil runs the kubectl binary
+	Runner plugin.KubectlRunner
+}
+
+// Request describes a debug session
+type Request struct {
+	// Target is the pod to debug; empty creates a standalone debug pod
+	Target string
+	// Copy debugs a copy of Target instead of adding an ephemeral container
+	Copy bool
+	// Image defaults to debug:latest
+	Image string
+	// Profile is a kpdbug security profile, e.g. "netadmin"
+	Profile string
+	// Command runs a shell command instead of an interactive shell
+	Command string
+	// Interactive attaches an interactive shell with a TTY
+	Interactive bool
+	// RemoveAfter deletes the debug pod when the session ends
+	RemoveAfter bool
+	// CPURequest, MemoryLimit and MemoryRequest default to 100m, 128Mi and
+	// 128Mi
+	CPURequest    string
+	MemoryLimit   string
+	MemoryRequest string
+}
+
+// config builds the DebugConfig of the options
+func (o Options) config(ctx context.Context) *plugin.DebugConfig {
+	flags := []string{}
+	if o.Kubeconfig != "" {
+		flags = append(flags, "--kubeconfig="+o.Kubeconfig)
+	}
+	if o.Context != "" {
+		flags = append(flags, "--context="+o.Context)
+	}
+	if o.As != "" {
+		flags = append(flags, "--as="+o.As)
+	}
+	for _, group := range o.AsGroups {
+		flags = append(flags, "--as-group="+group)
+	}
+
+	config := &plugin.DebugConfig{
+		Context:      ctx,
+		Runner:       o.Runner,
+		Namespace:    o.Namespace,
+		KubectlFlags: flags,
+		Stdin:        o.Stdin,
+		Stdout:       o.Stdout,
+		Stderr:       o.Stderr,
+	}
+	config.ResolveNamespace()
+	return config
+}
+
+// CreateSession creates a debug pod or container as the request describes,
+// runs the command or the interactive shell if requested, and returns what
+// it created. A debug pod of the same target is never reused.
+func CreateSession(ctx context.Context, opts Options, req Request) (*plugin.DebugResult, error) {
+	config := opts.config(ctx)
+	config.PodName = req.Target
+	config.CopyPod = req.Copy
+	config.Image = valueOr(req.Image, "debug:latest")
+	config.Profile = req.Profile
+	config.Command = req.Command
+	config.Interactive = req.Interactive
+	config.TTY = req.Interactive
+	config.RemoveAfter = req.RemoveAfter
+	config.Force = true
+	config.CPURequest = valueOr(req.CPURequest, "100m")
+	config.MemoryLimit = valueOr(req.MemoryLimit, "128Mi")
+	config.MemoryRequest = valueOr(req.MemoryRequest, "128Mi")
+
+	if req.RemoveAfter && !req.Interactive && req.Command == "" {
+		return nil, plugin.NewValidationError("RemoveAfter", "true", "needs Interactive or a Command")
+	}
+	switch {
+	case req.Target == "":
+		config.Operation = plugin.OperationStandalone
+	case req.Copy:
+		config.Operation = plugin.OperationCopyPod
+	default:
+		config.Operation = plugin.OperationAddContainer
+	}
+	return config.Execute()
+}
+
+// Attach opens an interactive shell in a debug pod
+func Attach(ctx context.Context, opts Options, pod string) error {
+	return opts.config(ctx).Attach(pod)
+}
+
+// List returns the debug pods in the namespace, or in all namespaces
+func List(ctx context.Context, opts Options, allNamespaces bool) ([]plugin.DebugPodInfo, error) {
+	return opts.config(ctx).ListDebugPods(allNamespaces)
+}
+
+// Clean deletes the named debug pods of the namespace, or all of them when
+// no names are given, and returns the names of the deleted pods. Pods that
+// are not debug pods are never deleted.
+func Clean(ctx context.Context, opts Options, names ...string) ([]string, error) {
+	config := opts.config(ctx)
+	pods, err := config.ListDebugPods(false)
+	if err != nil {
+		return nil, err
+	}
+	wanted := map[string]bool{}
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	var deleted []string
+	var errs []error
+	for _, pod := range pods {
+		if len(names) > 0 && !wanted[pod.Name] {
+			continue
+		}
+		if err := config.DeleteDebugPod(pod.Name); err != nil {
+			errs = append(errs, fmt.Errorf("error deleting %s: %v", pod.Name, err))
+			continue
+		}
+		deleted = append(deleted, pod.Name)
+	}
+	return deleted, errors.Join(errs...)
+}
+
+func valueOr(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,86 @@
+package debugsession
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/the-kernel-panics/k8s-pods-debug/pkg/plugin"
+)
+
+func TestSessionLifecycle(t *testing.T) {
+	ctx := context.Background()
+	var stdout, stderr bytes.Buffer
+	opts := Options{Namespace: "default", Stdout: &stdout, Stderr: &stderr, Runner: plugin.NewFakeClusterRunner()}
+
+	standalone, err := CreateSession(ctx, opts, Request{})
+	if err != nil {
+		t.Fatalf("CreateSession(standalone) = %v", err)
+	}
+	if standalone.Pod == "" || standalone.Namespace != "default" || standalone.Strategy != plugin.OperationStandalone || standalone.CleanedUp {
+		t.Errorf("CreateSession(standalone) = %+v", standalone)
+	}
+	ephemeral, err := CreateSession(ctx, opts, Request{Target: "web-6d5f8b7c9-x2k4p", Command: "hostname"})
+	if err != nil {
+		t.Fatalf("CreateSession(ephemeral) = %v", err)
+	}
+	if ephemeral.Pod != "web-6d5f8b7c9-x2k4p" || ephemeral.Strategy != plugin.OperationAddContainer || ephemeral.Container == "" {
+		t.Errorf("CreateSession(ephemeral) = %+v", ephemeral)
+	}
+	if !strings.Contains(stderr.String(), `would run "sh -c hostname"`) {
+		t.Errorf("stderr = %q, want the session's", stderr.String())
+	}
+	other, err := CreateSession(ctx, opts, Request{})
+	if err != nil {
+		t.Fatalf("CreateSession(standalone) = %v", err)
+	}
+
+	// The fake shell echoes its input
+	session := opts
+	session.Stdin = strings.NewReader("uname -a\n")
+	if err := Attach(ctx, session, other.Pod); err != nil || stdout.String() != "uname -a\n" {
+		t.Errorf("Attach() = %v with stdout %q, want the input echoed", err, stdout.String())
+	}
+
+	pods, err := List(ctx, opts, false)
+	if err != nil || len(pods) != 2 {
+		t.Fatalf("List() = %v, %v, want the two debug pods", pods, err)
+	}
+
+	deleted, err := Clean(ctx, opts, standalone.Pod)
+	if err != nil || len(deleted) != 1 || deleted[0] != standalone.Pod {
+		t.Errorf("Clean(%s) = %v, %v", standalone.Pod, deleted, err)
+	}
+	// The target is not a debug pod
+	if deleted, err := Clean(ctx, opts, "web-6d5f8b7c9-x2k4p"); err != nil || len(deleted) != 0 {
+		t.Errorf("Clean(target) = %v, %v, want nothing deleted", deleted, err)
+	}
+	pods, err = List(ctx, opts, false)
+	if err != nil || len(pods) != 1 || pods[0].Name != other.Pod {
+		t.Errorf("List() after Clean = %v, %v, want only %s", pods, err, other.Pod)
+	}
+
+	if _, err := CreateSession(ctx, opts, Request{RemoveAfter: true}); err == nil {
+		t.Error("CreateSession(RemoveAfter without a session) succeeded")
+	}
+}
+
+func TestOptionsFlags(t *testing.T) {
+	opts := Options{Kubeconfig: "/tmp/kubeconfig", Context: "staging", As: "alice", AsGroups: []string{"sre"}, Namespace: "team-a"}
+	config := opts.config(context.Background())
+	want := []string{"--kubeconfig=/tmp/kubeconfig", "--context=staging", "--as=alice", "--as-group=sre"}
+	if len(config.KubectlFlags) != len(want) {
+		t.Fatalf("KubectlFlags = %v, want %v", config.KubectlFlags, want)
+	}
+	for i := range want {
+		if config.KubectlFlags[i] != want[i] {
+			t.Errorf("KubectlFlags = %v, want %v", config.KubectlFlags, want)
+		}
+	}
+
+	// No options must not fall back to the kpdbug command line flags
+	if config := (Options{Namespace: "default"}).config(context.Background()); config.KubectlFlags == nil {
+		t.Error("KubectlFlags = nil, want the global flags overridden")
+	}
+}
@@ -0,0 +1,319 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+)
+
+// manifestDigestAnnotation records the SHA-256 of the manifest file a pod
+// was applied from, so audits can match the pod to the reviewed file
+const manifestDigestAnnotation = "debug-tool/manifest-sha256"
+
+var applyFile string
+
+var applyCmd = &cobra.Command{
+	Use:   "apply <manifest>",
+	Short: "Create a reviewed debug pod manifest and manage it like other debug pods",
+	Long: `Create the debug pod of a manifest, typically one written by 'kpdbug export'
+and merged after review, and open a session in it like kpdbug would for its
+own pods.
+
+The manifest must be a single v1 Pod. Before it is created, the pod gets the
+debug-tool labels that 'kpdbug list' and 'kpdbug clean' look for, the user
+applying it and the SHA-256 of the manifest as annotations, and a deadline:
+--ttl or the configured maxTTL when the manifest has none, and never more than
+the maxTTL. Its images, and the profile its spec amounts to (host namespaces
+and paths, privileged containers, added capabilities), are checked against
+the cluster debug policy and image verification; a manifest above the
+policy's maxProfile is refused, never downgraded.
+
+Ephemeral container patches from 'kpdbug export -p <pod>' cannot be applied:
+they carry no labels or deadline; add them with the kubectl patch command in
+their header.`,
+	Example: `  kpdbug apply debug-pod.yaml -it --rm
+  kpdbug apply --filename replay.yaml --ttl 30m
+  kpdbug export -n payments | kpdbug apply -`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file := applyFile
+		switch {
+		case len(args) == 1 && file != "":
+			return NewValidationError("filename", file, "give the manifest either as argument or with --filename")
+		case len(args) == 1:
+			file = args[0]
+		case file == "":
+			return NewValidationError("filename", "", "a manifest is required").
+				WithCommand("kpdbug apply debug-pod.yaml")
+		}
+		return runApply(cmd, file)
+	},
+}
+
+func init() {
+	applyCmd.Flags().StringVar(&applyFile, "filename", "", "debug pod manifest to create, - for stdin (-f is the global --force)")
+	rootCmd.AddCommand(applyCmd)
+}
+
+func runApply(cmd *cobra.Command, file string) error {
+	if removeAfter && (!interactive || !tty) {
+		return NewValidationError("--rm flag", "true", "--rm requires -it flags to be set")
+	}
+
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return NewValidationError("filename", file, "cannot read file").WithOriginalError(err)
+	}
+	pod, err := parseDebugManifest(data, file)
+	if err != nil {
+		return err
+	}
+
+	config := NewDebugConfigFromFlags()
+	config.Context = cmd.Context()
+	if err := config.prepareAppliedPod(pod, data, cmd.Flags().Changed("namespace")); err != nil {
+		return err
+	}
+
+	log.Printf("Creating debug pod %s from %s...", pod.Name, file)
+	if err := config.createObject(pod); err != nil {
+		if isAlreadyExists(err) {
+			return NewDetailedError(ErrorTypeValidation, fmt.Sprintf("pod %s already exists in namespace %s", pod.Name, pod.Namespace)).
+				WithSuggestion("The manifest was applied before; open a shell in its pod, or remove metadata.name to generate a new name").
+				WithCommand(fmt.Sprintf("kpdbug attach %s -n %s", pod.Name, pod.Namespace))
+		}
+		return WrapKubectlError(err, "create debug pod")
+	}
+	config.emitPodEvent(EventCreated, pod.Name, "applied from "+filepath.Base(file))
+	return config.openAppliedPod(pod.Name)
+}
+
+// openAppliedPod opens a shell in the applied pod with -it, or prints how to
+// access it; its command may be sleep, so the shell is exec'd, not attached
+func (config *DebugConfig) openAppliedPod(name string) error {
+	if config.RemoveAfter {
+		defer config.removeOnExit(name, false).run()
+	}
+
+	if !config.attaches() {
+		config.notifySession(NotifyCreated, name, false)
+		config.logf("You can access the pod with: kpdbug attach %s -n %s\n", name, config.Namespace)
+		config.printPodName(name)
+		return nil
+	}
+
+	config.logf("Waiting for pod to be ready...")
+	config.emitPodEvent(EventWaiting, name, "")
+	if err := config.waitForPod(name); err != nil {
+		return NewTimeoutError("pod ready", fmt.Sprintf("%ds", maxAttempts)).WithOriginalError(err)
+	}
+	config.emitPodEvent(EventReady, name, "")
+	return wrapSessionError(config.attachToPod(name), "attach to debug pod")
+}
+
+// parseDebugManifest decodes a manifest holding a single v1 Pod; unknown
+// fields are rejected so a typo is not silently dropped from a reviewed pod
+func parseDebugManifest(data []byte, file string) (*corev1.Pod, error) {
+	for _, doc := range strings.Split(string(data), "\n---")[1:] {
+		if strings.TrimSpace(stripYAMLComments(doc)) != "" {
+			return nil, NewValidationError("filename", file, "must contain a single Pod; found several documents")
+		}
+	}
+
+	var pod corev1.Pod
+	if err := yaml.UnmarshalStrict(data, &pod); err != nil {
+		return nil, NewValidationError("filename", file, "is not a valid Pod manifest").WithOriginalError(err)
+	}
+	if pod.APIVersion != "v1" || pod.Kind != "Pod" {
+		return nil, NewValidationError("filename", file,
+			fmt.Sprintf("must be a v1 Pod, not %s %s", pod.APIVersion, pod.Kind)).
+			WithSuggestion("Generate one with 'kpdbug export'")
+	}
+	if len(pod.Spec.Containers) == 0 && len(pod.Spec.EphemeralContainers) > 0 {
+		return nil, NewValidationError("filename", file, "is an ephemeral container patch, which carries no labels or deadline").
+			WithSuggestion("Add it with the kubectl patch --subresource=ephemeralcontainers command in its header")
+	}
+	if len(pod.Spec.Containers) == 0 {
+		return nil, NewValidationError("filename", file, "pod has no containers")
+	}
+	return &pod, nil
+}
+
+// stripYAMLComments removes the comment lines of a YAML document
+func stripYAMLComments(doc string) string {
+	var lines []string
+	for _, line := range strings.Split(doc, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// prepareAppliedPod checks the pod against the debug policy and adds what
+// kpdbug's own debug pods have: a name, namespace, tool labels, audit
+// annotations and a deadline within the maximum TTL
+func (config *DebugConfig) prepareAppliedPod(pod *corev1.Pod, manifest []byte, namespaceFlag bool) error {
+	switch {
+	case pod.Namespace == "":
+		pod.Namespace = config.Namespace
+	case namespaceFlag && pod.Namespace != config.Namespace:
+		return NewValidationError("namespace", config.Namespace,
+			fmt.Sprintf("the manifest is for namespace %s", pod.Namespace)).
+			WithSuggestion("Drop -n or change the namespace in the reviewed manifest")
+	default:
+		config.Namespace = pod.Namespace
+	}
+
+	if pod.Name == "" {
+		pod.Name = config.generateUniqueName()
+	}
+	if err := validatePodName(pod.Name); err != nil {
+		return err
+	}
+
+	// The policy judges what the manifest asks for, not --profile, and a
+	// reviewed pod is refused rather than downgraded
+	profile := manifestProfile(&pod.Spec)
+	for _, c := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		config.Image = c.Image
+		if err := config.enforcePolicy(profile); err != nil {
+			return err
+		}
+		if err := config.verifyImage(elevatedProfiles[profile]); err != nil {
+			return err
+		}
+	}
+
+	if pod.Labels == nil {
+		pod.Labels = map[string]string{}
+	}
+	pod.Labels["debug-tool/type"] = "debug-pod"
+
+	if pod.Annotations == nil {
+		pod.Annotations = map[string]string{}
+	}
+	delete(pod.Annotations, createdByAnnotation)
+	delete(pod.Annotations, removeAfterAnnotation)
+	if user := config.currentUser(); user != "" {
+		pod.Annotations[createdByAnnotation] = user
+	}
+	if config.RemoveAfter {
+		pod.Annotations[removeAfterAnnotation] = removalOwner()
+	}
+	digest := sha256.Sum256(manifest)
+	pod.Annotations[manifestDigestAnnotation] = hex.EncodeToString(digest[:])
+
+	// --ttl replaces the manifest's deadline; the maximum TTL caps both
+	limit := config.maxSessionTTL()
+	switch {
+	case pod.Spec.ActiveDeadlineSeconds == nil || config.TTL > 0:
+		pod.Spec.ActiveDeadlineSeconds = config.activeDeadlineSeconds()
+	case limit > 0 && float64(*pod.Spec.ActiveDeadlineSeconds) > limit.Seconds():
+		config.logf("Warning: the manifest's activeDeadlineSeconds %d exceeds the maximum session duration; the pod ends after %s",
+			*pod.Spec.ActiveDeadlineSeconds, limit)
+		capped := int64(math.Ceil(limit.Seconds()))
+		pod.Spec.ActiveDeadlineSeconds = &capped
+	}
+	return nil
+}
+
+// escalatingCapabilities give a container control of the node, like the
+// privileged profile
+var escalatingCapabilities = map[corev1.Capability]bool{
+	"ALL": true, "SYS_ADMIN": true, "SYS_MODULE": true, "SYS_RAWIO": true, "SYS_BOOT": true, "DAC_READ_SEARCH": true,
+}
+
+// manifestProfile returns the least privileged profile covering what the pod
+// spec asks for: host namespaces, host paths, privileged containers, added
+// capabilities and unconfined seccomp
+func manifestProfile(spec *corev1.PodSpec) string {
+	profile := "restricted"
+	raise := func(to string) {
+		if profileRank(to) > profileRank(profile) {
+			profile = to
+		}
+	}
+
+	if spec.HostPID || spec.HostIPC {
+		raise("privileged")
+	}
+	if spec.HostNetwork {
+		raise("netadmin")
+	}
+	ebpfPaths := map[string]bool{}
+	for _, hostPath := range ebpfHostPaths {
+		ebpfPaths[hostPath.Path] = true
+	}
+	for _, volume := range spec.Volumes {
+		switch {
+		case volume.HostPath == nil:
+		case ebpfPaths[strings.TrimSuffix(volume.HostPath.Path, "/")]:
+			raise(ebpfProfile)
+		default:
+			raise("privileged")
+		}
+	}
+
+	podNonRoot := spec.SecurityContext != nil && ptr.Deref(spec.SecurityContext.RunAsNonRoot, false)
+	if spec.SecurityContext != nil && spec.SecurityContext.SeccompProfile != nil &&
+		spec.SecurityContext.SeccompProfile.Type == corev1.SeccompProfileTypeUnconfined {
+		raise(ebpfProfile)
+	}
+	for _, c := range append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...) {
+		sc := c.SecurityContext
+		if sc == nil {
+			// Runtime default capabilities, as root unless the pod says otherwise
+			raise("general")
+			continue
+		}
+		if ptr.Deref(sc.Privileged, false) {
+			raise("privileged")
+		}
+		if sc.SeccompProfile != nil && sc.SeccompProfile.Type == corev1.SeccompProfileTypeUnconfined {
+			raise(ebpfProfile)
+		}
+		if !ptr.Deref(sc.RunAsNonRoot, podNonRoot) {
+			raise("baseline")
+		}
+		droppedAll := false
+		if sc.Capabilities != nil {
+			for _, capability := range sc.Capabilities.Drop {
+				droppedAll = droppedAll || capability == "ALL"
+			}
+			for _, capability := range sc.Capabilities.Add {
+				switch capability = corev1.Capability(strings.TrimPrefix(strings.ToUpper(string(capability)), "CAP_")); {
+				case escalatingCapabilities[capability]:
+					raise("privileged")
+				case capability == "NET_ADMIN" || capability == "NET_RAW":
+					raise("netadmin")
+				case capability == "BPF" || capability == "PERFMON" || capability == "SYS_RESOURCE":
+					raise(ebpfProfile)
+				default:
+					raise("general")
+				}
+			}
+		}
+		if !droppedAll || ptr.Deref(sc.AllowPrivilegeEscalation, true) {
+			raise("general")
+		}
+	}
+	return profile
+}
@@ -0,0 +1,166 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestParseDebugManifest(t *testing.T) {
+	valid := "# reviewed in PR 42\napiVersion: v1\nkind: Pod\nmetadata:\n  name: debug-a\nspec:\n  containers:\n  - name: debugger\n    image: busybox\n"
+	if pod, err := parseDebugManifest([]byte(valid+"---\n# trailing comment\n"), "pod.yaml"); err != nil || pod.Name != "debug-a" {
+		t.Errorf("parseDebugManifest(valid) = %v, %v", pod, err)
+	}
+
+	invalid := map[string]string{
+		"several documents": valid + "---\n" + valid,
+		"unknown field":     strings.Replace(valid, "image: busybox", "image: busybox\n    imagePullPolicyy: Always", 1),
+		"not a pod":         strings.Replace(valid, "kind: Pod", "kind: Deployment", 1),
+		"ephemeral patch":   "apiVersion: v1\nkind: Pod\nmetadata:\n  name: web\nspec:\n  ephemeralContainers:\n  - name: debugger-x\n    image: busybox\n",
+	}
+	for name, manifest := range invalid {
+		if _, err := parseDebugManifest([]byte(manifest), "pod.yaml"); err == nil {
+			t.Errorf("parseDebugManifest(%s) succeeded", name)
+		}
+	}
+}
+
+func TestPrepareAppliedPod(t *testing.T) {
+	newPod := func(namespace string, deadline *int64) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "debug-a",
+				Namespace:   namespace,
+				Annotations: map[string]string{createdByAnnotation: "exporter"},
+			},
+			Spec: corev1.PodSpec{
+				ActiveDeadlineSeconds: deadline,
+				Containers:            []corev1.Container{{Name: "debugger", Image: "busybox"}},
+			},
+		}
+	}
+	newConfig := func(ttl time.Duration) *DebugConfig {
+		return &DebugConfig{
+			Namespace: "default",
+			TTL:       ttl,
+			Runner:    fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}},
+		}
+	}
+
+	pod := newPod("", nil)
+	if err := newConfig(time.Hour).prepareAppliedPod(pod, []byte("manifest"), false); err != nil {
+		t.Fatal(err)
+	}
+	if pod.Namespace != "default" || pod.Labels["debug-tool/type"] != "debug-pod" {
+		t.Errorf("applied pod namespace %q, labels %v", pod.Namespace, pod.Labels)
+	}
+	if pod.Annotations[createdByAnnotation] == "exporter" || len(pod.Annotations[manifestDigestAnnotation]) != 64 {
+		t.Errorf("applied pod annotations = %v", pod.Annotations)
+	}
+	if pod.Spec.ActiveDeadlineSeconds == nil || *pod.Spec.ActiveDeadlineSeconds != 3600 {
+		t.Errorf("applied pod activeDeadlineSeconds = %v, want 3600", pod.Spec.ActiveDeadlineSeconds)
+	}
+
+	// The manifest's deadline is kept without --ttl
+	pod = newPod("default", ptr.To(int64(600)))
+	if err := newConfig(0).prepareAppliedPod(pod, nil, false); err != nil || *pod.Spec.ActiveDeadlineSeconds != 600 {
+		t.Errorf("applied pod activeDeadlineSeconds = %v, %v; want 600", pod.Spec.ActiveDeadlineSeconds, err)
+	}
+
+	config := newConfig(0)
+	if err := config.prepareAppliedPod(newPod("kube-system", nil), nil, false); err != nil || config.Namespace != "kube-system" {
+		t.Errorf("prepareAppliedPod(kube-system) namespace %s, %v", config.Namespace, err)
+	}
+	if err := newConfig(0).prepareAppliedPod(newPod("kube-system", nil), nil, true); err == nil {
+		t.Error("prepareAppliedPod(-n default, manifest kube-system) succeeded")
+	}
+}
+
+func TestManifestProfile(t *testing.T) {
+	newSpec := func(profile string) *corev1.PodSpec {
+		containerContext, podContext := getSecurityContextForProfile(profile)
+		spec := &corev1.PodSpec{
+			SecurityContext: podContext,
+			Containers:      []corev1.Container{{Name: "debugger", Image: "busybox", SecurityContext: containerContext}},
+		}
+		if profile == ebpfProfile {
+			addEBPFHostMounts(spec, &spec.Containers[0])
+		}
+		return spec
+	}
+
+	tests := []struct {
+		name string
+		spec *corev1.PodSpec
+		want string
+	}{
+		{"restricted", newSpec("restricted"), "restricted"},
+		{"baseline", newSpec("baseline"), "baseline"},
+		{"general", newSpec("general"), "general"},
+		{"netadmin", newSpec("netadmin"), "netadmin"},
+		{"ebpf", newSpec(ebpfProfile), ebpfProfile},
+		{"sysadmin", newSpec("sysadmin"), "privileged"},
+		{"privileged", newSpec("privileged"), "privileged"},
+		{"no security context", &corev1.PodSpec{Containers: []corev1.Container{{Name: "debugger"}}}, "general"},
+		{"hostPID", func() *corev1.PodSpec { spec := newSpec("baseline"); spec.HostPID = true; return spec }(), "privileged"},
+		{"hostNetwork", func() *corev1.PodSpec { spec := newSpec("baseline"); spec.HostNetwork = true; return spec }(), "netadmin"},
+		{"hostPath", func() *corev1.PodSpec {
+			spec := newSpec("baseline")
+			spec.Volumes = []corev1.Volume{{Name: "root", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/"}}}}
+			return spec
+		}(), "privileged"},
+		{"SYS_ADMIN", func() *corev1.PodSpec {
+			spec := newSpec("baseline")
+			spec.Containers[0].SecurityContext.Capabilities.Add = []corev1.Capability{"CAP_SYS_ADMIN"}
+			return spec
+		}(), "privileged"},
+		{"privileged init container", func() *corev1.PodSpec {
+			spec := newSpec("restricted")
+			spec.InitContainers = []corev1.Container{{Name: "setup", SecurityContext: &corev1.SecurityContext{Privileged: ptr.To(true)}}}
+			return spec
+		}(), "privileged"},
+	}
+	for _, tt := range tests {
+		if got := manifestProfile(tt.spec); got != tt.want {
+			t.Errorf("manifestProfile(%s) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPrepareAppliedPodPolicy(t *testing.T) {
+	clusterPolicyOnce.Do(func() {})
+	defer func() { clusterPolicy = nil }()
+	var err error
+	clusterPolicy, err = parseClusterPolicy("maxProfile: general\nenforcement: downgrade\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newPod := func(hostPID bool) *corev1.Pod {
+		return &corev1.Pod{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: metav1.ObjectMeta{Name: "debug-reviewed", Namespace: "default"},
+			Spec: corev1.PodSpec{
+				HostPID:    hostPID,
+				Containers: []corev1.Container{{Name: "debugger", Image: "busybox"}},
+			},
+		}
+	}
+	// --profile does not change how the manifest is judged, and a downgrade
+	// policy refuses it instead of rewriting the reviewed pod
+	config := &DebugConfig{Namespace: "default", Profile: "restricted", Runner: fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}}}
+	pod := newPod(true)
+	if err := config.prepareAppliedPod(pod, nil, false); err == nil {
+		t.Error("prepareAppliedPod(hostPID) under maxProfile general succeeded")
+	}
+	if !pod.Spec.HostPID {
+		t.Error("prepareAppliedPod rewrote the refused pod")
+	}
+	if err := config.prepareAppliedPod(newPod(false), nil, false); err != nil {
+		t.Errorf("prepareAppliedPod(general) = %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package plugin
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var attachCmd = &cobra.Command{
+	Use:   "attach <debug-pod>",
+	Short: "Attach to an existing debug pod",
+	Long: `Open an interactive shell in a debug pod previously created by kpdbug tool.
+Use 'kpdbug list' to find the names of active debug pods.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeDebugPodNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config := NewDebugConfigFromFlags()
+		config.Context = cmd.Context()
+		return config.Attach(args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(attachCmd)
+}
+
+// Attach opens an interactive shell in the debug pod
+func (config *DebugConfig) Attach(pod string) error {
+	return wrapSessionError(config.attachToPod(pod), "attach to debug pod")
+}
@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// bundleFile is a local file added to a bundle under Name
+type bundleFile struct {
+	Name string
+	Path string
+}
+
+// writeBundle writes files into a gzip-compressed tarball at path
+func writeBundle(path string, files []bundleFile, modTime time.Time) error {
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("error creating bundle %s: %v", path, err)
+	}
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	for _, f := range files {
+		if err := addBundleFile(tw, f, modTime); err != nil {
+			_ = out.Close()
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("error writing bundle %s: %v", path, err)
+	}
+	if err := gz.Close(); err != nil {
+		_ = out.Close()
+		return fmt.Errorf("error writing bundle %s: %v", path, err)
+	}
+	return out.Close()
+}
+
+func addBundleFile(tw *tar.Writer, f bundleFile, modTime time.Time) error {
+	in, err := os.Open(f.Path)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", f.Name, err)
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	info, err := in.Stat()
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", f.Name, err)
+	}
+
+	header := &tar.Header{Name: f.Name, Mode: 0o644, Size: info.Size(), ModTime: modTime}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("error writing %s to bundle: %v", f.Name, err)
+	}
+	if _, err := io.Copy(tw, in); err != nil {
+		return fmt.Errorf("error writing %s to bundle: %v", f.Name, err)
+	}
+	return nil
+}
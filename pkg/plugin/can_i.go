@@ -0,0 +1,184 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+var canICmd = &cobra.Command{
+	Use:   "can-i",
+	Short: "Report which debug operations your permissions allow",
+	Long: `Run a SelfSubjectAccessReview (kubectl auth can-i) for every permission the
+debug operations rely on in the namespace, and print which are allowed and
+which operations will therefore work, so you know which mode to use before
+trying. Impersonation flags (--as, --as-group) are honored.`,
+	Example: `  kpdbug can-i
+  kpdbug can-i -n production
+  kpdbug can-i -n production --as jane`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config := NewDebugConfigFromFlags()
+		config.Context = cmd.Context()
+		return config.runCanI()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(canICmd)
+}
+
+var (
+	accessGetPods     = accessCheck{"get", "pods", ""}
+	accessListPods    = accessCheck{"list", "pods", ""}
+	accessDeletePods  = accessCheck{"delete", "pods", ""}
+	accessPatchPods   = accessCheck{"patch", "pods", ""}
+	accessPodLogs     = accessCheck{"get", "pods", "log"}
+	accessReplicaSets = accessCheck{"get", "replicasets.apps", ""}
+	accessDeployments = accessCheck{"get", "deployments.apps", ""}
+	accessJobs        = accessCheck{"get", "jobs.batch", ""}
+	accessCronJobs    = accessCheck{"get", "cronjobs.batch", ""}
+	accessNodes       = accessCheck{"list", "nodes", ""}
+	accessDaemonSets  = accessCheck{"create", "daemonsets.apps", ""}
+	accessEvents      = accessCheck{"create", "events", ""}
+)
+
+// debugOperation is a kpdbug operation with the permissions it needs;
+// optional permissions only degrade it when denied
+type debugOperation struct {
+	name     string
+	required []accessCheck
+	optional []accessCheck
+}
+
+var debugOperations = []debugOperation{
+	{
+		name:     "ephemeral container (-p pod)",
+		required: []accessCheck{accessGetPods, accessEphemeral},
+		optional: []accessCheck{accessAttach, accessEvents},
+	},
+	{
+		name:     "pod copy (-p pod --copy)",
+		required: []accessCheck{accessGetPods, accessCreatePods},
+		optional: []accessCheck{accessAttach, accessDeletePods, accessPatchPods},
+	},
+	{
+		name:     "standalone pod",
+		required: []accessCheck{accessCreatePods, accessGetPods},
+		optional: []accessCheck{accessAttach, accessExec, accessDeletePods},
+	},
+	{
+		name:     "standalone pod beside a target",
+		required: []accessCheck{accessGetPods, accessCreatePods, accessReplicaSets, accessDeployments},
+		optional: []accessCheck{accessAttach},
+	},
+	{
+		name:     "job replay (-p job/<name>)",
+		required: []accessCheck{accessJobs, accessCronJobs, accessCreatePods},
+		optional: []accessCheck{accessExec},
+	},
+	{
+		name:     "scripted commands (net, perms, ...)",
+		required: []accessCheck{accessGetPods, accessEphemeral, accessPodLogs},
+	},
+	{
+		name:     "node commands",
+		required: []accessCheck{accessCreatePods, accessNodes, accessPodLogs},
+		optional: []accessCheck{accessDaemonSets},
+	},
+	{
+		name:     "list and clean",
+		required: []accessCheck{accessListPods, accessDeletePods},
+	},
+}
+
+// canIResult is the outcome of one access review
+type canIResult struct {
+	allowed bool
+	known   bool
+}
+
+func (r canIResult) String() string {
+	switch {
+	case !r.known:
+		return "unknown"
+	case r.allowed:
+		return "yes"
+	}
+	return "no"
+}
+
+// operationStatus summarizes the reviews of an operation's permissions: no
+// when a required one is denied, limited when an optional one is, unknown
+// when a review was inconclusive, and the denied permissions
+func operationStatus(op debugOperation, results map[accessCheck]canIResult) (string, []string) {
+	status := "yes"
+	var missing []string
+	for _, check := range op.required {
+		result := results[check]
+		switch {
+		case !result.known:
+			if status == "yes" {
+				status = "unknown"
+			}
+		case !result.allowed:
+			status = "no"
+			missing = append(missing, check.String())
+		}
+	}
+	for _, check := range op.optional {
+		result := results[check]
+		if result.known && !result.allowed {
+			if status != "no" {
+				status = "limited"
+			}
+			missing = append(missing, check.String()+" (optional)")
+		}
+	}
+	return status, missing
+}
+
+// runCanI reviews every permission once, concurrently, and prints the
+// permission and operation matrices
+func (config *DebugConfig) runCanI() error {
+	var checks []accessCheck
+	seen := map[accessCheck]bool{}
+	for _, op := range debugOperations {
+		for _, check := range append(append([]accessCheck(nil), op.required...), op.optional...) {
+			if !seen[check] {
+				seen[check] = true
+				checks = append(checks, check)
+			}
+		}
+	}
+
+	results := make(map[accessCheck]canIResult, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check accessCheck) {
+			defer wg.Done()
+			allowed, known := config.canI(check)
+			mu.Lock()
+			results[check] = canIResult{allowed: allowed, known: known}
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	fmt.Printf("Permissions in namespace %s:\n\n", config.Namespace)
+	fmt.Printf("%-36s %s\n", "PERMISSION", "ALLOWED")
+	for _, check := range checks {
+		fmt.Printf("%-36s %s\n", check, results[check])
+	}
+
+	fmt.Printf("\n%-38s %-8s %s\n", "OPERATION", "WORKS", "MISSING")
+	for _, op := range debugOperations {
+		status, missing := operationStatus(op, results)
+		fmt.Printf("%-38s %-8s %s\n", op.name, status, strings.Join(missing, ", "))
+	}
+	return nil
+}
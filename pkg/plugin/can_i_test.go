@@ -0,0 +1,31 @@
+package plugin
+
+import "testing"
+
+func TestOperationStatus(t *testing.T) {
+	op := debugOperation{
+		name:     "pod copy",
+		required: []accessCheck{accessGetPods, accessCreatePods},
+		optional: []accessCheck{accessAttach},
+	}
+	yes, no, unknown := canIResult{true, true}, canIResult{false, true}, canIResult{}
+	tests := []struct {
+		name        string
+		results     map[accessCheck]canIResult
+		wantStatus  string
+		wantMissing int
+	}{
+		{"all allowed", map[accessCheck]canIResult{accessGetPods: yes, accessCreatePods: yes, accessAttach: yes}, "yes", 0},
+		{"optional denied", map[accessCheck]canIResult{accessGetPods: yes, accessCreatePods: yes, accessAttach: no}, "limited", 1},
+		{"required denied", map[accessCheck]canIResult{accessGetPods: yes, accessCreatePods: no, accessAttach: no}, "no", 2},
+		{"inconclusive", map[accessCheck]canIResult{accessGetPods: unknown, accessCreatePods: yes, accessAttach: yes}, "unknown", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, missing := operationStatus(op, tt.results)
+			if status != tt.wantStatus || len(missing) != tt.wantMissing {
+				t.Errorf("operationStatus() = %s, %v; want %s with %d missing", status, missing, tt.wantStatus, tt.wantMissing)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package plugin
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Pod Security Admission levels
+const (
+	psaPrivileged = "privileged"
+	psaBaseline   = "baseline"
+	psaRestricted = "restricted"
+)
+
+// baselineCapabilities are the capabilities the PSA baseline level allows adding
+var baselineCapabilities = map[string]bool{
+	"AUDIT_WRITE":      true,
+	"CHOWN":            true,
+	"DAC_OVERRIDE":     true,
+	"FOWNER":           true,
+	"FSETID":           true,
+	"KILL":             true,
+	"MKNOD":            true,
+	"NET_BIND_SERVICE": true,
+	"SETFCAP":          true,
+	"SETGID":           true,
+	"SETPCAP":          true,
+	"SETUID":           true,
+	"SYS_CHROOT":       true,
+}
+
+// normalizeCapability accepts "net_raw", "CAP_NET_RAW" or "NET_RAW"
+func normalizeCapability(name string) corev1.Capability {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	return corev1.Capability(strings.TrimPrefix(name, "CAP_"))
+}
+
+// applyCapabilityOverrides adds and drops capabilities on top of the
+// profile's security context; an explicit add wins over a profile drop of
+// the same capability, and an explicit drop removes it from the add list
+func applyCapabilityOverrides(secContext *corev1.SecurityContext, add, drop []string) {
+	if len(add) == 0 && len(drop) == 0 {
+		return
+	}
+	if secContext.Capabilities == nil {
+		secContext.Capabilities = &corev1.Capabilities{}
+	}
+	caps := secContext.Capabilities
+
+	for _, name := range add {
+		capability := normalizeCapability(name)
+		caps.Drop = removeCapability(caps.Drop, capability)
+		if !containsCapability(caps.Add, capability) {
+			caps.Add = append(caps.Add, capability)
+		}
+	}
+	for _, name := range drop {
+		capability := normalizeCapability(name)
+		caps.Add = removeCapability(caps.Add, capability)
+		if !containsCapability(caps.Drop, capability) {
+			caps.Drop = append(caps.Drop, capability)
+		}
+	}
+}
+
+func containsCapability(list []corev1.Capability, capability corev1.Capability) bool {
+	for _, c := range list {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+func removeCapability(list []corev1.Capability, capability corev1.Capability) []corev1.Capability {
+	var result []corev1.Capability
+	for _, c := range list {
+		if c != capability {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// psaCapabilityViolations returns the added capabilities the given PSA
+// level does not allow
+func psaCapabilityViolations(level string, add []string) []string {
+	var violations []string
+	for _, name := range add {
+		capability := normalizeCapability(name)
+		switch level {
+		case psaRestricted:
+			if capability != "NET_BIND_SERVICE" {
+				violations = append(violations, string(capability))
+			}
+		case psaBaseline:
+			if !baselineCapabilities[string(capability)] {
+				violations = append(violations, string(capability))
+			}
+		}
+	}
+	return violations
+}
+
+// namespacePSALevel reads the enforced Pod Security level of the namespace,
+// falling back to the level implied by the selected profile
+func (config *DebugConfig) namespacePSALevel() string {
+	output, err := config.kubectl("get", "namespace", config.Namespace,
+		"-o", "jsonpath={.metadata.labels.pod-security\\.kubernetes\\.io/enforce}").Output()
+	if err == nil {
+		if level := strings.TrimSpace(string(output)); level != "" {
+			return level
+		}
+	}
+
+	switch config.Profile {
+	case psaRestricted, psaBaseline:
+		return config.Profile
+	default:
+		return psaPrivileged
+	}
+}
+
+// warnCapabilityViolations warns when --cap-add requests capabilities that
+// the namespace's Pod Security level will reject
+func (config *DebugConfig) warnCapabilityViolations() {
+	if len(config.CapAdd) == 0 {
+		return
+	}
+
+	level := config.namespacePSALevel()
+	if violations := psaCapabilityViolations(level, config.CapAdd); len(violations) > 0 {
+		config.logf("Warning: capabilities %s are not allowed by the %q Pod Security level of namespace %s; the debug container may be rejected",
+			strings.Join(violations, ", "), level, config.Namespace)
+	}
+}
@@ -0,0 +1,20 @@
+package plugin
+
+import "testing"
+
+func TestApplyCapabilityOverrides(t *testing.T) {
+	containerContext, _ := getSecurityContextForProfile("baseline")
+	applyCapabilityOverrides(containerContext, []string{"net_raw", "CAP_SYS_PTRACE"}, []string{"SYS_PTRACE"})
+
+	caps := containerContext.Capabilities
+	if len(caps.Add) != 1 || caps.Add[0] != "NET_RAW" {
+		t.Errorf("Add = %v, want [NET_RAW]", caps.Add)
+	}
+	if !containsCapability(caps.Drop, "ALL") || !containsCapability(caps.Drop, "SYS_PTRACE") {
+		t.Errorf("Drop = %v, want ALL and SYS_PTRACE", caps.Drop)
+	}
+
+	if got := psaCapabilityViolations(psaBaseline, []string{"NET_RAW", "CHOWN"}); len(got) != 1 || got[0] != "NET_RAW" {
+		t.Errorf("psaCapabilityViolations() = %v, want [NET_RAW]", got)
+	}
+}
@@ -0,0 +1,277 @@
+package plugin
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	certsEndpoints []string
+	certsWarnDays  int
+)
+
+var certsCmd = &cobra.Command{
+	Use:   "certs",
+	Short: "Inspect the TLS certificates mounted in or served to a pod",
+	Long: `Add an ephemeral debug container to the target pod, find the certificate
+files mounted in the target container and optionally fetch the certificates
+served by endpoints as seen from inside the pod. For each certificate the
+subject, SANs, expiry and chain validation result are printed; chains are
+validated against the CA files mounted next to them and the container's own
+CA bundle.`,
+	Example: `  kpdbug certs -p mypod
+  kpdbug certs -p mypod --endpoint api.internal:443 --endpoint db:5432 --warn-days 14`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runCerts(cmd)
+	},
+}
+
+func init() {
+	certsCmd.Flags().StringArrayVar(&certsEndpoints, "endpoint", nil, "host:port to dial from the pod and inspect (repeatable)")
+	certsCmd.Flags().IntVar(&certsWarnDays, "warn-days", 30, "flag certificates expiring within this many days")
+	rootCmd.AddCommand(certsCmd)
+}
+
+// certsFilesScript prints every PEM certificate file of the target's volume
+// mounts, skipping the Kubernetes "..data" symlink targets, followed by the
+// container's CA bundle
+const certsFilesScript = targetMountsScript + `  [ "$mp" = / ] && continue
+  find "$root$mp" -maxdepth 4 \( -type f -o -type l \) \( -name '*.crt' -o -name '*.pem' -o -name '*.cer' -o -name '*.cert' \) 2>/dev/null | while read -r file; do
+    case "$file" in */..*) continue;; esac
+    grep -q "BEGIN CERTIFICATE" "$file" 2>/dev/null || continue
+    echo "### file ${file#$root}"
+    cat "$file"
+  done
+done < /proc/$pid/mounts
+for bundle in /etc/ssl/certs/ca-certificates.crt /etc/pki/tls/certs/ca-bundle.crt /etc/ssl/cert.pem; do
+  if [ -f "$root$bundle" ]; then
+    echo "### bundle"
+    cat "$root$bundle"
+    break
+  fi
+done
+`
+
+// certsEndpointScript prints the chain served by an endpoint
+func certsEndpointScript(endpoint, host string) string {
+	return fmt.Sprintf("echo %s\necho | timeout 10 openssl s_client -connect %s -servername %s -showcerts 2>/dev/null\n",
+		shellQuote("### endpoint "+endpoint), shellQuote(endpoint), shellQuote(host))
+}
+
+// certReport is the inspection result of one certificate file or endpoint
+type certReport struct {
+	Source   string
+	Subject  string
+	SANs     []string
+	NotAfter time.Time
+	Status   string
+	Chain    string
+}
+
+func runCerts(cmd *cobra.Command) error {
+	script := certsFilesScript
+	for _, endpoint := range certsEndpoints {
+		host, _, err := net.SplitHostPort(endpoint)
+		if err != nil {
+			return NewValidationError("endpoint", endpoint, "must be host:port")
+		}
+		script += certsEndpointScript(endpoint, host)
+	}
+
+	config, err := newTargetConfig(cmd.Context(), cmd, defaultNetImage, "general")
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Inspecting certificates of pod %s...", config.PodName)
+	result, err := config.runEphemeralScript(config.PodName, script+"true")
+	if err != nil {
+		return err
+	}
+
+	reports := inspectCertificates(result.Output, clock(), certsWarnDays)
+	if len(reports) == 0 {
+		fmt.Println("No certificates found")
+		return nil
+	}
+	for _, report := range reports {
+		fmt.Printf("%s\n", report.Source)
+		if report.Subject != "" {
+			fmt.Printf("  Subject:  %s\n", report.Subject)
+			fmt.Printf("  SANs:     %s\n", strings.Join(report.SANs, ", "))
+			fmt.Printf("  Expires:  %s\n", report.NotAfter.UTC().Format(time.RFC3339))
+		}
+		fmt.Printf("  Status:   %s\n", report.Status)
+		if report.Chain != "" {
+			fmt.Printf("  Chain:    %s\n", report.Chain)
+		}
+	}
+	return nil
+}
+
+// inspectCertificates builds a report for every "### file" and
+// "### endpoint" section of the script output
+func inspectCertificates(output string, now time.Time, warnDays int) []certReport {
+	sections := pemSections(output)
+
+	roots := x509.NewCertPool()
+	for _, cert := range parseCertificates(sections["bundle"]) {
+		roots.AddCert(cert)
+	}
+
+	var names []string
+	for name := range sections {
+		if strings.HasPrefix(name, "file ") || strings.HasPrefix(name, "endpoint ") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var reports []certReport
+	for _, name := range names {
+		certs := parseCertificates(sections[name])
+		report := certReport{Source: name}
+		if len(certs) == 0 {
+			report.Status = "no certificate found"
+			if strings.HasPrefix(name, "endpoint ") {
+				report.Status = "connection or TLS handshake failed"
+			}
+			reports = append(reports, report)
+			continue
+		}
+
+		leaf := certs[0]
+		report.Subject = leaf.Subject.String()
+		report.SANs = certificateSANs(leaf)
+		report.NotAfter = leaf.NotAfter
+		report.Status = expiryStatus(leaf, now, warnDays)
+
+		// CA certificates are only checked for expiry
+		if leaf.IsCA && strings.HasPrefix(name, "file ") {
+			reports = append(reports, report)
+			continue
+		}
+
+		opts := x509.VerifyOptions{
+			Roots:         fileRoots(sections, name, roots),
+			Intermediates: x509.NewCertPool(),
+			CurrentTime:   now,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		if endpoint, ok := strings.CutPrefix(name, "endpoint "); ok {
+			if host, _, err := net.SplitHostPort(endpoint); err == nil {
+				opts.DNSName = host
+			}
+		}
+		if _, err := leaf.Verify(opts); err != nil {
+			report.Chain = "invalid: " + err.Error()
+		} else {
+			report.Chain = "valid"
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// fileRoots adds the CA files mounted next to a certificate file (such as the
+// ca.crt of a cert-manager Secret) to the container's roots
+func fileRoots(sections map[string][]byte, name string, bundle *x509.CertPool) *x509.CertPool {
+	file, ok := strings.CutPrefix(name, "file ")
+	if !ok {
+		return bundle
+	}
+	dir := file[:strings.LastIndex(file, "/")+1]
+
+	roots := bundle.Clone()
+	for other, data := range sections {
+		otherFile, ok := strings.CutPrefix(other, "file ")
+		if !ok || otherFile == file || !strings.HasPrefix(otherFile, dir) || strings.Contains(otherFile[len(dir):], "/") {
+			continue
+		}
+		for _, cert := range parseCertificates(data) {
+			if cert.IsCA {
+				roots.AddCert(cert)
+			}
+		}
+	}
+	return roots
+}
+
+// pemSections splits the script output on "### <name>" headers, keeping the
+// raw section contents
+func pemSections(output string) map[string][]byte {
+	sections := map[string][]byte{}
+	current := ""
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "### ") {
+			current = strings.TrimPrefix(line, "### ")
+			if _, ok := sections[current]; !ok {
+				sections[current] = nil
+			}
+			continue
+		}
+		if current != "" {
+			sections[current] = append(sections[current], line+"\n"...)
+		}
+	}
+	return sections
+}
+
+// parseCertificates decodes every PEM certificate block, skipping other text
+func parseCertificates(data []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+}
+
+func certificateSANs(cert *x509.Certificate) []string {
+	sans := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	if len(sans) == 0 {
+		return []string{"<none>"}
+	}
+	return sans
+}
+
+func expiryStatus(cert *x509.Certificate, now time.Time, warnDays int) string {
+	days := int(cert.NotAfter.Sub(now).Hours() / 24)
+	switch {
+	case now.Before(cert.NotBefore):
+		return fmt.Sprintf("NOT YET VALID (valid from %s)", cert.NotBefore.UTC().Format(time.RFC3339))
+	case now.After(cert.NotAfter):
+		return fmt.Sprintf("EXPIRED %d days ago", -days)
+	case days < warnDays:
+		return fmt.Sprintf("EXPIRING in %d days", days)
+	default:
+		return fmt.Sprintf("OK (%d days left)", days)
+	}
+}
@@ -0,0 +1,87 @@
+package plugin
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestCertificate(t *testing.T, cn string, isCA bool, notAfter time.Time, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              []string{cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestInspectCertificates(t *testing.T) {
+	now := time.Now()
+	ca, caKey, caPEM := newTestCertificate(t, "test-ca", true, now.Add(365*24*time.Hour), nil, nil)
+	_, _, leafPEM := newTestCertificate(t, "web.default.svc", false, now.Add(10*24*time.Hour), ca, caKey)
+	_, _, selfSignedPEM := newTestCertificate(t, "self", false, now.Add(-24*time.Hour), nil, nil)
+
+	output := "### file /etc/tls/ca.crt\n" + caPEM +
+		"### file /etc/tls/tls.crt\n" + leafPEM +
+		"### file /etc/other/expired.pem\n" + selfSignedPEM +
+		"### endpoint db:5432\nCONNECTED(00000003)\n"
+
+	reports := inspectCertificates(output, now, 30)
+	if len(reports) != 4 {
+		t.Fatalf("inspectCertificates() returned %d reports, want 4", len(reports))
+	}
+
+	bySource := map[string]certReport{}
+	for _, report := range reports {
+		bySource[report.Source] = report
+	}
+
+	leaf := bySource["file /etc/tls/tls.crt"]
+	if leaf.Chain != "valid" || !strings.HasPrefix(leaf.Status, "EXPIRING") {
+		t.Errorf("leaf report = %+v, want valid chain expiring soon", leaf)
+	}
+	if len(leaf.SANs) != 1 || leaf.SANs[0] != "web.default.svc" {
+		t.Errorf("leaf SANs = %v, want [web.default.svc]", leaf.SANs)
+	}
+
+	expired := bySource["file /etc/other/expired.pem"]
+	if !strings.HasPrefix(expired.Status, "EXPIRED") || !strings.HasPrefix(expired.Chain, "invalid") {
+		t.Errorf("expired report = %+v, want expired and invalid chain", expired)
+	}
+
+	if ca := bySource["file /etc/tls/ca.crt"]; ca.Chain != "" || !strings.HasPrefix(ca.Status, "OK") {
+		t.Errorf("ca report = %+v, want OK without chain check", ca)
+	}
+
+	if endpoint := bySource["endpoint db:5432"]; endpoint.Status != "connection or TLS handshake failed" {
+		t.Errorf("endpoint report = %+v, want handshake failure", endpoint)
+	}
+}
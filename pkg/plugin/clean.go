@@ -1,6 +1,7 @@
 package plugin
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -12,15 +13,18 @@ var (
 	cleanAllNamespaces bool
 	cleanForce         bool
 	cleanOlderThan     string
+	cleanLeaked        bool
 )
 
 var cleanCmd = &cobra.Command{
-	Use:   "clean",
+	Use:   "clean [debug-pod...]",
 	Short: "Clean up debug pods",
 	Long: `Clean up debug pods created by kpdbug tool.
-This command will remove debug pods based on the specified criteria.`,
+This command will remove debug pods based on the specified criteria.
+When debug pod names are given, only those pods are considered.`,
+	ValidArgsFunction: completeDebugPodNames,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runClean()
+		return runClean(cmd.Context(), args)
 	},
 }
 
@@ -28,11 +32,12 @@ func init() {
 	cleanCmd.Flags().BoolVarP(&cleanAllNamespaces, "all-namespaces", "A", false, "clean debug pods across all namespaces")
 	cleanCmd.Flags().BoolVarP(&cleanForce, "force", "f", false, "force cleanup without confirmation")
 	cleanCmd.Flags().StringVar(&cleanOlderThan, "older-than", "", "clean pods older than specified duration (e.g., 1h, 30m)")
+	cleanCmd.Flags().BoolVar(&cleanLeaked, "leaked", false, "only clean --rm pods whose kpdbug process on this host exited without deleting them")
 	rootCmd.AddCommand(cleanCmd)
 }
 
-func runClean() error {
-	debugPods, err := getDebugPods()
+func runClean(ctx context.Context, names []string) error {
+	debugPods, err := getDebugPods(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get debug pods: %v", err)
 	}
@@ -42,7 +47,7 @@ func runClean() error {
 		return nil
 	}
 
-	podsToDelete, err := filterPodsForCleanup(debugPods)
+	podsToDelete, err := filterPodsForCleanup(filterPodsByName(debugPods, names))
 	if err != nil {
 		return fmt.Errorf("failed to filter pods: %v", err)
 	}
@@ -71,7 +76,7 @@ func runClean() error {
 
 	deletedCount := 0
 	for _, pod := range podsToDelete {
-		err := deletePodByName(pod.Name, pod.Namespace)
+		err := deletePodByName(ctx, pod.Name, pod.Namespace)
 		if err != nil {
 			fmt.Printf("Warning: Failed to delete pod %s/%s: %v\n",
 				pod.Namespace, pod.Name, err)
@@ -86,6 +91,9 @@ func runClean() error {
 }
 
 func filterPodsForCleanup(pods []DebugPodInfo) ([]DebugPodInfo, error) {
+	if cleanLeaked {
+		pods = filterLeakedPods(pods)
+	}
 	if cleanOlderThan == "" {
 		return pods, nil
 	}
@@ -96,7 +104,7 @@ func filterPodsForCleanup(pods []DebugPodInfo) ([]DebugPodInfo, error) {
 	}
 
 	var filtered []DebugPodInfo
-	cutoff := time.Now().Add(-duration)
+	cutoff := clock().Add(-duration)
 
 	for _, pod := range pods {
 		if pod.CreationTimestamp.Before(cutoff) {
@@ -107,6 +115,26 @@ func filterPodsForCleanup(pods []DebugPodInfo) ([]DebugPodInfo, error) {
 	return filtered, nil
 }
 
+// filterPodsByName keeps only the named pods; no names keeps all of them
+func filterPodsByName(pods []DebugPodInfo, names []string) []DebugPodInfo {
+	if len(names) == 0 {
+		return pods
+	}
+
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	var filtered []DebugPodInfo
+	for _, pod := range pods {
+		if wanted[pod.Name] {
+			filtered = append(filtered, pod)
+		}
+	}
+	return filtered
+}
+
 func askForConfirmation(prompt string) bool {
 	fmt.Print(prompt)
 	var response string
@@ -115,7 +143,12 @@ func askForConfirmation(prompt string) bool {
 	return response == "y" || response == "yes"
 }
 
-func deletePodByName(podName, namespace string) error {
-	cmd := ExecCommand("kubectl", "delete", "pod", podName, "-n", namespace)
+func deletePodByName(ctx context.Context, podName, namespace string) error {
+	cmd := kubectlCommand(ctx, "delete", "pod", podName, "-n", namespace)
 	return cmd.Run()
 }
+
+// DeleteDebugPod deletes the debug pod in the config's namespace
+func (config *DebugConfig) DeleteDebugPod(pod string) error {
+	return config.deletePod(pod)
+}
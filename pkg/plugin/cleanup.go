@@ -0,0 +1,142 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// removeAfterAnnotation marks a --rm debug pod with the kpdbug process that
+// deletes it, like a finalizer: a pod still carrying it after that process
+// is gone leaked, e.g. because kpdbug crashed, and kpdbug clean --leaked
+// deletes it
+const removeAfterAnnotation = "debug-tool/remove-after"
+
+// cleanupAttempts bounds the attempts to delete a --rm debug pod
+const cleanupAttempts = 3
+
+// removalOwner names this process in removeAfterAnnotation: <host>/<pid>
+func removalOwner() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s/%d", host, os.Getpid())
+}
+
+// ownerGone reports whether the kpdbug process named by a removeAfter
+// annotation has exited. Processes on other hosts cannot be checked and are
+// taken to be running.
+func ownerGone(owner string) bool {
+	i := strings.LastIndex(owner, "/")
+	if i < 0 {
+		return false
+	}
+	pid, err := strconv.Atoi(owner[i+1:])
+	if host, _ := os.Hostname(); err != nil || owner[:i] != host {
+		return false
+	}
+	return !processRunning(pid)
+}
+
+// podCleanup deletes a --rm debug pod exactly once, however many of the
+// operation's exit paths run it
+type podCleanup struct {
+	config *DebugConfig
+	pod    string
+	once   sync.Once
+	kept   atomic.Bool
+	// stop ends marking a copy, marked is closed once marking is over
+	stop   chan struct{}
+	marked chan struct{}
+}
+
+// removeOnExit returns the cleanup of the --rm debug pod, for the operation
+// to defer right after the pod was created or its name reserved. Pods
+// created by kpdbug carry removeAfterAnnotation from the start; a copy,
+// created by kubectl debug, is labelled and annotated once it appears so
+// kpdbug clean --leaked finds it too.
+func (config *DebugConfig) removeOnExit(pod string, copied bool) *podCleanup {
+	cleanup := &podCleanup{config: config, pod: pod}
+	if copied {
+		cleanup.stop = make(chan struct{})
+		cleanup.marked = make(chan struct{})
+		go func() {
+			defer close(cleanup.marked)
+			config.markForRemoval(pod, cleanup.stop)
+		}()
+	}
+	return cleanup
+}
+
+// keep leaves the pod to be reattached; it counts as leaked once kpdbug
+// exited
+func (c *podCleanup) keep() {
+	c.kept.Store(true)
+}
+
+// run deletes the pod unless it is kept, retrying failures with backoff as
+// the deletion is idempotent. An interrupt does not exit the process but
+// cancels the step in flight, so the operation returns through its deferred
+// cleanup, which runs on the cleanup context.
+func (c *podCleanup) run() {
+	c.once.Do(func() {
+		if c.stop != nil {
+			close(c.stop)
+			<-c.marked
+		}
+		if c.kept.Load() || c.config.detachedPod == c.pod {
+			return
+		}
+
+		config := c.config
+		if config.context().Err() != nil {
+			config.logf("Interrupted, cleaning up debug pod %s...", c.pod)
+		} else {
+			config.logf("Cleaning up debug pod %s...", c.pod)
+		}
+		var err error
+		for attempt := 0; attempt < cleanupAttempts; attempt++ {
+			if attempt > 0 {
+				time.Sleep(backoffDelay(attempt - 1))
+			}
+			if err = config.deletePod(c.pod); err == nil {
+				config.logf("Debug pod deleted successfully")
+				return
+			}
+		}
+		config.logf("Warning: Failed to delete debug pod %s: %v; delete it with: kpdbug clean --leaked -n %s", c.pod, err, config.Namespace)
+	})
+}
+
+// markForRemoval labels the copy pod as a debug pod and annotates it with
+// removeAfterAnnotation, retrying until it exists or stop is closed. Errors
+// are not logged over the session's terminal.
+func (config *DebugConfig) markForRemoval(pod string, stop <-chan struct{}) {
+	patch := fmt.Sprintf(`{"metadata":{"labels":{"debug-tool/type":"debug-pod"},"annotations":{%q:%q}}}`,
+		removeAfterAnnotation, removalOwner())
+	for i := 0; i < maxAttempts; i++ {
+		err := config.kubectlWithContext(config.cleanupContext(), "patch", "pod", pod, "-n", config.Namespace,
+			"--type=merge", "-p", patch).Run()
+		if err == nil {
+			return
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(sleepDuration):
+		}
+	}
+}
+
+// filterLeakedPods keeps the --rm debug pods whose kpdbug process is gone
+func filterLeakedPods(pods []DebugPodInfo) []DebugPodInfo {
+	var leaked []DebugPodInfo
+	for _, pod := range pods {
+		if pod.RemoveOwner != "" && ownerGone(pod.RemoveOwner) {
+			leaked = append(leaked, pod)
+		}
+	}
+	return leaked
+}
@@ -0,0 +1,95 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// flakyDeleteRunner fails the first failures deletions and counts them all
+type flakyDeleteRunner struct {
+	fakeClusterRunner
+	failures int
+	deletes  *int
+}
+
+func (r flakyDeleteRunner) Stream(ctx context.Context, streams IOStreams, name string, args ...string) error {
+	if args[0] == "delete" {
+		*r.deletes++
+		if *r.deletes <= r.failures {
+			fmt.Fprintln(streams.ErrOut, "Error from server (InternalError): etcdserver: request timed out")
+			return &ExitCodeError{Code: 1}
+		}
+	}
+	return r.fakeClusterRunner.Stream(ctx, streams, name, args...)
+}
+
+func TestPodCleanup(t *testing.T) {
+	defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	deletes := 0
+	config := &DebugConfig{
+		Namespace: "default", Operation: OperationStandalone, Image: "busybox", Profile: "general",
+		Command: "true", RemoveAfter: true, CPURequest: "100m", MemoryLimit: "128Mi", MemoryRequest: "128Mi",
+		Runner: flakyDeleteRunner{fakeClusterRunner: fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}}, failures: 1, deletes: &deletes},
+	}
+	pod, err := config.createDebugPod()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pods, err := config.ListDebugPods(false)
+	if err != nil || len(pods) != 1 || pods[0].RemoveOwner != removalOwner() {
+		t.Fatalf("ListDebugPods() = %+v, %v, want the pod marked for removal by %s", pods, err, removalOwner())
+	}
+	// Owned by this process, which is running
+	if leaked := filterLeakedPods(pods); len(leaked) != 0 {
+		t.Errorf("filterLeakedPods() = %v, want none", leaked)
+	}
+
+	// Every exit path may run it, the pod is deleted once and retried
+	cleanup := config.removeOnExit(pod, false)
+	cleanup.run()
+	cleanup.run()
+	if deletes != 2 {
+		t.Errorf("%d deletions, want a failed one and its retry", deletes)
+	}
+	if pods, err := config.ListDebugPods(false); err != nil || len(pods) != 0 {
+		t.Errorf("ListDebugPods() after cleanup = %v, %v, want none", pods, err)
+	}
+
+	// A kept pod is left for reattaching
+	deletes = 0
+	kept := config.removeOnExit(pod, false)
+	kept.keep()
+	kept.run()
+	if deletes != 0 {
+		t.Errorf("%d deletions of a kept pod, want none", deletes)
+	}
+}
+
+func TestFilterLeakedPods(t *testing.T) {
+	// The pid of an exited process
+	cmd := exec.Command("go", "version")
+	cmd.Stdout = io.Discard
+	if err := cmd.Run(); err != nil {
+		t.Skip("go not available")
+	}
+	host, _ := os.Hostname()
+	exited := fmt.Sprintf("%s/%d", host, cmd.Process.Pid)
+
+	pods := []DebugPodInfo{
+		{Name: "running", RemoveOwner: removalOwner()},
+		{Name: "crashed", RemoveOwner: exited},
+		{Name: "elsewhere", RemoveOwner: "build-agent-7/4242"},
+		{Name: "kept"},
+	}
+	leaked := filterLeakedPods(pods)
+	if len(leaked) != 1 || leaked[0].Name != "crashed" {
+		t.Errorf("filterLeakedPods() = %v, want only the pod of the exited process", leaked)
+	}
+}
@@ -0,0 +1,32 @@
+package plugin
+
+import (
+	cryptorand "crypto/rand"
+	"io"
+	"math/rand"
+	"time"
+)
+
+// deterministicEpoch is the time the clock stands still at in deterministic
+// mode
+var deterministicEpoch = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+var (
+	// clock returns the current time for names, timestamps and ages
+	clock = time.Now
+	// randomSource draws the random parts of generated names
+	randomSource io.Reader = cryptorand.Reader
+)
+
+// useDeterministicMode stops the clock and seeds the random source, so
+// generated names, event timestamps and ages are the same on every run and
+// output can be compared with golden files. Timeouts keep using real time.
+func useDeterministicMode() {
+	clock = func() time.Time { return deterministicEpoch }
+	randomSource = rand.New(rand.NewSource(1))
+}
+
+// since is time.Since on the injectable clock
+func since(t time.Time) time.Duration {
+	return clock().Sub(t)
+}
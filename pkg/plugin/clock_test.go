@@ -0,0 +1,30 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeterministicMode(t *testing.T) {
+	origClock, origSource := clock, randomSource
+	defer func() { clock, randomSource = origClock, origSource }()
+
+	config := &DebugConfig{PodName: "web"}
+	useDeterministicMode()
+	first := config.generateUniqueName()
+	useDeterministicMode()
+	if second := config.generateUniqueName(); second != first {
+		t.Errorf("generateUniqueName() = %s then %s, want the same name", first, second)
+	}
+	if !strings.HasPrefix(first, "debug-web-120000-") {
+		t.Errorf("generateUniqueName() = %s, want the stopped clock's time", first)
+	}
+
+	if age := calculateAge(deterministicEpoch.Add(-90 * time.Minute)); age != "1h" {
+		t.Errorf("calculateAge(90m ago) = %s, want 1h", age)
+	}
+	if age := calculateAge(deterministicEpoch.Add(time.Hour)); age != "0s" {
+		t.Errorf("calculateAge(future) = %s, want 0s", age)
+	}
+}
@@ -1,6 +1,7 @@
 package plugin
 
 import (
+	"context"
 	"os"
 	"strings"
 
@@ -10,7 +11,11 @@ import (
 var completionCmd = &cobra.Command{
 	Use:   "completion [bash|zsh|fish|powershell]",
 	Short: "Generate completion script",
-	Long: `To load completions:
+	Long: `To install the completion for your shell where it is loaded automatically:
+
+  $ kpdbug completion install
+
+To load completions manually:
 
 Bash:
 
@@ -68,64 +73,178 @@ PowerShell:
 
 func init() {
 	rootCmd.AddCommand(completionCmd)
-
-	// Set up custom completions for flags
-	setupCustomCompletions()
 }
 
+// setupCustomCompletions registers flag completions; it is called from the
+// root command's init once the persistent flags have been defined
 func setupCustomCompletions() {
+	// Context completion from the selected kubeconfig
+	_ = rootCmd.RegisterFlagCompletionFunc("context", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return getKubeContexts(cmd.Context()), cobra.ShellCompDirectiveNoFileComp
+	})
+
 	// Namespace completion
 	_ = rootCmd.RegisterFlagCompletionFunc("namespace", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return getNamespaces(), cobra.ShellCompDirectiveNoFileComp
+		return getNamespaces(cmd.Context()), cobra.ShellCompDirectiveNoFileComp
 	})
 
 	// Pod completion
 	_ = rootCmd.RegisterFlagCompletionFunc("pod", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return getPods(), cobra.ShellCompDirectiveNoFileComp
+		return getPods(cmd.Context()), cobra.ShellCompDirectiveNoFileComp
 	})
 
 	// Profile completion
 	_ = rootCmd.RegisterFlagCompletionFunc("profile", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return []string{"general", "restricted", "baseline", "privileged"}, cobra.ShellCompDirectiveNoFileComp
+		return validProfiles, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	_ = rootCmd.RegisterFlagCompletionFunc("preset", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return presetNames(), cobra.ShellCompDirectiveNoFileComp
 	})
 
-	// Image completion (common debug images)
+	// Container completion from the selected target pod
+	_ = rootCmd.RegisterFlagCompletionFunc("container", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		// Completion does not run PersistentPreRunE, which sets podName
+		target := podName
+		if len(podNames) > 0 {
+			target = podNames[0]
+		}
+		return getContainers(cmd.Context(), target), cobra.ShellCompDirectiveNoFileComp
+	})
+
+	// Image completion (common debug images plus the configured catalog)
 	_ = rootCmd.RegisterFlagCompletionFunc("image", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
-		return []string{
-			"debug:latest",
-			"busybox:latest",
-			"alpine:latest",
-			"ubuntu:latest",
-			"nicolaka/netshoot:latest",
-		}, cobra.ShellCompDirectiveNoFileComp
+		return getImages(), cobra.ShellCompDirectiveNoFileComp
 	})
 }
 
-func getNamespaces() []string {
-	cmd := ExecCommand("kubectl", "get", "namespaces", "-o", "jsonpath={.items[*].metadata.name}")
-	output, err := cmd.Output()
-	if err != nil {
-		return []string{"default"}
+// completeDebugPodNames completes positional arguments with debug pod names
+func completeDebugPodNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return getDebugPodNames(cmd.Context()), cobra.ShellCompDirectiveNoFileComp
+}
+
+// defaultImages are always offered by --image completion
+var defaultImages = []string{
+	"debug:latest",
+	"busybox:latest",
+	"alpine:latest",
+	"ubuntu:latest",
+	"nicolaka/netshoot:latest",
+}
+
+func getImages() []string {
+	images := append([]string{}, defaultImages...)
+	seen := make(map[string]bool, len(images))
+	for _, img := range images {
+		seen[img] = true
+	}
+	for _, img := range currentConfig().Images {
+		if !seen[img] {
+			images = append(images, img)
+			seen[img] = true
+		}
 	}
+	return images
+}
 
-	namespaces := strings.Fields(string(output))
-	if len(namespaces) == 0 {
+func getNamespaces(ctx context.Context) []string {
+	namespaces, err := cachedLookup("namespaces", func() ([]string, error) {
+		cmd := kubectlCommand(ctx, "get", "namespaces", "-o", "jsonpath={.items[*].metadata.name}")
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, err
+		}
+		return strings.Fields(string(output)), nil
+	})
+	if err != nil || len(namespaces) == 0 {
 		return []string{"default"}
 	}
 	return namespaces
 }
 
-func getPods() []string {
-	ns := namespace
-	if ns == "" {
-		ns = "default"
+func getNodes(ctx context.Context) []string {
+	nodes, err := cachedLookup("nodes", func() ([]string, error) {
+		cmd := kubectlCommand(ctx, "get", "nodes", "-o", "jsonpath={.items[*].metadata.name}")
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, err
+		}
+		return strings.Fields(string(output)), nil
+	})
+	if err != nil {
+		return []string{}
 	}
+	return nodes
+}
+
+func getPods(ctx context.Context) []string {
+	return getPodsInNamespace(ctx, currentNamespace(ctx))
+}
 
-	cmd := ExecCommand("kubectl", "get", "pods", "-n", ns, "-o", "jsonpath={.items[*].metadata.name}")
-	output, err := cmd.Output()
+func getPodsInNamespace(ctx context.Context, ns string) []string {
+	pods, err := cachedLookup("pods/"+ns, func() ([]string, error) {
+		cmd := kubectlCommand(ctx, "get", "pods", "-n", ns, "-o", "jsonpath={.items[*].metadata.name}")
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, err
+		}
+		return strings.Fields(string(output)), nil
+	})
+	if err != nil {
+		return []string{}
+	}
+	return pods
+}
+
+func getContainers(ctx context.Context, pod string) []string {
+	if pod == "" {
+		return []string{}
+	}
+
+	ns := currentNamespace(ctx)
+
+	containers, err := cachedLookup("containers/"+ns+"/"+pod, func() ([]string, error) {
+		cmd := kubectlCommand(ctx, "get", "pod", pod, "-n", ns, "-o", "jsonpath={.spec.containers[*].name}")
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, err
+		}
+		return strings.Fields(string(output)), nil
+	})
 	if err != nil {
 		return []string{}
 	}
+	return containers
+}
 
+func getDebugPodNames(ctx context.Context) []string {
+	ns := currentNamespace(ctx)
+
+	names, err := cachedLookup("debug-pods/"+ns, func() ([]string, error) {
+		cmd := kubectlCommand(ctx, "get", "pods", "-n", ns, "-l", "debug-tool/type=debug-pod",
+			"-o", "jsonpath={.items[*].metadata.name}")
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, err
+		}
+		return strings.Fields(string(output)), nil
+	})
+	if err != nil {
+		return []string{}
+	}
+	return names
+}
+
+func getKubeContexts(ctx context.Context) []string {
+	// --context is not forwarded here, every context of the kubeconfig is a candidate
+	args := []string{"config", "get-contexts", "-o", "name"}
+	if kubeconfig != "" {
+		args = append(args, "--kubeconfig="+kubeconfig)
+	}
+
+	output, err := newRunnerCommand(ctx, defaultRunner, "kubectl", args...).Output()
+	if err != nil {
+		return []string{}
+	}
 	return strings.Fields(string(output))
 }
@@ -0,0 +1,63 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// completionCacheTTL is how long completion lookups are served from disk
+var completionCacheTTL = 30 * time.Second
+
+// completionCacheEntry is the on-disk format of a cached completion lookup
+type completionCacheEntry struct {
+	Items     []string  `json:"items"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// cachedLookup returns the cached result for key if it is younger than the
+// TTL, otherwise calls fetch and stores its result. Failed lookups are never
+// cached, and --no-cache bypasses the cache entirely.
+func cachedLookup(key string, fetch func() ([]string, error)) ([]string, error) {
+	if noCache {
+		return fetch()
+	}
+
+	path, err := completionCachePath(key)
+	if err != nil {
+		return fetch()
+	}
+
+	if data, err := os.ReadFile(path); err == nil {
+		var entry completionCacheEntry
+		if json.Unmarshal(data, &entry) == nil && time.Since(entry.Timestamp) < completionCacheTTL {
+			return entry.Items, nil
+		}
+	}
+
+	items, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(completionCacheEntry{Items: items, Timestamp: time.Now()})
+	if err == nil && os.MkdirAll(filepath.Dir(path), 0o700) == nil {
+		_ = os.WriteFile(path, data, 0o600)
+	}
+	return items, nil
+}
+
+// completionCachePath maps a lookup key to its cache file. The global kubectl
+// flags are part of the key so different identities never share entries.
+func completionCachePath(key string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(key + "\x00" + strings.Join(globalKubectlFlags(), "\x00")))
+	return filepath.Join(dir, "kpdbug", "completion", hex.EncodeToString(sum[:16])+".json"), nil
+}
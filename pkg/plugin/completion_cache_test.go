@@ -0,0 +1,54 @@
+package plugin
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCompletionCache(t *testing.T) {
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("HOME", cache)
+	oldNoCache, oldUser, oldTTL := noCache, asUser, completionCacheTTL
+	defer func() { noCache, asUser, completionCacheTTL = oldNoCache, oldUser, oldTTL }()
+	noCache, asUser = false, ""
+
+	fetches := 0
+	fetch := func(items ...string) func() ([]string, error) {
+		return func() ([]string, error) {
+			fetches++
+			return items, nil
+		}
+	}
+	failing := func() ([]string, error) {
+		fetches++
+		return nil, errors.New("connection refused")
+	}
+
+	tests := []struct {
+		name    string
+		setup   func()
+		key     string
+		fetch   func() ([]string, error)
+		want    []string
+		fetched bool
+	}{
+		{"miss", func() {}, "pods/default", fetch("web-0"), []string{"web-0"}, true},
+		{"hit", func() {}, "pods/default", fetch("web-1"), []string{"web-0"}, false},
+		{"other key", func() {}, "pods/payments", fetch("api-0"), []string{"api-0"}, true},
+		{"other identity", func() { asUser = "alice" }, "pods/default", fetch("web-2"), []string{"web-2"}, true},
+		{"failure is not cached", func() { asUser = "bob" }, "pods/default", failing, nil, true},
+		{"after a failure", func() {}, "pods/default", fetch("web-3"), []string{"web-3"}, true},
+		{"--no-cache", func() { noCache = true }, "pods/default", fetch("web-4"), []string{"web-4"}, true},
+		{"expired", func() { noCache, completionCacheTTL = false, 0 }, "pods/default", fetch("web-5"), []string{"web-5"}, true},
+	}
+	for _, tt := range tests {
+		tt.setup()
+		before := fetches
+		got, _ := cachedLookup(tt.key, tt.fetch)
+		if !reflect.DeepEqual(got, tt.want) || (fetches > before) != tt.fetched {
+			t.Errorf("%s: cachedLookup() = %v, fetched %v, want %v, fetched %v", tt.name, got, fetches > before, tt.want, tt.fetched)
+		}
+	}
+}
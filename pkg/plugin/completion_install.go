@@ -0,0 +1,148 @@
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	completionShell string
+	completionPath  string
+)
+
+// completionShells lists the shells completion install supports
+var completionShells = []string{"bash", "zsh", "fish"}
+
+var completionInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Install the completion script for your shell",
+	Long: `Detect the shell from $SHELL (or --shell), write the completion script where
+the shell loads it automatically and print what, if anything, is left to do:
+
+  bash  $XDG_DATA_HOME/bash-completion/completions/kpdbug, loaded by bash-completion 2
+  zsh   $HOMEBREW_PREFIX/share/zsh/site-functions/_kpdbug, or ~/.zfunc/_kpdbug
+  fish  $XDG_CONFIG_HOME/fish/completions/kpdbug.fish`,
+	Example: `  kpdbug completion install
+  kpdbug completion install --shell zsh --path ~/.zsh/completions/_kpdbug`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runCompletionInstall(cmd.Root())
+	},
+}
+
+func init() {
+	completionInstallCmd.Flags().StringVar(&completionShell, "shell", "", "shell to install the completion for (bash, zsh, fish); defaults to $SHELL")
+	completionInstallCmd.Flags().StringVar(&completionPath, "path", "", "file to write the completion script to instead of the shell's default location")
+	_ = completionInstallCmd.RegisterFlagCompletionFunc("shell", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completionShells, cobra.ShellCompDirectiveNoFileComp
+	})
+	completionCmd.AddCommand(completionInstallCmd)
+}
+
+func runCompletionInstall(root *cobra.Command) error {
+	shell := completionShell
+	if shell == "" {
+		shell = filepath.Base(os.Getenv("SHELL"))
+		// PowerShell and cmd do not set $SHELL
+		if os.Getenv("SHELL") == "" && runtime.GOOS == "windows" {
+			shell = "powershell"
+		}
+	}
+
+	var script bytes.Buffer
+	var err error
+	switch shell {
+	case "bash":
+		err = root.GenBashCompletion(&script)
+	case "zsh":
+		err = root.GenZshCompletion(&script)
+	case "fish":
+		err = root.GenFishCompletion(&script, true)
+	case "powershell", "pwsh":
+		return NewValidationError("shell", shell, "PowerShell has no completion directory to install into").
+			WithSuggestion("Add the script to your profile: kpdbug completion powershell >> $PROFILE")
+	default:
+		return NewValidationError("shell", shell, "must be bash, zsh or fish").
+			WithSuggestion("Pass the shell with --shell")
+	}
+	if err != nil {
+		return err
+	}
+
+	path, hint, err := completionInstallPath(shell)
+	if err != nil {
+		return err
+	}
+	if completionPath != "" {
+		path, hint = completionPath, completionSourceHint(shell, completionPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("error creating completion directory: %v", err)
+	}
+	if err := os.WriteFile(path, script.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("error writing completion script: %v", err)
+	}
+
+	fmt.Printf("Installed %s completion to %s\n", shell, path)
+	if hint != "" {
+		fmt.Println(hint)
+	}
+	fmt.Println("Start a new shell to load it.")
+	return nil
+}
+
+// completionInstallPath returns where shell loads completion scripts from
+// without further configuration, with a hint when the user has to configure
+// the shell anyway
+func completionInstallPath(shell string) (string, string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", fmt.Errorf("error finding the home directory: %v", err)
+	}
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(home, ".config")
+	}
+
+	switch shell {
+	case "bash":
+		return filepath.Join(dataHome, "bash-completion", "completions", "kpdbug"),
+			"bash-completion 2 loads it on demand; without bash-completion, add to ~/.bashrc:\n  source <(kpdbug completion bash)", nil
+	case "zsh":
+		// Homebrew's site-functions directory is in the default fpath
+		if prefix := os.Getenv("HOMEBREW_PREFIX"); prefix != "" {
+			dir := filepath.Join(prefix, "share", "zsh", "site-functions")
+			if info, err := os.Stat(dir); err == nil && info.IsDir() {
+				return filepath.Join(dir, "_kpdbug"), "", nil
+			}
+		}
+		path := filepath.Join(home, ".zfunc", "_kpdbug")
+		return path, completionSourceHint(shell, path), nil
+	case "fish":
+		return filepath.Join(configHome, "fish", "completions", "kpdbug.fish"), "", nil
+	}
+	return "", "", NewValidationError("shell", shell, "must be bash, zsh or fish")
+}
+
+// completionSourceHint explains how to load a completion script from a
+// directory the shell does not search by default
+func completionSourceHint(shell, path string) string {
+	switch shell {
+	case "zsh":
+		return fmt.Sprintf("Unless %s is already in your fpath, add to ~/.zshrc:\n  fpath=(%s $fpath)\n  autoload -U compinit && compinit",
+			filepath.Dir(path), filepath.Dir(path))
+	case "fish":
+		return fmt.Sprintf("Unless %s is in $fish_complete_path, add to ~/.config/fish/config.fish:\n  source %s", filepath.Dir(path), path)
+	default:
+		return fmt.Sprintf("Add to ~/.bashrc:\n  source %s", shellQuote(path))
+	}
+}
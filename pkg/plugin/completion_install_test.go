@@ -0,0 +1,57 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompletionInstall(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_DATA_HOME", "")
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+	t.Setenv("HOMEBREW_PREFIX", "")
+	oldShell, oldPath := completionShell, completionPath
+	defer func() { completionShell, completionPath = oldShell, oldPath }()
+
+	tests := []struct {
+		shell string
+		path  string
+		hint  bool
+	}{
+		{"bash", filepath.Join(home, ".local", "share", "bash-completion", "completions", "kpdbug"), true},
+		{"zsh", filepath.Join(home, ".zfunc", "_kpdbug"), true},
+		{"fish", filepath.Join(home, "config", "fish", "completions", "kpdbug.fish"), false},
+	}
+	for _, tt := range tests {
+		path, hint, err := completionInstallPath(tt.shell)
+		if err != nil || path != tt.path || (hint != "") != tt.hint {
+			t.Errorf("completionInstallPath(%s) = %q, %q, %v, want %q", tt.shell, path, hint, err, tt.path)
+		}
+	}
+
+	brew := filepath.Join(home, "brew")
+	if err := os.MkdirAll(filepath.Join(brew, "share", "zsh", "site-functions"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HOMEBREW_PREFIX", brew)
+	if path, hint, _ := completionInstallPath("zsh"); path != filepath.Join(brew, "share", "zsh", "site-functions", "_kpdbug") || hint != "" {
+		t.Errorf("completionInstallPath(zsh) with Homebrew = %q, %q", path, hint)
+	}
+
+	t.Setenv("SHELL", "/usr/bin/fish")
+	completionShell, completionPath = "", ""
+	if err := runCompletionInstall(rootCmd); err != nil {
+		t.Fatal(err)
+	}
+	if script, err := os.ReadFile(tests[2].path); err != nil || !strings.Contains(string(script), "complete -c kpdbug") {
+		t.Errorf("installed fish completion = %.40q, %v", script, err)
+	}
+
+	completionShell = "powershell"
+	if err := runCompletionInstall(rootCmd); err == nil {
+		t.Error("runCompletionInstall(powershell) succeeded")
+	}
+}
@@ -0,0 +1,69 @@
+package plugin
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompletionHonorsGlobalFlags(t *testing.T) {
+	origRunner, oldNamespace, oldNoCache := defaultRunner, namespace, noCache
+	oldKubeconfig, oldContext := kubeconfig, kubeContext
+	defer func() {
+		defaultRunner, namespace, noCache = origRunner, oldNamespace, oldNoCache
+		kubeconfig, kubeContext = oldKubeconfig, oldContext
+		for _, name := range []string{"namespace", "context", "kubeconfig", "pod"} {
+			rootCmd.PersistentFlags().Lookup(name).Changed = false
+		}
+		rootCmd.SetArgs(nil)
+		rootCmd.SetOut(nil)
+		rootCmd.SetErr(nil)
+		loadedConfig = nil
+	}()
+	noCache = true
+	loadedConfig = &Config{}
+
+	tests := []struct {
+		name string
+		args []string
+		call string
+		want string
+	}{
+		{
+			name: "pods in the --namespace of the --context",
+			args: []string{"__complete", "--context", "staging", "-n", "payments", "-p", ""},
+			call: "kubectl get pods -n payments -o jsonpath={.items[*].metadata.name} --context=staging",
+			want: "api-0",
+		},
+		{
+			name: "namespaces of the --kubeconfig",
+			args: []string{"__complete", "--kubeconfig", "/tmp/other", "-n", ""},
+			call: "kubectl get namespaces -o jsonpath={.items[*].metadata.name} --kubeconfig=/tmp/other",
+			want: "payments",
+		},
+		{
+			name: "pods in the namespace of the --context",
+			args: []string{"__complete", "--context", "staging", "-p", ""},
+			call: "kubectl get pods -n team-a -o jsonpath={.items[*].metadata.name} --context=staging",
+			want: "web-0",
+		},
+	}
+	for _, tt := range tests {
+		namespace, kubeconfig, kubeContext = "", "", ""
+		defaultRunner = &fakeRunner{outputs: map[string]string{
+			tt.call: tt.want,
+			"kubectl config view --minify -o jsonpath={..namespace} --context=staging": "team-a",
+		}}
+		var out bytes.Buffer
+		rootCmd.SetOut(&out)
+		rootCmd.SetErr(io.Discard)
+		rootCmd.SetArgs(tt.args)
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := strings.Fields(out.String()); len(got) == 0 || got[0] != tt.want {
+			t.Errorf("%s: completions = %q, want %s from %q (ran %v)", tt.name, out.String(), tt.want, tt.call, defaultRunner.(*fakeRunner).calls)
+		}
+	}
+}
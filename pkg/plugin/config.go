@@ -0,0 +1,93 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config holds user settings loaded from the kpdbug config file
+type Config struct {
+	// Images is the catalog of debug images offered by --image completion,
+	// typically including private registry entries
+	Images []string `json:"images,omitempty"`
+	// Presets are named debugging setups selected with --preset
+	Presets map[string]Preset `json:"presets,omitempty"`
+	// Naming customizes generated debug pod names
+	Naming *Naming `json:"naming,omitempty"`
+	// OrphanSweep enables the startup reminder about forgotten debug pods
+	OrphanSweep *OrphanSweep `json:"orphanSweep,omitempty"`
+	// Notifications announces privileged and host-namespace sessions
+	Notifications *Notifications `json:"notifications,omitempty"`
+	// ImageRewrites maps registry or repository prefixes to mirrors, e.g.
+	// docker.io/nicolaka/netshoot: internal.registry/mirror/netshoot, and
+	// applies to every image kpdbug runs
+	ImageRewrites map[string]string `json:"imageRewrites,omitempty"`
+	// ImageVerification checks debug images with cosign or a scanner before
+	// elevated debug pods are created
+	ImageVerification *ImageVerification `json:"imageVerification,omitempty"`
+	// MaxTTL, e.g. 4h, caps --ttl and is the lifetime of debug pods when
+	// --ttl is not set
+	MaxTTL string `json:"maxTTL,omitempty"`
+}
+
+var (
+	configFile   string
+	loadedConfig *Config
+)
+
+// currentConfig returns the user config, loading it on first use. A missing
+// file yields an empty config; a broken one is reported and ignored.
+func currentConfig() *Config {
+	if loadedConfig != nil {
+		return loadedConfig
+	}
+
+	cfg, err := loadConfig(configFilePath())
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		cfg = &Config{}
+	}
+	loadedConfig = cfg
+	return loadedConfig
+}
+
+// configFilePath resolves the config file from --config, $KPDBUG_CONFIG or
+// the per-user config directory, in that order
+func configFilePath() string {
+	if configFile != "" {
+		return configFile
+	}
+	if path := os.Getenv("KPDBUG_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "kpdbug", "config.yaml")
+}
+
+// loadConfig reads the config file at path; a missing file is not an error
+func loadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file %s: %v", path, err)
+	}
+
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %v", path, err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,363 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	configDiffConfigMap string
+	configDiffSecret    string
+)
+
+// Drift states of a mounted key
+const (
+	driftInSync  = "in sync"
+	driftStale   = "stale"
+	driftPending = "pending"
+	driftMissing = "missing"
+	driftExtra   = "extra"
+)
+
+var configDiffCmd = &cobra.Command{
+	Use:   "config-diff",
+	Short: "Compare a ConfigMap or Secret with the files mounted in a pod",
+	Long: `Compare the live contents of a ConfigMap or Secret in the API with the files
+mounted from it in the target container, key by key.
+
+Drift is reported as:
+  stale    the file differs and is a subPath mount, which never updates;
+           the container must be restarted to see the new value
+  pending  the file differs and the kubelet has not refreshed the volume yet;
+           updates reach pods after the kubelet sync period, usually within
+           a minute or two
+  missing  the key exists in the API but no file was found
+  extra    the file exists but its key was removed from the API
+
+The command exits with code 1 when any key drifted. Secret values are
+compared by hash and never printed.`,
+	Example: `  kpdbug config-diff -p mypod --configmap app-config
+  kpdbug config-diff -p mypod --container app --secret tls-certs`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runConfigDiff(cmd)
+	},
+}
+
+func init() {
+	configDiffCmd.Flags().StringVar(&configDiffConfigMap, "configmap", "", "ConfigMap to compare")
+	configDiffCmd.Flags().StringVar(&configDiffSecret, "secret", "", "Secret to compare")
+	configDiffCmd.MarkFlagsOneRequired("configmap", "secret")
+	configDiffCmd.MarkFlagsMutuallyExclusive("configmap", "secret")
+	rootCmd.AddCommand(configDiffCmd)
+}
+
+// configSource is the live content of a ConfigMap or Secret
+type configSource struct {
+	Kind      string
+	Name      string
+	Data      map[string][]byte
+	UpdatedAt time.Time
+}
+
+// lastUpdate returns the time of the last write to an object, from its
+// managed fields
+func lastUpdate(meta metav1.ObjectMeta) time.Time {
+	updated := meta.CreationTimestamp.Time
+	for _, entry := range meta.ManagedFields {
+		if entry.Time != nil && entry.Time.After(updated) {
+			updated = entry.Time.Time
+		}
+	}
+	return updated
+}
+
+// getConfigSource gets the ConfigMap or Secret from the API
+func (config *DebugConfig) getConfigSource(kind, name string) (*configSource, error) {
+	output, err := config.kubectl("get", kind, name, "-n", config.Namespace, "-o", "json").Output()
+	if err != nil {
+		return nil, NewDetailedError(ErrorTypePodNotFound,
+			fmt.Sprintf("%s '%s' not found in namespace '%s'", kind, name, config.Namespace)).
+			WithCommand(fmt.Sprintf("kubectl get %ss -n %s", kind, config.Namespace)).
+			WithOriginalError(err)
+	}
+
+	source := &configSource{Kind: kind, Name: name, Data: map[string][]byte{}}
+	if kind == "secret" {
+		var secret corev1.Secret
+		if err := json.Unmarshal(output, &secret); err != nil {
+			return nil, fmt.Errorf("error parsing secret JSON: %v", err)
+		}
+		for key, value := range secret.Data {
+			source.Data[key] = value
+		}
+		source.UpdatedAt = lastUpdate(secret.ObjectMeta)
+		return source, nil
+	}
+
+	var configMap corev1.ConfigMap
+	if err := json.Unmarshal(output, &configMap); err != nil {
+		return nil, fmt.Errorf("error parsing configmap JSON: %v", err)
+	}
+	for key, value := range configMap.Data {
+		source.Data[key] = []byte(value)
+	}
+	for key, value := range configMap.BinaryData {
+		source.Data[key] = value
+	}
+	source.UpdatedAt = lastUpdate(configMap.ObjectMeta)
+	return source, nil
+}
+
+// configMount is a mount of the source in a container: a directory of keys
+// or a single key through subPath
+type configMount struct {
+	MountPath string
+	SubPath   bool
+	// Files maps the mounted path of every key to its key
+	Files map[string]string
+}
+
+// volumeItems returns the key to relative path mapping of a volume of the
+// source, or false when the volume does not project it
+func volumeItems(volume corev1.Volume, source *configSource) (map[string]string, bool) {
+	var items []corev1.KeyToPath
+	found := false
+	switch {
+	case source.Kind == "configmap" && volume.ConfigMap != nil && volume.ConfigMap.Name == source.Name:
+		items, found = volume.ConfigMap.Items, true
+	case source.Kind == "secret" && volume.Secret != nil && volume.Secret.SecretName == source.Name:
+		items, found = volume.Secret.Items, true
+	case volume.Projected != nil:
+		for _, projection := range volume.Projected.Sources {
+			if source.Kind == "configmap" && projection.ConfigMap != nil && projection.ConfigMap.Name == source.Name {
+				items, found = projection.ConfigMap.Items, true
+			}
+			if source.Kind == "secret" && projection.Secret != nil && projection.Secret.Name == source.Name {
+				items, found = projection.Secret.Items, true
+			}
+		}
+	}
+	if !found {
+		return nil, false
+	}
+
+	paths := map[string]string{}
+	if len(items) == 0 {
+		for key := range source.Data {
+			paths[key] = key
+		}
+		return paths, true
+	}
+	for _, item := range items {
+		paths[item.Key] = item.Path
+	}
+	return paths, true
+}
+
+// configMounts returns the mounts of the source in container
+func configMounts(spec corev1.PodSpec, container string, source *configSource) []configMount {
+	var mounts []configMount
+	for _, c := range spec.Containers {
+		if c.Name != container {
+			continue
+		}
+		for _, volumeMount := range c.VolumeMounts {
+			for _, volume := range spec.Volumes {
+				if volume.Name != volumeMount.Name {
+					continue
+				}
+				items, ok := volumeItems(volume, source)
+				if !ok {
+					continue
+				}
+				mount := configMount{MountPath: volumeMount.MountPath, SubPath: volumeMount.SubPath != "", Files: map[string]string{}}
+				for key, relative := range items {
+					switch {
+					case !mount.SubPath:
+						mount.Files[path.Join(volumeMount.MountPath, relative)] = key
+					case relative == volumeMount.SubPath:
+						mount.Files[volumeMount.MountPath] = key
+					}
+				}
+				mounts = append(mounts, mount)
+			}
+		}
+	}
+	return mounts
+}
+
+// configDiffScript prints FILE|<path>|<sha256> or MISSING|<path> for every
+// mounted file, ENTRY|<dir>|<name> for the entries of every mounted
+// directory and DATA|<dir>|<..data target> for the kubelet's last refresh
+func configDiffScript(mounts []configMount) string {
+	var b strings.Builder
+	b.WriteString(targetPIDScript)
+	b.WriteString(`check() { if [ -f "$root$1" ]; then echo "FILE|$1|$(sha256sum < "$root$1" | cut -d' ' -f1)"; else echo "MISSING|$1"; fi; }
+`)
+	for _, mount := range mounts {
+		files := make([]string, 0, len(mount.Files))
+		for file := range mount.Files {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			fmt.Fprintf(&b, "check %s\n", shellQuote(file))
+		}
+		if !mount.SubPath {
+			dir := shellQuote(mount.MountPath)
+			fmt.Fprintf(&b, `ls -A "$root"%[1]s 2>/dev/null | grep -v '^\.\.' | while read -r entry; do echo "ENTRY|"%[1]s"|$entry"; done
+echo "DATA|"%[1]s"|$(readlink "$root"%[1]s/..data 2>/dev/null)"
+`, dir)
+		}
+	}
+	return b.String()
+}
+
+// configDrift is the state of one mounted key
+type configDrift struct {
+	Path   string
+	Key    string
+	Status string
+	Detail string
+}
+
+// kubeletRefresh parses the ..YYYY_MM_DD_HH_MM_SS.N directory name the
+// ..data symlink of an atomic writer volume points to
+func kubeletRefresh(target string) (time.Time, bool) {
+	name := strings.TrimPrefix(path.Base(target), "..")
+	if i := strings.Index(name, "."); i > 0 {
+		name = name[:i]
+	}
+	refreshed, err := time.Parse("2006_01_02_15_04_05", name)
+	return refreshed, err == nil
+}
+
+// compareConfig compares the script output with the source
+func compareConfig(output string, mounts []configMount, source *configSource) []configDrift {
+	hashes := map[string]string{}
+	entries := map[string][]string{}
+	refreshed := map[string]time.Time{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), "|", 3)
+		switch {
+		case fields[0] == "FILE" && len(fields) == 3:
+			hashes[fields[1]] = fields[2]
+		case fields[0] == "ENTRY" && len(fields) == 3:
+			entries[fields[1]] = append(entries[fields[1]], fields[2])
+		case fields[0] == "DATA" && len(fields) == 3:
+			if at, ok := kubeletRefresh(fields[2]); ok {
+				refreshed[fields[1]] = at
+			}
+		}
+	}
+
+	var drifts []configDrift
+	for _, mount := range mounts {
+		for file, key := range mount.Files {
+			drift := configDrift{Path: file, Key: key, Status: driftInSync}
+			sum := sha256.Sum256(source.Data[key])
+			hash, found := hashes[file]
+			switch {
+			case !found:
+				drift.Status = driftMissing
+			case hash == hex.EncodeToString(sum[:]):
+			case mount.SubPath:
+				drift.Status, drift.Detail = driftStale, "subPath mounts never update; restart the container"
+			default:
+				drift.Status = driftPending
+				drift.Detail = fmt.Sprintf("%s updated %s ago", source.Kind, since(source.UpdatedAt).Round(time.Second))
+				if at, ok := refreshed[mount.MountPath]; ok {
+					drift.Detail += fmt.Sprintf(", volume refreshed at %s", at.Format(time.RFC3339))
+				}
+			}
+			drifts = append(drifts, drift)
+		}
+
+		if mount.SubPath {
+			continue
+		}
+		for _, entry := range entries[mount.MountPath] {
+			file := path.Join(mount.MountPath, entry)
+			if _, known := mount.Files[file]; known || isMountedDir(file, mount.Files) {
+				continue
+			}
+			drifts = append(drifts, configDrift{Path: file, Status: driftExtra, Detail: "key is not in the " + source.Kind})
+		}
+	}
+
+	sort.Slice(drifts, func(i, j int) bool { return drifts[i].Path < drifts[j].Path })
+	return drifts
+}
+
+// isMountedDir reports whether dir contains one of the mounted files, for
+// items projected into subdirectories
+func isMountedDir(dir string, files map[string]string) bool {
+	for file := range files {
+		if strings.HasPrefix(file, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func runConfigDiff(cmd *cobra.Command) error {
+	config, err := newTargetConfig(cmd.Context(), cmd, "", "general")
+	if err != nil {
+		return err
+	}
+	kind, name := "configmap", configDiffConfigMap
+	if configDiffSecret != "" {
+		kind, name = "secret", configDiffSecret
+	}
+
+	source, err := config.getConfigSource(kind, name)
+	if err != nil {
+		return err
+	}
+	pod, err := config.getPod(config.PodName, config.Namespace)
+	if err != nil {
+		return WrapKubectlError(err, "get pod")
+	}
+	container, err := config.getTargetContainerName()
+	if err != nil {
+		return WrapKubectlError(err, "get target container name")
+	}
+	mounts := configMounts(pod.Spec, container, source)
+	if len(mounts) == 0 {
+		return NewValidationError(kind, name, fmt.Sprintf("is not mounted in container %s of pod %s", container, config.PodName))
+	}
+
+	log.Printf("Comparing %s %s with the files mounted in %s/%s...", kind, name, config.PodName, container)
+	result, err := config.runEphemeralScript(config.PodName, configDiffScript(mounts))
+	if err != nil {
+		return err
+	}
+
+	drifts := compareConfig(result.Output, mounts, source)
+	drifted := 0
+	fmt.Printf("%-50s %-30s %-8s %s\n", "PATH", "KEY", "STATUS", "DETAIL")
+	for _, drift := range drifts {
+		if drift.Status != driftInSync {
+			drifted++
+		}
+		fmt.Printf("%-50s %-30s %-8s %s\n", drift.Path, drift.Key, drift.Status, drift.Detail)
+	}
+	fmt.Printf("\n%d of %d files drifted from %s %s, last updated at %s\n", drifted, len(drifts), kind, name,
+		source.UpdatedAt.Format(time.RFC3339))
+	if drifted > 0 {
+		return &ExitCodeError{Code: 1}
+	}
+	return nil
+}
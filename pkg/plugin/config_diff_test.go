@@ -0,0 +1,62 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestCompareConfig(t *testing.T) {
+	source := &configSource{Kind: "configmap", Name: "app-config", Data: map[string][]byte{
+		"app.yaml": []byte("replicas: 3\n"),
+		"log.yaml": []byte("level: debug\n"),
+	}}
+	spec := corev1.PodSpec{
+		Containers: []corev1.Container{{Name: "app", VolumeMounts: []corev1.VolumeMount{
+			{Name: "config", MountPath: "/etc/app"},
+			{Name: "config", MountPath: "/etc/log.yaml", SubPath: "log.yaml"},
+		}}},
+		Volumes: []corev1.Volume{{Name: "config", VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "app-config"}},
+		}}},
+	}
+	mounts := configMounts(spec, "app", source)
+	if len(mounts) != 2 || len(mounts[0].Files) != 2 || mounts[1].Files["/etc/log.yaml"] != "log.yaml" {
+		t.Fatalf("configMounts() = %+v", mounts)
+	}
+
+	hash := func(value string) string {
+		sum := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(sum[:])
+	}
+	output := strings.Join([]string{
+		"FILE|/etc/app/app.yaml|" + hash("replicas: 3\n"),
+		"FILE|/etc/app/log.yaml|" + hash("level: info\n"),
+		"FILE|/etc/log.yaml|" + hash("level: info\n"),
+		"ENTRY|/etc/app|app.yaml",
+		"ENTRY|/etc/app|log.yaml",
+		"ENTRY|/etc/app|old.yaml",
+		"DATA|/etc/app|..2023_11_14_22_13_20.1234567",
+	}, "\n")
+	got := map[string]string{}
+	for _, drift := range compareConfig(output, mounts, source) {
+		got[drift.Path] = drift.Status
+	}
+	want := map[string]string{
+		"/etc/app/app.yaml": driftInSync,
+		"/etc/app/log.yaml": driftPending,
+		"/etc/app/old.yaml": driftExtra,
+		"/etc/log.yaml":     driftStale,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("compareConfig() = %v, want %v", got, want)
+	}
+
+	if at, ok := kubeletRefresh("..2023_11_14_22_13_20.1234567"); !ok || at.Unix() != 1700000000 {
+		t.Errorf("kubeletRefresh() = %v, %v", at, ok)
+	}
+}
@@ -0,0 +1,282 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	dbType string
+	dbYes  bool
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Open a database client connected like the target container",
+	Long: `Add an ephemeral container with a database client to the target pod and
+start the client with the connection settings of the target container. The
+ephemeral container gets the environment of the target container, including
+its Secret and ConfigMap references, and shares its network namespace, so the
+client reaches the same endpoint as the application, sidecar proxies on
+localhost included.
+
+Secret values stay in the cluster: the environment is copied as references,
+but the client can read them, so kpdbug lists what it copies and asks for
+confirmation first. Use --yes to skip the prompt.
+
+Connection settings are read from the usual variables of each client:
+  postgres  DATABASE_URL, POSTGRES_URL, PGHOST, POSTGRES_HOST, DB_HOST, ...
+  mysql     MYSQL_HOST, DB_HOST, MYSQL_USER, MYSQL_PASSWORD, ...
+  redis     REDIS_URL, REDIS_HOST, REDIS_PORT, REDIS_PASSWORD
+  mongo     MONGODB_URI, MONGO_URL, MONGO_HOST, MONGO_USER, ...`,
+	Example: `  kpdbug db -p mypod --type postgres
+  kpdbug db -p mypod --container app --type redis
+  kpdbug db -p mypod --type mysql --image mysql:8.0 --yes`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runDB(cmd)
+	},
+}
+
+func init() {
+	dbCmd.Flags().StringVar(&dbType, "type", "", "database type: "+strings.Join(clientTypes(dbClients), ", ")+" (required)")
+	dbCmd.Flags().BoolVar(&dbYes, "yes", false, "copy the environment of the target container without asking")
+	_ = dbCmd.MarkFlagRequired("type")
+	rootCmd.AddCommand(dbCmd)
+}
+
+// clientTool is the image and start script of a client connecting with the
+// environment of the target container
+type clientTool struct {
+	Image  string
+	Script string
+}
+
+// dbClients maps database types to their clients. The scripts look up
+// connection settings in order of preference; ports are cut after the last
+// colon since Service links set REDIS_PORT and friends to tcp://<ip>:<port>.
+var dbClients = map[string]clientTool{
+	"postgres": {
+		Image: "postgres:16-alpine",
+		Script: `url="${DATABASE_URL:-${POSTGRES_URL:-${POSTGRESQL_URL:-}}}"
+if [ -n "$url" ]; then exec psql "$url"; fi
+export PGHOST="${PGHOST:-${POSTGRES_HOST:-${DB_HOST:-127.0.0.1}}}"
+port="${PGPORT:-${POSTGRES_PORT:-${DB_PORT:-5432}}}"; export PGPORT="${port##*:}"
+export PGUSER="${PGUSER:-${POSTGRES_USER:-${DB_USER:-${DB_USERNAME:-postgres}}}}"
+password="${PGPASSWORD:-${POSTGRES_PASSWORD:-${DB_PASSWORD:-}}}"
+if [ -n "$password" ]; then export PGPASSWORD="$password"; fi
+database="${PGDATABASE:-${POSTGRES_DB:-${DB_NAME:-${DB_DATABASE:-}}}}"
+if [ -n "$database" ]; then export PGDATABASE="$database"; fi
+exec psql`,
+	},
+	"mysql": {
+		Image: "mysql:8.4",
+		Script: `host="${MYSQL_HOST:-${DB_HOST:-127.0.0.1}}"
+port="${MYSQL_PORT:-${DB_PORT:-3306}}"
+user="${MYSQL_USER:-${DB_USER:-${DB_USERNAME:-root}}}"
+password="${MYSQL_PASSWORD:-${MYSQL_ROOT_PASSWORD:-${DB_PASSWORD:-}}}"
+if [ -n "$password" ]; then export MYSQL_PWD="$password"; fi
+database="${MYSQL_DATABASE:-${DB_NAME:-${DB_DATABASE:-}}}"
+exec mysql -h "$host" -P "${port##*:}" -u "$user" ${database:+"$database"}`,
+	},
+	"redis": {
+		Image: "redis:7-alpine",
+		Script: `if [ -n "${REDIS_URL:-}" ]; then exec redis-cli -u "$REDIS_URL"; fi
+password="${REDIS_PASSWORD:-${REDISCLI_AUTH:-}}"
+if [ -n "$password" ]; then export REDISCLI_AUTH="$password"; fi
+port="${REDIS_PORT:-6379}"
+exec redis-cli -h "${REDIS_HOST:-${REDIS_SERVICE_HOST:-127.0.0.1}}" -p "${port##*:}"`,
+	},
+	"mongo": {
+		Image: "mongo:7",
+		Script: `url="${MONGODB_URI:-${MONGO_URI:-${MONGODB_URL:-${MONGO_URL:-}}}}"
+if [ -n "$url" ]; then exec mongosh "$url"; fi
+port="${MONGO_PORT:-${MONGODB_PORT:-27017}}"
+set -- --host "${MONGO_HOST:-${MONGODB_HOST:-127.0.0.1}}" --port "${port##*:}"
+user="${MONGO_USER:-${MONGODB_USERNAME:-${MONGO_INITDB_ROOT_USERNAME:-}}}"
+if [ -n "$user" ]; then
+  set -- "$@" -u "$user" -p "${MONGO_PASSWORD:-${MONGODB_PASSWORD:-${MONGO_INITDB_ROOT_PASSWORD:-}}}" --authenticationDatabase admin
+fi
+exec mongosh "$@"`,
+	},
+}
+
+// clientTypes returns the types of clients, sorted
+func clientTypes(clients map[string]clientTool) []string {
+	types := make([]string, 0, len(clients))
+	for name := range clients {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	return types
+}
+
+var scriptVariable = regexp.MustCompile(`\$\{([A-Z][A-Z0-9_]*)`)
+
+// connectionVariables returns the environment variables a client script
+// reads, in lookup order
+func connectionVariables(script string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, match := range scriptVariable.FindAllStringSubmatch(script, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// clientEnv returns the environment of container that can be copied to an
+// ephemeral container; ephemeral containers have no resources, so
+// resourceFieldRef variables are dropped
+func clientEnv(container *corev1.Container) []corev1.EnvVar {
+	var env []corev1.EnvVar
+	for _, v := range container.Env {
+		if v.ValueFrom != nil && v.ValueFrom.ResourceFieldRef != nil {
+			continue
+		}
+		env = append(env, v)
+	}
+	return env
+}
+
+// envSource describes where an environment variable comes from
+func envSource(v corev1.EnvVar) string {
+	switch {
+	case v.ValueFrom == nil:
+		return "value"
+	case v.ValueFrom.SecretKeyRef != nil:
+		return fmt.Sprintf("secret %s key %s", v.ValueFrom.SecretKeyRef.Name, v.ValueFrom.SecretKeyRef.Key)
+	case v.ValueFrom.ConfigMapKeyRef != nil:
+		return fmt.Sprintf("configmap %s key %s", v.ValueFrom.ConfigMapKeyRef.Name, v.ValueFrom.ConfigMapKeyRef.Key)
+	case v.ValueFrom.FieldRef != nil:
+		return "field " + v.ValueFrom.FieldRef.FieldPath
+	}
+	return "reference"
+}
+
+// describeClientEnv lists the copied environment for the confirmation prompt:
+// the connection variables the client reads and every referenced source
+func describeClientEnv(env []corev1.EnvVar, envFrom []corev1.EnvFromSource, script string) []string {
+	byName := map[string]corev1.EnvVar{}
+	for _, v := range env {
+		byName[v.Name] = v
+	}
+
+	var lines []string
+	for _, name := range connectionVariables(script) {
+		if v, ok := byName[name]; ok {
+			lines = append(lines, fmt.Sprintf("%s (%s)", name, envSource(v)))
+		}
+	}
+	for _, v := range env {
+		if v.ValueFrom != nil && v.ValueFrom.SecretKeyRef != nil {
+			lines = append(lines, fmt.Sprintf("%s (%s)", v.Name, envSource(v)))
+		}
+	}
+	for _, source := range envFrom {
+		switch {
+		case source.SecretRef != nil:
+			lines = append(lines, fmt.Sprintf("all keys of secret %s", source.SecretRef.Name))
+		case source.ConfigMapRef != nil:
+			lines = append(lines, fmt.Sprintf("all keys of configmap %s", source.ConfigMapRef.Name))
+		}
+	}
+
+	seen := map[string]bool{}
+	unique := lines[:0]
+	for _, line := range lines {
+		if !seen[line] {
+			seen[line] = true
+			unique = append(unique, line)
+		}
+	}
+	return unique
+}
+
+// findContainer returns the container of pod named name
+func findContainer(pod *corev1.Pod, name string) *corev1.Container {
+	for i := range pod.Spec.Containers {
+		if pod.Spec.Containers[i].Name == name {
+			return &pod.Spec.Containers[i]
+		}
+	}
+	return nil
+}
+
+func runDB(cmd *cobra.Command) error {
+	client, ok := dbClients[dbType]
+	if !ok {
+		return NewValidationError("type", dbType, "must be one of: "+strings.Join(clientTypes(dbClients), ", "))
+	}
+	return runClientTool(cmd, dbType, client, dbYes)
+}
+
+// runClientTool starts client in an ephemeral container of the target pod
+// with the environment of the target container, after confirmation unless
+// yes is set
+func runClientTool(cmd *cobra.Command, kind string, client clientTool, yes bool) error {
+	config, err := newTargetConfig(cmd.Context(), cmd, client.Image, "general")
+	if err != nil {
+		return err
+	}
+	if err := config.admitEphemeral(); err != nil {
+		return err
+	}
+
+	containerName, err := config.getTargetContainerName()
+	if err != nil {
+		return WrapKubectlError(err, "get target container name")
+	}
+	pod, err := config.getPod(config.PodName, config.Namespace)
+	if err != nil {
+		return WrapKubectlError(err, "get target pod")
+	}
+	container := findContainer(pod, containerName)
+	if container == nil {
+		return NewValidationError("container", containerName, fmt.Sprintf("not found in pod %s", config.PodName))
+	}
+
+	env := clientEnv(container)
+	copied := describeClientEnv(env, container.EnvFrom, client.Script)
+	if len(copied) == 0 {
+		log.Printf("Warning: container %s sets none of the %s connection variables; the client starts with its defaults", containerName, kind)
+	} else if !yes {
+		fmt.Printf("The %s client gets the environment of container %s, including:\n", kind, containerName)
+		for _, line := range copied {
+			fmt.Printf("  %s\n", line)
+		}
+		if !askForConfirmation("Do you want to continue? (y/N): ") {
+			fmt.Println("Aborted")
+			return nil
+		}
+	}
+
+	spec, err := config.mergedEphemeralSpec()
+	if err != nil {
+		return err
+	}
+	spec["env"] = append(env, presetEnv()...)
+	if len(container.EnvFrom) > 0 {
+		spec["envFrom"] = container.EnvFrom
+	}
+	customFile, err := writeSpecFile(spec)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(customFile)
+	}()
+
+	args := append(config.ephemeralArgs(containerName, customFile), "-it", "--", "sh", "-c", client.Script)
+	log.Printf("Starting %s client in pod %s (environment of container %s)...", kind, config.PodName, containerName)
+	return wrapSessionError(config.runPodSession(config.PodName, args...), "start "+kind+" client")
+}
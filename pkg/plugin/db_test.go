@@ -0,0 +1,57 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestConnectionVariables(t *testing.T) {
+	vars := connectionVariables(dbClients["redis"].Script)
+	want := []string{"REDIS_URL", "REDIS_PASSWORD", "REDISCLI_AUTH", "REDIS_PORT", "REDIS_HOST", "REDIS_SERVICE_HOST"}
+	if strings.Join(vars, ",") != strings.Join(want, ",") {
+		t.Errorf("connectionVariables() = %v, want %v", vars, want)
+	}
+	for _, clients := range []map[string]clientTool{dbClients, mqClients} {
+		for _, name := range clientTypes(clients) {
+			if len(connectionVariables(clients[name].Script)) == 0 {
+				t.Errorf("client %s reads no connection variables", name)
+			}
+		}
+	}
+	if vars := connectionVariables(mqClients["kafka"].Script); vars[0] != "KAFKA_BOOTSTRAP_SERVERS" {
+		t.Errorf("kafka connection variables = %v, want KAFKA_BOOTSTRAP_SERVERS first", vars)
+	}
+}
+
+func TestDescribeClientEnv(t *testing.T) {
+	secretRef := func(name, key string) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key}}
+	}
+	container := &corev1.Container{
+		Env: []corev1.EnvVar{
+			{Name: "PGHOST", Value: "db.shop.svc"},
+			{Name: "PGPASSWORD", ValueFrom: secretRef("db-creds", "password")},
+			{Name: "API_TOKEN", ValueFrom: secretRef("api", "token")},
+			{Name: "MEMORY", ValueFrom: &corev1.EnvVarSource{ResourceFieldRef: &corev1.ResourceFieldSelector{Resource: "limits.memory"}}},
+		},
+		EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "extra"}}}},
+	}
+
+	env := clientEnv(container)
+	if len(env) != 3 {
+		t.Fatalf("clientEnv() kept %d variables, want 3 without resourceFieldRef", len(env))
+	}
+	got := describeClientEnv(env, container.EnvFrom, dbClients["postgres"].Script)
+	want := []string{
+		"PGHOST (value)",
+		"PGPASSWORD (secret db-creds key password)",
+		"API_TOKEN (secret api key token)",
+		"all keys of secret extra",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("describeClientEnv() = %q, want %q", got, want)
+	}
+}
@@ -3,27 +3,19 @@ package plugin
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
-	"math/rand"
-	"os"
-	"os/exec"
-	"os/signal"
+	"io"
 	"strings"
-	"syscall"
+	"sync"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/utils/ptr"
-	"sigs.k8s.io/yaml"
 )
 
-// Add at the top of the file, after imports
-var ExecCommand = exec.Command
-
 // Add near the top with other vars
 var (
 	sleepDuration = time.Second
@@ -42,23 +34,32 @@ func (e *ExecError) Error() string {
 func (config *DebugConfig) findExistingDebugPod() (string, error) {
 	labelSelector := "debug-tool/type=debug-pod"
 	if config.PodName != "" {
-		labelSelector += fmt.Sprintf(",debug-tool/target=%s", config.PodName)
+		labelSelector += fmt.Sprintf(",debug-tool/target=%s", targetLabelValue(config.PodName))
 	}
 
-	cmd := ExecCommand("kubectl", "get", "pod", "-n", config.Namespace, "-l", labelSelector,
-		"--no-headers",
-		"-o", "custom-columns=:metadata.name")
-
+	var output []byte
 	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	output, err := cmd.Output()
+	err := withRetry(config.context(), func() error {
+		cmd := config.kubectl("get", "pod", "-n", config.Namespace, "-l", labelSelector,
+			"--no-headers",
+			"-o", "custom-columns=:metadata.name")
+
+		stderr.Reset()
+		cmd.Stderr = &stderr
+		var err error
+		output, err = cmd.Output()
+		if err != nil {
+			return fmt.Errorf("%v - %s", err, stderr.String())
+		}
+		return nil
+	})
 
 	// If there's an error, check if it's because no pods were found
 	if err != nil {
 		if strings.Contains(stderr.String(), "No resources found") {
 			return "", nil
 		}
-		return "", fmt.Errorf("error checking for existing pods: %v - %s", err, stderr.String())
+		return "", fmt.Errorf("error checking for existing pods: %v", err)
 	}
 
 	// Get the first non-empty pod name
@@ -76,12 +77,13 @@ func (config *DebugConfig) askForNewPod(existingPod string) bool {
 		return true
 	}
 
-	fmt.Printf("Debug pod '%s' already exists in namespace '%s'. Do you want to:\n", existingPod, config.Namespace)
-	fmt.Printf("[1] Use existing pod\n")
-	fmt.Printf("[2] Create new pod\n")
-	fmt.Printf("Choose (1/2) [1]: ")
+	out := config.stdout()
+	fmt.Fprintf(out, "Debug pod '%s' already exists in namespace '%s'. Do you want to:\n", existingPod, config.Namespace)
+	fmt.Fprintf(out, "[1] Use existing pod\n")
+	fmt.Fprintf(out, "[2] Create new pod\n")
+	fmt.Fprintf(out, "Choose (1/2) [1]: ")
 
-	reader := bufio.NewReader(os.Stdin)
+	reader := bufio.NewReader(config.stdin())
 	response, err := reader.ReadString('\n')
 	if err != nil {
 		return false
@@ -92,58 +94,105 @@ func (config *DebugConfig) askForNewPod(existingPod string) bool {
 }
 
 func (config *DebugConfig) generateUniqueName() string {
-	timestamp := time.Now().Format("150405") // HHMMSS
-	randomStr := fmt.Sprintf("%04d", rand.Intn(10000))
+	return config.renderName(currentConfig().Naming, clock(), randomSuffix())
+}
+
+// suffixAlphabet matches the one Kubernetes uses for generated names, which
+// avoids vowels and look-alike characters
+const suffixAlphabet = "bcdfghjklmnpqrstvwxz2456789"
+
+// maxNameAttempts bounds the retries when a generated name is already taken
+const maxNameAttempts = 5
+
+// randomMu serializes reads of randomSource
+var randomMu sync.Mutex
 
-	// If no target pod, use simpler name format
-	if config.PodName == "" {
-		return fmt.Sprintf("debug-%s-%s", timestamp, randomStr)
+// randomSuffix returns the random part of generated names, drawn from
+// crypto/rand so concurrent invocations do not share a seed (or from the
+// seeded source of deterministic mode, which is not safe for concurrent use)
+func randomSuffix() string {
+	buf := make([]byte, 5)
+	randomMu.Lock()
+	_, err := io.ReadFull(randomSource, buf)
+	randomMu.Unlock()
+	if err != nil {
+		// crypto/rand does not fail on supported platforms; fall back to the clock
+		return fmt.Sprintf("%05d", clock().UnixNano()%100000)
+	}
+	for i, b := range buf {
+		buf[i] = suffixAlphabet[int(b)%len(suffixAlphabet)]
 	}
+	return string(buf)
+}
+
+// isAlreadyExists reports whether a kubectl error is an AlreadyExists conflict
+func isAlreadyExists(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "AlreadyExists") || strings.Contains(err.Error(), "already exists"))
+}
 
-	// If target pod specified, include it in the name
-	return fmt.Sprintf("debug-%s-%s-%s", config.PodName, timestamp, randomStr)
+// freePodName generates names until one is not used by an existing pod
+func (config *DebugConfig) freePodName() (string, error) {
+	for attempt := 1; ; attempt++ {
+		name := config.generateUniqueName()
+		if err := validatePodName(name); err != nil {
+			return "", err
+		}
+		if config.kubectl("get", "pod", name, "-n", config.Namespace, "-o", "name").Run() != nil || attempt == maxNameAttempts {
+			return name, nil
+		}
+		config.logf("Debug pod name %s is taken, generating another one", name)
+	}
 }
 
 func (config *DebugConfig) attachToPod(debugPodName string) error {
-	args := []string{"exec", "-it", debugPodName, "-n", config.Namespace, "--", "sh"}
-	cmd := ExecCommand("kubectl", args...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return config.runPodSession(debugPodName, "exec", "-it", debugPodName, "-n", config.Namespace, "--", "sh")
 }
 
 func (config *DebugConfig) deletePod(debugPodName string) error {
-	cmd := ExecCommand("kubectl", "delete", "pod", debugPodName, "-n", config.Namespace)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	// The pod may be gone already, e.g. when the copy was never created
+	cmd := config.kubectlWithContext(config.cleanupContext(), "delete", "pod", debugPodName, "-n", config.Namespace, "--ignore-not-found")
+	cmd.Stdout = config.stdout()
+	cmd.Stderr = config.stderr()
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	config.emitPodEvent(EventDeleted, debugPodName, "")
+	config.recordCleanup(debugPodName)
+	return nil
 }
 
 func (config *DebugConfig) getTargetPodLabels() (map[string]string, error) {
-	cmd := ExecCommand("kubectl", "get", "pod", config.PodName, "-n", config.Namespace, "-o", "jsonpath={.metadata.labels}")
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	output, err := cmd.Output()
+	var output []byte
+	err := withRetry(config.context(), func() error {
+		cmd := config.kubectl("get", "pod", config.PodName, "-n", config.Namespace, "-o", "jsonpath={.metadata.labels}")
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		var err error
+		output, err = cmd.Output()
+		if err != nil {
+			return fmt.Errorf("%v - %s", err, stderr.String())
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error getting target pod labels: %v - %s", err, stderr.String())
+		return nil, fmt.Errorf("error getting target pod labels: %v", err)
 	}
 
 	// If no output, return a map with basic labels
 	if len(output) == 0 {
 		return map[string]string{
 			"debug-tool/type":   "debug-pod",
-			"debug-tool/target": config.PodName,
+			"debug-tool/target": targetLabelValue(config.PodName),
 		}, nil
 	}
 
 	// Parse JSON output to a map
 	labels := make(map[string]string)
 	if err := json.Unmarshal(output, &labels); err != nil {
-		log.Printf("Warning: Error parsing labels JSON: %v, using basic labels", err)
+		config.logf("Warning: Error parsing labels JSON: %v, using basic labels", err)
 		return map[string]string{
 			"debug-tool/type":   "debug-pod",
-			"debug-tool/target": config.PodName,
+			"debug-tool/target": targetLabelValue(config.PodName),
 		}, nil
 	}
 
@@ -152,22 +201,27 @@ func (config *DebugConfig) getTargetPodLabels() (map[string]string, error) {
 
 func (config *DebugConfig) waitForPod(debugPodName string) error {
 	for i := 0; i < maxAttempts; i++ {
-		cmd := ExecCommand("kubectl", "get", "pod", debugPodName, "-n", config.Namespace,
+		cmd := config.kubectl("get", "pod", debugPodName, "-n", config.Namespace,
 			"-o", "jsonpath={.status.phase}")
 		output, err := cmd.Output()
 		if err == nil && string(output) == "Running" {
 			return nil
 		}
-		time.Sleep(sleepDuration)
+		select {
+		case <-config.context().Done():
+			return config.context().Err()
+		case <-time.After(sleepDuration):
+		}
 	}
 	return fmt.Errorf("pod did not become ready within %d seconds", maxAttempts)
 }
 
 func (config *DebugConfig) getDeploymentSelectors() (map[string]string, error) {
 	// First get the deployment name by looking for the pod's owner reference
-	cmd := ExecCommand("kubectl", "get", "pod", config.PodName, "-n", config.Namespace,
-		"-o", "jsonpath={.metadata.ownerReferences[?(@.kind=='ReplicaSet')].name}")
-	output, err := cmd.Output()
+	output, err := outputWithRetry(config.context(), func() *runnerCommand {
+		return config.kubectl("get", "pod", config.PodName, "-n", config.Namespace,
+			"-o", "jsonpath={.metadata.ownerReferences[?(@.kind=='ReplicaSet')].name}")
+	})
 	if err != nil {
 		return nil, fmt.Errorf("error getting pod owner reference: %v", err)
 	}
@@ -177,9 +231,10 @@ func (config *DebugConfig) getDeploymentSelectors() (map[string]string, error) {
 	}
 
 	// Get deployment name from ReplicaSet
-	cmd = ExecCommand("kubectl", "get", "rs", replicaSetName, "-n", config.Namespace,
-		"-o", "jsonpath={.metadata.ownerReferences[?(@.kind=='Deployment')].name}")
-	output, err = cmd.Output()
+	output, err = outputWithRetry(config.context(), func() *runnerCommand {
+		return config.kubectl("get", "rs", replicaSetName, "-n", config.Namespace,
+			"-o", "jsonpath={.metadata.ownerReferences[?(@.kind=='Deployment')].name}")
+	})
 	if err != nil {
 		return nil, fmt.Errorf("error getting replicaset owner reference: %v", err)
 	}
@@ -189,9 +244,10 @@ func (config *DebugConfig) getDeploymentSelectors() (map[string]string, error) {
 	}
 
 	// Get deployment matchLabels
-	cmd = ExecCommand("kubectl", "get", "deployment", deploymentName, "-n", config.Namespace,
-		"-o", "jsonpath={.spec.selector.matchLabels}")
-	output, err = cmd.Output()
+	output, err = outputWithRetry(config.context(), func() *runnerCommand {
+		return config.kubectl("get", "deployment", deploymentName, "-n", config.Namespace,
+			"-o", "jsonpath={.spec.selector.matchLabels}")
+	})
 	if err != nil {
 		return nil, fmt.Errorf("error getting deployment selector: %v", err)
 	}
@@ -206,8 +262,18 @@ func (config *DebugConfig) getDeploymentSelectors() (map[string]string, error) {
 }
 
 func (config *DebugConfig) getTargetPodSecurityContext() (*corev1.PodSecurityContext, error) {
-	cmd := ExecCommand("kubectl", "get", "pod", config.PodName, "-n", config.Namespace, "-o", "json")
-	output, err := cmd.Output()
+	pod, err := config.getTargetPod()
+	if err != nil {
+		return nil, err
+	}
+	return pod.Spec.SecurityContext, nil
+}
+
+// getTargetPod fetches the target pod as a typed object
+func (config *DebugConfig) getTargetPod() (*corev1.Pod, error) {
+	output, err := outputWithRetry(config.context(), func() *runnerCommand {
+		return config.kubectl("get", "pod", config.PodName, "-n", config.Namespace, "-o", "json")
+	})
 	if err != nil {
 		return nil, fmt.Errorf("error getting pod info: %v", err)
 	}
@@ -216,8 +282,131 @@ func (config *DebugConfig) getTargetPodSecurityContext() (*corev1.PodSecurityCon
 	if err := json.Unmarshal(output, &pod); err != nil {
 		return nil, fmt.Errorf("error parsing pod JSON: %v", err)
 	}
+	return &pod, nil
+}
 
-	return pod.Spec.SecurityContext, nil
+// hasIdentitySettings reports whether the pod security context defines any
+// user, group or seccomp settings worth mirroring into the debug pod.
+func hasIdentitySettings(secContext *corev1.PodSecurityContext) bool {
+	if secContext == nil {
+		return false
+	}
+	return secContext.RunAsUser != nil ||
+		secContext.RunAsGroup != nil ||
+		secContext.FSGroup != nil ||
+		len(secContext.SupplementalGroups) > 0 ||
+		secContext.SeccompProfile != nil
+}
+
+// mergeTargetSecurityContext overlays the target pod's identity fields
+// (user, group, fsGroup, supplemental groups, seccomp) onto the profile defaults.
+func mergeTargetSecurityContext(base, target *corev1.PodSecurityContext) *corev1.PodSecurityContext {
+	merged := base.DeepCopy()
+	if merged == nil {
+		merged = &corev1.PodSecurityContext{}
+	}
+	if target == nil {
+		return merged
+	}
+
+	if target.RunAsUser != nil {
+		merged.RunAsUser = ptr.To(*target.RunAsUser)
+	}
+	if target.RunAsGroup != nil {
+		merged.RunAsGroup = ptr.To(*target.RunAsGroup)
+	}
+	if target.RunAsNonRoot != nil {
+		merged.RunAsNonRoot = ptr.To(*target.RunAsNonRoot)
+	}
+	if target.FSGroup != nil {
+		merged.FSGroup = ptr.To(*target.FSGroup)
+	}
+	if target.FSGroupChangePolicy != nil {
+		policy := *target.FSGroupChangePolicy
+		merged.FSGroupChangePolicy = &policy
+	}
+	if len(target.SupplementalGroups) > 0 {
+		merged.SupplementalGroups = append([]int64(nil), target.SupplementalGroups...)
+	}
+	if target.SeccompProfile != nil {
+		merged.SeccompProfile = target.SeccompProfile.DeepCopy()
+	}
+
+	return merged
+}
+
+// describeIdentity renders the UID/GID/fsGroup of a pod security context for logging
+func describeIdentity(secContext *corev1.PodSecurityContext) string {
+	var parts []string
+	if secContext.RunAsUser != nil {
+		parts = append(parts, fmt.Sprintf("UID: %d", *secContext.RunAsUser))
+	}
+	if secContext.RunAsGroup != nil {
+		parts = append(parts, fmt.Sprintf("GID: %d", *secContext.RunAsGroup))
+	}
+	if secContext.FSGroup != nil {
+		parts = append(parts, fmt.Sprintf("fsGroup: %d", *secContext.FSGroup))
+	}
+	if len(secContext.SupplementalGroups) > 0 {
+		parts = append(parts, fmt.Sprintf("supplementalGroups: %v", secContext.SupplementalGroups))
+	}
+	if len(parts) == 0 {
+		return "seccomp only"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// parseSeccompProfile converts a --seccomp-profile value (RuntimeDefault,
+// Unconfined or localhost/<path>) into a SeccompProfile; empty returns nil
+func parseSeccompProfile(value string) (*corev1.SeccompProfile, error) {
+	switch {
+	case value == "":
+		return nil, nil
+	case strings.EqualFold(value, "RuntimeDefault") || value == "runtime/default":
+		return &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}, nil
+	case strings.EqualFold(value, "Unconfined"):
+		return &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeUnconfined}, nil
+	case strings.HasPrefix(value, "localhost/") && len(value) > len("localhost/"):
+		return &corev1.SeccompProfile{
+			Type:             corev1.SeccompProfileTypeLocalhost,
+			LocalhostProfile: ptr.To(strings.TrimPrefix(value, "localhost/")),
+		}, nil
+	default:
+		return nil, NewValidationError("seccomp profile", value, "must be RuntimeDefault, Unconfined or localhost/<path>")
+	}
+}
+
+// parseAppArmorProfile converts an --apparmor-profile value (runtime/default,
+// unconfined or localhost/<name>) into an AppArmorProfile; empty returns nil
+func parseAppArmorProfile(value string) (*corev1.AppArmorProfile, error) {
+	switch {
+	case value == "":
+		return nil, nil
+	case value == "runtime/default" || strings.EqualFold(value, "RuntimeDefault"):
+		return &corev1.AppArmorProfile{Type: corev1.AppArmorProfileTypeRuntimeDefault}, nil
+	case strings.EqualFold(value, "unconfined"):
+		return &corev1.AppArmorProfile{Type: corev1.AppArmorProfileTypeUnconfined}, nil
+	case strings.HasPrefix(value, "localhost/") && len(value) > len("localhost/"):
+		return &corev1.AppArmorProfile{
+			Type:             corev1.AppArmorProfileTypeLocalhost,
+			LocalhostProfile: ptr.To(strings.TrimPrefix(value, "localhost/")),
+		}, nil
+	default:
+		return nil, NewValidationError("AppArmor profile", value, "must be runtime/default, unconfined or localhost/<name>")
+	}
+}
+
+// appArmorAnnotationValue renders an AppArmor profile in the annotation
+// format understood by clusters that predate the securityContext field
+func appArmorAnnotationValue(profile *corev1.AppArmorProfile) string {
+	switch profile.Type {
+	case corev1.AppArmorProfileTypeLocalhost:
+		return "localhost/" + *profile.LocalhostProfile
+	case corev1.AppArmorProfileTypeUnconfined:
+		return "unconfined"
+	default:
+		return "runtime/default"
+	}
 }
 
 func getSecurityContextForProfile(profileName string) (*corev1.SecurityContext, *corev1.PodSecurityContext) {
@@ -256,6 +445,28 @@ func getSecurityContextForProfile(profileName string) (*corev1.SecurityContext,
 
 		podContext.SeccompProfile.Type = corev1.SeccompProfileTypeRuntimeDefault
 
+	case "netadmin":
+		// Matches kubectl debug: network administration without full privileges
+		containerContext.Capabilities = &corev1.Capabilities{
+			Add: []corev1.Capability{"NET_ADMIN", "NET_RAW"},
+		}
+
+	case "sysadmin":
+		// Matches kubectl debug: a privileged container, host namespaces stay isolated
+		containerContext.Privileged = ptr.To(true)
+
+	case ebpfProfile:
+		// Just enough for bpftrace and bcc; default seccomp profiles of most
+		// runtimes block bpf() and perf_event_open()
+		containerContext.AllowPrivilegeEscalation = ptr.To(false)
+		containerContext.Capabilities = &corev1.Capabilities{
+			Add:  append([]corev1.Capability(nil), ebpfCapabilities...),
+			Drop: []corev1.Capability{"ALL"},
+		}
+		containerContext.SeccompProfile.Type = corev1.SeccompProfileTypeUnconfined
+
+		podContext.SeccompProfile.Type = corev1.SeccompProfileTypeUnconfined
+
 	case "privileged":
 		containerContext.AllowPrivilegeEscalation = ptr.To(true)
 		containerContext.Privileged = ptr.To(true)
@@ -271,8 +482,39 @@ func getSecurityContextForProfile(profileName string) (*corev1.SecurityContext,
 }
 
 func (config *DebugConfig) createDebugPod() (string, error) {
+	debugPod, err := config.buildDebugPod()
+	if err != nil {
+		return "", err
+	}
+	debugPodName := debugPod.Name
+
+	// create, unlike apply, fails instead of modifying a pod someone else
+	// just created under the same name
+	config.logf("Creating debug pod from YAML...")
+	for attempt := 1; ; attempt++ {
+		err := config.createObject(debugPod)
+		if err == nil {
+			break
+		}
+		if !isAlreadyExists(err) || attempt == maxNameAttempts {
+			return "", fmt.Errorf("error creating debug pod: %v", err)
+		}
+		debugPod.Name = config.generateUniqueName()
+		config.logf("Debug pod name %s is taken, retrying as %s", debugPodName, debugPod.Name)
+		debugPodName = debugPod.Name
+	}
+
+	config.logf("Debug pod created successfully")
+	return debugPodName, nil
+}
+
+// buildDebugPod renders the standalone debug pod without creating it
+func (config *DebugConfig) buildDebugPod() (*corev1.Pod, error) {
 	debugPodName := config.generateUniqueName()
-	log.Printf("Generating debug pod name: %s", debugPodName)
+	config.logf("Generating debug pod name: %s", debugPodName)
+	if err := validatePodName(debugPodName); err != nil {
+		return nil, err
+	}
 
 	// Initialize basic labels
 	labels := map[string]string{
@@ -284,20 +526,33 @@ func (config *DebugConfig) createDebugPod() (string, error) {
 	podSpec := corev1.PodSpec{
 		AutomountServiceAccountToken:  &automountServiceAccountToken,
 		TerminationGracePeriodSeconds: ptr.To(int64(0)),
+		ActiveDeadlineSeconds:         config.activeDeadlineSeconds(),
+		Affinity:                      avoidNodesAffinity(config.AvoidNodes),
 	}
 
+	var ownerReferences []metav1.OwnerReference
+
 	// If targeting an existing pod
 	if config.PodName != "" {
 		// Try to get target pod's security context
 		secContext, err := config.getTargetPodSecurityContext()
 		if err != nil {
-			log.Printf("Warning: Could not get target pod security context: %v", err)
-		} else if secContext != nil && secContext.RunAsUser != nil {
-			// Only set security context if target pod has RunAsUser defined
-			podSpec.SecurityContext = secContext
-			log.Printf("Using security context from target pod (UID: %d)", *secContext.RunAsUser)
+			config.logf("Warning: Could not get target pod security context: %v", err)
+		} else if hasIdentitySettings(secContext) {
+			// Mirror the target's identity so volumes owned by its UID/GID/fsGroup stay readable
+			_, podContext := getSecurityContextForProfile(config.Profile)
+			podSpec.SecurityContext = mergeTargetSecurityContext(podContext, secContext)
+			config.logf("Using security context from target pod (%s)", describeIdentity(podSpec.SecurityContext))
 		} else {
-			log.Printf("No security context defined in target pod, using profile settings")
+			config.logf("No security context defined in target pod, using profile settings")
+		}
+
+		if config.GCWithTarget {
+			targetPod, err := config.getTargetPod()
+			if err != nil {
+				return nil, fmt.Errorf("error getting target pod for owner reference: %v", err)
+			}
+			ownerReferences = []metav1.OwnerReference{targetOwnerReference(targetPod)}
 		}
 
 		// Get target pod labels
@@ -305,7 +560,7 @@ func (config *DebugConfig) createDebugPod() (string, error) {
 		if err == nil {
 			labels = targetLabels
 		}
-		labels["debug-tool/target"] = config.PodName
+		labels["debug-tool/target"] = targetLabelValue(config.PodName)
 
 		// Remove deployment selectors if present
 		deploymentSelectors, err := config.getDeploymentSelectors()
@@ -324,21 +579,49 @@ func (config *DebugConfig) createDebugPod() (string, error) {
 	if podSpec.SecurityContext == nil {
 		_, podContext := getSecurityContextForProfile(config.Profile)
 		podSpec.SecurityContext = podContext
-		log.Printf("Using security context from profile: %s", config.Profile)
+		config.logf("Using security context from profile: %s", config.Profile)
 	}
 
 	// Ensure debug tool labels are present
 	labels["debug-tool/type"] = "debug-pod"
 
+	// Explicit seccomp profile applies to the whole pod
+	seccomp, err := parseSeccompProfile(config.SeccompProfile)
+	if err != nil {
+		return nil, err
+	}
+	if seccomp != nil {
+		podSpec.SecurityContext = podSpec.SecurityContext.DeepCopy()
+		podSpec.SecurityContext.SeccompProfile = seccomp
+	}
+
+	// AppArmor is set through the pod annotation so older clusters honor it too
+	annotations := map[string]string{}
+	appArmor, err := parseAppArmorProfile(config.AppArmorProfile)
+	if err != nil {
+		return nil, err
+	}
+	if appArmor != nil {
+		annotations["container.apparmor.security.beta.kubernetes.io/debugger"] = appArmorAnnotationValue(appArmor)
+	}
+	if user := config.currentUser(); user != "" {
+		annotations[createdByAnnotation] = user
+	}
+	if config.RemoveAfter {
+		annotations[removeAfterAnnotation] = removalOwner()
+	}
+
 	debugPod := &corev1.Pod{
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: "v1",
 			Kind:       "Pod",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      debugPodName,
-			Namespace: config.Namespace,
-			Labels:    labels,
+			Name:            debugPodName,
+			Namespace:       config.Namespace,
+			Labels:          labels,
+			Annotations:     annotations,
+			OwnerReferences: ownerReferences,
 		},
 		Spec: podSpec,
 	}
@@ -350,95 +633,78 @@ func (config *DebugConfig) createDebugPod() (string, error) {
 		containerContext.RunAsUser = podSpec.SecurityContext.RunAsUser
 		containerContext.RunAsNonRoot = podSpec.SecurityContext.RunAsNonRoot
 	}
+	if podSpec.SecurityContext != nil && podSpec.SecurityContext.RunAsGroup != nil {
+		containerContext.RunAsGroup = podSpec.SecurityContext.RunAsGroup
+	}
+	if seccomp != nil {
+		containerContext.SeccompProfile = seccomp.DeepCopy()
+	}
+	applyCapabilityOverrides(containerContext, config.CapAdd, config.CapDrop)
 
 	// Add the debug container
 	var command []string
-	if config.Interactive && config.TTY {
+	if config.Interactive && config.TTY && config.Command == "" {
 		command = []string{"bash"}
 	} else {
 		command = []string{"sleep", "infinity"}
 	}
 
+	resources, err := config.debugResources()
+	if err != nil {
+		return nil, err
+	}
 	debugPod.Spec.Containers = []corev1.Container{
 		{
 			Name:            "debugger",
-			Image:           config.Image,
+			Image:           config.debugImage(),
 			Command:         command,
 			Stdin:           true,
 			TTY:             true,
 			SecurityContext: containerContext,
-			Resources: corev1.ResourceRequirements{
-				Limits: corev1.ResourceList{
-					corev1.ResourceMemory: resource.MustParse(config.MemoryLimit),
-				},
-				Requests: corev1.ResourceList{
-					corev1.ResourceCPU:    resource.MustParse(config.CPURequest),
-					corev1.ResourceMemory: resource.MustParse(config.MemoryRequest),
-				},
-			},
-			LivenessProbe: &corev1.Probe{
-				ProbeHandler: corev1.ProbeHandler{
-					Exec: &corev1.ExecAction{
-						Command: []string{"/bin/true"},
-					},
-				},
-				InitialDelaySeconds: 5,
-				PeriodSeconds:       10,
-			},
-			ReadinessProbe: &corev1.Probe{
-				ProbeHandler: corev1.ProbeHandler{
-					Exec: &corev1.ExecAction{
-						Command: []string{"/bin/true"},
-					},
-				},
-				InitialDelaySeconds: 5,
-				PeriodSeconds:       10,
-			},
+			Env:             presetEnv(),
+			Resources:       resources.requirements(),
 		},
 	}
-
-	podYAML, err := yaml.Marshal(debugPod)
-	if err != nil {
-		return "", fmt.Errorf("error generating YAML: %v", err)
+	if config.Probes {
+		probe := &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{
+				Exec: &corev1.ExecAction{
+					Command: []string{"/bin/true"},
+				},
+			},
+			InitialDelaySeconds: 5,
+			PeriodSeconds:       10,
+		}
+		debugPod.Spec.Containers[0].LivenessProbe = probe
+		debugPod.Spec.Containers[0].ReadinessProbe = probe.DeepCopy()
 	}
-
-	log.Printf("Applying debug pod YAML...")
-	applyCmd := ExecCommand("kubectl", "apply", "-f", "-")
-	applyCmd.Stdin = bytes.NewReader(podYAML)
-	var stderr bytes.Buffer
-	applyCmd.Stderr = &stderr
-	if err := applyCmd.Run(); err != nil {
-		return "", fmt.Errorf("error creating debug pod: %v - %s", err, stderr.String())
+	if config.Profile == ebpfProfile {
+		addEBPFHostMounts(&debugPod.Spec, &debugPod.Spec.Containers[0])
 	}
-
-	log.Printf("Debug pod created successfully")
-	return debugPodName, nil
+	return debugPod, nil
 }
 
 func (config *DebugConfig) getTargetContainerName() (string, error) {
-	cmd := ExecCommand("kubectl", "get", "pod", config.PodName, "-n", config.Namespace,
-		"-o", "jsonpath={.spec.containers[0].name}")
-	output, err := cmd.Output()
+	if config.Container != "" {
+		return config.Container, nil
+	}
+
+	output, err := outputWithRetry(config.context(), func() *runnerCommand {
+		return config.kubectl("get", "pod", config.PodName, "-n", config.Namespace,
+			"-o", "jsonpath={.spec.containers[0].name}")
+	})
 	if err != nil {
 		return "", fmt.Errorf("error getting container name: %v", err)
 	}
 	return strings.TrimSpace(string(output)), nil
 }
 
-func (config *DebugConfig) setupSignalHandler(debugPodName string) {
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-sigChan
-		log.Printf("\nReceived interrupt signal, cleaning up...")
-		if err := config.deletePod(debugPodName); err != nil {
-			log.Printf("Warning: Failed to delete pod %s: %v", debugPodName, err)
-		}
-		os.Exit(1)
-	}()
-}
-
-func runDebug() error {
+func runDebug(ctx context.Context) error {
 	config := NewDebugConfigFromFlags()
-	return config.Execute()
+	config.Context = ctx
+	if err := config.resolveTarget(); err != nil {
+		return err
+	}
+	_, err := config.Execute()
+	return err
 }
@@ -1,33 +1,28 @@
 package plugin
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
-)
 
-// MockCommand stores the last command execution for validation
-type MockCommand struct {
-	Command string
-	Args    []string
-}
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
 
-var lastCommand MockCommand
 var mockShouldFail bool
 
-// Mock exec.Command
-func mockExecCommand(command string, args ...string) *exec.Cmd {
-	// Store the command for validation
-	lastCommand = MockCommand{
-		Command: command,
-		Args:    args,
-	}
+// mockRunner runs every command in TestHelperProcess
+type mockRunner struct{}
 
+func (mockRunner) command(ctx context.Context, command string, args ...string) *exec.Cmd {
 	cs := []string{"-test.run=TestHelperProcess", "--", command}
 	cs = append(cs, args...)
-	cmd := exec.Command(os.Args[0], cs...)
+	cmd := exec.CommandContext(ctx, os.Args[0], cs...)
 	cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1"}
 	if mockShouldFail {
 		cmd.Env = append(cmd.Env, "GO_WANT_HELPER_PROCESS_FAIL=1")
@@ -35,7 +30,23 @@ func mockExecCommand(command string, args ...string) *exec.Cmd {
 	return cmd
 }
 
-// TestHelperProcess helps mock exec.Command
+func (r mockRunner) Run(ctx context.Context, name string, args ...string) error {
+	return r.command(ctx, name, args...).Run()
+}
+
+func (r mockRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return r.command(ctx, name, args...).Output()
+}
+
+func (r mockRunner) Stream(ctx context.Context, streams IOStreams, name string, args ...string) error {
+	cmd := r.command(ctx, name, args...)
+	cmd.Stdin = streams.In
+	cmd.Stdout = streams.Out
+	cmd.Stderr = streams.ErrOut
+	return cmd.Run()
+}
+
+// TestHelperProcess plays the commands of mockRunner
 func TestHelperProcess(t *testing.T) {
 	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
 		return
@@ -98,9 +109,9 @@ func TestHelperProcess(t *testing.T) {
 }
 
 func TestRunDebug(t *testing.T) {
-	origExecCommand := ExecCommand
-	defer func() { ExecCommand = origExecCommand }()
-	ExecCommand = mockExecCommand
+	origRunner := defaultRunner
+	defer func() { defaultRunner = origRunner }()
+	defaultRunner = mockRunner{}
 
 	tests := []struct {
 		name       string
@@ -158,7 +169,7 @@ func TestRunDebug(t *testing.T) {
 			copyPod = tt.copyPod
 			mockShouldFail = tt.shouldFail
 
-			err := runDebug()
+			err := runDebug(context.Background())
 			if (err != nil) != tt.wantErr {
 				t.Errorf("RunDebug() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -167,9 +178,9 @@ func TestRunDebug(t *testing.T) {
 }
 
 func TestGetTargetContainerName(t *testing.T) {
-	origExecCommand := ExecCommand
-	defer func() { ExecCommand = origExecCommand }()
-	ExecCommand = mockExecCommand
+	origRunner := defaultRunner
+	defer func() { defaultRunner = origRunner }()
+	defaultRunner = mockRunner{}
 
 	tests := []struct {
 		name        string
@@ -225,9 +236,9 @@ func TestGetTargetContainerName(t *testing.T) {
 }
 
 func TestDeletePod(t *testing.T) {
-	origExecCommand := ExecCommand
-	defer func() { ExecCommand = origExecCommand }()
-	ExecCommand = mockExecCommand
+	origRunner := defaultRunner
+	defer func() { defaultRunner = origRunner }()
+	defaultRunner = mockRunner{}
 
 	tests := []struct {
 		name       string
@@ -264,9 +275,9 @@ func TestDeletePod(t *testing.T) {
 }
 
 func TestAttachToPod(t *testing.T) {
-	origExecCommand := ExecCommand
-	defer func() { ExecCommand = origExecCommand }()
-	ExecCommand = mockExecCommand
+	origRunner := defaultRunner
+	defer func() { defaultRunner = origRunner }()
+	defaultRunner = mockRunner{}
 
 	tests := []struct {
 		name       string
@@ -303,9 +314,9 @@ func TestAttachToPod(t *testing.T) {
 }
 
 func TestFindExistingDebugPod(t *testing.T) {
-	origExecCommand := ExecCommand
-	defer func() { ExecCommand = origExecCommand }()
-	ExecCommand = mockExecCommand
+	origRunner := defaultRunner
+	defer func() { defaultRunner = origRunner }()
+	defaultRunner = mockRunner{}
 
 	tests := []struct {
 		name       string
@@ -354,6 +365,19 @@ func TestFindExistingDebugPod(t *testing.T) {
 	}
 }
 
+func TestAskForNewPod(t *testing.T) {
+	for input, want := range map[string]bool{"2\n": true, "1\n": false, "\n": false, "": false} {
+		var stdout strings.Builder
+		config := &DebugConfig{Namespace: "default", Stdin: strings.NewReader(input), Stdout: &stdout}
+		if got := config.askForNewPod("debug-abc"); got != want {
+			t.Errorf("askForNewPod() with input %q = %v, want %v", input, got, want)
+		}
+		if !strings.Contains(stdout.String(), "Debug pod 'debug-abc' already exists") {
+			t.Errorf("stdout = %q, want the question", stdout.String())
+		}
+	}
+}
+
 func TestGenerateUniqueName(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -384,3 +408,244 @@ func TestGenerateUniqueName(t *testing.T) {
 		})
 	}
 }
+
+func TestMergeTargetSecurityContext(t *testing.T) {
+	_, base := getSecurityContextForProfile("restricted")
+	target := &corev1.PodSecurityContext{
+		RunAsUser:          ptr.To(int64(2000)),
+		RunAsGroup:         ptr.To(int64(3000)),
+		FSGroup:            ptr.To(int64(4000)),
+		SupplementalGroups: []int64{5000, 6000},
+	}
+
+	got := mergeTargetSecurityContext(base, target)
+
+	if *got.RunAsUser != 2000 {
+		t.Errorf("RunAsUser = %d, want 2000", *got.RunAsUser)
+	}
+	if got.RunAsGroup == nil || *got.RunAsGroup != 3000 {
+		t.Errorf("RunAsGroup = %v, want 3000", got.RunAsGroup)
+	}
+	if got.FSGroup == nil || *got.FSGroup != 4000 {
+		t.Errorf("FSGroup = %v, want 4000", got.FSGroup)
+	}
+	if len(got.SupplementalGroups) != 2 {
+		t.Errorf("SupplementalGroups = %v, want [5000 6000]", got.SupplementalGroups)
+	}
+	if got.SeccompProfile == nil || got.SeccompProfile.Type != corev1.SeccompProfileTypeRuntimeDefault {
+		t.Errorf("SeccompProfile = %v, want profile default to be kept", got.SeccompProfile)
+	}
+	if *base.RunAsUser != 1000 {
+		t.Errorf("base context was modified: RunAsUser = %d", *base.RunAsUser)
+	}
+}
+
+func TestParseSeccompProfile(t *testing.T) {
+	tests := []struct {
+		value       string
+		wantType    corev1.SeccompProfileType
+		wantProfile string
+		wantErr     bool
+	}{
+		{value: "RuntimeDefault", wantType: corev1.SeccompProfileTypeRuntimeDefault},
+		{value: "Unconfined", wantType: corev1.SeccompProfileTypeUnconfined},
+		{value: "localhost/profiles/audit.json", wantType: corev1.SeccompProfileTypeLocalhost, wantProfile: "profiles/audit.json"},
+		{value: "localhost/", wantErr: true},
+		{value: "bogus", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseSeccompProfile(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSeccompProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Type != tt.wantType {
+				t.Errorf("parseSeccompProfile() type = %v, want %v", got.Type, tt.wantType)
+			}
+			if tt.wantProfile != "" && (got.LocalhostProfile == nil || *got.LocalhostProfile != tt.wantProfile) {
+				t.Errorf("parseSeccompProfile() localhost profile = %v, want %v", got.LocalhostProfile, tt.wantProfile)
+			}
+		})
+	}
+}
+
+func TestKubectlDebugProfiles(t *testing.T) {
+	tests := []struct {
+		profile    string
+		add        []corev1.Capability
+		privileged bool
+	}{
+		{"netadmin", []corev1.Capability{"NET_ADMIN", "NET_RAW"}, false},
+		{"sysadmin", nil, true},
+	}
+	for _, tt := range tests {
+		if err := validateProfile(tt.profile); err != nil {
+			t.Errorf("validateProfile(%s) = %v", tt.profile, err)
+		}
+		containerContext, podContext := getSecurityContextForProfile(tt.profile)
+		var add []corev1.Capability
+		if containerContext.Capabilities != nil {
+			add = containerContext.Capabilities.Add
+			if len(containerContext.Capabilities.Drop) != 0 {
+				t.Errorf("%s: drops %v, want nothing dropped like kubectl debug", tt.profile, containerContext.Capabilities.Drop)
+			}
+		}
+		if !reflect.DeepEqual(add, tt.add) {
+			t.Errorf("%s: adds %v, want %v", tt.profile, add, tt.add)
+		}
+		if got := containerContext.Privileged != nil && *containerContext.Privileged; got != tt.privileged {
+			t.Errorf("%s: privileged = %v, want %v", tt.profile, got, tt.privileged)
+		}
+		if containerContext.SeccompProfile.Type != corev1.SeccompProfileTypeRuntimeDefault || podContext.SeccompProfile.Type != corev1.SeccompProfileTypeRuntimeDefault {
+			t.Errorf("%s: seccomp = %s/%s, want RuntimeDefault", tt.profile, containerContext.SeccompProfile.Type, podContext.SeccompProfile.Type)
+		}
+		if podContext.RunAsNonRoot != nil || containerContext.RunAsUser != nil {
+			t.Errorf("%s: the debug container should run as the image user", tt.profile)
+		}
+		if got := kubectlDebugProfile(tt.profile); got != tt.profile {
+			t.Errorf("kubectlDebugProfile(%s) = %q", tt.profile, got)
+		}
+	}
+}
+
+func TestRandomSuffix(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		suffix := randomSuffix()
+		if len(suffix) != 5 || strings.Trim(suffix, suffixAlphabet) != "" {
+			t.Fatalf("randomSuffix() = %q, want 5 characters from %q", suffix, suffixAlphabet)
+		}
+		seen[suffix] = true
+	}
+	if len(seen) < 90 {
+		t.Errorf("randomSuffix() produced only %d distinct values out of 100", len(seen))
+	}
+}
+
+func TestIsAlreadyExists(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{fmt.Errorf(`Error from server (AlreadyExists): pods "debug-web-0" already exists`), true},
+		{fmt.Errorf(`Error from server (Forbidden): pods is forbidden`), false},
+	}
+	for _, tt := range tests {
+		if got := isAlreadyExists(tt.err); got != tt.want {
+			t.Errorf("isAlreadyExists(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestInvalidResourcesAreRefused(t *testing.T) {
+	builders := map[string]func(*DebugConfig) error{
+		"debug pod": func(config *DebugConfig) error { _, err := config.buildDebugPod(); return err },
+		"mesh DaemonSet": func(config *DebugConfig) error {
+			_, err := config.meshDaemonSet("debug-mesh-1", nil, false)
+			return err
+		},
+		"tool pod": func(config *DebugConfig) error {
+			_, err := config.toolPod("debug-scan-1", "default", "probe", nil, []string{"true"})
+			return err
+		},
+		"proxy pod":       func(config *DebugConfig) error { _, err := config.proxyPod("debug-proxy-1"); return err },
+		"Parca agent pod": func(config *DebugConfig) error { _, err := config.parcaAgentPod("debug-parca-1", fakeNode); return err },
+	}
+	flags := []struct {
+		name string
+		set  func(*DebugConfig)
+	}{
+		{"cpu-request", func(config *DebugConfig) { config.CPURequest = "lots" }},
+		{"memory-request", func(config *DebugConfig) { config.MemoryRequest = "128MB!" }},
+		{"memory-limit", func(config *DebugConfig) { config.MemoryLimit = "bogus" }},
+	}
+	for name, build := range builders {
+		for _, flag := range flags {
+			config := &DebugConfig{
+				Namespace:     "default",
+				Image:         "busybox",
+				CPURequest:    "100m",
+				MemoryRequest: "128Mi",
+				MemoryLimit:   "128Mi",
+				Runner:        fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}},
+			}
+			if err := build(config); err != nil {
+				t.Errorf("%s with valid resources: %v", name, err)
+			}
+			flag.set(config)
+			if err := build(config); err == nil || !strings.Contains(err.Error(), flag.name) {
+				t.Errorf("%s with an invalid --%s = %v, want a validation error", name, flag.name, err)
+			}
+		}
+	}
+}
+
+// fakeRunner answers commands from canned outputs keyed by the joined
+// arguments and records what was run
+type fakeRunner struct {
+	outputs map[string]string
+	// mu guards calls, as sessions run next to their background lookups
+	mu    sync.Mutex
+	calls []string
+}
+
+// record adds a call to the calls run
+func (f *fakeRunner) record(call string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+}
+
+func (f *fakeRunner) Run(ctx context.Context, name string, args ...string) error {
+	_, err := f.Output(ctx, name, args...)
+	return err
+}
+
+func (f *fakeRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	call := name + " " + strings.Join(args, " ")
+	f.record(call)
+	output, ok := f.outputs[call]
+	if !ok {
+		return nil, &ExitCodeError{Code: 1}
+	}
+	return []byte(output), nil
+}
+
+func (f *fakeRunner) Stream(ctx context.Context, streams IOStreams, name string, args ...string) error {
+	output, err := f.Output(ctx, name, args...)
+	if streams.Out != nil {
+		_, _ = streams.Out.Write(output)
+	}
+	return err
+}
+
+func TestCreateDebugPodProbes(t *testing.T) {
+	for _, probes := range []bool{false, true} {
+		config := &DebugConfig{
+			Namespace:     "default",
+			Image:         "gcr.io/distroless/base",
+			Probes:        probes,
+			CPURequest:    "100m",
+			MemoryLimit:   "128Mi",
+			MemoryRequest: "128Mi",
+			Runner:        fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}},
+		}
+		name, err := config.createDebugPod()
+		if err != nil {
+			t.Fatal(err)
+		}
+		pod, err := config.getPod(name, "default")
+		if err != nil {
+			t.Fatal(err)
+		}
+		debugger := pod.Spec.Containers[0]
+		if got := debugger.LivenessProbe != nil && debugger.ReadinessProbe != nil; got != probes {
+			t.Errorf("Probes %v: liveness %v, readiness %v", probes, debugger.LivenessProbe, debugger.ReadinessProbe)
+		}
+	}
+}
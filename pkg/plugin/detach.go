@@ -0,0 +1,75 @@
+package plugin
+
+import (
+	"errors"
+	"io"
+)
+
+// The detach sequence of native terminal sessions, like Docker's: Ctrl-P
+// followed by Ctrl-Q
+const (
+	detachPrefix = 0x10
+	detachKey    = 0x11
+)
+
+// errSessionDetached ends a session the user detached from; the remote
+// process and the debug pod are left running
+var errSessionDetached = errors.New("detached from the session")
+
+// detachReader forwards the terminal input of a session until the detach
+// sequence, which it swallows and reports to detach, after which it returns
+// io.EOF. A Ctrl-P is held back until the next byte shows whether it starts
+// the sequence.
+type detachReader struct {
+	r      io.Reader
+	detach func()
+	in     []byte
+	out    []byte
+	held   bool
+	err    error
+}
+
+func newDetachReader(r io.Reader, detach func()) *detachReader {
+	return &detachReader{r: r, detach: detach, in: make([]byte, 4096)}
+}
+
+func (d *detachReader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 && d.err == nil {
+		n, err := d.r.Read(d.in[:min(len(p), len(d.in))])
+		d.scan(d.in[:n])
+		if err != nil && d.err == nil {
+			if d.held {
+				d.out, d.held = append(d.out, detachPrefix), false
+			}
+			d.err = err
+		}
+	}
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	if len(d.out) == 0 && d.err != nil {
+		return n, d.err
+	}
+	return n, nil
+}
+
+// scan moves input to the output, stopping at the detach sequence
+func (d *detachReader) scan(input []byte) {
+	for _, b := range input {
+		switch {
+		case d.held && b == detachKey:
+			d.held, d.err = false, io.EOF
+			d.detach()
+			return
+		case d.held:
+			d.out = append(d.out, detachPrefix)
+			d.held = b == detachPrefix
+			if !d.held {
+				d.out = append(d.out, b)
+			}
+		case b == detachPrefix:
+			d.held = true
+		default:
+			d.out = append(d.out, b)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDetachReader(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		input    string
+		want     string
+		detached bool
+	}{
+		{name: "plain input", input: "ls -l\n", want: "ls -l\n"},
+		{name: "detach sequence", input: "ls\n\x10\x11exit\n", want: "ls\n", detached: true},
+		{name: "lone ctrl-p", input: "\x10a\x10", want: "\x10a\x10"},
+		{name: "ctrl-p before the sequence", input: "\x10\x10\x11", want: "\x10", detached: true},
+		{name: "ctrl-q alone", input: "\x11", want: "\x11"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			detached := false
+			// One byte per read splits the sequence across reads
+			r := newDetachReader(iotest.OneByteReader(strings.NewReader(tt.input)), func() { detached = true })
+			got, err := io.ReadAll(r)
+			if err != nil || string(got) != tt.want || detached != tt.detached {
+				t.Errorf("read %q, %v, detached %v, want %q, detached %v", got, err, detached, tt.want, tt.detached)
+			}
+		})
+	}
+}
+
+// detachingRunner detaches from every attach session
+type detachingRunner struct {
+	fakeClusterRunner
+}
+
+func (r detachingRunner) Stream(ctx context.Context, streams IOStreams, name string, args ...string) error {
+	if args[0] == "attach" {
+		return errSessionDetached
+	}
+	return r.fakeClusterRunner.Stream(ctx, streams, name, args...)
+}
+
+func TestDetachedSessionKeepsPod(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	config := &DebugConfig{
+		Namespace: "default", Operation: OperationStandalone, Image: "busybox", Profile: "general",
+		Interactive: true, TTY: true, RemoveAfter: true, CPURequest: "100m", MemoryLimit: "128Mi", MemoryRequest: "128Mi",
+		Runner: detachingRunner{fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}}},
+		Stdin:  strings.NewReader(""), Stdout: io.Discard, Stderr: io.Discard,
+	}
+	if _, err := config.Execute(); err != nil {
+		t.Fatalf("Execute() = %v, want a detached session to succeed", err)
+	}
+	pods, err := config.ListDebugPods(false)
+	if err != nil || len(pods) != 1 {
+		t.Fatalf("ListDebugPods() = %v, %v, want the detached pod kept despite --rm", pods, err)
+	}
+	if config.detachedPod != pods[0].Name {
+		t.Errorf("detachedPod = %q, want %q", config.detachedPod, pods[0].Name)
+	}
+	want := "reattach with: kubectl attach -it " + pods[0].Name + " -n default"
+	if !strings.Contains(logs.String(), want) {
+		t.Errorf("logged %q, want %q", logs.String(), want)
+	}
+}
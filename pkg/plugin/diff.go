@@ -0,0 +1,323 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+var diffOutput string
+
+var diffCmd = &cobra.Command{
+	Use:   "diff <debug-pod>",
+	Short: "Show what changed between a debug pod copy and its original",
+	Long: `Compare the spec of a debug pod copy against the pod it was copied from,
+so reviewers can see exactly which images, commands, probes and resources were changed.
+The original pod is taken from --pod, or from the debug pod's debug-tool/target label.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeDebugPodNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runDiff(cmd.Context(), args[0])
+	},
+}
+
+func init() {
+	diffCmd.Flags().StringVarP(&diffOutput, "output", "o", "unified", "diff format (unified, structured)")
+	rootCmd.AddCommand(diffCmd)
+}
+
+func runDiff(ctx context.Context, debugPodName string) error {
+	debugPod, err := getPod(ctx, debugPodName, currentNamespace(ctx))
+	if err != nil {
+		return WrapKubectlError(err, "get debug pod")
+	}
+
+	original := podName
+	if original == "" {
+		original = debugPod.Labels["debug-tool/target"]
+	}
+	if original == "" {
+		return NewValidationError("pod", debugPodName, "cannot determine the original pod").
+			WithSuggestion("Pass the original pod with -p <pod>")
+	}
+
+	originalPod, err := getPod(ctx, original, currentNamespace(ctx))
+	if err != nil {
+		return NewPodNotFoundError(original, currentNamespace(ctx)).WithOriginalError(err)
+	}
+
+	switch diffOutput {
+	case "unified":
+		diff, err := unifiedPodDiff(originalPod, debugPod)
+		if err != nil {
+			return err
+		}
+		if diff == "" {
+			fmt.Println("No differences found")
+			return nil
+		}
+		fmt.Print(diff)
+	case "structured":
+		changes := structuredPodDiff(originalPod, debugPod)
+		if len(changes) == 0 {
+			fmt.Println("No differences found")
+			return nil
+		}
+		for _, change := range changes {
+			fmt.Println(change)
+		}
+	default:
+		return NewValidationError("output", diffOutput, "must be one of: unified, structured")
+	}
+	return nil
+}
+
+// getPod fetches a pod as a typed object
+func getPod(ctx context.Context, name, ns string) (*corev1.Pod, error) {
+	return fetchPod(kubectlCommand(ctx, "get", "pod", name, "-n", ns, "-o", "json"), name)
+}
+
+// getPod fetches a pod through the config's runner
+func (config *DebugConfig) getPod(name, ns string) (*corev1.Pod, error) {
+	return fetchPod(config.kubectl("get", "pod", name, "-n", ns, "-o", "json"), name)
+}
+
+// fetchPod runs the kubectl get pod command and parses the pod
+func fetchPod(get *runnerCommand, name string) (*corev1.Pod, error) {
+	output, err := get.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error getting pod %s: %v", name, err)
+	}
+
+	var pod corev1.Pod
+	if err := json.Unmarshal(output, &pod); err != nil {
+		return nil, fmt.Errorf("error parsing pod JSON: %v", err)
+	}
+	return &pod, nil
+}
+
+// comparablePod strips server-populated and identity fields so only the
+// user-visible configuration is compared
+func comparablePod(pod *corev1.Pod) map[string]interface{} {
+	spec := pod.Spec.DeepCopy()
+	spec.NodeName = ""
+
+	return map[string]interface{}{
+		"labels":      pod.Labels,
+		"annotations": pod.Annotations,
+		"spec":        spec,
+	}
+}
+
+// unifiedPodDiff renders a line-based unified diff of the two pods as YAML
+func unifiedPodDiff(original, debugCopy *corev1.Pod) (string, error) {
+	a, err := yaml.Marshal(comparablePod(original))
+	if err != nil {
+		return "", fmt.Errorf("error generating YAML: %v", err)
+	}
+	b, err := yaml.Marshal(comparablePod(debugCopy))
+	if err != nil {
+		return "", fmt.Errorf("error generating YAML: %v", err)
+	}
+	return unifiedDiff(original.Name, debugCopy.Name, string(a), string(b), 3), nil
+}
+
+// unifiedDiff computes a unified diff between two texts with the given
+// number of context lines; it returns an empty string when they are equal
+func unifiedDiff(nameA, nameB, a, b string, contextLines int) string {
+	linesA := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	linesB := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+	ops := diffLines(linesA, linesB)
+
+	var sb strings.Builder
+	changed := false
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		changed = true
+
+		// Extend the hunk while changes are within 2*context lines of each other
+		start := max(i-contextLines, 0)
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*contextLines {
+				break
+			}
+			end = next
+		}
+		end = min(end+contextLines, len(ops))
+
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", nameA, nameB)
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n",
+			ops[start].lineA+1, countKinds(ops[start:end], ' ', '-'),
+			ops[start].lineB+1, countKinds(ops[start:end], ' ', '+'))
+		for _, op := range ops[start:end] {
+			fmt.Fprintf(&sb, "%c%s\n", op.kind, op.text)
+		}
+		i = end
+	}
+
+	if !changed {
+		return ""
+	}
+	return sb.String()
+}
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed, '+' added
+type diffOp struct {
+	kind  byte
+	text  string
+	lineA int
+	lineB int
+}
+
+// diffLines computes a minimal line edit script using longest common subsequence
+func diffLines(a, b []string) []diffOp {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i], i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i], i, j})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j], i, j})
+			j++
+		}
+	}
+	return ops
+}
+
+func countKinds(ops []diffOp, kinds ...byte) int {
+	count := 0
+	for _, op := range ops {
+		for _, kind := range kinds {
+			if op.kind == kind {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+// structuredPodDiff lists the changes that matter when reviewing a debug copy:
+// added or removed containers and changed images, commands, probes and resources
+func structuredPodDiff(original, debugCopy *corev1.Pod) []string {
+	var changes []string
+
+	originalContainers := make(map[string]corev1.Container)
+	for _, c := range original.Spec.Containers {
+		originalContainers[c.Name] = c
+	}
+	copyContainers := make(map[string]bool)
+
+	for _, c := range debugCopy.Spec.Containers {
+		copyContainers[c.Name] = true
+		orig, ok := originalContainers[c.Name]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("+ container %s added (image %s)", c.Name, c.Image))
+			continue
+		}
+
+		prefix := "~ container " + c.Name
+		if orig.Image != c.Image {
+			changes = append(changes, fmt.Sprintf("%s: image %s -> %s", prefix, orig.Image, c.Image))
+		}
+		if !reflect.DeepEqual(orig.Command, c.Command) {
+			changes = append(changes, fmt.Sprintf("%s: command %q -> %q", prefix, orig.Command, c.Command))
+		}
+		if !reflect.DeepEqual(orig.Args, c.Args) {
+			changes = append(changes, fmt.Sprintf("%s: args %q -> %q", prefix, orig.Args, c.Args))
+		}
+		if !reflect.DeepEqual(orig.LivenessProbe, c.LivenessProbe) {
+			changes = append(changes, fmt.Sprintf("%s: liveness probe %s -> %s", prefix, describeProbe(orig.LivenessProbe), describeProbe(c.LivenessProbe)))
+		}
+		if !reflect.DeepEqual(orig.ReadinessProbe, c.ReadinessProbe) {
+			changes = append(changes, fmt.Sprintf("%s: readiness probe %s -> %s", prefix, describeProbe(orig.ReadinessProbe), describeProbe(c.ReadinessProbe)))
+		}
+		if !reflect.DeepEqual(orig.StartupProbe, c.StartupProbe) {
+			changes = append(changes, fmt.Sprintf("%s: startup probe %s -> %s", prefix, describeProbe(orig.StartupProbe), describeProbe(c.StartupProbe)))
+		}
+		if !reflect.DeepEqual(orig.Resources, c.Resources) {
+			changes = append(changes, fmt.Sprintf("%s: resources changed", prefix))
+		}
+		if !reflect.DeepEqual(orig.Env, c.Env) {
+			changes = append(changes, fmt.Sprintf("%s: environment changed", prefix))
+		}
+		if !reflect.DeepEqual(orig.SecurityContext, c.SecurityContext) {
+			changes = append(changes, fmt.Sprintf("%s: security context changed", prefix))
+		}
+	}
+
+	for _, c := range original.Spec.Containers {
+		if !copyContainers[c.Name] {
+			changes = append(changes, fmt.Sprintf("- container %s removed", c.Name))
+		}
+	}
+
+	if !reflect.DeepEqual(original.Spec.ShareProcessNamespace, debugCopy.Spec.ShareProcessNamespace) {
+		changes = append(changes, "~ pod: process namespace sharing changed")
+	}
+	if !reflect.DeepEqual(original.Spec.SecurityContext, debugCopy.Spec.SecurityContext) {
+		changes = append(changes, "~ pod: security context changed")
+	}
+	if !reflect.DeepEqual(original.Labels, debugCopy.Labels) {
+		changes = append(changes, "~ pod: labels changed")
+	}
+
+	return changes
+}
+
+func describeProbe(probe *corev1.Probe) string {
+	switch {
+	case probe == nil:
+		return "<none>"
+	case probe.Exec != nil:
+		return fmt.Sprintf("exec %q", probe.Exec.Command)
+	case probe.HTTPGet != nil:
+		return fmt.Sprintf("http %s:%s", probe.HTTPGet.Path, probe.HTTPGet.Port.String())
+	case probe.TCPSocket != nil:
+		return fmt.Sprintf("tcp %s", probe.TCPSocket.Port.String())
+	case probe.GRPC != nil:
+		return fmt.Sprintf("grpc %d", probe.GRPC.Port)
+	default:
+		return "<custom>"
+	}
+}
@@ -0,0 +1,47 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "one\ntwo\nthree\nfour\n"
+	b := "one\ntwo\n3\nfour\nfive\n"
+
+	got := unifiedDiff("a", "b", a, b, 1)
+	want := "--- a\n+++ b\n@@ -2,3 +2,4 @@\n two\n-three\n+3\n four\n+five\n"
+	if got != want {
+		t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, want)
+	}
+
+	if got := unifiedDiff("a", "b", a, a, 3); got != "" {
+		t.Errorf("unifiedDiff() of equal texts = %q, want empty", got)
+	}
+}
+
+func TestStructuredPodDiff(t *testing.T) {
+	original := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{
+		{
+			Name:          "app",
+			Image:         "app:1.0",
+			LivenessProbe: &corev1.Probe{ProbeHandler: corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: []string{"check"}}}},
+		},
+	}}}
+	debugCopy := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{
+		{Name: "app", Image: "app:1.0"},
+		{Name: "debugger", Image: "debug:latest"},
+	}}}
+
+	changes := strings.Join(structuredPodDiff(original, debugCopy), "\n")
+	for _, want := range []string{
+		"+ container debugger added (image debug:latest)",
+		`~ container app: liveness probe exec ["check"] -> <none>`,
+	} {
+		if !strings.Contains(changes, want) {
+			t.Errorf("structuredPodDiff() = %q, want it to contain %q", changes, want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var duCmd = &cobra.Command{
+	Use:   "du",
+	Short: "Report disk usage of the target pod's volumes",
+	Long: `Add an ephemeral debug container to the target pod and report the usage of
+every filesystem mounted in the target container, read through /proc/<pid>/root.
+df shows the backing filesystem (the node disk for emptyDir volumes) and du shows
+the space actually used by the volume, so full emptyDir and full PVC incidents can
+be told apart quickly.`,
+	Example: `  kpdbug du -p mypod
+  kpdbug du -p mypod -c app`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runDu(cmd)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(duCmd)
+}
+
+// targetPIDScript sets $pid and $root to the target container's process and
+// filesystem. PID 1 is the target container's process unless the pod shares
+// its process namespace, in which case it is the pause container
+const targetPIDScript = `pid=1
+if [ "$(cat /proc/1/comm 2>/dev/null)" = "pause" ]; then
+  pid=$(ls /proc | grep -E '^[0-9]+$' | sort -n | sed -n 2p)
+fi
+root=/proc/$pid/root
+`
+
+// targetMountsScript loops over the target's directory mounts with $mp and
+// $fstype set; it must be completed with the loop body and
+// "done < /proc/$pid/mounts"
+const targetMountsScript = targetPIDScript + `while read -r dev mp fstype rest; do
+  case "$fstype" in proc|sysfs|devpts|mqueue|cgroup|cgroup2|securityfs|debugfs|tracefs|bpf|pstore|fusectl|configfs) continue;; esac
+  case "$mp" in /proc|/proc/*|/sys|/sys/*|/dev|/dev/*) continue;; esac
+  [ -d "$root$mp" ] || continue
+`
+
+// duScript prints one line per directory mount of the target:
+// MOUNT|<path>|<fstype>|<size KiB>|<used KiB>|<avail KiB>|<du KiB>
+const duScript = targetMountsScript + `  df=$(df -Pk "$root$mp" 2>/dev/null | tail -n 1 | awk '{print $2"|"$3"|"$4}')
+  [ -n "$df" ] || df="||"
+  du=$(timeout 60 du -sxk "$root$mp" 2>/dev/null | cut -f1)
+  echo "MOUNT|$mp|$fstype|$df|$du"
+done < /proc/$pid/mounts`
+
+// volumeUsage is the disk usage of one mount of the target container
+type volumeUsage struct {
+	MountPath string
+	FSType    string
+	Volume    string
+	SizeKB    int64
+	UsedKB    int64
+	AvailKB   int64
+	DuKB      int64
+}
+
+func runDu(cmd *cobra.Command) error {
+	config, err := newTargetConfig(cmd.Context(), cmd, "", "general")
+	if err != nil {
+		return err
+	}
+
+	pod, err := config.getPod(config.PodName, config.Namespace)
+	if err != nil {
+		return NewPodNotFoundError(config.PodName, config.Namespace).WithOriginalError(err)
+	}
+	containerName, err := config.getTargetContainerName()
+	if err != nil {
+		return WrapKubectlError(err, "get target container name")
+	}
+
+	log.Printf("Measuring disk usage of container %s in pod %s...", containerName, config.PodName)
+	result, err := config.runEphemeralScript(config.PodName, duScript)
+	if err != nil {
+		return err
+	}
+
+	usages := parseVolumeUsage(result.Output, volumesByMountPath(pod, containerName))
+	if len(usages) == 0 {
+		fmt.Println("No filesystems found; the debug container may lack permission to read /proc/<pid>/root")
+		return nil
+	}
+
+	fmt.Printf("%-35s %-25s %-10s %10s %10s %10s %5s %10s\n",
+		"MOUNT", "VOLUME", "TYPE", "SIZE", "USED", "AVAIL", "USE%", "DU")
+	for _, usage := range usages {
+		fmt.Printf("%-35s %-25s %-10s %10s %10s %10s %5s %10s\n",
+			truncateString(usage.MountPath, 35),
+			truncateString(usage.Volume, 25),
+			truncateString(usage.FSType, 10),
+			formatKB(usage.SizeKB),
+			formatKB(usage.UsedKB),
+			formatKB(usage.AvailKB),
+			usage.percentUsed(),
+			formatKB(usage.DuKB))
+	}
+	return nil
+}
+
+// volumesByMountPath maps the container's mount paths to a description of
+// the volume mounted there, e.g. "data (pvc data-db-0)"
+func volumesByMountPath(pod *corev1.Pod, containerName string) map[string]string {
+	sources := map[string]string{}
+	for _, volume := range pod.Spec.Volumes {
+		sources[volume.Name] = describeVolumeSource(volume)
+	}
+
+	mounts := map[string]string{}
+	for _, container := range pod.Spec.Containers {
+		if container.Name != containerName {
+			continue
+		}
+		for _, mount := range container.VolumeMounts {
+			mounts[strings.TrimSuffix(mount.MountPath, "/")] = sources[mount.Name]
+		}
+	}
+	return mounts
+}
+
+func describeVolumeSource(volume corev1.Volume) string {
+	switch {
+	case volume.PersistentVolumeClaim != nil:
+		return fmt.Sprintf("%s (pvc %s)", volume.Name, volume.PersistentVolumeClaim.ClaimName)
+	case volume.EmptyDir != nil:
+		return fmt.Sprintf("%s (emptyDir)", volume.Name)
+	case volume.ConfigMap != nil:
+		return fmt.Sprintf("%s (configMap)", volume.Name)
+	case volume.Secret != nil:
+		return fmt.Sprintf("%s (secret)", volume.Name)
+	case volume.HostPath != nil:
+		return fmt.Sprintf("%s (hostPath)", volume.Name)
+	case volume.Projected != nil:
+		return fmt.Sprintf("%s (projected)", volume.Name)
+	default:
+		return volume.Name
+	}
+}
+
+// parseVolumeUsage parses the MOUNT lines printed by duScript
+func parseVolumeUsage(output string, volumes map[string]string) []volumeUsage {
+	var usages []volumeUsage
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "|")
+		if len(fields) != 7 || fields[0] != "MOUNT" {
+			continue
+		}
+
+		usage := volumeUsage{
+			MountPath: fields[1],
+			FSType:    fields[2],
+			Volume:    volumes[strings.TrimSuffix(fields[1], "/")],
+			SizeKB:    parseKB(fields[3]),
+			UsedKB:    parseKB(fields[4]),
+			AvailKB:   parseKB(fields[5]),
+			DuKB:      parseKB(fields[6]),
+		}
+		if usage.MountPath == "/" {
+			usage.Volume = "<container root>"
+		}
+		usages = append(usages, usage)
+	}
+
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].MountPath < usages[j].MountPath
+	})
+	return usages
+}
+
+// parseKB returns -1 for values df or du could not report
+func parseKB(value string) int64 {
+	kb, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return kb
+}
+
+func (u volumeUsage) percentUsed() string {
+	if u.SizeKB <= 0 || u.UsedKB < 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d%%", (u.UsedKB*100+u.SizeKB-1)/u.SizeKB)
+}
+
+// formatKB renders a size in KiB using binary units
+func formatKB(kb int64) string {
+	if kb < 0 {
+		return "-"
+	}
+	units := []string{"Ki", "Mi", "Gi", "Ti", "Pi"}
+	value := float64(kb)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d%s", kb, units[0])
+	}
+	return fmt.Sprintf("%.1f%s", value, units[unit])
+}
@@ -0,0 +1,29 @@
+package plugin
+
+import "testing"
+
+func TestParseVolumeUsage(t *testing.T) {
+	output := "MOUNT|/|overlay|102400|51200|51200|2048\n" +
+		"MOUNT|/data|ext4|1048576|1048576|0|1040000\n" +
+		"MOUNT|/cache|tmpfs||||\n" +
+		"noise\n"
+	volumes := map[string]string{"/data": "data (pvc data-db-0)"}
+
+	usages := parseVolumeUsage(output, volumes)
+	if len(usages) != 3 {
+		t.Fatalf("parseVolumeUsage() returned %d entries, want 3", len(usages))
+	}
+	if usages[1].SizeKB != -1 || formatKB(usages[1].SizeKB) != "-" {
+		t.Errorf("usages[1] = %+v, want unknown size", usages[1])
+	}
+	usages = append(usages[:1], usages[2:]...)
+	if usages[0].MountPath != "/" || usages[0].Volume != "<container root>" {
+		t.Errorf("usages[0] = %+v, want container root", usages[0])
+	}
+	if usages[1].Volume != "data (pvc data-db-0)" || usages[1].percentUsed() != "100%" {
+		t.Errorf("usages[1] = %+v, want full data PVC", usages[1])
+	}
+	if got := formatKB(1048576); got != "1.0Gi" {
+		t.Errorf("formatKB(1048576) = %q, want 1.0Gi", got)
+	}
+}
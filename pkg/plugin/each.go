@@ -0,0 +1,158 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	eachSelector    string
+	eachCommand     string
+	eachConcurrency int
+	eachSummaryOnly bool
+)
+
+var eachCmd = &cobra.Command{
+	Use:   "each",
+	Short: "Run a command in an ephemeral debug container of every matching pod",
+	Long: `Create an ephemeral debug container in every running pod matching the label
+selector, run the command in all of them concurrently, and print the output of
+each pod followed by a summary table with exit codes.`,
+	Example: `  kpdbug each -l app=web --command "ss -tnp | grep 8080"`,
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runEach(cmd.Context())
+	},
+}
+
+func init() {
+	eachCmd.Flags().StringVarP(&eachSelector, "selector", "l", "", "label selector of the pods to debug (required)")
+	eachCmd.Flags().StringVar(&eachCommand, "command", "", "shell command to run in every pod (required)")
+	eachCmd.Flags().IntVar(&eachConcurrency, "concurrency", 10, "maximum number of pods debugged at the same time")
+	eachCmd.Flags().BoolVar(&eachSummaryOnly, "summary", false, "only print the summary table")
+	_ = eachCmd.MarkFlagRequired("selector")
+	_ = eachCmd.MarkFlagRequired("command")
+	rootCmd.AddCommand(eachCmd)
+}
+
+func runEach(ctx context.Context) error {
+	if eachConcurrency < 1 {
+		return NewValidationError("concurrency", fmt.Sprint(eachConcurrency), "must be at least 1")
+	}
+
+	config := NewDebugConfigFromFlags()
+	config.Context = ctx
+
+	pods, err := config.getRunningPodsBySelector(eachSelector)
+	if err != nil {
+		return WrapKubectlError(err, "list pods")
+	}
+	if len(pods) == 0 {
+		fmt.Printf("No running pods match selector %q in namespace %s\n", eachSelector, config.Namespace)
+		return nil
+	}
+
+	log.Printf("Running command in %d pods...", len(pods))
+	results := config.runEphemeralScriptInPods(pods, eachCommand, eachConcurrency)
+	saveResults(config.OutputFile, results)
+
+	if !eachSummaryOnly {
+		for _, result := range results {
+			fmt.Printf("==> %s <==\n", result.Pod)
+			fmt.Print(result.Output)
+			if result.Output != "" && !strings.HasSuffix(result.Output, "\n") {
+				fmt.Println()
+			}
+		}
+		fmt.Println()
+	}
+
+	failed := printResultSummary("POD", results)
+	if failed > 0 {
+		return NewDetailedError(ErrorTypeKubectl,
+			fmt.Sprintf("Command failed in %d of %d pods", failed, len(results)))
+	}
+	return nil
+}
+
+// eachResult is the outcome of the command in a single pod
+type eachResult struct {
+	Pod      string
+	Output   string
+	ExitCode int
+	Err      error
+}
+
+// runEphemeralScriptInPods runs the script in every pod with at most
+// concurrency pods in flight, and returns the results in pod order
+func (config *DebugConfig) runEphemeralScriptInPods(pods []string, script string, concurrency int) []eachResult {
+	results := make([]eachResult, len(pods))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i, pod := range pods {
+		wg.Add(1)
+		go func(i int, pod string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			result, err := config.runEphemeralScript(pod, script)
+			if err != nil {
+				results[i] = eachResult{Pod: pod, ExitCode: -1, Err: err}
+				return
+			}
+			results[i] = eachResult{Pod: pod, Output: result.Output, ExitCode: result.ExitCode}
+		}(i, pod)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// printResultSummary prints the per-pod (or per-node) result table and
+// returns the number of failures
+func printResultSummary(title string, results []eachResult) int {
+	failed := 0
+	fmt.Printf("%-40s %-6s %-50s\n", title, "EXIT", "RESULT")
+	fmt.Printf("%-40s %-6s %-50s\n", strings.Repeat("-", len(title)), "----", "------")
+	for _, result := range results {
+		exit := fmt.Sprint(result.ExitCode)
+		summary := firstLine(result.Output)
+		if result.Err != nil {
+			exit = "-"
+			summary = "error: " + firstLine(result.Err.Error())
+		}
+		if result.Err != nil || result.ExitCode != 0 {
+			failed++
+		}
+		fmt.Printf("%-40s %-6s %-50s\n", truncateString(result.Pod, 40), exit, truncateString(summary, 50))
+	}
+	return failed
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if index := strings.IndexByte(s, '\n'); index >= 0 {
+		return s[:index]
+	}
+	return s
+}
+
+// getRunningPodsBySelector lists the running pods matching a label selector
+func (config *DebugConfig) getRunningPodsBySelector(selector string) ([]string, error) {
+	output, err := outputWithRetry(config.context(), func() *runnerCommand {
+		return config.kubectl("get", "pods", "-n", config.Namespace, "-l", selector,
+			"--field-selector=status.phase=Running",
+			"-o", "jsonpath={.items[*].metadata.name}")
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing pods for selector %s: %v", selector, err)
+	}
+	return strings.Fields(string(output)), nil
+}
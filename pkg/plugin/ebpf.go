@@ -0,0 +1,71 @@
+package plugin
+
+import corev1 "k8s.io/api/core/v1"
+
+// ebpfProfile is the security profile for bpftrace and bcc tools
+const ebpfProfile = "ebpf"
+
+// ebpfCapabilities are the capabilities bpftrace needs on kernels 5.8 and
+// later: loading programs, attaching to perf events and kprobes, reading the
+// target's memory for uprobes and raising the locked memory limit for maps
+var ebpfCapabilities = []corev1.Capability{"BPF", "PERFMON", "SYS_PTRACE", "SYS_RESOURCE"}
+
+// ebpfHostPaths are mounted from the node into standalone ebpf debug pods:
+// debugfs and tracefs for tracepoints, kernel modules and headers for tools
+// that compile against them when the kernel has no BTF
+var ebpfHostPaths = []struct {
+	Name     string
+	Path     string
+	ReadOnly bool
+}{
+	{"debugfs", "/sys/kernel/debug", false},
+	{"tracefs", "/sys/kernel/tracing", false},
+	{"kernel-modules", "/lib/modules", true},
+	{"kernel-headers", "/usr/src", true},
+}
+
+// addEBPFHostMounts adds the ebpf host paths to the pod spec and container
+func addEBPFHostMounts(spec *corev1.PodSpec, container *corev1.Container) {
+	for _, hostPath := range ebpfHostPaths {
+		spec.Volumes = append(spec.Volumes, corev1.Volume{
+			Name: hostPath.Name,
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{Path: hostPath.Path},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      hostPath.Name,
+			MountPath: hostPath.Path,
+			ReadOnly:  hostPath.ReadOnly,
+		})
+	}
+}
+
+// kubectlDebugProfile returns the kubectl debug --profile for a kpdbug
+// profile; ebpf starts from general and sends its security context through
+// the custom container spec
+func kubectlDebugProfile(profile string) string {
+	if profile == "" || profile == ebpfProfile {
+		return "general"
+	}
+	return profile
+}
+
+// warnEBPFProfile prints the guardrails of the ebpf profile: the Pod Security
+// level it needs, the kernel version it assumes and where host mounts apply
+func (config *DebugConfig) warnEBPFProfile() {
+	if config.Profile != ebpfProfile {
+		return
+	}
+
+	if level := config.namespacePSALevel(); level != psaPrivileged {
+		config.logf("Warning: the ebpf profile adds BPF, PERFMON, SYS_PTRACE and SYS_RESOURCE and runs without seccomp, "+
+			"which the %q Pod Security level of namespace %s rejects; use a namespace that enforces \"privileged\"", level, config.Namespace)
+	}
+	config.logf("Warning: the ebpf profile can trace every process and read kernel memory on the node; " +
+		"kernels before 5.8 have no BPF and PERFMON capabilities and need --profile sysadmin")
+	if config.Operation != OperationStandalone {
+		config.logf("Debugfs, tracefs and kernel headers are only mounted into standalone debug pods; " +
+			"the container relies on the kernel's BTF (/sys/kernel/btf/vmlinux)")
+	}
+}
@@ -0,0 +1,35 @@
+package plugin
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestEBPFProfile(t *testing.T) {
+	containerContext, podContext := getSecurityContextForProfile(ebpfProfile)
+	if caps := containerContext.Capabilities; len(caps.Add) != len(ebpfCapabilities) || len(caps.Drop) != 1 || caps.Drop[0] != "ALL" {
+		t.Errorf("capabilities = %+v, want the ebpf capabilities on top of dropping ALL", caps)
+	}
+	if containerContext.Privileged != nil || podContext.SeccompProfile.Type != corev1.SeccompProfileTypeUnconfined {
+		t.Errorf("ebpf profile must not be privileged and must run without seccomp")
+	}
+
+	config := &DebugConfig{Profile: ebpfProfile, CPURequest: "100m", MemoryLimit: "128Mi", MemoryRequest: "128Mi"}
+	securityContext, ok := config.customContainerSpec()["securityContext"].(map[string]interface{})
+	if !ok || securityContext["capabilities"] == nil || securityContext["seccompProfile"] == nil {
+		t.Errorf("custom spec securityContext = %v, want the ebpf capabilities and seccomp profile", securityContext)
+	}
+	if got := kubectlDebugProfile(ebpfProfile); got != "general" {
+		t.Errorf("kubectlDebugProfile(ebpf) = %q, want general", got)
+	}
+	if got := kubectlDebugProfile("netadmin"); got != "netadmin" {
+		t.Errorf("kubectlDebugProfile(netadmin) = %q", got)
+	}
+
+	spec := corev1.PodSpec{Containers: []corev1.Container{{Name: "debugger"}}}
+	addEBPFHostMounts(&spec, &spec.Containers[0])
+	if len(spec.Volumes) != len(ebpfHostPaths) || spec.Containers[0].VolumeMounts[0].MountPath != "/sys/kernel/debug" {
+		t.Errorf("addEBPFHostMounts() = %+v", spec)
+	}
+}
@@ -0,0 +1,153 @@
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// exitMarker is appended to one-shot scripts so the remote exit code can be
+// recovered from the output regardless of the kubectl version
+const exitMarker = "__KPDBUG_EXIT_CODE="
+
+// scriptResult is the outcome of a one-shot command in a debug container
+type scriptResult struct {
+	Pod      string
+	Output   string
+	Stderr   string
+	ExitCode int
+}
+
+// runEphemeralScript runs a shell script in a new ephemeral debug container
+// of pod, sharing the process namespace of the target container, and waits
+// for it to finish
+func (config *DebugConfig) runEphemeralScript(pod, script string) (*scriptResult, error) {
+	return config.streamEphemeralScript(pod, script, nil)
+}
+
+// streamEphemeralScript is runEphemeralScript calling onLine with every line
+// of output as it arrives, for scripts that run for a long time
+func (config *DebugConfig) streamEphemeralScript(pod, script string, onLine func(string)) (*scriptResult, error) {
+	target := *config
+	target.PodName = pod
+	if err := target.admitEphemeral(); err != nil {
+		return nil, err
+	}
+
+	containerName, err := target.getTargetContainerName()
+	if err != nil {
+		return nil, WrapKubectlError(err, "get target container name")
+	}
+
+	customFile, err := target.writeEphemeralSpec()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.Remove(customFile)
+	}()
+
+	args := append(target.ephemeralArgs(containerName, customFile),
+		"--attach=true",
+		"--quiet",
+		"--", "sh", "-c", wrapScript(script),
+	)
+
+	cmd := target.kubectl(args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	if onLine != nil {
+		cmd.Stdout = io.MultiWriter(&stdout, &lineWriter{onLine: onLine})
+	}
+	cmd.Stderr = &stderr
+	runErr := cmd.Run()
+
+	output, exitCode, ok := parseExitMarker(stdout.String())
+	if !ok {
+		if runErr != nil {
+			return nil, fmt.Errorf("error running command in pod %s: %v - %s", pod, runErr, stderr.String())
+		}
+		return nil, fmt.Errorf("command in pod %s finished without reporting an exit code", pod)
+	}
+
+	return &scriptResult{
+		Pod:      pod,
+		Output:   output,
+		Stderr:   stderr.String(),
+		ExitCode: exitCode,
+	}, nil
+}
+
+// lineWriter calls onLine with every complete line written to it
+type lineWriter struct {
+	onLine  func(string)
+	partial []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		w.onLine(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+	}
+}
+
+// ephemeralArgs returns the kubectl debug arguments adding a uniquely named
+// ephemeral container to the config's pod, targeting containerName
+func (config *DebugConfig) ephemeralArgs(containerName, customFile string) []string {
+	return []string{
+		"debug", config.PodName,
+		"-n", config.Namespace,
+		"--image", config.debugImage(),
+		"--target=" + containerName,
+		"--profile=" + kubectlDebugProfile(config.Profile),
+		"--custom=" + customFile,
+		"--container=" + config.generateContainerName(),
+	}
+}
+
+// admitEphemeral checks the debug image and profile of an ephemeral
+// container against the cluster debug policy and image verification; every
+// command adding one to a target calls it first
+func (config *DebugConfig) admitEphemeral() error {
+	if err := config.enforcePolicy(""); err != nil {
+		return err
+	}
+	return config.verifyImage(elevatedProfiles[config.Profile])
+}
+
+// generateContainerName returns a unique name for an ephemeral container
+func (config *DebugConfig) generateContainerName() string {
+	return fmt.Sprintf("kpdbug-%s", randomSuffix())
+}
+
+// wrapScript appends the exit marker to a script
+func wrapScript(script string) string {
+	return fmt.Sprintf("%s\necho \"%s$?\"", script, exitMarker)
+}
+
+// parseExitMarker splits the script output from the trailing exit marker
+func parseExitMarker(output string) (string, int, bool) {
+	index := strings.LastIndex(output, exitMarker)
+	if index < 0 {
+		return output, 0, false
+	}
+
+	code, err := strconv.Atoi(strings.TrimSpace(output[index+len(exitMarker):]))
+	if err != nil {
+		return output, 0, false
+	}
+	return output[:index], code, true
+}
+
+// shellQuote quotes s as a single POSIX shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,51 @@
+package plugin
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseExitMarker(t *testing.T) {
+	output, code, ok := parseExitMarker("LISTEN 0 128 *:8080\n" + exitMarker + "3\n")
+	if !ok || code != 3 || output != "LISTEN 0 128 *:8080\n" {
+		t.Errorf("parseExitMarker() = %q, %d, %v", output, code, ok)
+	}
+
+	if _, _, ok := parseExitMarker("connection lost"); ok {
+		t.Errorf("parseExitMarker() without marker reported ok")
+	}
+}
+
+func TestEphemeralCustomSpec(t *testing.T) {
+	config := &DebugConfig{
+		Namespace:     "default",
+		Image:         "busybox",
+		CPURequest:    "100m",
+		MemoryLimit:   "128Mi",
+		MemoryRequest: "128Mi",
+		Runner:        fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}},
+	}
+	result, err := config.runEphemeralScript("web-6d5f8b7c9-x2k4p", "true")
+	if err != nil {
+		t.Fatalf("runEphemeralScript() error = %v", err)
+	}
+	if result.ExitCode != 0 {
+		t.Errorf("runEphemeralScript() exit code = %d, want 0", result.ExitCode)
+	}
+
+	// The fake cluster rejects resources on ephemeral containers like the
+	// API server, so the tool's default resources must not reach it
+	config.PodName = "web-6d5f8b7c9-x2k4p"
+	customFile, err := config.writeCustomSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = os.Remove(customFile)
+	}()
+	output, err := config.kubectl(append(config.ephemeralArgs("nginx", customFile), "--quiet")...).CombinedOutput()
+	if err == nil || !strings.Contains(string(output), "Forbidden") {
+		t.Errorf("kubectl debug with resources = %v - %s, want a Forbidden error", err, output)
+	}
+}
@@ -1,6 +1,7 @@
 package plugin
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -17,6 +18,7 @@ const (
 	ErrorTypeValidation    ErrorType = "VALIDATION_ERROR"
 	ErrorTypeTimeout       ErrorType = "TIMEOUT_ERROR"
 	ErrorTypeClusterAccess ErrorType = "CLUSTER_ACCESS_ERROR"
+	ErrorTypeCredentials   ErrorType = "CREDENTIALS_ERROR"
 	ErrorTypeResourceLimit ErrorType = "RESOURCE_LIMIT_ERROR"
 )
 
@@ -106,7 +108,7 @@ func NewPermissionError(operation string) *DetailedError {
 	).WithSuggestion(
 		"Check your RBAC permissions or contact your cluster administrator",
 	).WithCommand(
-		"kubectl auth can-i create pods",
+		displayKubectl(withGlobalKubectlFlags([]string{"auth", "can-i", "create", "pods"})),
 	)
 }
 
@@ -121,6 +123,17 @@ func NewClusterAccessError() *DetailedError {
 	)
 }
 
+func NewCredentialsError() *DetailedError {
+	return NewDetailedError(
+		ErrorTypeCredentials,
+		"The API server rejected your credentials; the token may have expired",
+	).WithSuggestion(
+		"Log in again with the credential plugin of your kubeconfig (e.g. your SSO login) and retry",
+	).WithCommand(
+		displayKubectl(withGlobalKubectlFlags([]string{"auth", "whoami"})),
+	)
+}
+
 func NewValidationError(field, value, reason string) *DetailedError {
 	return NewDetailedError(
 		ErrorTypeValidation,
@@ -139,12 +152,64 @@ func NewTimeoutError(operation string, timeout string) *DetailedError {
 	)
 }
 
+// ExitCodeError carries the exit status of the remote command so kpdbug
+// exits with the same code; the command already reported its own output
+type ExitCodeError struct {
+	Code int
+}
+
+func (e *ExitCodeError) Error() string {
+	return fmt.Sprintf("command exited with code %d", e.Code)
+}
+
+// ExitCode returns the code, like exec.ExitError
+func (e *ExitCodeError) ExitCode() int {
+	return e.Code
+}
+
+// wrapSessionError turns the non-zero exit of an attached kubectl session into
+// an ExitCodeError and wraps any other failure not detailed yet as a kubectl
+// error
+func wrapSessionError(err error, operation string) error {
+	if err == nil {
+		return nil
+	}
+	if code, ok := exitCode(err); ok && code > 0 {
+		return &ExitCodeError{Code: code}
+	}
+	var detailed *DetailedError
+	if errors.As(err, &detailed) {
+		return detailed
+	}
+	if evicted := asPodEvicted(err); evicted != nil {
+		detailed := NewDetailedError(ErrorTypePodNotFound, "the session ended because "+evicted.Error()).
+			WithSuggestion("Start a new debug session; check the node if its pods keep being evicted")
+		if evicted.Node != "" {
+			detailed = detailed.WithCommand("kubectl describe node " + evicted.Node)
+		}
+		return detailed
+	}
+	return WrapKubectlError(err, operation)
+}
+
 // HandleError provides centralized error handling with improved UX
 func HandleError(err error) {
 	if err == nil {
 		return
 	}
 
+	// HandleError exits the process, so record the outcome now
+	finishHistory(err)
+
+	// The remote command's exit status is propagated as-is
+	var exitCodeErr *ExitCodeError
+	if errors.As(err, &exitCodeErr) {
+		os.Exit(exitCodeErr.Code)
+	}
+
+	// Events are written unbuffered, so exiting below loses nothing
+	emitErrorEvent(err)
+
 	// If it's already a DetailedError, print it nicely
 	if detailedErr, ok := err.(*DetailedError); ok {
 		fmt.Fprint(os.Stderr, detailedErr.Error())
@@ -192,6 +257,9 @@ func WrapKubectlError(err error, operation string) *DetailedError {
 	}
 
 	errStr := err.Error()
+	if _, rejected := credentialsRejected(errStr); rejected {
+		return NewCredentialsError().WithOriginalError(err)
+	}
 	switch {
 	case strings.Contains(errStr, "not found"):
 		return NewDetailedError(
@@ -0,0 +1,28 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestWrapSessionError(t *testing.T) {
+	mockShouldFail = true
+	defer func() { mockShouldFail = false }()
+
+	err := wrapSessionError(mockRunner{}.Run(context.Background(), "kubectl", "attach"), "attach to pod")
+	exitCodeErr, ok := err.(*ExitCodeError)
+	if !ok || exitCodeErr.Code != 1 {
+		t.Errorf("wrapSessionError() = %v, want ExitCodeError with code 1", err)
+	}
+
+	if err := wrapSessionError(fmt.Errorf("connection refused"), "attach to pod"); err == nil {
+		t.Error("wrapSessionError() = nil, want a kubectl error")
+	} else if _, ok := err.(*DetailedError); !ok {
+		t.Errorf("wrapSessionError() = %T, want *DetailedError", err)
+	}
+
+	if err := wrapSessionError(nil, "attach to pod"); err != nil {
+		t.Errorf("wrapSessionError(nil) = %v, want nil", err)
+	}
+}
@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Lifecycle event types emitted with --events-json
+const (
+	EventCreated  = "created"
+	EventWaiting  = "waiting"
+	EventReady    = "ready"
+	EventAttached = "attached"
+	EventExited   = "exited"
+	EventDeleted  = "deleted"
+	EventError    = "error"
+)
+
+// Event is one machine-readable lifecycle event, written as a JSON line
+type Event struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	Pod       string    `json:"pod,omitempty"`
+	Namespace string    `json:"namespace,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	ErrorType ErrorType `json:"errorType,omitempty"`
+	ExitCode  *int      `json:"exitCode,omitempty"`
+}
+
+var (
+	eventsMu   sync.Mutex
+	eventsSink io.WriteCloser
+)
+
+// openEventSink starts writing events to target: "stderr", a file
+// descriptor number inherited from the parent process, or a file path
+func openEventSink(target string) error {
+	if target == "" {
+		return nil
+	}
+
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+
+	switch fd, err := strconv.Atoi(target); {
+	case target == "stderr":
+		eventsSink = nopCloser{os.Stderr}
+	case err == nil:
+		if fd < 0 {
+			return NewValidationError("events-json", target, "file descriptor must not be negative")
+		}
+		eventsSink = os.NewFile(uintptr(fd), "events")
+	default:
+		file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return NewValidationError("events-json", target, "cannot open file").WithOriginalError(err)
+		}
+		eventsSink = file
+	}
+	return nil
+}
+
+// closeEventSink flushes and closes the event sink, if any
+func closeEventSink() {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	if eventsSink != nil {
+		_ = eventsSink.Close()
+		eventsSink = nil
+	}
+}
+
+// emitEvent writes an event when --events-json is set
+func emitEvent(event Event) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	if eventsSink == nil {
+		return
+	}
+
+	if event.Time.IsZero() {
+		event.Time = clock().UTC()
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	_, _ = fmt.Fprintf(eventsSink, "%s\n", data)
+}
+
+// emitPodEvent emits a lifecycle event for a pod of the config namespace
+func (config *DebugConfig) emitPodEvent(eventType, pod, message string) {
+	emitEvent(Event{Type: eventType, Pod: pod, Namespace: config.Namespace, Message: message})
+}
+
+// emitErrorEvent emits the error event for err
+func emitErrorEvent(err error) {
+	event := Event{Type: EventError, Message: err.Error()}
+	if detailedErr, ok := err.(*DetailedError); ok {
+		event.ErrorType = detailedErr.Type
+		event.Message = detailedErr.Message
+	}
+	emitEvent(event)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,37 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEmitEvent(t *testing.T) {
+	var buf bytes.Buffer
+	eventsSink = nopCloser{&buf}
+	defer closeEventSink()
+
+	config := &DebugConfig{Namespace: "prod"}
+	config.emitPodEvent(EventCreated, "debug-web-1", "")
+	emitErrorEvent(NewPodNotFoundError("web", "prod"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d events, want 2: %q", len(lines), buf.String())
+	}
+
+	var created, failed Event
+	if err := json.Unmarshal([]byte(lines[0]), &created); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &failed); err != nil {
+		t.Fatal(err)
+	}
+	if created.Type != EventCreated || created.Pod != "debug-web-1" || created.Namespace != "prod" || created.Time.IsZero() {
+		t.Errorf("created event = %+v", created)
+	}
+	if failed.Type != EventError || failed.ErrorType != ErrorTypePodNotFound {
+		t.Errorf("error event = %+v, want POD_NOT_FOUND", failed)
+	}
+}
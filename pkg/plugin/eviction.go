@@ -0,0 +1,178 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// evictionInterval is how often the pod of a session is checked for an
+// eviction
+var evictionInterval = 5 * time.Second
+
+// podEvictedError reports a session that ended because its pod was evicted,
+// deleted or stopped, e.g. when its node was drained
+type podEvictedError struct {
+	Pod  string
+	Node string
+	// Reason describes how the pod went away, e.g. "was evicted: The node
+	// was low on resource: memory."
+	Reason string
+}
+
+func (e *podEvictedError) Error() string {
+	if e.Node == "" {
+		return fmt.Sprintf("pod %s %s", e.Pod, e.Reason)
+	}
+	return fmt.Sprintf("pod %s on node %s %s", e.Pod, e.Node, e.Reason)
+}
+
+// asPodEvicted returns the *podEvictedError of err, or nil
+func asPodEvicted(err error) *podEvictedError {
+	var evicted *podEvictedError
+	if errors.As(err, &evicted) {
+		return evicted
+	}
+	return nil
+}
+
+// podEviction describes how pod went away, or returns "" while it runs; a
+// nil pod means it was deleted
+func podEviction(pod *corev1.Pod) string {
+	if pod == nil {
+		return "was deleted"
+	}
+	if pod.Status.Reason == "Evicted" {
+		return "was evicted: " + strings.TrimSpace(pod.Status.Message)
+	}
+	// The eviction API, as used by kubectl drain, marks the pod before
+	// deleting it
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.DisruptionTarget && condition.Status == corev1.ConditionTrue {
+			return fmt.Sprintf("was evicted (%s): %s", condition.Reason, strings.TrimSpace(condition.Message))
+		}
+	}
+	switch {
+	case pod.DeletionTimestamp != nil:
+		return "was deleted"
+	case pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded:
+		return fmt.Sprintf("has %s", pod.Status.Phase)
+	}
+	return ""
+}
+
+// lookupPod fetches the pod, or nil when it does not exist
+func (config *DebugConfig) lookupPod(name string) (*corev1.Pod, error) {
+	lookup := *config
+	lookup.PodName = name
+	return lookup.lookupTarget()
+}
+
+// watchEviction polls the pod of a session until the returned function is
+// called with the session's error, which returns a *podEvictedError when
+// the session failed because the pod went away. Polling keeps the eviction
+// reason, which is gone with the pod by the time the session notices.
+func (config *DebugConfig) watchEviction(pod string) func(error) *podEvictedError {
+	done := make(chan struct{})
+	var mu sync.Mutex
+	var node, reason string
+	// A copy only exists once kubectl debug created it
+	seen := false
+	observe := func(current *corev1.Pod) {
+		mu.Lock()
+		defer mu.Unlock()
+		if current == nil && !seen {
+			return
+		}
+		seen = true
+		if current != nil && current.Spec.NodeName != "" {
+			node = current.Spec.NodeName
+		}
+		if reason == "" {
+			reason = podEviction(current)
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(evictionInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-config.context().Done():
+				return
+			case <-ticker.C:
+			}
+			if current, err := config.lookupPod(pod); err == nil {
+				observe(current)
+			}
+		}
+	}()
+
+	return func(sessionErr error) *podEvictedError {
+		close(done)
+		wg.Wait()
+		if code, exited := exitCode(sessionErr); sessionErr == nil || (exited && code == 0) {
+			return nil
+		}
+		// The session may end before the first or next poll
+		if reason == "" {
+			if current, err := config.lookupPod(pod); err == nil {
+				observe(current)
+			}
+		}
+		if reason == "" {
+			return nil
+		}
+		return &podEvictedError{Pod: pod, Node: node, Reason: reason}
+	}
+}
+
+// offerRecreate tells the user that the session's pod went away and asks
+// whether to create a new one on another node; only interactive sessions
+// whose node is known ask
+func (config *DebugConfig) offerRecreate(evicted *podEvictedError) bool {
+	config.logf("Debug pod %s", strings.TrimPrefix(evicted.Error(), "pod "))
+	if !config.Interactive || !config.TTY || evicted.Node == "" {
+		return false
+	}
+	return config.confirm("Recreate the debug pod on another node? (y/N): ")
+}
+
+// confirm asks a yes/no question on the config's streams
+func (config *DebugConfig) confirm(prompt string) bool {
+	fmt.Fprint(config.stderr(), prompt)
+	var response string
+	_, _ = fmt.Fscanln(config.stdin(), &response)
+	response = strings.ToLower(strings.TrimSpace(response))
+	return response == "y" || response == "yes"
+}
+
+// avoidNodesAffinity keeps a debug pod off the nodes, e.g. the one a
+// previous debug pod was evicted from
+func avoidNodesAffinity(nodes []string) *corev1.Affinity {
+	if len(nodes) == 0 {
+		return nil
+	}
+	return &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{{
+					MatchExpressions: []corev1.NodeSelectorRequirement{{
+						Key:      corev1.LabelHostname,
+						Operator: corev1.NodeSelectorOpNotIn,
+						Values:   nodes,
+					}},
+				}},
+			},
+		},
+	}
+}
@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// evictingRunner evicts the pod of the first attach session, which then
+// fails like kubectl when the container is killed
+type evictingRunner struct {
+	fakeClusterRunner
+	attaches *int
+}
+
+func (r evictingRunner) Stream(ctx context.Context, streams IOStreams, name string, args ...string) error {
+	if args[0] == "attach" {
+		*r.attaches++
+		if *r.attaches == 1 {
+			r.cluster.mu.Lock()
+			pod := r.cluster.objects[objectKey("Pod", "default", args[2])]
+			pod["status"] = map[string]interface{}{"phase": "Failed", "reason": "Evicted", "message": "The node was low on resource: memory."}
+			r.cluster.mu.Unlock()
+			fmt.Fprintln(streams.ErrOut, "error: unexpected EOF")
+			return &ExitCodeError{Code: 1}
+		}
+	}
+	return r.fakeClusterRunner.Stream(ctx, streams, name, args...)
+}
+
+func TestEvictedSession(t *testing.T) {
+	for _, recreate := range []bool{false, true} {
+		answer := "n\n"
+		if recreate {
+			answer = "y\n"
+		}
+		attaches := 0
+		var stderr bytes.Buffer
+		config := &DebugConfig{
+			Namespace: "default", Operation: OperationStandalone, Image: "busybox", Profile: "general",
+			Interactive: true, TTY: true, AttachRetries: 3, CPURequest: "100m", MemoryLimit: "128Mi", MemoryRequest: "128Mi",
+			Stdin: strings.NewReader(answer), Stderr: &stderr,
+			Runner: evictingRunner{fakeClusterRunner: fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}}, attaches: &attaches},
+		}
+		result, err := config.Execute()
+		if !strings.Contains(stderr.String(), "Recreate the debug pod on another node?") {
+			t.Errorf("recreate %v: stderr = %q, want the offer to recreate the pod", recreate, stderr.String())
+		}
+
+		if !recreate {
+			// Not reattached, the pod is gone
+			var detailed *DetailedError
+			if attaches != 1 || !errors.As(err, &detailed) || !strings.Contains(detailed.Message, "was evicted: The node was low on resource: memory.") {
+				t.Errorf("Execute() = %v after %d attaches, want the eviction reported", err, attaches)
+			}
+			continue
+		}
+		if err != nil || attaches != 2 {
+			t.Fatalf("Execute() = %v after %d attaches, want a new pod attached", err, attaches)
+		}
+		pod, err := config.getPod(result.Pod, "default")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if affinity := pod.Spec.Affinity; affinity == nil || affinity.NodeAffinity == nil ||
+			affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[0].MatchExpressions[0].Values[0] != fakeNode {
+			t.Errorf("recreated pod affinity = %+v, want it off %s", pod.Spec.Affinity, fakeNode)
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export [file]",
+	Short: "Write the debug pod or ephemeral container kpdbug would create as YAML",
+	Long: `Render the debug pod, job replay pod or ephemeral container the same flags
+would create, without creating anything, and write it as YAML to the file (or
+to stdout). Every field the tool sets carries a comment saying why, so the
+manifest can go through review where changes to the cluster must come from a
+pull request.
+
+Without -p the manifest is a standalone debug pod, with -p job/<name> or
+cronjob/<name> a replay pod, and with -p <pod> a patch adding an ephemeral
+container to the pod through its ephemeralcontainers subresource. Copies
+(--copy) are built by kubectl debug from the live pod and cannot be exported.`,
+	Example: `  kpdbug export debug-pod.yaml -n payments --profile restricted --ttl 1h
+  kpdbug export -p web-6d5f8b7c9-x2k4p -it > ephemeral-patch.yaml
+  kpdbug export -p job/nightly-report replay.yaml`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file := ""
+		if len(args) == 1 && args[0] != "-" {
+			file = args[0]
+		}
+		return runExport(cmd, file)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+}
+
+// manifestComment explains why kpdbug set a field of an exported manifest;
+// path is the dotted YAML key path, without list indexes
+type manifestComment struct {
+	path string
+	text string
+}
+
+func runExport(cmd *cobra.Command, file string) error {
+	if err := validateProfile(profile); err != nil {
+		return err
+	}
+	if _, err := parseSeccompProfile(seccompProfile); err != nil {
+		return err
+	}
+	if _, err := parseAppArmorProfile(appArmorProfile); err != nil {
+		return err
+	}
+
+	config := NewDebugConfigFromFlags()
+	config.Context = cmd.Context()
+	if err := config.resolveTarget(); err != nil {
+		return err
+	}
+	if err := config.enforcePolicy(""); err != nil {
+		return err
+	}
+
+	manifest, err := config.exportManifest()
+	if err != nil {
+		return err
+	}
+	if file == "" {
+		_, err := os.Stdout.Write(manifest)
+		return err
+	}
+	if err := os.WriteFile(file, manifest, 0o644); err != nil {
+		return fmt.Errorf("error writing %s: %v", file, err)
+	}
+	log.Printf("Wrote the debug manifest to %s", file)
+	return nil
+}
+
+// exportManifest renders the object of the debug operation as commented YAML
+func (config *DebugConfig) exportManifest() ([]byte, error) {
+	switch config.Operation {
+	case OperationStandalone:
+		pod, err := config.buildDebugPod()
+		if err != nil {
+			return nil, err
+		}
+		return renderManifest(pod, config.podHeader(pod), config.podComments(pod))
+	case OperationReplayJob:
+		pod, target, err := config.buildReplayPod()
+		if err != nil {
+			return nil, err
+		}
+		pod.Name = config.generateUniqueName()
+		if err := validatePodName(pod.Name); err != nil {
+			return nil, err
+		}
+		return renderManifest(pod, config.podHeader(pod), config.replayComments(target))
+	case OperationAddContainer:
+		if err := config.verifyTargetPod(); err != nil {
+			return nil, err
+		}
+		targetContainer, err := config.getTargetContainerName()
+		if err != nil {
+			return nil, WrapKubectlError(err, "get target container name")
+		}
+		patch, name, err := config.buildEphemeralPatch(targetContainer)
+		if err != nil {
+			return nil, err
+		}
+		return renderManifest(patch, config.ephemeralHeader(name), config.ephemeralComments(targetContainer))
+	case OperationCopyPod:
+		return nil, NewValidationError("copy", "true", "kubectl debug builds pod copies from the live target; they cannot be exported").
+			WithSuggestion("Drop --copy to export an ephemeral container patch for the pod")
+	}
+	return nil, NewValidationError("operation", "unknown", "invalid debug operation")
+}
+
+// buildEphemeralPatch renders the strategic merge patch adding the debug
+// container to the target through the ephemeralcontainers subresource, and
+// returns the container's name. kubectl debug would apply its --profile on
+// the client, so the patch spells out the profile's security context.
+func (config *DebugConfig) buildEphemeralPatch(targetContainer string) (map[string]interface{}, string, error) {
+	containerContext, _ := getSecurityContextForProfile(config.Profile)
+	if kubectlDebugProfile(config.Profile) == "general" && config.Profile != ebpfProfile {
+		// kubectl's general profile lets debuggers inspect the target's processes
+		containerContext.Capabilities = &corev1.Capabilities{Add: []corev1.Capability{"SYS_PTRACE"}}
+	}
+	seccomp, err := parseSeccompProfile(config.SeccompProfile)
+	if err != nil {
+		return nil, "", err
+	}
+	if seccomp != nil {
+		containerContext.SeccompProfile = seccomp
+	}
+	appArmor, err := parseAppArmorProfile(config.AppArmorProfile)
+	if err != nil {
+		return nil, "", err
+	}
+	if appArmor != nil {
+		containerContext.AppArmorProfile = appArmor
+	}
+	applyCapabilityOverrides(containerContext, config.CapAdd, config.CapDrop)
+
+	name := "debugger-" + randomSuffix()
+	container := corev1.EphemeralContainer{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:            name,
+			Image:           config.debugImage(),
+			Stdin:           true,
+			TTY:             true,
+			SecurityContext: containerContext,
+		},
+		TargetContainerName: targetContainer,
+	}
+
+	// The --custom overlay applies last, as with kubectl debug
+	base, err := toMap(container)
+	if err != nil {
+		return nil, "", err
+	}
+	// Ephemeral containers cannot set resources, not even empty ones
+	delete(base, "resources")
+	custom, err := config.mergedEphemeralSpec()
+	if err != nil {
+		return nil, "", err
+	}
+
+	patch := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata": map[string]interface{}{
+			"name":      config.PodName,
+			"namespace": config.Namespace,
+		},
+		"spec": map[string]interface{}{
+			"ephemeralContainers": []interface{}{mergeMaps(base, custom)},
+		},
+	}
+	return patch, name, nil
+}
+
+// toMap converts a typed object to its JSON map
+func toMap(obj interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("error generating manifest: %v", err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("error generating manifest: %v", err)
+	}
+	return m, nil
+}
+
+// renderManifest marshals the object to YAML behind the header, with a
+// comment above the first occurrence of each commented field. Empty
+// creationTimestamp and status fields of typed objects are dropped.
+func renderManifest(obj interface{}, header []string, comments []manifestComment) ([]byte, error) {
+	m, err := toMap(obj)
+	if err != nil {
+		return nil, err
+	}
+	delete(m, "status")
+	if metadata, ok := m["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "creationTimestamp")
+	}
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("error generating YAML: %v", err)
+	}
+
+	var out strings.Builder
+	for _, line := range header {
+		out.WriteString(strings.TrimRight("# "+line, " ") + "\n")
+	}
+	out.Write(commentYAML(data, comments))
+	return []byte(out.String()), nil
+}
+
+// commentYAML inserts the comments above the lines of their key paths in
+// YAML as written by sigs.k8s.io/yaml: two-space indentation, list items
+// at their key's indentation and block scalars for multi-line strings
+func commentYAML(data []byte, comments []manifestComment) []byte {
+	pending := map[string]string{}
+	for _, c := range comments {
+		if c.text != "" {
+			pending[c.path] = c.text
+		}
+	}
+
+	type level struct {
+		indent int
+		key    string
+	}
+	var stack []level
+	blockIndent := -1
+	var out strings.Builder
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+		if blockIndent >= 0 {
+			if strings.TrimSpace(line) == "" || indent > blockIndent {
+				out.WriteString(line)
+				continue
+			}
+			blockIndent = -1
+		}
+
+		lineIndent := indent
+		for strings.HasPrefix(trimmed, "- ") {
+			trimmed = trimmed[2:]
+			indent += 2
+		}
+		key, value, isKey := strings.Cut(strings.TrimRight(trimmed, "\n"), ":")
+		if !isKey || key == "" || strings.ContainsAny(key[:1], `"'`) || (value != "" && value[0] != ' ') {
+			out.WriteString(line)
+			continue
+		}
+
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, level{indent, key})
+		path := make([]string, len(stack))
+		for i, l := range stack {
+			path[i] = l.key
+		}
+		if text, ok := pending[strings.Join(path, ".")]; ok {
+			delete(pending, strings.Join(path, "."))
+			for _, commentLine := range strings.Split(text, "\n") {
+				out.WriteString(strings.Repeat(" ", lineIndent) + "# " + commentLine + "\n")
+			}
+		}
+		if value = strings.TrimSpace(value); strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+			blockIndent = lineIndent
+		}
+		out.WriteString(line)
+	}
+	return []byte(out.String())
+}
+
+// podHeader explains how to create an exported debug pod and end it
+func (config *DebugConfig) podHeader(pod *corev1.Pod) []string {
+	return []string{
+		"Debug pod rendered by kpdbug export; nothing was created.",
+		"Create it and open a shell with kpdbug, which adds the deadline and audit annotations,",
+		"or with kubectl; remove it when done:",
+		"  kpdbug apply <this file> -it",
+		"  kubectl create -f <this file> && kpdbug attach " + pod.Name + " -n " + pod.Namespace,
+		fmt.Sprintf("  kpdbug clean -n %s", pod.Namespace),
+		"",
+	}
+}
+
+// podComments explains the fields buildDebugPod sets for a standalone pod
+func (config *DebugConfig) podComments(pod *corev1.Pod) []manifestComment {
+	comments := []manifestComment{
+		{"metadata.name", "Generated from the naming template; kubectl create fails rather than replace a pod of the same name"},
+		{"metadata.labels", "debug-tool/type lets kpdbug list and clean find the pod"},
+		{"metadata.annotations", config.annotationsReason(pod.Annotations)},
+		{"spec.automountServiceAccountToken", "No service account token: the debug container gets no API credentials"},
+		{"spec.terminationGracePeriodSeconds", "Nothing to shut down gracefully, so deletes are immediate"},
+		{"spec.securityContext", config.profileReason()},
+		{"spec.containers.image", "--image, or the image of the --preset"},
+		{"spec.containers.command", debugCommandReason(pod.Spec.Containers[0].Command)},
+		{"spec.containers.resources", "--cpu-request, --memory-request and --memory-limit; counted by LimitRanges and ResourceQuotas"},
+		{"spec.containers.securityContext", config.profileReason()},
+		{"spec.containers.stdin", "stdin and tty let kpdbug attach open a shell"},
+		{"spec.containers.env", "Environment of the --preset"},
+		{"spec.containers.livenessProbe", "--probes; the image must contain /bin/true"},
+		{"spec.volumes", "debugfs, tracefs and kernel headers of the node, for the ebpf profile's tools"},
+	}
+	if deadline := pod.Spec.ActiveDeadlineSeconds; deadline != nil {
+		comments = append(comments, manifestComment{"spec.activeDeadlineSeconds",
+			fmt.Sprintf("The kubelet ends the pod %ds after it starts (--ttl or the configured maxTTL), even if nobody cleans it up", *deadline)})
+	}
+	return comments
+}
+
+// annotationsReason explains the annotations of a standalone debug pod
+func (config *DebugConfig) annotationsReason(annotations map[string]string) string {
+	var reasons []string
+	if _, ok := annotations[createdByAnnotation]; ok {
+		reasons = append(reasons, createdByAnnotation+" records who exported the pod")
+	}
+	if config.AppArmorProfile != "" {
+		reasons = append(reasons, "the AppArmor annotation applies --apparmor-profile on older clusters too")
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// replayComments explains the fields buildReplayPod sets
+func (config *DebugConfig) replayComments(target corev1.Container) []manifestComment {
+	comments := []manifestComment{
+		{"metadata.labels", "The pod template's labels without the Job controller's, so the Job does not count the pod;\n" +
+			"debug-tool/type lets kpdbug list and clean find it"},
+		{"metadata.annotations", fmt.Sprintf("%s records the workload, kubectl.kubernetes.io/default-container\n"+
+			"selects %s for kubectl exec and %s who exported the pod", replayOfAnnotation, target.Name, createdByAnnotation)},
+		{"spec.restartPolicy", "The replay is debugged by hand, never restarted"},
+		{"spec.terminationGracePeriodSeconds", "Nothing to shut down gracefully, so deletes are immediate"},
+		{"spec.containers.command", fmt.Sprintf("Every entrypoint is replaced by sleep and the probes are removed;\n"+
+			"the original command of %s was: %s", target.Name, originalCommand(target))},
+	}
+	if deadline := config.activeDeadlineSeconds(); deadline != nil {
+		comments = append(comments, manifestComment{"spec.activeDeadlineSeconds",
+			fmt.Sprintf("The kubelet ends the pod %ds after it starts (--ttl or the configured maxTTL), even if nobody cleans it up", *deadline)})
+	}
+	return comments
+}
+
+// ephemeralHeader explains how to apply an exported ephemeral container
+// patch and what it cannot do
+func (config *DebugConfig) ephemeralHeader(name string) []string {
+	return []string{
+		fmt.Sprintf("Ephemeral debug container for pod %s, rendered by kpdbug export; nothing was changed.", config.PodName),
+		"Add it through the pod's ephemeralcontainers subresource, then connect to it:",
+		fmt.Sprintf("  kubectl patch pod %s -n %s --subresource=ephemeralcontainers --patch-file <this file>", config.PodName, config.Namespace),
+		fmt.Sprintf("  kubectl attach -it %s -n %s -c %s", config.PodName, config.Namespace, name),
+		"Ephemeral containers carry no labels or deadline, cannot be removed and stay until the pod is deleted.",
+		"",
+	}
+}
+
+// ephemeralComments explains the fields buildEphemeralPatch sets
+func (config *DebugConfig) ephemeralComments(targetContainer string) []manifestComment {
+	return []manifestComment{
+		{"spec.ephemeralContainers", "Merged into the pod's ephemeral containers by name"},
+		{"spec.ephemeralContainers.name", "Unique: ephemeral containers cannot be removed, so names are never reused"},
+		{"spec.ephemeralContainers.image", "--image, or the image of the --preset"},
+		{"spec.ephemeralContainers.targetContainerName", fmt.Sprintf("Shares the process namespace of container %s", targetContainer)},
+		{"spec.ephemeralContainers.securityContext", config.profileReason()},
+		{"spec.ephemeralContainers.stdin", "Always set, so kubectl attach -it connects to the shell"},
+	}
+}
+
+// debugCommandReason explains the command of a standalone debug pod
+func debugCommandReason(command []string) string {
+	if len(command) > 0 && command[0] == "bash" {
+		return "-it: kpdbug attach connects to this shell"
+	}
+	return "sleep keeps the pod running for kpdbug attach and kubectl exec"
+}
+
+// profileReason explains the debug container's security context
+func (config *DebugConfig) profileReason() string {
+	name := config.Profile
+	if name == "" {
+		name = "general"
+	}
+	reason := fmt.Sprintf("The %s profile", name)
+	var overrides []string
+	if config.SeccompProfile != "" {
+		overrides = append(overrides, "--seccomp-profile")
+	}
+	if config.AppArmorProfile != "" {
+		overrides = append(overrides, "--apparmor-profile")
+	}
+	if len(config.CapAdd) > 0 {
+		overrides = append(overrides, "--cap-add "+strings.Join(config.CapAdd, ","))
+	}
+	if len(config.CapDrop) > 0 {
+		overrides = append(overrides, "--cap-drop "+strings.Join(config.CapDrop, ","))
+	}
+	if len(overrides) > 0 {
+		reason += " with " + strings.Join(overrides, ", ")
+	}
+	return reason
+}
@@ -0,0 +1,138 @@
+package plugin
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+func TestCommentYAML(t *testing.T) {
+	data := `metadata:
+  labels:
+    app: web
+spec:
+  containers:
+  - command:
+    - sh
+    - -c
+    - |
+      image: not a key
+    image: busybox
+  - image: nginx
+`
+	got := string(commentYAML([]byte(data), []manifestComment{
+		{"metadata.labels", "why labels"},
+		{"spec.containers.command", "why command"},
+		{"spec.containers.image", "why image\nsecond line"},
+		{"spec.volumes", "absent"},
+	}))
+	want := `metadata:
+  # why labels
+  labels:
+    app: web
+spec:
+  containers:
+  # why command
+  - command:
+    - sh
+    - -c
+    - |
+      image: not a key
+    # why image
+    # second line
+    image: busybox
+  - image: nginx
+`
+	if got != want {
+		t.Errorf("commentYAML() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExportManifest(t *testing.T) {
+	newConfig := func(operation DebugOperation, target string) *DebugConfig {
+		return &DebugConfig{
+			Operation:     operation,
+			Namespace:     "default",
+			PodName:       target,
+			Image:         "busybox",
+			Interactive:   true,
+			TTY:           true,
+			TTL:           time.Hour,
+			CPURequest:    "100m",
+			MemoryLimit:   "128Mi",
+			MemoryRequest: "128Mi",
+			Runner:        fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}},
+		}
+	}
+
+	config := newConfig(OperationStandalone, "")
+	manifest, err := config.exportManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pod corev1.Pod
+	if err := yaml.Unmarshal(manifest, &pod); err != nil {
+		t.Fatalf("exported pod is not valid YAML: %v\n%s", err, manifest)
+	}
+	if pod.Labels["debug-tool/type"] != "debug-pod" || pod.Spec.ActiveDeadlineSeconds == nil || *pod.Spec.ActiveDeadlineSeconds != 3600 {
+		t.Errorf("exported pod labels %v, activeDeadlineSeconds %v", pod.Labels, pod.Spec.ActiveDeadlineSeconds)
+	}
+	for _, want := range []string{"kubectl create -f", "  # The kubelet ends the pod 3600s after it starts", "  # No service account token"} {
+		if !strings.Contains(string(manifest), want) {
+			t.Errorf("exported pod lacks %q:\n%s", want, manifest)
+		}
+	}
+	if pods, _ := config.kubectl("get", "pods", "-n", "default", "-l", "debug-tool/type=debug-pod", "-o", "name").Output(); len(pods) > 0 {
+		t.Errorf("export created %s", pods)
+	}
+
+	manifest, err = newConfig(OperationAddContainer, "web-6d5f8b7c9-x2k4p").exportManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var patch corev1.Pod
+	if err := yaml.Unmarshal(manifest, &patch); err != nil {
+		t.Fatalf("exported patch is not valid YAML: %v\n%s", err, manifest)
+	}
+	if len(patch.Spec.EphemeralContainers) != 1 || patch.Spec.EphemeralContainers[0].TargetContainerName != "nginx" {
+		t.Fatalf("exported ephemeral containers = %+v", patch.Spec.EphemeralContainers)
+	}
+	debugger := patch.Spec.EphemeralContainers[0]
+	if debugger.SecurityContext == nil || debugger.SecurityContext.Capabilities == nil ||
+		!reflect.DeepEqual(debugger.SecurityContext.Capabilities.Add, []corev1.Capability{"SYS_PTRACE"}) {
+		t.Errorf("exported ephemeral security context = %+v", debugger.SecurityContext)
+	}
+	if !strings.Contains(string(manifest), "--subresource=ephemeralcontainers") || strings.Contains(string(manifest), "containers: null") {
+		t.Errorf("exported patch:\n%s", manifest)
+	}
+	// The API server rejects resources on ephemeral containers
+	if debugger.Resources.Limits != nil || debugger.Resources.Requests != nil || strings.Contains(string(manifest), "resources:") {
+		t.Errorf("exported ephemeral container has resources:\n%s", manifest)
+	}
+
+	// The header connects with attach -it, which the patch's stdin and tty allow
+	noTTY := newConfig(OperationAddContainer, "web-6d5f8b7c9-x2k4p")
+	noTTY.Interactive, noTTY.TTY = false, false
+	manifest, err = noTTY.exportManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch = corev1.Pod{}
+	if err := yaml.Unmarshal(manifest, &patch); err != nil {
+		t.Fatal(err)
+	}
+	debugger = patch.Spec.EphemeralContainers[0]
+	if want := fmt.Sprintf("#   kubectl attach -it web-6d5f8b7c9-x2k4p -n default -c %s\n", debugger.Name); !strings.Contains(string(manifest), want) ||
+		strings.Contains(string(manifest), "kubectl logs") || !debugger.Stdin || !debugger.TTY {
+		t.Errorf("exported patch without -it:\n%s", manifest)
+	}
+
+	if _, err := newConfig(OperationCopyPod, "web-6d5f8b7c9-x2k4p").exportManifest(); err == nil {
+		t.Error("exporting a copy succeeded")
+	}
+}
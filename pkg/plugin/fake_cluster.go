@@ -0,0 +1,965 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// fakeNode is the only node of the fake cluster
+const fakeNode = "mock-node-1"
+
+// fakeKinds maps the resource names kubectl accepts to kinds
+var fakeKinds = map[string]string{
+	"pod": "Pod", "pods": "Pod", "po": "Pod",
+	"namespace": "Namespace", "namespaces": "Namespace", "ns": "Namespace",
+	"node": "Node", "nodes": "Node", "no": "Node",
+	"configmap": "ConfigMap", "configmaps": "ConfigMap", "cm": "ConfigMap",
+	"secret": "Secret", "secrets": "Secret",
+	"daemonset": "DaemonSet", "daemonsets": "DaemonSet", "ds": "DaemonSet", "daemonset.apps": "DaemonSet",
+	"replicaset": "ReplicaSet", "replicasets": "ReplicaSet", "rs": "ReplicaSet", "replicaset.apps": "ReplicaSet",
+	"statefulset": "StatefulSet", "statefulsets": "StatefulSet", "sts": "StatefulSet", "statefulset.apps": "StatefulSet",
+	"deployment": "Deployment", "deployments": "Deployment", "deploy": "Deployment", "deployment.apps": "Deployment",
+	"job": "Job", "jobs": "Job", "job.batch": "Job",
+	"cronjob": "CronJob", "cronjobs": "CronJob", "cronjob.batch": "CronJob",
+	"event": "Event", "events": "Event", "ev": "Event",
+}
+
+// clusterScoped are the kinds without a namespace
+var clusterScoped = map[string]bool{"Namespace": true, "Node": true}
+
+// fakeValueFlags are the kubectl flags whose value is the next argument
+var fakeValueFlags = map[string]bool{
+	"-n": true, "--namespace": true, "-l": true, "--selector": true, "-o": true, "--output": true,
+	"-f": true, "--filename": true, "-c": true, "--container": true, "--image": true,
+	"--field-selector": true, "--type": true, "-p": true, "--patch": true, "--subresource": true,
+	"--tail": true, "--address": true, "--as": true, "--as-group": true, "--context": true, "--kubeconfig": true,
+	"--raw": true,
+}
+
+// kubectlArgs is a parsed kubectl command line
+type kubectlArgs struct {
+	positional []string
+	flags      map[string]string
+	remote     []string
+}
+
+func parseKubectlArgs(args []string) kubectlArgs {
+	parsed := kubectlArgs{flags: map[string]string{}}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			parsed.remote = args[i+1:]
+			return parsed
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			name, value, hasValue := strings.Cut(arg, "=")
+			// -f is --follow, not --filename, for logs
+			follow := name == "-f" && len(parsed.positional) > 0 && parsed.positional[0] == "logs"
+			if !hasValue && fakeValueFlags[name] && !follow && i+1 < len(args) {
+				i++
+				value = args[i]
+			} else if !hasValue {
+				value = "true"
+			}
+			parsed.flags[name] = value
+		default:
+			parsed.positional = append(parsed.positional, arg)
+		}
+	}
+	return parsed
+}
+
+// flag returns the value of the first of names that is set
+func (a kubectlArgs) flag(names ...string) string {
+	for _, name := range names {
+		if value, ok := a.flags[name]; ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// fakeCluster is an in-memory cluster answering kubectl command lines, for
+// demos and tests without a cluster. Pods run as soon as they are created,
+// sessions echo their input and scripts finish successfully without output.
+// Other commands are run for real.
+type fakeCluster struct {
+	mu      sync.Mutex
+	objects map[string]map[string]interface{}
+	logs    map[string]string
+	next    int
+	// statePath, when set, keeps the cluster between kpdbug invocations
+	statePath string
+}
+
+// fakeState is the persisted form of the fake cluster
+type fakeState struct {
+	Objects map[string]map[string]interface{} `json:"objects"`
+	Logs    map[string]string                 `json:"logs"`
+	Next    int                               `json:"next"`
+}
+
+// newFakeCluster returns a fake cluster with a demo workload, or the state
+// saved at statePath
+func newFakeCluster(statePath string) *fakeCluster {
+	cluster := &fakeCluster{objects: map[string]map[string]interface{}{}, logs: map[string]string{}, statePath: statePath}
+	if statePath != "" {
+		if data, err := os.ReadFile(statePath); err == nil {
+			var state fakeState
+			if json.Unmarshal(data, &state) == nil && state.Objects != nil {
+				cluster.objects, cluster.next = state.Objects, state.Next
+				if state.Logs != nil {
+					cluster.logs = state.Logs
+				}
+				return cluster
+			}
+		}
+	}
+	cluster.seed()
+	return cluster
+}
+
+func (c *fakeCluster) seed() {
+	for _, ns := range []string{"default", "kube-system"} {
+		c.store(map[string]interface{}{"apiVersion": "v1", "kind": "Namespace", "metadata": map[string]interface{}{"name": ns}})
+	}
+	c.store(map[string]interface{}{
+		"apiVersion": "v1", "kind": "Node",
+		"metadata": map[string]interface{}{"name": fakeNode, "labels": map[string]interface{}{"kubernetes.io/hostname": fakeNode}},
+		"status":   map[string]interface{}{"nodeInfo": map[string]interface{}{"kernelVersion": "6.6.0-mock", "containerRuntimeVersion": "containerd://1.7.0"}},
+	})
+	c.store(map[string]interface{}{
+		"apiVersion": "apps/v1", "kind": "Deployment",
+		"metadata": map[string]interface{}{"name": "web", "namespace": "default"},
+		"spec":     map[string]interface{}{"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "web"}}},
+	})
+	c.store(map[string]interface{}{
+		"apiVersion": "apps/v1", "kind": "ReplicaSet",
+		"metadata": map[string]interface{}{"name": "web-6d5f8b7c9", "namespace": "default",
+			"ownerReferences": []interface{}{map[string]interface{}{"apiVersion": "apps/v1", "kind": "Deployment", "name": "web", "uid": "mock-web"}}},
+	})
+	web := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "web-6d5f8b7c9-x2k4p", Namespace: "default",
+			Labels:          map[string]string{"app": "web", "pod-template-hash": "6d5f8b7c9"},
+			OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-6d5f8b7c9", UID: "mock-web-rs"}},
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "nginx", Image: "nginx:1.27"}}},
+	}
+	c.storePod(web)
+	c.store(map[string]interface{}{
+		"apiVersion": "apps/v1", "kind": "StatefulSet",
+		"metadata": map[string]interface{}{"name": "db", "namespace": "default"},
+		"spec": map[string]interface{}{"replicas": 2, "serviceName": "db-headless",
+			"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "db"}}},
+	})
+	for i := 0; i < 2; i++ {
+		c.storePod(&corev1.Pod{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name: fmt.Sprintf("db-%d", i), Namespace: "default", Labels: map[string]string{"app": "db"},
+				OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "db", UID: "mock-db"}},
+			},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "postgres", Image: "postgres:16"}}},
+		})
+	}
+	c.logs["default/"+web.Name] = "10.244.0.1 - - \"GET / HTTP/1.1\" 200 615\n10.244.0.1 - - \"GET /healthz HTTP/1.1\" 200 2\n"
+}
+
+func objectKey(kind, namespace, name string) string {
+	if clusterScoped[kind] {
+		namespace = ""
+	}
+	return kind + "/" + namespace + "/" + name
+}
+
+func objectMeta(obj map[string]interface{}) map[string]interface{} {
+	meta, _ := obj["metadata"].(map[string]interface{})
+	if meta == nil {
+		meta = map[string]interface{}{}
+		obj["metadata"] = meta
+	}
+	return meta
+}
+
+func metaString(obj map[string]interface{}, field string) string {
+	value, _ := objectMeta(obj)[field].(string)
+	return value
+}
+
+// store saves obj, filling in the fields the API server would set
+func (c *fakeCluster) store(obj map[string]interface{}) {
+	kind, _ := obj["kind"].(string)
+	meta := objectMeta(obj)
+	c.next++
+	if _, ok := meta["uid"]; !ok {
+		meta["uid"] = fmt.Sprintf("mock-%06d", c.next)
+	}
+	if _, ok := meta["creationTimestamp"]; !ok || meta["creationTimestamp"] == nil {
+		meta["creationTimestamp"] = clock().UTC().Format(time.RFC3339)
+	}
+	c.objects[objectKey(kind, metaString(obj, "namespace"), metaString(obj, "name"))] = obj
+}
+
+// storePod starts the pod: it runs on the fake node, or has already
+// succeeded when its command is a kpdbug script reporting an exit code
+func (c *fakeCluster) storePod(pod *corev1.Pod) {
+	if pod.Namespace == "" {
+		pod.Namespace = "default"
+	}
+	if pod.Spec.NodeName == "" {
+		pod.Spec.NodeName = fakeNode
+	}
+	c.next++
+	pod.Status.Phase = corev1.PodRunning
+	pod.Status.PodIP = fmt.Sprintf("10.244.0.%d", c.next%250+2)
+	pod.Status.HostIP = "192.168.49.2"
+	pod.Status.ContainerStatuses = nil
+	for _, container := range pod.Spec.Containers {
+		if strings.Contains(strings.Join(container.Command, " "), exitMarker) {
+			pod.Status.Phase = corev1.PodSucceeded
+			c.logs[pod.Namespace+"/"+pod.Name] = exitMarker + "0\n"
+		}
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, corev1.ContainerStatus{
+			Name:        container.Name,
+			Image:       container.Image,
+			Ready:       pod.Status.Phase == corev1.PodRunning,
+			ContainerID: fmt.Sprintf("containerd://%064x", c.next),
+			State:       corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: metav1.NewTime(clock())}},
+		})
+	}
+	obj, _ := toUnstructured(pod)
+	c.store(obj)
+}
+
+func toUnstructured(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]interface{}
+	return obj, json.Unmarshal(data, &obj)
+}
+
+func fromUnstructured(obj map[string]interface{}, v interface{}) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (c *fakeCluster) save() {
+	if c.statePath == "" {
+		return
+	}
+	data, err := json.Marshal(fakeState{Objects: c.objects, Logs: c.logs, Next: c.next})
+	if err == nil {
+		_ = os.WriteFile(c.statePath, data, 0o600)
+	}
+}
+
+// fakeClusterRunner answers kubectl with a fake cluster and runs anything else
+type fakeClusterRunner struct {
+	cluster *fakeCluster
+	local   KubectlRunner
+}
+
+func (r fakeClusterRunner) Run(ctx context.Context, name string, args ...string) error {
+	return r.Stream(ctx, IOStreams{}, name, args...)
+}
+
+func (r fakeClusterRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if name != "kubectl" {
+		return r.local.Output(ctx, name, args...)
+	}
+	var stdout, stderr bytes.Buffer
+	err := r.Stream(ctx, IOStreams{Out: &stdout, ErrOut: &stderr}, name, args...)
+	if err != nil {
+		return stdout.Bytes(), &fakeExitError{code: 1, stderr: strings.TrimSpace(stderr.String())}
+	}
+	return stdout.Bytes(), nil
+}
+
+func (r fakeClusterRunner) Stream(ctx context.Context, streams IOStreams, name string, args ...string) error {
+	if name != "kubectl" {
+		return r.local.Stream(ctx, streams, name, args...)
+	}
+	if streams.Out == nil {
+		streams.Out = io.Discard
+	}
+	if streams.ErrOut == nil {
+		streams.ErrOut = io.Discard
+	}
+	return r.cluster.kubectl(ctx, parseKubectlArgs(args), streams)
+}
+
+// fakeExitError is the failure of a fake kubectl command
+type fakeExitError struct {
+	code   int
+	stderr string
+}
+
+func (e *fakeExitError) Error() string {
+	return fmt.Sprintf("exit status %d: %s", e.code, e.stderr)
+}
+
+func (e *fakeExitError) ExitCode() int {
+	return e.code
+}
+
+// notFound writes kubectl's NotFound message and returns its error
+func notFound(streams IOStreams, kind, name string) error {
+	message := fmt.Sprintf("Error from server (NotFound): %ss %q not found", strings.ToLower(kind), name)
+	fmt.Fprintln(streams.ErrOut, message)
+	return &fakeExitError{code: 1, stderr: message}
+}
+
+// kubectl runs one fake kubectl command
+func (c *fakeCluster) kubectl(ctx context.Context, args kubectlArgs, streams IOStreams) error {
+	if len(args.positional) == 0 {
+		return nil
+	}
+	namespace := args.flag("-n", "--namespace")
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	switch verb := args.positional[0]; verb {
+	case "get":
+		if args.flag("--raw") == "/version" {
+			fmt.Fprint(streams.Out, `{"major": "1", "minor": "30", "gitVersion": "v1.30.0-mock"}`)
+			return nil
+		}
+		return c.get(args, namespace, streams)
+	case "create", "apply":
+		return c.submit(verb, streams)
+	case "delete":
+		return c.delete(args, namespace, streams)
+	case "patch":
+		return c.patch(args, namespace, streams)
+	case "debug":
+		return c.debug(ctx, args, namespace, streams)
+	case "attach", "exec":
+		return c.session(ctx, args, streams)
+	case "logs":
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if len(args.positional) > 1 {
+			fmt.Fprint(streams.Out, c.logs[namespace+"/"+strings.TrimPrefix(args.positional[1], "pod/")])
+		}
+		return nil
+	case "auth":
+		if len(args.positional) > 1 && args.positional[1] == "whoami" {
+			fmt.Fprint(streams.Out, "mock-user")
+			return nil
+		}
+		fmt.Fprintln(streams.Out, "yes")
+		return nil
+	case "config":
+		if len(args.positional) > 1 && args.positional[1] == "get-contexts" {
+			fmt.Fprintln(streams.Out, "mock")
+			return nil
+		}
+		fmt.Fprint(streams.Out, "default")
+		return nil
+	case "top":
+		fmt.Fprintln(streams.Out, "POD\tNAME\tCPU(cores)\tMEMORY(bytes)")
+		return nil
+	case "port-forward":
+		fmt.Fprintf(streams.Out, "Forwarding from %s -> mock (no traffic is forwarded)\n", args.flag("--address"))
+		<-ctx.Done()
+		return nil
+	}
+	return nil
+}
+
+// fakeResource returns the kind and name of a get or delete, accepting both
+// "pod web" and "pod/web"
+func fakeResource(args kubectlArgs) (string, string) {
+	if len(args.positional) < 2 {
+		return "", ""
+	}
+	kindName, name := args.positional[1], ""
+	if k, n, ok := strings.Cut(kindName, "/"); ok {
+		kindName, name = k, n
+	} else if len(args.positional) > 2 {
+		name = args.positional[2]
+	}
+	kind, ok := fakeKinds[strings.ToLower(kindName)]
+	if !ok {
+		kind = kindName
+	}
+	return kind, name
+}
+
+// matchesSelector reports whether labels satisfy a label selector of
+// key=value, key!=value and key terms
+func matchesSelector(labels map[string]interface{}, selector string) bool {
+	if selector == "" {
+		return true
+	}
+	for _, term := range strings.Split(selector, ",") {
+		if key, value, ok := strings.Cut(term, "!="); ok {
+			if labels[key] == value {
+				return false
+			}
+			continue
+		}
+		key, value, hasValue := strings.Cut(term, "=")
+		actual, ok := labels[strings.TrimSpace(key)]
+		if !ok || (hasValue && actual != strings.TrimPrefix(value, "=")) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *fakeCluster) get(args kubectlArgs, namespace string, streams IOStreams) error {
+	kind, name := fakeResource(args)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var matches []map[string]interface{}
+	if name != "" {
+		obj, ok := c.objects[objectKey(kind, namespace, name)]
+		if !ok && args.flag("--ignore-not-found") == "true" {
+			return nil
+		}
+		if !ok {
+			return notFound(streams, kind, name)
+		}
+		matches = append(matches, obj)
+	} else {
+		all := args.flag("-A", "--all-namespaces") == "true"
+		selector := args.flag("-l", "--selector")
+		keys := make([]string, 0, len(c.objects))
+		for key := range c.objects {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			obj := c.objects[key]
+			if obj["kind"] != kind || (!all && !clusterScoped[kind] && metaString(obj, "namespace") != namespace) {
+				continue
+			}
+			labels, _ := objectMeta(obj)["labels"].(map[string]interface{})
+			if !matchesSelector(labels, selector) || !matchesFieldSelector(obj, args.flag("--field-selector")) {
+				continue
+			}
+			matches = append(matches, obj)
+		}
+		if len(matches) == 0 && !strings.HasPrefix(args.flag("-o", "--output"), "json") {
+			fmt.Fprintf(streams.ErrOut, "No resources found in %s namespace.\n", namespace)
+		}
+	}
+
+	var result interface{}
+	if name != "" {
+		result = matches[0]
+	} else {
+		items := make([]interface{}, len(matches))
+		for i, obj := range matches {
+			items[i] = obj
+		}
+		result = map[string]interface{}{"apiVersion": "v1", "kind": "List", "items": items}
+	}
+	return printObjects(streams.Out, args.flag("-o", "--output"), result, matches)
+}
+
+// matchesFieldSelector supports the status.phase selector kpdbug uses
+func matchesFieldSelector(obj map[string]interface{}, selector string) bool {
+	if selector == "" {
+		return true
+	}
+	for _, term := range strings.Split(selector, ",") {
+		field, value, _ := strings.Cut(term, "=")
+		if got := jsonPathValues(obj, "."+field); len(got) != 1 || fmt.Sprint(got[0]) != value {
+			return false
+		}
+	}
+	return true
+}
+
+func printObjects(out io.Writer, format string, result interface{}, matches []map[string]interface{}) error {
+	switch {
+	case format == "json":
+		data, err := json.MarshalIndent(result, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, string(data))
+	case format == "yaml":
+		data, err := yaml.Marshal(result)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(out, string(data))
+	case format == "name":
+		for _, obj := range matches {
+			fmt.Fprintf(out, "%s/%s\n", strings.ToLower(obj["kind"].(string)), metaString(obj, "name"))
+		}
+	case strings.HasPrefix(format, "jsonpath="):
+		fmt.Fprint(out, evalJSONPath(result, strings.TrimPrefix(format, "jsonpath=")))
+	case strings.HasPrefix(format, "custom-columns="):
+		columns := strings.Split(strings.TrimPrefix(format, "custom-columns="), ",")
+		for _, obj := range matches {
+			var cells []string
+			for _, column := range columns {
+				_, path, _ := strings.Cut(column, ":")
+				cells = append(cells, evalJSONPath(obj, "{."+path+"}"))
+			}
+			fmt.Fprintln(out, strings.Join(cells, "   "))
+		}
+	default:
+		fmt.Fprintln(out, "NAME\tSTATUS\tAGE")
+		for _, obj := range matches {
+			status := evalJSONPath(obj, "{.status.phase}")
+			fmt.Fprintf(out, "%s\t%s\t%s\n", metaString(obj, "name"), status, "1m")
+		}
+	}
+	return nil
+}
+
+// evalJSONPath evaluates the subset of kubectl's JSONPath templates kpdbug
+// uses: {.a.b}, [*], [n], [?(@.k=='v')], escaped dots and ..key
+func evalJSONPath(obj interface{}, template string) string {
+	var out strings.Builder
+	for {
+		start := strings.Index(template, "{")
+		end := strings.Index(template, "}")
+		if start < 0 || end < start {
+			out.WriteString(template)
+			return out.String()
+		}
+		out.WriteString(template[:start])
+		values := jsonPathValues(obj, template[start+1:end])
+		parts := make([]string, 0, len(values))
+		for _, value := range values {
+			switch v := value.(type) {
+			case string:
+				parts = append(parts, v)
+			case map[string]interface{}, []interface{}:
+				data, _ := json.Marshal(v)
+				parts = append(parts, string(data))
+			default:
+				parts = append(parts, fmt.Sprint(v))
+			}
+		}
+		out.WriteString(strings.Join(parts, " "))
+		template = template[end+1:]
+	}
+}
+
+// splitJSONPath splits .a.b\.c[0] into a, b.c, [0]
+func splitJSONPath(path string) []string {
+	var segments []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			segments = append(segments, current.String())
+			current.Reset()
+		}
+	}
+	for i := 0; i < len(path); i++ {
+		switch ch := path[i]; {
+		case ch == '\\' && i+1 < len(path):
+			i++
+			current.WriteByte(path[i])
+		case ch == '.':
+			flush()
+			if i+1 < len(path) && path[i+1] == '.' {
+				segments = append(segments, "..")
+				i++
+			}
+		case ch == '[':
+			flush()
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				end = len(path) - i - 1
+			}
+			segments = append(segments, path[i:i+end+1])
+			i += end
+		default:
+			current.WriteByte(ch)
+		}
+	}
+	flush()
+	return segments
+}
+
+func jsonPathValues(obj interface{}, path string) []interface{} {
+	values := []interface{}{obj}
+	recursive := false
+	for _, segment := range splitJSONPath(path) {
+		if segment == ".." {
+			recursive = true
+			continue
+		}
+		var next []interface{}
+		for _, value := range values {
+			if recursive {
+				next = append(next, findKey(value, segment)...)
+				continue
+			}
+			next = append(next, stepJSONPath(value, segment)...)
+		}
+		values, recursive = next, false
+	}
+	return values
+}
+
+func stepJSONPath(value interface{}, segment string) []interface{} {
+	if !strings.HasPrefix(segment, "[") {
+		if m, ok := value.(map[string]interface{}); ok {
+			if v, ok := m[segment]; ok {
+				return []interface{}{v}
+			}
+		}
+		return nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	inner := strings.TrimSuffix(strings.TrimPrefix(segment, "["), "]")
+	switch {
+	case inner == "*":
+		return list
+	case strings.HasPrefix(inner, "?(@."):
+		expr := strings.TrimSuffix(strings.TrimPrefix(inner, "?(@."), ")")
+		field, want, _ := strings.Cut(expr, "==")
+		want = strings.Trim(want, `'"`)
+		var matches []interface{}
+		for _, item := range list {
+			if m, ok := item.(map[string]interface{}); ok && fmt.Sprint(m[field]) == want {
+				matches = append(matches, item)
+			}
+		}
+		return matches
+	}
+	index, err := strconv.Atoi(inner)
+	if err != nil || index < 0 || index >= len(list) {
+		return nil
+	}
+	return []interface{}{list[index]}
+}
+
+// findKey returns the values of key at any depth
+func findKey(value interface{}, key string) []interface{} {
+	var found []interface{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if match, ok := v[key]; ok {
+			found = append(found, match)
+		}
+		for _, child := range v {
+			found = append(found, findKey(child, key)...)
+		}
+	case []interface{}:
+		for _, child := range v {
+			found = append(found, findKey(child, key)...)
+		}
+	}
+	return found
+}
+
+// submit creates or applies the YAML documents read from stdin
+func (c *fakeCluster) submit(verb string, streams IOStreams) error {
+	if streams.In == nil {
+		return nil
+	}
+	data, err := io.ReadAll(streams.In)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.save()
+
+	for _, doc := range strings.Split(string(data), "\n---") {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		var obj map[string]interface{}
+		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
+			fmt.Fprintf(streams.ErrOut, "error: error parsing input: %v\n", err)
+			return &fakeExitError{code: 1, stderr: err.Error()}
+		}
+		kind, _ := obj["kind"].(string)
+		if metaString(obj, "namespace") == "" && !clusterScoped[kind] {
+			objectMeta(obj)["namespace"] = "default"
+		}
+		name := metaString(obj, "name")
+		if _, exists := c.objects[objectKey(kind, metaString(obj, "namespace"), name)]; exists && verb == "create" {
+			message := fmt.Sprintf("Error from server (AlreadyExists): %ss %q already exists", strings.ToLower(kind), name)
+			fmt.Fprintln(streams.ErrOut, message)
+			return &fakeExitError{code: 1, stderr: message}
+		}
+
+		switch kind {
+		case "Pod":
+			var pod corev1.Pod
+			if err := fromUnstructured(obj, &pod); err != nil {
+				return err
+			}
+			c.storePod(&pod)
+		case "DaemonSet":
+			c.store(obj)
+			c.scheduleDaemonSet(obj)
+		default:
+			c.store(obj)
+		}
+		fmt.Fprintf(streams.Out, "%s/%s created\n", strings.ToLower(kind), name)
+	}
+	return nil
+}
+
+// scheduleDaemonSet runs one pod of the DaemonSet's template on every node
+func (c *fakeCluster) scheduleDaemonSet(ds map[string]interface{}) {
+	var daemonSet struct {
+		Metadata metav1.ObjectMeta `json:"metadata"`
+		Spec     struct {
+			Template corev1.PodTemplateSpec `json:"template"`
+		} `json:"spec"`
+	}
+	if fromUnstructured(ds, &daemonSet) != nil {
+		return
+	}
+	var nodes []string
+	for _, obj := range c.objects {
+		if obj["kind"] != "Node" {
+			continue
+		}
+		labels, _ := objectMeta(obj)["labels"].(map[string]interface{})
+		matches := true
+		for key, value := range daemonSet.Spec.Template.Spec.NodeSelector {
+			matches = matches && labels[key] == value
+		}
+		if matches {
+			nodes = append(nodes, metaString(obj, "name"))
+		}
+	}
+	sort.Strings(nodes)
+	objectMeta(ds)["generation"] = 1
+	ds["status"] = map[string]interface{}{"observedGeneration": 1, "desiredNumberScheduled": len(nodes), "numberReady": len(nodes)}
+	for i, node := range nodes {
+		pod := &corev1.Pod{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+			ObjectMeta: *daemonSet.Spec.Template.ObjectMeta.DeepCopy(),
+			Spec:       *daemonSet.Spec.Template.Spec.DeepCopy(),
+		}
+		pod.Name = fmt.Sprintf("%s-%05d", daemonSet.Metadata.Name, i)
+		pod.Namespace = daemonSet.Metadata.Namespace
+		pod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "DaemonSet", Name: daemonSet.Metadata.Name}}
+		pod.Spec.NodeName = node
+		c.storePod(pod)
+	}
+}
+
+func (c *fakeCluster) delete(args kubectlArgs, namespace string, streams IOStreams) error {
+	kind, name := fakeResource(args)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.save()
+
+	key := objectKey(kind, namespace, name)
+	if _, ok := c.objects[key]; !ok {
+		if args.flag("--ignore-not-found") == "true" {
+			return nil
+		}
+		return notFound(streams, kind, name)
+	}
+	delete(c.objects, key)
+	if kind == "DaemonSet" {
+		for podKey, obj := range c.objects {
+			for _, owner := range jsonPathValues(obj, ".metadata.ownerReferences[?(@.kind=='DaemonSet')].name") {
+				if owner == name && metaString(obj, "namespace") == namespace {
+					delete(c.objects, podKey)
+				}
+			}
+		}
+	}
+	fmt.Fprintf(streams.Out, "%s %q deleted\n", strings.ToLower(kind), name)
+	return nil
+}
+
+// mergePatch applies a JSON merge patch to obj
+func mergePatch(obj, patch map[string]interface{}) {
+	for key, value := range patch {
+		if value == nil {
+			delete(obj, key)
+			continue
+		}
+		if patchMap, ok := value.(map[string]interface{}); ok {
+			if objMap, ok := obj[key].(map[string]interface{}); ok {
+				mergePatch(objMap, patchMap)
+				continue
+			}
+		}
+		obj[key] = value
+	}
+}
+
+func (c *fakeCluster) patch(args kubectlArgs, namespace string, streams IOStreams) error {
+	kind, name := fakeResource(args)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.save()
+
+	obj, ok := c.objects[objectKey(kind, namespace, name)]
+	if !ok {
+		return notFound(streams, kind, name)
+	}
+	var patch map[string]interface{}
+	if err := json.Unmarshal([]byte(args.flag("-p", "--patch")), &patch); err != nil {
+		fmt.Fprintf(streams.ErrOut, "error: unable to parse patch: %v\n", err)
+		return &fakeExitError{code: 1, stderr: err.Error()}
+	}
+	mergePatch(obj, patch)
+	fmt.Fprintf(streams.Out, "%s/%s patched\n", strings.ToLower(kind), name)
+	return nil
+}
+
+// debug adds an ephemeral container to the target, or with --copy-to
+// creates a copy of it with the debug container, then runs the session
+func (c *fakeCluster) debug(ctx context.Context, args kubectlArgs, namespace string, streams IOStreams) error {
+	if len(args.positional) < 2 {
+		return nil
+	}
+	target := strings.TrimPrefix(args.positional[1], "pod/")
+	c.mu.Lock()
+	obj, ok := c.objects[objectKey("Pod", namespace, target)]
+	if !ok {
+		c.mu.Unlock()
+		return notFound(streams, "Pod", target)
+	}
+	var pod corev1.Pod
+	if err := fromUnstructured(obj, &pod); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	container := args.flag("-c", "--container")
+	if container == "" {
+		container = fmt.Sprintf("debugger-%d", c.next)
+	}
+	image := args.flag("--image")
+
+	if copyTo := args.flag("--copy-to"); copyTo != "" {
+		copied := pod.DeepCopy()
+		copied.ObjectMeta = metav1.ObjectMeta{Name: copyTo, Namespace: namespace, Labels: pod.Labels, Annotations: pod.Annotations}
+		copied.Spec.Containers = append(copied.Spec.Containers, corev1.Container{Name: container, Image: image, Command: args.remote})
+		if args.flag("--share-processes") == "true" {
+			copied.Spec.ShareProcessNamespace = &[]bool{true}[0]
+		}
+		c.storePod(copied)
+		target = copyTo
+	} else {
+		if err := ephemeralCustomError(args.flag("--custom"), pod.Name); err != nil {
+			c.mu.Unlock()
+			fmt.Fprintf(streams.ErrOut, "error: %v\n", err)
+			return &fakeExitError{code: 1, stderr: err.Error()}
+		}
+		pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, corev1.EphemeralContainer{
+			EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: container, Image: image, Command: args.remote},
+			TargetContainerName:      args.flag("--target"),
+		})
+		updated, _ := toUnstructured(&pod)
+		c.objects[objectKey("Pod", namespace, target)] = updated
+	}
+	c.save()
+	c.mu.Unlock()
+
+	// kubectl only reports the names it picks
+	if args.flag("--quiet") != "true" && args.flag("-c", "--container") == "" {
+		fmt.Fprintf(streams.ErrOut, "Defaulting debug container name to %s.\n", container)
+	}
+	if args.flag("-i", "--stdin", "-it", "--attach") == "" && len(args.remote) == 0 {
+		return nil
+	}
+	return c.session(ctx, kubectlArgs{positional: []string{"attach", target}, flags: args.flags, remote: args.remote}, streams)
+}
+
+// ephemeralCustomError rejects a --custom spec with fields the API server
+// forbids for ephemeral containers, like it does
+func ephemeralCustomError(customFile, pod string) error {
+	if customFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(customFile)
+	if err != nil {
+		return err
+	}
+	var spec map[string]interface{}
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return err
+	}
+	for _, field := range []string{"resources", "ports", "livenessProbe", "readinessProbe", "startupProbe", "lifecycle"} {
+		if _, ok := spec[field]; ok {
+			return fmt.Errorf("Pod %q is invalid: spec.ephemeralContainers[0].%s: Forbidden: cannot be set for an Ephemeral Container", pod, field)
+		}
+	}
+	return nil
+}
+
+// fakeShells are the commands sessions echo their input for
+var fakeShells = map[string]bool{"sh": true, "bash": true, "/bin/sh": true, "/bin/bash": true}
+
+// session plays an attach or exec: a kpdbug script reports success without
+// output, another command is announced, and a shell echoes its input
+func (c *fakeCluster) session(ctx context.Context, args kubectlArgs, streams IOStreams) error {
+	pod := ""
+	if len(args.positional) > 1 {
+		pod = strings.TrimPrefix(args.positional[1], "pod/")
+	}
+	command := strings.Join(args.remote, " ")
+	switch {
+	case strings.Contains(command, exitMarker):
+		fmt.Fprintln(streams.Out, exitMarker+"0")
+		return nil
+	case command != "" && !fakeShells[command]:
+		fmt.Fprintf(streams.ErrOut, "[mock] %s: would run %q\n", pod, command)
+		return nil
+	case streams.In == nil:
+		return nil
+	}
+
+	fmt.Fprintf(streams.ErrOut, "[mock] connected to %s; input is echoed back, end with Ctrl-D\n", pod)
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(streams.Out, streams.In)
+		done <- err
+	}()
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-done:
+		return err
+	}
+}
+
+// NewFakeClusterRunner returns a runner answering kubectl from a fresh
+// in-memory cluster, the one --mock uses, for tests of code embedding kpdbug
+func NewFakeClusterRunner() KubectlRunner {
+	return fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}}
+}
+
+// useFakeCluster makes kpdbug run against a fake cluster, kept in the
+// KPDBUG_FAKE_STATE file between invocations when that is set
+func useFakeCluster() {
+	defaultRunner = fakeClusterRunner{cluster: newFakeCluster(os.Getenv("KPDBUG_FAKE_STATE")), local: execRunner{}}
+}
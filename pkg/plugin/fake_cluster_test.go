@@ -0,0 +1,100 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFakeClusterLifecycle(t *testing.T) {
+	config := &DebugConfig{
+		Namespace: "default",
+		Runner:    fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}},
+	}
+
+	create := config.kubectl("create", "-f", "-")
+	create.Stdin = strings.NewReader(`apiVersion: v1
+kind: Pod
+metadata:
+  name: debug-demo
+  labels:
+    debug-tool/type: debug-pod
+spec:
+  containers:
+  - name: debug
+    image: busybox
+`)
+	if output, err := create.CombinedOutput(); err != nil {
+		t.Fatalf("create: %v - %s", err, output)
+	}
+
+	phase, err := config.kubectl("get", "pod", "debug-demo", "-n", "default", "-o", "jsonpath={.status.phase}").Output()
+	if err != nil || string(phase) != "Running" {
+		t.Errorf("get phase = %q, %v", phase, err)
+	}
+	names, err := config.kubectl("get", "pods", "-n", "default", "-l", "debug-tool/type=debug-pod", "-o", "name").Output()
+	if err != nil || strings.TrimSpace(string(names)) != "pod/debug-demo" {
+		t.Errorf("get by label = %q, %v", names, err)
+	}
+
+	if err := config.kubectl("delete", "pod", "debug-demo", "-n", "default").Run(); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	_, err = config.kubectl("get", "pod", "debug-demo", "-n", "default").Output()
+	if code, ok := exitCode(err); !ok || code != 1 {
+		t.Errorf("get deleted pod = %v, want exit code 1", err)
+	}
+}
+
+func TestFakeClusterEphemeralScript(t *testing.T) {
+	config := &DebugConfig{
+		Namespace: "default",
+		Image:     "busybox",
+		Runner:    fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}},
+	}
+	output, err := config.kubectl("debug", "web-6d5f8b7c9-x2k4p", "-n", "default", "-i", "--image=busybox",
+		"--", "sh", "-c", wrapScript("true")).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, code, ok := parseExitMarker(string(output)); !ok || code != 0 {
+		t.Errorf("script output = %q, want a zero exit marker", output)
+	}
+	containers, _ := config.kubectl("get", "pod", "web-6d5f8b7c9-x2k4p", "-n", "default",
+		"-o", "jsonpath={.spec.ephemeralContainers[*].image}").Output()
+	if string(containers) != "busybox" {
+		t.Errorf("ephemeral containers = %q", containers)
+	}
+}
+
+func TestEvalJSONPath(t *testing.T) {
+	obj := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name":   "web",
+			"labels": map[string]interface{}{"app.kubernetes.io/name": "web"},
+		},
+		"spec": map[string]interface{}{
+			"containers": []interface{}{
+				map[string]interface{}{"name": "nginx", "image": "nginx:1.27"},
+				map[string]interface{}{"name": "sidecar", "image": "envoy:1.30"},
+			},
+		},
+	}
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"{.metadata.name}", "web"},
+		{`{.metadata.labels.app\.kubernetes\.io/name}`, "web"},
+		{"{.spec.containers[*].name}", "nginx sidecar"},
+		{"{.spec.containers[1].image}", "envoy:1.30"},
+		{"{.spec.containers[?(@.name=='nginx')].image}", "nginx:1.27"},
+		{"{..image}", "nginx:1.27 envoy:1.30"},
+		{"name={.metadata.name}", "name=web"},
+		{"{.status.phase}", ""},
+	}
+	for _, tt := range tests {
+		if got := evalJSONPath(obj, tt.template); got != tt.want {
+			t.Errorf("evalJSONPath(%s) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	// followInterval is how often --follow checks the target during a session
+	followInterval = 2 * time.Second
+	// followTimeout bounds the wait for a restarted or replacement target
+	followTimeout = 5 * time.Minute
+)
+
+// revisionLabels differ between the replicas of one workload across
+// rollouts and StatefulSet ordinals; replacements are matched without them
+var revisionLabels = map[string]bool{
+	"pod-template-hash":                  true,
+	"controller-revision-hash":           true,
+	"statefulset.kubernetes.io/pod-name": true,
+	"apps.kubernetes.io/pod-index":       true,
+}
+
+// targetIncarnation is one run of the target container: a pod UID and the
+// container's restart count
+type targetIncarnation struct {
+	pod       *corev1.Pod
+	container string
+	restarts  int32
+}
+
+// restartCount returns the restart count of the named container
+func restartCount(pod *corev1.Pod, container string) int32 {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == container {
+			return status.RestartCount
+		}
+	}
+	return 0
+}
+
+// lastTermination returns why the named container last terminated, e.g.
+// OOMKilled
+func lastTermination(pod *corev1.Pod, container string) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == container && status.LastTerminationState.Terminated != nil {
+			return status.LastTerminationState.Terminated.Reason
+		}
+	}
+	return ""
+}
+
+// targetChange describes how the target moved on from the incarnation, or
+// returns "" while it is unchanged; a nil pod means it was deleted
+func targetChange(before targetIncarnation, pod *corev1.Pod) string {
+	switch {
+	case pod == nil:
+		return "was deleted"
+	case pod.UID != before.pod.UID:
+		return "was replaced"
+	case pod.Status.Reason == "Evicted":
+		return "was evicted"
+	case pod.DeletionTimestamp != nil:
+		return "is terminating"
+	case pod.Status.Phase == corev1.PodFailed || pod.Status.Phase == corev1.PodSucceeded:
+		return fmt.Sprintf("has %s", pod.Status.Phase)
+	case restartCount(pod, before.container) > before.restarts:
+		if reason := lastTermination(pod, before.container); reason != "" {
+			return fmt.Sprintf("restarted container %s (%s)", before.container, reason)
+		}
+		return fmt.Sprintf("restarted container %s", before.container)
+	}
+	return ""
+}
+
+// lookupTarget fetches the target pod, or nil when it does not exist
+func (config *DebugConfig) lookupTarget() (*corev1.Pod, error) {
+	output, err := outputWithRetry(config.context(), func() *runnerCommand {
+		return config.kubectl("get", "pod", config.PodName, "-n", config.Namespace, "-o", "json", "--ignore-not-found")
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting pod info: %v", err)
+	}
+	if len(output) == 0 {
+		return nil, nil
+	}
+	var pod corev1.Pod
+	if err := json.Unmarshal(output, &pod); err != nil {
+		return nil, fmt.Errorf("error parsing pod JSON: %v", err)
+	}
+	return &pod, nil
+}
+
+// watchTarget polls the target until it changes or done is closed, and
+// returns the change
+func (config *DebugConfig) watchTarget(before targetIncarnation, done <-chan struct{}) string {
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return ""
+		case <-config.context().Done():
+			return ""
+		case <-ticker.C:
+		}
+		pod, err := config.lookupTarget()
+		if err != nil {
+			continue
+		}
+		if change := targetChange(before, pod); change != "" {
+			return change
+		}
+	}
+}
+
+// isReplacement reports whether pod could replace the target: the same
+// controller and labels, or the same name as a StatefulSet pod gets
+func isReplacement(before, pod *corev1.Pod) bool {
+	if pod.UID == before.UID || pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	if pod.Name == before.Name {
+		return true
+	}
+	owner, candidate := metav1.GetControllerOf(before), metav1.GetControllerOf(pod)
+	if owner == nil || candidate == nil || owner.Kind != candidate.Kind {
+		return false
+	}
+	if owner.Name == candidate.Name {
+		return true
+	}
+	// A rollout replaces the ReplicaSet; its pods keep the other labels
+	if owner.Kind != "ReplicaSet" {
+		return false
+	}
+	matched := 0
+	for key, value := range before.Labels {
+		if revisionLabels[key] {
+			continue
+		}
+		if pod.Labels[key] != value {
+			return false
+		}
+		matched++
+	}
+	return matched > 0
+}
+
+// containerRunning reports whether the named container is running
+func containerRunning(pod *corev1.Pod, container string) bool {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == container {
+			return status.State.Running != nil
+		}
+	}
+	return false
+}
+
+// awaitTarget waits for the target container to run again, in the same pod
+// after a restart or in the newest replacement pod, and returns that pod
+func (config *DebugConfig) awaitTarget(before targetIncarnation) (string, error) {
+	deadline := time.Now().Add(followTimeout)
+	for time.Now().Before(deadline) {
+		pod, err := config.lookupTarget()
+		if err == nil && pod != nil && pod.UID == before.pod.UID && pod.DeletionTimestamp == nil &&
+			pod.Status.Phase == corev1.PodRunning && containerRunning(pod, before.container) {
+			return pod.Name, nil
+		}
+
+		var podList corev1.PodList
+		output, err := config.kubectl("get", "pods", "-n", config.Namespace, "-o", "json").Output()
+		if err == nil && json.Unmarshal(output, &podList) == nil {
+			var candidates []corev1.Pod
+			for _, candidate := range podList.Items {
+				if isReplacement(before.pod, &candidate) && containerRunning(&candidate, before.container) {
+					candidates = append(candidates, candidate)
+				}
+			}
+			if len(candidates) > 0 {
+				sort.Slice(candidates, func(i, j int) bool {
+					return candidates[j].CreationTimestamp.Before(&candidates[i].CreationTimestamp)
+				})
+				return candidates[0].Name, nil
+			}
+		}
+
+		select {
+		case <-config.context().Done():
+			return "", config.context().Err()
+		case <-time.After(followInterval):
+		}
+	}
+	return "", NewDetailedError(ErrorTypePodNotFound,
+		fmt.Sprintf("no replacement for pod %s ran container %s within %s", before.pod.Name, before.container, followTimeout)).
+		WithCommand(fmt.Sprintf("kubectl get pods -n %s", config.Namespace))
+}
+
+// executeFollow runs ephemeral container sessions against the target and,
+// when it restarts, is evicted or is replaced, ends the session, waits for
+// the target container to run again and attaches a new debug container.
+// It returns once a session ends with the target unchanged.
+func (config *DebugConfig) executeFollow() error {
+	for {
+		container, err := config.getTargetContainerName()
+		if err != nil {
+			return WrapKubectlError(err, "get target container name")
+		}
+		pod, err := config.lookupTarget()
+		if err != nil {
+			return WrapKubectlError(err, "get target pod")
+		}
+		if pod == nil {
+			return NewPodNotFoundError(config.PodName, config.Namespace)
+		}
+		before := targetIncarnation{pod: pod, container: container, restarts: restartCount(pod, container)}
+
+		done := make(chan struct{})
+		stop := make(chan struct{})
+		var change string
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if change = config.watchTarget(before, done); change != "" {
+				close(stop)
+			}
+		}()
+		config.stopSession = stop
+		sessionErr := config.executeAddContainer()
+		close(done)
+		wg.Wait()
+		config.stopSession = nil
+
+		// kubectl also ends the session itself when the pod goes away
+		if change == "" {
+			if pod, err := config.lookupTarget(); err == nil {
+				change = targetChange(before, pod)
+			}
+		}
+		if change == "" || config.context().Err() != nil {
+			return sessionErr
+		}
+
+		config.logf("Target pod %s %s; waiting for container %s to run again...", config.PodName, change, container)
+		next, err := config.awaitTarget(before)
+		if err != nil {
+			return err
+		}
+		if next != config.PodName {
+			config.logf("Following the target to pod %s", next)
+		}
+		config.PodName = next
+	}
+}
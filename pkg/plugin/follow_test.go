@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestTargetChange(t *testing.T) {
+	pod := func(uid string, restarts int32) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-1", UID: types.UID(uid)},
+			Status: corev1.PodStatus{
+				Phase:             corev1.PodRunning,
+				ContainerStatuses: []corev1.ContainerStatus{{Name: "app", RestartCount: restarts}},
+			},
+		}
+	}
+	before := targetIncarnation{pod: pod("a", 1), container: "app", restarts: 1}
+
+	oomKilled := pod("a", 2)
+	oomKilled.Status.ContainerStatuses[0].LastTerminationState.Terminated = &corev1.ContainerStateTerminated{Reason: "OOMKilled"}
+	evicted := pod("a", 1)
+	evicted.Status.Phase, evicted.Status.Reason = corev1.PodFailed, "Evicted"
+
+	tests := []struct {
+		pod  *corev1.Pod
+		want string
+	}{
+		{pod("a", 1), ""},
+		{nil, "was deleted"},
+		{pod("b", 0), "was replaced"},
+		{oomKilled, "restarted container app (OOMKilled)"},
+		{evicted, "was evicted"},
+	}
+	for _, tt := range tests {
+		if got := targetChange(before, tt.pod); got != tt.want {
+			t.Errorf("targetChange() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestIsReplacement(t *testing.T) {
+	controller := true
+	pod := func(name, uid, owner string, labels map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name, UID: types.UID(uid), Labels: labels,
+				OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: owner, Controller: &controller}},
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+	before := pod("web-6d5f-abcde", "a", "web-6d5f", map[string]string{"app": "web", "pod-template-hash": "6d5f"})
+
+	tests := []struct {
+		name string
+		pod  *corev1.Pod
+		want bool
+	}{
+		{"same ReplicaSet", pod("web-6d5f-fghij", "b", "web-6d5f", map[string]string{"app": "web"}), true},
+		{"after a rollout", pod("web-7c8d-klmno", "c", "web-7c8d", map[string]string{"app": "web", "pod-template-hash": "7c8d"}), true},
+		{"other workload", pod("api-7c8d-klmno", "d", "api-7c8d", map[string]string{"app": "api"}), false},
+		{"the old pod", before, false},
+	}
+	for _, tt := range tests {
+		if got := isReplacement(before, tt.pod); got != tt.want {
+			t.Errorf("isReplacement(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// defaultGRPCPort is dialled when the target container declares no gRPC port
+const defaultGRPCPort = 50051
+
+var (
+	grpcAddr      string
+	grpcData      string
+	grpcHeaders   []string
+	grpcCertDir   string
+	grpcPlaintext bool
+	grpcInsecure  bool
+)
+
+var grpcCmd = &cobra.Command{
+	Use:   "grpc",
+	Short: "Call gRPC services with grpcurl from the network namespace of a pod",
+	Long: `Run grpcurl in an ephemeral debug container of the target pod, so gRPC-only
+services can be listed and called without writing a client. Services are
+discovered through server reflection.
+
+The address defaults to the target container's port named grpc, or its
+first TCP port, on localhost. When the target container mounts a
+certificate directory with tls.crt and tls.key (the layout of
+kubernetes.io/tls Secrets and cert-manager), grpcurl presents them as client
+certificate and verifies the server with the ca.crt next to them; otherwise
+the connection is plaintext.`,
+	Example: `  kpdbug grpc -p mypod list
+  kpdbug grpc -p mypod list orders.v1.Orders --addr orders.shop.svc:9090
+  kpdbug grpc -p mypod call orders.v1.Orders/Get -d '{"id": "42"}'
+  kpdbug grpc -p mypod call grpc.health.v1.Health/Check --plaintext`,
+}
+
+var grpcListCmd = &cobra.Command{
+	Use:   "list [service]",
+	Short: "List the services, or the methods of a service",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runGRPC(cmd, append([]string{"list"}, args...))
+	},
+}
+
+var grpcDescribeCmd = &cobra.Command{
+	Use:   "describe <symbol>",
+	Short: "Describe a service, method or message",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runGRPC(cmd, []string{"describe", args[0]})
+	},
+}
+
+var grpcCallCmd = &cobra.Command{
+	Use:   "call <service/method>",
+	Short: "Call a method with a JSON request",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runGRPC(cmd, []string{args[0]})
+	},
+}
+
+func init() {
+	grpcCmd.PersistentFlags().StringVar(&grpcAddr, "addr", "", "host:port of the gRPC server (default the target container's gRPC port on localhost)")
+	grpcCmd.PersistentFlags().StringArrayVar(&grpcHeaders, "header", nil, "request metadata as 'name: value' (repeatable)")
+	grpcCmd.PersistentFlags().StringVar(&grpcCertDir, "cert-dir", "", "directory in the target container with tls.crt, tls.key and ca.crt (default auto-detected from its mounts)")
+	grpcCmd.PersistentFlags().BoolVar(&grpcPlaintext, "plaintext", false, "connect without TLS even if certificates are mounted")
+	grpcCmd.PersistentFlags().BoolVar(&grpcInsecure, "insecure", false, "skip verification of the server certificate")
+	grpcCallCmd.Flags().StringVarP(&grpcData, "data", "d", "{}", "request message as JSON")
+
+	grpcCmd.AddCommand(grpcListCmd, grpcDescribeCmd, grpcCallCmd)
+	rootCmd.AddCommand(grpcCmd)
+}
+
+// grpcRequest is a grpcurl invocation run from the pod
+type grpcRequest struct {
+	Addr      string
+	Verb      []string
+	Data      string
+	Headers   []string
+	CertDir   string
+	Plaintext bool
+	Insecure  bool
+}
+
+// grpcCertsScript sets $certdir to the first mounted directory of the target
+// container holding tls.crt and tls.key
+const grpcCertsScript = targetMountsScript + `  [ "$mp" = / ] && continue
+  for crt in $(find "$root$mp" -maxdepth 3 -name tls.crt 2>/dev/null); do
+    case "$crt" in */..*) continue;; esac
+    if [ -f "${crt%/tls.crt}/tls.key" ]; then certdir=${crt%/tls.crt}; break; fi
+  done
+  [ -n "$certdir" ] && break
+done < /proc/$pid/mounts
+`
+
+// grpcScript runs grpcurl with the target's client certificates, printing
+// CERTS|<dir> first when they are used
+func grpcScript(req grpcRequest) string {
+	var b strings.Builder
+	b.WriteString("certdir=\n")
+	switch {
+	case req.Plaintext:
+		b.WriteString(targetPIDScript)
+	case req.CertDir != "":
+		b.WriteString(targetPIDScript)
+		fmt.Fprintf(&b, "certdir=\"$root\"%s\n", shellQuote(strings.TrimSuffix(req.CertDir, "/")))
+	default:
+		b.WriteString(grpcCertsScript)
+	}
+
+	b.WriteString(`if [ -n "$certdir" ]; then
+  echo "CERTS|${certdir#$root}"
+  set -- -cert "$certdir/tls.crt" -key "$certdir/tls.key"
+  if [ -f "$certdir/ca.crt" ]; then set -- "$@" -cacert "$certdir/ca.crt"; fi
+else
+  set -- -plaintext
+fi
+`)
+
+	args := []string{`"$@"`}
+	if req.Insecure {
+		args = append(args, "-insecure")
+	}
+	for _, header := range req.Headers {
+		args = append(args, "-H", shellQuote(header))
+	}
+	if req.Verb[0] != "list" && req.Verb[0] != "describe" {
+		args = append(args, "-d", shellQuote(req.Data))
+	}
+	args = append(args, shellQuote(req.Addr))
+	for _, arg := range req.Verb {
+		args = append(args, shellQuote(arg))
+	}
+	fmt.Fprintf(&b, "grpcurl %s 2>&1", strings.Join(args, " "))
+	return b.String()
+}
+
+// grpcPort returns the port of container serving gRPC: the port named grpc
+// (or grpc-*), otherwise the first TCP port
+func grpcPort(container *corev1.Container) int32 {
+	var first int32
+	for _, port := range container.Ports {
+		if port.Protocol != "" && port.Protocol != corev1.ProtocolTCP {
+			continue
+		}
+		if port.Name == "grpc" || strings.HasPrefix(port.Name, "grpc-") {
+			return port.ContainerPort
+		}
+		if first == 0 {
+			first = port.ContainerPort
+		}
+	}
+	if first == 0 {
+		return defaultGRPCPort
+	}
+	return first
+}
+
+func runGRPC(cmd *cobra.Command, verb []string) error {
+	config, err := newTargetConfig(cmd.Context(), cmd, defaultNetImage, "general")
+	if err != nil {
+		return err
+	}
+
+	addr := grpcAddr
+	if addr == "" {
+		containerName, err := config.getTargetContainerName()
+		if err != nil {
+			return WrapKubectlError(err, "get target container name")
+		}
+		port := int32(defaultGRPCPort)
+		if pod, err := config.getPod(config.PodName, config.Namespace); err == nil {
+			if container := findContainer(pod, containerName); container != nil {
+				port = grpcPort(container)
+			}
+		}
+		addr = "localhost:" + strconv.Itoa(int(port))
+	}
+
+	req := grpcRequest{
+		Addr:      addr,
+		Verb:      verb,
+		Data:      grpcData,
+		Headers:   grpcHeaders,
+		CertDir:   grpcCertDir,
+		Plaintext: grpcPlaintext,
+		Insecure:  grpcInsecure,
+	}
+	log.Printf("Running grpcurl against %s from pod %s...", addr, config.PodName)
+	result, err := config.runEphemeralScript(config.PodName, grpcScript(req))
+	if err != nil {
+		return err
+	}
+
+	output := result.Output
+	if first, rest, found := strings.Cut(output, "\n"); found && strings.HasPrefix(first, "CERTS|") {
+		log.Printf("Using client certificates from %s", strings.TrimPrefix(first, "CERTS|"))
+		output = rest
+	} else if !grpcPlaintext {
+		log.Printf("No client certificates mounted, connecting in plaintext")
+	}
+	fmt.Print(output)
+
+	if result.ExitCode != 0 {
+		return &ExitCodeError{Code: result.ExitCode}
+	}
+	return nil
+}
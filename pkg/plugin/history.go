@@ -0,0 +1,310 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// HistoryEntry is one recorded kpdbug invocation
+type HistoryEntry struct {
+	ID        int       `json:"id"`
+	Time      time.Time `json:"time"`
+	Args      []string  `json:"args"`
+	Namespace string    `json:"namespace,omitempty"`
+	Target    string    `json:"target,omitempty"`
+	Outcome   string    `json:"outcome"`
+	ExitCode  int       `json:"exitCode"`
+	Duration  string    `json:"duration"`
+}
+
+// unrecordedCommands are never written to the history
+var unrecordedCommands = map[string]bool{
+	"history":          true,
+	"rerun":            true,
+	"help":             true,
+	"completion":       true,
+	"install":          true,
+	"version":          true,
+	"__complete":       true,
+	"__completeNoDesc": true,
+}
+
+var (
+	historyLimit int
+
+	historyOnce    sync.Once
+	historyStart   time.Time
+	historyArgs    []string
+	historyCommand *cobra.Command
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List previous kpdbug invocations",
+	Long: `List the kpdbug invocations recorded in the local history file, with their
+flags, target, outcome and duration. Repeat one with 'kpdbug rerun <id>'.
+The history is stored in $KPDBUG_HISTORY or <user config dir>/kpdbug/history.jsonl.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runHistory()
+	},
+}
+
+var rerunCmd = &cobra.Command{
+	Use:   "rerun <id>",
+	Short: "Repeat a previous kpdbug invocation from the history",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runRerun(args[0])
+	},
+}
+
+func init() {
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "l", 20, "number of most recent entries to show (0 for all)")
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(rerunCmd)
+}
+
+// startHistory remembers the invocation, without the values of the secret
+// flags; it is written by finishHistory
+func startHistory(args []string) {
+	historyStart = clock()
+	historyArgs = redactSecrets(args)
+}
+
+// finishHistory appends the invocation and its outcome to the history file,
+// once, for commands that got past flag parsing. Failures are ignored so the
+// history never gets in the way of debugging.
+func finishHistory(err error) {
+	historyOnce.Do(func() {
+		if historyCommand == nil || unrecordedCommands[historyCommand.Name()] {
+			return
+		}
+
+		entry := HistoryEntry{
+			Time:      historyStart.UTC(),
+			Args:      historyArgs,
+			Namespace: namespace,
+			Target:    podName,
+			Outcome:   "ok",
+			Duration:  since(historyStart).Round(time.Millisecond).String(),
+		}
+		var exitCodeErr *ExitCodeError
+		switch {
+		case errors.As(err, &exitCodeErr):
+			entry.Outcome = "exit"
+			entry.ExitCode = exitCodeErr.Code
+		case err != nil:
+			entry.Outcome = "error"
+			entry.ExitCode = 1
+		}
+
+		_ = appendHistory(entry)
+	})
+}
+
+// historyFilePath resolves the history file from $KPDBUG_HISTORY or the
+// per-user config directory
+func historyFilePath() (string, error) {
+	if path := os.Getenv("KPDBUG_HISTORY"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "kpdbug", "history.jsonl"), nil
+}
+
+// appendHistory assigns the next ID to entry and appends it to the file
+func appendHistory(entry HistoryEntry) error {
+	path, err := historyFilePath()
+	if err != nil {
+		return err
+	}
+
+	entries, err := readHistory(path)
+	if err != nil {
+		return err
+	}
+	entry.ID = 1
+	if len(entries) > 0 {
+		entry.ID = entries[len(entries)-1].ID + 1
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	_, err = fmt.Fprintf(file, "%s\n", data)
+	return err
+}
+
+// readHistory loads the history file; a missing file is empty and
+// unreadable lines are skipped
+func readHistory(path string) ([]HistoryEntry, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading history file %s: %v", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry HistoryEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+func runHistory() error {
+	path, err := historyFilePath()
+	if err != nil {
+		return err
+	}
+	entries, err := readHistory(path)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("No history recorded yet")
+		return nil
+	}
+	if historyLimit > 0 && len(entries) > historyLimit {
+		entries = entries[len(entries)-historyLimit:]
+	}
+
+	fmt.Printf("%-5s %-20s %-10s %-8s %s\n", "ID", "TIME", "DURATION", "OUTCOME", "COMMAND")
+	for _, entry := range entries {
+		fmt.Printf("%-5d %-20s %-10s %-8s %s\n",
+			entry.ID,
+			entry.Time.Local().Format("2006-01-02 15:04:05"),
+			entry.Duration,
+			entry.outcome(),
+			entry.commandLine())
+	}
+	return nil
+}
+
+func (e HistoryEntry) outcome() string {
+	if e.Outcome == "exit" {
+		return fmt.Sprintf("exit %d", e.ExitCode)
+	}
+	return e.Outcome
+}
+
+// commandLine renders the recorded arguments as a copyable command line;
+// entries written before secrets were redacted are redacted here
+func (e HistoryEntry) commandLine() string {
+	parts := []string{"kpdbug"}
+	for _, arg := range redactSecrets(e.Args) {
+		if arg == "" || strings.ContainsAny(arg, " \t\n'\"$`\\|&;<>()*?!") {
+			arg = shellQuote(arg)
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+func runRerun(idArg string) error {
+	id, err := strconv.Atoi(idArg)
+	if err != nil {
+		return NewValidationError("id", idArg, "must be a history ID").
+			WithCommand("kpdbug history")
+	}
+
+	path, err := historyFilePath()
+	if err != nil {
+		return err
+	}
+	entries, err := readHistory(path)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.ID != id {
+			continue
+		}
+
+		self, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("error locating the kpdbug binary: %v", err)
+		}
+		args, err := restoreSecrets(entry)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Re-running: %s\n", entry.commandLine())
+
+		// The child records its own history entry
+		cmd := newRunnerCommand(context.Background(), defaultRunner, self, args...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			if code, ok := exitCode(err); ok {
+				return &ExitCodeError{Code: code}
+			}
+			return fmt.Errorf("error re-running history entry %d: %v", id, err)
+		}
+		return nil
+	}
+
+	return NewValidationError("id", idArg, "no such history entry").
+		WithCommand("kpdbug history")
+}
+
+// restoreSecrets fills the redacted secret flags of a history entry in from
+// the flags of the rerun, which fails when one of them is not given again
+func restoreSecrets(entry HistoryEntry) ([]string, error) {
+	current := map[string]string{"--token": kubeToken, "--client-key": clientKey}
+	var missing []string
+	args := replaceSecrets(entry.Args, func(flag, value string) string {
+		if value != redacted {
+			return value
+		}
+		if current[flag] == "" {
+			missing = append(missing, flag)
+		}
+		return current[flag]
+	})
+	if len(missing) > 0 {
+		id := strconv.Itoa(entry.ID)
+		reason := "the history does not record the value of " + strings.Join(missing, ", ")
+		return nil, NewValidationError("id", id, reason).
+			WithSuggestion("Pass --token or --client-key to kpdbug rerun " + id + " again, or run the command line with the values filled in").
+			WithCommand(entry.commandLine())
+	}
+	return args, nil
+}
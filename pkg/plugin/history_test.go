@@ -0,0 +1,63 @@
+package plugin
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	t.Setenv("KPDBUG_HISTORY", t.TempDir()+"/history.jsonl")
+
+	for _, args := range [][]string{{"-p", "web", "-it"}, {"-p", "db", "--command", "psql -c 'select 1'"}} {
+		if err := appendHistory(HistoryEntry{Args: args, Outcome: "ok"}); err != nil {
+			t.Fatalf("appendHistory() error = %v", err)
+		}
+	}
+
+	path, _ := historyFilePath()
+	entries, err := readHistory(path)
+	if err != nil {
+		t.Fatalf("readHistory() error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].ID != 1 || entries[1].ID != 2 {
+		t.Fatalf("readHistory() = %+v, want IDs 1 and 2", entries)
+	}
+
+	want := `kpdbug -p db --command 'psql -c '\''select 1'\'''`
+	if got := entries[1].commandLine(); got != want {
+		t.Errorf("commandLine() = %s, want %s", got, want)
+	}
+}
+
+func TestHistoryRedactsSecrets(t *testing.T) {
+	defer func(args []string, token, key string) {
+		historyArgs, kubeToken, clientKey = args, token, key
+	}(historyArgs, kubeToken, clientKey)
+	kubeToken, clientKey = "", ""
+
+	startHistory([]string{"--token=s3cr3t", "-p", "web", "--client-key", "/etc/client.key"})
+	want := []string{"--token=REDACTED", "-p", "web", "--client-key", "REDACTED"}
+	if !reflect.DeepEqual(historyArgs, want) {
+		t.Errorf("historyArgs = %q, want %q", historyArgs, want)
+	}
+
+	// Entries recorded before the redaction are not shown in clear text
+	old := HistoryEntry{ID: 3, Args: []string{"--token", "s3cr3t", "-p", "web"}}
+	if got := old.commandLine(); got != "kpdbug --token REDACTED -p web" {
+		t.Errorf("commandLine() = %s, want the token redacted", got)
+	}
+
+	// A rerun needs the credentials again
+	entry := HistoryEntry{ID: 4, Args: want}
+	var detailed *DetailedError
+	if _, err := restoreSecrets(entry); !errors.As(err, &detailed) || !strings.Contains(detailed.Message, "--token, --client-key") {
+		t.Errorf("restoreSecrets() = %v, want the missing flags named", err)
+	}
+	kubeToken, clientKey = "n3w", "/etc/other.key"
+	args, err := restoreSecrets(entry)
+	if restored := []string{"--token=n3w", "-p", "web", "--client-key", "/etc/other.key"}; err != nil || !reflect.DeepEqual(args, restored) {
+		t.Errorf("restoreSecrets() = %q, %v, want %q", args, err, restored)
+	}
+}
@@ -0,0 +1,220 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	httpExpectStatus int
+	httpExpectBody   string
+	httpHeaders      []string
+	httpData         string
+	httpTimeout      time.Duration
+	httpOutput       string
+)
+
+var httpCmd = &cobra.Command{
+	Use:   "http [method] <url>",
+	Short: "Run an HTTP check from the network namespace of the target pod",
+	Long: `Add an ephemeral debug container to the target pod and send an HTTP request
+from its network namespace, so Service names, NetworkPolicies and egress
+rules apply exactly as they do to the application. The response is checked
+against the expectations and reported as a table or as JSON.
+
+Without --expect-status any status below 400 passes. kpdbug exits with 1
+when a check fails, so smoke checks can be scripted.`,
+	Example: `  kpdbug http -p mypod http://dep-svc/health
+  kpdbug http -p mypod GET http://dep-svc/health --expect-status 200 --expect-body ok
+  kpdbug http -p mypod POST http://api/v1/echo --header 'Content-Type: application/json' --data '{"ping":1}' -o json`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		method, url := "GET", args[0]
+		if len(args) == 2 {
+			method, url = strings.ToUpper(args[0]), args[1]
+		}
+		return runHTTPCheck(cmd, method, url)
+	},
+}
+
+func init() {
+	httpCmd.Flags().IntVar(&httpExpectStatus, "expect-status", 0, "expected HTTP status code (default any status below 400)")
+	httpCmd.Flags().StringVar(&httpExpectBody, "expect-body", "", "text the response body must contain")
+	httpCmd.Flags().StringArrayVar(&httpHeaders, "header", nil, "request header as 'Name: value' (repeatable)")
+	httpCmd.Flags().StringVar(&httpData, "data", "", "request body")
+	httpCmd.Flags().DurationVar(&httpTimeout, "timeout", 10*time.Second, "request timeout")
+	httpCmd.Flags().StringVarP(&httpOutput, "output", "o", "table", "output format (table, json)")
+	rootCmd.AddCommand(httpCmd)
+}
+
+// httpBodyLimit bounds the response body read back from the pod
+const httpBodyLimit = 64 * 1024
+
+// httpRequest is an HTTP check to run from the pod
+type httpRequest struct {
+	Method  string
+	URL     string
+	Headers []string
+	Data    string
+	Timeout time.Duration
+}
+
+// httpAssertion is one checked expectation
+type httpAssertion struct {
+	Name     string `json:"name"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Passed   bool   `json:"passed"`
+}
+
+// httpCheckResult is the outcome of an HTTP check
+type httpCheckResult struct {
+	Pod        string          `json:"pod"`
+	Method     string          `json:"method"`
+	URL        string          `json:"url"`
+	Status     int             `json:"status,omitempty"`
+	Seconds    float64         `json:"seconds,omitempty"`
+	RemoteIP   string          `json:"remoteIP,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Body       string          `json:"body,omitempty"`
+	Assertions []httpAssertion `json:"assertions"`
+	Passed     bool            `json:"passed"`
+}
+
+// httpScript runs the request with curl and prints an HTTP|status|time|ip
+// or HTTPERR|code|message line, then HTTPBODY followed by the body
+func httpScript(req httpRequest) string {
+	args := []string{"-sS", "-o", `"$body"`, "-w", shellQuote("%{http_code}|%{time_total}|%{remote_ip}"),
+		"-X", shellQuote(req.Method), "--max-time", strconv.Itoa(int(req.Timeout.Seconds()))}
+	for _, header := range req.Headers {
+		args = append(args, "-H", shellQuote(header))
+	}
+	if req.Data != "" {
+		args = append(args, "--data-raw", shellQuote(req.Data))
+	}
+	args = append(args, shellQuote(req.URL))
+
+	return fmt.Sprintf(`body=$(mktemp); err=$(mktemp)
+if meta=$(curl %s 2>"$err"); then
+  echo "HTTP|$meta"
+else
+  echo "HTTPERR|$?|$(tr '\n' ' ' < "$err")"
+fi
+echo HTTPBODY
+head -c %d "$body"
+rm -f "$body" "$err"`, strings.Join(args, " "), httpBodyLimit)
+}
+
+// parseHTTPOutput fills the response fields of result from httpScript output
+func parseHTTPOutput(output string, result *httpCheckResult) {
+	meta, body, _ := strings.Cut(output, "HTTPBODY\n")
+	result.Body = body
+	for _, line := range strings.Split(meta, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), "|", 4)
+		switch {
+		case fields[0] == "HTTP" && len(fields) == 4:
+			result.Status, _ = strconv.Atoi(fields[1])
+			result.Seconds, _ = strconv.ParseFloat(fields[2], 64)
+			result.RemoteIP = fields[3]
+		case fields[0] == "HTTPERR" && len(fields) >= 3:
+			result.Error = strings.TrimSpace(fields[2])
+			if result.Error == "" {
+				result.Error = "curl exited with code " + fields[1]
+			}
+		}
+	}
+	if result.Status == 0 && result.Error == "" {
+		result.Error = "no response"
+	}
+}
+
+// checkHTTPResult evaluates the expectations against the response
+func checkHTTPResult(result *httpCheckResult, expectStatus int, expectBody string) {
+	status := httpAssertion{Name: "status", Expected: "< 400", Actual: strconv.Itoa(result.Status)}
+	if result.Error != "" {
+		status.Actual = "-"
+	}
+	if expectStatus != 0 {
+		status.Expected = strconv.Itoa(expectStatus)
+		status.Passed = result.Status == expectStatus
+	} else {
+		status.Passed = result.Status > 0 && result.Status < 400
+	}
+	result.Assertions = []httpAssertion{status}
+
+	if expectBody != "" {
+		body := httpAssertion{Name: "body contains", Expected: expectBody, Actual: "not found"}
+		if strings.Contains(result.Body, expectBody) {
+			body.Actual, body.Passed = "found", true
+		}
+		result.Assertions = append(result.Assertions, body)
+	}
+
+	result.Passed = result.Error == ""
+	for _, assertion := range result.Assertions {
+		result.Passed = result.Passed && assertion.Passed
+	}
+}
+
+func runHTTPCheck(cmd *cobra.Command, method, url string) error {
+	if httpOutput != "table" && httpOutput != "json" {
+		return NewValidationError("output", httpOutput, "must be one of: table, json")
+	}
+	config, err := newTargetConfig(cmd.Context(), cmd, defaultNetImage, "general")
+	if err != nil {
+		return err
+	}
+
+	req := httpRequest{Method: method, URL: url, Headers: httpHeaders, Data: httpData, Timeout: httpTimeout}
+	log.Printf("Sending %s %s from pod %s...", method, url, config.PodName)
+	script, err := config.runEphemeralScript(config.PodName, httpScript(req))
+	if err != nil {
+		return err
+	}
+
+	result := &httpCheckResult{Pod: config.PodName, Method: method, URL: url}
+	parseHTTPOutput(script.Output, result)
+	checkHTTPResult(result, httpExpectStatus, httpExpectBody)
+
+	if httpOutput == "json" {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error generating JSON: %v", err)
+		}
+		fmt.Println(string(data))
+	} else {
+		printHTTPResult(result)
+	}
+
+	if !result.Passed {
+		return &ExitCodeError{Code: 1}
+	}
+	return nil
+}
+
+// printHTTPResult renders the check as a table
+func printHTTPResult(result *httpCheckResult) {
+	if result.Error != "" {
+		fmt.Printf("%s %s from pod %s failed: %s\n\n", result.Method, result.URL, result.Pod, result.Error)
+	} else {
+		fmt.Printf("%s %s from pod %s: %d in %.3fs (%s)\n\n", result.Method, result.URL, result.Pod, result.Status, result.Seconds, result.RemoteIP)
+	}
+
+	fmt.Printf("%-16s %-24s %-24s %s\n", "CHECK", "EXPECTED", "ACTUAL", "RESULT")
+	for _, a := range result.Assertions {
+		outcome := "PASS"
+		if !a.Passed {
+			outcome = "FAIL"
+		}
+		fmt.Printf("%-16s %-24s %-24s %s\n", a.Name, truncateString(a.Expected, 24), truncateString(a.Actual, 24), outcome)
+	}
+	if !result.Passed && result.Body != "" {
+		fmt.Printf("\nResponse body:\n%s\n", truncateString(strings.TrimSpace(result.Body), 500))
+	}
+}
@@ -0,0 +1,41 @@
+package plugin
+
+import (
+	"strings"
+	"sync"
+)
+
+// createdByAnnotation records who created a debug pod; annotations allow
+// the full username, such as an email address or service account
+const createdByAnnotation = "debug-tool/created-by"
+
+// userLookup caches the username of the configs sharing it
+type userLookup struct {
+	once sync.Once
+	user string
+}
+
+// flagUser is shared by the configs of the command line, which all reach
+// the cluster with the global kubectl flags
+var flagUser = &userLookup{}
+
+// currentUser returns the username the API server authenticates the
+// config's kubectl as, honoring --as, or "" when it cannot be determined
+// (kubectl auth whoami needs Kubernetes 1.27 or later). It is looked up
+// once per Execute, or once for the command line.
+func (config *DebugConfig) currentUser() string {
+	lookup := func() string {
+		output, err := config.kubectl("auth", "whoami", "-o", "jsonpath={.status.userInfo.username}").Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(output))
+	}
+	if config.users == nil {
+		return lookup()
+	}
+	config.users.once.Do(func() {
+		config.users.user = lookup()
+	})
+	return config.users.user
+}
@@ -0,0 +1,32 @@
+package plugin
+
+import "testing"
+
+func TestCurrentUserPerConfig(t *testing.T) {
+	whoami := "kubectl auth whoami -o jsonpath={.status.userInfo.username} "
+	alice := &fakeRunner{outputs: map[string]string{whoami + "--as=alice": "alice\n"}}
+	bob := &fakeRunner{outputs: map[string]string{whoami + "--as=bob": "bob"}}
+	configs := []*DebugConfig{
+		{KubectlFlags: []string{"--as=alice"}, Runner: alice, users: &userLookup{}},
+		{KubectlFlags: []string{"--as=bob"}, Runner: bob, users: &userLookup{}},
+	}
+
+	for i, want := range []string{"alice", "bob"} {
+		for range 2 {
+			if user := configs[i].currentUser(); user != want {
+				t.Errorf("currentUser() = %q, want %q", user, want)
+			}
+		}
+	}
+	// Each config looks its user up once, with its own runner and flags
+	if len(alice.calls) != 1 || len(bob.calls) != 1 {
+		t.Errorf("calls = %q and %q, want one lookup each", alice.calls, bob.calls)
+	}
+
+	// Without a cache every call looks the user up
+	config := &DebugConfig{KubectlFlags: []string{"--as=alice"}, Runner: alice}
+	config.currentUser()
+	if user := config.currentUser(); user != "alice" || len(alice.calls) != 3 {
+		t.Errorf("currentUser() = %q after %d calls, want alice after 3", user, len(alice.calls))
+	}
+}
@@ -0,0 +1,233 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ImageVerification checks debug images before elevated debug pods are
+// created; kpdbug verifies with every check that is configured
+type ImageVerification struct {
+	// Required refuses elevated sessions whose image fails or cannot be
+	// verified instead of warning, for regulated clusters
+	Required bool `json:"required,omitempty"`
+	// CosignKey is the key (file, KMS URI or k8s://ns/secret) passed to
+	// cosign verify --key
+	CosignKey string `json:"cosignKey,omitempty"`
+	// CertificateIdentity and CertificateOIDCIssuer verify keyless cosign
+	// signatures instead of a key
+	CertificateIdentity   string `json:"certificateIdentity,omitempty"`
+	CertificateOIDCIssuer string `json:"certificateOIDCIssuer,omitempty"`
+	// Scanner is "trivy" to scan with the local trivy CLI, or the URL of a
+	// scanner endpoint receiving {"image", "severity"} and answering
+	// {"allowed", "reason"}
+	Scanner string `json:"scanner,omitempty"`
+	// Severity lists the vulnerability severities that fail a scan,
+	// default CRITICAL
+	Severity string `json:"severity,omitempty"`
+}
+
+// elevatedProfiles are the profiles whose images are verified
+var elevatedProfiles = map[string]bool{
+	"netadmin":   true,
+	"sysadmin":   true,
+	ebpfProfile:  true,
+	"privileged": true,
+}
+
+// scannerTimeout bounds the call to a scanner endpoint
+const scannerTimeout = 2 * time.Minute
+
+var (
+	verifiedImagesMu sync.Mutex
+	verifiedImages   = map[string]error{}
+)
+
+// configured reports whether any check is set up
+func (v *ImageVerification) configured() bool {
+	return v.CosignKey != "" || v.CertificateIdentity != "" || v.Scanner != ""
+}
+
+func (v *ImageVerification) severity() string {
+	if v.Severity == "" {
+		return "CRITICAL"
+	}
+	return strings.ToUpper(v.Severity)
+}
+
+// verifyImage verifies the debug image when --verify-image is set or the
+// session is elevated and verification is configured. Failures are errors
+// with --verify-image or a required verification, and warnings otherwise.
+// Results are cached per image, so fan-out commands verify once.
+func (config *DebugConfig) verifyImage(elevated bool) error {
+	settings := currentConfig().ImageVerification
+	if !config.VerifyImage && (settings == nil || !elevated) {
+		return nil
+	}
+	if settings == nil {
+		settings = &ImageVerification{}
+	}
+	enforce := config.VerifyImage || settings.Required
+	image := config.debugImage()
+
+	verifiedImagesMu.Lock()
+	defer verifiedImagesMu.Unlock()
+	err, done := verifiedImages[image]
+	if !done {
+		err = config.runImageChecks(settings, image)
+		verifiedImages[image] = err
+	}
+	if err == nil {
+		return nil
+	}
+	if !enforce {
+		if !done {
+			config.logf("Warning: debug image %s failed verification: %v", image, err)
+		}
+		return nil
+	}
+	return NewDetailedError(ErrorTypePermission, fmt.Sprintf("debug image %s failed verification: %v", image, err)).
+		WithSuggestion("Use a signed image without blocking vulnerabilities, or ask the cluster admins to allow it")
+}
+
+// runImageChecks runs the configured cosign and scanner checks
+func (config *DebugConfig) runImageChecks(settings *ImageVerification, image string) error {
+	if !settings.configured() {
+		return fmt.Errorf("no cosign key, keyless identity or scanner is configured under imageVerification in the config file")
+	}
+	if settings.CosignKey != "" || settings.CertificateIdentity != "" {
+		config.logf("Verifying the cosign signature of %s...", image)
+		if err := config.verifyCosign(settings, image); err != nil {
+			return err
+		}
+	}
+	switch {
+	case settings.Scanner == "":
+	case settings.Scanner == "trivy":
+		config.logf("Scanning %s with trivy...", image)
+		return config.scanWithTrivy(image, settings.severity())
+	default:
+		config.logf("Scanning %s with %s...", image, settings.Scanner)
+		return scanWithEndpoint(settings.Scanner, image, settings.severity())
+	}
+	return nil
+}
+
+// cosignArgs returns the cosign verify arguments for the settings
+func cosignArgs(settings *ImageVerification, image string) []string {
+	args := []string{"verify"}
+	if settings.CosignKey != "" {
+		args = append(args, "--key", settings.CosignKey)
+	} else {
+		args = append(args, "--certificate-identity", settings.CertificateIdentity,
+			"--certificate-oidc-issuer", settings.CertificateOIDCIssuer)
+	}
+	return append(args, "--output", "json", image)
+}
+
+func (config *DebugConfig) verifyCosign(settings *ImageVerification, image string) error {
+	var stderr bytes.Buffer
+	cmd := config.command("cosign", cosignArgs(settings, image)...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("cosign verify: %v - %s", err, truncateString(strings.TrimSpace(stderr.String()), 300))
+	}
+	return nil
+}
+
+// trivyReport is the part of trivy's JSON report kpdbug reads
+type trivyReport struct {
+	Results []struct {
+		Vulnerabilities []struct {
+			VulnerabilityID string `json:"VulnerabilityID"`
+			Severity        string `json:"Severity"`
+		} `json:"Vulnerabilities"`
+	} `json:"Results"`
+}
+
+// blockingVulnerabilities counts the vulnerabilities of the report per
+// severity and returns a summary, or "" when there are none
+func blockingVulnerabilities(report trivyReport) string {
+	counts := map[string]int{}
+	var order []string
+	var examples []string
+	for _, result := range report.Results {
+		for _, vuln := range result.Vulnerabilities {
+			if counts[vuln.Severity] == 0 {
+				order = append(order, vuln.Severity)
+			}
+			counts[vuln.Severity]++
+			if len(examples) < 3 {
+				examples = append(examples, vuln.VulnerabilityID)
+			}
+		}
+	}
+	if len(order) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(order))
+	for _, severity := range order {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[severity], severity))
+	}
+	return fmt.Sprintf("%s vulnerabilities (e.g. %s)", strings.Join(parts, ", "), strings.Join(examples, ", "))
+}
+
+func (config *DebugConfig) scanWithTrivy(image, severity string) error {
+	var stderr bytes.Buffer
+	cmd := config.command("trivy", "image", "--quiet", "--format", "json", "--severity", severity, image)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("trivy: %v - %s", err, truncateString(strings.TrimSpace(stderr.String()), 300))
+	}
+	var report trivyReport
+	if err := json.Unmarshal(output, &report); err != nil {
+		return fmt.Errorf("error parsing trivy report: %v", err)
+	}
+	if summary := blockingVulnerabilities(report); summary != "" {
+		return fmt.Errorf("trivy found %s", summary)
+	}
+	return nil
+}
+
+// scannerVerdict is the answer of a scanner endpoint
+type scannerVerdict struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+}
+
+// scanWithEndpoint asks a scanner endpoint whether the image may be used
+func scanWithEndpoint(url, image, severity string) error {
+	data, err := json.Marshal(map[string]string{"image": image, "severity": severity})
+	if err != nil {
+		return fmt.Errorf("error generating scan request: %v", err)
+	}
+	client := &http.Client{Timeout: scannerTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("scanner: %v", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("scanner returned %s", resp.Status)
+	}
+
+	var verdict scannerVerdict
+	if err := json.NewDecoder(resp.Body).Decode(&verdict); err != nil {
+		return fmt.Errorf("error parsing scanner response: %v", err)
+	}
+	if !verdict.Allowed {
+		if verdict.Reason == "" {
+			verdict.Reason = "no reason given"
+		}
+		return fmt.Errorf("scanner rejected the image: %s", verdict.Reason)
+	}
+	return nil
+}
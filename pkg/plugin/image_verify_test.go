@@ -0,0 +1,89 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVerifyImageGating(t *testing.T) {
+	defer func() {
+		loadedConfig = nil
+		verifiedImages = map[string]error{}
+	}()
+
+	tests := []struct {
+		name     string
+		settings *ImageVerification
+		flag     bool
+		elevated bool
+		wantErr  bool
+	}{
+		{"not configured", nil, false, true, false},
+		{"not elevated", &ImageVerification{Required: true}, false, false, false},
+		{"required without checks", &ImageVerification{Required: true}, false, true, true},
+		{"optional without checks only warns", &ImageVerification{}, false, true, false},
+		{"flag without checks", nil, true, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadedConfig = &Config{ImageVerification: tt.settings}
+			verifiedImages = map[string]error{}
+			config := &DebugConfig{Image: "nicolaka/netshoot", VerifyImage: tt.flag}
+			if err := config.verifyImage(tt.elevated); (err != nil) != tt.wantErr {
+				t.Errorf("verifyImage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCosignArgs(t *testing.T) {
+	got := cosignArgs(&ImageVerification{CosignKey: "k8s://security/cosign"}, "registry.local/debug:1")
+	want := []string{"verify", "--key", "k8s://security/cosign", "--output", "json", "registry.local/debug:1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cosignArgs(key) = %v, want %v", got, want)
+	}
+
+	got = cosignArgs(&ImageVerification{CertificateIdentity: "ci@example.com", CertificateOIDCIssuer: "https://token.actions.githubusercontent.com"}, "debug:1")
+	if got[1] != "--certificate-identity" || got[3] != "--certificate-oidc-issuer" {
+		t.Errorf("cosignArgs(keyless) = %v", got)
+	}
+}
+
+func TestBlockingVulnerabilities(t *testing.T) {
+	var report trivyReport
+	data := `{"Results":[{"Vulnerabilities":[{"VulnerabilityID":"CVE-1","Severity":"CRITICAL"},{"VulnerabilityID":"CVE-2","Severity":"HIGH"}]},{"Vulnerabilities":[{"VulnerabilityID":"CVE-3","Severity":"CRITICAL"}]}]}`
+	if err := json.Unmarshal([]byte(data), &report); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := blockingVulnerabilities(report), "2 CRITICAL, 1 HIGH vulnerabilities (e.g. CVE-1, CVE-2, CVE-3)"; got != want {
+		t.Errorf("blockingVulnerabilities() = %q, want %q", got, want)
+	}
+	if got := blockingVulnerabilities(trivyReport{}); got != "" {
+		t.Errorf("blockingVulnerabilities(empty) = %q", got)
+	}
+}
+
+func TestScanWithEndpoint(t *testing.T) {
+	var request map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		allowed := !strings.Contains(request["image"], "old")
+		_ = json.NewEncoder(w).Encode(scannerVerdict{Allowed: allowed, Reason: "CVE-2024-0001"})
+	}))
+	defer server.Close()
+
+	if err := scanWithEndpoint(server.URL, "debug:2", "CRITICAL"); err != nil {
+		t.Errorf("scanWithEndpoint(allowed) = %v", err)
+	}
+	if request["severity"] != "CRITICAL" {
+		t.Errorf("request = %v", request)
+	}
+	err := scanWithEndpoint(server.URL, "debug:old", "CRITICAL")
+	if err == nil || !strings.Contains(err.Error(), "CVE-2024-0001") {
+		t.Errorf("scanWithEndpoint(rejected) = %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"sort"
+	"strings"
+)
+
+// defaultRegistry is the registry of image references without one
+const defaultRegistry = "docker.io"
+
+// normalizeImage expands an image reference to its fully qualified form, so
+// nicolaka/netshoot and busybox:musl match rules written for
+// docker.io/nicolaka/netshoot and docker.io/library/busybox
+func normalizeImage(ref string) string {
+	first, rest, found := strings.Cut(ref, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		return ref
+	}
+	if !found {
+		return defaultRegistry + "/library/" + ref
+	}
+	return defaultRegistry + "/" + first + "/" + rest
+}
+
+// rewriteImage applies the longest matching rewrite rule to an image. Rules
+// map a registry or repository prefix to its mirror; a prefix matches whole
+// path components, and the remainder of the reference (path, tag or
+// digest) is kept. Images without a matching rule are returned unchanged.
+func rewriteImage(image string, rules map[string]string) string {
+	if len(rules) == 0 || image == "" {
+		return image
+	}
+	normalized := normalizeImage(image)
+
+	prefixes := make([]string, 0, len(rules))
+	for prefix := range rules {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		return len(normalizeRulePrefix(prefixes[i])) > len(normalizeRulePrefix(prefixes[j]))
+	})
+
+	for _, prefix := range prefixes {
+		from := normalizeRulePrefix(prefix)
+		if !strings.HasPrefix(normalized, from) {
+			continue
+		}
+		rest := normalized[len(from):]
+		if rest != "" && !strings.ContainsAny(rest[:1], "/:@") {
+			continue
+		}
+		return strings.TrimSuffix(rules[prefix], "/") + rest
+	}
+	return image
+}
+
+// normalizeRulePrefix qualifies a rule prefix like an image reference; bare
+// registry hosts such as docker.io or quay.io are kept as they are
+func normalizeRulePrefix(prefix string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if first, _, _ := strings.Cut(prefix, "/"); strings.ContainsAny(first, ".:") || first == "localhost" {
+		return prefix
+	}
+	return normalizeImage(prefix)
+}
+
+// debugImage is the image of the debug container after the configured
+// registry rewrites, so air-gapped clusters pull it from their mirror
+func (config *DebugConfig) debugImage() string {
+	return rewriteImage(config.Image, currentConfig().ImageRewrites)
+}
@@ -0,0 +1,32 @@
+package plugin
+
+import "testing"
+
+func TestRewriteImage(t *testing.T) {
+	rules := map[string]string{
+		"docker.io/nicolaka/netshoot": "internal.registry/mirror/netshoot",
+		"docker.io":                   "internal.registry/dockerhub",
+		"quay.io/":                    "internal.registry/quay/",
+		"busybox":                     "internal.registry/base/busybox",
+	}
+	tests := []struct {
+		image, want string
+	}{
+		{"nicolaka/netshoot:latest", "internal.registry/mirror/netshoot:latest"},
+		{"docker.io/nicolaka/netshoot@sha256:abc", "internal.registry/mirror/netshoot@sha256:abc"},
+		{"nicolaka/netshoot-extra:1", "internal.registry/dockerhub/nicolaka/netshoot-extra:1"},
+		{"busybox:musl", "internal.registry/base/busybox:musl"},
+		{"alpine", "internal.registry/dockerhub/library/alpine"},
+		{"quay.io/prometheus/busybox:latest", "internal.registry/quay/prometheus/busybox:latest"},
+		{"ghcr.io/org/tool:v1", "ghcr.io/org/tool:v1"},
+		{"localhost:5000/tool", "localhost:5000/tool"},
+	}
+	for _, tt := range tests {
+		if got := rewriteImage(tt.image, rules); got != tt.want {
+			t.Errorf("rewriteImage(%q) = %q, want %q", tt.image, got, tt.want)
+		}
+	}
+	if got := rewriteImage("nicolaka/netshoot", nil); got != "nicolaka/netshoot" {
+		t.Errorf("rewriteImage() without rules = %q, want the image unchanged", got)
+	}
+}
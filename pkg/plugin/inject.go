@@ -0,0 +1,85 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultBusyboxImage ships a statically linked busybox at /bin/busybox
+const defaultBusyboxImage = "busybox:musl"
+
+var injectBusyboxPath string
+
+var injectCmd = &cobra.Command{
+	Use:   "inject",
+	Short: "Open a busybox shell chrooted into a shell-less target container",
+	Long: `Add an ephemeral debug container to the target pod, copy a statically linked
+busybox from the debug image into a writable directory of the target container
+through /proc/<pid>/root, and open a shell chrooted into the target's filesystem.
+Use it to poke the original filesystem of distroless or scratch containers with
+their own paths. The injected binary is removed when the shell exits.`,
+	Example: `  kpdbug inject -p mypod
+  kpdbug inject -p mypod -c app --image my-registry/busybox:musl --busybox /bin/busybox`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runInject(cmd)
+	},
+}
+
+func init() {
+	injectCmd.Flags().StringVar(&injectBusyboxPath, "busybox", "/bin/busybox", "path of the static busybox binary in the debug image")
+	rootCmd.AddCommand(injectCmd)
+}
+
+// injectScript copies busybox into the first writable directory of the
+// target, installs its applets next to it and runs a chrooted shell; the
+// directory is removed afterwards
+const injectScript = targetPIDScript + `dir=""
+for candidate in /tmp /dev/shm /var/tmp /run $(awk '$4 ~ /^rw/ {print $2}' /proc/$pid/mounts); do
+  if mkdir -p "$root$candidate/.kpdbug" 2>/dev/null && cp %[1]s "$root$candidate/.kpdbug/busybox" 2>/dev/null; then
+    dir="$candidate/.kpdbug"
+    break
+  fi
+done
+if [ -z "$dir" ]; then
+  echo "kpdbug: no writable directory found in the target container" >&2
+  exit 1
+fi
+chmod 755 "$root$dir/busybox"
+echo "kpdbug: busybox injected at $dir, chrooting into the target filesystem (exit to clean up)" >&2
+chroot "$root" "$dir/busybox" sh -c "$dir/busybox --install -s $dir; export PATH=\$PATH:$dir; exec $dir/busybox sh"
+code=$?
+rm -rf "$root$dir"
+exit $code`
+
+func runInject(cmd *cobra.Command) error {
+	config, err := newTargetConfig(cmd.Context(), cmd, defaultBusyboxImage, "general")
+	if err != nil {
+		return err
+	}
+	if err := config.admitEphemeral(); err != nil {
+		return err
+	}
+
+	containerName, err := config.getTargetContainerName()
+	if err != nil {
+		return WrapKubectlError(err, "get target container name")
+	}
+
+	customFile, err := config.writeEphemeralSpec()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(customFile)
+	}()
+
+	args := append(config.ephemeralArgs(containerName, customFile),
+		"-it", "--", "sh", "-c", fmt.Sprintf(injectScript, shellQuote(injectBusyboxPath)))
+
+	log.Printf("Injecting busybox into container %s of pod %s...", containerName, config.PodName)
+	return wrapSessionError(config.runPodSession(config.PodName, args...), "inject busybox")
+}
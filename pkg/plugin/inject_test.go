@@ -0,0 +1,63 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInjectScript(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	busybox := filepath.Join(t.TempDir(), "busybox")
+	if err := os.WriteFile(busybox, []byte("#!/bin/sh\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		setup  func(root string) error
+		source string
+		dir    string
+		code   int
+	}{
+		{"first writable directory", func(string) error { return nil }, busybox, "/tmp/.kpdbug", 7},
+		{"read-only /tmp", func(root string) error { return os.WriteFile(filepath.Join(root, "tmp"), nil, 0o644) }, busybox, "/dev/shm/.kpdbug", 7},
+		{"missing busybox", func(string) error { return nil }, filepath.Join(t.TempDir(), "missing"), "", 1},
+	}
+	for _, tt := range tests {
+		root := t.TempDir()
+		if err := tt.setup(root); err != nil {
+			t.Fatal(err)
+		}
+		// A stub chroot checks the injected binary and fails with 7, which
+		// the script must pass on after cleaning up
+		prelude := "pid=self\nroot=" + shellQuote(root) + "\n" +
+			`chroot() { [ -x "$1$2" ] && echo "chroot $2 $3"; return 7; }` + "\n"
+		script := prelude + strings.TrimPrefix(fmt.Sprintf(injectScript, shellQuote(tt.source)), targetPIDScript)
+
+		output, err := exec.Command("sh", "-c", script).CombinedOutput()
+		code, _ := exitCode(err)
+		if err == nil {
+			code = 0
+		}
+		if code != tt.code {
+			t.Errorf("%s: exit code %d, want %d: %s", tt.name, code, tt.code, output)
+		}
+		if tt.dir != "" && !strings.Contains(string(output), "chroot "+tt.dir+"/busybox sh") {
+			t.Errorf("%s: output = %q, want busybox chrooted from %s", tt.name, output, tt.dir)
+		}
+		if tt.dir == "" && !strings.Contains(string(output), "no writable directory") {
+			t.Errorf("%s: output = %q, want the missing directory reported", tt.name, output)
+		}
+		if tt.dir != "" {
+			if _, err := os.Stat(filepath.Join(root, tt.dir)); !os.IsNotExist(err) {
+				t.Errorf("%s: %s was not removed", tt.name, tt.dir)
+			}
+		}
+	}
+}
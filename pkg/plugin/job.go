@@ -0,0 +1,223 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+// Workload kinds accepted by --pod as <kind>/<name>
+const (
+	WorkloadJob     = "job"
+	WorkloadCronJob = "cronjob"
+)
+
+// workloadKinds maps the resource names kubectl accepts to workload kinds
+var workloadKinds = map[string]string{
+	"job":           WorkloadJob,
+	"jobs":          WorkloadJob,
+	"job.batch":     WorkloadJob,
+	"cronjob":       WorkloadCronJob,
+	"cronjobs":      WorkloadCronJob,
+	"cj":            WorkloadCronJob,
+	"cronjob.batch": WorkloadCronJob,
+}
+
+// jobControllerLabels are set by the Job controller on its pods; a replay
+// pod keeping them would be counted and adopted by the Job
+var jobControllerLabels = []string{
+	"controller-uid",
+	"job-name",
+	"batch.kubernetes.io/controller-uid",
+	"batch.kubernetes.io/job-name",
+	"batch.kubernetes.io/job-completion-index",
+}
+
+// replayOfAnnotation records the workload a replay pod was created from
+const replayOfAnnotation = "debug-tool/replay-of"
+
+// parseWorkloadTarget splits job/<name> and cronjob/<name> --pod values;
+// plain pod names return an empty kind
+func parseWorkloadTarget(value string) (kind, name string) {
+	prefix, rest, ok := strings.Cut(value, "/")
+	if !ok {
+		return "", value
+	}
+	if kind, known := workloadKinds[strings.ToLower(prefix)]; known && rest != "" {
+		return kind, rest
+	}
+	return "", value
+}
+
+// workloadPodTemplate fetches the pod template of the Job or CronJob
+func (config *DebugConfig) workloadPodTemplate() (*corev1.PodTemplateSpec, error) {
+	output, err := outputWithRetry(config.context(), func() *runnerCommand {
+		return config.kubectl("get", config.Workload, config.PodName, "-n", config.Namespace, "-o", "json")
+	})
+	if err != nil {
+		return nil, NewDetailedError(ErrorTypePodNotFound,
+			fmt.Sprintf("%s %s not found in namespace %s", config.Workload, config.PodName, config.Namespace)).
+			WithCommand(fmt.Sprintf("kubectl get %ss -n %s", config.Workload, config.Namespace)).
+			WithOriginalError(err)
+	}
+
+	if config.Workload == WorkloadCronJob {
+		var cronJob batchv1.CronJob
+		if err := json.Unmarshal(output, &cronJob); err != nil {
+			return nil, fmt.Errorf("error parsing cronjob JSON: %v", err)
+		}
+		return &cronJob.Spec.JobTemplate.Spec.Template, nil
+	}
+	var job batchv1.Job
+	if err := json.Unmarshal(output, &job); err != nil {
+		return nil, fmt.Errorf("error parsing job JSON: %v", err)
+	}
+	return &job.Spec.Template, nil
+}
+
+// replayPod builds a debug pod from a Job's pod template with the exact env,
+// volumes and service account, but every container's entrypoint replaced by
+// sleep so the failed batch command can be rerun by hand. Init containers
+// still run, since they often prepare the volumes the command needs.
+func replayPod(template *corev1.PodTemplateSpec, name, namespace, container string) *corev1.Pod {
+	labels := map[string]string{}
+	for key, value := range template.Labels {
+		labels[key] = value
+	}
+	for _, key := range jobControllerLabels {
+		delete(labels, key)
+	}
+
+	annotations := map[string]string{}
+	for key, value := range template.Annotations {
+		annotations[key] = value
+	}
+	// kubectl exec and attach pick this container without -c
+	annotations["kubectl.kubernetes.io/default-container"] = container
+
+	spec := template.Spec.DeepCopy()
+	spec.RestartPolicy = corev1.RestartPolicyNever
+	spec.ActiveDeadlineSeconds = nil
+	spec.TerminationGracePeriodSeconds = ptr.To(int64(0))
+	for i := range spec.Containers {
+		c := &spec.Containers[i]
+		c.Command = []string{"sleep", "infinity"}
+		c.Args = nil
+		c.LivenessProbe = nil
+		c.ReadinessProbe = nil
+		c.StartupProbe = nil
+		c.Lifecycle = nil
+	}
+
+	return &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+		Spec: *spec,
+	}
+}
+
+// originalCommand renders the entrypoint a replay pod replaced
+func originalCommand(c corev1.Container) string {
+	parts := append(append([]string{}, c.Command...), c.Args...)
+	if len(parts) == 0 {
+		return "(image entrypoint)"
+	}
+	quoted := make([]string, len(parts))
+	for i, part := range parts {
+		quoted[i] = shellQuote(part)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// executeReplayJob creates a replay pod of the Job or CronJob's pod template
+// and opens a session in its main container
+func (config *DebugConfig) executeReplayJob() error {
+	pod, target, err := config.buildReplayPod()
+	if err != nil {
+		return err
+	}
+	name, err := config.freePodName()
+	if err != nil {
+		return err
+	}
+	pod.Name = name
+
+	config.logf("Creating replay pod %s from %s %s with entrypoints replaced by sleep...", name, config.Workload, config.PodName)
+	if err := config.createObject(pod); err != nil {
+		return WrapKubectlError(err, "create replay pod")
+	}
+	config.emitPodEvent(EventCreated, name, "replay of "+config.Workload+"/"+config.PodName)
+	config.recordDebugPod(name, "", "exec", "-it", name, "-n", config.Namespace, "--", "sh")
+	config.logf("Original command of container %s: %s", target.Name, originalCommand(target))
+
+	if config.RemoveAfter {
+		defer config.removeOnExit(name, false).run()
+	}
+
+	if !config.attaches() {
+		config.notifySession(NotifyCreated, name, false)
+		config.logf("You can access the pod with: kubectl exec -it %s -n %s -- sh\n", name, config.Namespace)
+		config.printPodName(name)
+		return nil
+	}
+
+	config.logf("Waiting for pod to be ready...")
+	config.emitPodEvent(EventWaiting, name, "")
+	if err := config.waitForPod(name); err != nil {
+		return NewTimeoutError("pod ready", fmt.Sprintf("%ds", maxAttempts)).WithOriginalError(err)
+	}
+	config.emitPodEvent(EventReady, name, "")
+
+	if config.Command != "" {
+		return wrapSessionError(config.runPodSession(name, config.commandExecArgs(name)...), "run command in replay pod")
+	}
+	return wrapSessionError(config.attachToPod(name), "attach to replay pod")
+}
+
+// buildReplayPod renders the replay pod of the Job or CronJob, still
+// unnamed, and returns the container sessions open in
+func (config *DebugConfig) buildReplayPod() (*corev1.Pod, corev1.Container, error) {
+	template, err := config.workloadPodTemplate()
+	if err != nil {
+		return nil, corev1.Container{}, err
+	}
+	if len(template.Spec.Containers) == 0 {
+		return nil, corev1.Container{}, NewValidationError("pod", config.Workload+"/"+config.PodName, "pod template has no containers")
+	}
+
+	target := template.Spec.Containers[0]
+	if config.Container != "" {
+		found := false
+		for _, c := range template.Spec.Containers {
+			if c.Name == config.Container {
+				target, found = c, true
+			}
+		}
+		if !found {
+			return nil, corev1.Container{}, NewValidationError("container", config.Container, fmt.Sprintf("not a container of %s %s", config.Workload, config.PodName))
+		}
+	}
+
+	pod := replayPod(template, "", config.Namespace, target.Name)
+	pod.Spec.ActiveDeadlineSeconds = config.activeDeadlineSeconds()
+	pod.Labels["debug-tool/type"] = "debug-pod"
+	pod.Labels["debug-tool/target"] = targetLabelValue(config.PodName)
+	pod.Annotations[replayOfAnnotation] = config.Workload + "/" + config.PodName
+	if user := config.currentUser(); user != "" {
+		pod.Annotations[createdByAnnotation] = user
+	}
+	if config.RemoveAfter {
+		pod.Annotations[removeAfterAnnotation] = removalOwner()
+	}
+	return pod, target, nil
+}
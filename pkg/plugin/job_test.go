@@ -0,0 +1,77 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestParseWorkloadTarget(t *testing.T) {
+	tests := []struct {
+		value, kind, name string
+	}{
+		{"job/backup", WorkloadJob, "backup"},
+		{"jobs.batch/backup", "", "jobs.batch/backup"},
+		{"cronjob/nightly", WorkloadCronJob, "nightly"},
+		{"cj/nightly", WorkloadCronJob, "nightly"},
+		{"mypod", "", "mypod"},
+		{"deployment/web", "", "deployment/web"},
+		{"job/", "", "job/"},
+	}
+	for _, tt := range tests {
+		kind, name := parseWorkloadTarget(tt.value)
+		if kind != tt.kind || name != tt.name {
+			t.Errorf("parseWorkloadTarget(%q) = %q, %q, want %q, %q", tt.value, kind, name, tt.kind, tt.name)
+		}
+	}
+}
+
+func TestReplayPod(t *testing.T) {
+	template := &corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+			"app":                                "backup",
+			"job-name":                           "backup",
+			"batch.kubernetes.io/controller-uid": "1234",
+		}},
+		Spec: corev1.PodSpec{
+			RestartPolicy:         corev1.RestartPolicyOnFailure,
+			ActiveDeadlineSeconds: ptr.To(int64(600)),
+			InitContainers:        []corev1.Container{{Name: "fetch", Command: []string{"fetch-config"}}},
+			Containers: []corev1.Container{{
+				Name:          "backup",
+				Command:       []string{"/bin/backup"},
+				Args:          []string{"--target", "s3://bucket"},
+				Env:           []corev1.EnvVar{{Name: "BUCKET", Value: "bucket"}},
+				LivenessProbe: &corev1.Probe{},
+			}},
+		},
+	}
+
+	pod := replayPod(template, "debug-backup-abcde", "batch", "backup")
+	if _, ok := pod.Labels["job-name"]; ok || pod.Labels["batch.kubernetes.io/controller-uid"] != "" || pod.Labels["app"] != "backup" {
+		t.Errorf("labels = %v, want the Job controller labels removed and app kept", pod.Labels)
+	}
+	c := pod.Spec.Containers[0]
+	if strings.Join(c.Command, " ") != "sleep infinity" || c.Args != nil || c.LivenessProbe != nil {
+		t.Errorf("container = %+v, want the entrypoint replaced by sleep and probes removed", c)
+	}
+	if len(c.Env) != 1 || pod.Spec.InitContainers[0].Command[0] != "fetch-config" {
+		t.Errorf("replay pod should keep env and init containers: %+v", pod.Spec)
+	}
+	if pod.Spec.RestartPolicy != corev1.RestartPolicyNever || pod.Spec.ActiveDeadlineSeconds != nil {
+		t.Errorf("restartPolicy = %s, activeDeadlineSeconds = %v", pod.Spec.RestartPolicy, pod.Spec.ActiveDeadlineSeconds)
+	}
+	if pod.Annotations["kubectl.kubernetes.io/default-container"] != "backup" {
+		t.Errorf("annotations = %v, want backup as the default container", pod.Annotations)
+	}
+	if template.Spec.Containers[0].Command[0] != "/bin/backup" {
+		t.Error("replayPod() should not modify the template")
+	}
+
+	if got := originalCommand(template.Spec.Containers[0]); got != "'/bin/backup' '--target' 's3://bucket'" {
+		t.Errorf("originalCommand() = %s", got)
+	}
+}
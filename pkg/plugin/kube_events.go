@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Reasons of the Kubernetes Events recorded on debugged pods
+const (
+	ReasonSessionStarted = "SessionStarted"
+	ReasonSessionEnded   = "SessionEnded"
+)
+
+// eventComponent is the source reported on recorded Events
+const eventComponent = "kpdbug"
+
+// newTargetEvent builds a Normal Event about target, named like the ones the
+// kubelet creates so `kubectl describe pod` lists it with the pod's events
+func newTargetEvent(target *corev1.Pod, reason, message string, now time.Time) *corev1.Event {
+	timestamp := metav1.NewTime(now)
+	return &corev1.Event{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Event",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s.%x", target.Name, now.UnixNano()),
+			Namespace: target.Namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Name:       target.Name,
+			Namespace:  target.Namespace,
+			UID:        target.UID,
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           corev1.EventTypeNormal,
+		Source:         corev1.EventSource{Component: eventComponent},
+		FirstTimestamp: timestamp,
+		LastTimestamp:  timestamp,
+		Count:          1,
+	}
+}
+
+// sessionEventMessage describes a debug session and who started it
+func sessionEventMessage(what, user string) string {
+	if user == "" {
+		return what + " via kpdbug"
+	}
+	return fmt.Sprintf("%s by %s via kpdbug", what, user)
+}
+
+// recordTargetEvent creates an Event on the target pod; it is best effort,
+// since users allowed to debug are not always allowed to create Events
+func (config *DebugConfig) recordTargetEvent(reason, what string) {
+	target, err := config.getTargetPod()
+	if err != nil {
+		config.logf("Warning: Could not record %s event on pod %s: %v", reason, config.PodName, err)
+		return
+	}
+	message := sessionEventMessage(what, config.currentUser())
+	event := newTargetEvent(target, reason, message, clock())
+	if err := config.createObject(event); err != nil {
+		config.logf("Warning: Could not record %s event on pod %s: %v", reason, config.PodName, err)
+	}
+}
@@ -0,0 +1,41 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestNewTargetEvent(t *testing.T) {
+	target := &corev1.Pod{}
+	target.Name = "web-0"
+	target.Namespace = "shop"
+	target.UID = "1234-abcd"
+	now := time.Date(2026, 3, 4, 10, 20, 30, 0, time.UTC)
+
+	event := newTargetEvent(target, ReasonSessionStarted, sessionEventMessage("Ephemeral debug container added", "alice"), now)
+
+	if event.Namespace != "shop" || !strings.HasPrefix(event.Name, "web-0.") {
+		t.Errorf("event metadata = %s/%s, want shop/web-0.<hex>", event.Namespace, event.Name)
+	}
+	if event.InvolvedObject.Kind != "Pod" || event.InvolvedObject.Name != "web-0" || event.InvolvedObject.UID != "1234-abcd" {
+		t.Errorf("InvolvedObject = %+v, want the target pod", event.InvolvedObject)
+	}
+	if event.Reason != "SessionStarted" || event.Type != corev1.EventTypeNormal || event.Source.Component != "kpdbug" {
+		t.Errorf("event = %s/%s from %s, want Normal/SessionStarted from kpdbug", event.Type, event.Reason, event.Source.Component)
+	}
+	if want := "Ephemeral debug container added by alice via kpdbug"; event.Message != want {
+		t.Errorf("Message = %q, want %q", event.Message, want)
+	}
+	if !event.FirstTimestamp.Time.Equal(now) || event.Count != 1 {
+		t.Errorf("timestamps = %v x%d, want %v x1", event.FirstTimestamp, event.Count, now)
+	}
+}
+
+func TestSessionEventMessageWithoutUser(t *testing.T) {
+	if got, want := sessionEventMessage("Debug copy web-0-debug created", ""), "Debug copy web-0-debug created via kpdbug"; got != want {
+		t.Errorf("sessionEventMessage() = %q, want %q", got, want)
+	}
+}
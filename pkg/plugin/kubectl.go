@@ -0,0 +1,182 @@
+package plugin
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// kubectlCommand builds a kubectl invocation bound to ctx with the global
+// kubectl flags applied, so every call made by the tool runs as the same
+// identity and is killed when ctx is cancelled.
+func kubectlCommand(ctx context.Context, args ...string) *runnerCommand {
+	return newRunnerCommand(ctx, defaultRunner, "kubectl", withGlobalKubectlFlags(args)...)
+}
+
+// kubectl builds a kubectl invocation bound to the config's context and run
+// by the config's runner
+func (config *DebugConfig) kubectl(args ...string) *runnerCommand {
+	return config.command("kubectl", config.withKubectlFlags(args)...)
+}
+
+// kubectlWithContext builds a kubectl invocation run by the config's runner
+// but bound to ctx, e.g. the cleanup context
+func (config *DebugConfig) kubectlWithContext(ctx context.Context, args ...string) *runnerCommand {
+	return newRunnerCommand(ctx, config.runner(), "kubectl", config.withKubectlFlags(args)...)
+}
+
+// withKubectlFlags applies the config's KubectlFlags, or the global ones
+func (config *DebugConfig) withKubectlFlags(args []string) []string {
+	if config.KubectlFlags != nil {
+		return insertKubectlFlags(args, config.KubectlFlags)
+	}
+	return withGlobalKubectlFlags(args)
+}
+
+// context returns the context for the current operation
+func (config *DebugConfig) context() context.Context {
+	if config.Context == nil {
+		return context.Background()
+	}
+	return config.Context
+}
+
+// cleanupContext returns a context that survives cancellation of the
+// operation, so pods are still deleted after Ctrl-C.
+func (config *DebugConfig) cleanupContext() context.Context {
+	return context.WithoutCancel(config.context())
+}
+
+// globalKubectlFlags returns the flags forwarded to every kubectl call
+func globalKubectlFlags() []string {
+	var flags []string
+	if kubeconfig != "" {
+		flags = append(flags, "--kubeconfig="+kubeconfig)
+	}
+	if kubeContext != "" {
+		flags = append(flags, "--context="+kubeContext)
+	}
+	for _, flag := range []struct{ name, value string }{
+		{"cluster", kubeCluster},
+		{"user", kubeUser},
+		{"server", kubeServer},
+		{"token", kubeToken},
+		{"certificate-authority", certAuthority},
+		{"client-certificate", clientCert},
+		{"client-key", clientKey},
+		{"tls-server-name", tlsServerName},
+		{"request-timeout", requestTimeout},
+	} {
+		if flag.value != "" {
+			flags = append(flags, "--"+flag.name+"="+flag.value)
+		}
+	}
+	if insecureTLS {
+		flags = append(flags, "--insecure-skip-tls-verify=true")
+	}
+	if kubectlLogLevel > 0 {
+		flags = append(flags, "--v="+strconv.Itoa(kubectlLogLevel))
+	}
+	if asUser != "" {
+		flags = append(flags, "--as="+asUser)
+	}
+	for _, group := range asGroups {
+		flags = append(flags, "--as-group="+group)
+	}
+	return flags
+}
+
+// withGlobalKubectlFlags inserts the global flags before any "--" separator
+// so they are never passed to the remote command.
+func withGlobalKubectlFlags(args []string) []string {
+	return insertKubectlFlags(args, globalKubectlFlags())
+}
+
+// insertKubectlFlags inserts global before any "--" separator of args
+func insertKubectlFlags(args, global []string) []string {
+	if len(global) == 0 {
+		return args
+	}
+
+	result := make([]string, 0, len(args)+len(global))
+	for i, arg := range args {
+		if arg == "--" {
+			result = append(result, global...)
+			return append(result, args[i:]...)
+		}
+		result = append(result, arg)
+	}
+	return append(result, global...)
+}
+
+// secretFlags are the flags whose values are credentials; they are redacted
+// from the history and from every command line shown to the user
+var secretFlags = []string{"--token", "--client-key", "--password"}
+
+// redacted replaces the value of a secret flag
+const redacted = "REDACTED"
+
+// replaceSecrets returns args with the value of every secret flag, given as
+// --flag=value or as --flag value, replaced by replace
+func replaceSecrets(args []string, replace func(flag, value string) string) []string {
+	result := make([]string, len(args))
+	copy(result, args)
+	for i := 0; i < len(result); i++ {
+		for _, flag := range secretFlags {
+			if value, ok := strings.CutPrefix(result[i], flag+"="); ok {
+				result[i] = flag + "=" + replace(flag, value)
+			} else if result[i] == flag && i+1 < len(result) {
+				i++
+				result[i] = replace(flag, result[i])
+			}
+		}
+	}
+	return result
+}
+
+// redactSecrets returns args with the values of the secret flags redacted
+func redactSecrets(args []string) []string {
+	return replaceSecrets(args, func(string, string) string { return redacted })
+}
+
+// displayKubectl renders a kubectl invocation for the user to copy, without
+// the credentials among its flags
+func displayKubectl(args []string) string {
+	return "kubectl " + strings.Join(redactSecrets(args), " ")
+}
+
+// currentNamespace returns the --namespace flag, or the namespace of the
+// selected kubeconfig context when the flag is not set, falling back to
+// "default". The resolved value is stored back into the flag variable. It is
+// resolved on first use, so commands that never reach the cluster, such as
+// completion and history, do not run kubectl for it.
+func currentNamespace(ctx context.Context) string {
+	if namespace == "" {
+		namespace = contextNamespace(ctx)
+	}
+	return namespace
+}
+
+// contextNamespace reads the namespace of the current kubeconfig context,
+// honoring --kubeconfig and --context
+func contextNamespace(ctx context.Context) string {
+	return (&DebugConfig{Context: ctx}).contextNamespace()
+}
+
+// ResolveNamespace sets an empty Namespace to the namespace of the config's
+// kubeconfig context, or "default"
+func (config *DebugConfig) ResolveNamespace() {
+	if config.Namespace == "" {
+		config.Namespace = config.contextNamespace()
+	}
+}
+
+func (config *DebugConfig) contextNamespace() string {
+	output, err := config.kubectl("config", "view", "--minify", "-o", "jsonpath={..namespace}").Output()
+	if err == nil {
+		if ns := strings.TrimSpace(string(output)); ns != "" {
+			return ns
+		}
+	}
+	return "default"
+}
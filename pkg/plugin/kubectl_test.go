@@ -0,0 +1,158 @@
+package plugin
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImpersonationForwarding(t *testing.T) {
+	oldKubeconfig, oldContext, oldUser, oldGroups := kubeconfig, kubeContext, asUser, asGroups
+	defer func() { kubeconfig, kubeContext, asUser, asGroups = oldKubeconfig, oldContext, oldUser, oldGroups }()
+
+	tests := []struct {
+		name   string
+		user   string
+		groups []string
+		args   []string
+		want   string
+	}{
+		{"none", "", nil, []string{"get", "pods"}, "kubectl get pods"},
+		{"user", "alice", nil, []string{"get", "pods"}, "kubectl get pods --as=alice"},
+		{"user and groups", "alice", []string{"sre", "oncall"}, []string{"get", "pods"},
+			"kubectl get pods --as=alice --as-group=sre --as-group=oncall"},
+		{"groups only", "", []string{"sre"}, []string{"auth", "can-i", "create", "pods"},
+			"kubectl auth can-i create pods --as-group=sre"},
+		{"before the remote command", "alice", []string{"sre"}, []string{"exec", "web", "--", "id", "--as=root"},
+			"kubectl exec web --as=alice --as-group=sre -- id --as=root"},
+	}
+	kubeconfig, kubeContext = "", ""
+	for _, tt := range tests {
+		asUser, asGroups = tt.user, tt.groups
+		runner := &fakeRunner{}
+		config := &DebugConfig{Runner: runner}
+		_ = config.kubectl(tt.args...).Run()
+		_ = config.kubectlWithContext(context.Background(), tt.args...).Run()
+		if len(runner.calls) != 2 {
+			t.Fatalf("%s: ran %v, want two calls", tt.name, runner.calls)
+		}
+		for _, call := range runner.calls {
+			if call != tt.want {
+				t.Errorf("%s: ran %q, want %q", tt.name, call, tt.want)
+			}
+		}
+	}
+
+	kubeconfig, kubeContext, asUser, asGroups = "/tmp/kubeconfig", "staging", "alice", []string{"sre"}
+	want := []string{"--kubeconfig=/tmp/kubeconfig", "--context=staging", "--as=alice", "--as-group=sre"}
+	if got := globalKubectlFlags(); !reflect.DeepEqual(got, want) {
+		t.Errorf("globalKubectlFlags() = %v, want %v", got, want)
+	}
+}
+
+func TestConnectionFlagsForwarding(t *testing.T) {
+	defer func(cluster, user, server, token, ca, cert, key, name string, insecure bool, timeout string, level int) {
+		kubeCluster, kubeUser, kubeServer, kubeToken, certAuthority, clientCert, clientKey, tlsServerName = cluster, user, server, token, ca, cert, key, name
+		insecureTLS, requestTimeout, kubectlLogLevel = insecure, timeout, level
+	}(kubeCluster, kubeUser, kubeServer, kubeToken, certAuthority, clientCert, clientKey, tlsServerName, insecureTLS, requestTimeout, kubectlLogLevel)
+
+	kubeCluster, kubeUser, kubeServer, kubeToken = "prod", "sso", "https://10.0.0.1:6443", "s3cr3t"
+	certAuthority, clientCert, clientKey, tlsServerName = "/etc/ca.crt", "/etc/client.crt", "/etc/client.key", "api.internal"
+	insecureTLS, requestTimeout, kubectlLogLevel = true, "30s", 6
+
+	runner := &fakeRunner{}
+	config := &DebugConfig{Runner: runner}
+	_ = config.kubectl("exec", "web", "--", "ls", "-v").Run()
+	want := "kubectl exec web --cluster=prod --user=sso --server=https://10.0.0.1:6443 --token=s3cr3t" +
+		" --certificate-authority=/etc/ca.crt --client-certificate=/etc/client.crt --client-key=/etc/client.key" +
+		" --tls-server-name=api.internal --request-timeout=30s --insecure-skip-tls-verify=true --v=6 -- ls -v"
+	if len(runner.calls) != 1 || runner.calls[0] != want {
+		t.Errorf("ran %q, want %q", runner.calls, want)
+	}
+
+	// kubectl's shorthands and flag names parse like in kubectl
+	flags := rootCmd.PersistentFlags()
+	if flag := flags.ShorthandLookup("v"); flag == nil || flag.Name != "v" {
+		t.Errorf("-v = %v, want --v", flag)
+	}
+	if flag := flags.ShorthandLookup("s"); flag == nil || flag.Name != "server" {
+		t.Errorf("-s = %v, want --server", flag)
+	}
+}
+
+func TestSecretsRedacted(t *testing.T) {
+	defer func(token, key string) { kubeToken, clientKey = token, key }(kubeToken, clientKey)
+	kubeToken, clientKey = "s3cr3t", "/etc/client.key"
+
+	got := redactSecrets([]string{"-p", "web", "--token", "s3cr3t", "--client-key=/etc/client.key", "--", "mysql", "--password=hunter2"})
+	want := []string{"-p", "web", "--token", "REDACTED", "--client-key=REDACTED", "--", "mysql", "--password=REDACTED"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("redactSecrets() = %q, want %q", got, want)
+	}
+
+	config := &DebugConfig{result: &DebugResult{}}
+	config.recordDebugPod("debug-abc", "debugger", "attach", "debug-abc", "-it")
+	shown := map[string]string{
+		"NewPermissionError":  NewPermissionError("create pods").Command,
+		"NewCredentialsError": NewCredentialsError().Command,
+		"AttachCommand":       config.result.AttachCommand,
+	}
+	for name, command := range shown {
+		if strings.Contains(command, "s3cr3t") || strings.Contains(command, "client.key") || !strings.Contains(command, "--token=REDACTED") {
+			t.Errorf("%s = %q, want the token and client key redacted", name, command)
+		}
+	}
+
+	// The redaction is only shown; kubectl still gets the token
+	runner := &fakeRunner{}
+	_ = (&DebugConfig{Runner: runner}).kubectl("auth", "whoami").Run()
+	if len(runner.calls) != 1 || !strings.Contains(runner.calls[0], "--token=s3cr3t") {
+		t.Errorf("ran %q, want the token passed to kubectl", runner.calls)
+	}
+}
+
+func TestContextNamespace(t *testing.T) {
+	oldKubeconfig, oldContext, oldNamespace := kubeconfig, kubeContext, namespace
+	defer func() { kubeconfig, kubeContext, namespace = oldKubeconfig, oldContext, oldNamespace }()
+	kubeconfig, kubeContext = "", "staging"
+	const view = "kubectl config view --minify -o jsonpath={..namespace} --context=staging"
+
+	tests := []struct {
+		name      string
+		outputs   map[string]string
+		namespace string
+		want      string
+		looksUp   bool
+	}{
+		{"namespace of the --context", map[string]string{view: "team-a\n"}, "", "team-a", true},
+		{"context without a namespace", map[string]string{view: ""}, "", "default", true},
+		{"kubeconfig that cannot be read", nil, "", "default", true},
+		{"--namespace", map[string]string{view: "team-a"}, "payments", "payments", false},
+	}
+	for _, tt := range tests {
+		runner := &fakeRunner{outputs: tt.outputs}
+		config := &DebugConfig{Namespace: tt.namespace, Runner: runner}
+		config.ResolveNamespace()
+		if config.Namespace != tt.want {
+			t.Errorf("%s: Namespace = %q, want %q", tt.name, config.Namespace, tt.want)
+		}
+		if looked := len(runner.calls) > 0; looked != tt.looksUp {
+			t.Errorf("%s: ran %v, want a lookup: %v", tt.name, runner.calls, tt.looksUp)
+		}
+	}
+
+	// The flag default is resolved once and kept for the later lookups
+	origRunner := defaultRunner
+	defer func() { defaultRunner = origRunner }()
+	runner := &fakeRunner{outputs: map[string]string{view: "team-a"}}
+	defaultRunner, namespace = runner, ""
+	for i := 0; i < 2; i++ {
+		if got := currentNamespace(context.Background()); got != "team-a" {
+			t.Errorf("currentNamespace() = %q, want team-a", got)
+		}
+	}
+	if len(runner.calls) != 1 {
+		t.Errorf("ran %v, want one lookup", runner.calls)
+	}
+}
@@ -0,0 +1,91 @@
+package plugin
+
+import (
+	"fmt"
+	"math"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// quantityBounds are the LimitRange constraints on one container value
+type quantityBounds struct {
+	min, max, preferred *resource.Quantity
+}
+
+// within reports whether value satisfies the bounds
+func (b quantityBounds) within(value resource.Quantity) bool {
+	return (b.min == nil || value.Cmp(*b.min) >= 0) && (b.max == nil || value.Cmp(*b.max) <= 0)
+}
+
+// fit returns value when it is within the bounds, otherwise the preferred
+// LimitRange default if that fits, otherwise the nearest bound
+func (b quantityBounds) fit(value resource.Quantity) (resource.Quantity, string) {
+	if b.within(value) {
+		return value, ""
+	}
+	if b.preferred != nil && b.within(*b.preferred) {
+		return b.preferred.DeepCopy(), "LimitRange default"
+	}
+	if b.min != nil && value.Cmp(*b.min) < 0 {
+		return b.min.DeepCopy(), "LimitRange min"
+	}
+	return b.max.DeepCopy(), "LimitRange max"
+}
+
+// lookup returns a pointer to list[name], or nil when it is not set
+func lookup(list corev1.ResourceList, name corev1.ResourceName) *resource.Quantity {
+	if value, ok := list[name]; ok {
+		return &value
+	}
+	return nil
+}
+
+// fitLimitRange adjusts the debug container's resources to the Container
+// constraints of the namespace LimitRanges: min and max, the defaults the
+// LimitRanger would fill in, and maxLimitRequestRatio. It returns the fitted
+// resources and a description of every change.
+func fitLimitRange(res containerResources, limitRanges []corev1.LimitRange) (containerResources, []string) {
+	var changes []string
+	adjust := func(what string, value *resource.Quantity, bounds quantityBounds) {
+		fitted, reason := bounds.fit(*value)
+		if reason != "" {
+			changes = append(changes, fmt.Sprintf("%s %s -> %s (%s)", what, value.String(), fitted.String(), reason))
+			*value = fitted
+		}
+	}
+
+	for _, lr := range limitRanges {
+		for _, item := range lr.Spec.Limits {
+			if item.Type != corev1.LimitTypeContainer {
+				continue
+			}
+			cpuLimit := lookup(item.Default, corev1.ResourceCPU)
+
+			cpu := quantityBounds{lookup(item.Min, corev1.ResourceCPU), lookup(item.Max, corev1.ResourceCPU), lookup(item.DefaultRequest, corev1.ResourceCPU)}
+			// The debug container sets no CPU limit, so the LimitRanger fills in
+			// the default one and the request must not exceed it
+			if cpuLimit != nil && (cpu.max == nil || cpuLimit.Cmp(*cpu.max) < 0) {
+				cpu.max = cpuLimit
+			}
+			adjust("cpu request", &res.CPURequest, cpu)
+
+			adjust("memory limit", &res.MemoryLimit, quantityBounds{
+				lookup(item.Min, corev1.ResourceMemory), lookup(item.Max, corev1.ResourceMemory), lookup(item.Default, corev1.ResourceMemory)})
+			memory := quantityBounds{lookup(item.Min, corev1.ResourceMemory), &res.MemoryLimit, lookup(item.DefaultRequest, corev1.ResourceMemory)}
+			if ratio := lookup(item.MaxLimitRequestRatio, corev1.ResourceMemory); ratio != nil && ratio.Sign() > 0 {
+				least := resource.NewQuantity(int64(math.Ceil(float64(res.MemoryLimit.Value())/ratio.AsApproximateFloat64())), resource.BinarySI)
+				if memory.min == nil || least.Cmp(*memory.min) > 0 {
+					memory.min = least
+				}
+			}
+			adjust("memory request", &res.MemoryRequest, memory)
+
+			if ratio := lookup(item.MaxLimitRequestRatio, corev1.ResourceCPU); ratio != nil && ratio.Sign() > 0 && cpuLimit != nil {
+				least := resource.NewMilliQuantity(int64(math.Ceil(float64(cpuLimit.MilliValue())/ratio.AsApproximateFloat64())), resource.DecimalSI)
+				adjust("cpu request", &res.CPURequest, quantityBounds{min: least, max: cpuLimit})
+			}
+		}
+	}
+	return res, changes
+}
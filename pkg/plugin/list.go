@@ -2,8 +2,10 @@ package plugin
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 
@@ -21,11 +23,17 @@ type DebugPodInfo struct {
 	CreationTimestamp time.Time `json:"-"`
 	Image             string    `json:"image"`
 	Node              string    `json:"node,omitempty"`
+	CreatedBy         string    `json:"created_by,omitempty"`
+	Attaches          int       `json:"attaches"`
+	SessionSeconds    int64     `json:"session_seconds"`
+	Attached          bool      `json:"attached"`
+	RemoveOwner       string    `json:"remove_owner,omitempty"`
 }
 
 var (
 	listAllNamespaces bool
 	outputFormat      string
+	listNoPager       bool
 )
 
 var listCmd = &cobra.Command{
@@ -34,18 +42,19 @@ var listCmd = &cobra.Command{
 	Long: `List all active debug pods created by kpdbug tool.
 Shows information about debug pods including their status, target pod, and age.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runList()
+		return runList(cmd.Context())
 	},
 }
 
 func init() {
 	listCmd.Flags().BoolVarP(&listAllNamespaces, "all-namespaces", "A", false, "list debug pods across all namespaces")
-	listCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "output format (table, json, yaml)")
+	listCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "output format (table, wide, json, yaml)")
+	listCmd.Flags().BoolVar(&listNoPager, "no-pager", false, "print the table directly instead of through $PAGER when it does not fit on the terminal")
 	rootCmd.AddCommand(listCmd)
 }
 
-func runList() error {
-	debugPods, err := getDebugPods()
+func runList(ctx context.Context) error {
+	debugPods, err := getDebugPods(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get debug pods: %v", err)
 	}
@@ -60,31 +69,50 @@ func runList() error {
 		return outputJSON(debugPods)
 	case "yaml":
 		return outputYAML(debugPods)
-	default:
-		return outputTable(debugPods)
 	}
+	var table bytes.Buffer
+	outputTable(&table, debugPods, outputFormat == "wide")
+	return writePaged(ctx, table.Bytes(), listNoPager)
 }
 
-func getDebugPods() ([]DebugPodInfo, error) {
+func getDebugPods(ctx context.Context) ([]DebugPodInfo, error) {
+	config := &DebugConfig{Context: ctx}
+	if !listAllNamespaces {
+		config.Namespace = currentNamespace(ctx)
+	}
+	return config.ListDebugPods(listAllNamespaces)
+}
+
+// ListDebugPods returns the debug pods in the config's namespace, or in all
+// namespaces
+func (config *DebugConfig) ListDebugPods(allNamespaces bool) ([]DebugPodInfo, error) {
 	var args []string
-	if listAllNamespaces {
+	if allNamespaces {
 		args = []string{"get", "pods", "--all-namespaces",
 			"-l", "debug-tool/type=debug-pod", "-o", "json"}
 	} else {
-		args = []string{"get", "pods", "-n", namespace,
+		args = []string{"get", "pods", "-n", config.Namespace,
 			"-l", "debug-tool/type=debug-pod", "-o", "json"}
 	}
 
-	cmd := ExecCommand("kubectl", args...)
-
+	var output []byte
 	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-	output, err := cmd.Output()
+	err := withRetry(config.context(), func() error {
+		cmd := config.kubectl(args...)
+		stderr.Reset()
+		cmd.Stderr = &stderr
+		var err error
+		output, err = cmd.Output()
+		if err != nil {
+			return fmt.Errorf("%v - %s", err, stderr.String())
+		}
+		return nil
+	})
 	if err != nil {
 		if strings.Contains(stderr.String(), "No resources found") {
 			return []DebugPodInfo{}, nil
 		}
-		return nil, fmt.Errorf("error listing pods: %v - %s", err, stderr.String())
+		return nil, fmt.Errorf("error listing pods: %v", err)
 	}
 
 	var podList corev1.PodList
@@ -94,33 +122,48 @@ func getDebugPods() ([]DebugPodInfo, error) {
 
 	var debugPods []DebugPodInfo
 	for _, pod := range podList.Items {
-		debugPod := DebugPodInfo{
-			Name:              pod.Name,
-			Namespace:         pod.Namespace,
-			Status:            string(pod.Status.Phase),
-			Age:               calculateAge(pod.CreationTimestamp.Time),
-			CreationTimestamp: pod.CreationTimestamp.Time,
-			Node:              pod.Spec.NodeName,
-		}
+		debugPods = append(debugPods, newDebugPodInfo(pod))
+	}
 
-		// Get target pod from labels
-		if targetPod, exists := pod.Labels["debug-tool/target"]; exists {
-			debugPod.TargetPod = targetPod
-		}
+	return debugPods, nil
+}
 
-		// Get image from first container
-		if len(pod.Spec.Containers) > 0 {
-			debugPod.Image = pod.Spec.Containers[0].Image
-		}
+func newDebugPodInfo(pod corev1.Pod) DebugPodInfo {
+	debugPod := DebugPodInfo{
+		Name:              pod.Name,
+		Namespace:         pod.Namespace,
+		Status:            string(pod.Status.Phase),
+		Age:               calculateAge(pod.CreationTimestamp.Time),
+		CreationTimestamp: pod.CreationTimestamp.Time,
+		Node:              pod.Spec.NodeName,
+		CreatedBy:         pod.Annotations[createdByAnnotation],
+		RemoveOwner:       pod.Annotations[removeAfterAnnotation],
+	}
+
+	usage := parseSessionUsage(pod.Annotations)
+	debugPod.Attaches = usage.Attaches
+	debugPod.SessionSeconds = int64(usage.total(clock()).Seconds())
+	debugPod.Attached = usage.attached()
 
-		debugPods = append(debugPods, debugPod)
+	// Get target pod from labels
+	if targetPod, exists := pod.Labels["debug-tool/target"]; exists {
+		debugPod.TargetPod = targetPod
 	}
 
-	return debugPods, nil
+	// Get image from first container
+	if len(pod.Spec.Containers) > 0 {
+		debugPod.Image = pod.Spec.Containers[0].Image
+	}
+
+	return debugPod
 }
 
 func calculateAge(creationTime time.Time) string {
-	duration := time.Since(creationTime)
+	duration := since(creationTime)
+	if duration < 0 {
+		// Clock skew, or the stopped clock of deterministic mode
+		duration = 0
+	}
 
 	if duration < time.Minute {
 		return fmt.Sprintf("%ds", int(duration.Seconds()))
@@ -133,46 +176,61 @@ func calculateAge(creationTime time.Time) string {
 	}
 }
 
-func outputTable(debugPods []DebugPodInfo) error {
+// listColumn is a column of the debug pod table
+type listColumn struct {
+	header string
+	width  int
+	value  func(DebugPodInfo) string
+}
+
+// outputTable writes the debug pods as a table; wide adds the session
+// time and attach count recorded by trackSession
+func outputTable(w io.Writer, debugPods []DebugPodInfo, wide bool) {
+	columns := []listColumn{
+		{"NAME", 30, func(pod DebugPodInfo) string { return truncateString(pod.Name, 30) }},
+	}
 	if listAllNamespaces {
-		fmt.Printf("%-30s %-15s %-20s %-12s %-8s %-25s\n",
-			"NAME", "NAMESPACE", "TARGET", "STATUS", "AGE", "IMAGE")
-		fmt.Printf("%-30s %-15s %-20s %-12s %-8s %-25s\n",
-			"----", "---------", "------", "------", "---", "-----")
-
-		for _, pod := range debugPods {
-			target := pod.TargetPod
-			if target == "" {
-				target = "<standalone>"
-			}
-			fmt.Printf("%-30s %-15s %-20s %-12s %-8s %-25s\n",
-				truncateString(pod.Name, 30),
-				pod.Namespace,
-				truncateString(target, 20),
-				pod.Status,
-				pod.Age,
-				truncateString(pod.Image, 25))
-		}
-	} else {
-		fmt.Printf("%-30s %-20s %-12s %-8s %-25s\n",
-			"NAME", "TARGET", "STATUS", "AGE", "IMAGE")
-		fmt.Printf("%-30s %-20s %-12s %-8s %-25s\n",
-			"----", "------", "------", "---", "-----")
-
-		for _, pod := range debugPods {
-			target := pod.TargetPod
-			if target == "" {
-				target = "<standalone>"
+		columns = append(columns, listColumn{"NAMESPACE", 15, func(pod DebugPodInfo) string { return pod.Namespace }})
+	}
+	columns = append(columns,
+		listColumn{"TARGET", 20, func(pod DebugPodInfo) string {
+			if pod.TargetPod == "" {
+				return "<standalone>"
 			}
-			fmt.Printf("%-30s %-20s %-12s %-8s %-25s\n",
-				truncateString(pod.Name, 30),
-				truncateString(target, 20),
-				pod.Status,
-				pod.Age,
-				truncateString(pod.Image, 25))
+			return truncateString(pod.TargetPod, 20)
+		}},
+		listColumn{"STATUS", 12, func(pod DebugPodInfo) string { return pod.Status }},
+		listColumn{"AGE", 8, func(pod DebugPodInfo) string { return pod.Age }},
+		listColumn{"IMAGE", 25, func(pod DebugPodInfo) string { return truncateString(pod.Image, 25) }},
+	)
+	if wide {
+		columns = append(columns,
+			listColumn{"SESSION TIME", 12, func(pod DebugPodInfo) string {
+				if pod.Attaches == 0 {
+					return "-"
+				}
+				session := formatSessionTime(time.Duration(pod.SessionSeconds) * time.Second)
+				if pod.Attached {
+					session += "+"
+				}
+				return session
+			}},
+			listColumn{"ATTACHES", 8, func(pod DebugPodInfo) string { return fmt.Sprint(pod.Attaches) }},
+		)
+	}
+
+	printRow := func(cell func(listColumn) string) {
+		cells := make([]string, len(columns))
+		for i, column := range columns {
+			cells[i] = fmt.Sprintf("%-*s", column.width, cell(column))
 		}
+		fmt.Fprintln(w, strings.Join(cells, " "))
+	}
+	printRow(func(column listColumn) string { return column.header })
+	printRow(func(column listColumn) string { return strings.Repeat("-", len(column.header)) })
+	for _, pod := range debugPods {
+		printRow(func(column listColumn) string { return column.value(pod) })
 	}
-	return nil
 }
 
 func outputJSON(debugPods []DebugPodInfo) error {
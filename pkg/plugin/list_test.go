@@ -0,0 +1,42 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestListTable(t *testing.T) {
+	pods := []DebugPodInfo{
+		{Name: "debug-a", Status: "Running", Age: "5m", Image: "busybox", Attaches: 2, SessionSeconds: 90, Attached: true},
+		{Name: "debug-b", TargetPod: "web-0", Status: "Pending", Age: "1m", Image: "busybox"},
+	}
+	var table bytes.Buffer
+	outputTable(&table, pods, true)
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	if len(lines) != 4 || !strings.Contains(lines[0], "SESSION TIME") || !strings.Contains(lines[2], "1m30s+") ||
+		!strings.Contains(lines[3], "web-0") {
+		t.Errorf("outputTable(wide) = %q", table.String())
+	}
+
+	// Output that is not a terminal is never paged
+	origStdout := os.Stdout
+	defer func() { os.Stdout = origStdout }()
+	t.Setenv("PAGER", "false")
+	t.Setenv("LINES", "1")
+	read, write, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = write
+	err = writePaged(context.Background(), table.Bytes(), false)
+	os.Stdout = origStdout
+	_ = write.Close()
+	paged, _ := io.ReadAll(read)
+	if err != nil || !bytes.Equal(paged, table.Bytes()) {
+		t.Errorf("writePaged() to a pipe = %q, %v, want the table unchanged", paged, err)
+	}
+}
@@ -0,0 +1,45 @@
+package plugin
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	logsFollow bool
+	logsTail   int
+)
+
+var logsCmd = &cobra.Command{
+	Use:   "logs <debug-pod>",
+	Short: "Print the logs of a debug pod",
+	Long: `Print the logs of a debug pod created by kpdbug tool.
+Use 'kpdbug list' to find the names of active debug pods.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeDebugPodNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logArgs := []string{"logs", args[0], "-n", currentNamespace(cmd.Context())}
+		if logsFollow {
+			logArgs = append(logArgs, "-f")
+		}
+		if logsTail >= 0 {
+			logArgs = append(logArgs, "--tail="+strconv.Itoa(logsTail))
+		}
+
+		logCmd := kubectlCommand(cmd.Context(), logArgs...)
+		logCmd.Stdout = os.Stdout
+		logCmd.Stderr = os.Stderr
+		if err := logCmd.Run(); err != nil {
+			return WrapKubectlError(err, "get debug pod logs")
+		}
+		return nil
+	},
+}
+
+func init() {
+	logsCmd.Flags().BoolVar(&logsFollow, "follow", false, "stream the logs (-f is the global --force)")
+	logsCmd.Flags().IntVar(&logsTail, "tail", -1, "number of recent lines to show, -1 shows all")
+	rootCmd.AddCommand(logsCmd)
+}
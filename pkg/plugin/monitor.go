@@ -0,0 +1,242 @@
+package plugin
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	monitorInterval time.Duration
+	monitorDuration time.Duration
+	monitorOut      string
+	monitorFile     string
+)
+
+var monitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "Record timeseries of the target's processes",
+	Long:  `Monitoring helpers that sample the target's processes from an ephemeral debug container for a long time.`,
+}
+
+var monitorRSSCmd = &cobra.Command{
+	Use:   "rss",
+	Short: "Sample per-process memory of the target into a timeseries file",
+	Long: `Add an ephemeral debug container to the target pod and sample the memory of
+every process of the target container through the shared PID namespace:
+resident set size, anonymous memory, the [heap] mapping and swap, all in KiB.
+
+Samples are written to the file as they arrive, so the timeseries survives
+Ctrl-C. At the end the growth of every process is printed; a steady growth
+of anonymous memory is the usual sign of a leak. The sampler stops by itself
+after --duration.`,
+	Example: `  kpdbug monitor rss -p mypod --interval 30s --duration 2h --out csv
+  kpdbug monitor rss -p mypod --container app --interval 1m --duration 12h --out jsonl --file leak.jsonl`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runMonitorRSS(cmd)
+	},
+}
+
+func init() {
+	monitorRSSCmd.Flags().DurationVar(&monitorInterval, "interval", 30*time.Second, "time between samples")
+	monitorRSSCmd.Flags().DurationVar(&monitorDuration, "duration", time.Hour, "how long to sample")
+	monitorRSSCmd.Flags().StringVar(&monitorOut, "out", "csv", "file format: csv or jsonl")
+	monitorRSSCmd.Flags().StringVar(&monitorFile, "file", "", "path of the timeseries (default <pod>-rss-<timestamp>.<format>)")
+	monitorCmd.AddCommand(monitorRSSCmd)
+	rootCmd.AddCommand(monitorCmd)
+}
+
+// rssScript prints RSS|<epoch>|<pid>|<comm>|<rss>|<anon>|<heap>|<swap> for
+// every process in the mount namespace of the target's main process, every
+// interval until duration has passed
+func rssScript(interval, duration time.Duration) string {
+	return targetPIDScript + fmt.Sprintf(`mntns=$(readlink /proc/$pid/ns/mnt)
+end=$(( $(date +%%s) + %[1]d ))
+while [ "$(date +%%s)" -lt "$end" ]; do
+  now=$(date +%%s)
+  for dir in /proc/[0-9]*; do
+    p=${dir#/proc/}
+    [ "$(readlink "$dir/ns/mnt" 2>/dev/null)" = "$mntns" ] || continue
+    stats=$(awk '/^VmRSS:/ {rss=$2} /^RssAnon:/ {anon=$2} /^VmSwap:/ {swap=$2} END {print rss+0 "|" anon+0 "|" swap+0}' "$dir/status" 2>/dev/null) || continue
+    case "$stats" in 0\|*) continue;; esac
+    heap=$(awk '/\[heap\]/ {h=1; next} /^[0-9a-f]+-/ {h=0} h && /^Rss:/ {kb+=$2} END {print kb+0}' "$dir/smaps" 2>/dev/null)
+    echo "RSS|$now|$p|$(cat "$dir/comm" 2>/dev/null)|${stats%%%%|*}|$(echo "$stats" | cut -d'|' -f2)|${heap:-0}|${stats##*|}"
+  done
+  sleep %[2]d
+done`, max(int(duration.Seconds()), 1), max(int(interval.Seconds()), 1))
+}
+
+// rssSample is the memory of one process at one time, in KiB
+type rssSample struct {
+	Time    time.Time `json:"time"`
+	PID     int       `json:"pid"`
+	Command string    `json:"command"`
+	RSS     int64     `json:"rssKiB"`
+	Anon    int64     `json:"anonKiB"`
+	Heap    int64     `json:"heapKiB"`
+	Swap    int64     `json:"swapKiB"`
+}
+
+// parseRSSSample parses one RSS line of rssScript
+func parseRSSSample(line string) (rssSample, bool) {
+	fields := strings.Split(strings.TrimSpace(line), "|")
+	if len(fields) != 8 || fields[0] != "RSS" {
+		return rssSample{}, false
+	}
+	epoch, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return rssSample{}, false
+	}
+	pid, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return rssSample{}, false
+	}
+	values := make([]int64, 4)
+	for i := range values {
+		values[i], _ = strconv.ParseInt(fields[4+i], 10, 64)
+	}
+	return rssSample{
+		Time:    time.Unix(epoch, 0).UTC(),
+		PID:     pid,
+		Command: fields[3],
+		RSS:     values[0],
+		Anon:    values[1],
+		Heap:    values[2],
+		Swap:    values[3],
+	}, true
+}
+
+// rssWriter appends samples to the timeseries file in the chosen format
+type rssWriter struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+func newRSSWriter(w io.Writer, format string) *rssWriter {
+	if format == "jsonl" {
+		return &rssWriter{json: json.NewEncoder(w)}
+	}
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{"time", "pid", "command", "rss_kib", "anon_kib", "heap_kib", "swap_kib"})
+	writer.Flush()
+	return &rssWriter{csv: writer}
+}
+
+func (w *rssWriter) write(sample rssSample) error {
+	if w.json != nil {
+		return w.json.Encode(sample)
+	}
+	_ = w.csv.Write([]string{
+		sample.Time.Format(time.RFC3339), strconv.Itoa(sample.PID), sample.Command,
+		strconv.FormatInt(sample.RSS, 10), strconv.FormatInt(sample.Anon, 10),
+		strconv.FormatInt(sample.Heap, 10), strconv.FormatInt(sample.Swap, 10),
+	})
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+// rssGrowth is the change of a process' memory between its first and last
+// sample
+type rssGrowth struct {
+	PID       int
+	Command   string
+	First     rssSample
+	Last      rssSample
+	PerHourKB float64
+}
+
+// summarizeRSS returns the growth of every process, largest growth first
+func summarizeRSS(samples []rssSample) []rssGrowth {
+	byPID := map[int]*rssGrowth{}
+	for _, sample := range samples {
+		growth, ok := byPID[sample.PID]
+		if !ok {
+			byPID[sample.PID] = &rssGrowth{PID: sample.PID, Command: sample.Command, First: sample, Last: sample}
+			continue
+		}
+		growth.Last = sample
+	}
+
+	growths := make([]rssGrowth, 0, len(byPID))
+	for _, growth := range byPID {
+		if hours := growth.Last.Time.Sub(growth.First.Time).Hours(); hours > 0 {
+			growth.PerHourKB = float64(growth.Last.RSS-growth.First.RSS) / hours
+		}
+		growths = append(growths, *growth)
+	}
+	sort.Slice(growths, func(i, j int) bool {
+		if growths[i].PerHourKB != growths[j].PerHourKB {
+			return growths[i].PerHourKB > growths[j].PerHourKB
+		}
+		return growths[i].PID < growths[j].PID
+	})
+	return growths
+}
+
+func runMonitorRSS(cmd *cobra.Command) error {
+	if monitorOut != "csv" && monitorOut != "jsonl" {
+		return NewValidationError("out", monitorOut, "must be one of: csv, jsonl")
+	}
+	config, err := newTargetConfig(cmd.Context(), cmd, "", "general")
+	if err != nil {
+		return err
+	}
+	path := monitorFile
+	if path == "" {
+		path = fmt.Sprintf("%s-rss-%s.%s", config.PodName, clock().Format("20060102-150405"), monitorOut)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %v", path, err)
+	}
+	defer file.Close()
+	writer := newRSSWriter(file, monitorOut)
+
+	var samples []rssSample
+	log.Printf("Sampling memory of pod %s every %s for %s into %s; press Ctrl-C to stop", config.PodName, monitorInterval, monitorDuration, path)
+	_, err = config.streamEphemeralScript(config.PodName, rssScript(monitorInterval, monitorDuration), func(line string) {
+		sample, ok := parseRSSSample(line)
+		if !ok {
+			return
+		}
+		samples = append(samples, sample)
+		if err := writer.write(sample); err != nil {
+			log.Printf("Warning: Failed to write sample: %v", err)
+		}
+	})
+	// Ctrl-C ends the session early; the samples so far are kept
+	if err != nil && config.context().Err() == nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return NewDetailedError(ErrorTypeValidation, "no samples were recorded").
+			WithSuggestion("Check that the target container is running")
+	}
+
+	fmt.Printf("%-8s %-20s %12s %12s %14s\n", "PID", "COMMAND", "FIRST RSS", "LAST RSS", "GROWTH/HOUR")
+	for _, growth := range summarizeRSS(samples) {
+		fmt.Printf("%-8d %-20s %12s %12s %14s\n", growth.PID, truncateString(growth.Command, 20),
+			formatKB(growth.First.RSS), formatKB(growth.Last.RSS), formatGrowthKB(int64(growth.PerHourKB)))
+	}
+	log.Printf("Wrote %d samples to %s", len(samples), path)
+	return nil
+}
+
+// formatGrowthKB renders a signed change in KiB
+func formatGrowthKB(kb int64) string {
+	if kb < 0 {
+		return "-" + formatKB(-kb)
+	}
+	return "+" + formatKB(kb)
+}
@@ -0,0 +1,38 @@
+package plugin
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRSSMonitor(t *testing.T) {
+	var samples []rssSample
+	for _, line := range []string{
+		"RSS|1700000000|7|app|102400|90000|4096|0",
+		"RSS|1700000000|9|sidecar|2048|1024|0|0",
+		"not a sample",
+		"RSS|1700003600|7|app|204800|190000|4096|0",
+		"RSS|1700003600|9|sidecar|2048|1024|0|0",
+	} {
+		if sample, ok := parseRSSSample(line); ok {
+			samples = append(samples, sample)
+		}
+	}
+	if len(samples) != 4 || samples[0].Command != "app" || samples[0].Heap != 4096 {
+		t.Fatalf("parseRSSSample() = %+v", samples)
+	}
+
+	growths := summarizeRSS(samples)
+	if len(growths) != 2 || growths[0].PID != 7 || growths[0].PerHourKB != 102400 || growths[1].PerHourKB != 0 {
+		t.Errorf("summarizeRSS() = %+v", growths)
+	}
+
+	var buf bytes.Buffer
+	writer := newRSSWriter(&buf, "csv")
+	if err := writer.write(samples[0]); err != nil {
+		t.Fatal(err)
+	}
+	if want := "time,pid,command,rss_kib,anon_kib,heap_kib,swap_kib\n2023-11-14T22:13:20Z,7,app,102400,90000,4096,0\n"; buf.String() != want {
+		t.Errorf("csv = %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,122 @@
+package plugin
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	mqType string
+	mqYes  bool
+)
+
+var mqCmd = &cobra.Command{
+	Use:   "mq",
+	Short: "Open a messaging shell configured like the target container",
+	Long: `Add an ephemeral container with Kafka or RabbitMQ tools to the target pod and
+open a shell preconfigured with the broker settings of the target container,
+to tail topics and inspect consumer lag or queue depth in one step. The
+environment is copied from the target container as in "kpdbug db", after
+confirmation unless --yes is set.
+
+Kafka shells read KAFKA_BOOTSTRAP_SERVERS, KAFKA_BROKERS or
+SPRING_KAFKA_BOOTSTRAP_SERVERS, plus KAFKA_SECURITY_PROTOCOL,
+KAFKA_SASL_MECHANISM, KAFKA_SASL_USERNAME and KAFKA_SASL_PASSWORD, and
+provide:
+  topics              list topics
+  consume <topic> ... console consumer, extra arguments are passed through
+  groups              list consumer groups
+  lag [group]         offsets and lag of one or all consumer groups
+
+RabbitMQ shells read RABBITMQ_URL or AMQP_URL, or RABBITMQ_HOST,
+RABBITMQ_USERNAME and RABBITMQ_PASSWORD, and provide:
+  queues              queues with message and consumer counts
+  rmq ...             rabbitmqadmin against the broker's management API`,
+	Example: `  kpdbug mq -p mypod --type kafka
+  kpdbug mq -p mypod --container worker --type rabbitmq --yes`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		client, ok := mqClients[mqType]
+		if !ok {
+			return NewValidationError("type", mqType, "must be one of: "+strings.Join(clientTypes(mqClients), ", "))
+		}
+		return runClientTool(cmd, mqType, client, mqYes)
+	},
+}
+
+func init() {
+	mqCmd.Flags().StringVar(&mqType, "type", "", "broker type: "+strings.Join(clientTypes(mqClients), ", ")+" (required)")
+	mqCmd.Flags().BoolVar(&mqYes, "yes", false, "copy the environment of the target container without asking")
+	_ = mqCmd.MarkFlagRequired("type")
+	rootCmd.AddCommand(mqCmd)
+}
+
+// mqClients maps broker types to shells with helper functions; each script
+// writes the client configuration and an rc file, then starts bash with it
+var mqClients = map[string]clientTool{
+	"kafka": {
+		Image: "apache/kafka:3.9.0",
+		Script: `export KPDBUG_BOOTSTRAP="${KAFKA_BOOTSTRAP_SERVERS:-${KAFKA_BROKERS:-${KAFKA_BROKER_LIST:-${SPRING_KAFKA_BOOTSTRAP_SERVERS:-${BOOTSTRAP_SERVERS:-localhost:9092}}}}}"
+export KPDBUG_KAFKA_CONFIG=/tmp/kpdbug-kafka.properties
+: > "$KPDBUG_KAFKA_CONFIG"
+protocol="${KAFKA_SECURITY_PROTOCOL:-}"
+mechanism="${KAFKA_SASL_MECHANISM:-}"
+username="${KAFKA_SASL_USERNAME:-}"
+if [ -n "$username" ] && [ -z "$protocol" ]; then protocol=SASL_SSL; fi
+if [ -n "$username" ] && [ -z "$mechanism" ]; then mechanism=PLAIN; fi
+if [ -n "$protocol" ]; then echo "security.protocol=$protocol" >> "$KPDBUG_KAFKA_CONFIG"; fi
+if [ -n "$mechanism" ]; then echo "sasl.mechanism=$mechanism" >> "$KPDBUG_KAFKA_CONFIG"; fi
+if [ -n "$username" ]; then
+  case "$mechanism" in
+    SCRAM-*) module=org.apache.kafka.common.security.scram.ScramLoginModule;;
+    *) module=org.apache.kafka.common.security.plain.PlainLoginModule;;
+  esac
+  echo "sasl.jaas.config=$module required username=\"$username\" password=\"${KAFKA_SASL_PASSWORD:-}\";" >> "$KPDBUG_KAFKA_CONFIG"
+fi
+cat > /tmp/kpdbug.rc <<'EOF'
+export PATH="/opt/kafka/bin:$PATH"
+topics() { kafka-topics.sh --bootstrap-server "$KPDBUG_BOOTSTRAP" --command-config "$KPDBUG_KAFKA_CONFIG" --list; }
+consume() { topic=$1; shift; kafka-console-consumer.sh --bootstrap-server "$KPDBUG_BOOTSTRAP" --consumer.config "$KPDBUG_KAFKA_CONFIG" --topic "$topic" "$@"; }
+groups() { kafka-consumer-groups.sh --bootstrap-server "$KPDBUG_BOOTSTRAP" --command-config "$KPDBUG_KAFKA_CONFIG" --list; }
+lag() {
+  if [ -n "$1" ]; then set -- --group "$1"; else set -- --all-groups; fi
+  kafka-consumer-groups.sh --bootstrap-server "$KPDBUG_BOOTSTRAP" --command-config "$KPDBUG_KAFKA_CONFIG" --describe "$@"
+}
+echo "Kafka at $KPDBUG_BOOTSTRAP. Helpers: topics, consume <topic> [args], groups, lag [group]"
+EOF
+exec bash --rcfile /tmp/kpdbug.rc -i`,
+	},
+	"rabbitmq": {
+		Image: "rabbitmq:3-management",
+		Script: `url="${RABBITMQ_URL:-${AMQP_URL:-${CLOUDAMQP_URL:-}}}"
+host="${RABBITMQ_HOST:-127.0.0.1}"
+username="${RABBITMQ_USERNAME:-${RABBITMQ_USER:-${RABBITMQ_DEFAULT_USER:-guest}}}"
+password="${RABBITMQ_PASSWORD:-${RABBITMQ_PASS:-${RABBITMQ_DEFAULT_PASS:-guest}}}"
+vhost="${RABBITMQ_VHOST:-/}"
+if [ -n "$url" ]; then
+  rest=${url#*://}
+  case "$rest" in
+    *@*) creds=${rest%%@*}; rest=${rest#*@}; username=${creds%%:*}; password=${creds#*:};;
+  esac
+  host=${rest%%/*}; host=${host%%:*}
+  case "$rest" in */?*) vhost=${rest#*/}; vhost=${vhost%%\?*};; esac
+  if [ "$vhost" = "%2F" ] || [ "$vhost" = "%2f" ]; then vhost=/; fi
+fi
+export KPDBUG_RMQ_CONFIG=/tmp/kpdbug-rabbitmqadmin.conf
+cat > "$KPDBUG_RMQ_CONFIG" <<EOF
+[default]
+hostname = $host
+port = ${RABBITMQ_MANAGEMENT_PORT:-15672}
+username = $username
+password = $password
+vhost = $vhost
+EOF
+cat > /tmp/kpdbug.rc <<'EOF'
+rmq() { rabbitmqadmin -c "$KPDBUG_RMQ_CONFIG" -N default "$@"; }
+queues() { rmq list queues name messages messages_unacknowledged consumers; }
+echo "RabbitMQ management API at $(sed -n 's/^hostname = //p' "$KPDBUG_RMQ_CONFIG"). Helpers: queues, rmq ..."
+EOF
+exec bash --rcfile /tmp/kpdbug.rc -i`,
+	},
+}
@@ -0,0 +1,102 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// runMultiTarget runs the --command in every -p target at the same time,
+// each in the debug pod or ephemeral container a single -p would get. The
+// output lines of every target are prefixed with [target], and a summary
+// table with the exit codes follows.
+func runMultiTarget(ctx context.Context, targets []string) error {
+	if remoteCommand == "" {
+		return NewValidationError("pod", strings.Join(targets, ","), "-p can only be repeated with --command").
+			WithSuggestion("Interactive sessions take one target; run a --command, or kpdbug each -l <selector> for every pod of a workload")
+	}
+	if tty {
+		return NewValidationError("tty", "true", "-t cannot be combined with several -p targets")
+	}
+	seen := map[string]bool{}
+	for _, target := range targets {
+		if seen[target] {
+			return NewValidationError("pod", target, "is given more than once")
+		}
+		seen[target] = true
+	}
+
+	// Loaded once, and the namespace resolved, before the sessions would
+	// race to load them
+	currentConfig()
+	configs := make([]*DebugConfig, len(targets))
+	for i, target := range targets {
+		configs[i] = targetCommandConfig(ctx, target)
+	}
+
+	log.Printf("Running command in %d targets...", len(targets))
+	results := make([]eachResult, len(targets))
+	var wg sync.WaitGroup
+	for i, config := range configs {
+		wg.Add(1)
+		go func(i int, config *DebugConfig) {
+			defer wg.Done()
+			results[i] = runTargetCommand(config, targets[i])
+		}(i, config)
+	}
+	wg.Wait()
+
+	fmt.Println()
+	failed := printResultSummary("TARGET", results)
+	if failed > 0 {
+		return NewDetailedError(ErrorTypeKubectl,
+			fmt.Sprintf("Command failed in %d of %d targets", failed, len(results)))
+	}
+	return nil
+}
+
+// targetCommandConfig builds the config of one of several targets from the
+// flags. Its progress lines are prefixed with the target, and its session
+// does not read stdin, which the sessions would have to share.
+func targetCommandConfig(ctx context.Context, target string) *DebugConfig {
+	config := NewDebugConfigFromFlags()
+	config.Context = ctx
+	config.PodName, config.Workload = target, ""
+	config.selectOperation()
+	config.Stdin = strings.NewReader("")
+	config.logPrefix = fmt.Sprintf("[%s] ", target)
+	return config
+}
+
+// runTargetCommand runs the --command in one of several targets, with its
+// output and kubectl's errors prefixed with the target
+func runTargetCommand(config *DebugConfig, target string) eachResult {
+	prefix := fmt.Sprintf("[%s] ", target)
+	stdout := &prefixWriter{w: os.Stdout, prefix: prefix, eol: "\n"}
+	stderr := &prefixWriter{w: os.Stderr, prefix: prefix, eol: "\n"}
+	defer stdout.Flush()
+	defer stderr.Flush()
+	var output bytes.Buffer
+	config.Stdout = io.MultiWriter(stdout, &output)
+	config.Stderr = stderr
+
+	err := config.resolveTarget()
+	if err == nil {
+		_, err = config.Execute()
+	}
+	result := eachResult{Pod: target, Output: output.String()}
+	var exitErr *ExitCodeError
+	switch {
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.Code
+	case err != nil:
+		result.ExitCode, result.Err = -1, err
+	}
+	return result
+}
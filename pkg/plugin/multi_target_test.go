@@ -0,0 +1,63 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMultiTarget(t *testing.T) {
+	clusterPolicyOnce.Do(func() {})
+	origRunner, origStderr, oldCommand, oldNamespace := defaultRunner, os.Stderr, remoteCommand, namespace
+	defer func() {
+		defaultRunner, os.Stderr, remoteCommand, namespace = origRunner, origStderr, oldCommand, oldNamespace
+		loadedConfig = nil
+		log.SetOutput(os.Stderr)
+	}()
+	loadedConfig = &Config{}
+	defaultRunner = fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}}
+
+	// More than one target needs a command
+	remoteCommand = ""
+	if err := runMultiTarget(context.Background(), []string{"db-0", "db-1"}); err == nil {
+		t.Error("runMultiTarget() without --command succeeded")
+	}
+
+	// The namespace of the kubeconfig context is resolved before the
+	// sessions start
+	remoteCommand, namespace = "hostname", ""
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	read, write, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stderr = write
+	err = runMultiTarget(context.Background(), []string{"db-0", "db-1", "missing-0"})
+	os.Stderr = origStderr
+	_ = write.Close()
+	stderr, _ := io.ReadAll(read)
+	_ = read.Close()
+
+	var detailed *DetailedError
+	if !errors.As(err, &detailed) || detailed.Message != "Command failed in 1 of 3 targets" {
+		t.Errorf("runMultiTarget() = %v, want the missing target to fail", err)
+	}
+	for _, want := range []string{`[db-0] [mock] db-0: would run "sh -c hostname"`, `[db-1] [mock] db-1: would run "sh -c hostname"`} {
+		if !strings.Contains(string(stderr), want+"\n") {
+			t.Errorf("stderr = %q, want the line %q", stderr, want)
+		}
+	}
+
+	// Every target's progress lines are marked with it
+	for _, target := range []string{"db-0", "db-1"} {
+		if !strings.Contains(logs.String(), " ["+target+"] ") {
+			t.Errorf("log = %q, want lines of %s", logs.String(), target)
+		}
+	}
+}
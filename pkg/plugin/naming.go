@@ -0,0 +1,149 @@
+package plugin
+
+import (
+	"strings"
+	"text/template"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// maxNameLength keeps generated names valid as DNS-1123 labels, which is
+// also what the pod hostname and the debug-tool/target label require
+const maxNameLength = validation.DNS1123LabelMaxLength
+
+// Naming configures generated debug pod names, e.g. for admission webhooks
+// that require team prefixes
+type Naming struct {
+	// Prefix replaces the default "debug" prefix
+	Prefix string `json:"prefix,omitempty"`
+	// Template is a Go template with {{.Prefix}}, {{.Target}}, {{.User}},
+	// {{.Date}}, {{.Time}} and {{.Random}}; a random suffix is appended when
+	// the template does not use {{.Random}}
+	Template string `json:"template,omitempty"`
+}
+
+// nameFields are the values available to the naming template
+type nameFields struct {
+	Prefix string
+	Target string
+	User   string
+	Date   string
+	Time   string
+	Random string
+}
+
+// defaultNameTemplate keeps the historical debug-<pod>-<HHMMSS>-<rand> format
+const (
+	defaultNameTemplate           = "{{.Prefix}}-{{.Target}}-{{.Time}}-{{.Random}}"
+	defaultStandaloneNameTemplate = "{{.Prefix}}-{{.Time}}-{{.Random}}"
+)
+
+// renderName builds a debug pod name from the naming settings
+func (config *DebugConfig) renderName(naming *Naming, now time.Time, random string) string {
+	fields := nameFields{
+		Prefix: "debug",
+		Target: config.PodName,
+		Date:   now.Format("20060102"),
+		Time:   now.Format("150405"),
+		Random: random,
+	}
+
+	text := defaultNameTemplate
+	if config.PodName == "" {
+		text = defaultStandaloneNameTemplate
+	}
+	if naming != nil {
+		if naming.Prefix != "" {
+			fields.Prefix = naming.Prefix
+		}
+		if naming.Template != "" {
+			text = naming.Template
+			if !strings.Contains(text, ".Random") {
+				text += "-{{.Random}}"
+			}
+		}
+	}
+	if strings.Contains(text, ".User") {
+		fields.User = userNamePart(config.currentUser())
+	}
+	fields.Prefix = sanitizeNamePart(fields.Prefix)
+	fields.Target = sanitizeNamePart(fields.Target)
+	fields.User = sanitizeNamePart(fields.User)
+
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(text)
+	if err != nil {
+		config.logf("Warning: invalid naming template %q: %v; using the default", text, err)
+		return config.renderName(nil, now, random)
+	}
+	name, err := executeNameTemplate(tmpl, fields)
+	if err != nil {
+		config.logf("Warning: invalid naming template %q: %v; using the default", text, err)
+		return config.renderName(nil, now, random)
+	}
+
+	// Long targets such as StatefulSet pods are shortened first, keeping the
+	// unique suffix; names still too long keep their head and the suffix
+	if overflow := len(name) - maxNameLength; overflow > 0 {
+		fields.Target = strings.TrimRight(fields.Target[:max(len(fields.Target)-overflow, 0)], "-")
+		name, _ = executeNameTemplate(tmpl, fields)
+	}
+	if len(name) > maxNameLength {
+		name = strings.TrimRight(name[:maxNameLength-len(random)-1], "-") + "-" + random
+	}
+	return name
+}
+
+// executeNameTemplate renders a name, dropping the separators left by empty
+// fields such as an unknown user
+func executeNameTemplate(tmpl *template.Template, fields nameFields) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, fields); err != nil {
+		return "", err
+	}
+	name := sb.String()
+	for strings.Contains(name, "--") {
+		name = strings.ReplaceAll(name, "--", "-")
+	}
+	return strings.Trim(name, "-"), nil
+}
+
+// sanitizeNamePart lowercases s and replaces characters not allowed in a
+// DNS-1123 label with dashes
+func sanitizeNamePart(s string) string {
+	var sb strings.Builder
+	for _, c := range strings.ToLower(s) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			sb.WriteRune(c)
+		} else {
+			sb.WriteByte('-')
+		}
+	}
+	return strings.Trim(sb.String(), "-")
+}
+
+// validatePodName checks the final name before anything is applied
+func validatePodName(name string) error {
+	if errs := validation.IsDNS1123Label(name); len(errs) > 0 {
+		return NewValidationError("debug pod name", name, strings.Join(errs, "; ")).
+			WithSuggestion("Adjust the naming prefix or template in the config file")
+	}
+	return nil
+}
+
+// targetLabelValue fits a target pod name into a label value; pod names may
+// be longer than the 63 characters labels allow
+func targetLabelValue(pod string) string {
+	if len(pod) <= validation.LabelValueMaxLength {
+		return pod
+	}
+	return strings.TrimRight(pod[:validation.LabelValueMaxLength], "-.")
+}
+
+// userNamePart keeps the local part of email-style usernames
+func userNamePart(user string) string {
+	if at := strings.Index(user, "@"); at >= 0 {
+		user = user[:at]
+	}
+	return strings.TrimPrefix(user, "system:serviceaccount:")
+}
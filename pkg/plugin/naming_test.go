@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderName(t *testing.T) {
+	now := time.Date(2026, 3, 4, 10, 20, 30, 0, time.UTC)
+	tests := []struct {
+		name   string
+		pod    string
+		naming *Naming
+		want   string
+	}{
+		{"default", "web-0", nil, "debug-web-0-102030-0042"},
+		{"default standalone", "", nil, "debug-102030-0042"},
+		{"prefix", "web-0", &Naming{Prefix: "team-a"}, "team-a-web-0-102030-0042"},
+		{"template", "web-0", &Naming{Prefix: "team-a", Template: "{{.Prefix}}-{{.Date}}-{{.Target}}"}, "team-a-20260304-web-0-0042"},
+		{"invalid template", "web-0", &Naming{Template: "{{.Nope"}, "debug-web-0-102030-0042"},
+		{"sanitized", "Web_0", &Naming{Prefix: "Team.A"}, "team-a-web-0-102030-0042"},
+		{
+			"long target",
+			"elasticsearch-data-hot-zone-a-production-cluster-statefulset-12",
+			nil,
+			"debug-elasticsearch-data-hot-zone-a-production-clus-102030-0042",
+		},
+		{
+			"long prefix",
+			"web-0",
+			&Naming{Prefix: strings.Repeat("p", 70)},
+			strings.Repeat("p", 58) + "-0042",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &DebugConfig{PodName: tt.pod}
+			got := config.renderName(tt.naming, now, "0042")
+			if got != tt.want {
+				t.Errorf("renderName() = %q, want %q", got, tt.want)
+			}
+			if err := validatePodName(got); err != nil {
+				t.Errorf("validatePodName(%q) error = %v", got, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package plugin
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var netCmd = &cobra.Command{
+	Use:   "net",
+	Short: "Network troubleshooting helpers",
+	Long: `Network troubleshooting helpers that run from debug pods or ephemeral
+debug containers in the network namespace of a target pod or node.`,
+}
+
+func init() {
+	rootCmd.AddCommand(netCmd)
+}
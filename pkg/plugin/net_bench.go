@@ -0,0 +1,240 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	benchTarget   string
+	benchLookups  int
+	benchConnects int
+	benchTimeout  time.Duration
+)
+
+var netBenchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure DNS resolution and TCP connect latency from a pod",
+	Long: `Add an ephemeral network debug container to the target pod, resolve the
+target repeatedly through the pod's resolver configuration (search domains
+included) and, when the target has a port, open TCP connections to it.
+Latencies are reported as percentiles, to put numbers on "the network feels
+slow" and compare them with a healthy pod or an earlier baseline.
+
+DNS times are the query times reported by dig. TCP times are measured around
+nc and include its start-up, a roughly constant offset of a millisecond.`,
+	Example: `  kpdbug net bench -p mypod --target checkout.shop
+  kpdbug net bench -p mypod --target checkout.shop:8080 --lookups 200 --connects 50`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runNetBench(cmd)
+	},
+}
+
+func init() {
+	netBenchCmd.Flags().StringVar(&benchTarget, "target", "", "host or host:port to benchmark (required)")
+	netBenchCmd.Flags().IntVar(&benchLookups, "lookups", 100, "number of DNS lookups")
+	netBenchCmd.Flags().IntVar(&benchConnects, "connects", 100, "number of TCP connections, when --target has a port")
+	netBenchCmd.Flags().DurationVar(&benchTimeout, "timeout", 2*time.Second, "timeout of each lookup and connection")
+	_ = netBenchCmd.MarkFlagRequired("target")
+	netCmd.AddCommand(netBenchCmd)
+}
+
+// benchScript prints DNS|ok|<ms> or DNS|fail|<status> per lookup and
+// TCP|ok|<ns> or TCP|fail per connection; TCP|unsupported is printed when
+// date cannot report nanoseconds
+func benchScript(host, port string, lookups, connects int, timeout time.Duration) string {
+	seconds := max(int(timeout.Seconds()), 1)
+	script := fmt.Sprintf(`n=0
+while [ $n -lt %d ]; do
+  n=$((n+1))
+  out=$(dig +search +tries=1 +time=%d %s 2>&1)
+  ms=$(echo "$out" | sed -n 's/^;; Query time: \([0-9]*\) msec.*/\1/p' | tail -n 1)
+  status=$(echo "$out" | sed -n 's/.*status: \([A-Z]*\),.*/\1/p' | tail -n 1)
+  answers=$(echo "$out" | sed -n 's/.*ANSWER: \([0-9]*\),.*/\1/p' | tail -n 1)
+  if [ "$status" = NOERROR ] && [ "${answers:-0}" -gt 0 ] && [ -n "$ms" ]; then
+    echo "DNS|ok|$ms"
+  elif [ "$status" = NOERROR ]; then
+    echo "DNS|fail|NODATA"
+  else
+    echo "DNS|fail|${status:-TIMEOUT}"
+  fi
+done
+`, lookups, seconds, shellQuote(host))
+
+	if port == "" || connects <= 0 {
+		return script
+	}
+	return script + fmt.Sprintf(`case "$(date +%%s%%N)" in
+  *N) echo "TCP|unsupported";;
+  *)
+    n=0
+    while [ $n -lt %d ]; do
+      n=$((n+1))
+      start=$(date +%%s%%N)
+      if nc -z -w %d %s %s >/dev/null 2>&1; then
+        end=$(date +%%s%%N)
+        echo "TCP|ok|$((end-start))"
+      else
+        echo "TCP|fail"
+      fi
+    done;;
+esac
+`, connects, seconds, shellQuote(host), shellQuote(port))
+}
+
+// latencyStats summarizes the samples of one measurement
+type latencyStats struct {
+	Name     string
+	Samples  []time.Duration
+	Failures map[string]int
+}
+
+// failed returns the number of failed attempts
+func (s *latencyStats) failed() int {
+	total := 0
+	for _, count := range s.Failures {
+		total += count
+	}
+	return total
+}
+
+// percentile returns the nearest-rank percentile p of sorted samples
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// parseBenchOutput parses the lines printed by benchScript; tcp is nil when
+// no connection was attempted and unsupported is set when it could not be
+// timed
+func parseBenchOutput(output string) (dns, tcp *latencyStats, unsupported bool) {
+	dns = &latencyStats{Name: "DNS lookup", Failures: map[string]int{}}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "|")
+		if len(fields) < 2 {
+			continue
+		}
+		stats := dns
+		switch fields[0] {
+		case "DNS":
+		case "TCP":
+			if tcp == nil {
+				tcp = &latencyStats{Name: "TCP connect", Failures: map[string]int{}}
+			}
+			stats = tcp
+		default:
+			continue
+		}
+
+		switch {
+		case fields[1] == "unsupported":
+			unsupported = true
+		case fields[1] == "ok" && len(fields) == 3:
+			value, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil {
+				continue
+			}
+			if fields[0] == "DNS" {
+				stats.Samples = append(stats.Samples, time.Duration(value)*time.Millisecond)
+			} else {
+				stats.Samples = append(stats.Samples, time.Duration(value))
+			}
+		case fields[1] == "fail":
+			reason := "failed"
+			if len(fields) == 3 {
+				reason = fields[2]
+			}
+			stats.Failures[reason]++
+		}
+	}
+
+	for _, stats := range []*latencyStats{dns, tcp} {
+		if stats != nil {
+			sort.Slice(stats.Samples, func(i, j int) bool { return stats.Samples[i] < stats.Samples[j] })
+		}
+	}
+	return dns, tcp, unsupported
+}
+
+func runNetBench(cmd *cobra.Command) error {
+	if benchLookups < 1 {
+		return NewValidationError("lookups", strconv.Itoa(benchLookups), "must be at least 1")
+	}
+	host, port := benchTarget, ""
+	if h, p, err := net.SplitHostPort(benchTarget); err == nil {
+		host, port = h, p
+	}
+
+	config, err := newTargetConfig(cmd.Context(), cmd, defaultNetImage, "general")
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Benchmarking %s from pod %s...", benchTarget, config.PodName)
+	result, err := config.runEphemeralScript(config.PodName, benchScript(host, port, benchLookups, benchConnects, benchTimeout))
+	if err != nil {
+		return err
+	}
+
+	dns, tcp, unsupported := parseBenchOutput(result.Output)
+	fmt.Printf("%-12s %6s %6s %9s %9s %9s %9s %9s\n", "", "OK", "FAILED", "MIN", "P50", "P90", "P99", "MAX")
+	for _, stats := range []*latencyStats{dns, tcp} {
+		if stats != nil && !(stats == tcp && unsupported) {
+			printLatencyStats(stats)
+		}
+	}
+	if unsupported {
+		log.Printf("Warning: TCP connections were not timed: date in image %s does not support nanoseconds", config.Image)
+	}
+	for _, stats := range []*latencyStats{dns, tcp} {
+		if stats == nil || len(stats.Failures) == 0 {
+			continue
+		}
+		reasons := make([]string, 0, len(stats.Failures))
+		for reason, count := range stats.Failures {
+			reasons = append(reasons, fmt.Sprintf("%s %d", reason, count))
+		}
+		sort.Strings(reasons)
+		fmt.Printf("\n%s failures: %s\n", stats.Name, strings.Join(reasons, ", "))
+	}
+	return nil
+}
+
+// printLatencyStats prints one row of the benchmark table
+func printLatencyStats(stats *latencyStats) {
+	row := fmt.Sprintf("%-12s %6d %6d", stats.Name, len(stats.Samples), stats.failed())
+	if len(stats.Samples) == 0 {
+		fmt.Println(row)
+		return
+	}
+	for _, value := range []time.Duration{
+		stats.Samples[0],
+		percentile(stats.Samples, 50),
+		percentile(stats.Samples, 90),
+		percentile(stats.Samples, 99),
+		stats.Samples[len(stats.Samples)-1],
+	} {
+		row += fmt.Sprintf(" %9s", formatLatency(value))
+	}
+	fmt.Println(row)
+}
+
+// formatLatency prints a latency in milliseconds with microsecond precision
+func formatLatency(d time.Duration) string {
+	return fmt.Sprintf("%.3fms", float64(d)/float64(time.Millisecond))
+}
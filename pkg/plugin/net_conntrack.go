@@ -0,0 +1,162 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultNetImage is used by network helpers when --image is not set
+const defaultNetImage = "nicolaka/netshoot:latest"
+
+var (
+	conntrackPort string
+	conntrackPeer string
+)
+
+var netConntrackCmd = &cobra.Command{
+	Use:   "conntrack",
+	Short: "List conntrack entries and open sockets of a pod",
+	Long: `Add an ephemeral network debug container to the target pod and list the
+conntrack entries and open sockets of its network namespace, optionally filtered
+by port or peer address. Useful for connection leaks and NAT exhaustion.`,
+	Example: `  kpdbug net conntrack -p mypod
+  kpdbug net conntrack -p mypod --port 5432 --peer 10.0.3.17`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runConntrack(cmd)
+	},
+}
+
+func init() {
+	netConntrackCmd.Flags().StringVar(&conntrackPort, "port", "", "only show entries for this port")
+	netConntrackCmd.Flags().StringVar(&conntrackPeer, "peer", "", "only show entries involving this address")
+	netCmd.AddCommand(netConntrackCmd)
+}
+
+const conntrackScript = `echo "### conntrack"
+conntrack -L 2>/dev/null || cat /proc/net/nf_conntrack 2>/dev/null
+echo "### sockets"
+ss -tanpu 2>/dev/null || netstat -tanpu 2>/dev/null
+true`
+
+func runConntrack(cmd *cobra.Command) error {
+	config, err := newTargetConfig(cmd.Context(), cmd, defaultNetImage, "netadmin")
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Collecting conntrack entries and sockets of pod %s...", config.PodName)
+	result, err := config.runEphemeralScript(config.PodName, conntrackScript)
+	if err != nil {
+		return err
+	}
+
+	sections := splitSections(result.Output)
+	entries := filterConnections(sections["conntrack"], conntrackPort, conntrackPeer)
+	sockets := filterConnections(sections["sockets"], conntrackPort, conntrackPeer)
+
+	fmt.Printf("Conntrack entries (%d)\n", len(entries))
+	for _, state := range countConntrackStates(entries) {
+		fmt.Printf("  %-14s %d\n", state.name, state.count)
+	}
+	for _, entry := range entries {
+		fmt.Printf("  %s\n", entry)
+	}
+
+	fmt.Printf("\nSockets (%d)\n", len(sockets))
+	for _, socket := range sockets {
+		fmt.Printf("  %s\n", socket)
+	}
+	return nil
+}
+
+// newTargetConfig builds the DebugConfig for helpers that act on the --pod
+// target, using the helper's default image and profile unless overridden
+func newTargetConfig(ctx context.Context, cmd *cobra.Command, defaultImage, defaultProfile string) (*DebugConfig, error) {
+	config := NewDebugConfigFromFlags()
+	config.Context = ctx
+
+	if config.PodName == "" {
+		return nil, NewValidationError("pod", "", "a target pod is required").
+			WithSuggestion("Select the target pod with -p <pod>")
+	}
+	if !cmd.Flags().Changed("image") && defaultImage != "" {
+		config.Image = defaultImage
+	}
+	if config.Profile == "" {
+		config.Profile = defaultProfile
+	}
+
+	if err := config.resolveTarget(); err != nil {
+		return nil, err
+	}
+	if err := config.verifyTargetPod(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// filterConnections keeps the lines mentioning the port and peer, if set
+func filterConnections(lines []string, port, peer string) []string {
+	var filtered []string
+	for _, line := range lines {
+		if port != "" && !strings.Contains(line, "port="+port+" ") && !strings.Contains(line, ":"+port+" ") &&
+			!strings.HasSuffix(line, "port="+port) && !strings.HasSuffix(line, ":"+port) {
+			continue
+		}
+		if peer != "" && !containsIP(line, peer) {
+			continue
+		}
+		filtered = append(filtered, line)
+	}
+	return filtered
+}
+
+type stateCount struct {
+	name  string
+	count int
+}
+
+// conntrackStates are the TCP states conntrack prints for tracked connections
+var conntrackStates = []string{"SYN_SENT", "SYN_RECV", "ESTABLISHED", "FIN_WAIT", "CLOSE_WAIT", "LAST_ACK", "TIME_WAIT", "CLOSE"}
+
+// countConntrackStates counts entries per TCP state, UDP and others as "other"
+func countConntrackStates(entries []string) []stateCount {
+	counts := map[string]int{}
+	for _, entry := range entries {
+		state := "other"
+		for _, candidate := range strings.Fields(entry) {
+			if containsString(conntrackStates, candidate) {
+				state = candidate
+				break
+			}
+		}
+		counts[state]++
+	}
+
+	result := make([]stateCount, 0, len(counts))
+	for name, count := range counts {
+		result = append(result, stateCount{name, count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].count != result[j].count {
+			return result[i].count > result[j].count
+		}
+		return result[i].name < result[j].name
+	})
+	return result
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,344 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+var (
+	meshSelector    string
+	meshCount       int
+	meshHostNetwork bool
+	meshTimeout     time.Duration
+)
+
+var netMeshCmd = &cobra.Command{
+	Use:   "mesh",
+	Short: "Measure latency and packet loss between every pair of nodes",
+	Long: `Deploy a short-lived probe DaemonSet on every node (or the nodes matching
+--node-selector), ping every probe from every other probe and render the
+average round-trip time and packet loss as a node-to-node matrix. The
+DaemonSet is deleted afterwards.
+
+By default the probes run on the pod network, which exercises the CNI and
+overlay; --host-network pings between the node addresses to test the
+underlay instead.`,
+	Example: `  kpdbug net mesh
+  kpdbug net mesh --node-selector pool=general --count 20 --host-network`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runNetMesh(cmd)
+	},
+}
+
+func init() {
+	netMeshCmd.Flags().StringVar(&meshSelector, "node-selector", "", "only probe the nodes matching this label selector (key=value,...)")
+	netMeshCmd.Flags().IntVar(&meshCount, "count", 10, "pings per node pair")
+	netMeshCmd.Flags().BoolVar(&meshHostNetwork, "host-network", false, "ping between node addresses instead of pod addresses")
+	netMeshCmd.Flags().DurationVar(&meshTimeout, "timeout", 2*time.Minute, "maximum time to wait for the probes to start")
+	netCmd.AddCommand(netMeshCmd)
+}
+
+// meshProbe is one running probe pod
+type meshProbe struct {
+	Pod  string
+	Node string
+	IP   string
+}
+
+// meshResult is the ping summary from one probe to another
+type meshResult struct {
+	Loss    float64
+	Average time.Duration
+	Err     error
+}
+
+// meshDaemonSet builds the idle probe DaemonSet; pings are run with exec
+func (config *DebugConfig) meshDaemonSet(session string, nodeSelector map[string]string, hostNetwork bool) (*appsv1.DaemonSet, error) {
+	resources, err := config.debugResources()
+	if err != nil {
+		return nil, err
+	}
+	labels := map[string]string{
+		"debug-tool/type":    "debug-pod",
+		"debug-tool/tool":    "mesh",
+		"debug-tool/session": session,
+	}
+	containerContext, podContext := getSecurityContextForProfile("netadmin")
+
+	return &appsv1.DaemonSet{
+		TypeMeta: metav1.TypeMeta{APIVersion: "apps/v1", Kind: "DaemonSet"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      session,
+			Namespace: config.Namespace,
+			Labels: map[string]string{
+				"debug-tool/type":    "debug-daemonset",
+				"debug-tool/session": session,
+			},
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					HostNetwork:                   hostNetwork,
+					NodeSelector:                  nodeSelector,
+					AutomountServiceAccountToken:  ptr.To(false),
+					TerminationGracePeriodSeconds: ptr.To(int64(0)),
+					SecurityContext:               podContext,
+					Tolerations:                   []corev1.Toleration{{Operator: corev1.TolerationOpExists}},
+					Containers: []corev1.Container{{
+						Name:            "probe",
+						Image:           config.debugImage(),
+						Command:         []string{"sleep", "infinity"},
+						SecurityContext: containerContext,
+						Resources:       resources.requirements(),
+					}},
+				},
+			},
+		},
+	}, nil
+}
+
+// waitForMeshProbes waits until the DaemonSet runs a pod with an IP on every
+// node it is scheduled to, or the timeout expires, and returns the running
+// probes sorted by node
+func (config *DebugConfig) waitForMeshProbes(session string, timeout time.Duration) ([]meshProbe, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		output, err := outputWithRetry(config.context(), func() *runnerCommand {
+			return config.kubectl("get", "daemonset", session, "-n", config.Namespace,
+				"-o", "jsonpath={.status.desiredNumberScheduled}")
+		})
+		if err != nil {
+			return nil, WrapKubectlError(err, "get probe DaemonSet")
+		}
+		desired, _ := strconv.Atoi(strings.TrimSpace(string(output)))
+
+		output, err = outputWithRetry(config.context(), func() *runnerCommand {
+			return config.kubectl("get", "pods", "-n", config.Namespace, "-l", "debug-tool/session="+session, "-o", "json")
+		})
+		if err != nil {
+			return nil, WrapKubectlError(err, "list probe pods")
+		}
+		var podList corev1.PodList
+		if err := json.Unmarshal(output, &podList); err != nil {
+			return nil, fmt.Errorf("error parsing pod list: %v", err)
+		}
+		probes := runningMeshProbes(podList.Items)
+
+		if desired > 0 && len(probes) >= desired {
+			return probes, nil
+		}
+		if time.Now().After(deadline) {
+			if len(probes) < 2 {
+				return nil, NewTimeoutError("probe pods running", timeout.String())
+			}
+			config.logf("Warning: only %d of %d probes started within %s, measuring those", len(probes), desired, timeout)
+			return probes, nil
+		}
+
+		select {
+		case <-config.context().Done():
+			return nil, config.context().Err()
+		case <-time.After(2 * sleepDuration):
+		}
+	}
+}
+
+// runningMeshProbes returns the running pods with an IP, sorted by node
+func runningMeshProbes(pods []corev1.Pod) []meshProbe {
+	var probes []meshProbe
+	for _, pod := range pods {
+		if pod.Status.Phase == corev1.PodRunning && pod.Status.PodIP != "" && pod.Spec.NodeName != "" {
+			probes = append(probes, meshProbe{Pod: pod.Name, Node: pod.Spec.NodeName, IP: pod.Status.PodIP})
+		}
+	}
+	sort.Slice(probes, func(i, j int) bool { return probes[i].Node < probes[j].Node })
+	return probes
+}
+
+// meshScript pings every peer in parallel and prints PEER|<ip> followed by
+// the ping summary of each
+func meshScript(peers []string, count int) string {
+	var b strings.Builder
+	for i, ip := range peers {
+		fmt.Fprintf(&b, "ping -q -n -c %d -i 0.2 -W 1 %s > /tmp/mesh-%d 2>&1 &\n", count, shellQuote(ip), i)
+	}
+	b.WriteString("wait\n")
+	for i, ip := range peers {
+		fmt.Fprintf(&b, "echo %s; cat /tmp/mesh-%d\n", shellQuote("PEER|"+ip), i)
+	}
+	return b.String()
+}
+
+// parseMeshOutput parses the ping summaries printed by meshScript by peer IP
+func parseMeshOutput(output string) map[string]meshResult {
+	results := map[string]meshResult{}
+	var peer string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if ip, found := strings.CutPrefix(line, "PEER|"); found {
+			peer = ip
+			results[peer] = meshResult{Loss: 100, Err: fmt.Errorf("no ping summary")}
+			continue
+		}
+		if peer == "" {
+			continue
+		}
+		result := results[peer]
+		switch {
+		case strings.Contains(line, "packet loss"):
+			for _, field := range strings.Split(line, ",") {
+				if value, found := strings.CutSuffix(strings.TrimSpace(field), "% packet loss"); found {
+					if loss, err := strconv.ParseFloat(value, 64); err == nil {
+						result.Loss, result.Err = loss, nil
+					}
+				}
+			}
+		case strings.HasPrefix(line, "rtt ") || strings.HasPrefix(line, "round-trip "):
+			// rtt min/avg/max/mdev = 0.321/0.412/0.577/0.070 ms
+			if _, values, found := strings.Cut(line, "= "); found {
+				if parts := strings.Split(values, "/"); len(parts) >= 2 {
+					if avg, err := strconv.ParseFloat(parts[1], 64); err == nil {
+						result.Average = time.Duration(avg * float64(time.Millisecond))
+					}
+				}
+			}
+		}
+		results[peer] = result
+	}
+	return results
+}
+
+// meshCell formats one cell of the matrix
+func meshCell(result meshResult, ok bool) string {
+	switch {
+	case !ok || result.Err != nil:
+		return "error"
+	case result.Loss >= 100:
+		return "lost"
+	case result.Loss > 0:
+		return fmt.Sprintf("%.2fms %.0f%%", float64(result.Average)/float64(time.Millisecond), result.Loss)
+	default:
+		return fmt.Sprintf("%.2fms", float64(result.Average)/float64(time.Millisecond))
+	}
+}
+
+func runNetMesh(cmd *cobra.Command) error {
+	if meshCount < 1 {
+		return NewValidationError("count", strconv.Itoa(meshCount), "must be at least 1")
+	}
+	selector, err := parseNodeSelector(meshSelector)
+	if err != nil {
+		return err
+	}
+
+	config := NewDebugConfigFromFlags()
+	config.Context = cmd.Context()
+	if !cmd.Flags().Changed("image") {
+		config.Image = defaultNetImage
+	}
+
+	if err := config.enforcePolicy("netadmin"); err != nil {
+		return err
+	}
+	if err := config.checkDaemonSetLifetime(); err != nil {
+		return err
+	}
+	if err := config.verifyImage(true); err != nil {
+		return err
+	}
+	session := fmt.Sprintf("debug-mesh-%s-%s", clock().Format("150405"), randomSuffix())
+	daemonSet, err := config.meshDaemonSet(session, selector, meshHostNetwork)
+	if err != nil {
+		return err
+	}
+	if err := config.applyObject(daemonSet); err != nil {
+		return WrapKubectlError(err, "create probe DaemonSet")
+	}
+	log.Printf("Created probe DaemonSet %s/%s", config.Namespace, session)
+	defer func() {
+		log.Printf("Deleting probe DaemonSet %s...", session)
+		if err := config.kubectlWithContext(config.cleanupContext(), "delete", "daemonset", session, "-n", config.Namespace, "--wait=false").Run(); err != nil {
+			log.Printf("Warning: Failed to delete probe DaemonSet %s: %v", session, err)
+		}
+	}()
+
+	probes, err := config.waitForMeshProbes(session, meshTimeout)
+	if err != nil {
+		return err
+	}
+	if len(probes) < 2 {
+		return NewValidationError("nodes", strconv.Itoa(len(probes)), "at least two nodes are needed for a mesh")
+	}
+
+	log.Printf("Pinging between %d nodes...", len(probes))
+	results := make([]map[string]meshResult, len(probes))
+	errs := make([]error, len(probes))
+	var wg sync.WaitGroup
+	for i, probe := range probes {
+		var peers []string
+		for _, other := range probes {
+			if other.Pod != probe.Pod {
+				peers = append(peers, other.IP)
+			}
+		}
+		wg.Add(1)
+		go func(i int, probe meshProbe, peers []string) {
+			defer wg.Done()
+			output, err := config.kubectl("exec", probe.Pod, "-n", config.Namespace, "-c", "probe", "--",
+				"sh", "-c", meshScript(peers, meshCount)).Output()
+			results[i], errs[i] = parseMeshOutput(string(output)), err
+		}(i, probe, peers)
+	}
+	wg.Wait()
+
+	printMeshMatrix(probes, results, errs)
+	return nil
+}
+
+// printMeshMatrix prints one row per source node and one numbered column per
+// destination node
+func printMeshMatrix(probes []meshProbe, results []map[string]meshResult, errs []error) {
+	header := fmt.Sprintf("%-28s", "FROM \\ TO")
+	for i := range probes {
+		header += fmt.Sprintf(" %-14s", fmt.Sprintf("[%d]", i+1))
+	}
+	fmt.Println(strings.TrimRight(header, " "))
+
+	for i, from := range probes {
+		row := fmt.Sprintf("%-28s", truncateString(fmt.Sprintf("[%d] %s", i+1, from.Node), 28))
+		for j, to := range probes {
+			cell := "-"
+			if i != j {
+				if errs[i] != nil {
+					cell = "error"
+				} else {
+					result, ok := results[i][to.IP]
+					cell = meshCell(result, ok)
+				}
+			}
+			row += fmt.Sprintf(" %-14s", cell)
+		}
+		fmt.Println(strings.TrimRight(row, " "))
+	}
+
+	for i, err := range errs {
+		if err != nil {
+			fmt.Printf("\nProbe on %s failed: %v\n", probes[i].Node, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Header overhead of an ICMP echo over IPv4
+const icmpOverhead = 28
+
+var mtuTo string
+
+var netMTUCmd = &cobra.Command{
+	Use:   "mtu",
+	Short: "Discover the path MTU from a pod to a host",
+	Long: `Add an ephemeral network debug container to the target pod and discover the
+effective MTU towards a host: the MTU of the interface the route uses, the
+largest ping that gets through with the don't-fragment bit set (found by
+bisection) and the path MTU reported by tracepath.
+
+A path MTU below the interface MTU is the classic overlay mismatch: small
+requests work while large responses or TLS handshakes hang, because the
+oversized packets are dropped. Only IPv4 targets are supported.`,
+	Example: `  kpdbug net mtu -p mypod --to 10.0.0.5
+  kpdbug net mtu -p mypod --to db.shop.svc`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runNetMTU(cmd)
+	},
+}
+
+func init() {
+	netMTUCmd.Flags().StringVar(&mtuTo, "to", "", "host to discover the path MTU to (required)")
+	_ = netMTUCmd.MarkFlagRequired("to")
+	netCmd.AddCommand(netMTUCmd)
+}
+
+// mtuScript prints IFACE|<name>|<mtu>, then PING|<largest payload> or
+// UNREACHABLE, then the tracepath summary as TRACEPATH|<pmtu>
+func mtuScript(host string) string {
+	return fmt.Sprintf(`host=%[1]s
+iface=$(ip route get "$host" 2>/dev/null | sed -n 's/.* dev \([^ ]*\).*/\1/p' | head -n 1)
+mtu=$(cat "/sys/class/net/$iface/mtu" 2>/dev/null)
+echo "IFACE|$iface|$mtu"
+probe() { ping -M do -c 1 -W 1 -s "$1" "$host" >/dev/null 2>&1; }
+if ! probe 0 && ! probe 0; then
+  echo "UNREACHABLE"
+else
+  lo=0; hi=$(( ${mtu:-1500} - %[2]d ))
+  if probe "$hi"; then
+    lo=$hi
+  else
+    while [ $((hi - lo)) -gt 1 ]; do
+      mid=$(( (lo + hi) / 2 ))
+      if probe "$mid" || probe "$mid"; then lo=$mid; else hi=$mid; fi
+    done
+  fi
+  echo "PING|$lo"
+fi
+pmtu=$(timeout 30 tracepath -n -m 16 "$host" 2>/dev/null | sed -n 's/.*Resume: pmtu \([0-9]*\).*/\1/p')
+echo "TRACEPATH|$pmtu"`, shellQuote(host), icmpOverhead)
+}
+
+// mtuReport is the MTU discovered towards a host
+type mtuReport struct {
+	Interface    string
+	InterfaceMTU int
+	Reachable    bool
+	PathMTU      int
+	TracepathMTU int
+}
+
+// parseMTUOutput parses the output of mtuScript
+func parseMTUOutput(output string) mtuReport {
+	var report mtuReport
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "|")
+		switch fields[0] {
+		case "IFACE":
+			if len(fields) == 3 {
+				report.Interface = fields[1]
+				report.InterfaceMTU, _ = strconv.Atoi(fields[2])
+			}
+		case "PING":
+			if len(fields) == 2 {
+				if payload, err := strconv.Atoi(fields[1]); err == nil {
+					report.Reachable = true
+					report.PathMTU = payload + icmpOverhead
+				}
+			}
+		case "TRACEPATH":
+			if len(fields) == 2 {
+				report.TracepathMTU, _ = strconv.Atoi(fields[1])
+			}
+		}
+	}
+	return report
+}
+
+// verdict explains the report in one or two sentences
+func (r mtuReport) verdict() string {
+	switch {
+	case !r.Reachable:
+		return "No ping got through, so the path MTU could not be measured; ICMP may be blocked by a NetworkPolicy or firewall."
+	case r.InterfaceMTU > 0 && r.PathMTU < r.InterfaceMTU:
+		return fmt.Sprintf("The path MTU %d is below the MTU %d of %s: packets of %d to %d bytes are dropped unless the sender learns the smaller MTU. "+
+			"Lower the MTU of the CNI/overlay or make sure ICMP fragmentation-needed messages are allowed.",
+			r.PathMTU, r.InterfaceMTU, r.Interface, r.PathMTU+1, r.InterfaceMTU)
+	default:
+		return "Packets of the full interface MTU reach the host without fragmentation."
+	}
+}
+
+func runNetMTU(cmd *cobra.Command) error {
+	config, err := newTargetConfig(cmd.Context(), cmd, defaultNetImage, "netadmin")
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Discovering the path MTU from pod %s to %s...", config.PodName, mtuTo)
+	result, err := config.runEphemeralScript(config.PodName, mtuScript(mtuTo))
+	if err != nil {
+		return err
+	}
+
+	report := parseMTUOutput(result.Output)
+	value := func(mtu int) string {
+		if mtu <= 0 {
+			return "unknown"
+		}
+		return strconv.Itoa(mtu)
+	}
+	fmt.Printf("Interface MTU:  %s (%s)\n", value(report.InterfaceMTU), report.Interface)
+	fmt.Printf("Ping path MTU:  %s\n", value(report.PathMTU))
+	fmt.Printf("Tracepath PMTU: %s\n", value(report.TracepathMTU))
+	fmt.Printf("\n%s\n", report.verdict())
+	return nil
+}
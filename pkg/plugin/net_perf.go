@@ -0,0 +1,199 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// iperfPort is the port of the iperf3 server
+const iperfPort = 5201
+
+var (
+	perfServerNode string
+	perfClientNode string
+	perfDuration   time.Duration
+	perfParallel   int
+	perfReverse    bool
+)
+
+var netPerfCmd = &cobra.Command{
+	Use:   "perf",
+	Short: "Measure pod network throughput between two nodes with iperf3",
+	Long: `Start an iperf3 server in a debug pod on one node and an iperf3 client in a
+debug pod on another, run a TCP throughput test over the pod network and
+print the throughput and retransmits. Both pods are deleted afterwards.
+
+The pods are pinned with spec.nodeName and tolerate every taint, so any
+node can be tested. Pick the same node twice to get a same-node baseline.`,
+	Example: `  kpdbug net perf --server-node worker-1 --client-node worker-2
+  kpdbug net perf --server-node worker-1 --client-node worker-2 --duration 30s --parallel 4 --reverse`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runNetPerf(cmd)
+	},
+}
+
+func init() {
+	netPerfCmd.Flags().StringVar(&perfServerNode, "server-node", "", "node running the iperf3 server (required)")
+	netPerfCmd.Flags().StringVar(&perfClientNode, "client-node", "", "node running the iperf3 client (required)")
+	netPerfCmd.Flags().DurationVar(&perfDuration, "duration", 10*time.Second, "duration of the test, at most 1m")
+	netPerfCmd.Flags().IntVar(&perfParallel, "parallel", 1, "number of parallel streams")
+	netPerfCmd.Flags().BoolVar(&perfReverse, "reverse", false, "send from the server to the client")
+	_ = netPerfCmd.MarkFlagRequired("server-node")
+	_ = netPerfCmd.MarkFlagRequired("client-node")
+	_ = netPerfCmd.RegisterFlagCompletionFunc("server-node", completeNodeNames)
+	_ = netPerfCmd.RegisterFlagCompletionFunc("client-node", completeNodeNames)
+	netCmd.AddCommand(netPerfCmd)
+}
+
+// perfClientScript waits for the server port, then runs the iperf3 client
+// with JSON output
+func perfClientScript(serverIP string, duration time.Duration, parallel int, reverse bool) string {
+	args := []string{"-c", shellQuote(serverIP), "-p", strconv.Itoa(iperfPort),
+		"-t", strconv.Itoa(max(int(duration.Seconds()), 1)), "-P", strconv.Itoa(max(parallel, 1)), "-J"}
+	if reverse {
+		args = append(args, "-R")
+	}
+	return fmt.Sprintf(`i=0
+until nc -z -w 1 %[1]s %[2]d >/dev/null 2>&1 || [ $i -ge 30 ]; do i=$((i+1)); sleep 1; done
+iperf3 %[3]s`, shellQuote(serverIP), iperfPort, strings.Join(args, " "))
+}
+
+// iperfResult is the part of the iperf3 JSON report kpdbug prints
+type iperfResult struct {
+	Error string `json:"error"`
+	End   struct {
+		SumSent struct {
+			BitsPerSecond float64 `json:"bits_per_second"`
+			Retransmits   int     `json:"retransmits"`
+		} `json:"sum_sent"`
+		SumReceived struct {
+			BitsPerSecond float64 `json:"bits_per_second"`
+		} `json:"sum_received"`
+	} `json:"end"`
+}
+
+// parseIperfResult parses the iperf3 JSON report
+func parseIperfResult(output string) (*iperfResult, error) {
+	start := strings.Index(output, "{")
+	if start < 0 {
+		return nil, fmt.Errorf("iperf3 printed no report: %s", truncateString(strings.TrimSpace(output), 200))
+	}
+	var result iperfResult
+	if err := json.Unmarshal([]byte(output[start:]), &result); err != nil {
+		return nil, fmt.Errorf("error parsing iperf3 report: %v", err)
+	}
+	if result.Error != "" {
+		return nil, fmt.Errorf("iperf3: %s", result.Error)
+	}
+	return &result, nil
+}
+
+// formatBitrate prints a rate in bits per second with a decimal unit
+func formatBitrate(bps float64) string {
+	for _, unit := range []struct {
+		name  string
+		value float64
+	}{{"Gbit/s", 1e9}, {"Mbit/s", 1e6}, {"Kbit/s", 1e3}} {
+		if bps >= unit.value {
+			return fmt.Sprintf("%.2f %s", bps/unit.value, unit.name)
+		}
+	}
+	return fmt.Sprintf("%.0f bit/s", bps)
+}
+
+// startPerfPod creates a tool pod for one side of the test on node and returns
+// a function deleting it
+func (config *DebugConfig) startPerfPod(name, role, node string, command []string) (func(), error) {
+	if err := config.enforcePolicy("restricted"); err != nil {
+		return nil, err
+	}
+	pod, err := config.toolPod(name, config.Namespace, "iperf3", map[string]string{
+		"debug-tool/tool": "iperf3",
+		"debug-tool/role": role,
+	}, command)
+	if err != nil {
+		return nil, err
+	}
+	pod.Spec.NodeName = node
+	pod.Spec.Tolerations = []corev1.Toleration{{Operator: corev1.TolerationOpExists}}
+
+	if err := config.createObject(pod); err != nil {
+		return nil, WrapKubectlError(err, "create iperf3 "+role+" pod")
+	}
+	config.emitPodEvent(EventCreated, name, "iperf3 "+role)
+	return func() {
+		if err := config.kubectlWithContext(config.cleanupContext(), "delete", "pod", name, "-n", config.Namespace, "--wait=false").Run(); err != nil {
+			config.logf("Warning: Failed to delete iperf3 %s pod %s: %v", role, name, err)
+		} else {
+			config.emitPodEvent(EventDeleted, name, "")
+		}
+	}, nil
+}
+
+func runNetPerf(cmd *cobra.Command) error {
+	// The client pod must finish within the completion wait of tool pods
+	if perfDuration > time.Minute {
+		return NewValidationError("duration", perfDuration.String(), "must be at most 1m")
+	}
+	config := NewDebugConfigFromFlags()
+	config.Context = cmd.Context()
+	if !cmd.Flags().Changed("image") {
+		config.Image = defaultNetImage
+	}
+
+	suffix := clock().Format("150405") + "-" + randomSuffix()
+	serverName, clientName := "debug-iperf-server-"+suffix, "debug-iperf-client-"+suffix
+
+	log.Printf("Starting iperf3 server on node %s...", perfServerNode)
+	deleteServer, err := config.startPerfPod(serverName, "server", perfServerNode,
+		[]string{"iperf3", "-s", "-p", strconv.Itoa(iperfPort)})
+	if err != nil {
+		return err
+	}
+	defer deleteServer()
+
+	if err := config.waitForPod(serverName); err != nil {
+		return NewTimeoutError("iperf3 server ready", fmt.Sprintf("%ds", maxAttempts)).WithOriginalError(err)
+	}
+	output, err := config.kubectl("get", "pod", serverName, "-n", config.Namespace, "-o", "jsonpath={.status.podIP}").Output()
+	serverIP := strings.TrimSpace(string(output))
+	if err != nil || serverIP == "" {
+		return NewDetailedError(ErrorTypeKubectl, "iperf3 server pod has no IP").WithOriginalError(err)
+	}
+
+	log.Printf("Running iperf3 client on node %s against %s for %s...", perfClientNode, serverIP, perfDuration)
+	script := perfClientScript(serverIP, perfDuration, perfParallel, perfReverse)
+	deleteClient, err := config.startPerfPod(clientName, "client", perfClientNode,
+		[]string{"sh", "-c", wrapScript(script)})
+	if err != nil {
+		return err
+	}
+	defer deleteClient()
+
+	report, _, err := config.toolPodOutput(clientName)
+	if err != nil {
+		return err
+	}
+	result, err := parseIperfResult(report)
+	if err != nil {
+		return err
+	}
+
+	from, to := perfClientNode, perfServerNode
+	if perfReverse {
+		from, to = to, from
+	}
+	fmt.Printf("%s -> %s, %d stream(s), %s\n\n", from, to, max(perfParallel, 1), perfDuration)
+	fmt.Printf("Sent:        %s\n", formatBitrate(result.End.SumSent.BitsPerSecond))
+	fmt.Printf("Received:    %s\n", formatBitrate(result.End.SumReceived.BitsPerSecond))
+	fmt.Printf("Retransmits: %d\n", result.End.SumSent.Retransmits)
+	return nil
+}
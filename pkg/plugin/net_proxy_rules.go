@@ -0,0 +1,296 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	proxyRulesService string
+	proxyRulesNode    string
+)
+
+var netProxyRulesCmd = &cobra.Command{
+	Use:   "proxy-rules",
+	Short: "Show the kube-proxy rules of a Service on a node",
+	Long: `Run a privileged host-network debug pod on a node and extract the iptables,
+IPVS and nftables rules that kube-proxy programmed for a Service's ClusterIP
+and NodePorts, rendered as a readable summary.`,
+	Example: `  kpdbug net proxy-rules --service mysvc
+  kpdbug net proxy-rules --service mysvc --node worker-2`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runProxyRules(cmd.Context())
+	},
+}
+
+func init() {
+	netProxyRulesCmd.Flags().StringVar(&proxyRulesService, "service", "", "name of the Service to inspect (required)")
+	netProxyRulesCmd.Flags().StringVar(&proxyRulesNode, "node", "", "node to inspect (defaults to the first node of the cluster)")
+	_ = netProxyRulesCmd.MarkFlagRequired("service")
+	netCmd.AddCommand(netProxyRulesCmd)
+}
+
+// proxyRulesScript dumps every kube-proxy backend, preferring the host binaries
+const proxyRulesScript = `echo "### iptables"
+chroot /host iptables-save 2>/dev/null || iptables-save 2>/dev/null
+echo "### ipvs"
+chroot /host ipvsadm -Ln 2>/dev/null || ipvsadm -Ln 2>/dev/null
+echo "### nft"
+chroot /host nft list ruleset 2>/dev/null || nft list ruleset 2>/dev/null
+true`
+
+func runProxyRules(ctx context.Context) error {
+	config := NewDebugConfigFromFlags()
+	config.Context = ctx
+
+	svc, err := config.getService(proxyRulesService)
+	if err != nil {
+		return err
+	}
+
+	node := proxyRulesNode
+	if node == "" {
+		if node, err = config.defaultNode(); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("Collecting proxy rules on node %s...", node)
+	result, err := config.runNodeScript(node, proxyRulesScript)
+	if err != nil {
+		return err
+	}
+
+	sections := splitSections(result.Output)
+	keys := newServiceRuleKeys(svc)
+
+	fmt.Printf("Service %s/%s on node %s\n", svc.Namespace, svc.Name, node)
+	fmt.Printf("  ClusterIP: %s\n", strings.Join(keys.ips, ", "))
+	for _, port := range svc.Spec.Ports {
+		if port.NodePort != 0 {
+			fmt.Printf("  Port: %d/%s (NodePort %d)\n", port.Port, port.Protocol, port.NodePort)
+		} else {
+			fmt.Printf("  Port: %d/%s\n", port.Port, port.Protocol)
+		}
+	}
+
+	iptablesRules := filterIptablesRules(sections["iptables"], keys)
+	ipvsRules := filterIPVSRules(sections["ipvs"], keys)
+	nftRules := filterNftRules(sections["nft"], keys)
+
+	printRuleSection("iptables", iptablesRules)
+	printRuleSection("IPVS", ipvsRules)
+	printRuleSection("nftables", nftRules)
+
+	if len(iptablesRules)+len(ipvsRules)+len(nftRules) == 0 {
+		fmt.Println("\nNo rules found for this Service. Is kube-proxy running on this node, or is it replaced by the CNI (e.g. Cilium eBPF)?")
+	}
+	return nil
+}
+
+// getService fetches a Service in the config namespace
+func (config *DebugConfig) getService(name string) (*corev1.Service, error) {
+	output, err := config.kubectl("get", "service", name, "-n", config.Namespace, "-o", "json").Output()
+	if err != nil {
+		return nil, NewDetailedError(ErrorTypePodNotFound,
+			fmt.Sprintf("Service '%s' not found in namespace '%s'", name, config.Namespace)).
+			WithCommand(fmt.Sprintf("kubectl get services -n %s", config.Namespace)).
+			WithOriginalError(err)
+	}
+
+	var svc corev1.Service
+	if err := json.Unmarshal(output, &svc); err != nil {
+		return nil, fmt.Errorf("error parsing service JSON: %v", err)
+	}
+	return &svc, nil
+}
+
+// serviceRuleKeys are the strings identifying a Service in proxy rules
+type serviceRuleKeys struct {
+	name      string // namespace/name as used in kube-proxy comments
+	ips       []string
+	nodePorts []string
+}
+
+func newServiceRuleKeys(svc *corev1.Service) serviceRuleKeys {
+	keys := serviceRuleKeys{name: svc.Namespace + "/" + svc.Name}
+	keys.ips = append(keys.ips, svc.Spec.ClusterIPs...)
+	if len(keys.ips) == 0 && svc.Spec.ClusterIP != "" && svc.Spec.ClusterIP != "None" {
+		keys.ips = append(keys.ips, svc.Spec.ClusterIP)
+	}
+	for _, port := range svc.Spec.Ports {
+		if port.NodePort != 0 {
+			keys.nodePorts = append(keys.nodePorts, strconv.Itoa(int(port.NodePort)))
+		}
+	}
+	return keys
+}
+
+// matches reports whether a rule line references the Service
+func (k serviceRuleKeys) matches(line string) bool {
+	if strings.Contains(line, `"`+k.name+":") || strings.Contains(line, `"`+k.name+`"`) || strings.Contains(line, k.name+"/") {
+		return true
+	}
+	for _, ip := range k.ips {
+		if containsIP(line, ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsIP reports whether line contains ip as a whole address
+func containsIP(line, ip string) bool {
+	ipv6 := strings.Contains(ip, ":")
+	for offset := 0; ; {
+		index := strings.Index(line[offset:], ip)
+		if index < 0 {
+			return false
+		}
+		start, end := offset+index, offset+index+len(ip)
+		before := start == 0 || !isIPChar(line[start-1], ipv6)
+		after := end == len(line) || !isIPChar(line[end], ipv6)
+		if before && after {
+			return true
+		}
+		offset = end
+	}
+}
+
+// isIPChar reports whether c can continue an address; for IPv4 a colon
+// separates the port and ends the address
+func isIPChar(c byte, ipv6 bool) bool {
+	if c == '.' || (c >= '0' && c <= '9') {
+		return true
+	}
+	return ipv6 && (c == ':' || (c >= 'a' && c <= 'f'))
+}
+
+// splitSections splits script output on "### <name>" headers
+func splitSections(output string) map[string][]string {
+	sections := map[string][]string{}
+	current := ""
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "### ") {
+			current = strings.TrimPrefix(line, "### ")
+			continue
+		}
+		if current != "" && strings.TrimSpace(line) != "" {
+			sections[current] = append(sections[current], line)
+		}
+	}
+	return sections
+}
+
+var kubeProxyChain = regexp.MustCompile(`KUBE-(?:SVC|SEP|FW|XLB|EXT|SVL)-[A-Z0-9]{16}`)
+
+// filterIptablesRules returns the iptables-save lines for the Service: rules
+// matching its name, ClusterIP or NodePorts, plus every rule of the per-service
+// and per-endpoint chains they jump to
+func filterIptablesRules(lines []string, keys serviceRuleKeys) []string {
+	chains := map[string]bool{}
+	selected := make([]bool, len(lines))
+
+	for i, line := range lines {
+		if keys.matches(line) || (strings.Contains(line, "KUBE-NODEPORTS") && matchesNodePort(line, keys.nodePorts)) {
+			selected[i] = true
+			for _, chain := range kubeProxyChain.FindAllString(line, -1) {
+				chains[chain] = true
+			}
+		}
+	}
+
+	// Follow jumps until no new chains are discovered
+	for changed := true; changed; {
+		changed = false
+		for i, line := range lines {
+			if selected[i] {
+				continue
+			}
+			fields := strings.Fields(line)
+			if len(fields) < 2 || !(fields[0] == "-A" && chains[fields[1]]) {
+				continue
+			}
+			selected[i] = true
+			for _, chain := range kubeProxyChain.FindAllString(line, -1) {
+				if !chains[chain] {
+					chains[chain] = true
+					changed = true
+				}
+			}
+		}
+	}
+
+	var rules []string
+	for i, line := range lines {
+		if selected[i] {
+			rules = append(rules, line)
+		}
+	}
+	return rules
+}
+
+func matchesNodePort(line string, nodePorts []string) bool {
+	for _, port := range nodePorts {
+		if strings.Contains(line, "--dport "+port+" ") || strings.HasSuffix(line, "--dport "+port) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterIPVSRules returns the ipvsadm virtual servers (with their real
+// servers) whose address is a ClusterIP or whose port is a NodePort
+func filterIPVSRules(lines []string, keys serviceRuleKeys) []string {
+	var rules []string
+	include := false
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && (fields[0] == "TCP" || fields[0] == "UDP" || fields[0] == "SCTP") {
+			include = false
+			for _, ip := range keys.ips {
+				if containsIP(fields[1], ip) {
+					include = true
+				}
+			}
+			for _, port := range keys.nodePorts {
+				if strings.HasSuffix(fields[1], ":"+port) {
+					include = true
+				}
+			}
+		} else if !strings.HasPrefix(strings.TrimSpace(line), "->") {
+			include = false
+		}
+		if include {
+			rules = append(rules, line)
+		}
+	}
+	return rules
+}
+
+// filterNftRules returns the nftables rules referencing the Service
+func filterNftRules(lines []string, keys serviceRuleKeys) []string {
+	var rules []string
+	for _, line := range lines {
+		if keys.matches(line) {
+			rules = append(rules, strings.TrimSpace(line))
+		}
+	}
+	return rules
+}
+
+func printRuleSection(title string, rules []string) {
+	fmt.Printf("\n%s (%d rules)\n", title, len(rules))
+	for _, rule := range rules {
+		fmt.Printf("  %s\n", rule)
+	}
+}
@@ -0,0 +1,275 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+var (
+	scanService        string
+	scanFromNamespaces []string
+	scanProbeLabels    string
+	scanTimeout        time.Duration
+)
+
+var netScanCmd = &cobra.Command{
+	Use:   "scan",
+	Short: "Test which namespaces can reach a Service",
+	Long: `Launch a short-lived probe pod in each source namespace, try to connect to
+every TCP port of the Service and report the result as a matrix, which shows
+empirically what the NetworkPolicies allow.
+
+A timeout usually means a NetworkPolicy drops the traffic; refused means the
+connection reached the Service but nothing accepted it (no ready endpoints,
+or the target port is not listening). --probe-labels gives the probe pods
+the labels a policy's podSelector matches, to test a specific source app.`,
+	Example: `  kpdbug net scan --service checkout -n shop --from-namespaces shop,frontend,batch
+  kpdbug net scan --service checkout -n shop --from-namespaces frontend --probe-labels app=web`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runNetScan(cmd)
+	},
+}
+
+func init() {
+	netScanCmd.Flags().StringVar(&scanService, "service", "", "name of the Service to probe (required)")
+	netScanCmd.Flags().StringSliceVar(&scanFromNamespaces, "from-namespaces", nil, "namespaces to probe from (defaults to the Service's namespace)")
+	netScanCmd.Flags().StringVar(&scanProbeLabels, "probe-labels", "", "labels for the probe pods, as key=value[,key=value]")
+	netScanCmd.Flags().DurationVar(&scanTimeout, "timeout", 3*time.Second, "connection timeout per port")
+	_ = netScanCmd.MarkFlagRequired("service")
+	netCmd.AddCommand(netScanCmd)
+}
+
+// Reachability results of one probe
+const (
+	scanOpen     = "open"
+	scanRefused  = "refused"
+	scanTimedOut = "timeout"
+	scanSkipped  = "skipped"
+	scanError    = "error"
+)
+
+// scanTarget is the host probe pods connect to: the ClusterIP, or the DNS
+// name of a headless Service
+func scanTarget(svc *corev1.Service) string {
+	if svc.Spec.ClusterIP == "" || svc.Spec.ClusterIP == corev1.ClusterIPNone {
+		return fmt.Sprintf("%s.%s.svc", svc.Name, svc.Namespace)
+	}
+	return svc.Spec.ClusterIP
+}
+
+// scanPortLabel names a Service port in the matrix
+func scanPortLabel(port corev1.ServicePort) string {
+	protocol := port.Protocol
+	if protocol == "" {
+		protocol = corev1.ProtocolTCP
+	}
+	return fmt.Sprintf("%d/%s", port.Port, protocol)
+}
+
+// scanScript prints one SCAN|<port>|<result> line per TCP port, telling
+// refused connections from timeouts by nc's error message
+func scanScript(host string, ports []corev1.ServicePort, timeout time.Duration) string {
+	seconds := int(timeout.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	var b strings.Builder
+	for _, port := range ports {
+		label := scanPortLabel(port)
+		if port.Protocol != "" && port.Protocol != corev1.ProtocolTCP {
+			fmt.Fprintf(&b, "echo \"SCAN|%s|%s\"\n", label, scanSkipped)
+			continue
+		}
+		fmt.Fprintf(&b, `if out=$(nc -z -v -w %d %s %d 2>&1); then r=%s; elif echo "$out" | grep -qi refused; then r=%s; else r=%s; fi
+echo "SCAN|%s|$r"
+`, seconds, shellQuote(host), port.Port, scanOpen, scanRefused, scanTimedOut, label)
+	}
+	return b.String()
+}
+
+// parseScanResults parses the SCAN lines printed by scanScript
+func parseScanResults(output string) map[string]string {
+	results := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), "|", 3)
+		if len(fields) == 3 && fields[0] == "SCAN" {
+			results[fields[1]] = fields[2]
+		}
+	}
+	return results
+}
+
+// toolPod builds a run-once, unprivileged debug pod in namespace running
+// command, with labels added to the debug pod label
+func (config *DebugConfig) toolPod(name, namespace, container string, labels map[string]string, command []string) (*corev1.Pod, error) {
+	resources, err := config.debugResources()
+	if err != nil {
+		return nil, err
+	}
+	podLabels := map[string]string{}
+	for key, value := range labels {
+		podLabels[key] = value
+	}
+	podLabels["debug-tool/type"] = "debug-pod"
+
+	containerContext, podContext := getSecurityContextForProfile("restricted")
+	return &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    podLabels,
+		},
+		Spec: corev1.PodSpec{
+			RestartPolicy:                 corev1.RestartPolicyNever,
+			AutomountServiceAccountToken:  ptr.To(false),
+			TerminationGracePeriodSeconds: ptr.To(int64(0)),
+			SecurityContext:               podContext,
+			Containers: []corev1.Container{{
+				Name:            container,
+				Image:           config.debugImage(),
+				Command:         command,
+				SecurityContext: containerContext,
+				Resources:       resources.requirements(),
+			}},
+		},
+	}, nil
+}
+
+// runProbe runs the scan script from a probe pod in namespace and returns
+// the result per port
+func (config *DebugConfig) runProbe(namespace string, labels map[string]string, script string) (map[string]string, error) {
+	probe := *config
+	probe.Namespace = namespace
+	name := fmt.Sprintf("debug-scan-%s-%s", clock().Format("150405"), randomSuffix())
+
+	if err := probe.enforcePolicy("restricted"); err != nil {
+		return nil, err
+	}
+	pod, err := probe.toolPod(name, namespace, "probe", labels, []string{"sh", "-c", wrapScript(script)})
+	if err != nil {
+		return nil, err
+	}
+	if err := probe.createObject(pod); err != nil {
+		return nil, WrapKubectlError(err, "create probe pod in namespace "+namespace)
+	}
+	defer func() {
+		if err := probe.kubectlWithContext(probe.cleanupContext(), "delete", "pod", name, "-n", namespace, "--wait=false").Run(); err != nil {
+			config.logf("Warning: Failed to delete probe pod %s/%s: %v", namespace, name, err)
+		}
+	}()
+
+	output, _, err := probe.toolPodOutput(name)
+	if err != nil {
+		return nil, err
+	}
+	return parseScanResults(output), nil
+}
+
+// toolPodOutput waits for a tool pod running a wrapped script to finish and
+// returns the script output and exit code from its logs
+func (config *DebugConfig) toolPodOutput(name string) (string, int, error) {
+	if err := config.waitForPodCompletion(name); err != nil {
+		return "", 0, err
+	}
+	logs, err := config.kubectl("logs", name, "-n", config.Namespace).Output()
+	if err != nil {
+		return "", 0, WrapKubectlError(err, "get logs of pod "+name)
+	}
+	output, exitCode, ok := parseExitMarker(string(logs))
+	if !ok {
+		return "", 0, fmt.Errorf("pod %s/%s finished without reporting an exit code", config.Namespace, name)
+	}
+	return output, exitCode, nil
+}
+
+func runNetScan(cmd *cobra.Command) error {
+	config := NewDebugConfigFromFlags()
+	config.Context = cmd.Context()
+	if !cmd.Flags().Changed("image") {
+		config.Image = defaultNetImage
+	}
+
+	labels, err := parseNodeSelector(scanProbeLabels)
+	if err != nil {
+		return NewValidationError("probe labels", scanProbeLabels, "must be a comma separated list of key=value pairs")
+	}
+	svc, err := config.getService(scanService)
+	if err != nil {
+		return err
+	}
+	if len(svc.Spec.Ports) == 0 {
+		return NewValidationError("service", scanService, "has no ports to probe")
+	}
+
+	namespaces := scanFromNamespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{config.Namespace}
+	}
+
+	host := scanTarget(svc)
+	script := scanScript(host, svc.Spec.Ports, scanTimeout)
+	log.Printf("Probing %s (%s) from %d namespaces...", svc.Name, host, len(namespaces))
+
+	// Probes run concurrently; each namespace waits for its own pod
+	results := make([]map[string]string, len(namespaces))
+	errs := make([]error, len(namespaces))
+	var wg sync.WaitGroup
+	for i, ns := range namespaces {
+		wg.Add(1)
+		go func(i int, ns string) {
+			defer wg.Done()
+			results[i], errs[i] = config.runProbe(ns, labels, script)
+		}(i, ns)
+	}
+	wg.Wait()
+
+	fmt.Printf("Service %s/%s (%s), connections time out after %s\n\n", svc.Namespace, svc.Name, host, scanTimeout)
+	printScanMatrix(namespaces, svc.Spec.Ports, results, errs)
+	return nil
+}
+
+// printScanMatrix prints one row per source namespace and one column per port
+func printScanMatrix(namespaces []string, ports []corev1.ServicePort, results []map[string]string, errs []error) {
+	header := fmt.Sprintf("%-24s", "FROM NAMESPACE")
+	for _, port := range ports {
+		header += fmt.Sprintf(" %-12s", scanPortLabel(port))
+	}
+	fmt.Println(strings.TrimRight(header, " "))
+
+	var failures []string
+	for i, ns := range namespaces {
+		row := fmt.Sprintf("%-24s", truncateString(ns, 24))
+		for _, port := range ports {
+			result := scanError
+			if errs[i] == nil {
+				if r, ok := results[i][scanPortLabel(port)]; ok {
+					result = r
+				}
+			}
+			row += fmt.Sprintf(" %-12s", result)
+		}
+		fmt.Println(strings.TrimRight(row, " "))
+		if errs[i] != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", ns, errs[i]))
+		}
+	}
+
+	if len(failures) > 0 {
+		sort.Strings(failures)
+		fmt.Println("\nProbes that could not run:")
+		for _, failure := range failures {
+			fmt.Printf("  %s\n", failure)
+		}
+	}
+}
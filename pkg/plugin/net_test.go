@@ -0,0 +1,357 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFilterIptablesRules(t *testing.T) {
+	keys := serviceRuleKeys{name: "default/web", ips: []string{"10.96.0.1"}, nodePorts: []string{"30080"}}
+	lines := []string{
+		`-A KUBE-SERVICES -d 10.96.0.1/32 -p tcp -m comment --comment "default/web:http cluster IP" -m tcp --dport 80 -j KUBE-SVC-AAAAAAAAAAAAAAAA`,
+		`-A KUBE-SERVICES -d 10.96.0.10/32 -p udp -m comment --comment "kube-system/kube-dns:dns cluster IP" -j KUBE-SVC-BBBBBBBBBBBBBBBB`,
+		`-A KUBE-SVC-AAAAAAAAAAAAAAAA -m statistic --mode random --probability 0.5 -j KUBE-SEP-CCCCCCCCCCCCCCCC`,
+		`-A KUBE-SEP-CCCCCCCCCCCCCCCC -p tcp -m tcp -j DNAT --to-destination 10.244.1.5:8080`,
+		`-A KUBE-SVC-BBBBBBBBBBBBBBBB -j KUBE-SEP-DDDDDDDDDDDDDDDD`,
+		`-A KUBE-NODEPORTS -p tcp -m tcp --dport 30080 -j KUBE-EXT-EEEEEEEEEEEEEEEE`,
+	}
+
+	got := filterIptablesRules(lines, keys)
+	if len(got) != 4 {
+		t.Fatalf("filterIptablesRules() returned %d rules, want 4: %v", len(got), got)
+	}
+	for _, rule := range got {
+		if containsIP(rule, "10.96.0.10") || kubeProxyChain.FindString(rule) == "KUBE-SVC-BBBBBBBBBBBBBBBB" {
+			t.Errorf("filterIptablesRules() included unrelated rule %q", rule)
+		}
+	}
+}
+
+func TestFilterIPVSRules(t *testing.T) {
+	keys := serviceRuleKeys{name: "default/web", ips: []string{"10.96.0.1"}}
+	lines := []string{
+		"IP Virtual Server version 1.2.1 (size=4096)",
+		"TCP  10.96.0.1:80 rr",
+		"  -> 10.244.1.5:8080              Masq    1      0          0",
+		"TCP  10.96.0.10:53 rr",
+		"  -> 10.244.0.2:53                Masq    1      0          0",
+	}
+
+	got := filterIPVSRules(lines, keys)
+	if len(got) != 2 {
+		t.Errorf("filterIPVSRules() = %v, want the 10.96.0.1 virtual server and its backend", got)
+	}
+}
+
+func TestFilterConnections(t *testing.T) {
+	lines := []string{
+		"tcp      6 431999 ESTABLISHED src=10.244.1.5 dst=10.0.3.17 sport=40112 dport=5432 src=10.0.3.17 dst=10.244.1.5 sport=5432 dport=40112 [ASSURED] mark=0 use=1",
+		"tcp      6 118 TIME_WAIT src=10.244.1.5 dst=10.96.0.1 sport=40200 dport=443 src=10.96.0.1 dst=10.244.1.5 sport=443 dport=40200 [ASSURED] mark=0 use=1",
+		"udp      17 29 src=10.244.1.5 dst=10.96.0.10 sport=53000 dport=53 [UNREPLIED] src=10.96.0.10 dst=10.244.1.5 sport=53 dport=53000 mark=0 use=1",
+	}
+
+	if got := filterConnections(lines, "5432", ""); len(got) != 1 {
+		t.Errorf("filterConnections(port) = %v, want 1 entry", got)
+	}
+	if got := filterConnections(lines, "", "10.96.0.1"); len(got) != 1 {
+		t.Errorf("filterConnections(peer) = %v, want 1 entry", got)
+	}
+
+	states := countConntrackStates(lines)
+	if len(states) != 3 {
+		t.Errorf("countConntrackStates() = %v, want ESTABLISHED, TIME_WAIT and other", states)
+	}
+}
+
+func TestScanScript(t *testing.T) {
+	ports := []corev1.ServicePort{
+		{Port: 8080, Protocol: corev1.ProtocolTCP},
+		{Port: 53, Protocol: corev1.ProtocolUDP},
+	}
+	script := scanScript("10.96.0.12", ports, 2*time.Second)
+	if !strings.Contains(script, "nc -z -v -w 2 '10.96.0.12' 8080") {
+		t.Errorf("scanScript() = %q, want a 2s nc probe of 8080", script)
+	}
+	if !strings.Contains(script, `echo "SCAN|53/UDP|skipped"`) {
+		t.Errorf("scanScript() = %q, want UDP ports skipped", script)
+	}
+
+	results := parseScanResults("SCAN|8080/TCP|open\nnoise\nSCAN|9090/TCP|timeout\n")
+	if results["8080/TCP"] != scanOpen || results["9090/TCP"] != scanTimedOut || len(results) != 2 {
+		t.Errorf("parseScanResults() = %v", results)
+	}
+}
+
+func TestScanTarget(t *testing.T) {
+	svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "checkout", Namespace: "shop"}}
+	svc.Spec.ClusterIP = "10.96.0.12"
+	if got := scanTarget(svc); got != "10.96.0.12" {
+		t.Errorf("scanTarget() = %q, want the ClusterIP", got)
+	}
+	svc.Spec.ClusterIP = corev1.ClusterIPNone
+	if got := scanTarget(svc); got != "checkout.shop.svc" {
+		t.Errorf("scanTarget(headless) = %q, want the Service DNS name", got)
+	}
+}
+
+func TestHTTPScript(t *testing.T) {
+	script := httpScript(httpRequest{
+		Method:  "POST",
+		URL:     "http://api/v1/echo",
+		Headers: []string{"Content-Type: application/json"},
+		Data:    `{"ping":1}`,
+		Timeout: 5 * time.Second,
+	})
+	for _, want := range []string{"-X 'POST'", "--max-time 5", "-H 'Content-Type: application/json'", `--data-raw '{"ping":1}'`, "'http://api/v1/echo'"} {
+		if !strings.Contains(script, want) {
+			t.Errorf("httpScript() = %q, want %q", script, want)
+		}
+	}
+}
+
+func TestCheckHTTPResult(t *testing.T) {
+	tests := []struct {
+		name         string
+		output       string
+		expectStatus int
+		expectBody   string
+		passed       bool
+	}{
+		{"default status", "HTTP|204|0.010|10.96.0.5\nHTTPBODY\n", 0, "", true},
+		{"status mismatch", "HTTP|503|0.010|10.96.0.5\nHTTPBODY\nunavailable", 200, "", false},
+		{"body found", "HTTP|200|0.010|10.96.0.5\nHTTPBODY\n{\"status\":\"ok\"}", 200, "ok", true},
+		{"body missing", "HTTP|200|0.010|10.96.0.5\nHTTPBODY\n{\"status\":\"degraded\"}", 200, "ok", false},
+		{"connection error", "HTTPERR|7|curl: (7) Failed to connect\nHTTPBODY\n", 0, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &httpCheckResult{}
+			parseHTTPOutput(tt.output, result)
+			checkHTTPResult(result, tt.expectStatus, tt.expectBody)
+			if result.Passed != tt.passed {
+				t.Errorf("passed = %v, want %v (result %+v)", result.Passed, tt.passed, result)
+			}
+		})
+	}
+
+	result := &httpCheckResult{}
+	parseHTTPOutput("HTTPERR|7|curl: (7) Failed to connect \nHTTPBODY\n", result)
+	if result.Error != "curl: (7) Failed to connect" {
+		t.Errorf("error = %q", result.Error)
+	}
+}
+
+func TestGRPCScript(t *testing.T) {
+	call := grpcScript(grpcRequest{
+		Addr:    "localhost:9090",
+		Verb:    []string{"orders.v1.Orders/Get"},
+		Data:    `{"id": "42"}`,
+		Headers: []string{"x-tenant: acme"},
+	})
+	for _, want := range []string{"find \"$root$mp\"", `-d '{"id": "42"}'`, "-H 'x-tenant: acme'", "'localhost:9090' 'orders.v1.Orders/Get'"} {
+		if !strings.Contains(call, want) {
+			t.Errorf("grpcScript(call) = %q, want %q", call, want)
+		}
+	}
+
+	list := grpcScript(grpcRequest{Addr: "localhost:9090", Verb: []string{"list"}, Data: "{}", CertDir: "/etc/tls/", Insecure: true})
+	if strings.Contains(list, " -d ") || strings.Contains(list, "find ") {
+		t.Errorf("grpcScript(list) = %q, want no request data and no certificate search", list)
+	}
+	for _, want := range []string{`certdir="$root"'/etc/tls'`, "-insecure"} {
+		if !strings.Contains(list, want) {
+			t.Errorf("grpcScript(list) = %q, want %q", list, want)
+		}
+	}
+}
+
+func TestGRPCPort(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports []corev1.ContainerPort
+		want  int32
+	}{
+		{"no ports", nil, defaultGRPCPort},
+		{"named grpc", []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}, {Name: "grpc", ContainerPort: 9090}}, 9090},
+		{"first tcp", []corev1.ContainerPort{{Name: "dns", ContainerPort: 53, Protocol: corev1.ProtocolUDP}, {Name: "api", ContainerPort: 7000}}, 7000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := grpcPort(&corev1.Container{Ports: tt.ports}); got != tt.want {
+				t.Errorf("grpcPort() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBenchScript(t *testing.T) {
+	dnsOnly := benchScript("checkout.shop", "", 10, 10, 2*time.Second)
+	if !strings.Contains(dnsOnly, "dig +search +tries=1 +time=2 'checkout.shop'") || strings.Contains(dnsOnly, "nc -z") {
+		t.Errorf("benchScript() without port = %q", dnsOnly)
+	}
+	withPort := benchScript("checkout.shop", "8080", 10, 5, 500*time.Millisecond)
+	if !strings.Contains(withPort, "nc -z -w 1 'checkout.shop' '8080'") || !strings.Contains(withPort, "date +%s%N") {
+		t.Errorf("benchScript() with port = %q", withPort)
+	}
+}
+
+func TestParseBenchOutput(t *testing.T) {
+	output := "DNS|ok|4\nDNS|ok|1\nDNS|fail|NXDOMAIN\nDNS|ok|2\nTCP|ok|1500000\nTCP|fail\nTCP|ok|900000\n"
+	dns, tcp, unsupported := parseBenchOutput(output)
+	if unsupported {
+		t.Error("unsupported = true, want false")
+	}
+	if len(dns.Samples) != 3 || dns.Samples[0] != time.Millisecond || dns.Failures["NXDOMAIN"] != 1 {
+		t.Errorf("dns = %+v", dns)
+	}
+	if tcp == nil || len(tcp.Samples) != 2 || tcp.Samples[0] != 900*time.Microsecond || tcp.failed() != 1 {
+		t.Errorf("tcp = %+v", tcp)
+	}
+
+	if _, tcp, _ := parseBenchOutput("DNS|ok|1\n"); tcp != nil {
+		t.Errorf("tcp = %+v, want nil without TCP lines", tcp)
+	}
+	if _, _, unsupported := parseBenchOutput("TCP|unsupported\n"); !unsupported {
+		t.Error("unsupported = false, want true")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var samples []time.Duration
+	for i := 1; i <= 100; i++ {
+		samples = append(samples, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[float64]time.Duration{50: 50 * time.Millisecond, 90: 90 * time.Millisecond, 99: 99 * time.Millisecond, 100: 100 * time.Millisecond} {
+		if got := percentile(samples, p); got != want {
+			t.Errorf("percentile(%v) = %v, want %v", p, got, want)
+		}
+	}
+	if got := percentile([]time.Duration{7 * time.Millisecond}, 99); got != 7*time.Millisecond {
+		t.Errorf("percentile of one sample = %v", got)
+	}
+}
+
+func TestParseMTUOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    mtuReport
+		verdict string
+	}{
+		{
+			name:    "mismatch",
+			output:  "IFACE|eth0|1500\nPING|1422\nTRACEPATH|1450\n",
+			want:    mtuReport{Interface: "eth0", InterfaceMTU: 1500, Reachable: true, PathMTU: 1450, TracepathMTU: 1450},
+			verdict: "below the MTU 1500 of eth0",
+		},
+		{
+			name:    "full mtu",
+			output:  "IFACE|eth0|1450\nPING|1422\nTRACEPATH|\n",
+			want:    mtuReport{Interface: "eth0", InterfaceMTU: 1450, Reachable: true, PathMTU: 1450},
+			verdict: "without fragmentation",
+		},
+		{
+			name:    "unreachable",
+			output:  "IFACE|eth0|1500\nUNREACHABLE\nTRACEPATH|\n",
+			want:    mtuReport{Interface: "eth0", InterfaceMTU: 1500},
+			verdict: "ICMP may be blocked",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseMTUOutput(tt.output)
+			if got != tt.want {
+				t.Errorf("parseMTUOutput() = %+v, want %+v", got, tt.want)
+			}
+			if !strings.Contains(got.verdict(), tt.verdict) {
+				t.Errorf("verdict() = %q, want %q", got.verdict(), tt.verdict)
+			}
+		})
+	}
+}
+
+func TestParseIperfResult(t *testing.T) {
+	report := `Connecting...
+{"start": {}, "end": {"sum_sent": {"bits_per_second": 9.41e9, "retransmits": 12}, "sum_received": {"bits_per_second": 9.39e9}}}`
+	result, err := parseIperfResult(report)
+	if err != nil {
+		t.Fatalf("parseIperfResult() error = %v", err)
+	}
+	if result.End.SumSent.Retransmits != 12 || formatBitrate(result.End.SumReceived.BitsPerSecond) != "9.39 Gbit/s" {
+		t.Errorf("parseIperfResult() = %+v", result.End)
+	}
+
+	if _, err := parseIperfResult(`{"error": "unable to connect to server: Connection refused"}`); err == nil || !strings.Contains(err.Error(), "Connection refused") {
+		t.Errorf("parseIperfResult() error = %v, want the iperf3 error", err)
+	}
+	if _, err := parseIperfResult("iperf3: not found"); err == nil {
+		t.Error("parseIperfResult() without JSON succeeded")
+	}
+}
+
+func TestPerfClientScript(t *testing.T) {
+	script := perfClientScript("10.244.1.7", 30*time.Second, 4, true)
+	if !strings.Contains(script, "iperf3 -c '10.244.1.7' -p 5201 -t 30 -P 4 -J -R") {
+		t.Errorf("perfClientScript() = %q", script)
+	}
+	if formatBitrate(850e6) != "850.00 Mbit/s" {
+		t.Errorf("formatBitrate(850e6) = %q", formatBitrate(850e6))
+	}
+}
+
+func TestParseMeshOutput(t *testing.T) {
+	output := `PEER|10.244.1.5
+PING 10.244.1.5 (10.244.1.5) 56(84) bytes of data.
+
+--- 10.244.1.5 ping statistics ---
+10 packets transmitted, 10 received, 0% packet loss, time 1820ms
+rtt min/avg/max/mdev = 0.321/0.412/0.577/0.070 ms
+PEER|10.244.2.9
+--- 10.244.2.9 ping statistics ---
+10 packets transmitted, 8 received, 20% packet loss, time 1811ms
+rtt min/avg/max/mdev = 1.100/3.250/9.010/2.100 ms
+PEER|10.244.3.2
+--- 10.244.3.2 ping statistics ---
+10 packets transmitted, 0 received, 100% packet loss, time 1900ms
+PEER|10.244.4.4
+ping: sendmsg: Operation not permitted
+`
+	results := parseMeshOutput(output)
+	tests := map[string]string{
+		"10.244.1.5": "0.41ms",
+		"10.244.2.9": "3.25ms 20%",
+		"10.244.3.2": "lost",
+		"10.244.4.4": "error",
+	}
+	for ip, want := range tests {
+		result, ok := results[ip]
+		if got := meshCell(result, ok); got != want {
+			t.Errorf("cell for %s = %q, want %q", ip, got, want)
+		}
+	}
+	if got := meshCell(meshResult{}, false); got != "error" {
+		t.Errorf("cell for missing peer = %q, want error", got)
+	}
+}
+
+func TestRunningMeshProbes(t *testing.T) {
+	pod := func(name, node, ip string, phase corev1.PodPhase) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       corev1.PodSpec{NodeName: node},
+			Status:     corev1.PodStatus{Phase: phase, PodIP: ip},
+		}
+	}
+	probes := runningMeshProbes([]corev1.Pod{
+		pod("b", "worker-2", "10.0.2.1", corev1.PodRunning),
+		pod("a", "worker-1", "10.0.1.1", corev1.PodRunning),
+		pod("c", "worker-3", "", corev1.PodPending),
+	})
+	if len(probes) != 2 || probes[0].Node != "worker-1" || probes[1].IP != "10.0.2.1" {
+		t.Errorf("runningMeshProbes() = %+v", probes)
+	}
+}
@@ -0,0 +1,24 @@
+package plugin
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var nodeCmd = &cobra.Command{
+	Use:   "node",
+	Short: "Node troubleshooting helpers",
+	Long: `Node troubleshooting helpers that run a short-lived privileged debug pod in
+the host namespaces of a single node, with the host filesystem at /host.`,
+}
+
+func init() {
+	rootCmd.AddCommand(nodeCmd)
+}
+
+// completeNodeNames completes positional arguments with node names
+func completeNodeNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return getNodes(cmd.Context()), cobra.ShellCompDirectiveNoFileComp
+}
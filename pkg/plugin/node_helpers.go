@@ -0,0 +1,61 @@
+package plugin
+
+// nodeHelpersEnv holds the node helper functions in node debug pods, so
+// `kubectl exec` sessions into a kept pod can load them with
+// eval "$KPDBUG_NODE_HELPERS"
+const nodeHelpersEnv = "KPDBUG_NODE_HELPERS"
+
+// nodeHelpersScript defines shell helpers for node-level container
+// inspection:
+//
+//	crictl ...                      crictl talking to the node's CRI socket,
+//	                                from the debug image or else the host
+//	kenter [-m] <pod> [container] [-- cmd]
+//	                                run cmd (default sh) in the network, PID,
+//	                                IPC and UTS namespaces of a container on
+//	                                this node, keeping the debug image's tools;
+//	                                -m also enters its mount namespace
+//
+// The CRI socket is detected for containerd, CRI-O, cri-dockerd and k3s.
+const nodeHelpersScript = `KPDBUG_CRI_SOCKET=""
+for s in /run/containerd/containerd.sock /run/crio/crio.sock /var/run/cri-dockerd.sock /run/k3s/containerd/containerd.sock; do
+  if [ -S "/host$s" ]; then KPDBUG_CRI_SOCKET=$s; break; fi
+done
+KPDBUG_CRICTL=$(command -v crictl 2>/dev/null)
+crictl() {
+  if [ -z "$KPDBUG_CRI_SOCKET" ]; then echo "crictl: no CRI socket found under /host" >&2; return 1; fi
+  if [ -n "$KPDBUG_CRICTL" ]; then
+    "$KPDBUG_CRICTL" --runtime-endpoint "unix:///host$KPDBUG_CRI_SOCKET" "$@"
+  else
+    chroot /host crictl --runtime-endpoint "unix://$KPDBUG_CRI_SOCKET" "$@"
+  fi
+}
+kenter() {
+  kenter_ns="-u -i -n -p"
+  if [ "$1" = "-m" ]; then kenter_ns="-m $kenter_ns"; shift; fi
+  if [ $# -eq 0 ]; then echo "usage: kenter [-m] <pod> [container] [-- command...]" >&2; return 2; fi
+  kenter_pod=$1; shift
+  kenter_ctr=""
+  if [ $# -gt 0 ] && [ "$1" != "--" ]; then kenter_ctr=$1; shift; fi
+  if [ "$1" = "--" ]; then shift; fi
+  kenter_sandbox=$(crictl pods -q --state ready --name "^$kenter_pod\$" | head -n 1)
+  if [ -z "$kenter_sandbox" ]; then echo "kenter: pod $kenter_pod is not running on this node" >&2; return 1; fi
+  if [ -n "$kenter_ctr" ]; then
+    kenter_id=$(crictl ps -q --pod "$kenter_sandbox" --name "^$kenter_ctr\$" | head -n 1)
+  else
+    kenter_id=$(crictl ps -q --pod "$kenter_sandbox" | head -n 1)
+  fi
+  if [ -z "$kenter_id" ]; then echo "kenter: no running container ${kenter_ctr:-in pod $kenter_pod}" >&2; return 1; fi
+  kenter_pid=$(crictl inspect -o go-template --template '{{.info.pid}}' "$kenter_id")
+  if [ $# -eq 0 ]; then set -- sh; fi
+  if command -v nsenter >/dev/null 2>&1; then
+    nsenter -t "$kenter_pid" $kenter_ns -- "$@"
+  else
+    chroot /host nsenter -t "$kenter_pid" $kenter_ns -- "$@"
+  fi
+}`
+
+// withNodeHelpers makes the node helpers available to script
+func withNodeHelpers(script string) string {
+	return "eval \"$" + nodeHelpersEnv + "\"\n" + script
+}
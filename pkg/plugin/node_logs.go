@@ -0,0 +1,131 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	nodeLogsDmesg      bool
+	nodeLogsKubelet    bool
+	nodeLogsContainerd bool
+	nodeLogsSince      time.Duration
+	nodeLogsOutput     string
+)
+
+var nodeLogsCmd = &cobra.Command{
+	Use:   "logs <node>",
+	Short: "Collect kernel, kubelet and containerd logs from a node",
+	Long: `Run a privileged debug pod on the node, collect the kernel log (dmesg), the
+kubelet journal and the containerd journal, and write them locally as a
+.tar.gz bundle for off-cluster analysis. Without a source flag every source
+is collected. Journals are read with journalctl on the host, falling back to
+dmesg and /var/log files on nodes without systemd.`,
+	Example: `  kpdbug node logs worker-2
+  kpdbug node logs worker-2 --dmesg --kubelet --since 1h
+  kpdbug node logs worker-2 --containerd --since 15m --output /tmp/worker-2.tar.gz`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeNodeNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runNodeLogs(cmd.Context(), args[0])
+	},
+}
+
+func init() {
+	nodeLogsCmd.Flags().BoolVar(&nodeLogsDmesg, "dmesg", false, "collect the kernel log")
+	nodeLogsCmd.Flags().BoolVar(&nodeLogsKubelet, "kubelet", false, "collect the kubelet journal")
+	nodeLogsCmd.Flags().BoolVar(&nodeLogsContainerd, "containerd", false, "collect the containerd journal")
+	nodeLogsCmd.Flags().DurationVar(&nodeLogsSince, "since", time.Hour, "only collect journal entries newer than this")
+	nodeLogsCmd.Flags().StringVar(&nodeLogsOutput, "output", "", "bundle path (default node-<node>-logs-<timestamp>.tar.gz)")
+	nodeCmd.AddCommand(nodeLogsCmd)
+}
+
+// nodeLogSource is one log collected from the node
+type nodeLogSource struct {
+	File   string
+	Script string
+}
+
+// nodeLogSources returns the selected log sources; none selected means all
+func nodeLogSources(dmesg, kubelet, containerd bool, since time.Duration) []nodeLogSource {
+	if !dmesg && !kubelet && !containerd {
+		dmesg, kubelet, containerd = true, true, true
+	}
+	sinceArg := fmt.Sprintf("-%ds", int64(since.Seconds()))
+	journal := func(unit string) string {
+		return fmt.Sprintf(`chroot /host journalctl -u %s --no-pager -o short-iso --since %s 2>/dev/null || cat /host/var/log/%s.log`, unit, sinceArg, unit)
+	}
+
+	var sources []nodeLogSource
+	if dmesg {
+		sources = append(sources, nodeLogSource{"dmesg.log",
+			fmt.Sprintf(`chroot /host journalctl -k --no-pager -o short-iso --since %s 2>/dev/null || chroot /host dmesg -T 2>/dev/null || dmesg -T`, sinceArg)})
+	}
+	if kubelet {
+		sources = append(sources, nodeLogSource{"kubelet.log", journal("kubelet")})
+	}
+	if containerd {
+		sources = append(sources, nodeLogSource{"containerd.log", journal("containerd")})
+	}
+	return sources
+}
+
+func runNodeLogs(ctx context.Context, node string) error {
+	config := NewDebugConfigFromFlags()
+	config.Context = ctx
+
+	output := nodeLogsOutput
+	if output == "" {
+		output = fmt.Sprintf("node-%s-logs-%s.tar.gz", node, clock().Format("20060102-150405"))
+	}
+
+	name, cleanup, err := config.startNodePod(node, []string{"sleep", "infinity"})
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	log.Printf("Waiting for node debug pod %s on %s...", name, node)
+	if err := config.waitForPod(name); err != nil {
+		return NewTimeoutError("node debug pod ready", fmt.Sprintf("%ds", maxAttempts)).WithOriginalError(err)
+	}
+
+	// Logs are streamed through exec rather than read from the pod log, which
+	// the kubelet would rotate and truncate for large journals
+	var files []bundleFile
+	defer func() {
+		for _, f := range files {
+			_ = os.Remove(f.Path)
+		}
+	}()
+	for _, source := range nodeLogSources(nodeLogsDmesg, nodeLogsKubelet, nodeLogsContainerd, nodeLogsSince) {
+		log.Printf("Collecting %s...", source.File)
+		tmp, err := os.CreateTemp("", "kpdbug-node-log-*")
+		if err != nil {
+			return fmt.Errorf("error creating temporary file: %v", err)
+		}
+		files = append(files, bundleFile{Name: source.File, Path: tmp.Name()})
+
+		cmd := config.kubectl("exec", name, "-n", config.Namespace, "--", "sh", "-c", source.Script)
+		var stderr bytes.Buffer
+		cmd.Stdout = tmp
+		cmd.Stderr = &stderr
+		err = cmd.Run()
+		_ = tmp.Close()
+		if err != nil {
+			log.Printf("Warning: Could not collect %s: %v - %s", source.File, err, stderr.String())
+		}
+	}
+
+	if err := writeBundle(output, files, clock()); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote node logs of %s to %s\n", node, output)
+	return nil
+}
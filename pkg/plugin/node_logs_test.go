@@ -0,0 +1,59 @@
+package plugin
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNodeLogSources(t *testing.T) {
+	all := nodeLogSources(false, false, false, time.Hour)
+	if len(all) != 3 || all[0].File != "dmesg.log" || all[1].File != "kubelet.log" || all[2].File != "containerd.log" {
+		t.Fatalf("nodeLogSources() without flags = %+v, want all three sources", all)
+	}
+
+	kubelet := nodeLogSources(false, true, false, 90*time.Minute)
+	if len(kubelet) != 1 || kubelet[0].File != "kubelet.log" {
+		t.Fatalf("nodeLogSources(--kubelet) = %+v, want only kubelet.log", kubelet)
+	}
+	if !strings.Contains(kubelet[0].Script, "journalctl -u kubelet") || !strings.Contains(kubelet[0].Script, "--since -5400s") {
+		t.Errorf("kubelet script = %q, want the kubelet journal of the last 5400s", kubelet[0].Script)
+	}
+}
+
+func TestWriteBundle(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "kubelet")
+	if err := os.WriteFile(source, []byte("I0101 kubelet started\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "bundle.tar.gz")
+	if err := writeBundle(path, []bundleFile{{Name: "kubelet.log", Path: source}}, time.Now()); err != nil {
+		t.Fatalf("writeBundle() error = %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("bundle is not gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	header, err := tr.Next()
+	if err != nil {
+		t.Fatalf("reading bundle: %v", err)
+	}
+	data, _ := io.ReadAll(tr)
+	if header.Name != "kubelet.log" || string(data) != "I0101 kubelet started\n" {
+		t.Errorf("bundle entry = %s %q, want kubelet.log with the log content", header.Name, data)
+	}
+}
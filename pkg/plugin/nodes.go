@@ -0,0 +1,469 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	nodesAll      bool
+	nodesSelector string
+	nodesCommand  string
+	nodesTimeout  time.Duration
+	nodesKeep     bool
+)
+
+var nodesCmd = &cobra.Command{
+	Use:   "nodes",
+	Short: "Run a command on every selected node through a debug DaemonSet",
+	Long: `Deploy a short-lived, labeled debug DaemonSet on the selected nodes, run the
+command in the host namespaces of every node, collect the output and tear the
+DaemonSet down again. The host filesystem is mounted at /host.`,
+	Example: `  kpdbug nodes --all --command "sysctl net.core.somaxconn"
+  kpdbug nodes --node-selector node-role.kubernetes.io/worker= --command "chroot /host uname -r"`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runNodes(cmd.Context())
+	},
+}
+
+func init() {
+	nodesCmd.Flags().BoolVar(&nodesAll, "all", false, "run on every node of the cluster")
+	nodesCmd.Flags().StringVar(&nodesSelector, "node-selector", "", "run on the nodes matching this label selector (key=value,...)")
+	nodesCmd.Flags().StringVar(&nodesCommand, "command", "", "shell command to run on every node (required)")
+	nodesCmd.Flags().DurationVar(&nodesTimeout, "timeout", 2*time.Minute, "maximum time to wait for all nodes to report")
+	nodesCmd.Flags().BoolVar(&nodesKeep, "keep", false, "keep the DaemonSet running after collecting the output")
+	_ = nodesCmd.MarkFlagRequired("command")
+	rootCmd.AddCommand(nodesCmd)
+}
+
+func runNodes(ctx context.Context) error {
+	if nodesAll == (nodesSelector != "") {
+		return NewValidationError("node selection", nodesSelector, "set exactly one of --all or --node-selector")
+	}
+	selector, err := parseNodeSelector(nodesSelector)
+	if err != nil {
+		return err
+	}
+
+	config := NewDebugConfigFromFlags()
+	config.Context = ctx
+
+	session := fmt.Sprintf("debug-nodes-%s-%s", clock().Format("150405"), randomSuffix())
+	if err := config.enforcePolicy("privileged"); err != nil {
+		return err
+	}
+	if err := config.checkDaemonSetLifetime(); err != nil {
+		return err
+	}
+	if err := config.verifyImage(true); err != nil {
+		return err
+	}
+	daemonSet, err := config.nodeDebugDaemonSet(session, selector, nodesCommand)
+	if err != nil {
+		return err
+	}
+
+	if err := config.applyObject(daemonSet); err != nil {
+		return WrapKubectlError(err, "create debug DaemonSet")
+	}
+	log.Printf("Created debug DaemonSet %s/%s", config.Namespace, session)
+	config.notifySession(NotifyStarted, session, true)
+	defer config.notifySession(NotifyEnded, session, true)
+
+	if !nodesKeep {
+		defer func() {
+			log.Printf("Deleting debug DaemonSet %s...", session)
+			cmd := config.kubectlWithContext(config.cleanupContext(), "delete", "daemonset", session, "-n", config.Namespace, "--wait=false")
+			if err := cmd.Run(); err != nil {
+				log.Printf("Warning: Failed to delete debug DaemonSet %s: %v", session, err)
+			}
+		}()
+	}
+
+	results, err := config.collectNodeResults(session, nodesTimeout)
+	if err != nil {
+		return err
+	}
+	saveResults(config.OutputFile, results)
+
+	for _, result := range results {
+		fmt.Printf("==> %s <==\n", result.Pod)
+		fmt.Print(result.Output)
+		if result.Output != "" && !strings.HasSuffix(result.Output, "\n") {
+			fmt.Println()
+		}
+	}
+	fmt.Println()
+
+	if failed := printResultSummary("NODE", results); failed > 0 {
+		return NewDetailedError(ErrorTypeKubectl,
+			fmt.Sprintf("Command failed on %d of %d nodes", failed, len(results)))
+	}
+	return nil
+}
+
+// parseNodeSelector parses key=value[,key=value] into a node selector map
+func parseNodeSelector(value string) (map[string]string, error) {
+	selector := map[string]string{}
+	if value == "" {
+		return selector, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		key, val, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || key == "" {
+			return nil, NewValidationError("node selector", value, "must be a comma separated list of key=value pairs")
+		}
+		selector[key] = val
+	}
+	return selector, nil
+}
+
+// nodeDebugPodSpec returns a privileged pod spec sharing the host namespaces,
+// with the host root filesystem mounted at /host and the node helpers in its
+// environment
+func (config *DebugConfig) nodeDebugPodSpec(command []string) (corev1.PodSpec, error) {
+	resources, err := config.debugResources()
+	if err != nil {
+		return corev1.PodSpec{}, err
+	}
+	return corev1.PodSpec{
+		HostPID:                       true,
+		HostNetwork:                   true,
+		HostIPC:                       true,
+		AutomountServiceAccountToken:  ptr.To(false),
+		TerminationGracePeriodSeconds: ptr.To(int64(0)),
+		Tolerations: []corev1.Toleration{
+			{Operator: corev1.TolerationOpExists},
+		},
+		Containers: []corev1.Container{
+			{
+				Name:    "debugger",
+				Image:   config.debugImage(),
+				Command: command,
+				Env: []corev1.EnvVar{
+					{Name: nodeHelpersEnv, Value: nodeHelpersScript},
+				},
+				SecurityContext: &corev1.SecurityContext{
+					Privileged: ptr.To(true),
+				},
+				Resources: resources.requirements(),
+				VolumeMounts: []corev1.VolumeMount{
+					{Name: "host-root", MountPath: "/host"},
+				},
+			},
+		},
+		Volumes: []corev1.Volume{
+			{
+				Name: "host-root",
+				VolumeSource: corev1.VolumeSource{
+					HostPath: &corev1.HostPathVolumeSource{Path: "/"},
+				},
+			},
+		},
+	}, nil
+}
+
+// nodeDebugDaemonSet builds the DaemonSet that runs the script once per node
+// and then idles so its output can be collected from the logs
+func (config *DebugConfig) nodeDebugDaemonSet(session string, nodeSelector map[string]string, script string) (*appsv1.DaemonSet, error) {
+	labels := map[string]string{
+		"debug-tool/type":    "debug-node-pod",
+		"debug-tool/session": session,
+	}
+
+	spec, err := config.nodeDebugPodSpec([]string{"sh", "-c", wrapScript(withNodeHelpers(script)) + "\nexec sleep infinity"})
+	if err != nil {
+		return nil, err
+	}
+	spec.NodeSelector = nodeSelector
+
+	return &appsv1.DaemonSet{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "apps/v1",
+			Kind:       "DaemonSet",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      session,
+			Namespace: config.Namespace,
+			Labels: map[string]string{
+				"debug-tool/type":    "debug-daemonset",
+				"debug-tool/session": session,
+			},
+		},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec:       spec,
+			},
+		},
+	}, nil
+}
+
+// applyObject creates or updates a Kubernetes object with kubectl apply
+func (config *DebugConfig) applyObject(obj interface{}) error {
+	return config.submitObject("apply", obj)
+}
+
+// createObject creates a Kubernetes object from its typed spec, failing with
+// AlreadyExists if an object of the same name exists
+func (config *DebugConfig) createObject(obj interface{}) error {
+	return config.submitObject("create", obj)
+}
+
+// submitObject pipes the object as YAML to kubectl apply or create
+func (config *DebugConfig) submitObject(verb string, obj interface{}) error {
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("error generating YAML: %v", err)
+	}
+
+	cmd := config.kubectl(verb, "-f", "-")
+	cmd.Stdin = bytes.NewReader(data)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%v - %s", err, stderr.String())
+	}
+	return nil
+}
+
+// collectNodeResults waits until every DaemonSet pod has reported its exit
+// marker, or the timeout expires, and returns one result per node
+func (config *DebugConfig) collectNodeResults(session string, timeout time.Duration) ([]eachResult, error) {
+	deadline := time.Now().Add(timeout)
+	results := map[string]eachResult{}
+
+	for {
+		pods, desired, err := config.getSessionPods(session)
+		if err != nil {
+			return nil, WrapKubectlError(err, "list debug DaemonSet pods")
+		}
+
+		for pod, node := range pods {
+			if _, done := results[node]; done {
+				continue
+			}
+			logs, err := config.kubectl("logs", pod, "-n", config.Namespace).Output()
+			if err != nil {
+				continue
+			}
+			if output, code, ok := parseExitMarker(string(logs)); ok {
+				results[node] = eachResult{Pod: node, Output: output, ExitCode: code}
+			}
+		}
+
+		if desired == 0 {
+			return nil, NewValidationError("node selector", nodesSelector, "no node matches; the DaemonSet runs no pods").
+				WithSuggestion("Check the node labels with 'kubectl get nodes --show-labels'")
+		}
+		if desired > 0 && len(results) >= desired {
+			break
+		}
+		if time.Now().After(deadline) {
+			config.logf("Warning: only %d of %d nodes reported within %s", len(results), desired, timeout)
+			for _, node := range pods {
+				if _, done := results[node]; !done {
+					results[node] = eachResult{Pod: node, ExitCode: -1, Err: fmt.Errorf("no result within %s", timeout)}
+				}
+			}
+			break
+		}
+
+		select {
+		case <-config.context().Done():
+			return nil, config.context().Err()
+		case <-time.After(2 * sleepDuration):
+		}
+	}
+
+	nodes := make([]string, 0, len(results))
+	for node := range results {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	ordered := make([]eachResult, 0, len(nodes))
+	for _, node := range nodes {
+		ordered = append(ordered, results[node])
+	}
+	return ordered, nil
+}
+
+// getSessionPods returns the pods of a debug DaemonSet mapped to their node,
+// plus the number of nodes the DaemonSet is expected to run on, -1 while
+// that is not known yet
+func (config *DebugConfig) getSessionPods(session string) (map[string]string, int, error) {
+	output, err := outputWithRetry(config.context(), func() *runnerCommand {
+		return config.kubectl("get", "daemonset", session, "-n", config.Namespace,
+			"-o", "jsonpath={.metadata.generation} {.status.observedGeneration} {.status.desiredNumberScheduled}")
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	desired := daemonSetDesired(string(output))
+
+	output, err = outputWithRetry(config.context(), func() *runnerCommand {
+		return config.kubectl("get", "pods", "-n", config.Namespace,
+			"-l", "debug-tool/session="+session, "-o", "json")
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var podList corev1.PodList
+	if err := json.Unmarshal(output, &podList); err != nil {
+		return nil, 0, fmt.Errorf("error parsing pod list: %v", err)
+	}
+
+	pods := make(map[string]string, len(podList.Items))
+	for _, pod := range podList.Items {
+		if pod.Spec.NodeName != "" {
+			pods[pod.Name] = pod.Spec.NodeName
+		}
+	}
+	return pods, desired, nil
+}
+
+// daemonSetDesired parses "generation observedGeneration desired" into the
+// number of nodes the DaemonSet runs on, or -1 until its controller has
+// observed the current generation
+func daemonSetDesired(output string) int {
+	var generation, observed, desired int64
+	fields := strings.Fields(output)
+	if len(fields) < 2 {
+		return -1
+	}
+	_, _ = fmt.Sscanf(fields[0], "%d", &generation)
+	_, _ = fmt.Sscanf(fields[1], "%d", &observed)
+	if observed == 0 || observed < generation {
+		return -1
+	}
+	if len(fields) > 2 {
+		_, _ = fmt.Sscanf(fields[2], "%d", &desired)
+	}
+	return int(desired)
+}
+
+// startNodePod creates a run-once privileged pod on node running command and
+// returns its name with a function that deletes it again
+func (config *DebugConfig) startNodePod(node string, command []string) (string, func(), error) {
+	if err := config.enforcePolicy("privileged"); err != nil {
+		return "", nil, err
+	}
+	if err := config.verifyImage(true); err != nil {
+		return "", nil, err
+	}
+	name := fmt.Sprintf("debug-node-%s-%s", clock().Format("150405"), randomSuffix())
+
+	spec, err := config.nodeDebugPodSpec(command)
+	if err != nil {
+		return "", nil, err
+	}
+	spec.NodeName = node
+	spec.RestartPolicy = corev1.RestartPolicyNever
+	spec.ActiveDeadlineSeconds = config.activeDeadlineSeconds()
+
+	pod := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "Pod",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: config.Namespace,
+			Labels: map[string]string{
+				"debug-tool/type": "debug-node-pod",
+				"debug-tool/node": node,
+			},
+		},
+		Spec: spec,
+	}
+
+	if err := config.applyObject(pod); err != nil {
+		return "", nil, WrapKubectlError(err, "create node debug pod")
+	}
+	config.notifySession(NotifyStarted, name, true)
+	cleanup := func() {
+		cmd := config.kubectlWithContext(config.cleanupContext(), "delete", "pod", name, "-n", config.Namespace, "--wait=false")
+		if err := cmd.Run(); err != nil {
+			config.logf("Warning: Failed to delete node debug pod %s: %v", name, err)
+		}
+		config.notifySession(NotifyEnded, name, true)
+	}
+	return name, cleanup, nil
+}
+
+// runNodeScript runs a script once in a privileged host-namespace pod on the
+// given node, waits for it to finish and deletes the pod afterwards
+func (config *DebugConfig) runNodeScript(node, script string) (*scriptResult, error) {
+	name, cleanup, err := config.startNodePod(node, []string{"sh", "-c", wrapScript(withNodeHelpers(script))})
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	if err := config.waitForPodCompletion(name); err != nil {
+		return nil, err
+	}
+
+	logs, err := config.kubectl("logs", name, "-n", config.Namespace).Output()
+	if err != nil {
+		return nil, WrapKubectlError(err, "get node debug pod logs")
+	}
+
+	output, code, ok := parseExitMarker(string(logs))
+	if !ok {
+		return nil, fmt.Errorf("node debug pod %s finished without reporting an exit code", name)
+	}
+	return &scriptResult{Pod: name, Output: output, ExitCode: code}, nil
+}
+
+// waitForPodCompletion waits until a run-once pod has succeeded or failed
+func (config *DebugConfig) waitForPodCompletion(name string) error {
+	for i := 0; i < maxAttempts*4; i++ {
+		output, err := config.kubectl("get", "pod", name, "-n", config.Namespace,
+			"-o", "jsonpath={.status.phase}").Output()
+		if err == nil {
+			switch string(output) {
+			case "Succeeded", "Failed":
+				return nil
+			}
+		}
+		select {
+		case <-config.context().Done():
+			return config.context().Err()
+		case <-time.After(sleepDuration):
+		}
+	}
+	return NewTimeoutError("node debug pod", fmt.Sprintf("%ds", maxAttempts*4))
+}
+
+// defaultNode returns the first node of the cluster, used when no node is given
+func (config *DebugConfig) defaultNode() (string, error) {
+	output, err := outputWithRetry(config.context(), func() *runnerCommand {
+		return config.kubectl("get", "nodes", "-o", "jsonpath={.items[0].metadata.name}")
+	})
+	if err != nil {
+		return "", WrapKubectlError(err, "list nodes")
+	}
+	node := strings.TrimSpace(string(output))
+	if node == "" {
+		return "", NewDetailedError(ErrorTypeClusterAccess, "No nodes found in the cluster")
+	}
+	return node, nil
+}
@@ -0,0 +1,129 @@
+package plugin
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestNodeDebugDaemonSetLoadsHelpers(t *testing.T) {
+	config := &DebugConfig{Namespace: "default", Image: "nicolaka/netshoot:latest", CPURequest: "100m", MemoryRequest: "128Mi", MemoryLimit: "128Mi"}
+	ds, err := config.nodeDebugDaemonSet("debug-nodes-1", nil, "kenter web-0 -- ss -tlnp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	container := ds.Spec.Template.Spec.Containers[0]
+	if len(container.Env) != 1 || container.Env[0].Name != nodeHelpersEnv || container.Env[0].Value != nodeHelpersScript {
+		t.Errorf("Env = %+v, want %s with the node helpers", container.Env, nodeHelpersEnv)
+	}
+	script := container.Command[len(container.Command)-1]
+	if !strings.HasPrefix(script, `eval "$KPDBUG_NODE_HELPERS"`+"\nkenter web-0") {
+		t.Errorf("script = %q, want the helpers loaded before the command", script)
+	}
+}
+
+func TestNodeDebugDaemonSet(t *testing.T) {
+	config := &DebugConfig{Namespace: "default", Image: "nicolaka/netshoot:latest", CPURequest: "100m", MemoryRequest: "128Mi", MemoryLimit: "256Mi"}
+	ds, err := config.nodeDebugDaemonSet("debug-nodes-1", map[string]string{"zone": "a"}, "uptime")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spec := ds.Spec.Template.Spec
+	if !spec.HostPID || !spec.HostNetwork || !spec.HostIPC {
+		t.Errorf("host namespaces = pid %v, network %v, ipc %v; want all shared", spec.HostPID, spec.HostNetwork, spec.HostIPC)
+	}
+	if spec.NodeSelector["zone"] != "a" || len(spec.Tolerations) == 0 {
+		t.Errorf("nodeSelector %v, tolerations %v", spec.NodeSelector, spec.Tolerations)
+	}
+	if len(spec.Volumes) != 1 || spec.Volumes[0].HostPath == nil || spec.Volumes[0].HostPath.Path != "/" {
+		t.Errorf("volumes = %+v, want the host root", spec.Volumes)
+	}
+	container := spec.Containers[0]
+	if container.SecurityContext == nil || !ptr.Deref(container.SecurityContext.Privileged, false) {
+		t.Errorf("security context = %+v, want privileged", container.SecurityContext)
+	}
+	if limit := container.Resources.Limits[corev1.ResourceMemory]; limit.String() != "256Mi" {
+		t.Errorf("memory limit = %s, want 256Mi", limit.String())
+	}
+	if request := container.Resources.Requests[corev1.ResourceCPU]; request.String() != "100m" {
+		t.Errorf("cpu request = %s, want 100m", request.String())
+	}
+	if ds.Spec.Selector == nil || ds.Spec.Selector.MatchLabels["debug-tool/session"] != "debug-nodes-1" ||
+		ds.Spec.Template.Labels["debug-tool/session"] != "debug-nodes-1" {
+		t.Errorf("selector %v does not match template labels %v", ds.Spec.Selector, ds.Spec.Template.Labels)
+	}
+
+	// Invalid quantities are validation errors, not panics
+	config.MemoryLimit = "bogus"
+	if _, err := config.nodeDebugDaemonSet("debug-nodes-1", nil, "uptime"); err == nil {
+		t.Error("nodeDebugDaemonSet(--memory-limit bogus) succeeded")
+	}
+	if _, _, err := config.startNodePod(fakeNode, []string{"true"}); err == nil {
+		t.Error("startNodePod(--memory-limit bogus) succeeded")
+	}
+}
+
+func TestDaemonSetDesired(t *testing.T) {
+	tests := []struct {
+		output string
+		want   int
+	}{
+		{"1 1 3", 3},
+		{"2 2 0", 0},
+		{"1  ", -1},
+		{"2 1 3", -1},
+		{"", -1},
+		{"1 1", 0},
+	}
+	for _, tt := range tests {
+		if got := daemonSetDesired(tt.output); got != tt.want {
+			t.Errorf("daemonSetDesired(%q) = %d, want %d", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestCollectNodeResultsNoNodes(t *testing.T) {
+	config := &DebugConfig{
+		Namespace:     "default",
+		Image:         "busybox",
+		CPURequest:    "100m",
+		MemoryRequest: "128Mi",
+		MemoryLimit:   "128Mi",
+		Runner:        fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}},
+	}
+	ds, err := config.nodeDebugDaemonSet("debug-nodes-1", map[string]string{"zone": "none"}, "uptime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.applyObject(ds); err != nil {
+		t.Fatal(err)
+	}
+
+	begin := time.Now()
+	_, err = config.collectNodeResults("debug-nodes-1", time.Minute)
+	var detailed *DetailedError
+	if !errors.As(err, &detailed) || detailed.Type != ErrorTypeValidation {
+		t.Errorf("collectNodeResults(no matching node) = %v, want a validation error", err)
+	}
+	if elapsed := time.Since(begin); elapsed > 10*time.Second {
+		t.Errorf("collectNodeResults(no matching node) took %s", elapsed)
+	}
+
+	ds, err = config.nodeDebugDaemonSet("debug-nodes-2", nil, "echo hi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.applyObject(ds); err != nil {
+		t.Fatal(err)
+	}
+	results, err := config.collectNodeResults("debug-nodes-2", time.Minute)
+	if err != nil || len(results) != 1 || results[0].Pod != fakeNode {
+		t.Errorf("collectNodeResults() = %+v, %v; want one result from %s", results, err, fakeNode)
+	}
+}
@@ -0,0 +1,122 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Notifications configures where privileged sessions are announced
+type Notifications struct {
+	// Webhook receives a JSON POST per notification; the "text" field makes
+	// it directly usable as a Slack incoming webhook
+	Webhook string `json:"webhook,omitempty"`
+}
+
+// Session phases reported to the notification webhook
+const (
+	NotifyCreated = "created"
+	NotifyStarted = "started"
+	NotifyEnded   = "ended"
+)
+
+// notifyTimeout bounds the webhook call so an unreachable sink never holds
+// up a debug session
+const notifyTimeout = 5 * time.Second
+
+// Notification is the payload posted to the webhook
+type Notification struct {
+	Text           string    `json:"text"`
+	Phase          string    `json:"phase"`
+	Time           time.Time `json:"time"`
+	User           string    `json:"user,omitempty"`
+	Context        string    `json:"context,omitempty"`
+	Namespace      string    `json:"namespace"`
+	Pod            string    `json:"pod"`
+	Target         string    `json:"target,omitempty"`
+	Profile        string    `json:"profile,omitempty"`
+	HostNamespaces bool      `json:"hostNamespaces"`
+}
+
+// notifiedProfile reports whether sessions with profile are always
+// announced: the elevated profiles, and anything ranked like privileged
+func notifiedProfile(profile string) bool {
+	return elevatedProfiles[profile] || profileRank(profile) >= profileRank("privileged")
+}
+
+// newNotification describes a session phase in a human-readable text line
+func (config *DebugConfig) newNotification(phase, pod, user string, hostNamespaces bool, now time.Time) Notification {
+	n := Notification{
+		Phase:          phase,
+		Time:           now.UTC(),
+		User:           user,
+		Context:        kubeContext,
+		Namespace:      config.Namespace,
+		Pod:            pod,
+		Target:         config.PodName,
+		Profile:        config.Profile,
+		HostNamespaces: hostNamespaces,
+	}
+
+	who := user
+	if who == "" {
+		who = "unknown user"
+	}
+	var kind []string
+	if notifiedProfile(config.Profile) {
+		kind = append(kind, config.Profile)
+	}
+	if hostNamespaces {
+		kind = append(kind, "host-namespace")
+	}
+	n.Text = fmt.Sprintf("kpdbug: %s debug session %s by %s on %s/%s",
+		strings.Join(kind, " "), phase, who, config.Namespace, pod)
+	if config.PodName != "" && config.PodName != pod {
+		n.Text += " targeting " + config.PodName
+	}
+	if kubeContext != "" {
+		n.Text += " (context " + kubeContext + ")"
+	}
+	return n
+}
+
+// notifySession posts a notification for elevated or host-namespace
+// sessions when a webhook is configured; failures only warn
+func (config *DebugConfig) notifySession(phase, pod string, hostNamespaces bool) {
+	settings := currentConfig().Notifications
+	if settings == nil || settings.Webhook == "" {
+		return
+	}
+	if !notifiedProfile(config.Profile) && !hostNamespaces {
+		return
+	}
+
+	n := config.newNotification(phase, pod, config.currentUser(), hostNamespaces, clock())
+	if err := postNotification(settings.Webhook, n); err != nil {
+		config.logf("Warning: Could not send session notification: %v", err)
+	}
+}
+
+// postNotification sends n as JSON to url
+func postNotification(url string, n Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("error generating notification: %v", err)
+	}
+
+	client := &http.Client{Timeout: notifyTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
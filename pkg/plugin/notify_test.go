@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewNotification(t *testing.T) {
+	config := &DebugConfig{Namespace: "shop", PodName: "web-0", Profile: "privileged"}
+	now := time.Date(2026, 3, 4, 10, 20, 30, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		pod            string
+		user           string
+		hostNamespaces bool
+		want           string
+	}{
+		{"copy", "web-0-debug", "alice", false, "kpdbug: privileged debug session started by alice on shop/web-0-debug targeting web-0"},
+		{"ephemeral", "web-0", "alice", false, "kpdbug: privileged debug session started by alice on shop/web-0"},
+		{"unknown user on host", "web-0", "", true, "kpdbug: privileged host-namespace debug session started by unknown user on shop/web-0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := config.newNotification(NotifyStarted, tt.pod, tt.user, tt.hostNamespaces, now)
+			if n.Text != tt.want {
+				t.Errorf("Text = %q, want %q", n.Text, tt.want)
+			}
+			if n.Phase != NotifyStarted || n.Pod != tt.pod || n.Target != "web-0" || n.HostNamespaces != tt.hostNamespaces {
+				t.Errorf("Notification = %+v", n)
+			}
+		})
+	}
+}
+
+func TestNotifiedProfile(t *testing.T) {
+	tests := []struct {
+		profile string
+		want    bool
+	}{
+		{"", false},
+		{"restricted", false},
+		{"baseline", false},
+		{"general", false},
+		{"netadmin", true},
+		{ebpfProfile, true},
+		{"sysadmin", true},
+		{"privileged", true},
+	}
+	for _, tt := range tests {
+		if got := notifiedProfile(tt.profile); got != tt.want {
+			t.Errorf("notifiedProfile(%q) = %v, want %v", tt.profile, got, tt.want)
+		}
+	}
+
+	config := &DebugConfig{Namespace: "shop", PodName: "web-0", Profile: "sysadmin"}
+	n := config.newNotification(NotifyStarted, "web-0", "alice", false, time.Date(2026, 3, 4, 10, 20, 30, 0, time.UTC))
+	if want := "kpdbug: sysadmin debug session started by alice on shop/web-0"; n.Text != want {
+		t.Errorf("Text = %q, want %q", n.Text, want)
+	}
+}
+
+func TestPostNotification(t *testing.T) {
+	var received Notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("decoding payload: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	if err := postNotification(server.URL, Notification{Text: "hello", Phase: NotifyEnded, Pod: "web-0"}); err != nil {
+		t.Fatalf("postNotification() error = %v", err)
+	}
+	if received.Text != "hello" || received.Phase != NotifyEnded || received.Pod != "web-0" {
+		t.Errorf("received %+v", received)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer failing.Close()
+	if err := postNotification(failing.URL, Notification{}); err == nil {
+		t.Error("postNotification() to a failing webhook succeeded, want error")
+	}
+}
@@ -0,0 +1,292 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var oomCmd = &cobra.Command{
+	Use:   "oom",
+	Short: "Explain OOM kills of the target pod",
+	Long: `Correlate the OOM evidence of the target pod: the OOMKilled terminations in its
+container statuses, the kernel's OOM-kill records on its node and the memory
+events of its cgroups. The report names the process the kernel killed, when,
+and its resident memory at that moment next to the container's limit.
+
+The kernel log and cgroups are read from a debug pod on the pod's node.`,
+	Example: `  kpdbug oom -p mypod
+  kpdbug oom -p mypod -n shop`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runOOM(cmd)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(oomCmd)
+}
+
+// oomScript prints the kernel OOM records as a "### kernel" section and the
+// memory usage and events of each cgroup ID as "### memory <id>" and
+// "### events <id>" sections
+const oomScript = `echo "### kernel"
+(chroot /host journalctl -k --no-pager -o short-iso 2>/dev/null || chroot /host dmesg -T 2>/dev/null || dmesg -T 2>/dev/null) |
+  grep -E "oom-kill:|Killed process" | tail -n 500
+base=/host/sys/fs/cgroup
+root=$base/
+[ -d "$base/memory" ] && root=$base/memory/
+for id in %s; do
+  dir=$(find "$root" -path "*kubepods*" -type d -name "*$id*" 2>/dev/null | head -n 1)
+  [ -z "$dir" ] && continue
+  echo "### memory $id"
+  if [ -f "$dir/memory.events" ]; then
+    echo "current $(cat "$dir/memory.current" 2>/dev/null)"
+    echo "peak $(cat "$dir/memory.peak" 2>/dev/null)"
+    echo "limit $(cat "$dir/memory.max" 2>/dev/null)"
+    echo "### events $id"; cat "$dir/memory.events"
+  else
+    echo "current $(cat "$dir/memory.usage_in_bytes" 2>/dev/null)"
+    echo "peak $(cat "$dir/memory.max_usage_in_bytes" 2>/dev/null)"
+    echo "limit $(cat "$dir/memory.limit_in_bytes" 2>/dev/null)"
+    echo "### events $id"; cat "$dir/memory.oom_control" 2>/dev/null; echo "failcnt $(cat "$dir/memory.failcnt" 2>/dev/null)"
+  fi
+done`
+
+// oomTermination is an OOMKilled termination from a container status
+type oomTermination struct {
+	Container   string
+	ContainerID string
+	FinishedAt  string
+	ExitCode    int32
+	Restarts    int32
+	Current     bool // the container is terminated now, not restarted
+}
+
+// oomKill is one OOM kill of the pod recorded by the kernel
+type oomKill struct {
+	Time      string
+	Container string // empty when the cgroup is the pod's
+	Process   string
+	PID       int
+	AnonRSSKB int64
+	Memcg     string
+}
+
+var killedProcessPattern = regexp.MustCompile(`Killed process (\d+) \(([^)]*)\).*?anon-rss:(\d+)kB`)
+
+// oomTerminations lists the containers whose current or last state is an
+// OOMKilled termination
+func oomTerminations(pod *corev1.Pod) []oomTermination {
+	var terminations []oomTermination
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		for i, state := range []corev1.ContainerState{status.State, status.LastTerminationState} {
+			terminated := state.Terminated
+			if terminated == nil || terminated.Reason != "OOMKilled" {
+				continue
+			}
+			terminations = append(terminations, oomTermination{
+				Container:   status.Name,
+				ContainerID: runtimeID(terminated.ContainerID),
+				FinishedAt:  terminated.FinishedAt.UTC().Format("2006-01-02T15:04:05Z"),
+				ExitCode:    terminated.ExitCode,
+				Restarts:    status.RestartCount,
+				Current:     i == 0,
+			})
+		}
+	}
+	return terminations
+}
+
+// runtimeID strips the runtime scheme from a containerID such as
+// containerd://0123abcd
+func runtimeID(containerID string) string {
+	if _, id, ok := strings.Cut(containerID, "://"); ok {
+		return id
+	}
+	return containerID
+}
+
+// podContainerIDs maps the current and previous runtime IDs of the pod's
+// containers to their names
+func podContainerIDs(pod *corev1.Pod) map[string]string {
+	ids := map[string]string{}
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if id := runtimeID(status.ContainerID); id != "" {
+			ids[id] = status.Name
+		}
+		if terminated := status.LastTerminationState.Terminated; terminated != nil {
+			if id := runtimeID(terminated.ContainerID); id != "" {
+				ids[id] = status.Name
+			}
+		}
+	}
+	return ids
+}
+
+// kernelTimestamp returns the timestamp of a journalctl short-iso line or of
+// a dmesg -T "[...]" line
+func kernelTimestamp(line string) string {
+	if strings.HasPrefix(line, "[") {
+		if end := strings.Index(line, "]"); end > 0 {
+			return line[1:end]
+		}
+	}
+	if fields := strings.Fields(line); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// parseOOMKills picks the kernel OOM kills whose memory cgroup belongs to the
+// pod. An "oom-kill:" record names the cgroup and task; the "Killed process"
+// line that follows it adds the resident memory at the time of the kill.
+func parseOOMKills(lines []string, podUID string, containers map[string]string) []oomKill {
+	podMarkers := []string{"pod" + podUID, "pod" + strings.ReplaceAll(podUID, "-", "_")}
+	var kills []oomKill
+	var last *oomKill
+	for _, line := range lines {
+		if _, record, ok := strings.Cut(line, "oom-kill:"); ok {
+			last = nil
+			fields := map[string]string{}
+			for _, field := range strings.Split(record, ",") {
+				if key, value, ok := strings.Cut(strings.TrimSpace(field), "="); ok {
+					fields[key] = value
+				}
+			}
+			memcg := fields["task_memcg"]
+			if podUID == "" || (!strings.Contains(memcg, podMarkers[0]) && !strings.Contains(memcg, podMarkers[1])) {
+				continue
+			}
+			kill := oomKill{Time: kernelTimestamp(line), Process: fields["task"], Memcg: memcg}
+			kill.PID, _ = strconv.Atoi(fields["pid"])
+			for id, name := range containers {
+				if strings.Contains(memcg, id) {
+					kill.Container = name
+				}
+			}
+			kills = append(kills, kill)
+			last = &kills[len(kills)-1]
+			continue
+		}
+		match := killedProcessPattern.FindStringSubmatch(line)
+		if match == nil || last == nil {
+			continue
+		}
+		if pid, _ := strconv.Atoi(match[1]); pid == last.PID {
+			last.Process = match[2]
+			last.AnonRSSKB, _ = strconv.ParseInt(match[3], 10, 64)
+		}
+		last = nil
+	}
+	return kills
+}
+
+func runOOM(cmd *cobra.Command) error {
+	config, err := newTargetConfig(cmd.Context(), cmd, "", "")
+	if err != nil {
+		return err
+	}
+
+	pod, err := config.getPod(config.PodName, config.Namespace)
+	if err != nil {
+		return NewPodNotFoundError(config.PodName, config.Namespace).WithOriginalError(err)
+	}
+
+	fmt.Printf("Pod %s/%s on node %s\n\n", config.Namespace, config.PodName, pod.Spec.NodeName)
+	terminations := oomTerminations(pod)
+	fmt.Println("Container terminations:")
+	if len(terminations) == 0 {
+		fmt.Println("  no OOMKilled termination in the container statuses")
+	}
+	for _, t := range terminations {
+		state := "last state"
+		if t.Current {
+			state = "current state"
+		}
+		fmt.Printf("  %-20s OOMKilled at %s (exit %d, %s), %d restarts, memory limit %s\n",
+			t.Container, t.FinishedAt, t.ExitCode, state, t.Restarts, containerMemoryLimit(pod, t.Container))
+	}
+
+	if pod.Spec.NodeName == "" {
+		return nil
+	}
+	containers := podContainerIDs(pod)
+	ids := []string{"pod" + string(pod.UID), "pod" + strings.ReplaceAll(string(pod.UID), "-", "_")}
+	for id := range containers {
+		ids = append(ids, id)
+	}
+
+	log.Printf("Reading the kernel log and cgroups of node %s...", pod.Spec.NodeName)
+	result, err := config.runNodeScript(pod.Spec.NodeName, fmt.Sprintf(oomScript, strings.Join(ids, " ")))
+	if err != nil {
+		return err
+	}
+	sections := splitSections(result.Output)
+
+	fmt.Println("\nKernel OOM kills:")
+	kills := parseOOMKills(sections["kernel"], string(pod.UID), containers)
+	if len(kills) == 0 {
+		fmt.Println("  none recorded for this pod in the node's kernel log")
+	}
+	for _, kill := range kills {
+		container := kill.Container
+		if container == "" {
+			container = "(pod)"
+		}
+		rss := "-"
+		if kill.AnonRSSKB > 0 {
+			rss = formatKB(kill.AnonRSSKB)
+		}
+		fmt.Printf("  %-26s %-20s %s (pid %d), anon-rss %s\n", kill.Time, container, kill.Process, kill.PID, rss)
+	}
+
+	fmt.Println("\nCgroup memory:")
+	printed := false
+	for _, id := range ids {
+		memory, ok := sections["memory "+id]
+		if !ok {
+			continue
+		}
+		name := containers[id]
+		if name == "" {
+			name = "(pod)"
+		}
+		usage := keyValues(memory)
+		events := keyValues(sections["events "+id])
+		limit := "none"
+		if l := usage["limit"]; l > 0 && l < unlimitedMemory {
+			limit = formatKB(l / 1024)
+		}
+		peak := "-"
+		if p, ok := usage["peak"]; ok {
+			peak = formatKB(p / 1024)
+		}
+		fmt.Printf("  %-20s current %s, peak %s, limit %s, oom kills %d\n",
+			name, formatKB(usage["current"]/1024), peak, limit, events["oom_kill"])
+		printed = true
+	}
+	if !printed {
+		fmt.Println("  no cgroup found for the pod on its node")
+	}
+	return nil
+}
+
+// containerMemoryLimit returns the memory limit of a container, or "none"
+func containerMemoryLimit(pod *corev1.Pod, name string) string {
+	for _, c := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		if c.Name == name {
+			if limit, ok := c.Resources.Limits[corev1.ResourceMemory]; ok {
+				return limit.String()
+			}
+		}
+	}
+	return "none"
+}
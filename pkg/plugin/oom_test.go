@@ -0,0 +1,69 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestOOMTerminations(t *testing.T) {
+	finished := metav1.NewTime(time.Date(2026, 10, 14, 9, 30, 0, 0, time.UTC))
+	pod := &corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+		{
+			Name:         "app",
+			ContainerID:  "containerd://new",
+			RestartCount: 3,
+			LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+				Reason: "OOMKilled", ExitCode: 137, FinishedAt: finished, ContainerID: "containerd://old",
+			}},
+		},
+		{
+			Name: "sidecar",
+			LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+				Reason: "Error", ExitCode: 1,
+			}},
+		},
+	}}}
+
+	terminations := oomTerminations(pod)
+	if len(terminations) != 1 {
+		t.Fatalf("oomTerminations() = %+v, want only the app termination", terminations)
+	}
+	got := terminations[0]
+	if got.Container != "app" || got.ContainerID != "old" || got.FinishedAt != "2026-10-14T09:30:00Z" || got.Restarts != 3 || got.Current {
+		t.Errorf("oomTerminations()[0] = %+v", got)
+	}
+
+	ids := podContainerIDs(pod)
+	if ids["new"] != "app" || ids["old"] != "app" {
+		t.Errorf("podContainerIDs() = %v, want the current and previous app IDs", ids)
+	}
+}
+
+func TestParseOOMKills(t *testing.T) {
+	uid := "1234-abcd"
+	lines := []string{
+		"2026-10-14T09:30:00+0000 worker-1 kernel: oom-kill:constraint=CONSTRAINT_MEMCG,nodemask=(null),cpuset=cri-containerd-old.scope,mems_allowed=0,oom_memcg=/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234_abcd.slice/cri-containerd-old.scope,task_memcg=/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234_abcd.slice/cri-containerd-old.scope,task=java,pid=4242,uid=1000",
+		"2026-10-14T09:30:00+0000 worker-1 kernel: Memory cgroup out of memory: Killed process 4242 (java) total-vm:4000000kB, anon-rss:262144kB, file-rss:1024kB, shmem-rss:0kB, UID:1000 pgtables:1000kB oom_score_adj:969",
+		"[Wed Oct 14 09:40:00 2026] oom-kill:constraint=CONSTRAINT_MEMCG,task_memcg=/kubepods/besteffort/pod9999/other,task=nginx,pid=77,uid=0",
+		"[Wed Oct 14 09:40:00 2026] Memory cgroup out of memory: Killed process 77 (nginx) total-vm:1000kB, anon-rss:512kB, file-rss:0kB",
+	}
+
+	kills := parseOOMKills(lines, uid, map[string]string{"old": "app"})
+	if len(kills) != 1 {
+		t.Fatalf("parseOOMKills() = %+v, want one kill of the pod", kills)
+	}
+	kill := kills[0]
+	if kill.Time != "2026-10-14T09:30:00+0000" || kill.Container != "app" || kill.Process != "java" || kill.PID != 4242 || kill.AnonRSSKB != 262144 {
+		t.Errorf("parseOOMKills()[0] = %+v", kill)
+	}
+
+	if got := kernelTimestamp(lines[2]); got != "Wed Oct 14 09:40:00 2026" {
+		t.Errorf("kernelTimestamp(dmesg) = %q", got)
+	}
+	if kills := parseOOMKills(lines, "", nil); len(kills) != 0 {
+		t.Errorf("parseOOMKills() without a pod UID = %+v, want none", kills)
+	}
+}
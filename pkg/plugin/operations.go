@@ -1,10 +1,16 @@
 package plugin
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log"
 	"os"
-	"os/exec"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/yaml"
 )
 
@@ -15,63 +21,257 @@ const (
 	OperationStandalone DebugOperation = iota
 	OperationCopyPod
 	OperationAddContainer
+	// OperationReplayJob runs a Job or CronJob's pod template with its
+	// entrypoints replaced by sleep
+	OperationReplayJob
 )
 
+// String returns the name of the operation, as in the DebugResult
+func (op DebugOperation) String() string {
+	switch op {
+	case OperationStandalone:
+		return "standalone"
+	case OperationCopyPod:
+		return "copy"
+	case OperationAddContainer:
+		return "ephemeral"
+	case OperationReplayJob:
+		return "replay"
+	}
+	return "unknown"
+}
+
+// DebugResult describes the outcome of Execute for programmatic callers
+type DebugResult struct {
+	// Pod is the debug pod, or the target of an ephemeral debug container
+	Pod       string
+	Namespace string
+	// Container is the debug container, empty for standalone and replay
+	// pods whose only container it is
+	Container string
+	// Strategy is the operation that ran, after the strategy selection
+	Strategy DebugOperation
+	// AttachCommand is the kubectl command line opening a shell in the
+	// debug container while it runs, with credentials such as --token
+	// redacted
+	AttachCommand string
+	// CleanedUp is set when the debug pod was deleted before returning
+	CleanedUp bool
+}
+
 // DebugConfig holds the configuration for debug operations
 type DebugConfig struct {
-	Operation     DebugOperation
-	Namespace     string
-	PodName       string
-	Image         string
-	Interactive   bool
-	TTY           bool
-	RemoveAfter   bool
-	Force         bool
-	CopyPod       bool
-	Profile       string
+	// Context cancels in-flight kubectl calls; defaults to context.Background()
+	Context context.Context
+	// Runner runs kubectl and the other external commands; defaults to
+	// running local processes
+	Runner KubectlRunner
+
+	Operation DebugOperation
+	Namespace string
+	// PodName is the target pod, or the Job or CronJob named by Workload
+	PodName string
+	// Workload is WorkloadJob or WorkloadCronJob when --pod was <kind>/<name>
+	Workload    string
+	Container   string
+	Image       string
+	Interactive bool
+	TTY         bool
+	// Command runs non-interactively in the debug container instead of a
+	// shell; with Interactive and no TTY, stdin is streamed into it
+	Command string
+	// CustomSpec is a partial container spec file merged over the defaults
+	// passed to kubectl debug --custom
+	CustomSpec string
+	// Output "name" prints only the debug pod name to stdout; everything
+	// else goes to stderr
+	Output      string
+	RemoveAfter bool
+	Force       bool
+	CopyPod     bool
+	Profile     string
+	// SeccompProfile and AppArmorProfile override the profile defaults,
+	// e.g. "localhost/profiles/audit.json" or "localhost/k8s-debug"
+	SeccompProfile  string
+	AppArmorProfile string
+	// CapAdd and CapDrop adjust the profile's capabilities, e.g. NET_RAW
+	CapAdd  []string
+	CapDrop []string
+	// GCWithTarget sets the target pod as owner of the debug pod so it is
+	// garbage collected when the target is deleted
+	GCWithTarget  bool
 	CPURequest    string
 	MemoryLimit   string
 	MemoryRequest string
+	// QuotaFloor, e.g. "cpu=50m,memory=64Mi", lets the debug container's
+	// resources shrink to the remaining ResourceQuota but not below it
+	QuotaFloor string
+	// VerifyImage enforces the image verification of the config file for
+	// this session, whatever the profile
+	VerifyImage bool
+	// TTL is the requested lifetime of debug pods; the maxTTL of the cluster
+	// policy and the config file caps it
+	TTL time.Duration
+	// SkipShellProbe does not run sh in the target container before adding
+	// an ephemeral container, which reports targets without a shell
+	SkipShellProbe bool
+	// Probes adds exec /bin/true liveness and readiness probes to standalone
+	// debug pods; images without /bin/true would restart in a loop
+	Probes bool
+	// TailTarget follows the target container's logs to stderr while a
+	// session is attached
+	TailTarget bool
+	// Follow recreates the ephemeral debug container and attaches again when
+	// the target restarts or is replaced
+	Follow bool
+	// Ordinal selects the pod of a statefulset/<name> target; nil selects
+	// the first
+	Ordinal *int
+	// OnNode selects the pod of a workload or selector target running on
+	// the node
+	OnNode string
+	// AvoidNodes keeps standalone debug pods off the nodes, e.g. after a
+	// debug pod was evicted from one
+	AvoidNodes []string
+	// AttachRetries is how often an interactive session is reattached after
+	// a connection failure before giving up
+	AttachRetries int
+	// OutputFile is the file name prefix the output of --command sessions
+	// is saved under, one file per pod
+	OutputFile string
+	// KubectlFlags, when not nil, replace the global kubectl flags of the
+	// command line (--kubeconfig, --context, --as, ...) for this config
+	KubectlFlags []string
+	// Stdin, Stdout and Stderr connect sessions and kubectl output; nil
+	// uses the process's own. The terminal modes are only saved and
+	// restored for the process's stdin.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// stopSession, when closed, ends the running session like SIGTERM
+	stopSession <-chan struct{}
+	// result collects the DebugResult of Execute
+	result *DebugResult
+	// users caches the username kubectl authenticates as
+	users *userLookup
+	// logPrefix marks the progress lines of one of several targets run at
+	// once, e.g. "[web] "
+	logPrefix string
+	// detachedPod is the pod of a session the user detached from, which
+	// --rm leaves running
+	detachedPod string
 }
 
 // NewDebugConfigFromFlags creates a DebugConfig from global flags
 func NewDebugConfigFromFlags() *DebugConfig {
 	config := &DebugConfig{
-		Namespace:     namespace,
-		PodName:       podName,
-		Image:         image,
-		Interactive:   interactive,
-		TTY:           tty,
-		RemoveAfter:   removeAfter,
-		Force:         force,
-		CopyPod:       copyPod,
-		Profile:       profile,
-		CPURequest:    cpuRequest,
-		MemoryLimit:   memoryLimit,
-		MemoryRequest: memoryRequest,
-	}
-
-	// Determine operation type
-	if config.PodName == "" {
+		Namespace:       currentNamespace(context.Background()),
+		PodName:         podName,
+		Container:       container,
+		Image:           image,
+		Interactive:     interactive,
+		TTY:             tty,
+		Command:         remoteCommand,
+		Output:          debugOutput,
+		CustomSpec:      customSpecFile,
+		RemoveAfter:     removeAfter,
+		Force:           force,
+		CopyPod:         copyPod,
+		Profile:         profile,
+		SeccompProfile:  seccompProfile,
+		AppArmorProfile: appArmorProfile,
+		CapAdd:          capAdd,
+		CapDrop:         capDrop,
+		GCWithTarget:    gcWithTarget,
+		CPURequest:      cpuRequest,
+		MemoryLimit:     memoryLimit,
+		MemoryRequest:   memoryRequest,
+		QuotaFloor:      quotaFloor,
+		VerifyImage:     verifyImage,
+		TTL:             debugTTL,
+		Probes:          debugProbes,
+		SkipShellProbe:  noProbeShell,
+		TailTarget:      tailTarget,
+		Follow:          followTarget,
+		OnNode:          onNode,
+		AttachRetries:   attachRetries,
+		OutputFile:      outputFile,
+		users:           flagUser,
+	}
+	if ordinal >= 0 {
+		config.Ordinal = ptr.To(ordinal)
+	}
+
+	config.selectOperation()
+	return config
+}
+
+// selectOperation determines the operation type from the target in PodName
+func (config *DebugConfig) selectOperation() {
+	if kind, name := parseWorkloadTarget(config.PodName); kind != "" {
+		config.Workload = kind
+		config.PodName = name
+		config.Operation = OperationReplayJob
+	} else if config.PodName == "" {
 		config.Operation = OperationStandalone
 	} else if config.CopyPod {
 		config.Operation = OperationCopyPod
 	} else {
 		config.Operation = OperationAddContainer
 	}
+}
 
-	return config
+// Execute runs the debug operation based on the configuration and returns
+// what it did; the result is filled in as far as the operation got when it
+// fails
+func (config *DebugConfig) Execute() (*DebugResult, error) {
+	config.result = &DebugResult{}
+	if config.users == nil {
+		config.users = &userLookup{}
+	}
+	err := config.execute()
+	if err != nil && config.context().Err() != nil {
+		err = fmt.Errorf("interrupted: %w", config.context().Err())
+	}
+	config.result.Namespace = config.Namespace
+	config.result.Strategy = config.Operation
+	return config.result, err
 }
 
-// Execute runs the debug operation based on the configuration
-func (config *DebugConfig) Execute() error {
+func (config *DebugConfig) execute() error {
+	if err := config.enforcePolicy(""); err != nil {
+		return err
+	}
+	config.warnCapabilityViolations()
+	config.warnEBPFProfile()
+	if err := config.verifyImage(elevatedProfiles[config.Profile]); err != nil {
+		return err
+	}
+	config.selectStrategy()
+	if err := config.selectByAccess(); err != nil {
+		return err
+	}
+	if config.GCWithTarget && config.Operation != OperationCopyPod {
+		config.logf("Warning: --gc-with-target only applies to pod copies; ephemeral containers already end with their pod")
+	}
+	if config.Follow && (config.Operation != OperationAddContainer || !config.attaches()) {
+		config.logf("Warning: --follow only applies to attached ephemeral container sessions (-p <pod> -it or --command)")
+		config.Follow = false
+	}
+
 	switch config.Operation {
 	case OperationStandalone:
 		return config.executeStandalone()
 	case OperationCopyPod:
 		return config.executeCopyPod()
 	case OperationAddContainer:
+		if config.Follow {
+			return config.executeFollow()
+		}
 		return config.executeAddContainer()
+	case OperationReplayJob:
+		return config.executeReplayJob()
 	default:
 		return NewValidationError("operation", "unknown", "invalid debug operation")
 	}
@@ -79,46 +279,47 @@ func (config *DebugConfig) Execute() error {
 
 // executeStandalone creates a new standalone debug pod
 func (config *DebugConfig) executeStandalone() error {
+	if config.CustomSpec != "" {
+		config.logf("Warning: --custom only applies to ephemeral container and copy operations; ignoring %s", config.CustomSpec)
+	}
+
+	if err := config.fitNamespaceResources(nil); err != nil {
+		return err
+	}
+
 	debugPodName, err := config.createDebugPod()
 	if err != nil {
 		return WrapKubectlError(err, "create debug pod")
 	}
+	config.emitPodEvent(EventCreated, debugPodName, "standalone debug pod")
+	config.recordDebugPod(debugPodName, "", "exec", "-it", debugPodName, "-n", config.Namespace, "--", "sh")
 
-	// Set up signal handler for cleanup
+	// With --rm, clean up the pod when the operation returns, also after an
+	// interrupt, unless the session was only cut off and can be reattached
+	cleanup := config.removeOnExit(debugPodName, false)
 	if config.RemoveAfter {
-		config.setupSignalHandler(debugPodName)
+		defer cleanup.run()
 	}
 
 	// Wait for pod to be ready only if we're going to attach to it
-	if config.Interactive && config.TTY {
-		log.Printf("Waiting for pod to be ready...")
+	if config.attaches() {
+		config.logf("Waiting for pod to be ready...")
+		config.emitPodEvent(EventWaiting, debugPodName, "")
 		if err := config.waitForPod(debugPodName); err != nil {
 			return NewTimeoutError("pod ready", "30s").WithOriginalError(err)
 		}
+		config.emitPodEvent(EventReady, debugPodName, "")
 	}
 
-	// If --rm flag is set, clean up the pod after the session ends
-	if config.RemoveAfter {
-		defer func() {
-			log.Printf("Cleaning up debug pod %s...", debugPodName)
-			deleteArgs := []string{
-				"delete",
-				"pod",
-				debugPodName,
-				"-n",
-				config.Namespace,
+	// Run the command, or attach to the pod if interactive mode is enabled
+	if config.Command != "" {
+		if err := config.runPodSession(debugPodName, config.commandExecArgs(debugPodName)...); err != nil {
+			if isSessionLost(err) {
+				cleanup.keep()
 			}
-			deleteCmd := ExecCommand("kubectl", deleteArgs...)
-			if err := deleteCmd.Run(); err != nil {
-				log.Printf("Warning: Failed to delete debug pod: %v", err)
-			} else {
-				log.Printf("Debug pod deleted successfully")
-			}
-		}()
-	}
-
-	// Attach to the pod if interactive mode is enabled
-	if config.Interactive && config.TTY {
+			return wrapSessionError(err, "run command in pod")
+		}
+	} else if config.Interactive && config.TTY {
 		attachArgs := []string{
 			"attach",
 			"-it",
@@ -126,18 +327,21 @@ func (config *DebugConfig) executeStandalone() error {
 			"-n",
 			config.Namespace,
 		}
-		attachCmd := ExecCommand("kubectl", attachArgs...)
-		attachCmd.Stdin = os.Stdin
-		attachCmd.Stdout = os.Stdout
-		attachCmd.Stderr = os.Stderr
-		if err := attachCmd.Run(); err != nil {
-			if exitErr, ok := err.(*exec.ExitError); ok {
-				os.Exit(exitErr.ExitCode())
+		// Returning instead of exiting lets the deferred cleanup run
+		if err := config.runPodSession(debugPodName, attachArgs...); err != nil {
+			if isSessionLost(err) {
+				cleanup.keep()
+			}
+			if evicted := asPodEvicted(err); evicted != nil && config.offerRecreate(evicted) {
+				config.AvoidNodes = append(config.AvoidNodes, evicted.Node)
+				return config.executeStandalone()
 			}
-			return WrapKubectlError(err, "attach to pod")
+			return wrapSessionError(err, "attach to pod")
 		}
 	} else {
-		log.Printf("You can access the pod with: kubectl exec -it %s -n %s -- sh\n", debugPodName, config.Namespace)
+		config.notifySession(NotifyCreated, debugPodName, false)
+		config.logf("You can access the pod with: kubectl exec -it %s -n %s -- sh\n", debugPodName, config.Namespace)
+		config.printPodName(debugPodName)
 	}
 
 	return nil
@@ -181,43 +385,156 @@ func (config *DebugConfig) executeAddContainer() error {
 		return WrapKubectlError(err, "get target container name")
 	}
 
+	customFile, err := config.writeEphemeralSpec()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(customFile)
+	}()
+
 	args := []string{
 		"debug", config.PodName,
 		"-n", config.Namespace,
-		"--image", config.Image,
+		"--image", config.debugImage(),
 		"--target=" + containerName,
+		"--custom=" + customFile,
 	}
 
 	// Always set profile if specified, otherwise use "general" as default
-	if config.Profile != "" {
-		args = append(args, "--profile="+config.Profile)
-	} else {
-		args = append(args, "--profile=general")
+	args = append(args, "--profile="+kubectlDebugProfile(config.Profile))
+
+	debugContainer := "debugger-" + randomSuffix()
+	args = append(args, "--container="+debugContainer)
+	args = append(args, config.sessionArgs()...)
+	config.recordDebugPod(config.PodName, debugContainer, "attach", "-it", config.PodName, "-c", debugContainer, "-n", config.Namespace)
+
+	if ttl := config.sessionTTL(); ttl > 0 {
+		config.logf("Warning: ephemeral containers cannot be given a deadline without ending pod %s; the session is not limited to %s", config.PodName, ttl)
+	}
+	config.logf("Adding debug container to pod %s (targeting container %s)...\n", config.PodName, containerName)
+	if config.attaches() {
+		config.recordTargetEvent(ReasonSessionStarted, "Ephemeral debug container session started")
+		err := config.runPodSession(config.PodName, args...)
+		config.recordTargetEvent(ReasonSessionEnded, "Ephemeral debug container session ended")
+		return wrapSessionError(err, "add debug container")
+	}
+	if err := config.runSession(args...); err != nil {
+		return WrapKubectlError(err, "add debug container")
+	}
+	config.recordTargetEvent(ReasonSessionStarted, "Ephemeral debug container added")
+	config.notifySession(NotifyCreated, config.PodName, false)
+	config.emitPodEvent(EventCreated, config.PodName, "ephemeral debug container added")
+	config.printPodName(config.PodName)
+	return nil
+}
+
+// Helper methods
+
+// stdout is where progress output of kubectl and prompts go: stderr when
+// only the pod name may be written to stdout
+func (config *DebugConfig) stdout() io.Writer {
+	if config.Output == "name" {
+		return config.stderr()
+	}
+	if config.Stdout != nil {
+		return config.Stdout
+	}
+	return os.Stdout
+}
+
+// stderr is where kubectl's errors go
+func (config *DebugConfig) stderr() io.Writer {
+	if config.Stderr != nil {
+		return config.Stderr
+	}
+	return os.Stderr
+}
+
+// logf logs a progress line like log.Printf, marked with the logPrefix
+func (config *DebugConfig) logf(format string, args ...any) {
+	log.Print(config.logPrefix + fmt.Sprintf(format, args...))
+}
+
+// stdin is the input of sessions
+func (config *DebugConfig) stdin() io.Reader {
+	if config.Stdin != nil {
+		return config.Stdin
 	}
+	return os.Stdin
+}
+
+// recordDebugPod records the debug pod and container in the result, with
+// the kubectl arguments opening a shell in it
+func (config *DebugConfig) recordDebugPod(pod, container string, attach ...string) {
+	if config.result == nil {
+		return
+	}
+	config.result.Pod, config.result.Container = pod, container
+	config.result.AttachCommand = displayKubectl(config.withKubectlFlags(attach))
+}
+
+// recordCleanup records in the result that the debug pod was deleted
+func (config *DebugConfig) recordCleanup(pod string) {
+	if config.result != nil && config.result.Pod == pod {
+		config.result.CleanedUp = true
+	}
+}
+
+// printPodName writes the debug pod name for -o name, the only output on
+// stdout
+func (config *DebugConfig) printPodName(name string) {
+	if config.Output != "name" {
+		return
+	}
+	out := config.Stdout
+	if out == nil {
+		out = os.Stdout
+	}
+	fmt.Fprintln(out, name)
+}
+
+// attaches reports whether the session stays connected to the debug
+// container: an interactive shell, or a command whose output and exit code
+// are waited for
+func (config *DebugConfig) attaches() bool {
+	return (config.Interactive && config.TTY) || config.Command != ""
+}
 
+// ioArgs returns the kubectl stdin/TTY flags; -i without -t streams piped
+// input into the command
+func (config *DebugConfig) ioArgs() []string {
+	var args []string
 	if config.Interactive {
 		args = append(args, "-i")
 	}
 	if config.TTY {
 		args = append(args, "-t")
 	}
-	if config.Interactive && config.TTY {
+	return args
+}
+
+// sessionArgs returns the trailing kubectl debug arguments: the I/O flags
+// followed by the command, if any
+func (config *DebugConfig) sessionArgs() []string {
+	args := config.ioArgs()
+	if config.Command != "" {
+		args = append(args, "--attach=true", "--quiet", "--", "sh", "-c", config.Command)
+	} else if config.Interactive && config.TTY {
 		args = append(args, "--")
 	}
-
-	log.Printf("Adding debug container to pod %s (targeting container %s)...\n", config.PodName, containerName)
-	cmd := ExecCommand("kubectl", args...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	return cmd.Run()
+	return args
 }
 
-// Helper methods
+// commandExecArgs returns the kubectl exec arguments running the command in
+// an existing debug pod
+func (config *DebugConfig) commandExecArgs(pod string) []string {
+	args := append([]string{"exec"}, config.ioArgs()...)
+	return append(args, pod, "-n", config.Namespace, "--", "sh", "-c", config.Command)
+}
 
 func (config *DebugConfig) verifyTargetPod() error {
-	cmd := ExecCommand("kubectl", "get", "pod", config.PodName, "-n", config.Namespace)
+	cmd := config.kubectl("get", "pod", config.PodName, "-n", config.Namespace)
 	if cmd.Run() != nil {
 		return NewPodNotFoundError(config.PodName, config.Namespace)
 	}
@@ -225,34 +542,138 @@ func (config *DebugConfig) verifyTargetPod() error {
 }
 
 func (config *DebugConfig) useExistingPod(existingPod string) error {
-	log.Printf("Using existing debug pod: %s\n", existingPod)
-	if config.Interactive && config.TTY {
-		log.Printf("Attaching to pod...\n")
-		if err := config.attachToPod(existingPod); err != nil {
-			return WrapKubectlError(err, "attach to existing pod")
+	config.logf("Using existing debug pod: %s\n", existingPod)
+	config.recordDebugPod(existingPod, "", "exec", "-it", existingPod, "-n", config.Namespace, "--", "sh")
+	if config.attaches() {
+		var sessionErr error
+		if config.Command != "" {
+			sessionErr = wrapSessionError(config.runPodSession(existingPod, config.commandExecArgs(existingPod)...), "run command in existing pod")
+		} else {
+			config.logf("Attaching to pod...\n")
+			sessionErr = wrapSessionError(config.attachToPod(existingPod), "attach to existing pod")
 		}
-		if config.RemoveAfter {
-			log.Printf("Removing debug pod...\n")
+		if _, exited := sessionErr.(*ExitCodeError); sessionErr != nil && !exited {
+			return sessionErr
+		}
+		if config.RemoveAfter && config.detachedPod != existingPod {
+			config.logf("Removing debug pod...\n")
 			if err := config.deletePod(existingPod); err != nil {
 				return WrapKubectlError(err, "delete pod")
 			}
 		}
+		return sessionErr
 	} else {
-		log.Printf("You can access the pod with: kubectl exec -it %s -n %s -- sh\n", existingPod, config.Namespace)
+		config.logf("You can access the pod with: kubectl exec -it %s -n %s -- sh\n", existingPod, config.Namespace)
+		config.printPodName(existingPod)
 	}
 	return nil
 }
 
 func (config *DebugConfig) createPodCopy() error {
-	debugPodName := config.generateUniqueName()
+	// kubectl debug --copy-to refuses existing names, so pick a free one first
+	debugPodName, err := config.freePodName()
+	if err != nil {
+		return err
+	}
 
-	// Set up signal handler for cleanup
-	if config.RemoveAfter {
-		config.setupSignalHandler(debugPodName)
+	// The copy counts against the quota with all of the target's containers
+	var copied []corev1.ResourceRequirements
+	if target, err := config.getTargetPod(); err != nil {
+		config.logf("Warning: Could not get target pod resources for the quota check: %v", err)
+	} else {
+		for _, c := range target.Spec.Containers {
+			copied = append(copied, c.Resources)
+		}
+	}
+	if err := config.fitNamespaceResources(copied); err != nil {
+		return err
 	}
 
-	// Create custom debug container configuration for resources
-	customDebug := map[string]interface{}{
+	// Create temporary file for custom debug configuration
+	customFile, err := config.writeCustomSpec()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(customFile)
+	}()
+
+	// Check if target pod has a security context
+	secContext, err := config.getTargetPodSecurityContext()
+	if err != nil {
+		config.logf("Warning: Could not get target pod security context: %v", err)
+	}
+
+	args := []string{
+		"debug", config.PodName,
+		"-n", config.Namespace,
+		"--image", config.debugImage(),
+		"--share-processes",
+		"--copy-to=" + debugPodName,
+		"--custom=" + customFile,
+	}
+
+	// Only set profile if target pod has security context or profile was explicitly set
+	if hasIdentitySettings(secContext) || config.Profile != "" {
+		args = append(args, "--profile="+kubectlDebugProfile(config.Profile))
+	}
+
+	debugContainer := "debugger-" + randomSuffix()
+	args = append(args, "--container="+debugContainer)
+	args = append(args, config.sessionArgs()...)
+	config.recordDebugPod(debugPodName, debugContainer, "attach", "-it", debugPodName, "-c", debugContainer, "-n", config.Namespace)
+
+	config.logf("Creating debug pod %s as a copy of %s...\n", debugPodName, config.PodName)
+	// A non-zero exit or an interrupt of the attached session still removes
+	// the copy, a connection loss leaves it to be reattached
+	var sessionErr error
+	var cleanup *podCleanup
+	if config.RemoveAfter && config.attaches() {
+		cleanup = config.removeOnExit(debugPodName, true)
+		defer cleanup.run()
+	}
+	if config.attaches() {
+		config.emitPodEvent(EventCreated, debugPodName, "copy of "+config.PodName)
+		if config.GCWithTarget {
+			go config.adoptByTarget(debugPodName)
+		}
+		go config.limitPodLifetime(debugPodName, config.activeDeadlineSeconds())
+		config.recordTargetEvent(ReasonSessionStarted, "Debug session started in copy "+debugPodName)
+		err := config.runPodSession(debugPodName, args...)
+		if cleanup != nil && isSessionLost(err) {
+			cleanup.keep()
+		}
+		sessionErr = wrapSessionError(err, "create debug pod copy")
+		config.recordTargetEvent(ReasonSessionEnded, "Debug session ended in copy "+debugPodName)
+	} else {
+		// Without a remote command kubectl's exit code is not the user's
+		if err := config.runSession(args...); err != nil {
+			return WrapKubectlError(err, "create debug pod copy")
+		}
+		config.recordTargetEvent(ReasonSessionStarted, "Debug copy "+debugPodName+" created")
+		config.notifySession(NotifyCreated, debugPodName, false)
+		if config.GCWithTarget {
+			config.adoptByTarget(debugPodName)
+		}
+		config.limitPodLifetime(debugPodName, config.activeDeadlineSeconds())
+	}
+	if _, exited := sessionErr.(*ExitCodeError); sessionErr != nil && !exited {
+		return sessionErr
+	}
+
+	if !config.attaches() {
+		config.emitPodEvent(EventCreated, debugPodName, "copy of "+config.PodName)
+		config.logf("You can access the pod with: kubectl exec -it %s -n %s -- sh\n", debugPodName, config.Namespace)
+		config.printPodName(debugPodName)
+	}
+
+	return sessionErr
+}
+
+// customContainerSpec builds the partial container spec passed to
+// kubectl debug --custom: resources plus any explicit security profiles
+func (config *DebugConfig) customContainerSpec() map[string]interface{} {
+	spec := map[string]interface{}{
 		"resources": map[string]interface{}{
 			"limits": map[string]string{
 				"memory": config.MemoryLimit,
@@ -264,81 +685,176 @@ func (config *DebugConfig) createPodCopy() error {
 		},
 	}
 
-	// Create temporary file for custom debug configuration
-	customYAML, err := yaml.Marshal(customDebug)
-	if err != nil {
-		return NewDetailedError(ErrorTypeValidation, "failed to create custom debug configuration").WithOriginalError(err)
+	if activePreset != nil {
+		if len(activePreset.Env) > 0 {
+			spec["env"] = activePreset.Env
+		}
+		if len(activePreset.VolumeMounts) > 0 {
+			spec["volumeMounts"] = activePreset.VolumeMounts
+		}
 	}
 
-	tmpfile, err := os.CreateTemp("", "debug-custom-*.yaml")
-	if err != nil {
-		return NewDetailedError(ErrorTypeValidation, "failed to create temporary file").WithOriginalError(err)
+	securityContext := map[string]interface{}{}
+	if config.Profile == ebpfProfile {
+		// kubectl debug has no such profile, so send its security context
+		containerContext, _ := getSecurityContextForProfile(ebpfProfile)
+		securityContext["capabilities"] = containerContext.Capabilities
+		securityContext["seccompProfile"] = containerContext.SeccompProfile
+		securityContext["allowPrivilegeEscalation"] = false
 	}
-	defer func() {
-		_ = os.Remove(tmpfile.Name())
-	}()
-
-	if _, err := tmpfile.Write(customYAML); err != nil {
-		return NewDetailedError(ErrorTypeValidation, "failed to write custom debug configuration").WithOriginalError(err)
+	if seccomp, err := parseSeccompProfile(config.SeccompProfile); err == nil && seccomp != nil {
+		securityContext["seccompProfile"] = seccomp
 	}
-	if err := tmpfile.Close(); err != nil {
-		return NewDetailedError(ErrorTypeValidation, "failed to close temporary file").WithOriginalError(err)
+	if appArmor, err := parseAppArmorProfile(config.AppArmorProfile); err == nil && appArmor != nil {
+		securityContext["appArmorProfile"] = appArmor
+	}
+	if len(config.CapAdd) > 0 || len(config.CapDrop) > 0 {
+		// kubectl replaces the capability lists, so send the complete result
+		containerContext, _ := getSecurityContextForProfile(config.Profile)
+		applyCapabilityOverrides(containerContext, config.CapAdd, config.CapDrop)
+		securityContext["capabilities"] = containerContext.Capabilities
+	}
+	if len(securityContext) > 0 {
+		spec["securityContext"] = securityContext
 	}
 
-	// Check if target pod has a security context
-	secContext, err := config.getTargetPodSecurityContext()
+	return spec
+}
+
+// mergedCustomSpec overlays the user's --custom partial container spec on
+// the tool's defaults: nested maps are merged and the user's values win, so
+// e.g. an env list or a securityContext.runAsUser can be added without losing
+// the default resources
+func (config *DebugConfig) mergedCustomSpec() (map[string]interface{}, error) {
+	// Round-trip through JSON so typed values merge like the user's YAML
+	data, err := json.Marshal(config.customContainerSpec())
 	if err != nil {
-		log.Printf("Warning: Could not get target pod security context: %v", err)
+		return nil, fmt.Errorf("error generating custom spec: %v", err)
+	}
+	var spec map[string]interface{}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("error generating custom spec: %v", err)
 	}
 
-	args := []string{
-		"debug", config.PodName,
-		"-n", config.Namespace,
-		"--image", config.Image,
-		"--share-processes",
-		"--copy-to=" + debugPodName,
-		"--custom=" + tmpfile.Name(),
+	user, err := config.userCustomSpec()
+	if err != nil {
+		return nil, err
 	}
+	return mergeMaps(spec, user), nil
+}
 
-	// Only set profile if target pod has security context or profile was explicitly set
-	if (secContext != nil && secContext.RunAsUser != nil) || config.Profile != "" {
-		profileToUse := config.Profile
-		if profileToUse == "" {
-			profileToUse = "general"
+// userCustomSpec reads the user's --custom partial container spec, nil
+// without --custom
+func (config *DebugConfig) userCustomSpec() (map[string]interface{}, error) {
+	if config.CustomSpec == "" {
+		return nil, nil
+	}
+	userData, err := os.ReadFile(config.CustomSpec)
+	if err != nil {
+		return nil, NewValidationError("custom", config.CustomSpec, "cannot read file").WithOriginalError(err)
+	}
+	var user map[string]interface{}
+	if err := yaml.Unmarshal(userData, &user); err != nil {
+		return nil, NewValidationError("custom", config.CustomSpec, "must be a YAML or JSON partial container spec").WithOriginalError(err)
+	}
+	// kubectl debug would drop them without a word
+	for _, field := range podDNSFields {
+		if _, ok := user[field]; ok {
+			return nil, NewValidationError("custom", config.CustomSpec, field+" is a pod field, and --custom is a container spec").
+				WithSuggestion("Copies and ephemeral containers keep the target's dnsPolicy and dnsConfig so resolver issues reproduce; to try other DNS settings, change them in the target's spec")
 		}
-		args = append(args, "--profile="+profileToUse)
 	}
+	return user, nil
+}
 
-	if config.Interactive {
-		args = append(args, "-i")
+// podDNSFields are the pod DNS settings a copy takes from the target, which
+// a --custom container spec cannot override
+var podDNSFields = []string{"dnsPolicy", "dnsConfig"}
+
+// ephemeralForbiddenFields are the container fields the API server rejects
+// for ephemeral containers
+var ephemeralForbiddenFields = []string{"resources", "ports", "livenessProbe", "readinessProbe", "startupProbe", "lifecycle"}
+
+// mergedEphemeralSpec is mergedCustomSpec for an ephemeral container: the
+// default resources and any field ephemeral containers cannot have are
+// dropped, with a warning when the user's --custom spec set them
+func (config *DebugConfig) mergedEphemeralSpec() (map[string]interface{}, error) {
+	spec, err := config.mergedCustomSpec()
+	if err != nil {
+		return nil, err
 	}
-	if config.TTY {
-		args = append(args, "-t")
+	user, err := config.userCustomSpec()
+	if err != nil {
+		return nil, err
 	}
-	if config.Interactive && config.TTY {
-		args = append(args, "--")
+	for _, field := range ephemeralForbiddenFields {
+		if _, ok := user[field]; ok {
+			config.logf("Warning: ignoring %s from --custom: ephemeral containers cannot set it", field)
+		}
+		delete(spec, field)
 	}
+	return spec, nil
+}
 
-	log.Printf("Creating debug pod %s as a copy of %s...\n", debugPodName, config.PodName)
-	cmd := ExecCommand("kubectl", args...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// mergeMaps deep-merges override into base; non-map values are replaced
+func mergeMaps(base, override map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		baseMap, baseIsMap := merged[key].(map[string]interface{})
+		overrideMap, overrideIsMap := value.(map[string]interface{})
+		if baseIsMap && overrideIsMap {
+			merged[key] = mergeMaps(baseMap, overrideMap)
+		} else {
+			merged[key] = value
+		}
+	}
+	return merged
+}
 
-	if err := cmd.Run(); err != nil {
-		return WrapKubectlError(err, "create debug pod copy")
+// writeCustomSpec writes the custom container spec to a temporary file and
+// returns its path; the caller removes it
+func (config *DebugConfig) writeCustomSpec() (string, error) {
+	spec, err := config.mergedCustomSpec()
+	if err != nil {
+		return "", err
 	}
+	return writeSpecFile(spec)
+}
 
-	if !config.Interactive || !config.TTY {
-		log.Printf("You can access the pod with: kubectl exec -it %s -n %s -- sh\n", debugPodName, config.Namespace)
+// writeEphemeralSpec is writeCustomSpec for an ephemeral container
+func (config *DebugConfig) writeEphemeralSpec() (string, error) {
+	spec, err := config.mergedEphemeralSpec()
+	if err != nil {
+		return "", err
 	}
+	return writeSpecFile(spec)
+}
 
-	if config.RemoveAfter && config.Interactive && config.TTY {
-		log.Printf("Removing debug pod...\n")
-		if err := config.deletePod(debugPodName); err != nil {
-			return WrapKubectlError(err, "delete debug pod")
-		}
+// writeSpecFile writes a partial container spec to a temporary file for
+// kubectl debug --custom and returns its path
+func writeSpecFile(spec map[string]interface{}) (string, error) {
+	customYAML, err := yaml.Marshal(spec)
+	if err != nil {
+		return "", NewDetailedError(ErrorTypeValidation, "failed to create custom debug configuration").WithOriginalError(err)
 	}
 
-	return nil
+	tmpfile, err := os.CreateTemp("", "debug-custom-*.yaml")
+	if err != nil {
+		return "", NewDetailedError(ErrorTypeValidation, "failed to create temporary file").WithOriginalError(err)
+	}
+
+	if _, err := tmpfile.Write(customYAML); err != nil {
+		_ = tmpfile.Close()
+		_ = os.Remove(tmpfile.Name())
+		return "", NewDetailedError(ErrorTypeValidation, "failed to write custom debug configuration").WithOriginalError(err)
+	}
+	if err := tmpfile.Close(); err != nil {
+		_ = os.Remove(tmpfile.Name())
+		return "", NewDetailedError(ErrorTypeValidation, "failed to close temporary file").WithOriginalError(err)
+	}
+
+	return tmpfile.Name(), nil
 }
@@ -0,0 +1,339 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOutputNameKeepsStdoutClean(t *testing.T) {
+	clusterPolicyOnce.Do(func() {})
+	origRunner, origStdout := defaultRunner, os.Stdout
+	defer func() {
+		defaultRunner, os.Stdout = origRunner, origStdout
+		clusterPolicy = nil
+		loadedConfig = nil
+	}()
+	clusterPolicy, loadedConfig = nil, &Config{}
+
+	tests := []struct {
+		name      string
+		operation DebugOperation
+		pod       string
+		prefix    string
+	}{
+		{"standalone", OperationStandalone, "", "debug-"},
+		{"ephemeral", OperationAddContainer, "web-6d5f8b7c9-x2k4p", "web-6d5f8b7c9-x2k4p"},
+		{"copy", OperationCopyPod, "web-6d5f8b7c9-x2k4p", "debug-web-6d5f8b7c9-x2k4p-"},
+	}
+	for _, tt := range tests {
+		runner := fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}}
+		defaultRunner = runner
+		config := &DebugConfig{
+			Namespace: "default", PodName: tt.pod, Operation: tt.operation, CopyPod: tt.operation == OperationCopyPod,
+			Image: "busybox", Profile: "general", Output: "name",
+			CPURequest: "100m", MemoryLimit: "128Mi", MemoryRequest: "128Mi",
+			Runner: runner,
+		}
+
+		read, write, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Stdout = write
+		result, err := config.Execute()
+		os.Stdout = origStdout
+		_ = write.Close()
+		stdout, _ := io.ReadAll(read)
+		_ = read.Close()
+
+		if err != nil {
+			t.Fatalf("%s: Execute() = %v", tt.name, err)
+		}
+		lines := strings.Split(string(stdout), "\n")
+		if len(lines) != 2 || lines[1] != "" || !strings.HasPrefix(lines[0], tt.prefix) || strings.ContainsAny(lines[0], " \t") {
+			t.Errorf("%s: stdout = %q, want only the pod name", tt.name, stdout)
+		}
+
+		// The result names the same pod and how to open a shell in it
+		if result.Pod != lines[0] || result.Namespace != "default" || result.Strategy != tt.operation || result.CleanedUp {
+			t.Errorf("%s: result = %+v, want pod %s", tt.name, result, lines[0])
+		}
+		if (result.Container != "") != (tt.operation != OperationStandalone) || !strings.Contains(result.AttachCommand, result.Pod) {
+			t.Errorf("%s: result = %+v, want the debug container", tt.name, result)
+		}
+		if tt.operation != OperationStandalone {
+			if err := config.kubectl(strings.Fields(result.AttachCommand)[1:]...).Run(); err != nil {
+				t.Errorf("%s: %s = %v", tt.name, result.AttachCommand, err)
+			}
+		}
+	}
+
+	// --rm shows in the result
+	config := &DebugConfig{
+		Namespace: "default", Operation: OperationStandalone, Image: "busybox", Profile: "general",
+		Command: "true", RemoveAfter: true, CPURequest: "100m", MemoryLimit: "128Mi", MemoryRequest: "128Mi",
+		Runner: fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}},
+	}
+	if result, err := config.Execute(); err != nil || !result.CleanedUp || result.Pod == "" {
+		t.Errorf("Execute(--rm) = %+v, %v, want the pod cleaned up", result, err)
+	}
+}
+
+func TestRecordDebugPodFlags(t *testing.T) {
+	config := &DebugConfig{KubectlFlags: []string{"--context=staging"}, result: &DebugResult{}}
+	config.recordDebugPod("debug-abc", "debugger", "attach", "debug-abc", "-n", "default", "-it")
+	if want := "kubectl attach debug-abc -n default -it --context=staging"; config.result.AttachCommand != want {
+		t.Errorf("AttachCommand = %q, want %q", config.result.AttachCommand, want)
+	}
+}
+
+func TestSessionArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		config DebugConfig
+		want   []string
+	}{
+		{"interactive shell", DebugConfig{Interactive: true, TTY: true}, []string{"-i", "-t", "--"}},
+		{"detached", DebugConfig{}, nil},
+		{"piped stdin", DebugConfig{Interactive: true, Command: "psql"}, []string{"-i", "--attach=true", "--quiet", "--", "sh", "-c", "psql"}},
+		{"command only", DebugConfig{Command: "ls"}, []string{"--attach=true", "--quiet", "--", "sh", "-c", "ls"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.sessionArgs(); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("sessionArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	config := DebugConfig{Namespace: "db", Interactive: true, Command: "psql -f -"}
+	want := "exec -i debug-db-0 -n db -- sh -c psql -f -"
+	if got := strings.Join(config.commandExecArgs("debug-db-0"), " "); got != want {
+		t.Errorf("commandExecArgs() = %q, want %q", got, want)
+	}
+}
+
+func TestMergedCustomSpec(t *testing.T) {
+	path := t.TempDir() + "/custom.yaml"
+	custom := `env:
+- name: DEBUG
+  value: "1"
+resources:
+  limits:
+    memory: 512Mi
+securityContext:
+  runAsUser: 1000
+`
+	if err := os.WriteFile(path, []byte(custom), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &DebugConfig{CPURequest: "100m", MemoryLimit: "128Mi", MemoryRequest: "128Mi", CustomSpec: path}
+	spec, err := config.mergedCustomSpec()
+	if err != nil {
+		t.Fatalf("mergedCustomSpec() error = %v", err)
+	}
+
+	resources := spec["resources"].(map[string]interface{})
+	if limits := resources["limits"].(map[string]interface{}); limits["memory"] != "512Mi" {
+		t.Errorf("limits.memory = %v, want the user's 512Mi", limits["memory"])
+	}
+	if requests := resources["requests"].(map[string]interface{}); requests["cpu"] != "100m" {
+		t.Errorf("requests.cpu = %v, want the default 100m to be kept", requests["cpu"])
+	}
+	if _, ok := spec["env"]; !ok {
+		t.Error("env from the custom file is missing")
+	}
+
+	// Ephemeral containers cannot have resources, the default ones included
+	spec, err = config.mergedEphemeralSpec()
+	if err != nil {
+		t.Fatalf("mergedEphemeralSpec() error = %v", err)
+	}
+	if _, ok := spec["resources"]; ok {
+		t.Errorf("ephemeral spec has resources: %v", spec["resources"])
+	}
+	if _, ok := spec["env"]; !ok {
+		t.Error("env from the custom file is missing from the ephemeral spec")
+	}
+
+	config.CustomSpec = t.TempDir() + "/missing.yaml"
+	if _, err := config.mergedCustomSpec(); err == nil {
+		t.Error("mergedCustomSpec() with a missing file should fail")
+	}
+
+	// The DNS settings of a copy are the target's; kubectl debug would drop
+	// them from the container spec
+	if err := os.WriteFile(path, []byte("dnsPolicy: Default\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config.CustomSpec = path
+	var detailed *DetailedError
+	if _, err := config.mergedCustomSpec(); !errors.As(err, &detailed) || detailed.Type != ErrorTypeValidation || !strings.Contains(detailed.Message, "dnsPolicy") {
+		t.Errorf("mergedCustomSpec() with dnsPolicy = %v, want a validation error", err)
+	}
+}
+
+func TestNewDebugConfigFromFlagsWorkload(t *testing.T) {
+	oldPodName := podName
+	defer func() { podName = oldPodName }()
+
+	podName = "cronjob/nightly"
+	config := NewDebugConfigFromFlags()
+	if config.Operation != OperationReplayJob || config.Workload != WorkloadCronJob || config.PodName != "nightly" {
+		t.Errorf("NewDebugConfigFromFlags() = operation %v, workload %q, pod %q", config.Operation, config.Workload, config.PodName)
+	}
+}
+
+func TestNewDebugConfigFromFlagsTargetPod(t *testing.T) {
+	oldPodName, oldCopyPod := podName, copyPod
+	defer func() { podName, copyPod = oldPodName, oldCopyPod }()
+
+	tests := []struct {
+		copy bool
+		want DebugOperation
+	}{
+		{false, OperationAddContainer},
+		{true, OperationCopyPod},
+	}
+	for _, tt := range tests {
+		podName, copyPod = "web-6d5f8b7c9-x2k4p", tt.copy
+		config := NewDebugConfigFromFlags()
+		if config.Operation != tt.want || config.PodName != "web-6d5f8b7c9-x2k4p" {
+			t.Errorf("copy %v: NewDebugConfigFromFlags() = operation %v, pod %q, want operation %v", tt.copy, config.Operation, config.PodName, tt.want)
+		}
+	}
+
+	// Both operations keep the target's DNS settings, so no flag chooses them
+	if rootCmd.PersistentFlags().Lookup("no-copy-dns") != nil {
+		t.Error("--no-copy-dns should not be registered")
+	}
+}
+
+// interruptingRunner cancels the operation like Ctrl-C once a call of
+// operation starts, after running it against the fake cluster
+type interruptingRunner struct {
+	fakeClusterRunner
+	operation string
+	cancel    context.CancelFunc
+	deletes   *int
+}
+
+func (r interruptingRunner) interrupts(args []string) bool {
+	if args[0] == "delete" {
+		*r.deletes++
+	}
+	return strings.Contains(strings.Join(args, " "), r.operation)
+}
+
+func (r interruptingRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	if r.interrupts(args) {
+		r.cancel()
+		return nil, ctx.Err()
+	}
+	return r.fakeClusterRunner.Output(ctx, name, args...)
+}
+
+func (r interruptingRunner) Stream(ctx context.Context, streams IOStreams, name string, args ...string) error {
+	err := r.fakeClusterRunner.Stream(ctx, streams, name, args...)
+	if r.interrupts(args) {
+		r.cancel()
+		return &ExitCodeError{Code: 143}
+	}
+	return err
+}
+
+func TestInterruptCleansUpOnce(t *testing.T) {
+	tests := []struct {
+		name      string
+		operation DebugOperation
+		interrupt string
+	}{
+		{name: "waiting for the pod", operation: OperationStandalone, interrupt: "jsonpath={.status.phase}"},
+		{name: "during the copy's session", operation: OperationCopyPod, interrupt: "--copy-to="},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		deletes := 0
+		config := &DebugConfig{
+			Context: ctx, Namespace: "default", Operation: tt.operation, PodName: "web-6d5f8b7c9-x2k4p",
+			Image: "busybox", Profile: "general", Command: "true", RemoveAfter: true,
+			CPURequest: "100m", MemoryLimit: "128Mi", MemoryRequest: "128Mi",
+			Runner: interruptingRunner{
+				fakeClusterRunner: fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}},
+				operation:         tt.interrupt, cancel: cancel, deletes: &deletes,
+			},
+		}
+		if tt.operation == OperationStandalone {
+			config.PodName = ""
+		}
+
+		result, err := config.Execute()
+		cancel()
+		if err == nil || !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: Execute() = %v, want it interrupted", tt.name, err)
+		}
+		if deletes != 1 || !result.CleanedUp {
+			t.Errorf("%s: %d deletions with result %+v, want the pod deleted once", tt.name, deletes, result)
+		}
+		config.Context = context.Background()
+		if pods, err := config.ListDebugPods(false); err != nil || len(pods) != 0 {
+			t.Errorf("%s: debug pods = %v, %v, want none left", tt.name, pods, err)
+		}
+	}
+}
+
+// failingCopyRunner fails kubectl debug --copy-to like an admission webhook
+// rejecting the copy
+type failingCopyRunner struct {
+	fakeClusterRunner
+}
+
+func (r failingCopyRunner) Stream(ctx context.Context, streams IOStreams, name string, args ...string) error {
+	if args[0] == "debug" && strings.Contains(strings.Join(args, " "), "--copy-to=") {
+		fmt.Fprintln(streams.ErrOut, `Error from server (Forbidden): pods "debug-web" is forbidden: violates PodSecurity "restricted:latest"`)
+		return &ExitCodeError{Code: 1}
+	}
+	return r.fakeClusterRunner.Stream(ctx, streams, name, args...)
+}
+
+func TestFailedCopy(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		exitCode bool
+	}{
+		{name: "created in the background", exitCode: false},
+		{name: "--command", command: "hostname", exitCode: true},
+	}
+	for _, tt := range tests {
+		var stdout bytes.Buffer
+		config := &DebugConfig{
+			Namespace: "default", Operation: OperationCopyPod, PodName: "web-6d5f8b7c9-x2k4p", CopyPod: true,
+			Image: "busybox", Profile: "general", Command: tt.command, Output: "name",
+			CPURequest: "100m", MemoryLimit: "128Mi", MemoryRequest: "128Mi",
+			Stdout: &stdout, Stderr: io.Discard,
+			Runner: failingCopyRunner{fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}}},
+		}
+
+		_, err := config.Execute()
+		var exitErr *ExitCodeError
+		var detailed *DetailedError
+		switch {
+		case tt.exitCode && !errors.As(err, &exitErr):
+			t.Errorf("%s: Execute() = %v, want the remote command's exit code", tt.name, err)
+		case !tt.exitCode && !errors.As(err, &detailed):
+			t.Errorf("%s: Execute() = %#v, want a *DetailedError", tt.name, err)
+		}
+		if stdout.Len() != 0 {
+			t.Errorf("%s: stdout = %q, want no pod name for a copy that was not created", tt.name, stdout.String())
+		}
+	}
+}
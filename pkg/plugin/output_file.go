@@ -0,0 +1,79 @@
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// outputFilePath returns the file the remote output of name is saved to
+// with --output-file: <prefix>-<name>-<timestamp>.log
+func outputFilePath(prefix, name string, at time.Time) string {
+	return fmt.Sprintf("%s-%s-%s.log", prefix, name, at.Format("20060102-150405"))
+}
+
+// createOutputFile creates the --output-file of name, and its directory
+func createOutputFile(prefix, name string, at time.Time) (*os.File, error) {
+	path := outputFilePath(prefix, name, at)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating output directory: %v", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating output file: %v", err)
+	}
+	return file, nil
+}
+
+// sessionOutput opens the --output-file of a --command session in pod and
+// returns the writer teeing the session's stdout into it, with a function
+// closing the file; without --output-file it returns the plain stdout
+func (config *DebugConfig) sessionOutput(pod string) (io.Writer, func()) {
+	if config.OutputFile == "" || config.Command == "" {
+		return config.stdout(), func() {}
+	}
+	file, err := createOutputFile(config.OutputFile, pod, clock())
+	if err != nil {
+		config.logf("Warning: Not saving the output of %s: %v", pod, err)
+		return config.stdout(), func() {}
+	}
+	return io.MultiWriter(config.stdout(), file), func() {
+		if err := file.Close(); err != nil {
+			config.logf("Warning: Could not save the output of %s: %v", pod, err)
+			return
+		}
+		config.logf("Saved the output of %s to %s", pod, file.Name())
+	}
+}
+
+// saveResults writes the output of every result to its own --output-file,
+// all with the same timestamp; results without output because the pod
+// could not be debugged are skipped
+func saveResults(prefix string, results []eachResult) {
+	if prefix == "" {
+		return
+	}
+	at := clock()
+	saved := 0
+	for _, result := range results {
+		if result.Err != nil {
+			continue
+		}
+		file, err := createOutputFile(prefix, result.Pod, at)
+		if err == nil {
+			_, err = io.WriteString(file, result.Output)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			log.Printf("Warning: Could not save the output of %s: %v", result.Pod, err)
+			continue
+		}
+		saved++
+	}
+	log.Printf("Saved %d of %d outputs to %s", saved, len(results), outputFilePath(prefix, "*", at))
+}
@@ -0,0 +1,56 @@
+package plugin
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOutputFile(t *testing.T) {
+	defer func(c func() time.Time) { clock = c }(clock)
+	clock = func() time.Time { return deterministicEpoch }
+	prefix := filepath.Join(t.TempDir(), "incident", "run")
+
+	saveResults(prefix, []eachResult{
+		{Pod: "web-1", Output: "LISTEN 0 128 *:8080\n"},
+		{Pod: "web-2", Output: "", ExitCode: 1},
+		{Pod: "web-3", ExitCode: -1, Err: errors.New("forbidden")},
+	})
+	for pod, want := range map[string]string{"web-1": "LISTEN 0 128 *:8080\n", "web-2": ""} {
+		got, err := os.ReadFile(prefix + "-" + pod + "-20250101-120000.log")
+		if err != nil || string(got) != want {
+			t.Errorf("output of %s = %q, %v, want %q", pod, got, err, want)
+		}
+	}
+	if _, err := os.Stat(prefix + "-web-3-20250101-120000.log"); !os.IsNotExist(err) {
+		t.Errorf("output of failed pod saved: %v", err)
+	}
+
+	// A --command session tees its stdout into the file of its pod
+	config := &DebugConfig{Namespace: "team-a", Command: "hostname", OutputFile: prefix, Runner: &fakeRunner{outputs: map[string]string{
+		"kubectl exec web-4 -n team-a -- sh -c hostname": "web-4\n",
+	}}}
+	stdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	err := config.runPodSession("web-4", config.commandExecArgs("web-4")...)
+	os.Stdout = stdout
+	_ = w.Close()
+	printed, _ := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("runPodSession() = %v", err)
+	}
+	saved, err := os.ReadFile(prefix + "-web-4-20250101-120000.log")
+	if err != nil || string(saved) != "web-4\n" || string(printed) != "web-4\n" {
+		t.Errorf("saved %q (%v), printed %q, want web-4", saved, err, printed)
+	}
+
+	// Without --output-file the session output is not saved
+	config.OutputFile = ""
+	if out, _ := config.sessionOutput("web-4"); out != config.stdout() {
+		t.Error("sessionOutput() tees without --output-file")
+	}
+}
@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+// targetOwnerReference makes the target pod the owner of a debug pod, so the
+// garbage collector deletes the debug pod together with its target. It is
+// neither a controller nor blocking, so it never delays deleting the target.
+func targetOwnerReference(target *corev1.Pod) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion:         "v1",
+		Kind:               "Pod",
+		Name:               target.Name,
+		UID:                target.UID,
+		Controller:         ptr.To(false),
+		BlockOwnerDeletion: ptr.To(false),
+	}
+}
+
+// ownerReferencePatch returns the merge patch setting ref as the only owner
+func ownerReferencePatch(ref metav1.OwnerReference) (string, error) {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"ownerReferences": []metav1.OwnerReference{ref},
+		},
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return "", fmt.Errorf("error generating owner reference patch: %v", err)
+	}
+	return string(data), nil
+}
+
+// adoptByTarget waits for debugPodName to exist and sets the target pod as its
+// owner. kubectl debug --copy-to cannot set owner references itself and blocks
+// while attached, so this runs alongside the session; failures only warn.
+func (config *DebugConfig) adoptByTarget(debugPodName string) {
+	target, err := config.getTargetPod()
+	if err != nil {
+		config.logf("Warning: Could not set owner of %s: %v", debugPodName, err)
+		return
+	}
+	patch, err := ownerReferencePatch(targetOwnerReference(target))
+	if err != nil {
+		config.logf("Warning: Could not set owner of %s: %v", debugPodName, err)
+		return
+	}
+
+	for i := 0; i < maxAttempts; i++ {
+		if config.kubectl("get", "pod", debugPodName, "-n", config.Namespace, "-o", "name").Run() == nil {
+			if output, err := config.kubectl("patch", "pod", debugPodName, "-n", config.Namespace,
+				"--type=merge", "-p", patch).CombinedOutput(); err != nil {
+				config.logf("Warning: Could not set owner of %s: %v - %s", debugPodName, err, output)
+			}
+			return
+		}
+		select {
+		case <-config.context().Done():
+			return
+		case <-time.After(sleepDuration):
+		}
+	}
+	config.logf("Warning: Could not set owner of %s: pod was not created within %d seconds", debugPodName, maxAttempts)
+}
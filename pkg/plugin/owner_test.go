@@ -0,0 +1,22 @@
+package plugin
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestOwnerReferencePatch(t *testing.T) {
+	target := &corev1.Pod{}
+	target.Name = "web-0"
+	target.UID = "1234-abcd"
+
+	patch, err := ownerReferencePatch(targetOwnerReference(target))
+	if err != nil {
+		t.Fatalf("ownerReferencePatch() error = %v", err)
+	}
+	want := `{"metadata":{"ownerReferences":[{"apiVersion":"v1","kind":"Pod","name":"web-0","uid":"1234-abcd","controller":false,"blockOwnerDeletion":false}]}}`
+	if patch != want {
+		t.Errorf("ownerReferencePatch() = %s, want %s", patch, want)
+	}
+}
@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultPager is used when $PAGER is not set; -F quits right away when the
+// output fits after all, -R keeps colors and -X leaves it on the screen
+const defaultPager = "less -FRX"
+
+// writePaged writes output to stdout, through $PAGER when stdout is a
+// terminal the output does not fit on and paging is not disabled
+func writePaged(ctx context.Context, output []byte, disabled bool) error {
+	if disabled || !isTerminal(os.Stdout) {
+		_, err := os.Stdout.Write(output)
+		return err
+	}
+	height := terminalHeight(ctx)
+	if height == 0 || bytes.Count(output, []byte("\n")) < height {
+		_, err := os.Stdout.Write(output)
+		return err
+	}
+
+	pager := strings.TrimSpace(os.Getenv("PAGER"))
+	if pager == "" {
+		pager = defaultPager
+	}
+	// Ctrl-C belongs to the pager, e.g. to abort a search
+	cmd := newRunnerCommand(context.WithoutCancel(ctx), defaultRunner, "sh", "-c", pager)
+	cmd.Stdin = bytes.NewReader(output)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		// 127: the pager is not installed
+		if code, exited := exitCode(err); !exited || code == 127 {
+			_, err := os.Stdout.Write(output)
+			return err
+		}
+	}
+	return nil
+}
+
+// isTerminal reports whether f is a character device such as a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// terminalHeight returns the number of rows of the controlling terminal
+// from $LINES or stty, or 0 when it is unknown
+func terminalHeight(ctx context.Context) int {
+	if lines, err := strconv.Atoi(os.Getenv("LINES")); err == nil && lines > 0 {
+		return lines
+	}
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return 0
+	}
+	defer func() {
+		_ = tty.Close()
+	}()
+
+	cmd := newRunnerCommand(ctx, defaultRunner, "stty", "size")
+	cmd.Stdin = tty
+	var size bytes.Buffer
+	cmd.Stdout = &size
+	cmd.Stderr = io.Discard
+	if err := cmd.Run(); err != nil {
+		return 0
+	}
+	// stty size prints "<rows> <columns>"
+	fields := strings.Fields(size.String())
+	if len(fields) != 2 {
+		return 0
+	}
+	rows, _ := strconv.Atoi(fields[0])
+	return rows
+}
@@ -0,0 +1,358 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var (
+	permsDepth    int
+	permsMaxFiles int
+)
+
+var permsCmd = &cobra.Command{
+	Use:   "perms",
+	Short: "Audit volume permissions against the user the target runs as",
+	Long: `Add an ephemeral debug container to the target pod, walk every volume mounted
+in the target container and compare the owner, group and mode of its files
+with the credentials of the target's main process: its uid, gid and
+supplementary groups (which include the fsGroup) and whether it may bypass
+file permissions.
+
+For each mount the report shows whether the process can read and write the
+volume root, flags a root it cannot write on read-write volumes, explains a
+fsGroup that was not applied (volume types like hostPath and many NFS and
+CSI drivers ignore it) and lists the files the process cannot read.`,
+	Example: `  kpdbug perms -p mypod
+  kpdbug perms -p db-0 --container postgres --depth 3`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runPerms(cmd)
+	},
+}
+
+func init() {
+	permsCmd.Flags().IntVar(&permsDepth, "depth", 2, "directory levels to walk below each mount")
+	permsCmd.Flags().IntVar(&permsMaxFiles, "max-files", 500, "maximum number of files checked per mount")
+	rootCmd.AddCommand(permsCmd)
+}
+
+// permsScript prints ROOT|<root> and PROC|<status line> for the credentials
+// of the target's main process, then MOUNT|<path>|<ro or rw> and
+// ENTRY|<uid>|<gid>|<mode>|<type>|<path> for the files of every mount
+func permsScript(mountPaths []string, depth, maxFiles int) string {
+	var b strings.Builder
+	b.WriteString(targetPIDScript)
+	b.WriteString(`echo "ROOT|$root"
+grep -E '^(Uid|Gid|Groups|CapEff):' /proc/$pid/status | while read -r line; do echo "PROC|$line"; done
+`)
+	for _, mountPath := range mountPaths {
+		fmt.Fprintf(&b, `mp=%[1]s
+echo "MOUNT|$mp|$(awk -v mp="$mp" '$2 == mp {print ($4 ~ /(^|,)ro(,|$)/) ? "ro" : "rw"}' /proc/$pid/mounts | tail -n 1)"
+find "$root$mp" -xdev -maxdepth %[2]d -exec stat -c 'ENTRY|%%u|%%g|%%a|%%F|%%n' {} + 2>/dev/null | head -n %[3]d
+`, shellQuote(mountPath), max(depth, 0), max(maxFiles, 1))
+	}
+	return b.String()
+}
+
+// procCredentials are the credentials file permissions are checked against
+type procCredentials struct {
+	UID    uint64
+	GID    uint64
+	Groups []uint64
+	// DACOverride is CAP_DAC_OVERRIDE, which bypasses read and write checks
+	DACOverride bool
+}
+
+func (c procCredentials) inGroup(gid uint64) bool {
+	if gid == c.GID {
+		return true
+	}
+	for _, group := range c.Groups {
+		if group == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// permEntry is a file or directory of a volume
+type permEntry struct {
+	UID  uint64
+	GID  uint64
+	Mode uint64
+	Type string
+	Path string
+}
+
+func (e permEntry) isDir() bool {
+	return e.Type == "directory"
+}
+
+// access returns whether the credentials can read and write the entry; a
+// directory is readable when it can be listed and traversed, and writable
+// when entries can be created in it
+func (c procCredentials) access(e permEntry) (read, write bool) {
+	if c.DACOverride {
+		return true, true
+	}
+	bits := e.Mode & 0o7
+	switch {
+	case c.UID == e.UID:
+		bits = (e.Mode >> 6) & 0o7
+	case c.inGroup(e.GID):
+		bits = (e.Mode >> 3) & 0o7
+	}
+	read, write = bits&0o4 != 0, bits&0o2 != 0
+	if e.isDir() {
+		traverse := bits&0o1 != 0
+		read, write = read && traverse, write && traverse
+	}
+	return read, write
+}
+
+// mountPerms is the audit of one mounted volume
+type mountPerms struct {
+	MountPath  string
+	ReadOnly   bool
+	Root       *permEntry
+	Entries    []permEntry
+	Unreadable []string
+}
+
+// parsePermsOutput parses the output of permsScript, with paths made
+// relative to the target's root
+func parsePermsOutput(output string) (procCredentials, []mountPerms, error) {
+	var creds procCredentials
+	var mounts []mountPerms
+	root := ""
+	seenUID := false
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), "|", 6)
+		switch {
+		case fields[0] == "ROOT" && len(fields) == 2:
+			root = fields[1]
+		case fields[0] == "PROC" && len(fields) == 2:
+			values := strings.Fields(fields[1])
+			if len(values) < 1 {
+				continue
+			}
+			ids := make([]uint64, 0, len(values)-1)
+			for _, value := range values[1:] {
+				if id, err := strconv.ParseUint(value, 10, 64); err == nil {
+					ids = append(ids, id)
+				}
+			}
+			switch values[0] {
+			case "Uid:":
+				// The effective uid is the second value
+				if len(ids) > 1 {
+					creds.UID, seenUID = ids[1], true
+				}
+			case "Gid:":
+				if len(ids) > 1 {
+					creds.GID = ids[1]
+				}
+			case "Groups:":
+				creds.Groups = ids
+			case "CapEff:":
+				if len(values) > 1 {
+					if caps, err := strconv.ParseUint(values[1], 16, 64); err == nil {
+						creds.DACOverride = caps&(1<<1) != 0
+					}
+				}
+			}
+		case fields[0] == "MOUNT" && len(fields) == 3:
+			mounts = append(mounts, mountPerms{MountPath: fields[1], ReadOnly: fields[2] == "ro"})
+		case fields[0] == "ENTRY" && len(fields) == 6 && len(mounts) > 0:
+			uid, _ := strconv.ParseUint(fields[1], 10, 64)
+			gid, _ := strconv.ParseUint(fields[2], 10, 64)
+			mode, _ := strconv.ParseUint(fields[3], 8, 64)
+			entry := permEntry{UID: uid, GID: gid, Mode: mode, Type: fields[4], Path: targetPath(fields[5], root)}
+			mount := &mounts[len(mounts)-1]
+			if entry.Path == mount.MountPath && mount.Root == nil {
+				mount.Root = &entry
+				continue
+			}
+			mount.Entries = append(mount.Entries, entry)
+		}
+	}
+	if !seenUID {
+		return creds, nil, fmt.Errorf("could not read the credentials of the target process")
+	}
+
+	for i := range mounts {
+		for _, entry := range mounts[i].Entries {
+			if entry.Type == "symbolic link" {
+				continue
+			}
+			if read, _ := creds.access(entry); !read {
+				mounts[i].Unreadable = append(mounts[i].Unreadable, entry.Path)
+			}
+		}
+	}
+	return creds, mounts, nil
+}
+
+// podFSGroups returns the fsGroup and supplemental groups of the pod
+func podFSGroups(pod *corev1.Pod) (*int64, []int64) {
+	if pod.Spec.SecurityContext == nil {
+		return nil, nil
+	}
+	return pod.Spec.SecurityContext.FSGroup, pod.Spec.SecurityContext.SupplementalGroups
+}
+
+// kubeletManagedMounts returns the mount paths of the container's volumes the
+// kubelet writes itself and the process is not meant to write
+func kubeletManagedMounts(pod *corev1.Pod, containerName string) map[string]bool {
+	managed := map[string]bool{}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.ConfigMap == nil && volume.Secret == nil && volume.Projected == nil && volume.DownwardAPI == nil {
+			continue
+		}
+		for _, container := range pod.Spec.Containers {
+			if container.Name != containerName {
+				continue
+			}
+			for _, mount := range container.VolumeMounts {
+				if mount.Name == volume.Name {
+					managed[strings.TrimSuffix(mount.MountPath, "/")] = true
+				}
+			}
+		}
+	}
+	return managed
+}
+
+// permissionIssue explains why the process cannot use a mount, or returns ""
+func permissionIssue(mount mountPerms, creds procCredentials, managed bool, fsGroup *int64) string {
+	if mount.Root == nil {
+		return "mount not found in the target"
+	}
+	read, write := creds.access(*mount.Root)
+	owner := fmt.Sprintf("owned by %d:%d mode %04o", mount.Root.UID, mount.Root.GID, mount.Root.Mode)
+	switch {
+	case !read:
+		return fmt.Sprintf("uid %d cannot read the volume root (%s)", creds.UID, owner)
+	case !write && !mount.ReadOnly && !managed:
+		issue := fmt.Sprintf("uid %d cannot write the volume root (%s)", creds.UID, owner)
+		if fsGroup != nil && uint64(*fsGroup) != mount.Root.GID {
+			return issue + fmt.Sprintf("; fsGroup %d was not applied, the volume type may not support fsGroup", *fsGroup)
+		}
+		if fsGroup == nil {
+			return issue + "; set securityContext.fsGroup or chown the volume to the process"
+		}
+		return issue + "; the group has no write permission"
+	}
+	return ""
+}
+
+// accessString renders read and write access like ls
+func accessString(read, write bool) string {
+	access := []byte("--")
+	if read {
+		access[0] = 'r'
+	}
+	if write {
+		access[1] = 'w'
+	}
+	return string(access)
+}
+
+func runPerms(cmd *cobra.Command) error {
+	config, err := newTargetConfig(cmd.Context(), cmd, "", "general")
+	if err != nil {
+		return err
+	}
+	pod, err := config.getPod(config.PodName, config.Namespace)
+	if err != nil {
+		return WrapKubectlError(err, "get pod")
+	}
+	container, err := config.getTargetContainerName()
+	if err != nil {
+		return WrapKubectlError(err, "get target container name")
+	}
+	volumes := volumesByMountPath(pod, container)
+	managed := kubeletManagedMounts(pod, container)
+	if len(volumes) == 0 {
+		return NewValidationError("container", container, "has no volume mounts")
+	}
+	mountPaths := make([]string, 0, len(volumes))
+	for mountPath := range volumes {
+		mountPaths = append(mountPaths, mountPath)
+	}
+	sort.Strings(mountPaths)
+
+	log.Printf("Auditing %d volumes of %s/%s...", len(mountPaths), config.PodName, container)
+	result, err := config.runEphemeralScript(config.PodName, permsScript(mountPaths, permsDepth, permsMaxFiles))
+	if err != nil {
+		return err
+	}
+	creds, mounts, err := parsePermsOutput(result.Output)
+	if err != nil {
+		return err
+	}
+
+	fsGroup, supplemental := podFSGroups(pod)
+	fmt.Printf("Process: uid=%d gid=%d groups=%v", creds.UID, creds.GID, creds.Groups)
+	if creds.DACOverride {
+		fmt.Print(" (CAP_DAC_OVERRIDE: permissions are bypassed)")
+	}
+	fmt.Println()
+	if fsGroup != nil {
+		fmt.Printf("Pod: fsGroup=%d supplementalGroups=%v\n", *fsGroup, supplemental)
+	} else {
+		fmt.Printf("Pod: no fsGroup, supplementalGroups=%v\n", supplemental)
+	}
+	fmt.Println()
+
+	issues := 0
+	fmt.Printf("%-35s %-25s %-3s %-12s %-5s %-6s %s\n", "MOUNT", "VOLUME", "RO", "OWNER", "MODE", "ACCESS", "ISSUE")
+	for _, mount := range mounts {
+		volume := volumes[mount.MountPath]
+		owner, mode, access := "-", "-", "--"
+		if mount.Root != nil {
+			owner = fmt.Sprintf("%d:%d", mount.Root.UID, mount.Root.GID)
+			mode = fmt.Sprintf("%04o", mount.Root.Mode)
+			read, write := creds.access(*mount.Root)
+			access = accessString(read, write && !mount.ReadOnly)
+		}
+		issue := permissionIssue(mount, creds, managed[mount.MountPath], fsGroup)
+		if len(mount.Unreadable) > 0 {
+			issue = strings.TrimPrefix(issue+fmt.Sprintf("; %d files are not readable", len(mount.Unreadable)), "; ")
+		}
+		if issue != "" {
+			issues++
+		}
+		ro := "no"
+		if mount.ReadOnly {
+			ro = "yes"
+		}
+		fmt.Printf("%-35s %-25s %-3s %-12s %-5s %-6s %s\n", truncateString(mount.MountPath, 35), truncateString(volume, 25),
+			ro, owner, mode, access, issue)
+	}
+
+	for _, mount := range mounts {
+		if len(mount.Unreadable) == 0 {
+			continue
+		}
+		fmt.Printf("\nNot readable by uid %d in %s:\n", creds.UID, mount.MountPath)
+		for i, path := range mount.Unreadable {
+			if i == 10 {
+				fmt.Printf("  ... and %d more\n", len(mount.Unreadable)-10)
+				break
+			}
+			fmt.Printf("  %s\n", path)
+		}
+	}
+	if issues > 0 {
+		return &ExitCodeError{Code: 1}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package plugin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPermsAudit(t *testing.T) {
+	output := strings.Join([]string{
+		"ROOT|/proc/7/root",
+		"PROC|Uid:\t1000\t1000\t1000\t1000",
+		"PROC|Gid:\t1000\t1000\t1000\t1000",
+		"PROC|Groups:\t2000",
+		"PROC|CapEff:\t0000000000000000",
+		"MOUNT|/data|rw",
+		"ENTRY|0|0|755|directory|/proc/7/root/data",
+		"ENTRY|0|0|600|regular file|/proc/7/root/data/secret.key",
+		"ENTRY|0|2000|640|regular file|/proc/7/root/data/app.db",
+		"MOUNT|/cache|rw",
+		"ENTRY|0|2000|2775|directory|/proc/7/root/cache",
+	}, "\n")
+	creds, mounts, err := parsePermsOutput(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.UID != 1000 || !creds.inGroup(2000) || creds.DACOverride {
+		t.Errorf("credentials = %+v", creds)
+	}
+	if len(mounts) != 2 || mounts[0].Root == nil || !reflect.DeepEqual(mounts[0].Unreadable, []string{"/data/secret.key"}) {
+		t.Fatalf("mounts = %+v", mounts)
+	}
+
+	fsGroup := int64(2000)
+	if issue := permissionIssue(mounts[0], creds, false, &fsGroup); !strings.Contains(issue, "fsGroup 2000 was not applied") {
+		t.Errorf("permissionIssue(/data) = %q", issue)
+	}
+	if issue := permissionIssue(mounts[0], creds, true, &fsGroup); issue != "" {
+		t.Errorf("permissionIssue() of a kubelet managed volume = %q", issue)
+	}
+	if issue := permissionIssue(mounts[1], creds, false, &fsGroup); issue != "" {
+		t.Errorf("permissionIssue(/cache) = %q", issue)
+	}
+}
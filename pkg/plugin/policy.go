@@ -0,0 +1,278 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// The ConfigMap cluster admins publish the debug policy in
+const (
+	policyNamespace = "kube-system"
+	policyConfigMap = "kpdbug-policy"
+	policyDataKey   = "policy.yaml"
+)
+
+// Policy enforcement modes
+const (
+	enforceRefuse    = "refuse"
+	enforceDowngrade = "downgrade"
+)
+
+// ClusterPolicy limits the debug images and profiles of every user of the
+// cluster; it is read from the policy.yaml key of kube-system/kpdbug-policy
+type ClusterPolicy struct {
+	// AllowedImages are glob patterns of fully qualified image references,
+	// e.g. registry.internal/tools/* or docker.io/nicolaka/netshoot:*
+	AllowedImages []string `json:"allowedImages,omitempty"`
+	// MaxProfile is the most privileged profile allowed
+	MaxProfile string `json:"maxProfile,omitempty"`
+	// Enforcement is "refuse" (the default) to reject a session above the
+	// maximum profile, or "downgrade" to run it with the maximum profile
+	Enforcement string `json:"enforcement,omitempty"`
+	// Namespaces overrides the images and maximum profile per namespace;
+	// keys are names or glob patterns such as prod-*
+	Namespaces map[string]NamespacePolicy `json:"namespaces,omitempty"`
+	// NamespaceLabels limits profiles to namespaces carrying a label, as
+	// key=value or just key, e.g. privileged: debug-tool/allow-privileged=true
+	NamespaceLabels map[string]string `json:"namespaceLabels,omitempty"`
+	// MaxTTL, e.g. 8h, caps the lifetime of debug pods; debug DaemonSets,
+	// which cannot be given one, are refused
+	MaxTTL string `json:"maxTTL,omitempty"`
+	// Contact is who to ask for access, shown when the policy refuses a
+	// session
+	Contact string `json:"contact,omitempty"`
+}
+
+// NamespacePolicy overrides the cluster-wide policy in matching namespaces
+type NamespacePolicy struct {
+	AllowedImages []string `json:"allowedImages,omitempty"`
+	MaxProfile    string   `json:"maxProfile,omitempty"`
+}
+
+// profileRanks orders the profiles from least to most privileged; sysadmin
+// runs a privileged container like the privileged profile
+var profileRanks = map[string]int{
+	"restricted": 0,
+	"baseline":   1,
+	"general":    2,
+	"netadmin":   3,
+	ebpfProfile:  4,
+	"sysadmin":   5,
+	"privileged": 5,
+}
+
+func profileRank(profile string) int {
+	if profile == "" {
+		profile = "general"
+	}
+	return profileRanks[profile]
+}
+
+var (
+	clusterPolicyOnce sync.Once
+	clusterPolicy     *ClusterPolicy
+)
+
+// currentPolicy returns the cluster policy, reading it on first use; a
+// missing or unreadable ConfigMap means no policy
+func (config *DebugConfig) currentPolicy() *ClusterPolicy {
+	clusterPolicyOnce.Do(func() {
+		output, err := config.kubectl("get", "configmap", policyConfigMap, "-n", policyNamespace, "-o", "json").Output()
+		if err != nil {
+			return
+		}
+		var configMap corev1.ConfigMap
+		if err := json.Unmarshal(output, &configMap); err != nil {
+			return
+		}
+		policy, err := parseClusterPolicy(configMap.Data[policyDataKey])
+		if err != nil {
+			config.logf("Warning: ignoring the debug policy in %s/%s: %v", policyNamespace, policyConfigMap, err)
+			return
+		}
+		clusterPolicy = policy
+	})
+	return clusterPolicy
+}
+
+// parseClusterPolicy parses and validates the policy document
+func parseClusterPolicy(data string) (*ClusterPolicy, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+	var policy ClusterPolicy
+	if err := yaml.UnmarshalStrict([]byte(data), &policy); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", policyDataKey, err)
+	}
+	switch policy.Enforcement {
+	case "", enforceRefuse, enforceDowngrade:
+	default:
+		return nil, fmt.Errorf("enforcement must be %s or %s, not %q", enforceRefuse, enforceDowngrade, policy.Enforcement)
+	}
+	maxProfiles := []string{policy.MaxProfile}
+	for _, ns := range policy.Namespaces {
+		maxProfiles = append(maxProfiles, ns.MaxProfile)
+	}
+	for _, profile := range maxProfiles {
+		if _, ok := profileRanks[profile]; profile != "" && !ok {
+			return nil, fmt.Errorf("unknown maxProfile %q", profile)
+		}
+	}
+	if policy.MaxTTL != "" {
+		if ttl, err := time.ParseDuration(policy.MaxTTL); err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("maxTTL must be a positive duration such as 8h, not %q", policy.MaxTTL)
+		}
+	}
+	for profile, label := range policy.NamespaceLabels {
+		if _, ok := profileRanks[profile]; !ok {
+			return nil, fmt.Errorf("unknown profile %q in namespaceLabels", profile)
+		}
+		if key, _, _ := strings.Cut(label, "="); key == "" {
+			return nil, fmt.Errorf("namespaceLabels.%s must be key=value or key, not %q", profile, label)
+		}
+	}
+	return &policy, nil
+}
+
+// forNamespace returns the allowed images and maximum profile in namespace:
+// an exact namespace entry wins over patterns, longer patterns win over
+// shorter ones, and unset fields fall back to the cluster-wide values
+func (p *ClusterPolicy) forNamespace(namespace string) NamespacePolicy {
+	effective := NamespacePolicy{AllowedImages: p.AllowedImages, MaxProfile: p.MaxProfile}
+
+	match, ok := p.Namespaces[namespace]
+	if !ok {
+		patterns := make([]string, 0, len(p.Namespaces))
+		for pattern := range p.Namespaces {
+			patterns = append(patterns, pattern)
+		}
+		sort.Slice(patterns, func(i, j int) bool { return len(patterns[i]) > len(patterns[j]) })
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, namespace); matched {
+				match, ok = p.Namespaces[pattern], true
+				break
+			}
+		}
+	}
+	if ok {
+		if len(match.AllowedImages) > 0 {
+			effective.AllowedImages = match.AllowedImages
+		}
+		if match.MaxProfile != "" {
+			effective.MaxProfile = match.MaxProfile
+		}
+	}
+	return effective
+}
+
+// imageAllowed reports whether the image matches one of the patterns; the
+// image and the patterns are compared fully qualified
+func imageAllowed(image string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	normalized := normalizeImage(image)
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(normalizeRulePrefix(pattern), normalized); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// refusal is the error of a request the policy rejects; the suggestion
+// names the admin contact when the policy has one
+func (p *ClusterPolicy) refusal(message, suggestion string) *DetailedError {
+	if p.Contact != "" {
+		suggestion += ", or contact " + p.Contact
+	}
+	return NewDetailedError(ErrorTypePermission, fmt.Sprintf("%s by the cluster debug policy (%s/%s)", message, policyNamespace, policyConfigMap)).
+		WithSuggestion(suggestion).
+		WithCommand(fmt.Sprintf("kubectl get configmap %s -n %s -o yaml", policyConfigMap, policyNamespace))
+}
+
+// namespaceHasLabel reports whether the labels satisfy a key=value or key
+// requirement
+func namespaceHasLabel(labels map[string]string, requirement string) bool {
+	key, value, hasValue := strings.Cut(requirement, "=")
+	actual, ok := labels[key]
+	return ok && (!hasValue || actual == value)
+}
+
+// namespaceLabels reads the labels of the debug namespace
+func (config *DebugConfig) namespaceLabels() (map[string]string, error) {
+	output, err := config.kubectl("get", "namespace", config.Namespace, "-o", "json").Output()
+	if err != nil {
+		return nil, err
+	}
+	var namespace corev1.Namespace
+	if err := json.Unmarshal(output, &namespace); err != nil {
+		return nil, err
+	}
+	return namespace.Labels, nil
+}
+
+// checkProfileLabel refuses a profile that needs a namespace label the
+// debug namespace lacks; a namespace that cannot be read is refused too
+func (config *DebugConfig) checkProfileLabel(policy *ClusterPolicy, profile string) error {
+	requirement, ok := policy.NamespaceLabels[profile]
+	if !ok {
+		return nil
+	}
+	labels, err := config.namespaceLabels()
+	if err == nil && namespaceHasLabel(labels, requirement) {
+		return nil
+	}
+	refusal := policy.refusal(fmt.Sprintf("profile %s is only allowed in namespaces labeled %s, and namespace %s is not", profile, requirement, config.Namespace),
+		fmt.Sprintf("Debug with a less privileged profile, or ask the cluster admins to label namespace %s", config.Namespace))
+	if err != nil {
+		refusal = refusal.WithOriginalError(err)
+	}
+	return refusal
+}
+
+// enforcePolicy checks the debug image and profile against the cluster
+// policy. Pods with a fixed profile, such as privileged node pods, pass it
+// and are refused when it is too high; otherwise the session's profile is
+// checked and, with downgrade enforcement, lowered to the maximum. Profiles
+// listed in namespaceLabels are then refused outside labeled namespaces.
+func (config *DebugConfig) enforcePolicy(fixedProfile string) error {
+	policy := config.currentPolicy()
+	if policy == nil {
+		return nil
+	}
+	effective := policy.forNamespace(config.Namespace)
+
+	image := config.debugImage()
+	if !imageAllowed(image, effective.AllowedImages) {
+		return policy.refusal(fmt.Sprintf("image %s is not allowed in namespace %s", image, config.Namespace),
+			"Use one of the allowed images: "+strings.Join(effective.AllowedImages, ", "))
+	}
+
+	profile := fixedProfile
+	if profile == "" {
+		profile = config.Profile
+	}
+	if profile == "" {
+		profile = "general"
+	}
+	if effective.MaxProfile != "" && profileRank(profile) > profileRank(effective.MaxProfile) {
+		if fixedProfile != "" || policy.Enforcement != enforceDowngrade {
+			return policy.refusal(fmt.Sprintf("profile %s is not allowed in namespace %s", profile, config.Namespace),
+				fmt.Sprintf("Use --profile %s or a less privileged profile", effective.MaxProfile))
+		}
+		config.logf("Warning: the cluster debug policy allows at most the %s profile in namespace %s; using it instead of %s",
+			effective.MaxProfile, config.Namespace, profile)
+		config.Profile = effective.MaxProfile
+		profile = effective.MaxProfile
+	}
+	return config.checkProfileLabel(policy, profile)
+}
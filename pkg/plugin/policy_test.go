@@ -0,0 +1,195 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+)
+
+const testPolicy = `
+allowedImages:
+  - registry.internal/tools/*
+  - nicolaka/netshoot:*
+maxProfile: netadmin
+enforcement: downgrade
+namespaces:
+  prod-*:
+    maxProfile: baseline
+  prod-payments:
+    maxProfile: restricted
+    allowedImages: [registry.internal/tools/minimal:*]
+`
+
+func TestParseClusterPolicy(t *testing.T) {
+	policy, err := parseClusterPolicy(testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.MaxProfile != "netadmin" || len(policy.Namespaces) != 2 {
+		t.Errorf("parseClusterPolicy() = %+v", policy)
+	}
+
+	if policy, err := parseClusterPolicy(""); policy != nil || err != nil {
+		t.Errorf("parseClusterPolicy(empty) = %v, %v", policy, err)
+	}
+	for _, data := range []string{
+		"maxProfile: root",
+		"enforcement: warn",
+		"namespaces: {dev: {maxProfile: admin}}",
+		"allowedImage: [debug]",
+		"namespaceLabels: {root: debug-tool/allow-root=true}",
+		"namespaceLabels: {privileged: =true}",
+	} {
+		if _, err := parseClusterPolicy(data); err == nil {
+			t.Errorf("parseClusterPolicy(%q) succeeded", data)
+		}
+	}
+}
+
+func TestPolicyForNamespace(t *testing.T) {
+	policy, err := parseClusterPolicy(testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		namespace  string
+		maxProfile string
+		images     int
+	}{
+		{"default", "netadmin", 2},
+		{"prod-web", "baseline", 2},
+		{"prod-payments", "restricted", 1},
+	}
+	for _, tt := range tests {
+		got := policy.forNamespace(tt.namespace)
+		if got.MaxProfile != tt.maxProfile || len(got.AllowedImages) != tt.images {
+			t.Errorf("forNamespace(%s) = %+v", tt.namespace, got)
+		}
+	}
+}
+
+func TestImageAllowed(t *testing.T) {
+	patterns := []string{"registry.internal/tools/*", "nicolaka/netshoot:*"}
+	tests := []struct {
+		image string
+		want  bool
+	}{
+		{"registry.internal/tools/debug:1.2", true},
+		{"nicolaka/netshoot:v0.13", true},
+		{"docker.io/nicolaka/netshoot:latest", true},
+		{"busybox:1.36", false},
+		{"registry.internal/other/debug:1", false},
+	}
+	for _, tt := range tests {
+		if got := imageAllowed(tt.image, patterns); got != tt.want {
+			t.Errorf("imageAllowed(%s) = %v, want %v", tt.image, got, tt.want)
+		}
+	}
+	if !imageAllowed("busybox", nil) {
+		t.Error("imageAllowed() without patterns should allow every image")
+	}
+}
+
+func TestEnforcePolicy(t *testing.T) {
+	clusterPolicyOnce.Do(func() {})
+	defer func() { clusterPolicy = nil }()
+
+	var err error
+	clusterPolicy, err = parseClusterPolicy(testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &DebugConfig{Namespace: "default", Image: "nicolaka/netshoot:v0.13", Profile: "sysadmin"}
+	if err := config.enforcePolicy(""); err != nil || config.Profile != "netadmin" {
+		t.Errorf("enforcePolicy(downgrade) = %v, profile %s", err, config.Profile)
+	}
+	if err := config.enforcePolicy("privileged"); err == nil {
+		t.Error("enforcePolicy(privileged node pod) should be refused")
+	}
+
+	config = &DebugConfig{Namespace: "prod-web", Image: "busybox"}
+	if err := config.enforcePolicy(""); err == nil {
+		t.Error("enforcePolicy(disallowed image) should be refused")
+	}
+
+	clusterPolicy.Enforcement = enforceRefuse
+	config = &DebugConfig{Namespace: "prod-web", Image: "nicolaka/netshoot:v0.13"}
+	if err := config.enforcePolicy(""); err == nil {
+		t.Error("enforcePolicy(general above baseline) should be refused")
+	}
+	config.Profile = "baseline"
+	if err := config.enforcePolicy(""); err != nil {
+		t.Errorf("enforcePolicy(baseline) = %v", err)
+	}
+}
+
+func TestEphemeralCommandsEnforcePolicy(t *testing.T) {
+	clusterPolicyOnce.Do(func() {})
+	defer func() { clusterPolicy = nil }()
+	origRunner, origPod, origNamespace := defaultRunner, podName, namespace
+	defer func() { defaultRunner, podName, namespace = origRunner, origPod, origNamespace }()
+
+	var err error
+	clusterPolicy, err = parseClusterPolicy("allowedImages: [registry.internal/tools/*]\nenforcement: refuse\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster := newFakeCluster("")
+	defaultRunner = fakeClusterRunner{cluster: cluster, local: execRunner{}}
+	podName, namespace = "web-6d5f8b7c9-x2k4p", "default"
+
+	commands := map[string]func() error{
+		"inject": func() error { return runInject(injectCmd) },
+		"db":     func() error { return runClientTool(dbCmd, "postgres", dbClients["postgres"], true) },
+		"mq":     func() error { return runClientTool(mqCmd, "kafka", mqClients["kafka"], true) },
+	}
+	for name, run := range commands {
+		err := run()
+		if err == nil || !strings.Contains(err.Error(), "not allowed") {
+			t.Errorf("%s under a restrictive policy = %v, want a refusal", name, err)
+		}
+	}
+
+	obj := cluster.objects[objectKey("Pod", "default", podName)]
+	if spec := obj["spec"].(map[string]interface{}); spec["ephemeralContainers"] != nil {
+		t.Errorf("refused commands added ephemeral containers: %v", spec["ephemeralContainers"])
+	}
+}
+
+func TestNamespaceHasLabel(t *testing.T) {
+	labels := map[string]string{"debug-tool/allow-privileged": "true", "team": ""}
+	tests := []struct {
+		requirement string
+		want        bool
+	}{
+		{"debug-tool/allow-privileged=true", true},
+		{"debug-tool/allow-privileged=false", false},
+		{"team", true},
+		{"team=", true},
+		{"debug-tool/allow-sysadmin", false},
+	}
+	for _, tt := range tests {
+		if got := namespaceHasLabel(labels, tt.requirement); got != tt.want {
+			t.Errorf("namespaceHasLabel(%s) = %v, want %v", tt.requirement, got, tt.want)
+		}
+	}
+}
+
+func TestCheckProfileLabel(t *testing.T) {
+	policy := &ClusterPolicy{
+		NamespaceLabels: map[string]string{"privileged": "debug-tool/allow-privileged=true"},
+		Contact:         "#platform-team",
+	}
+	config := &DebugConfig{Namespace: "default", Runner: mockRunner{}}
+	if err := config.checkProfileLabel(policy, "netadmin"); err != nil {
+		t.Errorf("checkProfileLabel(netadmin) = %v", err)
+	}
+	err := config.checkProfileLabel(policy, "privileged")
+	detailed, ok := err.(*DetailedError)
+	if !ok {
+		t.Fatalf("checkProfileLabel(privileged) = %v, want a DetailedError", err)
+	}
+	if !strings.Contains(detailed.Suggestion, "#platform-team") {
+		t.Errorf("suggestion %q does not name the contact", detailed.Suggestion)
+	}
+}
@@ -0,0 +1,121 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Preset is a named debugging setup from the config file, invoked with
+// --preset. Fields only apply when the matching flag is not given on the
+// command line.
+type Preset struct {
+	Description   string `json:"description,omitempty"`
+	Image         string `json:"image,omitempty"`
+	Profile       string `json:"profile,omitempty"`
+	CPURequest    string `json:"cpuRequest,omitempty"`
+	MemoryRequest string `json:"memoryRequest,omitempty"`
+	MemoryLimit   string `json:"memoryLimit,omitempty"`
+	// Env and VolumeMounts are added to the debug container; volume mounts
+	// refer to volumes of the target pod, so they apply to ephemeral and
+	// copy operations
+	Env          []corev1.EnvVar      `json:"env,omitempty"`
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+	// Flags sets any other kpdbug flag by name, e.g. cap-add: NET_RAW
+	Flags map[string]string `json:"flags,omitempty"`
+}
+
+var presetName string
+
+// builtinPresets are available without a config file; a config file preset
+// of the same name replaces them
+var builtinPresets = map[string]Preset{
+	"ebpf": {
+		Description: "bpftrace with the ebpf security profile",
+		Image:       "quay.io/iovisor/bpftrace:latest",
+		Profile:     ebpfProfile,
+	},
+}
+
+// lookupPreset returns the preset of the config file or the built-in preset
+// called name
+func lookupPreset(name string) (Preset, bool) {
+	if preset, ok := currentConfig().Presets[name]; ok {
+		return preset, true
+	}
+	preset, ok := builtinPresets[name]
+	return preset, ok
+}
+
+// activePreset is the preset selected with --preset, applied to the flags
+var activePreset *Preset
+
+// applyPreset looks up the --preset name in the config file and sets the
+// flags it defines that were not given explicitly
+func applyPreset(cmd *cobra.Command) error {
+	if presetName == "" {
+		return nil
+	}
+
+	preset, ok := lookupPreset(presetName)
+	if !ok {
+		return NewValidationError("preset", presetName, "no such preset in "+configFilePath()).
+			WithSuggestion("Available presets: " + strings.Join(presetNames(), ", "))
+	}
+
+	values := map[string]string{
+		"image":          preset.Image,
+		"profile":        preset.Profile,
+		"cpu-request":    preset.CPURequest,
+		"memory-request": preset.MemoryRequest,
+		"memory-limit":   preset.MemoryLimit,
+	}
+	for name, value := range preset.Flags {
+		values[name] = value
+	}
+
+	for name, value := range values {
+		if value == "" {
+			continue
+		}
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil {
+			return NewValidationError("preset", presetName, fmt.Sprintf("unknown flag %q for kpdbug %s", name, cmd.Name()))
+		}
+		if flag.Changed {
+			continue
+		}
+		if err := cmd.Flags().Set(name, value); err != nil {
+			return NewValidationError("preset", presetName, fmt.Sprintf("invalid value %q for flag %q", value, name)).WithOriginalError(err)
+		}
+	}
+
+	activePreset = &preset
+	return nil
+}
+
+// presetNames returns the sorted names of the configured and built-in presets
+func presetNames() []string {
+	var names []string
+	for name := range currentConfig().Presets {
+		names = append(names, name)
+	}
+	for name := range builtinPresets {
+		if _, ok := currentConfig().Presets[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// presetEnv returns the environment of the active preset, if any
+func presetEnv() []corev1.EnvVar {
+	if activePreset == nil {
+		return nil
+	}
+	return activePreset.Env
+}
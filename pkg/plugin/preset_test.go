@@ -0,0 +1,70 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestApplyPreset(t *testing.T) {
+	loadedConfig = &Config{Presets: map[string]Preset{
+		"netshoot-privileged": {
+			Image:   "nicolaka/netshoot:latest",
+			Profile: "privileged",
+			Env:     []corev1.EnvVar{{Name: "TERM", Value: "xterm"}},
+			Flags:   map[string]string{"memory-limit": "1Gi"},
+		},
+	}}
+	defer func() {
+		loadedConfig = nil
+		activePreset = nil
+		presetName = ""
+	}()
+
+	var gotImage, gotProfile, gotMemory string
+	cmd := &cobra.Command{Use: "kpdbug"}
+	cmd.Flags().StringVar(&gotImage, "image", "debug:latest", "")
+	cmd.Flags().StringVar(&gotProfile, "profile", "", "")
+	cmd.Flags().StringVar(&gotMemory, "memory-limit", "128Mi", "")
+	cmd.Flags().String("cpu-request", "100m", "")
+	cmd.Flags().String("memory-request", "128Mi", "")
+	if err := cmd.Flags().Parse([]string{"--profile", "netadmin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	presetName = "netshoot-privileged"
+	if err := applyPreset(cmd); err != nil {
+		t.Fatalf("applyPreset() error = %v", err)
+	}
+	if gotImage != "nicolaka/netshoot:latest" || gotMemory != "1Gi" {
+		t.Errorf("image = %q, memory-limit = %q, want the preset values", gotImage, gotMemory)
+	}
+	if gotProfile != "netadmin" {
+		t.Errorf("profile = %q, want the explicit netadmin to win", gotProfile)
+	}
+	if env := presetEnv(); len(env) != 1 || env[0].Name != "TERM" {
+		t.Errorf("presetEnv() = %v, want TERM", env)
+	}
+
+	presetName = "missing"
+	if err := applyPreset(cmd); err == nil {
+		t.Error("applyPreset() with an unknown preset should fail")
+	}
+}
+
+func TestBuiltinPresets(t *testing.T) {
+	loadedConfig = &Config{}
+	defer func() { loadedConfig = nil }()
+
+	if preset, ok := lookupPreset("ebpf"); !ok || preset.Profile != ebpfProfile {
+		t.Errorf("lookupPreset(ebpf) = %+v, %v, want the built-in preset", preset, ok)
+	}
+	loadedConfig = &Config{Presets: map[string]Preset{"ebpf": {Image: "registry.local/bpftrace:v0.21"}}}
+	if preset, _ := lookupPreset("ebpf"); preset.Image != "registry.local/bpftrace:v0.21" {
+		t.Errorf("lookupPreset(ebpf) = %+v, want the config file preset to win", preset)
+	}
+	if names := presetNames(); len(names) != 1 || names[0] != "ebpf" {
+		t.Errorf("presetNames() = %v, want ebpf once", names)
+	}
+}
@@ -0,0 +1,370 @@
+package plugin
+
+import (
+	"fmt"
+	"hash/fnv"
+	"html"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultPerfImage gets perf installed at start unless the image has it
+const defaultPerfImage = "alpine:3.20"
+
+// asyncProfilerVersion is downloaded for JVM targets when asprof is missing
+const asyncProfilerVersion = "3.0"
+
+// Profilers of profile cpu
+const (
+	profilerAuto  = "auto"
+	profilerPerf  = "perf"
+	profilerAsync = "async-profiler"
+)
+
+var (
+	profileDuration   time.Duration
+	profileFrequency  int
+	profileFlamegraph string
+	profileCollapsed  string
+	profileProfiler   string
+)
+
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Profile the processes of a pod",
+	Long:  `Profiling helpers that run from a privileged ephemeral debug container in the target pod.`,
+}
+
+var profileCPUCmd = &cobra.Command{
+	Use:   "cpu",
+	Short: "Record a CPU profile of the target process and write a flamegraph",
+	Long: `Add a privileged ephemeral debug container to the target pod, sample the
+stacks of the target container's main process for the given duration and
+write an SVG flamegraph locally.
+
+Native processes are sampled with perf; the image gets perf installed with
+apk when it has none. JVMs (a main process named java) are sampled with
+async-profiler, which resolves Java frames; asprof is downloaded when the
+image has none. Use --image with the tools preinstalled on clusters without
+egress, and --collapsed to keep the folded stacks for other tools.`,
+	Example: `  kpdbug profile cpu -p mypod --duration 30s --flamegraph out.svg
+  kpdbug profile cpu -p jvm-pod --duration 1m --collapsed stacks.txt
+  kpdbug profile cpu -p mypod --profiler perf --frequency 199`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runProfileCPU(cmd)
+	},
+}
+
+func init() {
+	profileCPUCmd.Flags().DurationVar(&profileDuration, "duration", 30*time.Second, "how long to sample")
+	profileCPUCmd.Flags().IntVar(&profileFrequency, "frequency", 99, "samples per second")
+	profileCPUCmd.Flags().StringVar(&profileFlamegraph, "flamegraph", "", "path of the SVG flamegraph (default <pod>-cpu-<timestamp>.svg)")
+	profileCPUCmd.Flags().StringVar(&profileCollapsed, "collapsed", "", "also write the folded stacks to this path")
+	profileCPUCmd.Flags().StringVar(&profileProfiler, "profiler", profilerAuto, "profiler: auto, perf or async-profiler")
+	profileCmd.AddCommand(profileCPUCmd)
+	rootCmd.AddCommand(profileCmd)
+}
+
+// profilerSetupScript resolves $pid of the target, picks $profiler (async-profiler
+// for java, perf otherwise, unless forced) and prints PROFILER|<name>|<pid>|<comm>.
+// Its setup function installs the profiler when the image has none and sets
+// $asprof; it returns 2 when the profiler cannot be installed
+func profilerSetupScript(profiler string) string {
+	return targetPIDScript + fmt.Sprintf(`comm=$(cat /proc/$pid/comm 2>/dev/null)
+profiler=%[1]s
+if [ "$profiler" = %[2]s ]; then
+  if [ "$comm" = java ]; then profiler=%[3]s; else profiler=%[4]s; fi
+fi
+echo "PROFILER|$profiler|$pid|$comm"
+setup() {
+  if [ "$profiler" = %[4]s ]; then
+    command -v perf >/dev/null 2>&1 || apk add --no-cache perf >/dev/null 2>&1 || { echo "perf is not installed in the debug image" >&2; return 2; }
+    return 0
+  fi
+  asprof=$(command -v asprof || echo /tmp/async-profiler/bin/asprof)
+  if [ ! -x "$asprof" ]; then
+    case "$(uname -m)" in aarch64) arch=arm64;; *) arch=x64;; esac
+    mkdir -p /tmp/async-profiler
+    wget -qO- "https://github.com/async-profiler/async-profiler/releases/download/v%[5]s/async-profiler-%[5]s-linux-$arch.tar.gz" |
+      tar -xz -C /tmp/async-profiler --strip-components=1 || { echo "cannot download async-profiler" >&2; return 2; }
+  fi
+}
+`, profiler, profilerAuto, profilerAsync, profilerPerf, asyncProfilerVersion)
+}
+
+// profileScript samples the target process once and prints either "### perf"
+// with perf script output or "### collapsed" with folded stacks from
+// async-profiler
+func profileScript(profiler string, duration time.Duration, frequency int) string {
+	seconds := max(int(duration.Seconds()), 1)
+	interval := time.Second.Nanoseconds() / int64(max(frequency, 1))
+	return profilerSetupScript(profiler) + fmt.Sprintf(`profile() {
+  setup || return
+  if [ "$profiler" = %[1]s ]; then
+    perf record -F %[2]d -g -p "$pid" -o /tmp/kpdbug-perf.data -- sleep %[3]d >/dev/null 2>/tmp/kpdbug-perf.err || { cat /tmp/kpdbug-perf.err >&2; return 1; }
+    echo "### perf"
+    perf script -i /tmp/kpdbug-perf.data 2>/dev/null
+    return 0
+  fi
+  echo "### collapsed"
+  "$asprof" -d %[3]d -e cpu -i %[4]d -o collapsed "$pid"
+}
+profile`, profilerPerf, max(frequency, 1), seconds, interval)
+}
+
+var perfSampleHeader = regexp.MustCompile(`^(.*?)\s+\d+(?:/\d+)?\s`)
+
+// collapsePerfScript folds perf script output into stacks rooted at the
+// command name, counted per unique stack
+func collapsePerfScript(lines []string) map[string]int {
+	stacks := map[string]int{}
+	var comm string
+	var frames []string
+	flush := func() {
+		if comm != "" && len(frames) > 0 {
+			stack := []string{comm}
+			for i := len(frames) - 1; i >= 0; i-- {
+				stack = append(stack, frames[i])
+			}
+			stacks[strings.Join(stack, ";")]++
+		}
+		comm, frames = "", nil
+	}
+
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			flush()
+			if match := perfSampleHeader.FindStringSubmatch(line); match != nil {
+				comm = strings.TrimSpace(match[1])
+			}
+			continue
+		}
+		frames = append(frames, perfFrame(strings.Fields(line)))
+	}
+	flush()
+	return stacks
+}
+
+// perfFrame returns the function of a perf script frame line, split into
+// address, symbol and (dso); unknown symbols are named after their dso
+func perfFrame(fields []string) string {
+	if len(fields) < 2 {
+		return "[unknown]"
+	}
+	dso := ""
+	if last := fields[len(fields)-1]; strings.HasPrefix(last, "(") {
+		dso = strings.Trim(last, "()")
+		fields = fields[:len(fields)-1]
+	}
+	symbol := strings.Join(fields[1:], " ")
+	if i := strings.LastIndex(symbol, "+0x"); i > 0 {
+		symbol = symbol[:i]
+	}
+	if (symbol == "" || symbol == "[unknown]") && dso != "" {
+		return "[" + dso[strings.LastIndex(dso, "/")+1:] + "]"
+	}
+	if symbol == "" {
+		return "[unknown]"
+	}
+	return symbol
+}
+
+// parseCollapsed reads folded "frame;frame count" lines
+func parseCollapsed(lines []string) map[string]int {
+	stacks := map[string]int{}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		i := strings.LastIndex(line, " ")
+		if i <= 0 {
+			continue
+		}
+		count, err := strconv.Atoi(line[i+1:])
+		if err != nil {
+			continue
+		}
+		stacks[line[:i]] += count
+	}
+	return stacks
+}
+
+// formatCollapsed prints folded stacks sorted by stack
+func formatCollapsed(stacks map[string]int) string {
+	keys := make([]string, 0, len(stacks))
+	for stack := range stacks {
+		keys = append(keys, stack)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, stack := range keys {
+		fmt.Fprintf(&b, "%s %d\n", stack, stacks[stack])
+	}
+	return b.String()
+}
+
+// flameNode is a frame of the flamegraph with the samples of its subtree
+type flameNode struct {
+	Name     string
+	Value    int
+	Children map[string]*flameNode
+}
+
+// flameTree merges folded stacks into a tree
+func flameTree(stacks map[string]int) (*flameNode, int) {
+	root := &flameNode{Name: "all", Children: map[string]*flameNode{}}
+	depth := 0
+	for stack, count := range stacks {
+		node := root
+		node.Value += count
+		frames := strings.Split(stack, ";")
+		depth = max(depth, len(frames))
+		for _, frame := range frames {
+			child, ok := node.Children[frame]
+			if !ok {
+				child = &flameNode{Name: frame, Children: map[string]*flameNode{}}
+				node.Children[frame] = child
+			}
+			child.Value += count
+			node = child
+		}
+	}
+	return root, depth + 1
+}
+
+// Flamegraph layout
+const (
+	flameWidth       = 1200.0
+	flameFrameHeight = 16.0
+	flamePadding     = 10.0
+	flameTitleHeight = 30.0
+)
+
+// renderFlamegraph renders folded stacks as an SVG flamegraph with the root
+// at the bottom; frames are ordered by name like in FlameGraph
+func renderFlamegraph(stacks map[string]int, title string) string {
+	root, depth := flameTree(stacks)
+	height := flameTitleHeight + float64(depth)*flameFrameHeight + 2*flamePadding
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<?xml version="1.0" standalone="no"?>
+<svg version="1.1" width="%.0f" height="%.0f" xmlns="http://www.w3.org/2000/svg" font-family="Verdana, sans-serif" font-size="12">
+<rect x="0" y="0" width="100%%" height="100%%" fill="#f8f8f8"/>
+<text x="%.0f" y="20" text-anchor="middle" font-size="16">%s</text>
+`, flameWidth+2*flamePadding, height, flameWidth/2+flamePadding, html.EscapeString(title))
+
+	if root.Value > 0 {
+		scale := flameWidth / float64(root.Value)
+		var draw func(node *flameNode, x float64, level int)
+		draw = func(node *flameNode, x float64, level int) {
+			width := float64(node.Value) * scale
+			if width < 0.1 {
+				return
+			}
+			y := height - flamePadding - float64(level+1)*flameFrameHeight
+			label := fmt.Sprintf("%s (%d samples, %.2f%%)", node.Name, node.Value, 100*float64(node.Value)/float64(root.Value))
+			fmt.Fprintf(&b, `<g><title>%s</title><rect x="%.2f" y="%.1f" width="%.2f" height="%.1f" fill="%s" rx="2"/>`,
+				html.EscapeString(label), x, y, width, flameFrameHeight-1, flameColor(node.Name))
+			if chars := int(width / 7); chars >= 3 {
+				fmt.Fprintf(&b, `<text x="%.2f" y="%.1f">%s</text>`, x+3, y+flameFrameHeight-4, html.EscapeString(truncateString(node.Name, chars)))
+			}
+			b.WriteString("</g>\n")
+
+			names := make([]string, 0, len(node.Children))
+			for name := range node.Children {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				child := node.Children[name]
+				draw(child, x, level+1)
+				x += float64(child.Value) * scale
+			}
+		}
+		draw(root, flamePadding, 0)
+	}
+
+	b.WriteString("</svg>\n")
+	return b.String()
+}
+
+// flameColor picks a stable warm color per function name
+func flameColor(name string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	v := h.Sum32()
+	return fmt.Sprintf("rgb(%d,%d,%d)", 205+v%50, 60+(v>>8)%140, (v>>16)%55)
+}
+
+func runProfileCPU(cmd *cobra.Command) error {
+	switch profileProfiler {
+	case profilerAuto, profilerPerf, profilerAsync:
+	default:
+		return NewValidationError("profiler", profileProfiler, "must be one of: auto, perf, async-profiler")
+	}
+	config, err := newTargetConfig(cmd.Context(), cmd, defaultPerfImage, "sysadmin")
+	if err != nil {
+		return err
+	}
+	output := profileFlamegraph
+	if output == "" {
+		output = fmt.Sprintf("%s-cpu-%s.svg", config.PodName, clock().Format("20060102-150405"))
+	}
+
+	log.Printf("Profiling pod %s for %s...", config.PodName, profileDuration)
+	result, err := config.runEphemeralScript(config.PodName, profileScript(profileProfiler, profileDuration, profileFrequency))
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return NewDetailedError(ErrorTypeKubectl, fmt.Sprintf("profiling failed: %s", strings.TrimSpace(result.Stderr))).
+			WithSuggestion("Use --image with perf or async-profiler installed when the debug container cannot download them")
+	}
+
+	var profiler, process string
+	for _, line := range strings.Split(result.Output, "\n") {
+		if fields := strings.Split(strings.TrimSpace(line), "|"); len(fields) == 4 && fields[0] == "PROFILER" {
+			profiler, process = fields[1], fmt.Sprintf("%s (pid %s)", fields[3], fields[2])
+			break
+		}
+	}
+
+	sections := splitSections(result.Output)
+	var stacks map[string]int
+	if lines, ok := sections["collapsed"]; ok {
+		stacks = parseCollapsed(lines)
+	} else {
+		stacks = collapsePerfScript(sections["perf"])
+	}
+	if len(stacks) == 0 {
+		return NewDetailedError(ErrorTypeValidation, "no samples were recorded").
+			WithSuggestion("Check that the target process was busy during the profile, or increase --duration")
+	}
+
+	title := fmt.Sprintf("CPU profile of %s in pod %s/%s, %s with %s", process, config.Namespace, config.PodName, profileDuration, profiler)
+	if err := os.WriteFile(output, []byte(renderFlamegraph(stacks, title)), 0o644); err != nil {
+		return fmt.Errorf("error writing flamegraph: %v", err)
+	}
+	if profileCollapsed != "" {
+		if err := os.WriteFile(profileCollapsed, []byte(formatCollapsed(stacks)), 0o644); err != nil {
+			return fmt.Errorf("error writing folded stacks: %v", err)
+		}
+	}
+
+	samples := 0
+	for _, count := range stacks {
+		samples += count
+	}
+	log.Printf("Wrote flamegraph of %d samples to %s", samples, output)
+	return nil
+}
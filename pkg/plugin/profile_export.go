@@ -0,0 +1,329 @@
+package plugin
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+// parcaAgentImage is the node-wide eBPF agent pushing to Parca
+const parcaAgentImage = "ghcr.io/parca-dev/parca-agent:v0.30.0"
+
+// Profiling backends of profile export
+const (
+	backendPyroscope = "pyroscope"
+	backendParca     = "parca"
+)
+
+// parcaHostPaths are mounted from the node into the Parca agent pod, like in
+// the agent's own DaemonSet
+var parcaHostPaths = []struct {
+	Name     string
+	Path     string
+	ReadOnly bool
+}{
+	{"run", "/run", false},
+	{"boot", "/boot", true},
+	{"kernel-modules", "/lib/modules", true},
+	{"debugfs", "/sys/kernel/debug", false},
+	{"cgroup", "/sys/fs/cgroup", true},
+	{"bpffs", "/sys/fs/bpf", false},
+}
+
+var (
+	exportTo        string
+	exportEndpoint  string
+	exportToken     string
+	exportApp       string
+	exportDuration  time.Duration
+	exportPeriod    time.Duration
+	exportFrequency int
+	exportProfiler  string
+	exportInsecure  bool
+)
+
+var profileExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Push CPU profiles of the target to Pyroscope or Parca for a while",
+	Long: `Attach a profiling agent to the target for the given duration and push its
+profiles to a Pyroscope or Parca endpoint, then remove it.
+
+Pyroscope: a privileged ephemeral container samples the target container's
+main process with perf (async-profiler for JVMs) and uploads the folded
+stacks to the /ingest API every --period, named <app>{namespace,pod,container}.
+The agent stops by itself after --duration; ephemeral containers cannot be
+removed from the pod, so the stopped container stays in its status.
+
+Parca: the Parca agent runs in a privileged pod on the target's node, which
+is deleted after --duration or on Ctrl-C. The agent profiles every process of
+the node; filter on the target's processes in Parca.`,
+	Example: `  kpdbug profile export -p mypod --to pyroscope --endpoint http://pyroscope.observability:4040 --duration 15m
+  kpdbug profile export -p jvm-pod --to pyroscope --endpoint https://profiles.example.com --token $TOKEN
+  kpdbug profile export -p mypod --to parca --endpoint parca.observability:7070 --insecure --duration 30m`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runProfileExport(cmd)
+	},
+}
+
+func init() {
+	profileExportCmd.Flags().StringVar(&exportTo, "to", "", "backend: pyroscope or parca (required)")
+	profileExportCmd.Flags().StringVar(&exportEndpoint, "endpoint", "", "Pyroscope URL or Parca gRPC address (required)")
+	profileExportCmd.Flags().StringVar(&exportToken, "token", "", "bearer token for the endpoint")
+	profileExportCmd.Flags().StringVar(&exportApp, "app", "kpdbug.cpu", "Pyroscope application name")
+	profileExportCmd.Flags().DurationVar(&exportDuration, "duration", 10*time.Minute, "how long to push profiles")
+	profileExportCmd.Flags().DurationVar(&exportPeriod, "period", 10*time.Second, "Pyroscope upload interval")
+	profileExportCmd.Flags().IntVar(&exportFrequency, "frequency", 99, "samples per second")
+	profileExportCmd.Flags().StringVar(&exportProfiler, "profiler", profilerAuto, "Pyroscope profiler: auto, perf or async-profiler")
+	profileExportCmd.Flags().BoolVar(&exportInsecure, "insecure", false, "connect to Parca without TLS")
+	_ = profileExportCmd.MarkFlagRequired("to")
+	_ = profileExportCmd.MarkFlagRequired("endpoint")
+	profileCmd.AddCommand(profileExportCmd)
+}
+
+// pyroscopeIngestURL returns the /ingest URL of folded CPU profiles for the
+// target; the script appends from and until
+func pyroscopeIngestURL(endpoint, app string, labels map[string]string, frequency int, spy string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+
+	query := url.Values{}
+	query.Set("name", app+"{"+strings.Join(pairs, ",")+"}")
+	query.Set("format", "folded")
+	query.Set("sampleRate", fmt.Sprint(max(frequency, 1)))
+	query.Set("spyName", spy)
+	return strings.TrimSuffix(endpoint, "/") + "/ingest?" + query.Encode()
+}
+
+// perfCollapseAwk folds perf script output like collapsePerfScript, so the
+// agent uploads folded stacks
+const perfCollapseAwk = `awk '
+function flush() { if (n) { s = comm; for (i = n; i >= 1; i--) s = s ";" f[i]; c[s]++ } n = 0 }
+/^[ \t]*$/ { flush(); next }
+/^[^ \t]/ { flush(); comm = $1; next }
+{
+  sym = $2; for (i = 3; i < NF; i++) sym = sym " " $i
+  if (NF == 2) sym = $2
+  sub(/\+0x[0-9a-f]+$/, "", sym)
+  if (sym == "[unknown]" && NF >= 3) { d = $NF; gsub(/[()]/, "", d); sub(/.*\//, "", d); sym = "[" d "]" }
+  f[++n] = sym
+}
+END { flush(); for (s in c) print s, c[s] }'`
+
+// pyroscopeAgentScript samples the target every period until duration has
+// passed and uploads the folded stacks, printing PUSHED|<from>|<until>|<stacks>
+// or FAILED|<from>|<until> per upload
+func pyroscopeAgentScript(profiler, ingestURL, token string, duration, period time.Duration, frequency int) string {
+	seconds := max(int(period.Seconds()), 1)
+	header := ""
+	if token != "" {
+		header = "--header " + shellQuote("Authorization: Bearer "+token)
+	}
+	return profilerSetupScript(profiler) + fmt.Sprintf(`export_profiles() {
+  setup || return
+  end=$(( $(date +%%s) + %[1]d ))
+  while [ "$(date +%%s)" -lt "$end" ]; do
+    from=$(date +%%s)
+    if [ "$profiler" = %[2]s ]; then
+      perf record -F %[3]d -g -p "$pid" -o /tmp/kpdbug-perf.data -- sleep %[4]d >/dev/null 2>&1 || return 1
+      perf script -i /tmp/kpdbug-perf.data 2>/dev/null | %[5]s > /tmp/kpdbug.folded
+    else
+      "$asprof" -d %[4]d -e cpu -i %[6]d -o collapsed "$pid" > /tmp/kpdbug.folded || return 1
+    fi
+    until=$(date +%%s)
+    [ -s /tmp/kpdbug.folded ] || continue
+    if wget -q -O /dev/null --header "Content-Type: text/plain" %[7]s --post-file=/tmp/kpdbug.folded %[8]s"&from=$from&until=$until"; then
+      echo "PUSHED|$from|$until|$(wc -l < /tmp/kpdbug.folded)"
+    else
+      echo "FAILED|$from|$until"
+    fi
+  done
+}
+export_profiles`, max(int(duration.Seconds()), 1), profilerPerf, max(frequency, 1), seconds, perfCollapseAwk,
+		time.Second.Nanoseconds()/int64(max(frequency, 1)), header, shellQuote(ingestURL))
+}
+
+// exportSummary counts the uploads reported by pyroscopeAgentScript
+type exportSummary struct {
+	Pushed int
+	Failed int
+	Stacks int
+}
+
+// parseExportOutput parses the PUSHED and FAILED lines of the agent
+func parseExportOutput(output string) exportSummary {
+	var summary exportSummary
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), "|")
+		switch {
+		case fields[0] == "PUSHED" && len(fields) == 4:
+			summary.Pushed++
+			var stacks int
+			if _, err := fmt.Sscan(fields[3], &stacks); err == nil {
+				summary.Stacks += stacks
+			}
+		case fields[0] == "FAILED":
+			summary.Failed++
+		}
+	}
+	return summary
+}
+
+// parcaAgentPod builds the privileged Parca agent pod pinned to node
+func (config *DebugConfig) parcaAgentPod(name, node string) (*corev1.Pod, error) {
+	args := []string{"--node=" + node, "--remote-store-address=" + exportEndpoint}
+	if exportInsecure {
+		args = append(args, "--remote-store-insecure")
+	}
+	if exportToken != "" {
+		args = append(args, "--remote-store-bearer-token="+exportToken)
+	}
+
+	pod, err := config.toolPod(name, config.Namespace, "parca-agent", map[string]string{
+		"debug-tool/tool": "parca-agent",
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	pod.Spec.NodeName = node
+	pod.Spec.HostPID = true
+	pod.Spec.Tolerations = []corev1.Toleration{{Operator: corev1.TolerationOpExists}}
+	pod.Spec.SecurityContext = nil
+	container := &pod.Spec.Containers[0]
+	container.Args = args
+	container.SecurityContext = &corev1.SecurityContext{Privileged: ptr.To(true)}
+	for _, hostPath := range parcaHostPaths {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: hostPath.Name,
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{Path: hostPath.Path},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      hostPath.Name,
+			MountPath: hostPath.Path,
+			ReadOnly:  hostPath.ReadOnly,
+		})
+	}
+	return pod, nil
+}
+
+func runProfileExport(cmd *cobra.Command) error {
+	var image string
+	switch exportTo {
+	case backendPyroscope:
+		image = defaultPerfImage
+	case backendParca:
+		image = parcaAgentImage
+	default:
+		return NewValidationError("to", exportTo, "must be one of: pyroscope, parca")
+	}
+	switch exportProfiler {
+	case profilerAuto, profilerPerf, profilerAsync:
+	default:
+		return NewValidationError("profiler", exportProfiler, "must be one of: auto, perf, async-profiler")
+	}
+	config, err := newTargetConfig(cmd.Context(), cmd, image, "sysadmin")
+	if err != nil {
+		return err
+	}
+
+	if exportTo == backendParca {
+		return config.exportToParca()
+	}
+	return config.exportToPyroscope()
+}
+
+// exportToPyroscope runs the agent in an ephemeral container until duration
+// has passed
+func (config *DebugConfig) exportToPyroscope() error {
+	container, err := config.getTargetContainerName()
+	if err != nil {
+		return WrapKubectlError(err, "get target container name")
+	}
+	spy := "perf"
+	if exportProfiler == profilerAsync {
+		spy = "asprof"
+	}
+	ingestURL := pyroscopeIngestURL(exportEndpoint, exportApp, map[string]string{
+		"namespace": config.Namespace,
+		"pod":       config.PodName,
+		"container": container,
+	}, exportFrequency, spy)
+
+	config.logf("Pushing CPU profiles of pod %s to %s every %s for %s...", config.PodName, exportEndpoint, exportPeriod, exportDuration)
+	result, err := config.runEphemeralScript(config.PodName, pyroscopeAgentScript(exportProfiler, ingestURL, exportToken, exportDuration, exportPeriod, exportFrequency))
+	if err != nil {
+		return err
+	}
+	summary := parseExportOutput(result.Output)
+	if result.ExitCode != 0 && summary.Pushed == 0 {
+		return NewDetailedError(ErrorTypeKubectl, fmt.Sprintf("profiling agent failed: %s", strings.TrimSpace(result.Stderr))).
+			WithSuggestion("Use --image with perf or async-profiler installed when the debug container cannot download them")
+	}
+	fmt.Printf("Pushed %d profiles (%d stacks) to %s, %d uploads failed\n", summary.Pushed, summary.Stacks, exportEndpoint, summary.Failed)
+	if summary.Pushed == 0 {
+		return &ExitCodeError{Code: 1}
+	}
+	return nil
+}
+
+// exportToParca runs the Parca agent on the target's node until duration has
+// passed or the command is interrupted, then deletes it
+func (config *DebugConfig) exportToParca() error {
+	pod, err := config.getPod(config.PodName, config.Namespace)
+	if err != nil {
+		return WrapKubectlError(err, "get pod")
+	}
+	if pod.Spec.NodeName == "" {
+		return NewValidationError("pod", config.PodName, "is not scheduled on a node")
+	}
+
+	name := fmt.Sprintf("debug-parca-agent-%s-%s", clock().Format("150405"), randomSuffix())
+	if err := config.enforcePolicy("privileged"); err != nil {
+		return err
+	}
+	if err := config.verifyImage(true); err != nil {
+		return err
+	}
+	agent, err := config.parcaAgentPod(name, pod.Spec.NodeName)
+	if err != nil {
+		return err
+	}
+	if err := config.createObject(agent); err != nil {
+		return WrapKubectlError(err, "create Parca agent pod")
+	}
+	config.emitPodEvent(EventCreated, name, "parca-agent")
+	defer func() {
+		if err := config.kubectlWithContext(config.cleanupContext(), "delete", "pod", name, "-n", config.Namespace, "--wait=false").Run(); err != nil {
+			config.logf("Warning: Failed to delete Parca agent pod %s: %v", name, err)
+		} else {
+			config.emitPodEvent(EventDeleted, name, "")
+		}
+	}()
+
+	if err := config.waitForPod(name); err != nil {
+		return NewTimeoutError("Parca agent ready", fmt.Sprintf("%ds", maxAttempts)).WithOriginalError(err)
+	}
+	config.logf("Parca agent %s is profiling node %s and pushing to %s for %s; press Ctrl-C to stop", name, pod.Spec.NodeName, exportEndpoint, exportDuration)
+
+	select {
+	case <-time.After(exportDuration):
+	case <-config.context().Done():
+	}
+	config.logf("Removing Parca agent %s", name)
+	return nil
+}
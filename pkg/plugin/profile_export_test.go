@@ -0,0 +1,16 @@
+package plugin
+
+import "testing"
+
+func TestPyroscopeExport(t *testing.T) {
+	got := pyroscopeIngestURL("http://pyroscope:4040/", "kpdbug.cpu", map[string]string{"pod": "web-1", "namespace": "shop"}, 99, "perf")
+	want := "http://pyroscope:4040/ingest?format=folded&name=kpdbug.cpu%7Bnamespace%3Dshop%2Cpod%3Dweb-1%7D&sampleRate=99&spyName=perf"
+	if got != want {
+		t.Errorf("pyroscopeIngestURL() = %q, want %q", got, want)
+	}
+
+	summary := parseExportOutput("PROFILER|perf|12|myapp\nPUSHED|1|11|40\nFAILED|11|21\nPUSHED|21|31|2\n")
+	if summary != (exportSummary{Pushed: 2, Failed: 1, Stacks: 42}) {
+		t.Errorf("parseExportOutput() = %+v", summary)
+	}
+}
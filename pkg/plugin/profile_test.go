@@ -0,0 +1,47 @@
+package plugin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCollapsePerfScript(t *testing.T) {
+	output := `myapp 1234/1240 [001] 12345.678901:   10101010 cpu-clock:pppH:
+	    55d0c0a1b2c3 compute+0x13 (/app/myapp)
+	    55d0c0a1b000 main+0x20 (/app/myapp)
+	    7f0000001234 [unknown] (/lib/ld-musl-x86_64.so.1)
+
+myapp 1234/1240 [001] 12345.688901:   10101010 cpu-clock:pppH:
+	    55d0c0a1b2c3 compute+0x13 (/app/myapp)
+	    55d0c0a1b000 main+0x20 (/app/myapp)
+	    7f0000001234 [unknown] (/lib/ld-musl-x86_64.so.1)
+
+my worker 1234/1241 [002] 12345.690000:   10101010 cpu-clock:pppH:
+	ffffffff810b6b2e native_write_msr+0xe ([kernel.kallsyms])
+`
+	stacks := collapsePerfScript(strings.Split(output, "\n"))
+	want := map[string]int{
+		"myapp;[ld-musl-x86_64.so.1];main;compute": 2,
+		"my worker;native_write_msr":               1,
+	}
+	if !reflect.DeepEqual(stacks, want) {
+		t.Errorf("collapsePerfScript() = %v, want %v", stacks, want)
+	}
+
+	if got := parseCollapsed(strings.Split(formatCollapsed(want), "\n")); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseCollapsed(formatCollapsed()) = %v, want %v", got, want)
+	}
+}
+
+func TestRenderFlamegraph(t *testing.T) {
+	svg := renderFlamegraph(map[string]int{"java;Main.run;<compute>": 3, "java;GC": 1}, "CPU profile")
+	for _, want := range []string{"<svg", "Main.run (3 samples, 75.00%)", "&lt;compute&gt;", "all (4 samples, 100.00%)"} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("renderFlamegraph() does not contain %q", want)
+		}
+	}
+	if strings.Count(svg, "<rect") != 6 {
+		t.Errorf("renderFlamegraph() has %d rects, want a background and 5 frames", strings.Count(svg, "<rect"))
+	}
+}
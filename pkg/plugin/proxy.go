@@ -0,0 +1,190 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+// defaultProxyImage serves SOCKS5 and HTTP proxies from a single binary
+const defaultProxyImage = "ginuerzh/gost:2.11.5"
+
+// Ports the proxy listens on inside the pod
+const (
+	proxySOCKSPort = 1080
+	proxyHTTPPort  = 8080
+)
+
+var (
+	proxySOCKSLocal int
+	proxyHTTPLocal  int
+	proxyAddress    string
+)
+
+var proxyCmd = &cobra.Command{
+	Use:   "proxy",
+	Short: "Proxy local traffic into the cluster through a debug pod",
+	Long: `Start a SOCKS5 and HTTP proxy in a debug pod and port-forward both locally, so
+curl, a browser or any proxy-aware tool on your machine can reach
+cluster-internal services and DNS names. Names are resolved inside the
+cluster when the client uses socks5h:// or the HTTP proxy.
+
+The proxy runs until Ctrl-C, then the pod is deleted. The pod runs in the
+target namespace, so NetworkPolicies apply to it like to any pod there.`,
+	Example: `  kpdbug proxy -n shop
+  curl --proxy socks5h://localhost:1080 http://checkout.shop.svc:8080/healthz
+  HTTPS_PROXY=http://localhost:8080 curl https://internal-api.shop.svc/
+
+  kpdbug proxy --socks-port 1081 --http-port 0`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runProxy(cmd)
+	},
+}
+
+func init() {
+	proxyCmd.Flags().IntVar(&proxySOCKSLocal, "socks-port", proxySOCKSPort, "local port for the SOCKS5 proxy, 0 to disable")
+	proxyCmd.Flags().IntVar(&proxyHTTPLocal, "http-port", proxyHTTPPort, "local port for the HTTP proxy, 0 to disable")
+	proxyCmd.Flags().StringVar(&proxyAddress, "address", "localhost", "local address to listen on; use 0.0.0.0 to share the proxy")
+	rootCmd.AddCommand(proxyCmd)
+}
+
+// proxyPortForwards returns the local:remote port pairs for kubectl port-forward
+func proxyPortForwards(socksLocal, httpLocal int) []string {
+	var ports []string
+	if socksLocal > 0 {
+		ports = append(ports, fmt.Sprintf("%d:%d", socksLocal, proxySOCKSPort))
+	}
+	if httpLocal > 0 {
+		ports = append(ports, fmt.Sprintf("%d:%d", httpLocal, proxyHTTPPort))
+	}
+	return ports
+}
+
+// proxyPod builds the pod running the proxy. It uses the restricted profile
+// by default: the proxy needs no privileges and only opens unprivileged ports.
+func (config *DebugConfig) proxyPod(name string) (*corev1.Pod, error) {
+	resources, err := config.debugResources()
+	if err != nil {
+		return nil, err
+	}
+	profileName := config.Profile
+	if profileName == "" {
+		profileName = "restricted"
+	}
+	containerContext, podContext := getSecurityContextForProfile(profileName)
+
+	annotations := map[string]string{}
+	if user := config.currentUser(); user != "" {
+		annotations[createdByAnnotation] = user
+	}
+
+	return &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   config.Namespace,
+			Labels:      map[string]string{"debug-tool/type": "debug-pod"},
+			Annotations: annotations,
+		},
+		Spec: corev1.PodSpec{
+			AutomountServiceAccountToken:  ptr.To(false),
+			TerminationGracePeriodSeconds: ptr.To(int64(0)),
+			ActiveDeadlineSeconds:         config.activeDeadlineSeconds(),
+			SecurityContext:               podContext,
+			Containers: []corev1.Container{{
+				Name:  "proxy",
+				Image: config.debugImage(),
+				Args: []string{
+					"-L=socks5://:" + strconv.Itoa(proxySOCKSPort),
+					"-L=http://:" + strconv.Itoa(proxyHTTPPort),
+				},
+				Ports: []corev1.ContainerPort{
+					{Name: "socks", ContainerPort: proxySOCKSPort},
+					{Name: "http", ContainerPort: proxyHTTPPort},
+				},
+				SecurityContext: containerContext,
+				Resources:       resources.requirements(),
+			}},
+		},
+	}, nil
+}
+
+func runProxy(cmd *cobra.Command) error {
+	config := NewDebugConfigFromFlags()
+	config.Context = cmd.Context()
+	if !cmd.Flags().Changed("image") {
+		config.Image = defaultProxyImage
+	}
+
+	ports := proxyPortForwards(proxySOCKSLocal, proxyHTTPLocal)
+	if len(ports) == 0 {
+		return NewValidationError("port", "0", "at least one of --socks-port and --http-port must be set")
+	}
+	if err := config.fitNamespaceResources(nil); err != nil {
+		return err
+	}
+
+	name, err := config.freePodName()
+	if err != nil {
+		return err
+	}
+	fixedProfile := ""
+	if config.Profile == "" {
+		fixedProfile = "restricted"
+	}
+	if err := config.enforcePolicy(fixedProfile); err != nil {
+		return err
+	}
+	log.Printf("Creating proxy pod %s in namespace %s...", name, config.Namespace)
+	pod, err := config.proxyPod(name)
+	if err != nil {
+		return err
+	}
+	if err := config.createObject(pod); err != nil {
+		return WrapKubectlError(err, "create proxy pod")
+	}
+	config.emitPodEvent(EventCreated, name, "proxy")
+	defer func() {
+		log.Printf("Deleting proxy pod %s...", name)
+		if err := config.kubectlWithContext(config.cleanupContext(), "delete", "pod", name, "-n", config.Namespace, "--wait=false").Run(); err != nil {
+			log.Printf("Warning: Failed to delete proxy pod %s: %v", name, err)
+		} else {
+			config.emitPodEvent(EventDeleted, name, "")
+		}
+	}()
+
+	log.Printf("Waiting for pod to be ready...")
+	if err := config.waitForPod(name); err != nil {
+		return NewTimeoutError("proxy pod ready", fmt.Sprintf("%ds", maxAttempts)).WithOriginalError(err)
+	}
+
+	if proxySOCKSLocal > 0 {
+		log.Printf("SOCKS5 proxy: socks5h://%s:%d (e.g. curl --proxy socks5h://%s:%d http://<service>.<namespace>.svc)",
+			proxyAddress, proxySOCKSLocal, proxyAddress, proxySOCKSLocal)
+	}
+	if proxyHTTPLocal > 0 {
+		log.Printf("HTTP proxy:   http://%s:%d (e.g. HTTPS_PROXY=http://%s:%d)", proxyAddress, proxyHTTPLocal, proxyAddress, proxyHTTPLocal)
+	}
+	log.Printf("Press Ctrl-C to stop the proxy")
+
+	args := append([]string{"port-forward", "pod/" + name, "-n", config.Namespace, "--address", proxyAddress}, ports...)
+	forward := config.kubectl(args...)
+	forward.Stdout = os.Stderr
+	forward.Stderr = os.Stderr
+	err = forward.Run()
+	if config.context().Err() == context.Canceled {
+		return nil
+	}
+	if err != nil {
+		return WrapKubectlError(err, "port-forward to proxy pod")
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProxyPortForwards(t *testing.T) {
+	if got := proxyPortForwards(1081, 8080); strings.Join(got, " ") != "1081:1080 8080:8080" {
+		t.Errorf("proxyPortForwards(1081, 8080) = %v", got)
+	}
+	if got := proxyPortForwards(1080, 0); strings.Join(got, " ") != "1080:1080" {
+		t.Errorf("proxyPortForwards(1080, 0) = %v, want only the SOCKS port", got)
+	}
+}
+
+func TestProxyPod(t *testing.T) {
+	config := &DebugConfig{Namespace: "shop", Image: defaultProxyImage, CPURequest: "100m", MemoryLimit: "128Mi", MemoryRequest: "64Mi"}
+	pod, err := config.proxyPod("debug-proxy-abcde")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := pod.Spec.Containers[0]
+	if c.Image != defaultProxyImage || strings.Join(c.Args, " ") != "-L=socks5://:1080 -L=http://:8080" {
+		t.Errorf("proxy container = %s %v", c.Image, c.Args)
+	}
+	if c.SecurityContext.RunAsNonRoot == nil || !*c.SecurityContext.RunAsNonRoot {
+		t.Errorf("proxy container should run with the restricted profile, got %+v", c.SecurityContext)
+	}
+	if pod.Labels["debug-tool/type"] != "debug-pod" {
+		t.Errorf("labels = %v, want the debug pod label for list and clean", pod.Labels)
+	}
+}
@@ -0,0 +1,325 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// containerResources are the resources the debug container asks for
+type containerResources struct {
+	CPURequest    resource.Quantity
+	MemoryRequest resource.Quantity
+	MemoryLimit   resource.Quantity
+}
+
+// debugResources parses the resource flags of the config
+func (config *DebugConfig) debugResources() (containerResources, error) {
+	var res containerResources
+	for _, field := range []struct {
+		flag, value string
+		target      *resource.Quantity
+	}{
+		{"cpu-request", config.CPURequest, &res.CPURequest},
+		{"memory-request", config.MemoryRequest, &res.MemoryRequest},
+		{"memory-limit", config.MemoryLimit, &res.MemoryLimit},
+	} {
+		quantity, err := resource.ParseQuantity(field.value)
+		if err != nil {
+			return res, NewValidationError(field.flag, field.value, "not a valid resource quantity")
+		}
+		*field.target = quantity
+	}
+	return res, nil
+}
+
+// requirements returns the container as the API server sees it
+func (r containerResources) requirements() corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    r.CPURequest,
+			corev1.ResourceMemory: r.MemoryRequest,
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: r.MemoryLimit,
+		},
+	}
+}
+
+// containerDefaults returns the default limits and requests LimitRanges
+// apply to containers that do not set them
+func containerDefaults(limitRanges []corev1.LimitRange) (limits, requests corev1.ResourceList) {
+	limits, requests = corev1.ResourceList{}, corev1.ResourceList{}
+	for _, lr := range limitRanges {
+		for _, item := range lr.Spec.Limits {
+			if item.Type != corev1.LimitTypeContainer {
+				continue
+			}
+			for name, value := range item.Default {
+				limits[name] = value
+			}
+			for name, value := range item.DefaultRequest {
+				requests[name] = value
+			}
+		}
+	}
+	return limits, requests
+}
+
+// quotaUsage returns what a container adds to each quota key once the
+// LimitRange defaults are applied
+func quotaUsage(req corev1.ResourceRequirements, limitRanges []corev1.LimitRange) corev1.ResourceList {
+	defaultLimits, defaultRequests := containerDefaults(limitRanges)
+	limits := corev1.ResourceList{}
+	for name, value := range defaultLimits {
+		limits[name] = value
+	}
+	for name, value := range req.Limits {
+		limits[name] = value
+	}
+	// A missing request is taken from the container's own limit, then from
+	// the LimitRange defaultRequest, then from the defaulted limit
+	requests := corev1.ResourceList{}
+	for _, list := range []corev1.ResourceList{defaultLimits, defaultRequests, req.Limits, req.Requests} {
+		for name, value := range list {
+			requests[name] = value
+		}
+	}
+
+	usage := corev1.ResourceList{}
+	for name, value := range requests {
+		usage[name] = value
+		usage["requests."+name] = value
+	}
+	for name, value := range limits {
+		usage["limits."+name] = value
+	}
+	return usage
+}
+
+// podQuotaUsage sums quotaUsage over containers and counts the pod itself
+func podQuotaUsage(containers []corev1.ResourceRequirements, limitRanges []corev1.LimitRange) corev1.ResourceList {
+	total := corev1.ResourceList{
+		corev1.ResourcePods: resource.MustParse("1"),
+		"count/pods":        resource.MustParse("1"),
+	}
+	for _, container := range containers {
+		for name, value := range quotaUsage(container, limitRanges) {
+			sum := total[name]
+			sum.Add(value)
+			total[name] = sum
+		}
+	}
+	return total
+}
+
+// quotaRemaining returns the lowest remaining amount per resource across the
+// unscoped quotas; scoped quotas are skipped rather than guessed at
+func quotaRemaining(quotas []corev1.ResourceQuota) corev1.ResourceList {
+	remaining := corev1.ResourceList{}
+	for _, quota := range quotas {
+		if len(quota.Spec.Scopes) > 0 || quota.Spec.ScopeSelector != nil {
+			continue
+		}
+		for name, hard := range quota.Status.Hard {
+			left := hard.DeepCopy()
+			if used, ok := quota.Status.Used[name]; ok {
+				left.Sub(used)
+			}
+			if current, ok := remaining[name]; !ok || left.Cmp(current) < 0 {
+				remaining[name] = left
+			}
+		}
+	}
+	return remaining
+}
+
+// quotaViolations lists the quota keys usage would exceed, sorted by name
+func quotaViolations(usage, remaining corev1.ResourceList) []string {
+	var violations []string
+	for name, left := range remaining {
+		want, ok := usage[name]
+		if !ok {
+			// The API server rejects pods missing compute resources a quota tracks
+			switch name {
+			case corev1.ResourceLimitsCPU, corev1.ResourceLimitsMemory, corev1.ResourceRequestsCPU, corev1.ResourceRequestsMemory:
+				violations = append(violations, fmt.Sprintf("%s must be set (the quota tracks it and no LimitRange default applies)", name))
+			}
+			continue
+		}
+		if want.Cmp(left) > 0 {
+			violations = append(violations, fmt.Sprintf("%s: need %s, %s left", name, want.String(), left.String()))
+		}
+	}
+	sort.Strings(violations)
+	return violations
+}
+
+// shrinkToQuota lowers the debug container's resources so the pod fits the
+// remaining quota, never going below floor. base is what the rest of the pod
+// adds to the quota (the copied containers of a pod copy).
+func shrinkToQuota(res containerResources, floor corev1.ResourceList, base, remaining corev1.ResourceList) containerResources {
+	shrink := func(value *resource.Quantity, keys []corev1.ResourceName, minimum corev1.ResourceName) {
+		for _, key := range keys {
+			left, ok := remaining[key]
+			if !ok {
+				continue
+			}
+			if used, ok := base[key]; ok {
+				left.Sub(used)
+			}
+			if value.Cmp(left) <= 0 {
+				continue
+			}
+			if min, ok := floor[minimum]; ok && left.Cmp(min) < 0 {
+				left = min
+			}
+			if left.Cmp(*value) < 0 {
+				*value = left
+			}
+		}
+	}
+	shrink(&res.CPURequest, []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceRequestsCPU}, corev1.ResourceCPU)
+	shrink(&res.MemoryLimit, []corev1.ResourceName{corev1.ResourceLimitsMemory}, corev1.ResourceMemory)
+	shrink(&res.MemoryRequest, []corev1.ResourceName{corev1.ResourceMemory, corev1.ResourceRequestsMemory}, corev1.ResourceMemory)
+	if res.MemoryRequest.Cmp(res.MemoryLimit) > 0 {
+		res.MemoryRequest = res.MemoryLimit
+	}
+	return res
+}
+
+// raiseFloorToLimitRange raises floor to the Container minimums of the
+// LimitRanges, since shrinking below them gets the pod rejected anyway
+func raiseFloorToLimitRange(floor corev1.ResourceList, limitRanges []corev1.LimitRange) {
+	for _, lr := range limitRanges {
+		for _, item := range lr.Spec.Limits {
+			if item.Type != corev1.LimitTypeContainer {
+				continue
+			}
+			for name, min := range item.Min {
+				if current, ok := floor[name]; !ok || min.Cmp(current) > 0 {
+					floor[name] = min
+				}
+			}
+		}
+	}
+}
+
+// parseResourceFloor parses --quota-floor, e.g. "cpu=50m,memory=64Mi"
+func parseResourceFloor(value string) (corev1.ResourceList, error) {
+	floor := corev1.ResourceList{}
+	if value == "" {
+		return floor, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		name, amount, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || (name != "cpu" && name != "memory") {
+			return nil, NewValidationError("quota-floor", value, "expected cpu=<quantity>,memory=<quantity>")
+		}
+		quantity, err := resource.ParseQuantity(amount)
+		if err != nil {
+			return nil, NewValidationError("quota-floor", value, fmt.Sprintf("%q is not a valid quantity", amount))
+		}
+		floor[corev1.ResourceName(name)] = quantity
+	}
+	return floor, nil
+}
+
+// listNamespaced fetches a list of namespaced objects into list; an empty
+// response is an empty list
+func (config *DebugConfig) listNamespaced(kind string, list interface{}) error {
+	output, err := config.kubectl("get", kind, "-n", config.Namespace, "-o", "json").Output()
+	if err != nil {
+		return fmt.Errorf("error listing %s: %v", kind, err)
+	}
+	if len(strings.TrimSpace(string(output))) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(output, list); err != nil {
+		return fmt.Errorf("error parsing %s JSON: %v", kind, err)
+	}
+	return nil
+}
+
+// fitNamespaceResources adapts the debug container's resources to the
+// namespace LimitRange and then checks the pod against its ResourceQuota.
+// base holds the resources of the other containers of the pod. Objects that
+// cannot be read only produce a warning.
+func (config *DebugConfig) fitNamespaceResources(base []corev1.ResourceRequirements) error {
+	res, err := config.debugResources()
+	if err != nil {
+		return err
+	}
+
+	var limitRanges corev1.LimitRangeList
+	if err := config.listNamespaced("limitrange", &limitRanges); err != nil {
+		config.logf("Warning: Could not read LimitRange: %v", err)
+	}
+	if fitted, changes := fitLimitRange(res, limitRanges.Items); len(changes) > 0 {
+		config.logf("Adjusting debug container resources to the namespace LimitRange: %s", strings.Join(changes, ", "))
+		config.setResources(fitted)
+		res = fitted
+	}
+
+	return config.fitQuota(res, limitRanges.Items, base)
+}
+
+// setResources stores res back into the resource settings
+func (config *DebugConfig) setResources(res containerResources) {
+	config.CPURequest = res.CPURequest.String()
+	config.MemoryRequest = res.MemoryRequest.String()
+	config.MemoryLimit = res.MemoryLimit.String()
+}
+
+// fitQuota checks the debug pod against the namespace ResourceQuotas before
+// it is created. With --quota-floor the debug container shrinks to fit, but
+// never below the floor or the LimitRange minimum; otherwise, or when that
+// is not enough, it fails with the quota that would reject the pod.
+func (config *DebugConfig) fitQuota(res containerResources, limitRanges []corev1.LimitRange, base []corev1.ResourceRequirements) error {
+	floor, err := parseResourceFloor(config.QuotaFloor)
+	if err != nil {
+		return err
+	}
+
+	var quotas corev1.ResourceQuotaList
+	if err := config.listNamespaced("resourcequota", &quotas); err != nil {
+		config.logf("Warning: Could not check ResourceQuota: %v", err)
+		return nil
+	}
+	remaining := quotaRemaining(quotas.Items)
+	if len(remaining) == 0 {
+		return nil
+	}
+
+	containers := append([]corev1.ResourceRequirements{res.requirements()}, base...)
+	usage := podQuotaUsage(containers, limitRanges)
+	violations := quotaViolations(usage, remaining)
+	if len(violations) == 0 {
+		return nil
+	}
+
+	if config.QuotaFloor != "" {
+		raiseFloorToLimitRange(floor, limitRanges)
+		shrunk := shrinkToQuota(res, floor, podQuotaUsage(base, limitRanges), remaining)
+		containers[0] = shrunk.requirements()
+		if violations = quotaViolations(podQuotaUsage(containers, limitRanges), remaining); len(violations) == 0 {
+			config.logf("Shrinking debug container to fit the namespace quota: cpu request %s, memory request %s, memory limit %s",
+				shrunk.CPURequest.String(), shrunk.MemoryRequest.String(), shrunk.MemoryLimit.String())
+			config.setResources(shrunk)
+			return nil
+		}
+	}
+
+	suggestion := "Lower --cpu-request, --memory-request or --memory-limit, or pass --quota-floor to shrink them automatically"
+	if config.QuotaFloor != "" {
+		suggestion = "Lower --quota-floor or free up quota in the namespace"
+	}
+	return NewDetailedError(ErrorTypeResourceLimit,
+		fmt.Sprintf("Debug pod would exceed the ResourceQuota of namespace '%s': %s", config.Namespace, strings.Join(violations, "; "))).
+		WithSuggestion(suggestion).
+		WithCommand(fmt.Sprintf("kubectl describe resourcequota -n %s", config.Namespace))
+}
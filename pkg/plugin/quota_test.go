@@ -0,0 +1,186 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func resourceList(pairs ...string) corev1.ResourceList {
+	list := corev1.ResourceList{}
+	for i := 0; i < len(pairs); i += 2 {
+		list[corev1.ResourceName(pairs[i])] = resource.MustParse(pairs[i+1])
+	}
+	return list
+}
+
+func testQuota(hard, used corev1.ResourceList) corev1.ResourceQuota {
+	var quota corev1.ResourceQuota
+	quota.Status.Hard = hard
+	quota.Status.Used = used
+	return quota
+}
+
+func TestQuotaViolations(t *testing.T) {
+	debug := containerResources{
+		CPURequest:    resource.MustParse("100m"),
+		MemoryRequest: resource.MustParse("128Mi"),
+		MemoryLimit:   resource.MustParse("128Mi"),
+	}
+	cpuLimitDefault := corev1.LimitRange{}
+	cpuLimitDefault.Spec.Limits = []corev1.LimitRangeItem{{
+		Type:    corev1.LimitTypeContainer,
+		Default: resourceList("cpu", "200m"),
+	}}
+
+	tests := []struct {
+		name        string
+		quota       corev1.ResourceQuota
+		limitRanges []corev1.LimitRange
+		want        []string
+	}{
+		{
+			name:  "fits",
+			quota: testQuota(resourceList("requests.cpu", "1", "requests.memory", "1Gi", "pods", "10"), resourceList("requests.cpu", "500m", "requests.memory", "512Mi", "pods", "3")),
+		},
+		{
+			name:  "memory exhausted",
+			quota: testQuota(resourceList("requests.memory", "1Gi", "limits.memory", "1Gi"), resourceList("requests.memory", "1000Mi", "limits.memory", "800Mi")),
+			want:  []string{"requests.memory: need 128Mi, 24Mi left"},
+		},
+		{
+			name:  "pod count exhausted",
+			quota: testQuota(resourceList("pods", "5"), resourceList("pods", "5")),
+			want:  []string{"pods: need 1, 0 left"},
+		},
+		{
+			name:  "cpu limit required",
+			quota: testQuota(resourceList("limits.cpu", "2"), resourceList("limits.cpu", "1")),
+			want:  []string{"limits.cpu must be set (the quota tracks it and no LimitRange default applies)"},
+		},
+		{
+			name:        "cpu limit defaulted by LimitRange",
+			quota:       testQuota(resourceList("limits.cpu", "2"), resourceList("limits.cpu", "1900m")),
+			limitRanges: []corev1.LimitRange{cpuLimitDefault},
+			want:        []string{"limits.cpu: need 200m, 100m left"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usage := podQuotaUsage([]corev1.ResourceRequirements{debug.requirements()}, tt.limitRanges)
+			got := quotaViolations(usage, quotaRemaining([]corev1.ResourceQuota{tt.quota}))
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("quotaViolations() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQuotaRemainingSkipsScopedQuotas(t *testing.T) {
+	scoped := testQuota(resourceList("pods", "1"), resourceList("pods", "1"))
+	scoped.Spec.Scopes = []corev1.ResourceQuotaScope{corev1.ResourceQuotaScopeBestEffort}
+	tight := testQuota(resourceList("pods", "10"), resourceList("pods", "8"))
+	loose := testQuota(resourceList("pods", "20"), resourceList("pods", "1"))
+
+	remaining := quotaRemaining([]corev1.ResourceQuota{scoped, tight, loose})
+	if got := remaining[corev1.ResourcePods]; got.Cmp(resource.MustParse("2")) != 0 {
+		t.Errorf("remaining pods = %s, want 2", got.String())
+	}
+}
+
+func TestShrinkToQuota(t *testing.T) {
+	res := containerResources{
+		CPURequest:    resource.MustParse("100m"),
+		MemoryRequest: resource.MustParse("128Mi"),
+		MemoryLimit:   resource.MustParse("128Mi"),
+	}
+	remaining := resourceList("requests.cpu", "80m", "limits.memory", "100Mi", "requests.memory", "200Mi")
+	base := resourceList("requests.cpu", "20m")
+
+	got := shrinkToQuota(res, resourceList("cpu", "50m", "memory", "64Mi"), base, remaining)
+	if got.CPURequest.String() != "60m" || got.MemoryLimit.String() != "100Mi" || got.MemoryRequest.String() != "100Mi" {
+		t.Errorf("shrinkToQuota() = cpu %s, memory %s/%s, want 60m, 100Mi/100Mi",
+			got.CPURequest.String(), got.MemoryRequest.String(), got.MemoryLimit.String())
+	}
+
+	got = shrinkToQuota(res, resourceList("cpu", "70m"), base, remaining)
+	if got.CPURequest.String() != "70m" {
+		t.Errorf("shrinkToQuota() below floor = cpu %s, want the 70m floor", got.CPURequest.String())
+	}
+}
+
+func TestParseResourceFloor(t *testing.T) {
+	floor, err := parseResourceFloor("cpu=50m, memory=64Mi")
+	if err != nil {
+		t.Fatalf("parseResourceFloor() error = %v", err)
+	}
+	if cpu := floor[corev1.ResourceCPU]; cpu.String() != "50m" {
+		t.Errorf("cpu floor = %s, want 50m", cpu.String())
+	}
+	for _, value := range []string{"gpu=1", "cpu", "memory=lots"} {
+		if _, err := parseResourceFloor(value); err == nil {
+			t.Errorf("parseResourceFloor(%q) succeeded, want error", value)
+		}
+	}
+}
+
+func TestFitLimitRange(t *testing.T) {
+	defaults := containerResources{
+		CPURequest:    resource.MustParse("100m"),
+		MemoryRequest: resource.MustParse("128Mi"),
+		MemoryLimit:   resource.MustParse("128Mi"),
+	}
+	limitRange := func(item corev1.LimitRangeItem) []corev1.LimitRange {
+		item.Type = corev1.LimitTypeContainer
+		var lr corev1.LimitRange
+		lr.Spec.Limits = []corev1.LimitRangeItem{item}
+		return []corev1.LimitRange{lr}
+	}
+
+	tests := []struct {
+		name        string
+		limitRanges []corev1.LimitRange
+		wantCPU     string
+		wantMemReq  string
+		wantMemLim  string
+		wantChanges int
+	}{
+		{"no LimitRange", nil, "100m", "128Mi", "128Mi", 0},
+		{"pod-only constraints ignored", []corev1.LimitRange{{Spec: corev1.LimitRangeSpec{Limits: []corev1.LimitRangeItem{{Type: corev1.LimitTypePod, Min: resourceList("memory", "1Gi")}}}}}, "100m", "128Mi", "128Mi", 0},
+		{"below min uses the default", limitRange(corev1.LimitRangeItem{
+			Min:            resourceList("memory", "256Mi", "cpu", "200m"),
+			Default:        resourceList("memory", "512Mi", "cpu", "1"),
+			DefaultRequest: resourceList("memory", "256Mi", "cpu", "250m"),
+		}), "250m", "256Mi", "512Mi", 3},
+		{"above max clamps", limitRange(corev1.LimitRangeItem{
+			Max: resourceList("memory", "64Mi", "cpu", "50m"),
+		}), "50m", "64Mi", "64Mi", 3},
+		{"default cpu limit caps the request", limitRange(corev1.LimitRangeItem{
+			Default: resourceList("cpu", "80m"),
+		}), "80m", "128Mi", "128Mi", 1},
+		{"min applies to request and limit", limitRange(corev1.LimitRangeItem{
+			Min: resourceList("memory", "512Mi"),
+		}), "100m", "512Mi", "512Mi", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changes := fitLimitRange(defaults, tt.limitRanges)
+			if got.CPURequest.String() != tt.wantCPU || got.MemoryRequest.String() != tt.wantMemReq || got.MemoryLimit.String() != tt.wantMemLim {
+				t.Errorf("fitLimitRange() = cpu %s, memory %s/%s, want %s, %s/%s",
+					got.CPURequest.String(), got.MemoryRequest.String(), got.MemoryLimit.String(), tt.wantCPU, tt.wantMemReq, tt.wantMemLim)
+			}
+			if len(changes) != tt.wantChanges {
+				t.Errorf("fitLimitRange() changes = %q, want %d", changes, tt.wantChanges)
+			}
+		})
+	}
+
+	skewed := defaults
+	skewed.MemoryRequest = resource.MustParse("32Mi")
+	got, _ := fitLimitRange(skewed, limitRange(corev1.LimitRangeItem{MaxLimitRequestRatio: resourceList("memory", "2")}))
+	if got.MemoryRequest.String() != "64Mi" {
+		t.Errorf("fitLimitRange() with maxLimitRequestRatio = memory request %s, want 64Mi", got.MemoryRequest.String())
+	}
+}
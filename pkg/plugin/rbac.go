@@ -0,0 +1,98 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+)
+
+// accessCheck is one permission a debug strategy relies on
+type accessCheck struct {
+	verb        string
+	resource    string
+	subresource string
+}
+
+var (
+	accessEphemeral  = accessCheck{"patch", "pods", "ephemeralcontainers"}
+	accessCreatePods = accessCheck{"create", "pods", ""}
+	accessAttach     = accessCheck{"create", "pods", "attach"}
+	accessExec       = accessCheck{"create", "pods", "exec"}
+)
+
+func (c accessCheck) String() string {
+	if c.subresource == "" {
+		return c.verb + " " + c.resource
+	}
+	return c.verb + " " + c.resource + "/" + c.subresource
+}
+
+// args returns the kubectl auth can-i arguments, which run a
+// SelfSubjectAccessReview for the current identity
+func (c accessCheck) args(namespace string) []string {
+	args := []string{"auth", "can-i", c.verb, c.resource}
+	if c.subresource != "" {
+		args = append(args, "--subresource="+c.subresource)
+	}
+	return append(args, "-n", namespace)
+}
+
+// canI reports whether the current identity is allowed the check; known is
+// false when the review itself could not be performed
+func (config *DebugConfig) canI(check accessCheck) (allowed, known bool) {
+	output, _ := config.kubectl(check.args(config.Namespace)...).Output()
+	return parseCanI(string(output))
+}
+
+// parseCanI interprets kubectl auth can-i output, "yes" or "no" optionally
+// followed by a reason
+func parseCanI(output string) (allowed, known bool) {
+	answer := strings.TrimSpace(output)
+	switch {
+	case strings.HasPrefix(answer, "yes"):
+		return true, true
+	case strings.HasPrefix(answer, "no"):
+		return false, true
+	}
+	return false, false
+}
+
+// denied reports whether the check is known to be forbidden; inconclusive
+// reviews are treated as allowed and left to the API server
+func (config *DebugConfig) denied(check accessCheck) bool {
+	allowed, known := config.canI(check)
+	return known && !allowed
+}
+
+// selectByAccess checks the permissions of the chosen strategy up front. When
+// ephemeral containers are forbidden but pods may be created, it switches to
+// a pod copy; when nothing works it fails before anything is created.
+func (config *DebugConfig) selectByAccess() error {
+	if config.Operation == OperationAddContainer && config.denied(accessEphemeral) {
+		if config.denied(accessCreatePods) {
+			return NewPermissionError("add an ephemeral debug container or create a debug pod").
+				WithSuggestion(fmt.Sprintf("Ask for '%s' or '%s' in namespace '%s'", accessEphemeral, accessCreatePods, config.Namespace)).
+				WithCommand(displayKubectl(config.withKubectlFlags(accessEphemeral.args(config.Namespace))))
+		}
+		config.Operation = OperationCopyPod
+		config.logf("Strategy: pod copy with image %s, because you may not %s in namespace %s but may %s",
+			config.Image, accessEphemeral, config.Namespace, accessCreatePods)
+	}
+
+	if config.Operation != OperationAddContainer && config.denied(accessCreatePods) {
+		return NewPermissionError("create a debug pod").
+			WithSuggestion(fmt.Sprintf("Ask for '%s' in namespace '%s', or debug with an ephemeral container (omit --copy)", accessCreatePods, config.Namespace))
+	}
+
+	// Sessions need attach (interactive kubectl debug or attach) or exec
+	// (--command, replay pods); only warn, since the pod is still useful without them
+	if config.attaches() {
+		session := accessAttach
+		if config.Operation == OperationReplayJob || (config.Command != "" && config.Operation == OperationStandalone) {
+			session = accessExec
+		}
+		if config.denied(session) {
+			config.logf("Warning: you may not %s in namespace %s; the debug container will be created but the session cannot connect", session, config.Namespace)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCanI(t *testing.T) {
+	tests := []struct {
+		output      string
+		wantAllowed bool
+		wantKnown   bool
+	}{
+		{"yes\n", true, true},
+		{"no\n", false, true},
+		{"no - RBAC: clusterrole.rbac.authorization.k8s.io \"view\" not found\n", false, true},
+		{"", false, false},
+	}
+	for _, tt := range tests {
+		allowed, known := parseCanI(tt.output)
+		if allowed != tt.wantAllowed || known != tt.wantKnown {
+			t.Errorf("parseCanI(%q) = %v, %v, want %v, %v", tt.output, allowed, known, tt.wantAllowed, tt.wantKnown)
+		}
+	}
+}
+
+func TestAccessCheckArgs(t *testing.T) {
+	got := strings.Join(accessEphemeral.args("shop"), " ")
+	if want := "auth can-i patch pods --subresource=ephemeralcontainers -n shop"; got != want {
+		t.Errorf("args() = %q, want %q", got, want)
+	}
+	if got := accessCreatePods.String(); got != "create pods" {
+		t.Errorf("String() = %q, want %q", got, "create pods")
+	}
+}
@@ -0,0 +1,304 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/term"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// nativeAttachRunner runs the kubectl attach and exec sessions of kpdbug
+// through client-go's remotecommand, so their exit codes, terminal modes,
+// resizing and stdin are handled in process and need no kubectl binary.
+// Every other command, and sessions with flags it does not know, go to
+// next.
+type nativeAttachRunner struct {
+	next KubectlRunner
+}
+
+// NewNativeAttachRunner returns a runner running attach and exec sessions
+// with client-go and everything else with next, or with the kubectl binary
+// when next is nil
+func NewNativeAttachRunner(next KubectlRunner) KubectlRunner {
+	if next == nil {
+		next = execRunner{}
+	}
+	return nativeAttachRunner{next: next}
+}
+
+func (r nativeAttachRunner) Run(ctx context.Context, name string, args ...string) error {
+	return r.next.Run(ctx, name, args...)
+}
+
+func (r nativeAttachRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return r.next.Output(ctx, name, args...)
+}
+
+func (r nativeAttachRunner) Stream(ctx context.Context, streams IOStreams, name string, args ...string) error {
+	session, ok := parseRemoteSession(name, args)
+	if !ok {
+		return r.next.Stream(ctx, streams, name, args...)
+	}
+	// Failures read like kubectl's, so lost connections are recognized
+	if err := session.run(ctx, streams); err != nil {
+		if errors.Is(err, errSessionDetached) {
+			return err
+		}
+		var exitErr utilexec.ExitError
+		if errors.As(err, &exitErr) && exitErr.Exited() {
+			return &ExitCodeError{Code: exitErr.ExitStatus()}
+		}
+		// Stopped like kubectl on SIGTERM
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if streams.ErrOut != nil {
+			fmt.Fprintf(streams.ErrOut, "error: %v\n", err)
+		}
+		return &ExitCodeError{Code: 1}
+	}
+	return nil
+}
+
+// remoteSession is a kubectl attach or exec invocation of kpdbug
+type remoteSession struct {
+	// subresource is "attach" or "exec"
+	subresource string
+	namespace   string
+	pod         string
+	container   string
+	stdin       bool
+	tty         bool
+	command     []string
+
+	kubeconfig string
+	overrides  clientcmd.ConfigOverrides
+}
+
+// parseRemoteSession reads the kubectl arguments of an attach or exec
+// session, with the global kubectl flags kpdbug adds, or reports false for
+// any other command or a flag it does not know
+func parseRemoteSession(name string, args []string) (*remoteSession, bool) {
+	if name != "kubectl" || len(args) == 0 || (args[0] != "attach" && args[0] != "exec") {
+		return nil, false
+	}
+	session := &remoteSession{subresource: args[0], namespace: "default"}
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			session.command = args[i+1:]
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			if session.pod != "" {
+				return nil, false
+			}
+			session.pod = strings.TrimPrefix(arg, "pod/")
+			continue
+		}
+
+		flag, value, hasValue := strings.Cut(arg, "=")
+		if !hasValue && (flag == "-n" || flag == "-c") {
+			if i+1 >= len(args) {
+				return nil, false
+			}
+			i++
+			value = args[i]
+		}
+		if !session.setFlag(flag, value) {
+			return nil, false
+		}
+	}
+	if session.pod == "" || (session.subresource == "exec" && len(session.command) == 0) {
+		return nil, false
+	}
+	return session, true
+}
+
+// setFlag applies one kubectl flag, reporting false for unknown ones
+func (s *remoteSession) setFlag(flag, value string) bool {
+	auth, cluster := &s.overrides.AuthInfo, &s.overrides.ClusterInfo
+	switch flag {
+	case "-i", "--stdin":
+		s.stdin = true
+	case "-t", "--tty":
+		s.tty = true
+	case "-it", "-ti":
+		s.stdin, s.tty = true, true
+	case "-q", "--quiet":
+	case "-n", "--namespace":
+		s.namespace = value
+	case "-c", "--container":
+		s.container = value
+	case "--kubeconfig":
+		s.kubeconfig = value
+	case "--context":
+		s.overrides.CurrentContext = value
+	case "--cluster":
+		s.overrides.Context.Cluster = value
+	case "--user":
+		s.overrides.Context.AuthInfo = value
+	case "--server":
+		cluster.Server = value
+	case "--certificate-authority":
+		cluster.CertificateAuthority = value
+	case "--tls-server-name":
+		cluster.TLSServerName = value
+	case "--insecure-skip-tls-verify":
+		cluster.InsecureSkipTLSVerify = value == "true"
+	case "--token":
+		auth.Token = value
+	case "--client-certificate":
+		auth.ClientCertificate = value
+	case "--client-key":
+		auth.ClientKey = value
+	case "--as":
+		auth.Impersonate = value
+	case "--as-group":
+		auth.ImpersonateGroups = append(auth.ImpersonateGroups, value)
+	case "--request-timeout":
+		s.overrides.Timeout = value
+	case "--v":
+		// kubectl's own log level
+	default:
+		return false
+	}
+	return true
+}
+
+// restConfig loads the kubeconfig with the session's flags applied, like
+// kubectl does
+func (s *remoteSession) restConfig() (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = s.kubeconfig
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &s.overrides).ClientConfig()
+}
+
+// url is the pods subresource URL of the session on the API server
+func (s *remoteSession) url(config *rest.Config) (*url.URL, error) {
+	base, _, err := rest.DefaultServerUrlFor(config)
+	if err != nil {
+		return nil, err
+	}
+	u := *base
+	u.Path = path.Join("/", base.Path, "api/v1/namespaces", s.namespace, "pods", s.pod, s.subresource)
+	query := url.Values{}
+	if s.container != "" {
+		query.Set("container", s.container)
+	}
+	query.Set("stdin", strconv.FormatBool(s.stdin))
+	query.Set("stdout", "true")
+	// A terminal carries stderr on stdout
+	query.Set("stderr", strconv.FormatBool(!s.tty))
+	query.Set("tty", strconv.FormatBool(s.tty))
+	for _, arg := range s.command {
+		query.Add("command", arg)
+	}
+	u.RawQuery = query.Encode()
+	return &u, nil
+}
+
+// newRemoteExecutor connects to a session's URL over WebSockets, falling
+// back to SPDY for API servers that do not upgrade them, like kubectl
+var newRemoteExecutor = func(config *rest.Config, u *url.URL) (remotecommand.Executor, error) {
+	spdy, err := remotecommand.NewSPDYExecutor(config, "POST", u)
+	if err != nil {
+		return nil, err
+	}
+	websocket, err := remotecommand.NewWebSocketExecutor(config, "GET", u.String())
+	if err != nil {
+		return nil, err
+	}
+	return remotecommand.NewFallbackExecutor(websocket, spdy, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+}
+
+// run streams the session until the remote process ends or ctx is
+// cancelled. A terminal on stdin is switched to raw mode for a TTY session
+// and its size follows the local one. Interactive TTY sessions end with
+// errSessionDetached on the detach sequence.
+func (s *remoteSession) run(ctx context.Context, streams IOStreams) error {
+	config, err := s.restConfig()
+	if err != nil {
+		return err
+	}
+	u, err := s.url(config)
+	if err != nil {
+		return err
+	}
+	executor, err := newRemoteExecutor(config, u)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var detached atomic.Bool
+	options := remotecommand.StreamOptions{Stdout: streams.Out, Tty: s.tty}
+	switch {
+	case s.stdin && s.tty && streams.In != nil:
+		options.Stdin = newDetachReader(streams.In, func() {
+			detached.Store(true)
+			cancel()
+		})
+	case s.stdin:
+		options.Stdin = streams.In
+	}
+	if !s.tty {
+		options.Stderr = streams.ErrOut
+	}
+	if terminal, ok := streams.In.(*os.File); ok && s.tty && term.IsTerminal(int(terminal.Fd())) {
+		fd := int(terminal.Fd())
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = term.Restore(fd, state)
+		}()
+		options.TerminalSizeQueue = &terminalSizeQueue{ctx: ctx, fd: int(os.Stdout.Fd()), resized: terminalResizes(ctx)}
+	}
+	err = executor.StreamWithContext(ctx, options)
+	if detached.Load() {
+		return errSessionDetached
+	}
+	return err
+}
+
+// terminalSizeQueue reports the size of the local terminal, first when the
+// session starts and then whenever it changes
+type terminalSizeQueue struct {
+	ctx     context.Context
+	fd      int
+	resized <-chan struct{}
+	started bool
+}
+
+func (q *terminalSizeQueue) Next() *remotecommand.TerminalSize {
+	if q.started {
+		select {
+		case <-q.ctx.Done():
+			return nil
+		case <-q.resized:
+		}
+	}
+	q.started = true
+	width, height, err := term.GetSize(q.fd)
+	if err != nil {
+		return nil
+	}
+	return &remotecommand.TerminalSize{Width: uint16(width), Height: uint16(height)}
+}
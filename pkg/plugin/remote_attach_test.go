@@ -0,0 +1,156 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+func TestParseRemoteSession(t *testing.T) {
+	session, ok := parseRemoteSession("kubectl", []string{"attach", "-it", "debug-abc", "-c", "debugger", "-n", "team-a",
+		"--context=staging", "--as=alice", "--as-group=sre", "--token=s3cr3t", "--v=6"})
+	if !ok {
+		t.Fatal("parseRemoteSession(attach) = false")
+	}
+	if session.subresource != "attach" || session.pod != "debug-abc" || session.container != "debugger" || session.namespace != "team-a" ||
+		!session.stdin || !session.tty || session.command != nil {
+		t.Errorf("parseRemoteSession(attach) = %+v", session)
+	}
+	if auth := session.overrides.AuthInfo; session.overrides.CurrentContext != "staging" || auth.Impersonate != "alice" ||
+		!reflect.DeepEqual(auth.ImpersonateGroups, []string{"sre"}) || auth.Token != "s3cr3t" {
+		t.Errorf("parseRemoteSession(attach) overrides = %+v", session.overrides)
+	}
+
+	session, ok = parseRemoteSession("kubectl", []string{"exec", "-i", "web", "-n", "default", "--kubeconfig=/tmp/config", "--", "sh", "-c", "ls -l"})
+	if !ok || session.subresource != "exec" || !session.stdin || session.tty || session.kubeconfig != "/tmp/config" ||
+		!reflect.DeepEqual(session.command, []string{"sh", "-c", "ls -l"}) {
+		t.Errorf("parseRemoteSession(exec) = %+v, %v", session, ok)
+	}
+
+	// Anything else is left to kubectl
+	for _, args := range [][]string{
+		{"get", "pods"},
+		{"exec", "web", "-n", "default"},
+		{"attach", "-it", "web", "--pod-running-timeout=1m"},
+		{"attach", "web", "other"},
+		{"debug", "web", "-it", "--image=busybox"},
+	} {
+		if _, ok := parseRemoteSession("kubectl", args); ok {
+			t.Errorf("parseRemoteSession(%q) = true, want it left to kubectl", args)
+		}
+	}
+	if _, ok := parseRemoteSession("stty", []string{"exec", "web", "--", "sh"}); ok {
+		t.Error("parseRemoteSession(stty) = true")
+	}
+}
+
+// fakeExecutor records the stream of a session and fails like err
+type fakeExecutor struct {
+	url     *url.URL
+	host    string
+	options remotecommand.StreamOptions
+	err     error
+}
+
+func (f *fakeExecutor) Stream(options remotecommand.StreamOptions) error {
+	return f.StreamWithContext(context.Background(), options)
+}
+
+func (f *fakeExecutor) StreamWithContext(ctx context.Context, options remotecommand.StreamOptions) error {
+	f.options = options
+	if options.Stdin != nil {
+		_, _ = io.Copy(options.Stdout, options.Stdin)
+	}
+	return f.err
+}
+
+func TestNativeAttachRunner(t *testing.T) {
+	kubeconfig := t.TempDir() + "/config"
+	if err := os.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: prod
+  cluster:
+    server: https://10.0.0.1:6443
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    user: sso
+current-context: prod
+users:
+- name: sso
+  user:
+    token: from-kubeconfig
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	executor := &fakeExecutor{}
+	defer func(orig func(*rest.Config, *url.URL) (remotecommand.Executor, error)) { newRemoteExecutor = orig }(newRemoteExecutor)
+	newRemoteExecutor = func(config *rest.Config, u *url.URL) (remotecommand.Executor, error) {
+		executor.url, executor.host = u, config.Host
+		if config.Impersonate.UserName != "alice" || config.BearerToken != "from-kubeconfig" {
+			t.Errorf("rest config = %+v, want the kubeconfig's token and --as", config)
+		}
+		return executor, nil
+	}
+
+	// The remote exit code is the session's
+	next := &fakeRunner{}
+	runner := NewNativeAttachRunner(next)
+	executor.err = utilexec.CodeExitError{Err: errors.New("command terminated with exit code 3"), Code: 3}
+	var stdout, stderr bytes.Buffer
+	streams := IOStreams{In: strings.NewReader("uname -a\n"), Out: &stdout, ErrOut: &stderr}
+	err := runner.Stream(context.Background(), streams, "kubectl",
+		"exec", "-i", "debug-abc", "-n", "team-a", "-c", "debugger", "--kubeconfig="+kubeconfig, "--as=alice", "--", "sh", "-c", "cat")
+	if code, exited := exitCode(err); !exited || code != 3 {
+		t.Errorf("Stream(exec) = %v, want exit code 3", err)
+	}
+	want := "https://10.0.0.1:6443/api/v1/namespaces/team-a/pods/debug-abc/exec?command=sh&command=-c&command=cat&container=debugger&stderr=true&stdin=true&stdout=true&tty=false"
+	if executor.url.String() != want {
+		t.Errorf("URL = %s, want %s", executor.url, want)
+	}
+	if stdout.String() != "uname -a\n" || executor.options.Stderr != &stderr || executor.options.Tty {
+		t.Errorf("streamed stdout %q with options %+v, want the input echoed", stdout.String(), executor.options)
+	}
+	if len(next.calls) != 0 {
+		t.Errorf("kubectl ran %q, want the session streamed natively", next.calls)
+	}
+
+	// Connection failures are reported like kubectl does, so the session
+	// counts as lost
+	executor.err = errors.New("read tcp 10.0.0.2:50000->10.0.0.1:6443: read: connection reset by peer")
+	config := &DebugConfig{Namespace: "team-a", Runner: runner, KubectlFlags: []string{"--kubeconfig=" + kubeconfig, "--as=alice"},
+		Stdin: strings.NewReader(""), Stdout: io.Discard, Stderr: io.Discard}
+	if err := config.runSession("attach", "-it", "debug-abc", "-n", "team-a"); !isSessionLost(err) {
+		t.Errorf("runSession(attach) = %v, want the session lost", err)
+	}
+	if !executor.options.Tty || executor.options.Stderr != nil || executor.url.Query().Get("stderr") != "false" {
+		t.Errorf("attach options = %+v, URL %s, want a TTY carrying stderr", executor.options, executor.url)
+	}
+
+	// The detach sequence ends a terminal session without sending it
+	executor.err = nil
+	stdout.Reset()
+	streams = IOStreams{In: strings.NewReader("ls\n\x10\x11exit\n"), Out: &stdout, ErrOut: &stderr}
+	err = runner.Stream(context.Background(), streams, "kubectl", "attach", "-it", "debug-abc", "-n", "team-a", "--kubeconfig="+kubeconfig, "--as=alice")
+	if !errors.Is(err, errSessionDetached) || stdout.String() != "ls\n" {
+		t.Errorf("Stream(attach) = %v with stdout %q, want a detach after ls", err, stdout.String())
+	}
+
+	// Other commands run with the next runner
+	_ = runner.Run(context.Background(), "kubectl", "get", "pods")
+	if len(next.calls) != 1 || next.calls[0] != "kubectl get pods" {
+		t.Errorf("kubectl ran %q, want get pods", next.calls)
+	}
+}
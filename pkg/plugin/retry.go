@@ -0,0 +1,94 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+var (
+	retryBaseDelay = 250 * time.Millisecond
+	retryMaxDelay  = 5 * time.Second
+)
+
+// transientErrorMarkers are API server responses that are worth retrying
+var transientErrorMarkers = []string{
+	"etcdserver: leader changed",
+	"etcdserver: request timed out",
+	"Too Many Requests",
+	"TooManyRequests",
+	"(429)",
+	"the server is currently unable to handle the request",
+	"ServiceUnavailable",
+	"connection reset by peer",
+	"TLS handshake timeout",
+	"i/o timeout",
+	"http2: client connection lost",
+}
+
+// isTransientError reports whether err looks like a momentary API failure
+func isTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	msg := err.Error()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		msg += " " + string(exitErr.Stderr)
+	}
+
+	for _, marker := range transientErrorMarkers {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// withRetry runs fn, retrying transient failures up to --retries times with
+// exponential backoff and jitter. Only use it for idempotent operations.
+func withRetry(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= retries || !isTransientError(err) {
+			return err
+		}
+
+		delay := backoffDelay(attempt)
+		log.Printf("Transient API error (attempt %d/%d), retrying in %s: %v", attempt+1, retries+1, delay, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoffDelay returns the wait before the given retry attempt: the base delay
+// doubled per attempt, capped at retryMaxDelay, with up to 50% jitter.
+func backoffDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << attempt
+	if delay <= 0 || delay > retryMaxDelay {
+		delay = retryMaxDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// outputWithRetry runs the command built by newCmd and returns its stdout,
+// retrying transient failures. A fresh command is built for every attempt.
+func outputWithRetry(ctx context.Context, newCmd func() *runnerCommand) ([]byte, error) {
+	var output []byte
+	err := withRetry(ctx, func() error {
+		var err error
+		output, err = newCmd().Output()
+		return err
+	})
+	return output, err
+}
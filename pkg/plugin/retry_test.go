@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithRetry(t *testing.T) {
+	origDelay, origRetries := retryBaseDelay, retries
+	defer func() { retryBaseDelay, retries = origDelay, origRetries }()
+	retryBaseDelay = time.Millisecond
+	retries = 3
+
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   bool
+	}{
+		{
+			name:      "Succeeds first time",
+			errs:      []error{nil},
+			wantCalls: 1,
+			wantErr:   false,
+		},
+		{
+			name:      "Recovers from leader change",
+			errs:      []error{errors.New("etcdserver: leader changed"), nil},
+			wantCalls: 2,
+			wantErr:   false,
+		},
+		{
+			name:      "Gives up after max retries",
+			errs:      []error{errors.New("Too Many Requests"), errors.New("Too Many Requests"), errors.New("Too Many Requests"), errors.New("Too Many Requests")},
+			wantCalls: 4,
+			wantErr:   true,
+		},
+		{
+			name:      "Does not retry permanent errors",
+			errs:      []error{errors.New("pods \"x\" not found")},
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := withRetry(context.Background(), func() error {
+				err := tt.errs[calls]
+				calls++
+				return err
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("withRetry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("withRetry() calls = %d, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	for attempt := 0; attempt < 40; attempt++ {
+		delay := backoffDelay(attempt)
+		if delay <= 0 || delay > retryMaxDelay {
+			t.Errorf("backoffDelay(%d) = %s, want within (0, %s]", attempt, delay, retryMaxDelay)
+		}
+	}
+}
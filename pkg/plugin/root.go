@@ -1,22 +1,73 @@
 package plugin
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
 	"github.com/spf13/cobra"
 )
 
 var (
-	namespace     string
-	podName       string
-	image         string
-	interactive   bool
-	tty           bool
-	removeAfter   bool
-	force         bool
-	cpuRequest    string
-	memoryLimit   string
-	memoryRequest string
-	profile       string
-	copyPod       bool
+	namespace       string
+	podName         string
+	podNames        []string
+	container       string
+	image           string
+	interactive     bool
+	tty             bool
+	remoteCommand   string
+	outputFile      string
+	debugOutput     string
+	customSpecFile  string
+	removeAfter     bool
+	force           bool
+	cpuRequest      string
+	memoryLimit     string
+	memoryRequest   string
+	quotaFloor      string
+	profile         string
+	seccompProfile  string
+	appArmorProfile string
+	capAdd          []string
+	capDrop         []string
+	gcWithTarget    bool
+	copyPod         bool
+	kubeconfig      string
+	kubeContext     string
+	kubeCluster     string
+	kubeUser        string
+	kubeServer      string
+	kubeToken       string
+	certAuthority   string
+	clientCert      string
+	clientKey       string
+	tlsServerName   string
+	insecureTLS     bool
+	requestTimeout  string
+	kubectlLogLevel int
+	asUser          string
+	asGroups        []string
+	retries         int
+	attachRetries   int
+	noCache         bool
+	eventsJSON      string
+	verifyImage     bool
+	debugTTL        time.Duration
+	mockCluster     bool
+	deterministic   bool
+	debugProbes     bool
+	tailTarget      bool
+	followTarget    bool
+	noProbeShell    bool
+	nativeAttach    bool
+	ordinal         int
+	onNode          string
 )
 
 var rootCmd = &cobra.Command{
@@ -27,21 +78,70 @@ including non-root execution, resource limits, and security context configuratio
 It provides an easy-to-use CLI interface for debugging Kubernetes pods.`,
 	SilenceErrors: true,
 	SilenceUsage:  true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		historyCommand = cmd
+		// Only --command sessions of the root command take several targets
+		if len(podNames) > 1 && cmd.HasParent() {
+			return NewValidationError("pod", strings.Join(podNames, ","), fmt.Sprintf("kpdbug %s takes a single -p target", cmd.Name()))
+		}
+		if len(podNames) > 0 {
+			podName = podNames[0]
+		}
+		if err := openEventSink(eventsJSON); err != nil {
+			return err
+		}
+		if err := applyPreset(cmd); err != nil {
+			return err
+		}
+		if deterministic || os.Getenv("KPDBUG_DETERMINISTIC") == "1" {
+			useDeterministicMode()
+			// The invocation started before the clock stopped
+			historyStart = clock()
+		}
+		if mockCluster || os.Getenv("KPDBUG_FAKE") == "1" {
+			useFakeCluster()
+		} else if nativeAttach {
+			defaultRunner = NewNativeAttachRunner(defaultRunner)
+		}
+		sweepOrphans(cmd)
+		return nil
+	},
 	RunE: func(cmd *cobra.Command, args []string) error {
 		// Validate removeAfter flag
-		if removeAfter && (!interactive || !tty) {
-			return NewValidationError("--rm flag", "true", "--rm requires -it flags to be set")
+		if removeAfter && (!interactive || !tty) && remoteCommand == "" {
+			return NewValidationError("--rm flag", "true", "--rm requires -it flags or --command to be set")
+		}
+
+		if outputFile != "" && remoteCommand == "" {
+			return NewValidationError("output-file", outputFile, "--output-file only saves the output of --command").
+				WithSuggestion("Run a one-shot command with --command, or kpdbug each/nodes for many pods")
+		}
+
+		if debugOutput != "" && debugOutput != "name" {
+			return NewValidationError("output", debugOutput, "must be \"name\"")
+		}
+		if debugOutput == "name" && (tty || remoteCommand != "" || removeAfter) {
+			return NewValidationError("output", debugOutput, "-o name cannot be combined with -t, --command or --rm").
+				WithSuggestion("Capture the pod name first, then attach with 'kpdbug attach <pod>'")
 		}
 
 		// Validate profile
-		switch profile {
-		case "general", "restricted", "baseline", "privileged", "":
-			// Valid profiles
-		default:
-			return NewValidationError("profile", profile, "must be one of: general, restricted, baseline, privileged")
+		if err := validateProfile(profile); err != nil {
+			return err
+		}
+		if _, err := parseSeccompProfile(seccompProfile); err != nil {
+			return err
+		}
+		if _, err := parseAppArmorProfile(appArmorProfile); err != nil {
+			return err
 		}
 
-		err := runDebug()
+		var err error
+		if len(podNames) > 1 {
+			err = runMultiTarget(cmd.Context(), podNames)
+		} else {
+			err = runDebug(cmd.Context())
+		}
 		if err != nil {
 			HandleError(err)
 		}
@@ -49,28 +149,153 @@ It provides an easy-to-use CLI interface for debugging Kubernetes pods.`,
 	},
 }
 
+// validProfiles lists the supported security profiles
+var validProfiles = []string{"general", "restricted", "baseline", "netadmin", "sysadmin", "ebpf", "privileged"}
+
+// validateProfile checks a security profile name; empty selects the default
+func validateProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+	for _, valid := range validProfiles {
+		if name == valid {
+			return nil
+		}
+	}
+	return NewValidationError("profile", name, "must be one of: "+strings.Join(validProfiles, ", "))
+}
+
 func init() {
 	// Set namespace flag with default value
-	rootCmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", "default", "namespace for the debug pod")
+	rootCmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", "", "namespace for the debug pod (defaults to the namespace of the current kubeconfig context)")
 
 	// Other flags
-	rootCmd.PersistentFlags().StringVarP(&podName, "pod", "p", "", "name of the target pod (optional)")
+	rootCmd.PersistentFlags().StringArrayVarP(&podNames, "pod", "p", nil, "name of the target pod, <kind>/<name> of a workload or a label selector such as app=web (optional); repeat it to run a --command in several targets at once")
+	rootCmd.PersistentFlags().StringVar(&onNode, "on-node", "", "with a workload (-p deployment/<name>) or label selector (-p app=web) target, pick the replica running on this node")
+	rootCmd.PersistentFlags().IntVar(&ordinal, "ordinal", -1, "ordinal of the pod to target with -p statefulset/<name> (defaults to the first)")
+	rootCmd.PersistentFlags().StringVar(&container, "container", "", "name of the target container (defaults to the first container of the pod)")
 	rootCmd.PersistentFlags().StringVar(&image, "image", "debug:latest", "debug container image")
 	rootCmd.PersistentFlags().BoolVarP(&interactive, "stdin", "i", false, "keep stdin open even if not attached")
 	rootCmd.PersistentFlags().BoolVarP(&tty, "tty", "t", false, "allocate a TTY for the container")
+	rootCmd.Flags().StringVarP(&debugOutput, "output", "o", "", "output format; \"name\" prints only the debug pod name to stdout and all logs to stderr")
+	rootCmd.Flags().StringVar(&remoteCommand, "command", "", "shell command to run in the debug container instead of a shell; with -i and no -t, stdin is streamed into it")
+	rootCmd.PersistentFlags().StringVar(&outputFile, "output-file", "", "also save the remote output of --command, each and nodes to <prefix>-<pod>-<timestamp>.log, one file per pod or node")
 	rootCmd.PersistentFlags().BoolVar(&removeAfter, "rm", false, "automatically remove the pod after the session ends")
 	rootCmd.PersistentFlags().BoolVarP(&force, "force", "f", false, "force creation of a new debug pod if one already exists")
 	rootCmd.PersistentFlags().BoolVar(&copyPod, "copy", false, "create a copy of the target pod instead of adding a container")
+	rootCmd.PersistentFlags().BoolVar(&nativeAttach, "native-attach", false, "run attach and exec sessions with client-go instead of the kubectl binary")
+	rootCmd.PersistentFlags().BoolVar(&noProbeShell, "no-probe-shell", false, "do not exec sh in the target container first to report distroless and scratch targets")
+
+	// Config file
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "path to the kpdbug config file (default $KPDBUG_CONFIG or <user config dir>/kpdbug/config.yaml)")
+
+	// Cluster selection flags, forwarded to every kubectl call
+	rootCmd.PersistentFlags().StringVar(&kubeconfig, "kubeconfig", "", "path to the kubeconfig file to use for kubectl operations")
+	rootCmd.PersistentFlags().StringVar(&kubeContext, "context", "", "name of the kubeconfig context to use")
+	rootCmd.PersistentFlags().StringVar(&kubeCluster, "cluster", "", "name of the kubeconfig cluster to use")
+	rootCmd.PersistentFlags().StringVar(&kubeUser, "user", "", "name of the kubeconfig user to use")
+
+	// Connection flags of kubectl, forwarded to every kubectl call
+	rootCmd.PersistentFlags().StringVarP(&kubeServer, "server", "s", "", "address and port of the Kubernetes API server")
+	rootCmd.PersistentFlags().StringVar(&kubeToken, "token", "", "bearer token for authentication to the API server")
+	rootCmd.PersistentFlags().StringVar(&certAuthority, "certificate-authority", "", "path to a cert file for the certificate authority")
+	rootCmd.PersistentFlags().StringVar(&clientCert, "client-certificate", "", "path to a client certificate file for TLS")
+	rootCmd.PersistentFlags().StringVar(&clientKey, "client-key", "", "path to a client key file for TLS")
+	rootCmd.PersistentFlags().StringVar(&tlsServerName, "tls-server-name", "", "server name to use for server certificate validation")
+	rootCmd.PersistentFlags().BoolVar(&insecureTLS, "insecure-skip-tls-verify", false, "do not check the server's certificate for validity; makes HTTPS connections insecure")
+	rootCmd.PersistentFlags().StringVar(&requestTimeout, "request-timeout", "", "time to wait for a single server request before giving up, e.g. 30s (0 waits forever)")
+	rootCmd.PersistentFlags().IntVarP(&kubectlLogLevel, "v", "v", 0, "kubectl log level, e.g. 6 to log the API requests")
+
+	// Impersonation flags, forwarded to every kubectl call
+	rootCmd.PersistentFlags().StringVar(&asUser, "as", "", "username to impersonate for all kubectl operations")
+	rootCmd.PersistentFlags().StringArrayVar(&asGroups, "as-group", nil, "group to impersonate for all kubectl operations, can be repeated")
+
+	// Retries for idempotent API reads
+	rootCmd.PersistentFlags().IntVar(&retries, "retries", 3, "number of retries for transient API failures on read operations")
+	rootCmd.PersistentFlags().IntVar(&attachRetries, "attach-retries", 3, "number of times to reattach an interactive session after the connection drops (0 disables)")
+
+	// Completion cache escape hatch
+	rootCmd.PersistentFlags().BoolVar(&noCache, "no-cache", false, "bypass the on-disk cache used by shell completion lookups")
 
 	// Security profile flag
-	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "security profile to use (general, restricted, baseline, privileged)")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "security profile to use (general, restricted, baseline, netadmin, sysadmin, ebpf, privileged)")
+
+	rootCmd.PersistentFlags().StringVar(&seccompProfile, "seccomp-profile", "", "seccomp profile for the debug container (RuntimeDefault, Unconfined, localhost/<path>)")
+	rootCmd.PersistentFlags().StringVar(&appArmorProfile, "apparmor-profile", "", "AppArmor profile for the debug container (runtime/default, unconfined, localhost/<name>)")
+
+	rootCmd.PersistentFlags().StringSliceVar(&capAdd, "cap-add", nil, "capabilities to add on top of the profile (e.g. NET_RAW,SYS_PTRACE)")
+	rootCmd.PersistentFlags().StringSliceVar(&capDrop, "cap-drop", nil, "capabilities to drop from the profile")
+
+	rootCmd.PersistentFlags().StringVar(&presetName, "preset", "", "named preset from the config file bundling image, profile, resources, env, volumes and flags")
+	rootCmd.PersistentFlags().BoolVar(&verifyImage, "verify-image", false, "verify the debug image with the cosign and scanner checks of the config file and refuse it if they fail")
+	rootCmd.Flags().BoolVar(&followTarget, "follow", false, "when the target pod restarts, is evicted or is replaced, attach a new ephemeral debug container to it (or to its replacement)")
+	rootCmd.PersistentFlags().BoolVar(&tailTarget, "tail-target", false, "follow the target container's logs on stderr, prefixed with pod/container, while attached to the debug container")
+	rootCmd.PersistentFlags().BoolVar(&debugProbes, "probes", false, "add exec /bin/true liveness and readiness probes to standalone debug pods (the image must contain /bin/true)")
+	rootCmd.PersistentFlags().DurationVar(&debugTTL, "ttl", 0, "maximum lifetime of debug pods, enforced by the cluster through activeDeadlineSeconds (capped by the configured maxTTL)")
+	rootCmd.PersistentFlags().StringVar(&customSpecFile, "custom", "", "partial container spec (YAML or JSON) merged into the debug container for ephemeral and copy operations")
+
+	// Garbage collection
+	rootCmd.PersistentFlags().BoolVar(&gcWithTarget, "gc-with-target", false, "make the target pod the owner of the debug pod so it is deleted together with the target")
 
 	// Resource flags
 	rootCmd.PersistentFlags().StringVar(&memoryLimit, "memory-limit", "128Mi", "memory limit for the debug container")
 	rootCmd.PersistentFlags().StringVar(&cpuRequest, "cpu-request", "100m", "CPU request for the debug container")
 	rootCmd.PersistentFlags().StringVar(&memoryRequest, "memory-request", "128Mi", "memory request for the debug container")
+	rootCmd.PersistentFlags().StringVar(&quotaFloor, "quota-floor", "", "shrink the debug container to the namespace's remaining ResourceQuota, but not below this (e.g. cpu=50m,memory=64Mi)")
+
+	rootCmd.PersistentFlags().BoolVar(&mockCluster, "mock", false, "run against an in-memory fake cluster instead of kubectl, for demos and CI (same as KPDBUG_FAKE=1)")
+	rootCmd.PersistentFlags().BoolVar(&deterministic, "deterministic", false, "stop the clock and seed name generation so output is reproducible, for golden-file tests (same as KPDBUG_DETERMINISTIC=1)")
+	_ = rootCmd.PersistentFlags().MarkHidden("deterministic")
+
+	rootCmd.PersistentFlags().StringVar(&eventsJSON, "events-json", "", "write lifecycle events as JSON lines to \"stderr\", an inherited file descriptor number or a file path")
+
+	// Set up custom completions for flags
+	setupCustomCompletions()
 }
 
+// Execute runs the root command; an interrupt cancels any in-flight kubectl
+// call. A failing remote command makes the process exit with its exit code.
 func Execute() error {
-	return rootCmd.Execute()
+	startHistory(os.Args[1:])
+	ctx, stop := interruptContext(context.Background())
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	finishHistory(err)
+	defer closeEventSink()
+
+	var exitCodeErr *ExitCodeError
+	if errors.As(err, &exitCodeErr) {
+		closeEventSink()
+		os.Exit(exitCodeErr.Code)
+	}
+	if err != nil {
+		emitErrorEvent(err)
+	}
+	return err
+}
+
+// interruptContext returns a context cancelled by SIGTERM, and by an
+// interrupt unless a session owns the terminal: Ctrl-C in a shell belongs to
+// the remote process, not to the kubectl calls following the target or
+// tailing its logs alongside the session
+func interruptContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(sigChan)
+		for {
+			select {
+			case sig := <-sigChan:
+				if sig == os.Interrupt && sessionActive.Load() {
+					continue
+				}
+				cancel()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ctx, cancel
 }
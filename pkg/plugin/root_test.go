@@ -0,0 +1,57 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestSubcommandFlagsMergeWithPersistentFlags(t *testing.T) {
+	var check func(cmd *cobra.Command)
+	check = func(cmd *cobra.Command) {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%s: merging the persistent flags panicked: %v", cmd.CommandPath(), r)
+				}
+			}()
+			// Merges the persistent flags of every parent into the command's
+			// flag set, which panics on a clashing shorthand such as -f
+			_ = cmd.InheritedFlags()
+			if cmd.HasParent() && cmd.Flags().Lookup("namespace") == nil {
+				t.Errorf("%s: --namespace was not inherited", cmd.CommandPath())
+			}
+		}()
+		for _, sub := range cmd.Commands() {
+			check(sub)
+		}
+	}
+	check(rootCmd)
+}
+
+func TestNamespaceResolvedLazily(t *testing.T) {
+	origRunner, oldNamespace, oldCommand := defaultRunner, namespace, historyCommand
+	defer func() {
+		defaultRunner, namespace, historyCommand = origRunner, oldNamespace, oldCommand
+		loadedConfig = nil
+	}()
+	runner := &fakeRunner{outputs: map[string]string{
+		"kubectl config view --minify -o jsonpath={..namespace}": "team-a",
+	}}
+	defaultRunner = runner
+	loadedConfig = &Config{OrphanSweep: &OrphanSweep{}}
+	namespace = ""
+
+	for _, cmd := range []*cobra.Command{completionCmd, historyCmd} {
+		if err := rootCmd.PersistentPreRunE(cmd, nil); err != nil {
+			t.Fatalf("%s: PersistentPreRunE() = %v", cmd.Name(), err)
+		}
+	}
+	if len(runner.calls) != 0 {
+		t.Errorf("commands without cluster access ran %v", runner.calls)
+	}
+
+	if config := NewDebugConfigFromFlags(); config.Namespace != "team-a" {
+		t.Errorf("NewDebugConfigFromFlags().Namespace = %q, want the context's team-a", config.Namespace)
+	}
+}
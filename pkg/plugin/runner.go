@@ -0,0 +1,145 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"time"
+)
+
+// IOStreams connects a command to its input and output; a nil In is empty
+// and nil writers discard
+type IOStreams struct {
+	In     io.Reader
+	Out    io.Writer
+	ErrOut io.Writer
+}
+
+// KubectlRunner runs the external commands kpdbug relies on: kubectl, the
+// cosign and trivy CLIs, stty and kpdbug itself. DebugConfig.Runner injects
+// one, so operations can be tested with a fake and other backends, such as
+// client-go, can replace the processes.
+type KubectlRunner interface {
+	// Run runs the command to completion and discards its output
+	Run(ctx context.Context, name string, args ...string) error
+	// Output runs the command and returns its stdout; a failed command's
+	// error carries its stderr and implements ExitCode() int
+	Output(ctx context.Context, name string, args ...string) ([]byte, error)
+	// Stream runs the command wired to streams until it ends; a cancelled
+	// ctx asks it to stop with SIGTERM
+	Stream(ctx context.Context, streams IOStreams, name string, args ...string) error
+}
+
+// streamStopGrace is how long a streaming command may take to exit after
+// SIGTERM before it is killed
+const streamStopGrace = 5 * time.Second
+
+// execRunner runs commands as local processes
+type execRunner struct{}
+
+func (execRunner) Run(ctx context.Context, name string, args ...string) error {
+	return exec.CommandContext(ctx, name, args...).Run()
+}
+
+func (execRunner) Output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).Output()
+}
+
+func (execRunner) Stream(ctx context.Context, streams IOStreams, name string, args ...string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = streams.In
+	cmd.Stdout = streams.Out
+	cmd.Stderr = streams.ErrOut
+	// Let kubectl restore the terminal and close port-forwards
+	cmd.Cancel = func() error {
+		return terminate(cmd.Process)
+	}
+	cmd.WaitDelay = streamStopGrace
+	return cmd.Run()
+}
+
+// defaultRunner runs the commands of configs without a Runner and of code
+// that has no DebugConfig at hand, such as completion
+var defaultRunner KubectlRunner = execRunner{}
+
+// runner returns the config's runner, or the default one
+func (config *DebugConfig) runner() KubectlRunner {
+	if config.Runner != nil {
+		return config.Runner
+	}
+	return defaultRunner
+}
+
+// runnerCommand is one invocation through a KubectlRunner. Like exec.Cmd,
+// its streams may be set before it is run; without streams Run and Output
+// use the runner's plain methods.
+type runnerCommand struct {
+	runner KubectlRunner
+	ctx    context.Context
+	name   string
+	Args   []string
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+func newRunnerCommand(ctx context.Context, runner KubectlRunner, name string, args ...string) *runnerCommand {
+	return &runnerCommand{runner: runner, ctx: ctx, name: name, Args: args}
+}
+
+// command builds an invocation of an external command bound to the
+// config's context
+func (config *DebugConfig) command(name string, args ...string) *runnerCommand {
+	return newRunnerCommand(config.context(), config.runner(), name, args...)
+}
+
+func (c *runnerCommand) streams() IOStreams {
+	return IOStreams{In: c.Stdin, Out: c.Stdout, ErrOut: c.Stderr}
+}
+
+// Run runs the command, writing to the streams that are set
+func (c *runnerCommand) Run() error {
+	if c.Stdin == nil && c.Stdout == nil && c.Stderr == nil {
+		return c.runner.Run(c.ctx, c.name, c.Args...)
+	}
+	return c.runner.Stream(c.ctx, c.streams(), c.name, c.Args...)
+}
+
+// Output runs the command and returns its stdout
+func (c *runnerCommand) Output() ([]byte, error) {
+	if c.Stdout != nil {
+		return nil, errors.New("runnerCommand: Stdout already set")
+	}
+	if c.Stdin == nil && c.Stderr == nil {
+		return c.runner.Output(c.ctx, c.name, c.Args...)
+	}
+	var stdout bytes.Buffer
+	streams := c.streams()
+	streams.Out = &stdout
+	err := c.runner.Stream(c.ctx, streams, c.name, c.Args...)
+	return stdout.Bytes(), err
+}
+
+// CombinedOutput runs the command and returns its stdout and stderr
+func (c *runnerCommand) CombinedOutput() ([]byte, error) {
+	if c.Stdout != nil || c.Stderr != nil {
+		return nil, errors.New("runnerCommand: Stdout or Stderr already set")
+	}
+	var output bytes.Buffer
+	streams := c.streams()
+	streams.Out = &output
+	streams.ErrOut = &output
+	err := c.runner.Stream(c.ctx, streams, c.name, c.Args...)
+	return output.Bytes(), err
+}
+
+// exitCode returns the exit code of a command that ran and failed
+func exitCode(err error) (int, bool) {
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,37 @@
+package plugin
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDebugConfigRunner(t *testing.T) {
+	runner := &fakeRunner{outputs: map[string]string{
+		"kubectl auth can-i create pods -n team-a":                                  "yes\n",
+		"kubectl get pod web -n team-a -o jsonpath={.spec.containers[0].name}":      "app\n",
+		"kubectl auth can-i patch pods --subresource=ephemeralcontainers -n team-a": "no\n",
+	}}
+	config := &DebugConfig{Namespace: "team-a", PodName: "web", Runner: runner}
+
+	if allowed, known := config.canI(accessCreatePods); !allowed || !known {
+		t.Errorf("canI(create pods) = %v, %v; want allowed", allowed, known)
+	}
+	if !config.denied(accessEphemeral) {
+		t.Error("denied(ephemeral) = false, want true")
+	}
+	if name, err := config.getTargetContainerName(); err != nil || name != "app" {
+		t.Errorf("getTargetContainerName() = %q, %v; want app", name, err)
+	}
+
+	cmd := config.kubectl("get", "pods")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if _, err := cmd.Output(); err == nil {
+		t.Error("Output() of an unknown command succeeded")
+	} else if code, ok := exitCode(err); !ok || code != 1 {
+		t.Errorf("exitCode(%v) = %d, %v; want 1", err, code, ok)
+	}
+	if len(runner.calls) != 4 {
+		t.Errorf("runner calls = %v, want 4", runner.calls)
+	}
+}
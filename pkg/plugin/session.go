@@ -0,0 +1,312 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// sessionActive is set while an interactive session owns the terminal, so
+// interrupts are left to the remote process instead of ending kpdbug
+var sessionActive atomic.Bool
+
+// runSession runs an interactive kubectl session (attach, exec or debug -it)
+// wired to the terminal. kubectl switches the terminal to raw mode and
+// forwards window size changes (SIGWINCH reaches it directly as part of the
+// foreground process group), so full-screen tools work as long as kpdbug
+// stays out of the way: the session is not bound to the cancellable context,
+// Ctrl-C goes to the remote process, SIGTERM is forwarded to kubectl and the
+// terminal modes are restored afterwards in case kubectl died while raw.
+// A session kubectl ends with a connection error returns a
+// *sessionLostError.
+func (config *DebugConfig) runSession(args ...string) error {
+	return config.runSessionTo(config.stdout(), args...)
+}
+
+// runSessionTo runs a session like runSession with its stdout going to
+// stdout
+func (config *DebugConfig) runSessionTo(stdout io.Writer, args ...string) error {
+	// Cancelling the session context sends SIGTERM to kubectl
+	ctx, cancel := context.WithCancel(config.cleanupContext())
+	defer cancel()
+	var stopped atomic.Bool
+	stop := func() {
+		stopped.Store(true)
+		cancel()
+	}
+	cmd := config.kubectlWithContext(ctx, args...)
+	cmd.Stdin = config.stdin()
+	cmd.Stdout = stdout
+	stderr := &tailBuffer{max: 4096}
+	cmd.Stderr = io.MultiWriter(config.stderr(), stderr)
+
+	if config.Stdin == nil {
+		restore := saveTerminalState()
+		defer restore()
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	sessionActive.Store(true)
+	defer sessionActive.Store(false)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-sigChan:
+				// The terminal already delivered Ctrl-C to kubectl's process group
+				if sig == syscall.SIGTERM {
+					stop()
+				}
+			case <-config.stopSession:
+				stop()
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Run()
+	if err != nil && !stopped.Load() {
+		if detail, rejected := credentialsRejected(stderr.String()); rejected {
+			return &sessionLostError{Detail: detail, Credentials: true}
+		}
+		if detail, lost := connectionLost(stderr.String()); lost {
+			return &sessionLostError{Detail: detail}
+		}
+	}
+	return err
+}
+
+// runPodSession runs an interactive session against pod, emitting the
+// attached and exited lifecycle events and session notifications around it,
+// recording it in the debug pod's annotations and following the target's
+// logs with --tail-target and saving the output of a --command with
+// --output-file. Interactive shells check the credentials first and are
+// reattached up to --attach-retries times when the connection drops or the
+// credentials expire. A session failing because its pod was evicted or
+// deleted returns a *podEvictedError.
+func (config *DebugConfig) runPodSession(pod string, args ...string) error {
+	if config.Interactive && config.TTY {
+		if err := config.checkCredentials(); err != nil {
+			return err
+		}
+	}
+	config.emitPodEvent(EventAttached, pod, "")
+	config.notifySession(NotifyStarted, pod, false)
+	detach := config.trackSession(pod)
+	stopTail := config.startTailTarget(pod)
+	stdout, closeOutput := config.sessionOutput(pod)
+	evicted := config.watchEviction(pod)
+	err := config.runSessionTo(stdout, args...)
+	closeOutput()
+	detached := errors.Is(err, errSessionDetached)
+	// A pod that went away cannot be reattached
+	if detached {
+		evicted(nil)
+	} else if gone := evicted(err); gone != nil {
+		err = gone
+	} else {
+		err = config.reattach(pod, args, err)
+	}
+	stopTail()
+	detach()
+	config.notifySession(NotifyEnded, pod, false)
+
+	if detached {
+		config.detachedPod = pod
+		retry := config.reattachArgs(pod, args)
+		if retry == nil {
+			retry = args
+		}
+		config.logf("Detached from %s, which keeps running; reattach with: %s", pod, displayKubectl(config.withKubectlFlags(retry)))
+		return nil
+	}
+
+	code, exited := exitCode(err)
+	if err != nil && !exited {
+		return err
+	}
+	emitEvent(Event{Type: EventExited, Pod: pod, Namespace: config.Namespace, ExitCode: &code})
+	return err
+}
+
+// connectionLostMarkers are kubectl errors of a session whose connection to
+// the API server or the kubelet broke, as opposed to the remote process ending
+var connectionLostMarkers = []string{
+	"connection reset by peer",
+	"broken pipe",
+	"i/o timeout",
+	"use of closed network connection",
+	"http2: client connection lost",
+	"unexpected EOF",
+	"error dialing backend",
+	"TLS handshake timeout",
+	"connection refused",
+	"Unable to connect to the server",
+}
+
+// credentialMarkers are kubectl errors of credentials the API server
+// rejected, typically an expired token of a kubeconfig exec plugin
+var credentialMarkers = []string{
+	"You must be logged in to the server",
+	"the server has asked for the client to provide credentials",
+	"getting credentials: exec",
+	"Unauthorized",
+}
+
+// sessionLostError reports a session that ended because its connection
+// broke or its credentials expired; the debug pod is still there and is not
+// cleaned up
+type sessionLostError struct {
+	// Detail is the kubectl error line naming the failure
+	Detail string
+	// Credentials is set when the API server rejected the credentials
+	Credentials bool
+}
+
+func (e *sessionLostError) Error() string {
+	if e.Credentials {
+		return "credentials of the session rejected: " + e.Detail
+	}
+	return "connection to the session lost: " + e.Detail
+}
+
+// isSessionLost reports whether err is a *sessionLostError
+func isSessionLost(err error) bool {
+	var lost *sessionLostError
+	return errors.As(err, &lost)
+}
+
+// connectionLost returns the last stderr line of kubectl reporting a
+// connection failure, if any
+func connectionLost(stderr string) (string, bool) {
+	return lastLineWith(stderr, connectionLostMarkers)
+}
+
+// credentialsRejected returns the last line of kubectl output reporting
+// rejected credentials, if any
+func credentialsRejected(output string) (string, bool) {
+	return lastLineWith(output, credentialMarkers)
+}
+
+// lastLineWith returns the last line of text containing one of markers
+func lastLineWith(text string, markers []string) (string, bool) {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		for _, marker := range markers {
+			if strings.Contains(lines[i], marker) {
+				return strings.TrimSpace(lines[i]), true
+			}
+		}
+	}
+	return "", false
+}
+
+// checkCredentials makes a cheap API request before an interactive session,
+// so a kubeconfig exec plugin whose token expired logs in again now, with
+// the terminal still in its normal mode, and credentials that cannot be
+// renewed fail with a clear error instead of a broken session
+func (config *DebugConfig) checkCredentials() error {
+	cmd := config.kubectl("get", "--raw", "/version")
+	// The exec plugin may prompt for the login
+	cmd.Stdin = config.stdin()
+	cmd.Stdout = io.Discard
+	stderr := &tailBuffer{max: 4096}
+	cmd.Stderr = io.MultiWriter(config.stderr(), stderr)
+	if err := cmd.Run(); err != nil {
+		if detail, rejected := credentialsRejected(stderr.String()); rejected {
+			return NewCredentialsError().WithOriginalError(errors.New(detail))
+		}
+	}
+	return nil
+}
+
+// reattach retries a session that err reports as lost with the arguments
+// reattachArgs returns, up to --attach-retries times with backoff, and
+// returns the error of the last attempt
+func (config *DebugConfig) reattach(pod string, args []string, err error) error {
+	retry := config.reattachArgs(pod, args)
+	for attempt := 0; isSessionLost(err); attempt++ {
+		if retry == nil || attempt >= config.AttachRetries {
+			if retry != nil {
+				config.logf("Warning: Giving up on the session; %s is kept, reattach with: kubectl %s", pod, strings.Join(retry, " "))
+			} else {
+				config.logf("Warning: The session cannot be resumed; %s is kept", pod)
+			}
+			return err
+		}
+
+		delay := backoffDelay(attempt)
+		var lost *sessionLostError
+		if errors.As(err, &lost) && lost.Credentials {
+			// Running kubectl again runs the exec plugin again
+			config.logf("Token expired, re-authenticating and reattaching (attempt %d/%d)...", attempt+1, config.AttachRetries)
+		} else {
+			config.logf("%v; reattaching in %s (attempt %d/%d)...", err, delay, attempt+1, config.AttachRetries)
+		}
+		select {
+		case <-config.context().Done():
+			return err
+		case <-config.stopSession:
+			return err
+		case <-time.After(delay):
+		}
+		err = config.runSession(retry...)
+	}
+	return err
+}
+
+// reattachArgs returns the kubectl arguments reconnecting to the session
+// args started in pod, or nil when it cannot be resumed: a --command would
+// run again, and debug containers have to be named to attach to them
+func (config *DebugConfig) reattachArgs(pod string, args []string) []string {
+	if config.Command != "" || !config.Interactive || !config.TTY || len(args) == 0 {
+		return nil
+	}
+	switch args[0] {
+	case "attach":
+		return args
+	case "exec":
+		// Only a plain shell can be replaced by a fresh one
+		if len(args) >= 2 && strings.Join(args[len(args)-2:], " ") == "-- sh" {
+			return args
+		}
+	case "debug":
+		for _, arg := range args {
+			if name, ok := strings.CutPrefix(arg, "--container="); ok {
+				return []string{"attach", "-it", pod, "-c", name, "-n", config.Namespace}
+			}
+		}
+	}
+	return nil
+}
+
+// tailBuffer keeps the last max bytes written to it
+type tailBuffer struct {
+	buf []byte
+	max int
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = t.buf[len(t.buf)-t.max:]
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	return string(t.buf)
+}
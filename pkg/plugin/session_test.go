@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// droppingRunner ends the first drops sessions with the error message, by
+// default a lost connection
+type droppingRunner struct {
+	fakeRunner
+	drops   int
+	message string
+	// rejected fails the credentials check
+	rejected bool
+}
+
+func (d *droppingRunner) Stream(ctx context.Context, streams IOStreams, name string, args ...string) error {
+	call := name + " " + strings.Join(args, " ")
+	d.record(call)
+	if d.rejected && call == "kubectl get --raw /version" {
+		fmt.Fprintln(streams.ErrOut, "error: You must be logged in to the server (Unauthorized)")
+		return &ExitCodeError{Code: 1}
+	}
+	if args[0] != "attach" && args[0] != "debug" && args[0] != "exec" {
+		return &ExitCodeError{Code: 1}
+	}
+	if d.drops > 0 {
+		d.drops--
+		message := d.message
+		if message == "" {
+			message = "error: unexpected EOF"
+		}
+		fmt.Fprintln(streams.ErrOut, message)
+		return &ExitCodeError{Code: 1}
+	}
+	return nil
+}
+
+func TestReattachLostSessions(t *testing.T) {
+	defer func(delay time.Duration) { retryBaseDelay = delay }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	debugArgs := []string{"debug", "web", "-n", "team-a", "--container=debugger-abcde", "-i", "-t", "--"}
+	reattachCall := "kubectl attach -it web -c debugger-abcde -n team-a"
+	tests := []struct {
+		name    string
+		drops   int
+		command string
+		want    []string
+		lost    bool
+	}{
+		{"intact", 0, "", []string{"kubectl " + strings.Join(debugArgs, " ")}, false},
+		{"reattached", 2, "", []string{"kubectl " + strings.Join(debugArgs, " "), reattachCall, reattachCall}, false},
+		{"gives up", 5, "", []string{"kubectl " + strings.Join(debugArgs, " "), reattachCall, reattachCall, reattachCall}, true},
+		{"command not rerun", 1, "hostname", []string{"kubectl " + strings.Join(debugArgs, " ")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &droppingRunner{drops: tt.drops}
+			config := &DebugConfig{Namespace: "team-a", PodName: "web", Interactive: true, TTY: true, Command: tt.command, AttachRetries: 3, Runner: runner}
+			err := config.runPodSession("web", debugArgs...)
+			if isSessionLost(err) != tt.lost {
+				t.Fatalf("runPodSession() = %v, want lost %v", err, tt.lost)
+			}
+			if !tt.lost && err != nil {
+				t.Fatalf("runPodSession() = %v", err)
+			}
+			var sessions []string
+			for _, call := range runner.calls {
+				if strings.HasPrefix(call, "kubectl attach ") || strings.HasPrefix(call, "kubectl debug ") {
+					sessions = append(sessions, call)
+				}
+			}
+			if strings.Join(sessions, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("sessions = %q, want %q", sessions, tt.want)
+			}
+		})
+	}
+
+	// Expired credentials are renewed by running kubectl again
+	runner := &droppingRunner{drops: 1, message: "error: You must be logged in to the server (the server has asked for the client to provide credentials)"}
+	config := &DebugConfig{Namespace: "team-a", Interactive: true, TTY: true, AttachRetries: 1, Runner: runner}
+	if err := config.runPodSession("web", debugArgs...); err != nil {
+		t.Errorf("runPodSession(expired token) = %v", err)
+	}
+	runner = &droppingRunner{drops: 5, message: "error: You must be logged in to the server (Unauthorized)"}
+	config.Runner = runner
+	err := wrapSessionError(config.runPodSession("web", debugArgs...), "attach")
+	if detailed, ok := err.(*DetailedError); !ok || detailed.Type != ErrorTypeCredentials {
+		t.Errorf("runPodSession(rejected token) = %v, want a credentials error", err)
+	}
+
+	// Credentials that cannot be renewed fail before the session
+	runner = &droppingRunner{rejected: true}
+	config.Runner = runner
+	err = wrapSessionError(config.runPodSession("web", debugArgs...), "attach")
+	if detailed, ok := err.(*DetailedError); !ok || detailed.Type != ErrorTypeCredentials {
+		t.Errorf("runPodSession(no credentials) = %v, want a credentials error", err)
+	}
+	if len(runner.calls) != 1 {
+		t.Errorf("ran %q, want only the credentials check", runner.calls)
+	}
+
+	// A remote shell exiting with an error is not a lost connection
+	if _, lost := connectionLost("command terminated with exit code 1\n"); lost {
+		t.Error("connectionLost(exit code) = true")
+	}
+	if detail, lost := connectionLost("Defaulting debug container name to debugger-1.\nerror: read tcp 10.0.0.1:51234->10.0.0.2:6443: read: connection reset by peer\n"); !lost || !strings.HasSuffix(detail, "connection reset by peer") {
+		t.Errorf("connectionLost(reset) = %q, %v", detail, lost)
+	}
+}
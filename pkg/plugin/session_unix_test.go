@@ -0,0 +1,108 @@
+//go:build !windows
+
+package plugin
+
+import (
+	"context"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInterruptDuringSession(t *testing.T) {
+	ctx, stop := interruptContext(context.Background())
+	defer stop()
+
+	// The fake shell echoes stdin until it is closed
+	origStdin := os.Stdin
+	defer func() { os.Stdin = origStdin }()
+	stdin, input, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = stdin.Close() }()
+	os.Stdin = stdin
+
+	config := &DebugConfig{
+		Namespace: "default",
+		Context:   ctx,
+		Runner:    fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}},
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- config.runSession("attach", "web-6d5f8b7c9-x2k4p", "-n", "default", "-it")
+	}()
+	for i := 0; !sessionActive.Load(); i++ {
+		if i > 200 {
+			t.Fatal("the session did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Ctrl-C in the shell belongs to the remote process
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatal("an interrupt during the session cancelled the context")
+	}
+	if err := input.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("runSession() error = %v", err)
+	}
+
+	// Outside a session it cancels the in-flight calls
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("an interrupt outside a session did not cancel the context")
+	}
+}
+
+func TestTerminateDuringSession(t *testing.T) {
+	// The fake shell would echo stdin until it is closed, which it never is
+	stdin, input, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = stdin.Close(); _ = input.Close() }()
+
+	config := &DebugConfig{
+		Namespace: "default",
+		Stdin:     stdin,
+		Stdout:    io.Discard,
+		Stderr:    io.Discard,
+		Runner:    fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}},
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- config.runSession("attach", "web-6d5f8b7c9-x2k4p", "-n", "default", "-it")
+	}()
+	for i := 0; !sessionActive.Load(); i++ {
+		if i > 200 {
+			t.Fatal("the session did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// SIGTERM, e.g. from a closing terminal emulator, is passed on to kubectl
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGTERM did not end the session")
+	}
+	if sessionActive.Load() {
+		t.Error("the session still owns the terminal")
+	}
+}
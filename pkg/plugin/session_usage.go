@@ -0,0 +1,159 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Annotations recording how a debug pod is used, shown by kpdbug list -o wide
+const (
+	attachCountAnnotation    = "debug-tool/attach-count"
+	lastAttachAnnotation     = "debug-tool/last-attach"
+	lastDetachAnnotation     = "debug-tool/last-detach"
+	sessionSecondsAnnotation = "debug-tool/session-seconds"
+)
+
+// sessionUsage is the usage of a debug pod recorded in its annotations
+type sessionUsage struct {
+	Attaches int
+	// Duration of the ended sessions
+	Ended      time.Duration
+	LastAttach time.Time
+	LastDetach time.Time
+}
+
+// parseSessionUsage reads the usage annotations; missing or invalid values
+// count as zero
+func parseSessionUsage(annotations map[string]string) sessionUsage {
+	var usage sessionUsage
+	usage.Attaches, _ = strconv.Atoi(annotations[attachCountAnnotation])
+	if seconds, err := strconv.ParseInt(annotations[sessionSecondsAnnotation], 10, 64); err == nil {
+		usage.Ended = time.Duration(seconds) * time.Second
+	}
+	usage.LastAttach, _ = time.Parse(time.RFC3339, annotations[lastAttachAnnotation])
+	usage.LastDetach, _ = time.Parse(time.RFC3339, annotations[lastDetachAnnotation])
+	return usage
+}
+
+// attached reports whether a session is open: the last attach is later than
+// the last detach
+func (u sessionUsage) attached() bool {
+	return !u.LastAttach.IsZero() && u.LastAttach.After(u.LastDetach)
+}
+
+// total is the time spent in sessions, including the open one
+func (u sessionUsage) total(now time.Time) time.Duration {
+	total := u.Ended
+	if u.attached() && now.After(u.LastAttach) {
+		total += now.Sub(u.LastAttach)
+	}
+	return total
+}
+
+// formatSessionTime renders a session duration in its two largest units,
+// e.g. 45s, 12m30s, 3h5m or 2d4h
+func formatSessionTime(d time.Duration) string {
+	d = d.Round(time.Second)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm%ds", int(d.Minutes()), int(d.Seconds())%60)
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh%dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dd%dh", int(d.Hours())/24, int(d.Hours())%24)
+}
+
+// trackSession records an attach to the debug pod in its annotations and
+// returns the function recording the detach. Sessions in a target pod, i.e.
+// ephemeral containers, are not recorded. The pod of a copy only exists
+// once kubectl debug created it, so the attach is recorded in the background
+// until the session ends; a pod that is gone by then is not recorded.
+func (config *DebugConfig) trackSession(pod string) func() {
+	if pod == config.PodName {
+		return func() {}
+	}
+
+	start := clock()
+	stop := make(chan struct{})
+	attached := make(chan bool, 1)
+	go func() {
+		// Errors are not logged over the session's terminal
+		recorded, _ := config.updateSessionUsage(pod, stop, func(annotations map[string]string, usage sessionUsage) {
+			annotations[attachCountAnnotation] = strconv.Itoa(usage.Attaches + 1)
+			annotations[lastAttachAnnotation] = start.UTC().Format(time.RFC3339)
+		})
+		attached <- recorded
+	}()
+
+	return func() {
+		close(stop)
+		if !<-attached {
+			return
+		}
+		end := clock()
+		_, err := config.updateSessionUsage(pod, nil, func(annotations map[string]string, usage sessionUsage) {
+			annotations[sessionSecondsAnnotation] = strconv.FormatInt(int64((usage.Ended + end.Sub(start)).Seconds()), 10)
+			annotations[lastDetachAnnotation] = end.UTC().Format(time.RFC3339)
+		})
+		if err != nil {
+			config.logf("Warning: Could not record the session in pod %s: %v", pod, err)
+		}
+	}
+}
+
+// updateSessionUsage patches the usage annotations of the pod and reports
+// whether it did. A missing pod is skipped, or polled for until stop is
+// closed when stop is not nil. The patch carries the resourceVersion it was
+// computed from, so concurrent sessions retry instead of losing an update.
+func (config *DebugConfig) updateSessionUsage(pod string, stop <-chan struct{}, update func(map[string]string, sessionUsage)) (bool, error) {
+	ctx := config.cleanupContext()
+	for i := 0; i < maxAttempts; i++ {
+		output, err := config.kubectlWithContext(ctx, "get", "pod", pod, "-n", config.Namespace,
+			"--ignore-not-found", "-o", "json").Output()
+		if err != nil {
+			return false, err
+		}
+		if len(strings.TrimSpace(string(output))) == 0 {
+			if stop == nil {
+				return false, nil
+			}
+			select {
+			case <-stop:
+				return false, nil
+			case <-time.After(sleepDuration):
+			}
+			continue
+		}
+
+		var current corev1.Pod
+		if err := json.Unmarshal(output, &current); err != nil {
+			return false, fmt.Errorf("error parsing pod JSON: %v", err)
+		}
+		annotations := map[string]string{}
+		update(annotations, parseSessionUsage(current.Annotations))
+		metadata := map[string]interface{}{"annotations": annotations}
+		if current.ResourceVersion != "" {
+			metadata["resourceVersion"] = current.ResourceVersion
+		}
+		patch, err := json.Marshal(map[string]interface{}{"metadata": metadata})
+		if err != nil {
+			return false, err
+		}
+		output, err = config.kubectlWithContext(ctx, "patch", "pod", pod, "-n", config.Namespace,
+			"--type=merge", "-p", string(patch)).CombinedOutput()
+		if err == nil {
+			return true, nil
+		}
+		if !strings.Contains(string(output), "Conflict") && !strings.Contains(string(output), "the object has been modified") {
+			return false, fmt.Errorf("%v - %s", err, strings.TrimSpace(string(output)))
+		}
+	}
+	return false, fmt.Errorf("pod %s kept changing while recording the session", pod)
+}
@@ -0,0 +1,94 @@
+package plugin
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSessionUsage(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	usage := parseSessionUsage(map[string]string{
+		attachCountAnnotation:    "3",
+		sessionSecondsAnnotation: "90",
+		lastAttachAnnotation:     start.Format(time.RFC3339),
+		lastDetachAnnotation:     start.Add(-time.Hour).Format(time.RFC3339),
+	})
+	if usage.Attaches != 3 || !usage.attached() {
+		t.Errorf("usage = %+v, want 3 attaches and an open session", usage)
+	}
+	if total := usage.total(start.Add(30 * time.Second)); total != 2*time.Minute {
+		t.Errorf("total = %s, want 2m0s", total)
+	}
+	if usage := parseSessionUsage(map[string]string{attachCountAnnotation: "x"}); usage.Attaches != 0 || usage.attached() {
+		t.Errorf("invalid annotations parsed as %+v", usage)
+	}
+
+	tests := []struct {
+		duration time.Duration
+		want     string
+	}{
+		{45 * time.Second, "45s"},
+		{12*time.Minute + 30*time.Second, "12m30s"},
+		{3*time.Hour + 5*time.Minute, "3h5m"},
+		{52 * time.Hour, "2d4h"},
+	}
+	for _, tt := range tests {
+		if got := formatSessionTime(tt.duration); got != tt.want {
+			t.Errorf("formatSessionTime(%s) = %q, want %q", tt.duration, got, tt.want)
+		}
+	}
+}
+
+func TestTrackSession(t *testing.T) {
+	defer func(c func() time.Time) { clock = c }(clock)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock = func() time.Time { return now }
+
+	cluster := newFakeCluster("")
+	cluster.storePod(&corev1.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{Name: "debug-session", Namespace: "default", Labels: map[string]string{"debug-tool/type": "debug-pod"}},
+		Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "debugger", Image: "busybox"}}},
+	})
+	config := &DebugConfig{
+		Namespace: "default",
+		Runner:    fakeClusterRunner{cluster: cluster, local: execRunner{}},
+	}
+
+	for _, session := range []time.Duration{time.Minute, 30 * time.Second} {
+		detach := config.trackSession("debug-session")
+		now = now.Add(session)
+		detach()
+	}
+
+	output, err := config.kubectl("get", "pod", "debug-session", "-n", "default", "-o", "json").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pod corev1.Pod
+	if err := json.Unmarshal(output, &pod); err != nil {
+		t.Fatal(err)
+	}
+	info := newDebugPodInfo(pod)
+	if info.Attaches != 2 || info.SessionSeconds != 90 || info.Attached {
+		t.Errorf("list info = %+v, want 2 attaches, 90s and no open session", info)
+	}
+
+	// A pod that is gone is skipped without waiting for it
+	begin := time.Now()
+	config.trackSession("debug-gone")()
+	if elapsed := time.Since(begin); elapsed > 5*time.Second {
+		t.Errorf("tracking a missing pod took %s", elapsed)
+	}
+
+	// Sessions in the target pod are not recorded
+	config.PodName = "web-6d5f8b7c9-x2k4p"
+	config.trackSession(config.PodName)()
+	if annotations := cluster.objects[objectKey("Pod", "default", config.PodName)]["metadata"].(map[string]interface{})["annotations"]; annotations != nil {
+		t.Errorf("target pod annotations = %v, want none", annotations)
+	}
+}
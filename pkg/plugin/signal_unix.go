@@ -0,0 +1,21 @@
+//go:build !windows
+
+package plugin
+
+import (
+	"os"
+	"syscall"
+)
+
+// terminate asks a process to exit with SIGTERM, giving it the chance to
+// clean up
+func terminate(process *os.Process) error {
+	return process.Signal(syscall.SIGTERM)
+}
+
+// processRunning reports whether a process with the pid exists; signal 0
+// only checks, and EPERM means it exists but belongs to another user
+func processRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,23 @@
+package plugin
+
+import (
+	"os"
+)
+
+// terminate ends a process. Windows has no SIGTERM and console control
+// events reach the whole console, kpdbug included, so the process is
+// killed; kubectl leaves nothing behind that outlives its connections.
+func terminate(process *os.Process) error {
+	return process.Kill()
+}
+
+// processRunning reports whether a process with the pid exists: finding a
+// process opens a handle to it, which fails once it exited
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = process.Release()
+	return true
+}
@@ -0,0 +1,144 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// shellProbe is the outcome of looking for a shell in the target container
+type shellProbe int
+
+const (
+	shellUnknown shellProbe = iota
+	shellPresent
+	shellMissing
+)
+
+// minEphemeralMinor is the first Kubernetes 1.x minor version with
+// ephemeral containers enabled by default
+const minEphemeralMinor = 23
+
+// selectStrategy picks how to reach the target pod when --copy was not
+// given. Ephemeral containers bring their own tools image, so they work for
+// distroless and scratch targets; when the cluster does not support them a
+// copy of the pod with the tools image is used instead. The choice and the
+// reason are logged. Unless --no-probe-shell is given, sh -c 'exit 0' is
+// first exec'd in the target container to report targets without a shell.
+func (config *DebugConfig) selectStrategy() {
+	if config.Operation != OperationAddContainer {
+		return
+	}
+
+	shell, containerName := shellUnknown, ""
+	if !config.SkipShellProbe {
+		var err error
+		if containerName, err = config.getTargetContainerName(); err == nil {
+			shell = config.probeTargetShell(containerName)
+		}
+	}
+	if shell == shellMissing {
+		config.logf("Target container %s has no shell (distroless or scratch image); tools come from the debug image %s", containerName, config.Image)
+	}
+
+	if supported, reason := config.ephemeralSupport(); !supported {
+		config.Operation = OperationCopyPod
+		config.logf("Strategy: pod copy with image %s, because %s", config.Image, reason)
+		return
+	}
+	if shell == shellMissing {
+		config.logf("Strategy: ephemeral container with image %s sharing the process namespace of %s", config.Image, containerName)
+	}
+}
+
+// ephemeralSubresource is the pods subresource kubectl debug patches
+const ephemeralSubresource = "pods/ephemeralcontainers"
+
+// ephemeralSupport reports whether the API server accepts ephemeral
+// containers, with the reason when it does not. The server version rules
+// out old clusters; discovery catches servers that report a recent version
+// but do not serve the subresource. Inconclusive checks assume support.
+func (config *DebugConfig) ephemeralSupport() (bool, string) {
+	if minor, ok := config.serverMinorVersion(); ok && minor < minEphemeralMinor {
+		return false, fmt.Sprintf("ephemeral containers are not supported by Kubernetes 1.%d", minor)
+	}
+
+	output, err := config.kubectl("get", "--raw", "/api/v1").Output()
+	if err != nil {
+		return true, ""
+	}
+	if served, ok := servesSubresource(output, ephemeralSubresource); ok && !served {
+		return false, fmt.Sprintf("the API server does not serve %s", ephemeralSubresource)
+	}
+	return true, ""
+}
+
+// servesSubresource looks name up in an APIResourceList discovery document
+func servesSubresource(data []byte, name string) (served, ok bool) {
+	var list metav1.APIResourceList
+	if err := json.Unmarshal(data, &list); err != nil || len(list.APIResources) == 0 {
+		return false, false
+	}
+	for _, r := range list.APIResources {
+		if r.Name == name {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+// probeTargetShell checks whether "sh" can be executed in the target container
+func (config *DebugConfig) probeTargetShell(containerName string) shellProbe {
+	cmd := config.kubectl("exec", config.PodName, "-n", config.Namespace, "-c", containerName, "--", "sh", "-c", "exit 0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	return classifyShellProbe(cmd.Run(), stderr.String())
+}
+
+// classifyShellProbe interprets the result of running sh in the target; the
+// runtimes report a missing binary with slightly different messages
+func classifyShellProbe(err error, stderr string) shellProbe {
+	if err == nil {
+		return shellPresent
+	}
+	lower := strings.ToLower(stderr)
+	for _, marker := range []string{"executable file not found", "no such file or directory", "exec: \"sh\"", "exit code 127"} {
+		if strings.Contains(lower, marker) {
+			return shellMissing
+		}
+	}
+	return shellUnknown
+}
+
+// serverMinorVersion returns the minor version of the Kubernetes API server
+func (config *DebugConfig) serverMinorVersion() (int, bool) {
+	output, err := config.kubectl("version", "-o", "json").Output()
+	if err != nil {
+		return 0, false
+	}
+	return parseServerMinor(output)
+}
+
+// parseServerMinor extracts serverVersion.minor from "kubectl version -o json";
+// providers append suffixes such as "27+"
+func parseServerMinor(data []byte) (int, bool) {
+	var version struct {
+		ServerVersion *struct {
+			Major string `json:"major"`
+			Minor string `json:"minor"`
+		} `json:"serverVersion"`
+	}
+	if err := json.Unmarshal(data, &version); err != nil || version.ServerVersion == nil || version.ServerVersion.Major != "1" {
+		return 0, false
+	}
+
+	minor, err := strconv.Atoi(strings.TrimRight(version.ServerVersion.Minor, "+"))
+	if err != nil {
+		return 0, false
+	}
+	return minor, true
+}
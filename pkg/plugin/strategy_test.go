@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestClassifyShellProbe(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		stderr string
+		want   shellProbe
+	}{
+		{"shell present", nil, "", shellPresent},
+		{"containerd", fmt.Errorf("exit status 1"), `OCI runtime exec failed: exec failed: unable to start container process: exec: "sh": executable file not found in $PATH: unknown`, shellMissing},
+		{"cri-o", fmt.Errorf("exit status 1"), "command terminated with exit code 127", shellMissing},
+		{"forbidden", fmt.Errorf("exit status 1"), `pods "web" is forbidden: User "dev" cannot create resource "pods/exec"`, shellUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyShellProbe(tt.err, tt.stderr); got != tt.want {
+				t.Errorf("classifyShellProbe() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseServerMinor(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   int
+		wantOK bool
+	}{
+		{`{"clientVersion":{"major":"1","minor":"33"},"serverVersion":{"major":"1","minor":"27+"}}`, 27, true},
+		{`{"clientVersion":{"major":"1","minor":"33"}}`, 0, false},
+		{`not json`, 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseServerMinor([]byte(tt.input))
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseServerMinor(%s) = %d, %v, want %d, %v", tt.input, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestServesSubresource(t *testing.T) {
+	tests := []struct {
+		input      string
+		wantServed bool
+		wantOK     bool
+	}{
+		{`{"kind":"APIResourceList","resources":[{"name":"pods","kind":"Pod"},{"name":"pods/ephemeralcontainers","kind":"Pod"}]}`, true, true},
+		{`{"kind":"APIResourceList","resources":[{"name":"pods","kind":"Pod"},{"name":"pods/exec","kind":"PodExecOptions"}]}`, false, true},
+		{`{"kind":"APIResourceList","resources":[]}`, false, false},
+		{`not json`, false, false},
+	}
+
+	for _, tt := range tests {
+		served, ok := servesSubresource([]byte(tt.input), ephemeralSubresource)
+		if served != tt.wantServed || ok != tt.wantOK {
+			t.Errorf("servesSubresource(%s) = %v, %v, want %v, %v", tt.input, served, ok, tt.wantServed, tt.wantOK)
+		}
+	}
+}
+
+func TestSelectStrategyProbesShellUnlessSkipped(t *testing.T) {
+	for _, skip := range []bool{false, true} {
+		runner := &fakeRunner{outputs: map[string]string{
+			"kubectl get pod web -n team-a -o jsonpath={.spec.containers[0].name}": "app\n",
+			"kubectl version -o json": `{"serverVersion": {"major": "1", "minor": "30"}}`,
+		}}
+		config := &DebugConfig{Namespace: "team-a", PodName: "web", Operation: OperationAddContainer, SkipShellProbe: skip, Runner: runner}
+		config.selectStrategy()
+
+		execs := 0
+		for _, call := range runner.calls {
+			if strings.HasPrefix(call, "kubectl exec ") {
+				execs++
+			}
+		}
+		if want := map[bool]int{false: 1, true: 0}[skip]; execs != want {
+			t.Errorf("selectStrategy(--no-probe-shell=%v) ran %d execs in the target, want %d: %v", skip, execs, want, runner.calls)
+		}
+		if config.Operation != OperationAddContainer {
+			t.Errorf("selectStrategy(--no-probe-shell=%v) operation = %v, want an ephemeral container", skip, config.Operation)
+		}
+	}
+}
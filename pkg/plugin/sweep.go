@@ -0,0 +1,99 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// OrphanSweep configures the startup check for forgotten debug pods
+type OrphanSweep struct {
+	// OlderThan is the age after which a debug pod is considered forgotten
+	OlderThan string `json:"olderThan,omitempty"`
+	// AutoClean deletes the forgotten pods instead of printing a reminder
+	AutoClean bool `json:"autoClean,omitempty"`
+}
+
+// orphanSweepTimeout bounds the startup check so it never delays commands
+const orphanSweepTimeout = 5 * time.Second
+
+// sweepOrphans looks for debug pods created by the current user that are
+// older than the configured threshold, and reminds about them or deletes
+// them. Every failure is silent: the sweep must never get in the way.
+func sweepOrphans(cmd *cobra.Command) {
+	sweep := currentConfig().OrphanSweep
+	if sweep == nil || unrecordedCommands[cmd.Name()] || cmd.Name() == "clean" {
+		return
+	}
+	threshold, err := time.ParseDuration(sweep.OlderThan)
+	if err != nil || threshold <= 0 {
+		threshold = 24 * time.Hour
+	}
+
+	ctx, cancel := context.WithTimeout(cmd.Context(), orphanSweepTimeout)
+	defer cancel()
+
+	user := (&DebugConfig{Context: ctx, users: flagUser}).currentUser()
+	if user == "" {
+		return
+	}
+	orphans := findOrphans(listSweepPods(ctx), user, threshold, clock())
+	if len(orphans) == 0 {
+		return
+	}
+
+	if sweep.AutoClean {
+		for _, pod := range orphans {
+			if kubectlCommand(ctx, "delete", "pod", pod.Name, "-n", pod.Namespace, "--wait=false").Run() == nil {
+				fmt.Fprintf(os.Stderr, "Deleted forgotten debug pod %s/%s (age %s)\n", pod.Namespace, pod.Name, pod.Age)
+			}
+		}
+		return
+	}
+
+	var names []string
+	for _, pod := range orphans {
+		names = append(names, fmt.Sprintf("%s/%s (%s)", pod.Namespace, pod.Name, pod.Age))
+	}
+	fmt.Fprintf(os.Stderr, "Reminder: you have %d debug pods older than %s: %s. Remove them with 'kpdbug clean'.\n",
+		len(orphans), threshold, strings.Join(names, ", "))
+}
+
+// listSweepPods lists debug pods across namespaces, falling back to the
+// current namespace when listing cluster-wide is not allowed
+func listSweepPods(ctx context.Context) []DebugPodInfo {
+	output, err := kubectlCommand(ctx, "get", "pods", "--all-namespaces", "-l", "debug-tool/type=debug-pod", "-o", "json").Output()
+	if err != nil {
+		output, err = kubectlCommand(ctx, "get", "pods", "-n", currentNamespace(ctx), "-l", "debug-tool/type=debug-pod", "-o", "json").Output()
+		if err != nil {
+			return nil
+		}
+	}
+
+	var podList corev1.PodList
+	if err := json.Unmarshal(output, &podList); err != nil {
+		return nil
+	}
+	var pods []DebugPodInfo
+	for _, pod := range podList.Items {
+		pods = append(pods, newDebugPodInfo(pod))
+	}
+	return pods
+}
+
+// findOrphans returns the pods created by user that are older than threshold
+func findOrphans(pods []DebugPodInfo, user string, threshold time.Duration, now time.Time) []DebugPodInfo {
+	var orphans []DebugPodInfo
+	for _, pod := range pods {
+		if pod.CreatedBy == user && now.Sub(pod.CreationTimestamp) > threshold {
+			orphans = append(orphans, pod)
+		}
+	}
+	return orphans
+}
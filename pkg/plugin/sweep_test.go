@@ -0,0 +1,21 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFindOrphans(t *testing.T) {
+	now := time.Now()
+	pods := []DebugPodInfo{
+		{Name: "old-mine", CreatedBy: "alice", CreationTimestamp: now.Add(-5 * time.Hour)},
+		{Name: "new-mine", CreatedBy: "alice", CreationTimestamp: now.Add(-time.Hour)},
+		{Name: "old-theirs", CreatedBy: "bob", CreationTimestamp: now.Add(-5 * time.Hour)},
+		{Name: "old-unknown", CreationTimestamp: now.Add(-5 * time.Hour)},
+	}
+
+	orphans := findOrphans(pods, "alice", 4*time.Hour, now)
+	if len(orphans) != 1 || orphans[0].Name != "old-mine" {
+		t.Errorf("findOrphans() = %+v, want only old-mine", orphans)
+	}
+}
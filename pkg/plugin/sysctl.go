@@ -0,0 +1,204 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var sysctlCompare []string
+
+var sysctlCmd = &cobra.Command{
+	Use:   "sysctl",
+	Short: "Show the network and kernel sysctls seen by the target pod",
+	Long: `Add an ephemeral debug container to the target pod and print the sysctls
+that commonly cause trouble: net.* values of the pod's network namespace and the
+node-wide vm.*, fs.* and kernel.* values. With --compare the same sysctls are
+read from other pods or nodes and listed side by side, marking differences.
+
+--compare takes node/<name>, pod/<name> or a bare name, which is looked up as a
+pod of the namespace first and as a node otherwise. Nodes are read from a
+host-network debug pod, so their net.* values are those of the host.`,
+	Example: `  kpdbug sysctl -p mypod
+  kpdbug sysctl -p mypod --compare node2
+  kpdbug sysctl -p mypod --compare pod/otherpod --compare node/worker-3`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runSysctl(cmd)
+	},
+}
+
+func init() {
+	sysctlCmd.Flags().StringSliceVar(&sysctlCompare, "compare", nil, "pods or nodes to compare against (node/<name>, pod/<name> or <name>)")
+	rootCmd.AddCommand(sysctlCmd)
+}
+
+// sysctlKeys are the sysctls reported, grouped by subsystem
+var sysctlKeys = []string{
+	"net.core.somaxconn",
+	"net.core.netdev_max_backlog",
+	"net.core.rmem_max",
+	"net.core.wmem_max",
+	"net.ipv4.ip_local_port_range",
+	"net.ipv4.ip_unprivileged_port_start",
+	"net.ipv4.ip_forward",
+	"net.ipv4.ping_group_range",
+	"net.ipv4.conf.all.rp_filter",
+	"net.ipv4.tcp_max_syn_backlog",
+	"net.ipv4.tcp_syncookies",
+	"net.ipv4.tcp_tw_reuse",
+	"net.ipv4.tcp_fin_timeout",
+	"net.ipv4.tcp_keepalive_time",
+	"net.ipv4.tcp_keepalive_intvl",
+	"net.ipv4.tcp_keepalive_probes",
+	"net.ipv4.tcp_rmem",
+	"net.ipv4.tcp_wmem",
+	"net.netfilter.nf_conntrack_max",
+	"vm.max_map_count",
+	"vm.swappiness",
+	"vm.overcommit_memory",
+	"vm.dirty_ratio",
+	"vm.dirty_background_ratio",
+	"fs.file-max",
+	"fs.inotify.max_user_watches",
+	"fs.inotify.max_user_instances",
+	"kernel.pid_max",
+}
+
+// sysctlScript prints one SYSCTL|<key>|<value> line per key, read from
+// /proc/sys with whitespace normalized; unreadable keys have an empty value
+func sysctlScript(keys []string) string {
+	return fmt.Sprintf(`for k in %s; do
+  v=$(tr -s '\t ' '  ' 2>/dev/null < "/proc/sys/$(echo "$k" | tr . /)")
+  echo "SYSCTL|$k|$v"
+done`, strings.Join(keys, " "))
+}
+
+// parseSysctls parses the SYSCTL lines printed by sysctlScript
+func parseSysctls(output string) map[string]string {
+	values := map[string]string{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.SplitN(strings.TrimRight(line, "\r"), "|", 3)
+		if len(fields) != 3 || fields[0] != "SYSCTL" {
+			continue
+		}
+		values[fields[1]] = strings.TrimSpace(fields[2])
+	}
+	return values
+}
+
+// sysctlTarget is a pod or node whose sysctls are read
+type sysctlTarget struct {
+	Kind string // "pod" or "node"
+	Name string
+}
+
+func (t sysctlTarget) String() string {
+	return t.Kind + "/" + t.Name
+}
+
+// parseSysctlTarget splits node/<name> and pod/<name>; bare names return an
+// empty kind and are resolved against the cluster
+func parseSysctlTarget(value string) sysctlTarget {
+	if kind, name, ok := strings.Cut(value, "/"); ok && (kind == "node" || kind == "pod") {
+		return sysctlTarget{Kind: kind, Name: name}
+	}
+	return sysctlTarget{Name: value}
+}
+
+// resolveSysctlTarget looks a bare name up as a pod of the namespace, then as a node
+func (config *DebugConfig) resolveSysctlTarget(target sysctlTarget) sysctlTarget {
+	if target.Kind != "" {
+		return target
+	}
+	if config.kubectl("get", "pod", target.Name, "-n", config.Namespace, "-o", "name").Run() == nil {
+		return sysctlTarget{Kind: "pod", Name: target.Name}
+	}
+	return sysctlTarget{Kind: "node", Name: target.Name}
+}
+
+// readSysctls reads the sysctls of a pod through an ephemeral container or
+// of a node through a host-network debug pod
+func (config *DebugConfig) readSysctls(target sysctlTarget) (map[string]string, error) {
+	script := sysctlScript(sysctlKeys)
+	var result *scriptResult
+	var err error
+	if target.Kind == "node" {
+		result, err = config.runNodeScript(target.Name, script)
+	} else {
+		result, err = config.runEphemeralScript(target.Name, script)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseSysctls(result.Output), nil
+}
+
+func runSysctl(cmd *cobra.Command) error {
+	config, err := newTargetConfig(cmd.Context(), cmd, "", "general")
+	if err != nil {
+		return err
+	}
+
+	targets := []sysctlTarget{{Kind: "pod", Name: config.PodName}}
+	for _, value := range sysctlCompare {
+		targets = append(targets, config.resolveSysctlTarget(parseSysctlTarget(value)))
+	}
+
+	var columns []map[string]string
+	for _, target := range targets {
+		log.Printf("Reading sysctls of %s...", target)
+		values, err := config.readSysctls(target)
+		if err != nil {
+			return err
+		}
+		columns = append(columns, values)
+	}
+
+	differences := printSysctlTable(targets, columns)
+	if len(targets) > 1 {
+		fmt.Printf("\n%d of %d sysctls differ\n", differences, len(sysctlKeys))
+	}
+	return nil
+}
+
+// printSysctlTable prints one row per key and one column per target, marking
+// rows whose values differ with "*"; it returns the number of such rows
+func printSysctlTable(targets []sysctlTarget, columns []map[string]string) int {
+	header := fmt.Sprintf("  %-38s", "SYSCTL")
+	for _, target := range targets {
+		header += fmt.Sprintf(" %-24s", truncateString(target.String(), 24))
+	}
+	fmt.Println(strings.TrimRight(header, " "))
+
+	differences := 0
+	for _, key := range sysctlKeys {
+		marker := " "
+		if sysctlDiffers(key, columns) {
+			marker = "*"
+			differences++
+		}
+		row := fmt.Sprintf("%s %-38s", marker, key)
+		for _, values := range columns {
+			value := values[key]
+			if value == "" {
+				value = "-"
+			}
+			row += fmt.Sprintf(" %-24s", value)
+		}
+		fmt.Println(strings.TrimRight(row, " "))
+	}
+	return differences
+}
+
+// sysctlDiffers reports whether key has different values across columns
+func sysctlDiffers(key string, columns []map[string]string) bool {
+	for _, values := range columns[1:] {
+		if values[key] != columns[0][key] {
+			return true
+		}
+	}
+	return false
+}
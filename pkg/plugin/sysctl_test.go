@@ -0,0 +1,50 @@
+package plugin
+
+import "testing"
+
+func TestParseSysctls(t *testing.T) {
+	output := "SYSCTL|net.core.somaxconn|4096\nSYSCTL|net.ipv4.ip_local_port_range|32768 60999\r\nSYSCTL|net.netfilter.nf_conntrack_max|\nnoise\n"
+	got := parseSysctls(output)
+	want := map[string]string{
+		"net.core.somaxconn":             "4096",
+		"net.ipv4.ip_local_port_range":   "32768 60999",
+		"net.netfilter.nf_conntrack_max": "",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parseSysctls() = %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("parseSysctls()[%s] = %q, want %q", key, got[key], value)
+		}
+	}
+}
+
+func TestParseSysctlTarget(t *testing.T) {
+	tests := []struct {
+		input string
+		want  sysctlTarget
+	}{
+		{"node/worker-2", sysctlTarget{Kind: "node", Name: "worker-2"}},
+		{"pod/web-1", sysctlTarget{Kind: "pod", Name: "web-1"}},
+		{"node2", sysctlTarget{Name: "node2"}},
+	}
+	for _, tt := range tests {
+		if got := parseSysctlTarget(tt.input); got != tt.want {
+			t.Errorf("parseSysctlTarget(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSysctlDiffers(t *testing.T) {
+	columns := []map[string]string{
+		{"net.core.somaxconn": "4096", "vm.swappiness": "60"},
+		{"net.core.somaxconn": "128", "vm.swappiness": "60"},
+	}
+	if !sysctlDiffers("net.core.somaxconn", columns) {
+		t.Error("sysctlDiffers(somaxconn) = false, want true")
+	}
+	if sysctlDiffers("vm.swappiness", columns) {
+		t.Error("sysctlDiffers(swappiness) = true, want false")
+	}
+}
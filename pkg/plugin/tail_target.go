@@ -0,0 +1,105 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// tailTargetLines is how much of the target's recent log is shown when the
+// session starts
+const tailTargetLines = "10"
+
+// prefixWriter writes each complete line to w behind a prefix. eol ends the
+// lines, "\r\n" while the terminal is in raw mode.
+type prefixWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	prefix string
+	eol    string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf = append(p.buf, data...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			return len(data), nil
+		}
+		line := bytes.TrimSuffix(p.buf[:i], []byte("\r"))
+		if _, err := fmt.Fprintf(p.w, "%s%s%s", p.prefix, line, p.eol); err != nil {
+			return len(data), err
+		}
+		p.buf = p.buf[i+1:]
+	}
+}
+
+// Flush writes a final line without newline
+func (p *prefixWriter) Flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.buf) > 0 {
+		fmt.Fprintf(p.w, "%s%s%s", p.prefix, p.buf, p.eol)
+		p.buf = nil
+	}
+}
+
+// tailTargetPod returns the pod whose application logs --tail-target
+// follows during a session in pod: the copy itself for copies, where the
+// application runs beside the debug container, none for job replays, and
+// otherwise the target
+func (config *DebugConfig) tailTargetPod(pod string) string {
+	switch config.Operation {
+	case OperationCopyPod:
+		return pod
+	case OperationReplayJob:
+		return ""
+	}
+	return config.PodName
+}
+
+// startTailTarget follows the target container's logs to stderr, each line
+// prefixed with pod/container, until the returned function is called. It is
+// a no-op without --tail-target or a target.
+func (config *DebugConfig) startTailTarget(pod string) func() {
+	logsPod := config.tailTargetPod(pod)
+	if !config.TailTarget || logsPod == "" {
+		return func() {}
+	}
+	container, err := config.getTargetContainerName()
+	if err != nil || container == "" {
+		config.logf("Warning: Could not follow the target's logs: %v", err)
+		return func() {}
+	}
+
+	eol := "\n"
+	if config.TTY {
+		eol = "\r\n"
+	}
+	out := &prefixWriter{w: config.stderr(), prefix: fmt.Sprintf("[%s/%s] ", logsPod, container), eol: eol}
+
+	ctx, cancel := context.WithCancel(config.context())
+	cmd := config.kubectlWithContext(ctx, "logs", "-f", logsPod, "-n", config.Namespace,
+		"-c", container, "--tail="+tailTargetLines)
+	cmd.Stdout = out
+	cmd.Stderr = out
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := cmd.Run(); err != nil && ctx.Err() == nil {
+			out.Flush()
+			config.logf("Warning: Stopped following the logs of %s/%s: %v", logsPod, container, err)
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+		out.Flush()
+	}
+}
@@ -0,0 +1,36 @@
+package plugin
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := &prefixWriter{w: &out, prefix: "[web/nginx] ", eol: "\r\n"}
+	fmt.Fprint(w, "GET / 200\nGET /hea")
+	fmt.Fprint(w, "lthz 200\r\npartial")
+	w.Flush()
+	want := "[web/nginx] GET / 200\r\n[web/nginx] GET /healthz 200\r\n[web/nginx] partial\r\n"
+	if out.String() != want {
+		t.Errorf("prefixWriter wrote %q, want %q", out.String(), want)
+	}
+}
+
+func TestTailTargetPod(t *testing.T) {
+	tests := []struct {
+		operation DebugOperation
+		want      string
+	}{
+		{OperationAddContainer, "web"},
+		{OperationCopyPod, "debug-web-copy"},
+		{OperationReplayJob, ""},
+	}
+	for _, tt := range tests {
+		config := &DebugConfig{PodName: "web", Operation: tt.operation}
+		if got := config.tailTargetPod("debug-web-copy"); got != tt.want {
+			t.Errorf("tailTargetPod(%v) = %q, want %q", tt.operation, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Controller kinds whose pods --pod can select as <kind>/<name>
+const (
+	ControllerDeployment  = "deployment"
+	ControllerReplicaSet  = "replicaset"
+	ControllerDaemonSet   = "daemonset"
+	ControllerStatefulSet = "statefulset"
+)
+
+// controllerKinds maps the resource names kubectl accepts to controller kinds
+var controllerKinds = map[string]string{
+	"deployment":       ControllerDeployment,
+	"deployments":      ControllerDeployment,
+	"deploy":           ControllerDeployment,
+	"deployment.apps":  ControllerDeployment,
+	"replicaset":       ControllerReplicaSet,
+	"replicasets":      ControllerReplicaSet,
+	"rs":               ControllerReplicaSet,
+	"replicaset.apps":  ControllerReplicaSet,
+	"daemonset":        ControllerDaemonSet,
+	"daemonsets":       ControllerDaemonSet,
+	"ds":               ControllerDaemonSet,
+	"daemonset.apps":   ControllerDaemonSet,
+	"statefulset":      ControllerStatefulSet,
+	"statefulsets":     ControllerStatefulSet,
+	"sts":              ControllerStatefulSet,
+	"statefulset.apps": ControllerStatefulSet,
+}
+
+// parseControllerTarget splits deployment/<name>, statefulset/<name>, ...
+// --pod values; other values return an empty kind
+func parseControllerTarget(value string) (kind, name string) {
+	prefix, rest, ok := strings.Cut(value, "/")
+	if !ok || rest == "" {
+		return "", value
+	}
+	if kind, known := controllerKinds[strings.ToLower(prefix)]; known {
+		return kind, rest
+	}
+	return "", value
+}
+
+// isSelectorTarget reports whether a --pod value is a label selector such
+// as app=web; pod names cannot contain '=' or '!'
+func isSelectorTarget(value string) bool {
+	return strings.ContainsAny(value, "=!")
+}
+
+// statefulSetPodName returns the pod of a StatefulSet with the ordinal, and
+// validates the ordinal against the StatefulSet's replicas
+func statefulSetPodName(sts *appsv1.StatefulSet, ordinal int) (string, error) {
+	replicas := 1
+	if sts.Spec.Replicas != nil {
+		replicas = int(*sts.Spec.Replicas)
+	}
+	start := 0
+	if sts.Spec.Ordinals != nil {
+		start = int(sts.Spec.Ordinals.Start)
+	}
+	if replicas == 0 {
+		return "", NewDetailedError(ErrorTypePodNotFound,
+			fmt.Sprintf("statefulset %s is scaled to 0 replicas", sts.Name)).
+			WithCommand(fmt.Sprintf("kubectl scale statefulset %s -n %s --replicas=1", sts.Name, sts.Namespace))
+	}
+	if ordinal < start || ordinal >= start+replicas {
+		return "", NewValidationError("ordinal", fmt.Sprint(ordinal),
+			fmt.Sprintf("statefulset %s has ordinals %d to %d", sts.Name, start, start+replicas-1))
+	}
+	return fmt.Sprintf("%s-%d", sts.Name, ordinal), nil
+}
+
+// getController fetches a controller and decodes it into obj
+func (config *DebugConfig) getController(kind, name string, obj interface{}) error {
+	output, err := outputWithRetry(config.context(), func() *runnerCommand {
+		return config.kubectl("get", kind, name, "-n", config.Namespace, "-o", "json")
+	})
+	if err != nil {
+		return NewDetailedError(ErrorTypePodNotFound,
+			fmt.Sprintf("%s %s not found in namespace %s", kind, name, config.Namespace)).
+			WithCommand(fmt.Sprintf("kubectl get %ss -n %s", kind, config.Namespace)).
+			WithOriginalError(err)
+	}
+	if err := json.Unmarshal(output, obj); err != nil {
+		return fmt.Errorf("error parsing %s JSON: %v", kind, err)
+	}
+	return nil
+}
+
+// resolveTarget replaces a controller or label selector target with one of
+// its running pods: the one on --on-node, the --ordinal of a StatefulSet
+// (by default the first) or the first by name. Plain pod names are kept.
+func (config *DebugConfig) resolveTarget() error {
+	kind, name := parseControllerTarget(config.PodName)
+	selector := ""
+	if kind == "" && isSelectorTarget(config.PodName) {
+		selector = config.PodName
+	}
+
+	switch {
+	case config.Ordinal != nil && kind != ControllerStatefulSet:
+		return NewValidationError("ordinal", fmt.Sprint(*config.Ordinal), "--ordinal requires a -p statefulset/<name> target")
+	case config.Ordinal != nil && config.OnNode != "":
+		return NewValidationError("on-node", config.OnNode, "--on-node and --ordinal both select the replica").
+			WithSuggestion("Use one of them")
+	case kind == "" && selector == "" && config.OnNode != "":
+		return NewValidationError("on-node", config.OnNode, "--on-node requires a workload or label selector target").
+			WithSuggestion("Use e.g. -p deployment/<name> or -p app=<name>")
+	case kind == "" && selector == "":
+		return nil
+	case kind == ControllerStatefulSet && config.OnNode == "":
+		return config.resolveStatefulSetPod(name)
+	}
+
+	target := config.PodName
+	if kind != "" {
+		var controller struct {
+			Spec struct {
+				Selector *metav1.LabelSelector `json:"selector"`
+			} `json:"spec"`
+		}
+		if err := config.getController(kind, name, &controller); err != nil {
+			return err
+		}
+		labelSelector, err := metav1.LabelSelectorAsSelector(controller.Spec.Selector)
+		if err != nil || labelSelector.Empty() {
+			return NewValidationError("pod", target, fmt.Sprintf("%s %s has no usable pod selector", kind, name))
+		}
+		selector = labelSelector.String()
+	}
+
+	pod, err := config.pickTargetPod(target, selector)
+	if err != nil {
+		return err
+	}
+	config.PodName = pod
+	return nil
+}
+
+// resolveStatefulSetPod targets the StatefulSet's pod with the ordinal,
+// after checking that the pod exists
+func (config *DebugConfig) resolveStatefulSetPod(name string) error {
+	var sts appsv1.StatefulSet
+	if err := config.getController(ControllerStatefulSet, name, &sts); err != nil {
+		return err
+	}
+
+	ordinal := 0
+	if sts.Spec.Ordinals != nil {
+		ordinal = int(sts.Spec.Ordinals.Start)
+	}
+	if config.Ordinal != nil {
+		ordinal = *config.Ordinal
+	}
+	pod, err := statefulSetPodName(&sts, ordinal)
+	if err != nil {
+		return err
+	}
+	if config.kubectl("get", "pod", pod, "-n", config.Namespace, "-o", "name").Run() != nil {
+		return NewDetailedError(ErrorTypePodNotFound,
+			fmt.Sprintf("pod %s of statefulset %s does not exist in namespace %s", pod, name, config.Namespace)).
+			WithSuggestion("The replica may not be created yet; StatefulSets start their pods in order").
+			WithCommand(fmt.Sprintf("kubectl rollout status statefulset/%s -n %s", name, config.Namespace))
+	}
+
+	if sts.Spec.ServiceName != "" {
+		config.logf("Resolved statefulset/%s ordinal %d to pod %s (%s.%s.%s.svc)", name, ordinal, pod, pod, sts.Spec.ServiceName, config.Namespace)
+	} else {
+		config.logf("Resolved statefulset/%s ordinal %d to pod %s", name, ordinal, pod)
+	}
+	config.PodName = pod
+	return nil
+}
+
+// selectTargetPod picks the first running pod by name, on the node when
+// one is given; without a match it returns the nodes the running pods are on
+func selectTargetPod(pods []corev1.Pod, node string) (string, []string) {
+	var names []string
+	nodes := map[string]bool{}
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+			continue
+		}
+		nodes[pod.Spec.NodeName] = true
+		if node == "" || pod.Spec.NodeName == node {
+			names = append(names, pod.Name)
+		}
+	}
+	if len(names) > 0 {
+		sort.Strings(names)
+		return names[0], nil
+	}
+
+	var running []string
+	for name := range nodes {
+		running = append(running, name)
+	}
+	sort.Strings(running)
+	return "", running
+}
+
+// pickTargetPod targets a running pod matching the selector, on --on-node
+// when set
+func (config *DebugConfig) pickTargetPod(target, selector string) (string, error) {
+	output, err := outputWithRetry(config.context(), func() *runnerCommand {
+		return config.kubectl("get", "pods", "-n", config.Namespace, "-l", selector, "-o", "json")
+	})
+	if err != nil {
+		return "", WrapKubectlError(err, "list pods of "+target)
+	}
+	var podList corev1.PodList
+	if err := json.Unmarshal(output, &podList); err != nil {
+		return "", fmt.Errorf("error parsing pod list: %v", err)
+	}
+
+	pod, nodes := selectTargetPod(podList.Items, config.OnNode)
+	if pod != "" {
+		if config.OnNode != "" {
+			config.logf("Resolved %s to pod %s on node %s", target, pod, config.OnNode)
+		} else {
+			config.logf("Resolved %s to pod %s", target, pod)
+		}
+		return pod, nil
+	}
+
+	message := fmt.Sprintf("no running pod of %s in namespace %s", target, config.Namespace)
+	if config.OnNode != "" {
+		message = fmt.Sprintf("no running pod of %s on node %s", target, config.OnNode)
+	}
+	detailed := NewDetailedError(ErrorTypePodNotFound, message).
+		WithCommand(fmt.Sprintf("kubectl get pods -n %s -l %q -o wide", config.Namespace, selector))
+	if len(nodes) > 0 {
+		detailed = detailed.WithSuggestion("Its pods run on: " + strings.Join(nodes, ", "))
+	}
+	return "", detailed
+}
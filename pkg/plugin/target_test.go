@@ -0,0 +1,102 @@
+package plugin
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+)
+
+func TestResolveStatefulSetTarget(t *testing.T) {
+	newConfig := func(target string, ordinal *int) *DebugConfig {
+		return &DebugConfig{
+			Namespace: "default",
+			PodName:   target,
+			Ordinal:   ordinal,
+			Runner:    fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}},
+		}
+	}
+
+	tests := []struct {
+		target  string
+		ordinal *int
+		want    string
+	}{
+		{"statefulset/db", ptr.To(1), "db-1"},
+		{"sts/db", nil, "db-0"},
+		{"web-6d5f8b7c9-x2k4p", nil, "web-6d5f8b7c9-x2k4p"},
+	}
+	for _, tt := range tests {
+		config := newConfig(tt.target, tt.ordinal)
+		if err := config.resolveTarget(); err != nil || config.PodName != tt.want {
+			t.Errorf("resolveTarget(%s) = %s, %v; want %s", tt.target, config.PodName, err, tt.want)
+		}
+	}
+
+	for _, config := range []*DebugConfig{
+		newConfig("statefulset/db", ptr.To(2)),
+		newConfig("statefulset/cache", nil),
+		newConfig("web-6d5f8b7c9-x2k4p", ptr.To(0)),
+	} {
+		if err := config.resolveTarget(); err == nil {
+			t.Errorf("resolveTarget(%s) succeeded", config.PodName)
+		}
+	}
+}
+
+func TestSelectTargetPod(t *testing.T) {
+	pod := func(name, node string, phase corev1.PodPhase) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       corev1.PodSpec{NodeName: node},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+	}
+	pods := []corev1.Pod{
+		pod("web-c", "node-2", corev1.PodRunning),
+		pod("web-b", "node-3", corev1.PodPending),
+		pod("web-a", "node-1", corev1.PodRunning),
+	}
+	if got, _ := selectTargetPod(pods, ""); got != "web-a" {
+		t.Errorf("selectTargetPod() = %s, want web-a", got)
+	}
+	if got, _ := selectTargetPod(pods, "node-2"); got != "web-c" {
+		t.Errorf("selectTargetPod(node-2) = %s, want web-c", got)
+	}
+	got, nodes := selectTargetPod(pods, "node-3")
+	if got != "" || !reflect.DeepEqual(nodes, []string{"node-1", "node-2"}) {
+		t.Errorf("selectTargetPod(node-3) = %q, %v; want no pod and the nodes running replicas", got, nodes)
+	}
+}
+
+func TestResolveTargetOnNode(t *testing.T) {
+	newConfig := func(target, node string) *DebugConfig {
+		return &DebugConfig{
+			Namespace: "default",
+			PodName:   target,
+			OnNode:    node,
+			Runner:    fakeClusterRunner{cluster: newFakeCluster(""), local: execRunner{}},
+		}
+	}
+	for _, target := range []string{"deployment/web", "app=web"} {
+		config := newConfig(target, fakeNode)
+		if err := config.resolveTarget(); err != nil || config.PodName != "web-6d5f8b7c9-x2k4p" {
+			t.Errorf("resolveTarget(%s --on-node %s) = %s, %v", target, fakeNode, config.PodName, err)
+		}
+	}
+	if config := newConfig("statefulset/db", fakeNode); config.resolveTarget() != nil || config.PodName != "db-0" {
+		t.Errorf("resolveTarget(statefulset/db --on-node) = %s", config.PodName)
+	}
+
+	err := newConfig("deployment/web", "node-9").resolveTarget()
+	detailed, ok := err.(*DetailedError)
+	if !ok || !strings.Contains(detailed.Suggestion, fakeNode) {
+		t.Errorf("resolveTarget(--on-node node-9) = %v, want an error naming %s", err, fakeNode)
+	}
+	if err := newConfig("web-6d5f8b7c9-x2k4p", fakeNode).resolveTarget(); err == nil {
+		t.Error("resolveTarget(pod --on-node) succeeded")
+	}
+}
@@ -0,0 +1,56 @@
+//go:build !windows
+
+package plugin
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// saveTerminalState records the stdin terminal modes and returns a function
+// restoring them; it is a no-op when stdin is not a terminal or stty is missing
+func saveTerminalState() func() {
+	if !isTerminal(os.Stdin) {
+		return func() {}
+	}
+
+	get := newRunnerCommand(context.Background(), defaultRunner, "stty", "-g")
+	get.Stdin = os.Stdin
+	output, err := get.Output()
+	if err != nil {
+		return func() {}
+	}
+	state := strings.TrimSpace(string(output))
+
+	return func() {
+		set := newRunnerCommand(context.Background(), defaultRunner, "stty", state)
+		set.Stdin = os.Stdin
+		_ = set.Run()
+	}
+}
+
+// terminalResizes reports the window size changes of the terminal, as
+// SIGWINCH, until ctx is done
+func terminalResizes(ctx context.Context) <-chan struct{} {
+	resized := make(chan struct{}, 1)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGWINCH)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				select {
+				case resized <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return resized
+}
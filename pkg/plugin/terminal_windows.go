@@ -0,0 +1,57 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+)
+
+var setConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+
+// saveTerminalState records the console mode of stdin and returns a function
+// restoring it, since a kubectl that was killed leaves the console raw; it
+// is a no-op when stdin is not a console
+func saveTerminalState() func() {
+	handle := syscall.Handle(os.Stdin.Fd())
+	var mode uint32
+	if err := syscall.GetConsoleMode(handle, &mode); err != nil {
+		return func() {}
+	}
+
+	return func() {
+		_, _, _ = setConsoleMode.Call(uintptr(handle), uintptr(mode))
+	}
+}
+
+// terminalResizeInterval is how often the console size is compared, as
+// Windows has no resize signal
+const terminalResizeInterval = 250 * time.Millisecond
+
+// terminalResizes reports the size changes of the console until ctx is done
+func terminalResizes(ctx context.Context) <-chan struct{} {
+	resized := make(chan struct{}, 1)
+	go func() {
+		ticker := time.NewTicker(terminalResizeInterval)
+		defer ticker.Stop()
+		fd := int(os.Stdout.Fd())
+		width, height, _ := term.GetSize(fd)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if w, h, err := term.GetSize(fd); err == nil && (w != width || h != height) {
+				width, height = w, h
+				select {
+				case resized <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return resized
+}
@@ -0,0 +1,272 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var topDetailed bool
+
+var topCmd = &cobra.Command{
+	Use:   "top",
+	Short: "Show resource usage of the target pod, with cgroup details",
+	Long: `Show the resource usage of the target pod as reported by kubectl top. With
+--detailed, a debug pod on the target's node reads the cgroup (v1 or v2) of the
+target container and reports CPU throttling against its quota, memory usage
+against its limit, OOM kills and pressure stall information (PSI).`,
+	Example: `  kpdbug top -p mypod
+  kpdbug top -p mypod -c app --detailed`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runTop(cmd)
+	},
+}
+
+func init() {
+	topCmd.Flags().BoolVar(&topDetailed, "detailed", false, "read the target container's cgroup for throttling, memory and pressure stats")
+	rootCmd.AddCommand(topCmd)
+}
+
+// cgroupScript prints "### <file>" sections with the cgroup files of the
+// container whose runtime ID is id, read from the host cgroup hierarchy
+const cgroupScript = `base=/host/sys/fs/cgroup
+id=%s
+if [ -f "$base/cgroup.controllers" ]; then
+  echo "### version"; echo v2
+  dir=$(find "$base/" -path "*kubepods*" -type d -name "*$id*" 2>/dev/null | head -n 1)
+  if [ -z "$dir" ]; then echo "### error"; echo "cgroup of container $id not found"; exit 0; fi
+  for f in cpu.max cpu.stat memory.current memory.max memory.events cpu.pressure memory.pressure io.pressure; do
+    echo "### $f"; cat "$dir/$f" 2>/dev/null
+  done
+else
+  echo "### version"; echo v1
+  cpu=$(find "$base/cpu,cpuacct/" "$base/cpu/" -path "*kubepods*" -type d -name "*$id*" 2>/dev/null | head -n 1)
+  mem=$(find "$base/memory/" -path "*kubepods*" -type d -name "*$id*" 2>/dev/null | head -n 1)
+  if [ -z "$cpu$mem" ]; then echo "### error"; echo "cgroup of container $id not found"; exit 0; fi
+  for f in cpu.cfs_quota_us cpu.cfs_period_us cpu.stat cpuacct.usage; do
+    echo "### $f"; cat "$cpu/$f" 2>/dev/null
+  done
+  for f in memory.usage_in_bytes memory.limit_in_bytes memory.oom_control; do
+    echo "### $f"; cat "$mem/$f" 2>/dev/null
+  done
+fi`
+
+// pressure is one PSI line: the share of time some or all tasks stalled,
+// averaged over 10s, 60s and 300s
+type pressure struct {
+	Avg10, Avg60, Avg300 float64
+}
+
+// cgroupStats are the normalized cgroup v1/v2 statistics of a container
+type cgroupStats struct {
+	Version       string
+	CPUQuota      float64 // cores; 0 means unlimited
+	CPUUsage      time.Duration
+	Periods       int64
+	Throttled     int64
+	ThrottledTime time.Duration
+	MemoryCurrent int64
+	MemoryLimit   int64 // bytes; 0 means unlimited
+	OOMKills      int64
+	// Pressure holds the "some" and "full" lines per resource, e.g. "memory full"
+	Pressure map[string]pressure
+}
+
+// unlimitedMemory is the smallest v1 memory.limit_in_bytes meaning no limit
+const unlimitedMemory = int64(1) << 62
+
+// keyValues parses "key value" lines such as cpu.stat or memory.events
+func keyValues(lines []string) map[string]int64 {
+	values := map[string]int64{}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if value, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			values[fields[0]] = value
+		}
+	}
+	return values
+}
+
+// firstInt parses the first line of a single-value cgroup file
+func firstInt(lines []string) int64 {
+	if len(lines) == 0 {
+		return 0
+	}
+	value, _ := strconv.ParseInt(strings.TrimSpace(lines[0]), 10, 64)
+	return value
+}
+
+// parsePressure parses PSI lines like "some avg10=1.20 avg60=0.50 avg300=0.10 total=123"
+func parsePressure(resource string, lines []string, into map[string]pressure) {
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		var p pressure
+		for _, field := range fields[1:] {
+			key, value, _ := strings.Cut(field, "=")
+			number, _ := strconv.ParseFloat(value, 64)
+			switch key {
+			case "avg10":
+				p.Avg10 = number
+			case "avg60":
+				p.Avg60 = number
+			case "avg300":
+				p.Avg300 = number
+			}
+		}
+		into[resource+" "+fields[0]] = p
+	}
+}
+
+// parseCgroupStats normalizes the sections printed by cgroupScript
+func parseCgroupStats(sections map[string][]string) (*cgroupStats, error) {
+	if msg := sections["error"]; len(msg) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(msg, " "))
+	}
+	if len(sections["version"]) == 0 {
+		return nil, fmt.Errorf("no cgroup information reported")
+	}
+
+	stats := &cgroupStats{Version: strings.TrimSpace(sections["version"][0]), Pressure: map[string]pressure{}}
+	if stats.Version == "v2" {
+		if fields := strings.Fields(strings.Join(sections["cpu.max"], " ")); len(fields) == 2 && fields[0] != "max" {
+			quota, _ := strconv.ParseFloat(fields[0], 64)
+			period, _ := strconv.ParseFloat(fields[1], 64)
+			if period > 0 {
+				stats.CPUQuota = quota / period
+			}
+		}
+		cpu := keyValues(sections["cpu.stat"])
+		stats.CPUUsage = time.Duration(cpu["usage_usec"]) * time.Microsecond
+		stats.Periods = cpu["nr_periods"]
+		stats.Throttled = cpu["nr_throttled"]
+		stats.ThrottledTime = time.Duration(cpu["throttled_usec"]) * time.Microsecond
+		stats.MemoryCurrent = firstInt(sections["memory.current"])
+		stats.MemoryLimit = firstInt(sections["memory.max"]) // "max" parses as 0
+		stats.OOMKills = keyValues(sections["memory.events"])["oom_kill"]
+		for _, resource := range []string{"cpu", "memory", "io"} {
+			parsePressure(resource, sections[resource+".pressure"], stats.Pressure)
+		}
+		return stats, nil
+	}
+
+	if quota, period := firstInt(sections["cpu.cfs_quota_us"]), firstInt(sections["cpu.cfs_period_us"]); quota > 0 && period > 0 {
+		stats.CPUQuota = float64(quota) / float64(period)
+	}
+	cpu := keyValues(sections["cpu.stat"])
+	stats.CPUUsage = time.Duration(firstInt(sections["cpuacct.usage"]))
+	stats.Periods = cpu["nr_periods"]
+	stats.Throttled = cpu["nr_throttled"]
+	stats.ThrottledTime = time.Duration(cpu["throttled_time"])
+	stats.MemoryCurrent = firstInt(sections["memory.usage_in_bytes"])
+	if limit := firstInt(sections["memory.limit_in_bytes"]); limit < unlimitedMemory {
+		stats.MemoryLimit = limit
+	}
+	stats.OOMKills = keyValues(sections["memory.oom_control"])["oom_kill"]
+	return stats, nil
+}
+
+// containerRuntimeID returns the runtime ID of a container of the pod
+func containerRuntimeID(pod *corev1.Pod, container string) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == container {
+			return runtimeID(status.ContainerID)
+		}
+	}
+	return ""
+}
+
+func runTop(cmd *cobra.Command) error {
+	config, err := newTargetConfig(cmd.Context(), cmd, "", "")
+	if err != nil {
+		return err
+	}
+
+	top := config.kubectl("top", "pod", config.PodName, "-n", config.Namespace, "--containers")
+	top.Stdout = os.Stdout
+	top.Stderr = os.Stderr
+	if err := top.Run(); err != nil {
+		log.Printf("Warning: kubectl top failed (is metrics-server installed?): %v", err)
+	}
+	if !topDetailed {
+		return nil
+	}
+
+	pod, err := config.getPod(config.PodName, config.Namespace)
+	if err != nil {
+		return NewPodNotFoundError(config.PodName, config.Namespace).WithOriginalError(err)
+	}
+	containerName, err := config.getTargetContainerName()
+	if err != nil {
+		return WrapKubectlError(err, "get target container name")
+	}
+	id := containerRuntimeID(pod, containerName)
+	if id == "" || pod.Spec.NodeName == "" {
+		return NewDetailedError(ErrorTypeValidation,
+			fmt.Sprintf("Container %s of pod %s is not running", containerName, config.PodName))
+	}
+
+	log.Printf("Reading cgroup of container %s on node %s...", containerName, pod.Spec.NodeName)
+	result, err := config.runNodeScript(pod.Spec.NodeName, fmt.Sprintf(cgroupScript, shellQuote(id)))
+	if err != nil {
+		return err
+	}
+	stats, err := parseCgroupStats(splitSections(result.Output))
+	if err != nil {
+		return NewDetailedError(ErrorTypeKubectl, fmt.Sprintf("Could not read the cgroup of container %s", containerName)).
+			WithOriginalError(err)
+	}
+
+	fmt.Println()
+	printCgroupReport(containerName, stats)
+	return nil
+}
+
+// printCgroupReport renders the throttling and memory pressure report
+func printCgroupReport(container string, stats *cgroupStats) {
+	fmt.Printf("Container %s (cgroup %s)\n", container, stats.Version)
+
+	quota := "unlimited"
+	if stats.CPUQuota > 0 {
+		quota = fmt.Sprintf("%.2f cores", stats.CPUQuota)
+	}
+	fmt.Printf("  CPU quota:        %s, %s used in total\n", quota, stats.CPUUsage.Round(time.Millisecond))
+	if stats.Periods > 0 {
+		fmt.Printf("  CPU throttling:   %d of %d periods (%.1f%%), %s throttled\n",
+			stats.Throttled, stats.Periods, float64(stats.Throttled)*100/float64(stats.Periods), stats.ThrottledTime.Round(time.Millisecond))
+	} else {
+		fmt.Printf("  CPU throttling:   none recorded\n")
+	}
+
+	memory := formatKB(stats.MemoryCurrent / 1024)
+	if stats.MemoryLimit > 0 {
+		memory += fmt.Sprintf(" of %s (%.1f%%)", formatKB(stats.MemoryLimit/1024), float64(stats.MemoryCurrent)*100/float64(stats.MemoryLimit))
+	} else {
+		memory += " (no limit)"
+	}
+	fmt.Printf("  Memory:           %s\n", memory)
+	fmt.Printf("  OOM kills:        %d\n", stats.OOMKills)
+
+	if len(stats.Pressure) == 0 {
+		fmt.Printf("  Pressure (PSI):   not available\n")
+		return
+	}
+	fmt.Printf("  Pressure (PSI, %% of time stalled, avg10/avg60/avg300):\n")
+	for _, key := range []string{"cpu some", "cpu full", "memory some", "memory full", "io some", "io full"} {
+		if p, ok := stats.Pressure[key]; ok {
+			fmt.Printf("    %-12s %6.2f %6.2f %6.2f\n", key, p.Avg10, p.Avg60, p.Avg300)
+		}
+	}
+}
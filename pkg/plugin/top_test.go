@@ -0,0 +1,101 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestParseCgroupStats(t *testing.T) {
+	v2 := splitSections(`### version
+v2
+### cpu.max
+50000 100000
+### cpu.stat
+usage_usec 4000000
+nr_periods 200
+nr_throttled 50
+throttled_usec 1500000
+### memory.current
+104857600
+### memory.max
+209715200
+### memory.events
+oom 1
+oom_kill 2
+### cpu.pressure
+some avg10=12.50 avg60=8.00 avg300=2.00 total=123
+full avg10=1.00 avg60=0.50 avg300=0.10 total=45
+### memory.pressure
+some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+### io.pressure
+`)
+	stats, err := parseCgroupStats(v2)
+	if err != nil {
+		t.Fatalf("parseCgroupStats(v2) error = %v", err)
+	}
+	if stats.CPUQuota != 0.5 || stats.Periods != 200 || stats.Throttled != 50 || stats.ThrottledTime != 1500*time.Millisecond {
+		t.Errorf("v2 cpu = %+v, want quota 0.5 and 50/200 periods throttled for 1.5s", stats)
+	}
+	if stats.MemoryCurrent != 100<<20 || stats.MemoryLimit != 200<<20 || stats.OOMKills != 2 {
+		t.Errorf("v2 memory = %d/%d with %d OOM kills, want 100Mi/200Mi with 2", stats.MemoryCurrent, stats.MemoryLimit, stats.OOMKills)
+	}
+	if p := stats.Pressure["cpu some"]; p.Avg10 != 12.5 || p.Avg300 != 2 {
+		t.Errorf("v2 cpu some pressure = %+v, want avg10 12.5 and avg300 2", p)
+	}
+	if _, ok := stats.Pressure["io some"]; ok {
+		t.Errorf("v2 io pressure should be missing when the file is empty")
+	}
+
+	v1 := splitSections(`### version
+v1
+### cpu.cfs_quota_us
+-1
+### cpu.cfs_period_us
+100000
+### cpu.stat
+nr_periods 10
+nr_throttled 0
+throttled_time 0
+### cpuacct.usage
+2500000000
+### memory.usage_in_bytes
+52428800
+### memory.limit_in_bytes
+9223372036854771712
+### memory.oom_control
+oom_kill_disable 0
+under_oom 0
+oom_kill 1
+`)
+	stats, err = parseCgroupStats(v1)
+	if err != nil {
+		t.Fatalf("parseCgroupStats(v1) error = %v", err)
+	}
+	if stats.CPUQuota != 0 || stats.CPUUsage != 2500*time.Millisecond || stats.Periods != 10 {
+		t.Errorf("v1 cpu = %+v, want unlimited quota, 2.5s usage and 10 periods", stats)
+	}
+	if stats.MemoryCurrent != 50<<20 || stats.MemoryLimit != 0 || stats.OOMKills != 1 {
+		t.Errorf("v1 memory = %d/%d with %d OOM kills, want 50Mi unlimited with 1", stats.MemoryCurrent, stats.MemoryLimit, stats.OOMKills)
+	}
+
+	if _, err := parseCgroupStats(splitSections("### version\nv2\n### error\ncgroup of container abc not found\n")); err == nil {
+		t.Error("parseCgroupStats() with an error section should fail")
+	}
+	if _, err := parseCgroupStats(splitSections("")); err == nil {
+		t.Error("parseCgroupStats() without output should fail")
+	}
+}
+
+func TestContainerRuntimeID(t *testing.T) {
+	pod := &corev1.Pod{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+		{Name: "app", ContainerID: "containerd://0123abcd"},
+		{Name: "sidecar", ContainerID: "cri-o://4567ef"},
+	}}}
+	for container, want := range map[string]string{"app": "0123abcd", "sidecar": "4567ef", "missing": ""} {
+		if got := containerRuntimeID(pod, container); got != want {
+			t.Errorf("containerRuntimeID(%q) = %q, want %q", container, got, want)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	triageOutput    string
+	triageRedactEnv bool
+)
+
+var triageCmd = &cobra.Command{
+	Use:   "triage",
+	Short: "Collect a triage report of the target pod",
+	Long: `Gather everything usually asked for in an incident ticket into one report:
+the pod description and manifest, current and previous logs of every
+container, the pod's events, the conditions of its node, its resource usage
+and the probe configuration of its containers.
+
+The report is written as a .tar.gz archive, or as a directory when --output
+does not end in .tar.gz or .tgz. --redact-env replaces literal environment
+values in the manifest and description with REDACTED.`,
+	Example: `  kpdbug triage -p mypod
+  kpdbug triage -p mypod --redact-env --output /tmp/incident-4711.tar.gz
+  kpdbug triage -p mypod --output ./mypod-triage`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runTriage(cmd)
+	},
+}
+
+func init() {
+	triageCmd.Flags().StringVar(&triageOutput, "output", "", "archive (.tar.gz, .tgz) or directory path (default triage-<pod>-<timestamp>.tar.gz)")
+	triageCmd.Flags().BoolVar(&triageRedactEnv, "redact-env", false, "replace literal environment variable values with REDACTED")
+	rootCmd.AddCommand(triageCmd)
+}
+
+// redactedValue replaces environment values when redacting
+const redactedValue = "REDACTED"
+
+// isArchivePath reports whether the triage report is written as a tarball
+func isArchivePath(path string) bool {
+	return strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz")
+}
+
+// redactPodEnv replaces the literal env values of all containers; values
+// taken from secrets or config maps are references and are kept
+func redactPodEnv(pod *corev1.Pod) *corev1.Pod {
+	pod = pod.DeepCopy()
+	redact := func(containers []corev1.Container) {
+		for i := range containers {
+			for j := range containers[i].Env {
+				if containers[i].Env[j].Value != "" {
+					containers[i].Env[j].Value = redactedValue
+				}
+			}
+		}
+	}
+	redact(pod.Spec.InitContainers)
+	redact(pod.Spec.Containers)
+	for i := range pod.Spec.EphemeralContainers {
+		for j := range pod.Spec.EphemeralContainers[i].Env {
+			if pod.Spec.EphemeralContainers[i].Env[j].Value != "" {
+				pod.Spec.EphemeralContainers[i].Env[j].Value = redactedValue
+			}
+		}
+	}
+	return pod
+}
+
+// redactDescribe replaces literal env values in kubectl describe output,
+// where each variable is printed as an indented "NAME:  value" line
+func redactDescribe(describe string, pod *corev1.Pod) string {
+	values := map[string]string{}
+	for _, c := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		for _, env := range c.Env {
+			if env.Value != "" {
+				values[env.Name] = env.Value
+			}
+		}
+	}
+
+	lines := strings.Split(describe, "\n")
+	for i, line := range lines {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		if literal, found := values[name]; found && strings.TrimSpace(value) == literal {
+			lines[i] = line[:strings.Index(line, name)+len(name)] + ":  " + redactedValue
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// probeConfig is the probe configuration of one container
+type probeConfig struct {
+	Container      string        `json:"container"`
+	LivenessProbe  *corev1.Probe `json:"livenessProbe,omitempty"`
+	ReadinessProbe *corev1.Probe `json:"readinessProbe,omitempty"`
+	StartupProbe   *corev1.Probe `json:"startupProbe,omitempty"`
+}
+
+// podProbes lists the probes of the pod's containers
+func podProbes(pod *corev1.Pod) []probeConfig {
+	var probes []probeConfig
+	for _, c := range append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...) {
+		probes = append(probes, probeConfig{
+			Container:      c.Name,
+			LivenessProbe:  c.LivenessProbe,
+			ReadinessProbe: c.ReadinessProbe,
+			StartupProbe:   c.StartupProbe,
+		})
+	}
+	return probes
+}
+
+// formatNodeConditions renders the node's conditions as a table
+func formatNodeConditions(node *corev1.Node) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Node %s\n\n", node.Name)
+	fmt.Fprintf(&b, "%-24s %-8s %-26s %-30s %s\n", "CONDITION", "STATUS", "LAST TRANSITION", "REASON", "MESSAGE")
+	for _, c := range node.Status.Conditions {
+		fmt.Fprintf(&b, "%-24s %-8s %-26s %-30s %s\n", c.Type, c.Status,
+			c.LastTransitionTime.UTC().Format(time.RFC3339), c.Reason, c.Message)
+	}
+	return b.String()
+}
+
+// triageReport writes the files of a triage report into a directory
+type triageReport struct {
+	dir   string
+	files []string
+}
+
+func (r *triageReport) write(name string, data []byte) {
+	path := filepath.Join(r.dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		log.Printf("Warning: Could not write %s: %v", name, err)
+		return
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		log.Printf("Warning: Could not write %s: %v", name, err)
+		return
+	}
+	r.files = append(r.files, name)
+}
+
+// kubectlOutput runs kubectl and returns stdout, or stdout followed by the
+// error so the report still records why a section is empty
+func (config *DebugConfig) kubectlOutput(args ...string) []byte {
+	cmd := config.kubectl(args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(&stdout, "\n# kubectl %s failed: %v\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+	return stdout.Bytes()
+}
+
+func runTriage(cmd *cobra.Command) error {
+	config, err := newTargetConfig(cmd.Context(), cmd, "", "")
+	if err != nil {
+		return err
+	}
+
+	output := triageOutput
+	if output == "" {
+		output = fmt.Sprintf("triage-%s-%s.tar.gz", config.PodName, clock().Format("20060102-150405"))
+	}
+
+	pod, err := config.getPod(config.PodName, config.Namespace)
+	if err != nil {
+		return NewPodNotFoundError(config.PodName, config.Namespace).WithOriginalError(err)
+	}
+
+	dir := output
+	if isArchivePath(output) {
+		dir, err = os.MkdirTemp("", "kpdbug-triage-*")
+		if err != nil {
+			return fmt.Errorf("error creating temporary directory: %v", err)
+		}
+		defer func() {
+			_ = os.RemoveAll(dir)
+		}()
+	} else if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("error creating %s: %v", dir, err)
+	}
+	report := &triageReport{dir: dir}
+	ns := config.Namespace
+
+	log.Printf("Collecting pod description and manifest...")
+	manifest := pod
+	describe := string(config.kubectlOutput("describe", "pod", config.PodName, "-n", ns))
+	if triageRedactEnv {
+		describe = redactDescribe(describe, pod)
+		manifest = redactPodEnv(pod)
+	}
+	report.write("describe.txt", []byte(describe))
+	if data, err := yaml.Marshal(manifest); err == nil {
+		report.write("pod.yaml", data)
+	}
+	if data, err := yaml.Marshal(podProbes(pod)); err == nil {
+		report.write("probes.yaml", data)
+	}
+
+	log.Printf("Collecting logs...")
+	var containers []string
+	for _, c := range pod.Spec.InitContainers {
+		containers = append(containers, c.Name)
+	}
+	for _, c := range pod.Spec.Containers {
+		containers = append(containers, c.Name)
+	}
+	for _, c := range pod.Spec.EphemeralContainers {
+		containers = append(containers, c.Name)
+	}
+	restarted := map[string]bool{}
+	for _, status := range append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...) {
+		restarted[status.Name] = status.LastTerminationState.Terminated != nil
+	}
+	for _, container := range containers {
+		report.write(filepath.Join("logs", container+".log"),
+			config.kubectlOutput("logs", config.PodName, "-n", ns, "-c", container, "--timestamps"))
+		if restarted[container] {
+			report.write(filepath.Join("logs", container+".previous.log"),
+				config.kubectlOutput("logs", config.PodName, "-n", ns, "-c", container, "--timestamps", "--previous"))
+		}
+	}
+
+	log.Printf("Collecting events, node conditions and resource usage...")
+	report.write("events.txt", config.kubectlOutput("get", "events", "-n", ns,
+		"--field-selector", "involvedObject.name="+config.PodName, "--sort-by=.lastTimestamp"))
+	if pod.Spec.NodeName != "" {
+		var node corev1.Node
+		data := config.kubectlOutput("get", "node", pod.Spec.NodeName, "-o", "json")
+		if err := json.Unmarshal(data, &node); err == nil {
+			report.write("node.txt", []byte(formatNodeConditions(&node)))
+		} else {
+			report.write("node.txt", data)
+		}
+	}
+	report.write("top.txt", config.kubectlOutput("top", "pod", config.PodName, "-n", ns, "--containers"))
+
+	if !isArchivePath(output) {
+		fmt.Printf("Wrote triage report of %s/%s to %s (%d files)\n", ns, config.PodName, output, len(report.files))
+		return nil
+	}
+	var files []bundleFile
+	for _, name := range report.files {
+		files = append(files, bundleFile{Name: filepath.ToSlash(name), Path: filepath.Join(dir, name)})
+	}
+	if err := writeBundle(output, files, clock()); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote triage report of %s/%s to %s (%d files)\n", ns, config.PodName, output, len(files))
+	return nil
+}
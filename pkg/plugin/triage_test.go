@@ -0,0 +1,64 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestRedactPodEnv(t *testing.T) {
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{
+		Name: "app",
+		Env: []corev1.EnvVar{
+			{Name: "DB_PASSWORD", Value: "hunter2"},
+			{Name: "TOKEN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{Key: "token"}}},
+		},
+	}}}}
+
+	redacted := redactPodEnv(pod)
+	if got := redacted.Spec.Containers[0].Env[0].Value; got != redactedValue {
+		t.Errorf("redacted DB_PASSWORD = %q, want %q", got, redactedValue)
+	}
+	if redacted.Spec.Containers[0].Env[1].ValueFrom == nil {
+		t.Error("secret references should be kept")
+	}
+	if pod.Spec.Containers[0].Env[0].Value != "hunter2" {
+		t.Error("redactPodEnv() should not modify the original pod")
+	}
+
+	describe := "    Environment:\n      DB_PASSWORD:  hunter2\n      TOKEN:        <set to the key 'token' in secret 'app'>  Optional: false\n    Mounts:"
+	got := redactDescribe(describe, pod)
+	if strings.Contains(got, "hunter2") || !strings.Contains(got, "      DB_PASSWORD:  REDACTED") {
+		t.Errorf("redactDescribe() = %q, want DB_PASSWORD redacted", got)
+	}
+	if !strings.Contains(got, "<set to the key 'token' in secret 'app'>") {
+		t.Errorf("redactDescribe() = %q, want secret references kept", got)
+	}
+}
+
+func TestIsArchivePath(t *testing.T) {
+	for path, want := range map[string]bool{
+		"triage.tar.gz":   true,
+		"/tmp/report.tgz": true,
+		"./mypod-triage":  false,
+		"report.tar":      false,
+	} {
+		if got := isArchivePath(path); got != want {
+			t.Errorf("isArchivePath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestPodProbes(t *testing.T) {
+	liveness := &corev1.Probe{ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/healthz"}}}
+	pod := &corev1.Pod{Spec: corev1.PodSpec{
+		InitContainers: []corev1.Container{{Name: "init"}},
+		Containers:     []corev1.Container{{Name: "app", LivenessProbe: liveness}},
+	}}
+
+	probes := podProbes(pod)
+	if len(probes) != 2 || probes[0].Container != "init" || probes[1].LivenessProbe != liveness {
+		t.Errorf("podProbes() = %+v, want init and app with its liveness probe", probes)
+	}
+}
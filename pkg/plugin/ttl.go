@@ -0,0 +1,104 @@
+package plugin
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"k8s.io/utils/ptr"
+)
+
+var ttlCapWarning sync.Once
+
+// maxSessionTTL returns the shorter of the cluster policy's and the config
+// file's maximum debug pod lifetime, or 0 when neither sets one
+func (config *DebugConfig) maxSessionTTL() time.Duration {
+	var limits []time.Duration
+	if policy := config.currentPolicy(); policy != nil && policy.MaxTTL != "" {
+		// Validated when the policy is parsed
+		ttl, _ := time.ParseDuration(policy.MaxTTL)
+		limits = append(limits, ttl)
+	}
+	if value := currentConfig().MaxTTL; value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			config.logf("Warning: ignoring invalid maxTTL %q in the config file", value)
+		} else {
+			limits = append(limits, ttl)
+		}
+	}
+
+	var limit time.Duration
+	for _, ttl := range limits {
+		if limit == 0 || ttl < limit {
+			limit = ttl
+		}
+	}
+	return limit
+}
+
+// sessionTTL returns how long debug pods may live: --ttl capped at the
+// maximum TTL, or the maximum when --ttl is not set; 0 means no limit
+func (config *DebugConfig) sessionTTL() time.Duration {
+	limit := config.maxSessionTTL()
+	if limit == 0 || (config.TTL > 0 && config.TTL <= limit) {
+		return config.TTL
+	}
+	if config.TTL > limit {
+		ttlCapWarning.Do(func() {
+			config.logf("Warning: --ttl %s exceeds the maximum session duration; debug pods end after %s", config.TTL, limit)
+		})
+	}
+	return limit
+}
+
+// activeDeadlineSeconds returns the activeDeadlineSeconds of debug pods, so
+// the kubelet ends them after the TTL even when kpdbug is gone
+func (config *DebugConfig) activeDeadlineSeconds() *int64 {
+	ttl := config.sessionTTL()
+	if ttl <= 0 {
+		return nil
+	}
+	return ptr.To(int64(math.Ceil(ttl.Seconds())))
+}
+
+// checkDaemonSetLifetime refuses a debug DaemonSet when debug pods must end
+// in time: the API rejects activeDeadlineSeconds in DaemonSet templates and
+// the controller would replace ended pods anyway, so nothing in the cluster
+// would enforce the lifetime
+func (config *DebugConfig) checkDaemonSetLifetime() error {
+	ttl := config.sessionTTL()
+	if ttl <= 0 {
+		return nil
+	}
+	return NewValidationError("ttl", ttl.String(), "debug DaemonSets cannot be given a lifetime the cluster enforces").
+		WithSuggestion("Drop --ttl; a maxTTL in the config file or cluster debug policy rules out DaemonSets")
+}
+
+// limitPodLifetime sets activeDeadlineSeconds on a pod kubectl debug
+// creates, such as a copy, once it exists; the field may be added to
+// running pods. The deadline is read by the caller, as this runs in the
+// background of attached sessions.
+func (config *DebugConfig) limitPodLifetime(podName string, deadline *int64) {
+	if deadline == nil {
+		return
+	}
+	patch := fmt.Sprintf(`{"spec":{"activeDeadlineSeconds":%d}}`, *deadline)
+
+	for i := 0; i < maxAttempts; i++ {
+		if config.kubectl("get", "pod", podName, "-n", config.Namespace, "-o", "name").Run() == nil {
+			if output, err := config.kubectl("patch", "pod", podName, "-n", config.Namespace,
+				"--type=merge", "-p", patch).CombinedOutput(); err != nil {
+				config.logf("Warning: Could not limit the lifetime of %s: %v - %s", podName, err, output)
+			}
+			return
+		}
+		select {
+		case <-config.context().Done():
+			return
+		case <-time.After(sleepDuration):
+		}
+	}
+	config.logf("Warning: Could not limit the lifetime of %s: pod was not created within %d seconds", podName, maxAttempts)
+}
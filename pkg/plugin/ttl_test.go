@@ -0,0 +1,74 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSessionTTL(t *testing.T) {
+	clusterPolicyOnce.Do(func() {})
+	defer func() {
+		clusterPolicy = nil
+		loadedConfig = nil
+	}()
+
+	clusterPolicy = nil
+	loadedConfig = &Config{}
+	if deadline := (&DebugConfig{}).activeDeadlineSeconds(); deadline != nil {
+		t.Errorf("activeDeadlineSeconds() without a TTL = %d, want none", *deadline)
+	}
+
+	clusterPolicy = &ClusterPolicy{MaxTTL: "1h"}
+	loadedConfig = &Config{MaxTTL: "30m"}
+	tests := []struct {
+		ttl  time.Duration
+		want time.Duration
+	}{
+		{0, 30 * time.Minute},
+		{10 * time.Minute, 10 * time.Minute},
+		{2 * time.Hour, 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := (&DebugConfig{TTL: tt.ttl}).sessionTTL(); got != tt.want {
+			t.Errorf("sessionTTL(%s) = %s, want %s", tt.ttl, got, tt.want)
+		}
+	}
+
+	loadedConfig = &Config{}
+	if deadline := (&DebugConfig{TTL: 90 * time.Second}).activeDeadlineSeconds(); deadline == nil || *deadline != 90 {
+		t.Errorf("activeDeadlineSeconds(90s) = %v, want 90", deadline)
+	}
+	if _, err := parseClusterPolicy("maxTTL: forever"); err == nil {
+		t.Error("parseClusterPolicy(maxTTL: forever) succeeded")
+	}
+}
+
+func TestDaemonSetsRefusedUnderTTL(t *testing.T) {
+	clusterPolicyOnce.Do(func() {})
+	defer func() {
+		clusterPolicy = nil
+		loadedConfig = nil
+	}()
+
+	tests := []struct {
+		name    string
+		policy  *ClusterPolicy
+		config  *Config
+		ttl     time.Duration
+		refused bool
+	}{
+		{"no limit", nil, &Config{}, 0, false},
+		{"--ttl", nil, &Config{}, time.Hour, true},
+		{"config maxTTL", nil, &Config{MaxTTL: "4h"}, 0, true},
+		{"policy maxTTL", &ClusterPolicy{MaxTTL: "8h"}, &Config{}, 0, true},
+	}
+	for _, tt := range tests {
+		clusterPolicy, loadedConfig = tt.policy, tt.config
+		err := (&DebugConfig{TTL: tt.ttl}).checkDaemonSetLifetime()
+		var detailed *DetailedError
+		if tt.refused != (err != nil) || (err != nil && (!errors.As(err, &detailed) || detailed.Type != ErrorTypeValidation)) {
+			t.Errorf("%s: checkDaemonSetLifetime() = %v, want refused %v", tt.name, err, tt.refused)
+		}
+	}
+}
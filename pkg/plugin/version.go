@@ -0,0 +1,180 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Build information, set by main from the values the release build injects
+// through ldflags
+var (
+	buildVersion = "dev"
+	buildCommit  = "none"
+	buildDate    = "unknown"
+)
+
+// latestReleaseURL is the GitHub API endpoint of the latest release
+var latestReleaseURL = "https://api.github.com/repos/the-kernel-panics/k8s-pods-debug/releases/latest"
+
+const updateCheckTimeout = 3 * time.Second
+
+var versionCheck bool
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Print the version and check for a newer release",
+	Long: `Print the version, commit and build date of kpdbug, then look up the latest
+release on GitHub and tell how to upgrade when it is newer. The check is skipped
+with --check=false, e.g. on machines without internet access.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		printVersion()
+		if versionCheck {
+			checkForUpdate()
+		}
+		return nil
+	},
+}
+
+func init() {
+	versionCmd.Flags().BoolVar(&versionCheck, "check", true, "check GitHub for a newer release")
+	rootCmd.AddCommand(versionCmd)
+}
+
+// SetVersionInfo records the build information injected into main
+func SetVersionInfo(version, commit, date string) {
+	buildVersion, buildCommit, buildDate = version, commit, date
+}
+
+func printVersion() {
+	fmt.Printf("kpdbug %s\n", buildVersion)
+	fmt.Printf("  commit:   %s\n", buildCommit)
+	fmt.Printf("  built:    %s\n", buildDate)
+	fmt.Printf("  go:       %s\n", runtime.Version())
+	fmt.Printf("  platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+}
+
+// checkForUpdate prints whether a newer release exists; failures only
+// print a note, the version command itself never fails on them
+func checkForUpdate() {
+	latest, err := latestRelease()
+	if err != nil {
+		fmt.Printf("\nCould not check for updates: %v\n", err)
+		return
+	}
+	if compareVersions(latest, buildVersion) <= 0 {
+		fmt.Printf("\nYou are running the latest release (%s)\n", latest)
+		return
+	}
+
+	fmt.Printf("\nA newer release is available: %s\n", latest)
+	if installedByKrew() {
+		fmt.Println("Upgrade with: kubectl krew upgrade")
+		return
+	}
+	fmt.Printf("Download it from https://github.com/the-kernel-panics/k8s-pods-debug/releases/tag/%s\n", latest)
+}
+
+// latestRelease returns the tag of the latest GitHub release
+func latestRelease() (string, error) {
+	client := &http.Client{Timeout: updateCheckTimeout}
+	req, err := http.NewRequest(http.MethodGet, latestReleaseURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GitHub returned %s", resp.Status)
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return "", fmt.Errorf("error parsing the release: %v", err)
+	}
+	if release.TagName == "" {
+		return "", fmt.Errorf("the latest release has no tag")
+	}
+	return release.TagName, nil
+}
+
+// compareVersions compares two vMAJOR.MINOR.PATCH versions; a version that
+// does not parse, such as a dev build, is older than any release
+func compareVersions(a, b string) int {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+	for i := range va {
+		if va[i] != vb[i] {
+			if va[i] < vb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// parseVersion parses v1.2.3, ignoring pre-release and build suffixes
+func parseVersion(version string) ([3]int, bool) {
+	var parsed [3]int
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	parts := strings.Split(version, ".")
+	if len(parts) != 3 {
+		return parsed, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return parsed, false
+		}
+		parsed[i] = n
+	}
+	return parsed, true
+}
+
+// installedByKrew reports whether the running binary lives under the krew
+// root ($KREW_ROOT or ~/.krew)
+func installedByKrew() bool {
+	executable, err := os.Executable()
+	if err != nil {
+		return false
+	}
+	root := os.Getenv("KREW_ROOT")
+	if root == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return false
+		}
+		root = filepath.Join(home, ".krew")
+	}
+	rel, err := filepath.Rel(root, executable)
+	return err == nil && !strings.HasPrefix(rel, "..")
+}
@@ -0,0 +1,55 @@
+package plugin
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "1.2.3", 0},
+		{"v1.10.0", "v1.9.9", 1},
+		{"v1.2.3", "v2.0.0", -1},
+		{"v1.2.4-rc.1", "1.2.3", 1},
+		{"v0.5.0", "dev", 1},
+		{"dev", "13d99f0-dirty", 0},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestLatestRelease(t *testing.T) {
+	oldURL := latestReleaseURL
+	defer func() { latestReleaseURL = oldURL }()
+
+	tests := []struct {
+		status  int
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{http.StatusOK, `{"tag_name":"v1.4.0","name":"v1.4.0"}`, "v1.4.0", false},
+		{http.StatusForbidden, `{"message":"API rate limit exceeded"}`, "", true},
+		{http.StatusOK, `{}`, "", true},
+	}
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+			_, _ = io.WriteString(w, tt.body)
+		}))
+		latestReleaseURL = server.URL
+		got, err := latestRelease()
+		server.Close()
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("latestRelease() with %d %s = %q, %v", tt.status, tt.body, got, err)
+		}
+	}
+}
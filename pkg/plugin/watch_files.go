@@ -0,0 +1,148 @@
+package plugin
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var watchFilesDuration time.Duration
+
+var watchFilesCmd = &cobra.Command{
+	Use:   "watch-files <path>...",
+	Short: "Watch paths in the target's filesystem for changes",
+	Long: `Add an ephemeral debug container to the target pod and watch paths of the
+target container's filesystem with inotify through /proc/<pid>/root, printing
+every modification, creation, deletion, move and attribute change as it
+happens. Directories are watched recursively.
+
+When a file is modified, the processes of the target that have it open are
+listed, which usually answers "is something rewriting this config at
+runtime?". inotify-tools is installed in the debug container when the image
+has none.`,
+	Example: `  kpdbug watch-files -p mypod /etc/app --duration 10m
+  kpdbug watch-files -p mypod --container app /etc/nginx/nginx.conf /var/run/secrets`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runWatchFiles(cmd, args)
+	},
+}
+
+func init() {
+	watchFilesCmd.Flags().DurationVar(&watchFilesDuration, "duration", 10*time.Minute, "how long to watch")
+	rootCmd.AddCommand(watchFilesCmd)
+}
+
+// watchFilesScript prints ROOT|<root>, then FILE|<epoch>|<events>|<path> per
+// inotify event and OPEN|<path>|<pid>|<comm> for the processes holding a
+// modified file open
+func watchFilesScript(paths []string, duration time.Duration) string {
+	quoted := make([]string, len(paths))
+	for i, path := range paths {
+		quoted[i] = `"$root"/` + shellQuote(strings.TrimPrefix(path, "/"))
+	}
+	return targetPIDScript + fmt.Sprintf(`echo "ROOT|$root"
+watch() {
+  command -v inotifywait >/dev/null 2>&1 || apk add --no-cache inotify-tools >/dev/null 2>&1 || { echo "inotifywait is not installed in the debug image" >&2; return 2; }
+  timeout %[1]d inotifywait -m -r -q -e modify,close_write,create,delete,moved_from,moved_to,attrib --timefmt %%s --format '%%T|%%e|%%w%%f' %[2]s |
+  while IFS='|' read -r at events path; do
+    echo "FILE|$at|$events|$path"
+    case "$events" in
+      *MODIFY*|*CLOSE_WRITE*)
+        for fd in /proc/[0-9]*/fd/*; do
+          [ "$(readlink "$fd" 2>/dev/null)" = "${path#$root}" ] || continue
+          p=${fd#/proc/}; p=${p%%%%/*}
+          echo "OPEN|$path|$p|$(cat /proc/$p/comm 2>/dev/null)"
+        done | sort -u
+        ;;
+    esac
+  done
+}
+watch`, max(int(duration.Seconds()), 1), strings.Join(quoted, " "))
+}
+
+// fileEvent is one inotify event in the target's filesystem
+type fileEvent struct {
+	Time   time.Time
+	Events string
+	Path   string
+}
+
+// parseFileEvent parses a FILE line of watchFilesScript, with the path made
+// relative to the target's root
+func parseFileEvent(line, root string) (fileEvent, bool) {
+	fields := strings.SplitN(strings.TrimSpace(line), "|", 4)
+	if len(fields) != 4 || fields[0] != "FILE" {
+		return fileEvent{}, false
+	}
+	epoch, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return fileEvent{}, false
+	}
+	return fileEvent{
+		Time:   time.Unix(epoch, 0),
+		Events: fields[2],
+		Path:   targetPath(fields[3], root),
+	}, true
+}
+
+// targetPath strips the /proc/<pid>/root prefix of a path
+func targetPath(path, root string) string {
+	if root != "" && strings.HasPrefix(path, root+"/") {
+		return strings.TrimPrefix(path, root)
+	}
+	return path
+}
+
+func runWatchFiles(cmd *cobra.Command, paths []string) error {
+	config, err := newTargetConfig(cmd.Context(), cmd, "", "general")
+	if err != nil {
+		return err
+	}
+
+	var root string
+	changes := map[string]int{}
+	log.Printf("Watching %s in pod %s for %s; press Ctrl-C to stop", strings.Join(paths, ", "), config.PodName, watchFilesDuration)
+	result, err := config.streamEphemeralScript(config.PodName, watchFilesScript(paths, watchFilesDuration), func(line string) {
+		fields := strings.Split(strings.TrimSpace(line), "|")
+		switch {
+		case fields[0] == "ROOT" && len(fields) == 2:
+			root = fields[1]
+		case fields[0] == "OPEN" && len(fields) == 4:
+			fmt.Printf("%8s opened by pid %s (%s)\n", "", fields[2], fields[3])
+		default:
+			if event, ok := parseFileEvent(line, root); ok {
+				changes[event.Path]++
+				fmt.Printf("%s  %-24s %s\n", event.Time.Format("15:04:05"), event.Events, event.Path)
+			}
+		}
+	})
+	// Ctrl-C ends the watch early
+	if err != nil && config.context().Err() == nil {
+		return err
+	}
+	if result != nil && result.ExitCode == 2 {
+		return NewDetailedError(ErrorTypeKubectl, strings.TrimSpace(result.Stderr)).
+			WithSuggestion("Use --image with inotify-tools installed when the debug container cannot install it")
+	}
+
+	if len(changes) == 0 {
+		fmt.Println("No changes")
+		return nil
+	}
+	changed := make([]string, 0, len(changes))
+	for path := range changes {
+		changed = append(changed, path)
+	}
+	sort.Strings(changed)
+	fmt.Printf("\n%d paths changed:\n", len(changed))
+	for _, path := range changed {
+		fmt.Printf("  %-60s %d events\n", path, changes[path])
+	}
+	return nil
+}
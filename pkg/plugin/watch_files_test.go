@@ -0,0 +1,16 @@
+package plugin
+
+import "testing"
+
+func TestParseFileEvent(t *testing.T) {
+	event, ok := parseFileEvent("FILE|1700000000|CLOSE_WRITE,CLOSE|/proc/7/root/etc/app/config|v2.yaml", "/proc/7/root")
+	if !ok || event.Events != "CLOSE_WRITE,CLOSE" || event.Path != "/etc/app/config|v2.yaml" || event.Time.Unix() != 1700000000 {
+		t.Errorf("parseFileEvent() = %+v, %v", event, ok)
+	}
+	if _, ok := parseFileEvent("OPEN|/proc/7/root/etc/app|7|app", "/proc/7/root"); ok {
+		t.Error("parseFileEvent() accepted an OPEN line")
+	}
+	if got := targetPath("/proc/7/rootfs/x", "/proc/7/root"); got != "/proc/7/rootfs/x" {
+		t.Errorf("targetPath() = %q", got)
+	}
+}
@@ -0,0 +1,242 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+)
+
+var whyCmd = &cobra.Command{
+	Use:   "why",
+	Short: "Explain why the target pod is restarting or not running",
+	Long: `Inspect the container statuses, exit codes, probe failures and recent events of
+the target pod and print the most likely root causes, each with the evidence
+it is based on and the kpdbug command to follow up with.`,
+	Example: `  kpdbug why -p mypod
+  kpdbug why -p mypod -n shop`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runWhy(cmd)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(whyCmd)
+}
+
+// hypothesis is one suspected cause of a pod not running
+type hypothesis struct {
+	Container string
+	Cause     string
+	Evidence  string
+	FollowUp  string
+}
+
+// exitCodeMeanings explains well-known container exit codes
+var exitCodeMeanings = map[int32]string{
+	1:   "the application exited with an error",
+	2:   "the command was misused (bad arguments or shell syntax)",
+	126: "the command is not executable",
+	127: "the command was not found in the image",
+	128: "the exit code was invalid",
+	134: "the process aborted (SIGABRT)",
+	137: "the process was killed (SIGKILL)",
+	139: "the process crashed with a segmentation fault (SIGSEGV)",
+	143: "the process was terminated (SIGTERM)",
+}
+
+var probeStatusPattern = regexp.MustCompile(`statuscode: (\d+)`)
+
+// probeFailure summarizes an Unhealthy event message such as
+// "Liveness probe failed: HTTP probe failed with statuscode: 503"
+func probeFailure(message string) (probe, detail string, ok bool) {
+	kind, detail, found := strings.Cut(message, " probe failed:")
+	if !found {
+		return "", "", false
+	}
+	probe = strings.ToLower(strings.TrimSpace(kind))
+	detail = strings.TrimSpace(detail)
+	if match := probeStatusPattern.FindStringSubmatch(detail); match != nil {
+		return probe, "with " + match[1], true
+	}
+	if strings.Contains(detail, "connection refused") {
+		return probe, "with connection refused", true
+	}
+	if strings.Contains(detail, "context deadline exceeded") || strings.Contains(detail, "timeout") {
+		return probe, "with a timeout", true
+	}
+	return probe, "(" + truncateString(detail, 60) + ")", true
+}
+
+// eventContainer returns the container an event refers to, from field paths
+// such as spec.containers{app}
+func eventContainer(event corev1.Event) string {
+	path := event.InvolvedObject.FieldPath
+	if start := strings.Index(path, "{"); start >= 0 && strings.HasSuffix(path, "}") {
+		return path[start+1 : len(path)-1]
+	}
+	return ""
+}
+
+// explainPod derives restart and startup hypotheses from the pod's status
+// and events, most specific first
+func explainPod(pod *corev1.Pod, events []corev1.Event) []hypothesis {
+	var hypotheses []hypothesis
+	target := fmt.Sprintf("kpdbug -p %s -n %s", pod.Name, pod.Namespace)
+
+	// Probe failures explain kills that only show up as exit 137 or 143
+	probeKilled := map[string]bool{}
+	seen := map[string]bool{}
+	for _, event := range events {
+		if event.Reason != "Unhealthy" {
+			continue
+		}
+		probe, detail, ok := probeFailure(event.Message)
+		container := eventContainer(event)
+		if !ok || seen[container+probe] {
+			continue
+		}
+		seen[container+probe] = true
+		if probe == "liveness" || probe == "startup" {
+			probeKilled[container] = true
+		}
+		hypotheses = append(hypotheses, hypothesis{
+			Container: container,
+			Cause:     fmt.Sprintf("%s probe failing %s", probe, detail),
+			Evidence:  fmt.Sprintf("%q (%d times)", event.Message, max(event.Count, 1)),
+			FollowUp:  fmt.Sprintf("%s --container %s --command 'curl -sv localhost:<port><path>'", target, container),
+		})
+	}
+
+	statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if waiting := status.State.Waiting; waiting != nil {
+			switch waiting.Reason {
+			case "ImagePullBackOff", "ErrImagePull", "InvalidImageName":
+				hypotheses = append(hypotheses, hypothesis{
+					Container: status.Name,
+					Cause:     fmt.Sprintf("image %s cannot be pulled", status.Image),
+					Evidence:  waiting.Reason + ": " + waiting.Message,
+					FollowUp:  fmt.Sprintf("kpdbug triage -p %s -n %s", pod.Name, pod.Namespace),
+				})
+			case "CreateContainerConfigError", "CreateContainerError", "RunContainerError":
+				hypotheses = append(hypotheses, hypothesis{
+					Container: status.Name,
+					Cause:     "the container cannot be created from its configuration",
+					Evidence:  waiting.Reason + ": " + waiting.Message,
+					FollowUp:  fmt.Sprintf("kpdbug triage -p %s -n %s", pod.Name, pod.Namespace),
+				})
+			}
+		}
+
+		terminated := status.State.Terminated
+		if terminated == nil {
+			terminated = status.LastTerminationState.Terminated
+		}
+		if terminated == nil {
+			continue
+		}
+		evidence := fmt.Sprintf("%s, exit code %d, %d restarts", terminated.Reason, terminated.ExitCode, status.RestartCount)
+		switch {
+		case terminated.Reason == "OOMKilled":
+			hypotheses = append(hypotheses, hypothesis{
+				Container: status.Name,
+				Cause:     fmt.Sprintf("OOMKilled at %s limit", containerMemoryLimit(pod, status.Name)),
+				Evidence:  evidence,
+				FollowUp:  fmt.Sprintf("kpdbug oom -p %s -n %s", pod.Name, pod.Namespace),
+			})
+		case probeKilled[status.Name] && (terminated.ExitCode == 137 || terminated.ExitCode == 143):
+			// Already explained by the probe failure
+		case terminated.ExitCode == 0:
+			if status.RestartCount > 0 && pod.Spec.RestartPolicy == corev1.RestartPolicyAlways {
+				hypotheses = append(hypotheses, hypothesis{
+					Container: status.Name,
+					Cause:     "the process exits successfully but restartPolicy Always restarts it",
+					Evidence:  evidence,
+					FollowUp:  fmt.Sprintf("kpdbug triage -p %s -n %s", pod.Name, pod.Namespace),
+				})
+			}
+		default:
+			meaning, known := exitCodeMeanings[terminated.ExitCode]
+			if !known {
+				meaning = "the application exited with an error"
+			}
+			hypotheses = append(hypotheses, hypothesis{
+				Container: status.Name,
+				Cause:     fmt.Sprintf("exit code %d: %s", terminated.ExitCode, meaning),
+				Evidence:  evidence,
+				FollowUp:  fmt.Sprintf("%s --container %s --copy", target, status.Name),
+			})
+		}
+	}
+
+	for _, event := range events {
+		switch event.Reason {
+		case "FailedScheduling":
+			hypotheses = append(hypotheses, hypothesis{
+				Cause:    "the pod cannot be scheduled",
+				Evidence: event.Message,
+				FollowUp: fmt.Sprintf("kpdbug triage -p %s -n %s", pod.Name, pod.Namespace),
+			})
+		case "FailedMount", "FailedAttachVolume":
+			hypotheses = append(hypotheses, hypothesis{
+				Cause:    "a volume cannot be mounted",
+				Evidence: event.Message,
+				FollowUp: fmt.Sprintf("kpdbug triage -p %s -n %s", pod.Name, pod.Namespace),
+			})
+		}
+	}
+	return hypotheses
+}
+
+// podEvents lists the events of the pod, oldest first
+func (config *DebugConfig) podEvents(name string) []corev1.Event {
+	output, err := config.kubectl("get", "events", "-n", config.Namespace,
+		"--field-selector", "involvedObject.kind=Pod,involvedObject.name="+name, "-o", "json").Output()
+	if err != nil {
+		config.logf("Warning: Could not list events of pod %s: %v", name, err)
+		return nil
+	}
+	var list corev1.EventList
+	if err := json.Unmarshal(output, &list); err != nil {
+		return nil
+	}
+	sort.SliceStable(list.Items, func(i, j int) bool {
+		return list.Items[i].LastTimestamp.Before(&list.Items[j].LastTimestamp)
+	})
+	return list.Items
+}
+
+func runWhy(cmd *cobra.Command) error {
+	config, err := newTargetConfig(cmd.Context(), cmd, "", "")
+	if err != nil {
+		return err
+	}
+
+	pod, err := config.getPod(config.PodName, config.Namespace)
+	if err != nil {
+		return NewPodNotFoundError(config.PodName, config.Namespace).WithOriginalError(err)
+	}
+
+	hypotheses := explainPod(pod, config.podEvents(config.PodName))
+	fmt.Printf("Pod %s/%s is %s\n\n", config.Namespace, config.PodName, pod.Status.Phase)
+	if len(hypotheses) == 0 {
+		fmt.Println("No restart or startup problem found in the container statuses and recent events.")
+		return nil
+	}
+	for i, h := range hypotheses {
+		subject := "pod"
+		if h.Container != "" {
+			subject = "container " + h.Container
+		}
+		fmt.Printf("%d. %s: %s\n", i+1, subject, h.Cause)
+		fmt.Printf("   evidence:  %s\n", h.Evidence)
+		fmt.Printf("   follow up: %s\n", h.FollowUp)
+	}
+	return nil
+}
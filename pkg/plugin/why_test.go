@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestProbeFailure(t *testing.T) {
+	tests := []struct {
+		message, probe, detail string
+		ok                     bool
+	}{
+		{"Liveness probe failed: HTTP probe failed with statuscode: 503", "liveness", "with 503", true},
+		{"Readiness probe failed: dial tcp 10.0.0.5:8080: connect: connection refused", "readiness", "with connection refused", true},
+		{"Startup probe failed: Get \"http://10.0.0.5:8080/\": context deadline exceeded", "startup", "with a timeout", true},
+		{"Back-off restarting failed container", "", "", false},
+	}
+	for _, tt := range tests {
+		probe, detail, ok := probeFailure(tt.message)
+		if probe != tt.probe || detail != tt.detail || ok != tt.ok {
+			t.Errorf("probeFailure(%q) = %q, %q, %v, want %q, %q, %v", tt.message, probe, detail, ok, tt.probe, tt.detail, tt.ok)
+		}
+	}
+}
+
+func TestExplainPod(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "mypod", Namespace: "shop"},
+		Spec: corev1.PodSpec{
+			RestartPolicy: corev1.RestartPolicyAlways,
+			Containers: []corev1.Container{
+				{Name: "app", Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")}}},
+				{Name: "web"},
+				{Name: "worker"},
+			},
+		},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+			{Name: "app", RestartCount: 4, LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "OOMKilled", ExitCode: 137}}},
+			{Name: "web", RestartCount: 2, LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 137}}},
+			{Name: "worker", RestartCount: 1, LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{Reason: "Error", ExitCode: 127}}},
+		}},
+	}
+	events := []corev1.Event{{
+		Reason:         "Unhealthy",
+		Message:        "Liveness probe failed: HTTP probe failed with statuscode: 503",
+		Count:          6,
+		InvolvedObject: corev1.ObjectReference{FieldPath: "spec.containers{web}"},
+	}}
+
+	hypotheses := explainPod(pod, events)
+	causes := map[string]hypothesis{}
+	for _, h := range hypotheses {
+		causes[h.Container] = h
+	}
+	if len(hypotheses) != 3 {
+		t.Fatalf("explainPod() = %+v, want one hypothesis per container", hypotheses)
+	}
+	if h := causes["web"]; h.Cause != "liveness probe failing with 503" {
+		t.Errorf("web cause = %q, want the liveness probe rather than exit 137", h.Cause)
+	}
+	if h := causes["app"]; h.Cause != "OOMKilled at 512Mi limit" || h.FollowUp != "kpdbug oom -p mypod -n shop" {
+		t.Errorf("app hypothesis = %+v", h)
+	}
+	if h := causes["worker"]; !strings.Contains(h.Cause, "exit code 127") {
+		t.Errorf("worker cause = %q, want exit code 127 explained", h.Cause)
+	}
+}
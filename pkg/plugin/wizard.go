@@ -0,0 +1,196 @@
+package plugin
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var wizardCmd = &cobra.Command{
+	Use:   "wizard",
+	Short: "Create a debug pod with a guided, interactive flow",
+	Long: `Guide you through namespace, target, image, profile, resources and cleanup
+choices, then show the equivalent kpdbug command line and run it.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		prompter := &wizardPrompter{reader: bufio.NewReader(os.Stdin), out: os.Stdout}
+		answers, err := prompter.run(cmd)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("\nEquivalent command:\n  %s\n\n", answers.commandLine())
+		if !prompter.confirm("Run it now?", true) {
+			fmt.Println("Wizard cancelled")
+			return nil
+		}
+
+		config := answers.debugConfig()
+		config.Context = cmd.Context()
+		_, err = config.Execute()
+		return err
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(wizardCmd)
+}
+
+// wizardAnswers holds the choices collected by the wizard
+type wizardAnswers struct {
+	Namespace     string
+	PodName       string
+	CopyPod       bool
+	Image         string
+	Profile       string
+	MemoryLimit   string
+	CPURequest    string
+	MemoryRequest string
+	RemoveAfter   bool
+}
+
+// commandLine renders the answers as the equivalent kpdbug invocation
+func (a *wizardAnswers) commandLine() string {
+	args := []string{"kpdbug", "-n", a.Namespace}
+	if a.PodName != "" {
+		args = append(args, "-p", a.PodName)
+		if a.CopyPod {
+			args = append(args, "--copy")
+		}
+	}
+	args = append(args,
+		"--image", a.Image,
+		"--profile", a.Profile,
+		"--memory-limit", a.MemoryLimit,
+		"--cpu-request", a.CPURequest,
+		"--memory-request", a.MemoryRequest,
+		"-it")
+	if a.RemoveAfter {
+		args = append(args, "--rm")
+	}
+	return strings.Join(args, " ")
+}
+
+// debugConfig converts the answers into a DebugConfig, starting from the
+// global flags so cluster selection and impersonation still apply
+func (a *wizardAnswers) debugConfig() *DebugConfig {
+	config := NewDebugConfigFromFlags()
+	config.Namespace = a.Namespace
+	config.PodName = a.PodName
+	config.CopyPod = a.CopyPod
+	config.Image = a.Image
+	config.Profile = a.Profile
+	config.MemoryLimit = a.MemoryLimit
+	config.CPURequest = a.CPURequest
+	config.MemoryRequest = a.MemoryRequest
+	config.RemoveAfter = a.RemoveAfter
+	config.Interactive = true
+	config.TTY = true
+
+	switch {
+	case config.PodName == "":
+		config.Operation = OperationStandalone
+	case config.CopyPod:
+		config.Operation = OperationCopyPod
+	default:
+		config.Operation = OperationAddContainer
+	}
+	return config
+}
+
+// wizardPrompter asks questions on out and reads answers from reader
+type wizardPrompter struct {
+	reader *bufio.Reader
+	out    io.Writer
+}
+
+func (p *wizardPrompter) run(cmd *cobra.Command) (*wizardAnswers, error) {
+	ctx := cmd.Context()
+	answers := &wizardAnswers{}
+
+	answers.Namespace = p.choose("Namespace", getNamespaces(ctx), currentNamespace(ctx))
+
+	pods := append([]string{"<standalone>"}, getPodsInNamespace(ctx, answers.Namespace)...)
+	if target := p.choose("Target pod", pods, "<standalone>"); target != "<standalone>" {
+		answers.PodName = target
+		answers.CopyPod = p.choose("Debug mode", []string{"ephemeral", "copy"}, "ephemeral") == "copy"
+	}
+
+	answers.Image = p.choose("Image", getImages(), image)
+
+	defaultProfile := profile
+	if defaultProfile == "" {
+		defaultProfile = "general"
+	}
+	answers.Profile = p.choose("Security profile", validProfiles, defaultProfile)
+	if err := validateProfile(answers.Profile); err != nil {
+		return nil, err
+	}
+
+	answers.MemoryLimit = p.ask("Memory limit", memoryLimit)
+	answers.CPURequest = p.ask("CPU request", cpuRequest)
+	answers.MemoryRequest = p.ask("Memory request", memoryRequest)
+	resources := &DebugConfig{MemoryLimit: answers.MemoryLimit, CPURequest: answers.CPURequest, MemoryRequest: answers.MemoryRequest}
+	if _, err := resources.debugResources(); err != nil {
+		return nil, err
+	}
+
+	answers.RemoveAfter = p.confirm("Remove the debug pod when the session ends?", true)
+	return answers, nil
+}
+
+// ask prints a question and returns the answer, or def when left empty
+func (p *wizardPrompter) ask(question, def string) string {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+
+	response, err := p.reader.ReadString('\n')
+	response = strings.TrimSpace(response)
+	if err != nil && response == "" {
+		return def
+	}
+	if response == "" {
+		return def
+	}
+	return response
+}
+
+// choose offers numbered options; the answer may be a number or a free value
+func (p *wizardPrompter) choose(question string, options []string, def string) string {
+	fmt.Fprintf(p.out, "%s:\n", question)
+	for i, option := range options {
+		fmt.Fprintf(p.out, "[%d] %s\n", i+1, option)
+	}
+
+	response := p.ask("Choose", def)
+	if index, err := strconv.Atoi(response); err == nil && index >= 1 && index <= len(options) {
+		return options[index-1]
+	}
+	return response
+}
+
+// confirm asks a yes/no question
+func (p *wizardPrompter) confirm(question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+
+	response := strings.ToLower(p.ask(fmt.Sprintf("%s (%s)", question, hint), ""))
+	switch response {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	default:
+		return def
+	}
+}
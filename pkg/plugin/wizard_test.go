@@ -0,0 +1,77 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestWizardPrompter(t *testing.T) {
+	origRunner, oldNamespace, oldNoCache := defaultRunner, namespace, noCache
+	defer func() {
+		defaultRunner, namespace, noCache = origRunner, oldNamespace, oldNoCache
+		loadedConfig = nil
+	}()
+	defaultRunner = &fakeRunner{outputs: map[string]string{
+		"kubectl get namespaces -o jsonpath={.items[*].metadata.name}":       "default payments",
+		"kubectl get pods -n payments -o jsonpath={.items[*].metadata.name}": "api-0 api-1",
+		"kubectl get pods -n default -o jsonpath={.items[*].metadata.name}":  "web-0",
+	}}
+	namespace, noCache = "default", true
+	loadedConfig = &Config{}
+
+	tests := []struct {
+		name   string
+		script string
+		want   *wizardAnswers
+		err    string
+	}{
+		{
+			name:   "defaults",
+			script: "\n\n\n\n\n\n\n\n",
+			want: &wizardAnswers{Namespace: "default", Image: image, Profile: "general",
+				MemoryLimit: memoryLimit, CPURequest: cpuRequest, MemoryRequest: memoryRequest, RemoveAfter: true},
+		},
+		{
+			name:   "numbered and free answers",
+			script: "2\n3\n2\nregistry.internal/tools:1\n4\n256Mi\n200m\n64Mi\nno\n",
+			want: &wizardAnswers{Namespace: "payments", PodName: "api-1", CopyPod: true, Image: "registry.internal/tools:1",
+				Profile: "netadmin", MemoryLimit: "256Mi", CPURequest: "200m", MemoryRequest: "64Mi"},
+		},
+		{
+			name:   "invalid profile",
+			script: "\n\n\nroot\n",
+			err:    "profile",
+		},
+		{
+			name:   "invalid resource",
+			script: "\n\n\n\nlots\n\n\n",
+			err:    "memory-limit",
+		},
+		{
+			name:   "out of range number is a free value",
+			script: "\n\n\n9\n",
+			err:    "profile",
+		},
+	}
+	for _, tt := range tests {
+		cmd := &cobra.Command{}
+		cmd.SetContext(context.Background())
+		prompter := &wizardPrompter{reader: bufio.NewReader(strings.NewReader(tt.script)), out: io.Discard}
+		got, err := prompter.run(cmd)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: run() = %+v, %v, want an error about %s", tt.name, got, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: run() = %+v, %v, want %+v", tt.name, got, err, tt.want)
+		}
+	}
+}